@@ -1,17 +1,176 @@
 package upload
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
 	"github.com/alecthomas/kingpin"
 	"github.com/apex/log"
 	"github.com/ooni/probe-cli/v3/cmd/ooniprobe/internal/cli/root"
+	"github.com/ooni/probe-cli/v3/cmd/ooniprobe/internal/database"
+	"github.com/ooni/probe-cli/v3/cmd/ooniprobe/internal/ooni"
+	"github.com/ooni/probe-cli/v3/cmd/ooniprobe/internal/output"
+	"github.com/ooni/probe-cli/v3/internal/engine"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"upper.io/db.v3/lib/sqlbuilder"
 )
 
+// errNothingToUpload indicates that we did not find any measurement
+// matching the user selection that still needs to be uploaded.
+var errNothingToUpload = errors.New("no measurements to upload")
+
+// errUploadFailed indicates that we could not upload some measurements.
+var errUploadFailed = errors.New("failed to upload some measurements")
+
+// readMeasurement reads the measurement saved on disk at the given path.
+func readMeasurement(filepath string) (*model.Measurement, error) {
+	data, err := os.ReadFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	var m model.Measurement
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// uploadMeasurements submits to the OONI collector every measurement that
+// is done but was not uploaded. When resultID is positive, we only upload
+// the measurements belonging to such result. When msmtID is positive, we
+// only upload the measurement with such ID. Failures to upload specific
+// measurements are logged and recorded into the database, and cause this
+// function to return an error wrapping errUploadFailed at the end.
+func uploadMeasurements(probe *ooni.Probe, resultID, msmtID int64) error {
+	msmts, err := database.ListMeasurementsToUpload(probe.DB(), resultID, msmtID)
+	if err != nil {
+		log.WithError(err).Error("failed to list measurements to upload")
+		return err
+	}
+	if len(msmts) <= 0 {
+		log.Info("no measurements to upload")
+		if msmtID > 0 || resultID > 0 {
+			return errNothingToUpload
+		}
+		return nil
+	}
+	ctx := context.Background()
+	sess, err := probe.NewSession(ctx)
+	if err != nil {
+		log.WithError(err).Error("failed to create a measurement session")
+		return err
+	}
+	defer sess.Close()
+	if err := sess.MaybeLookupBackends(); err != nil {
+		log.WithError(err).Error("failed to discover OONI backends")
+		return err
+	}
+	submitter, err := sess.NewSubmitter(ctx)
+	if err != nil {
+		log.WithError(err).Error("failed to create a measurement submitter")
+		return err
+	}
+	probe.ListenForSignals()
+	probe.MaybeListenForStdinClosed()
+	return submitMeasurements(ctx, probe, submitter, msmts)
+}
+
+// submitProbe is the part of ooni.Probe used by submitMeasurements.
+type submitProbe interface {
+	DB() sqlbuilder.Database
+	IsTerminated() bool
+}
+
+// submitMeasurements submits msmts using submitter and updates the database
+// accordingly. We return an error wrapping errUploadFailed if we could not
+// upload some measurements, after trying to upload all of them.
+func submitMeasurements(ctx context.Context, probe submitProbe,
+	submitter engine.Submitter, msmts []database.MeasurementURLNetwork) error {
+	results := make(map[int64]database.Result)
+	var numUploaded, numFailed int
+	for idx, msmt := range msmts {
+		if probe.IsTerminated() {
+			log.Info("user requested us to terminate using Ctrl-C")
+			break
+		}
+		perc := float64(idx) / float64(len(msmts))
+		output.Progress("upload", perc, -1, fmt.Sprintf(
+			"uploading measurement #%d (%s)", msmt.Measurement.ID, msmt.TestName))
+		results[msmt.Result.ID] = msmt.Result
+		// The JOIN assigns the columns shared by several tables to only one of
+		// the inline structs, so we restore the foreign keys of the measurement
+		// before uploadMeasurement writes it back into the database.
+		if msmt.Measurement.ResultID == 0 {
+			msmt.Measurement.ResultID = msmt.Result.ID
+		}
+		if !msmt.Measurement.URLID.Valid {
+			msmt.Measurement.URLID = msmt.URL.ID
+		}
+		if err := uploadMeasurement(ctx, probe.DB(), submitter, &msmt.Measurement); err != nil {
+			log.WithError(err).Errorf("failed to upload measurement #%d", msmt.Measurement.ID)
+			numFailed++
+			continue
+		}
+		numUploaded++
+	}
+	for _, result := range results {
+		result := result // make a copy
+		if err := database.UpdateUploadedStatus(probe.DB(), &result); err != nil {
+			log.WithError(err).Warnf("failed to update upload status of result #%d", result.ID)
+		}
+	}
+	output.Progress("upload", 1.0, -1, fmt.Sprintf(
+		"uploaded %d measurements; %d failed", numUploaded, numFailed))
+	if numFailed > 0 {
+		return fmt.Errorf("%w: %d out of %d", errUploadFailed, numFailed, numFailed+numUploaded)
+	}
+	return nil
+}
+
+// uploadMeasurement submits a single measurement and updates the database
+// to reflect whether the submission succeeded or failed. On success, we also
+// remove the measurement file, like we do when we upload a measurement right
+// after measuring, because the file would otherwise contain a stale report
+// ID and we can fetch the uploaded measurement from the OONI API.
+func uploadMeasurement(ctx context.Context, sess sqlbuilder.Database,
+	submitter engine.Submitter, msmt *database.Measurement) error {
+	m, err := readMeasurement(msmt.MeasurementFilePath.String)
+	if err != nil {
+		return err
+	}
+	if err := submitter.Submit(ctx, m); err != nil {
+		if err := msmt.UploadFailed(sess, err.Error()); err != nil {
+			log.WithError(err).Warn("failed to mark upload as failed")
+		}
+		return err
+	}
+	msmt.ReportID = sql.NullString{String: m.ReportID, Valid: true}
+	if err := msmt.UploadSucceeded(sess); err != nil {
+		log.WithError(err).Warn("failed to mark upload as succeeded")
+		return err
+	}
+	log.Infof("measurement #%d uploaded with report ID %s", msmt.ID, m.ReportID)
+	if err := os.Remove(msmt.MeasurementFilePath.String); err != nil {
+		log.WithError(err).Warn("failed to remove the uploaded measurement file")
+	}
+	return nil
+}
+
 func init() {
-	cmd := root.Command("upload", "Upload a specific measurement")
+	cmd := root.Command("upload", "Upload measurements that were not submitted to the collector")
+	resultID := cmd.Flag("result-id", "only upload measurements belonging to this result").Int64()
+	msmtID := cmd.Flag("measurement-id", "only upload the measurement with this ID").Int64()
 
 	cmd.Action(func(_ *kingpin.ParseContext) error {
-		log.Info("Uploading")
-		log.Error("this function is not implemented")
-		return nil
+		probe, err := root.Init()
+		if err != nil {
+			log.WithError(err).Error("failed to initialize root context")
+			return err
+		}
+		return uploadMeasurements(probe, *resultID, *msmtID)
 	})
 }
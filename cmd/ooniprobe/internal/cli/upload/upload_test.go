@@ -0,0 +1,133 @@
+package upload
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ooni/probe-cli/v3/cmd/ooniprobe/internal/database"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"upper.io/db.v3/lib/sqlbuilder"
+)
+
+type fakeLocation struct{}
+
+func (*fakeLocation) ProbeASN() uint           { return 30722 }
+func (*fakeLocation) ProbeASNString() string   { return "AS30722" }
+func (*fakeLocation) ProbeCC() string          { return "IT" }
+func (*fakeLocation) ProbeIP() string          { return "127.0.0.1" }
+func (*fakeLocation) ProbeNetworkName() string { return "Vodafone Italia" }
+func (*fakeLocation) ResolverIP() string       { return "127.0.0.2" }
+
+type fakeProbe struct {
+	db sqlbuilder.Database
+}
+
+func (p *fakeProbe) DB() sqlbuilder.Database { return p.db }
+
+func (p *fakeProbe) IsTerminated() bool { return false }
+
+type fakeSubmitter struct {
+	err error
+}
+
+func (s *fakeSubmitter) Submit(ctx context.Context, m *model.Measurement) error {
+	m.ReportID = "20211110T144410Z_urlgetter_IT_30722_n1_abcdef"
+	return s.err
+}
+
+// newMeasurementsToUpload creates a database containing two measurements to
+// upload and writes the first one on disk. It returns the measurements.
+func newMeasurementsToUpload(t *testing.T) (*fakeProbe, []database.MeasurementURLNetwork) {
+	tmpdir := t.TempDir()
+	sess, err := database.Connect(filepath.Join(tmpdir, "main.sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	network, err := database.CreateNetwork(sess, &fakeLocation{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := database.CreateResult(sess, tmpdir, "websites", network.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reportID := sql.NullString{String: "", Valid: false}
+	urlID := sql.NullInt64{Int64: 0, Valid: false}
+	for idx := 0; idx < 2; idx++ {
+		msmt, err := database.CreateMeasurement(
+			sess, reportID, "urlgetter", result.MeasurementDir, idx, result.ID, urlID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := msmt.Done(sess); err != nil {
+			t.Fatal(err)
+		}
+		if idx == 0 {
+			data := []byte(`{"test_name":"urlgetter"}`)
+			if err := os.WriteFile(msmt.MeasurementFilePath.String, data, 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	msmts, err := database.ListMeasurementsToUpload(sess, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msmts) != 2 {
+		t.Fatal("unexpected number of measurements", len(msmts))
+	}
+	return &fakeProbe{db: sess}, msmts
+}
+
+func TestSubmitMeasurements(t *testing.T) {
+	t.Run("when we cannot read a measurement", func(t *testing.T) {
+		probe, msmts := newMeasurementsToUpload(t)
+		err := submitMeasurements(context.Background(), probe, &fakeSubmitter{}, msmts)
+		if !errors.Is(err, errUploadFailed) {
+			t.Fatal("unexpected err", err)
+		}
+		pending, err := database.ListMeasurementsToUpload(probe.DB(), 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pending) != 1 || pending[0].Measurement.ID != msmts[1].Measurement.ID {
+			t.Fatal("unexpected pending measurements", pending)
+		}
+	})
+
+	t.Run("when the submitter fails", func(t *testing.T) {
+		probe, msmts := newMeasurementsToUpload(t)
+		expected := errors.New("mocked error")
+		err := submitMeasurements(
+			context.Background(), probe, &fakeSubmitter{err: expected}, msmts[:1])
+		if !errors.Is(err, errUploadFailed) {
+			t.Fatal("unexpected err", err)
+		}
+		if _, err := os.Stat(msmts[0].Measurement.MeasurementFilePath.String); err != nil {
+			t.Fatal("expected the measurement file to still exist", err)
+		}
+	})
+
+	t.Run("when all the uploads succeed", func(t *testing.T) {
+		probe, msmts := newMeasurementsToUpload(t)
+		err := submitMeasurements(context.Background(), probe, &fakeSubmitter{}, msmts[:1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		pending, err := database.ListMeasurementsToUpload(probe.DB(), 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pending) != 1 || pending[0].Measurement.ID != msmts[1].Measurement.ID {
+			t.Fatal("unexpected pending measurements", pending)
+		}
+		_, err = os.Stat(msmts[0].Measurement.MeasurementFilePath.String)
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Fatal("expected the measurement file to be removed", err)
+		}
+	})
+}
@@ -6,7 +6,16 @@ type Sharing struct {
 }
 
 // Advanced settings
-type Advanced struct{}
+type Advanced struct {
+	// TLSSplit is the strategy for splitting the TLS ClientHello sent
+	// by the session's HTTP client (one of: sni_segments, 8_4_rest,
+	// random_32_64, record_fragment). When empty, we do not split.
+	TLSSplit string `json:"tls_split,omitempty"`
+
+	// TLSSplitDelay is the number of milliseconds to wait
+	// between the segments of the split ClientHello.
+	TLSSplitDelay int64 `json:"tls_split_delay,omitempty"`
+}
 
 // Nettests related settings
 type Nettests struct {
@@ -40,6 +40,44 @@ func ListMeasurements(sess sqlbuilder.Database, resultID int64) ([]MeasurementUR
 	return measurements, nil
 }
 
+// ListMeasurementsToUpload returns the measurements that completed
+// successfully but have not been uploaded to the collector, e.g.,
+// because we ran with --no-collector or we were offline. When resultID
+// is positive, we only return measurements belonging to such result. When
+// msmtID is positive, we only return the measurement with such ID.
+func ListMeasurementsToUpload(
+	sess sqlbuilder.Database, resultID, msmtID int64) ([]MeasurementURLNetwork, error) {
+	measurements := []MeasurementURLNetwork{}
+	conds := db.And(
+		db.Cond{"measurements.measurement_is_done": true},
+		db.Cond{"measurements.measurement_is_failed": false},
+		db.Cond{"measurements.measurement_is_uploaded": false},
+		db.Cond{"measurements.measurement_file_path IS NOT": nil},
+	)
+	if resultID > 0 {
+		conds = conds.And(db.Cond{"measurements.result_id": resultID})
+	}
+	if msmtID > 0 {
+		conds = conds.And(db.Cond{"measurements.measurement_id": msmtID})
+	}
+	req := sess.Select(
+		db.Raw("networks.*"),
+		db.Raw("urls.*"),
+		db.Raw("measurements.*"),
+		db.Raw("results.*"),
+	).From("results").
+		Join("measurements").On("results.result_id = measurements.result_id").
+		Join("networks").On("results.network_id = networks.network_id").
+		LeftJoin("urls").On("urls.url_id = measurements.url_id").
+		OrderBy("measurements.measurement_start_time").
+		Where(conds)
+	if err := req.All(&measurements); err != nil {
+		log.Errorf("failed to run query %s: %v", req.String(), err)
+		return measurements, err
+	}
+	return measurements, nil
+}
+
 // GetMeasurementJSON returns a map[string]interface{} given a database and a measurementID
 func GetMeasurementJSON(sess sqlbuilder.Database, measurementID int64) (map[string]interface{}, error) {
 	var (
@@ -395,3 +395,124 @@ func TestGetMeasurementJSON(t *testing.T) {
 		t.Error("inconsistent measurement downloaded")
 	}
 }
+
+func TestListMeasurementsToUpload(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "dbtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	tmpdir, err := ioutil.TempDir("", "oonitest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	sess, err := Connect(tmpfile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	location := locationInfo{
+		asn:         0,
+		countryCode: "IT",
+		networkName: "Unknown",
+	}
+	network, err := CreateNetwork(sess, &location)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r1, err := CreateResult(sess, tmpdir, "websites", network.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := CreateResult(sess, tmpdir, "im", network.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reportID := sql.NullString{String: "", Valid: false}
+	urlID := sql.NullInt64{Int64: 0, Valid: false}
+
+	// m1 has been uploaded, m2 failed, m3 is not done, m4 and m5 are pending
+	m1, err := CreateMeasurement(sess, reportID, "antani", tmpdir, 0, r1.ID, urlID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m1.Done(sess); err != nil {
+		t.Fatal(err)
+	}
+	if err := m1.UploadSucceeded(sess); err != nil {
+		t.Fatal(err)
+	}
+	m2, err := CreateMeasurement(sess, reportID, "antani", tmpdir, 1, r1.ID, urlID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m2.Failed(sess, "generic_timeout_error"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m2.Done(sess); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateMeasurement(sess, reportID, "antani", tmpdir, 2, r1.ID, urlID); err != nil {
+		t.Fatal(err)
+	}
+	m4, err := CreateMeasurement(sess, reportID, "antani", tmpdir, 3, r1.ID, urlID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m4.Done(sess); err != nil {
+		t.Fatal(err)
+	}
+	if err := m4.UploadFailed(sess, "connection_refused"); err != nil {
+		t.Fatal(err)
+	}
+	m5, err := CreateMeasurement(sess, reportID, "mascetti", tmpdir, 0, r2.ID, urlID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m5.Done(sess); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := ListMeasurementsToUpload(sess, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Fatal("expected two measurements to upload, got", len(all))
+	}
+	if all[0].Measurement.ID != m4.ID || all[1].Measurement.ID != m5.ID {
+		t.Fatal("unexpected measurements to upload")
+	}
+	if all[1].Result.TestGroupName != "im" {
+		t.Fatal("expected the result to be joined")
+	}
+
+	byResult, err := ListMeasurementsToUpload(sess, r2.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byResult) != 1 || byResult[0].Measurement.ID != m5.ID {
+		t.Fatal("unexpected measurements to upload for result")
+	}
+
+	byMsmt, err := ListMeasurementsToUpload(sess, 0, m4.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byMsmt) != 1 || byMsmt[0].Measurement.ID != m4.ID {
+		t.Fatal("unexpected measurement to upload")
+	}
+
+	none, err := ListMeasurementsToUpload(sess, 0, m1.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(none) != 0 {
+		t.Fatal("expected no measurements to upload")
+	}
+}
@@ -1,12 +1,11 @@
 package database
 
 import (
-	"context"
 	"database/sql"
 	"embed"
 
 	"github.com/apex/log"
-	"github.com/ooni/probe-cli/v3/internal/netxlite"
+	"github.com/ooni/probe-cli/v3/internal/fsx"
 	migrate "github.com/rubenv/sql-migrate"
 	"upper.io/db.v3/lib/sqlbuilder"
 	"upper.io/db.v3/sqlite"
@@ -15,32 +14,12 @@ import (
 //go:embed migrations/*.sql
 var efs embed.FS
 
-func readAsset(path string) ([]byte, error) {
-	filep, err := efs.Open(path)
-	if err != nil {
-		return nil, err
-	}
-	return netxlite.ReadAllContext(context.Background(), filep)
-}
-
-func readAssetDir(path string) ([]string, error) {
-	var out []string
-	lst, err := efs.ReadDir(path)
-	if err != nil {
-		return nil, err
-	}
-	for _, e := range lst {
-		out = append(out, e.Name())
-	}
-	return out, nil
-}
-
 // RunMigrations runs the database migrations
 func RunMigrations(db *sql.DB) error {
 	log.Debugf("running migrations")
 	migrations := &migrate.AssetMigrationSource{
-		Asset:    readAsset,
-		AssetDir: readAssetDir,
+		Asset:    fsx.ReadAssetFunc(efs),
+		AssetDir: fsx.ReadAssetDirFunc(efs),
 		Dir:      "migrations",
 	}
 	n, err := migrate.Exec(db, "sqlite3", migrations, migrate.Up)
@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/apex/log"
 	"github.com/ooni/probe-cli/v3/cmd/ooniprobe/internal/config"
@@ -17,6 +18,7 @@ import (
 	"github.com/ooni/probe-cli/v3/internal/engine"
 	"github.com/ooni/probe-cli/v3/internal/engine/legacy/assetsdir"
 	"github.com/ooni/probe-cli/v3/internal/kvstore"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
 	"github.com/pkg/errors"
 	"upper.io/db.v3/lib/sqlbuilder"
 )
@@ -215,10 +217,24 @@ func (p *Probe) NewSession(ctx context.Context) (*engine.Session, error) {
 		SoftwareName:    p.softwareName,
 		SoftwareVersion: p.softwareVersion,
 		TempDir:         p.tempDir,
+		TLSSplit:        p.tlsSplitConfig(),
 		TunnelDir:       p.tunnelDir,
 	})
 }
 
+// tlsSplitConfig returns the config for splitting the ClientHello
+// sent by the session or nil if the user did not configure splitting.
+func (p *Probe) tlsSplitConfig() *netxlite.TLSSplitConfig {
+	advanced := p.config.Advanced
+	if advanced.TLSSplit == "" {
+		return nil
+	}
+	return &netxlite.TLSSplitConfig{
+		Strategy: advanced.TLSSplit,
+		Delay:    time.Duration(advanced.TLSSplitDelay) * time.Millisecond,
+	}
+}
+
 // NewProbeEngine creates a new ProbeEngine instance.
 func (p *Probe) NewProbeEngine(ctx context.Context) (ProbeEngine, error) {
 	sess, err := p.NewSession(ctx)
@@ -5,6 +5,10 @@ import (
 	"os"
 	"path"
 	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
 )
 
 func TestInit(t *testing.T) {
@@ -27,3 +31,25 @@ func TestInit(t *testing.T) {
 		t.Fatal("config file was not created")
 	}
 }
+
+func TestTLSSplitConfig(t *testing.T) {
+	t.Run("without a configured strategy", func(t *testing.T) {
+		probe := NewProbe("", "")
+		if probe.tlsSplitConfig() != nil {
+			t.Fatal("expected nil config")
+		}
+	})
+
+	t.Run("with a configured strategy", func(t *testing.T) {
+		probe := NewProbe("", "")
+		probe.config.Advanced.TLSSplit = netxlite.TLSSplitRecordFragment
+		probe.config.Advanced.TLSSplitDelay = 10
+		expected := &netxlite.TLSSplitConfig{
+			Strategy: netxlite.TLSSplitRecordFragment,
+			Delay:    10 * time.Millisecond,
+		}
+		if diff := cmp.Diff(expected, probe.tlsSplitConfig()); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
@@ -15,10 +15,15 @@ import (
 
 // NetworkEvent contains a network event. This kind of events
 // are generated by Dialer, QUICDialer, Conn, QUICConn.
+//
+// The Data and LocalAddr fields allow to synthesize the packets
+// of the measurement (see internal/engine/netx/pcapng).
 type NetworkEvent struct {
 	Count      int
+	Data       []byte
 	Failure    error
 	Finished   time.Time
+	LocalAddr  string
 	Network    string
 	Operation  string
 	RemoteAddr string
@@ -35,6 +40,7 @@ func (s *Saver) DialContext(ctx context.Context,
 		Count:      0,
 		Failure:    err,
 		Finished:   time.Now(),
+		LocalAddr:  s.safeConnLocalAddr(conn),
 		Network:    network,
 		Operation:  netxlite.ConnectOperation,
 		RemoteAddr: address,
@@ -51,8 +57,10 @@ func (s *Saver) Read(conn net.Conn, buf []byte) (int, error) {
 	count, err := conn.Read(buf)
 	s.appendNetworkEvent(&NetworkEvent{
 		Count:      count,
+		Data:       append([]byte{}, buf[:count]...), // the caller may reuse buf
 		Failure:    err,
 		Finished:   time.Now(),
+		LocalAddr:  s.safeAddrString(conn.LocalAddr()),
 		Network:    network,
 		Operation:  netxlite.ReadOperation,
 		RemoteAddr: remoteAddr,
@@ -69,8 +77,10 @@ func (s *Saver) Write(conn net.Conn, buf []byte) (int, error) {
 	count, err := conn.Write(buf)
 	s.appendNetworkEvent(&NetworkEvent{
 		Count:      count,
+		Data:       append([]byte{}, buf[:count]...), // the caller may reuse buf
 		Failure:    err,
 		Finished:   time.Now(),
+		LocalAddr:  s.safeAddrString(conn.LocalAddr()),
 		Network:    network,
 		Operation:  netxlite.WriteOperation,
 		RemoteAddr: remoteAddr,
@@ -79,6 +89,15 @@ func (s *Saver) Write(conn net.Conn, buf []byte) (int, error) {
 	return count, err
 }
 
+// safeConnLocalAddr returns the local address of conn or an
+// empty string if conn is nil (e.g., because dialing failed).
+func (s *Saver) safeConnLocalAddr(conn net.Conn) (out string) {
+	if conn != nil {
+		out = s.safeAddrString(conn.LocalAddr())
+	}
+	return
+}
+
 func (s *Saver) appendNetworkEvent(ev *NetworkEvent) {
 	s.mu.Lock()
 	s.trace.Network = append(s.trace.Network, ev)
@@ -1,6 +1,7 @@
 package archival
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"io"
@@ -17,6 +18,9 @@ func TestSaverDialContext(t *testing.T) {
 	// newConn creates a new connection with the desired properties.
 	newConn := func(address string) net.Conn {
 		return &mocks.Conn{
+			MockLocalAddr: func() net.Addr {
+				return &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 54321}
+			},
 			MockRemoteAddr: func() net.Addr {
 				return &mocks.Addr{
 					MockString: func() string {
@@ -47,6 +51,7 @@ func TestSaverDialContext(t *testing.T) {
 		v := &SingleNetworkEventValidator{
 			ExpectedCount:   0,
 			ExpectedErr:     nil,
+			ExpectedLocal:   "10.0.0.1:54321",
 			ExpectedNetwork: "tcp",
 			ExpectedOp:      netxlite.ConnectOperation,
 			ExpectedEpnt:    mockedEndpoint,
@@ -97,6 +102,9 @@ func TestSaverRead(t *testing.T) {
 	// newConn is a helper function for creating a new connection.
 	newConn := func(endpoint string, numBytes int, err error) net.Conn {
 		return &mocks.Conn{
+			MockLocalAddr: func() net.Addr {
+				return &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 54321}
+			},
 			MockRead: func(b []byte) (int, error) {
 				time.Sleep(time.Microsecond)
 				return numBytes, err
@@ -121,7 +129,9 @@ func TestSaverRead(t *testing.T) {
 		saver := NewSaver()
 		v := &SingleNetworkEventValidator{
 			ExpectedCount:   mockedNumBytes,
+			ExpectedData:    make([]byte, mockedNumBytes),
 			ExpectedErr:     nil,
+			ExpectedLocal:   "10.0.0.1:54321",
 			ExpectedNetwork: "tcp",
 			ExpectedOp:      netxlite.ReadOperation,
 			ExpectedEpnt:    mockedEndpoint,
@@ -148,6 +158,7 @@ func TestSaverRead(t *testing.T) {
 		v := &SingleNetworkEventValidator{
 			ExpectedCount:   0,
 			ExpectedErr:     mockedError,
+			ExpectedLocal:   "10.0.0.1:54321",
 			ExpectedNetwork: "tcp",
 			ExpectedOp:      netxlite.ReadOperation,
 			ExpectedEpnt:    mockedEndpoint,
@@ -171,6 +182,9 @@ func TestSaverWrite(t *testing.T) {
 	// newConn is a helper function for creating a new connection.
 	newConn := func(endpoint string, numBytes int, err error) net.Conn {
 		return &mocks.Conn{
+			MockLocalAddr: func() net.Addr {
+				return &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 54321}
+			},
 			MockWrite: func(b []byte) (int, error) {
 				time.Sleep(time.Microsecond)
 				return numBytes, err
@@ -195,7 +209,9 @@ func TestSaverWrite(t *testing.T) {
 		saver := NewSaver()
 		v := &SingleNetworkEventValidator{
 			ExpectedCount:   mockedNumBytes,
+			ExpectedData:    make([]byte, mockedNumBytes),
 			ExpectedErr:     nil,
+			ExpectedLocal:   "10.0.0.1:54321",
 			ExpectedNetwork: "tcp",
 			ExpectedOp:      netxlite.WriteOperation,
 			ExpectedEpnt:    mockedEndpoint,
@@ -222,6 +238,7 @@ func TestSaverWrite(t *testing.T) {
 		v := &SingleNetworkEventValidator{
 			ExpectedCount:   0,
 			ExpectedErr:     mockedError,
+			ExpectedLocal:   "10.0.0.1:54321",
 			ExpectedNetwork: "tcp",
 			ExpectedOp:      netxlite.WriteOperation,
 			ExpectedEpnt:    mockedEndpoint,
@@ -246,7 +263,9 @@ func TestSaverWrite(t *testing.T) {
 // an event contains the required field values.
 type SingleNetworkEventValidator struct {
 	ExpectedCount   int
+	ExpectedData    []byte
 	ExpectedErr     error
+	ExpectedLocal   string
 	ExpectedNetwork string
 	ExpectedOp      string
 	ExpectedEpnt    string
@@ -262,12 +281,18 @@ func (v *SingleNetworkEventValidator) Validate() error {
 	if entry.Count != v.ExpectedCount {
 		return errors.New("expected to see a different .Count")
 	}
+	if !bytes.Equal(entry.Data, v.ExpectedData) {
+		return errors.New("expected to see different .Data")
+	}
 	if !errors.Is(entry.Failure, v.ExpectedErr) {
 		return errors.New("unexpected .Failure")
 	}
 	if !entry.Finished.After(entry.Started) {
 		return errors.New(".Finished should be after .Started")
 	}
+	if entry.LocalAddr != v.ExpectedLocal {
+		return errors.New("unexpected value for .LocalAddr")
+	}
 	if entry.Network != v.ExpectedNetwork {
 		return errors.New("invalid value for .Network")
 	}
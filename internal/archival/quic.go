@@ -22,8 +22,10 @@ func (s *Saver) WriteTo(pconn model.UDPLikeConn, buf []byte, addr net.Addr) (int
 	count, err := pconn.WriteTo(buf, addr)
 	s.appendNetworkEvent(&NetworkEvent{
 		Count:      count,
+		Data:       append([]byte{}, buf[:count]...), // the caller may reuse buf
 		Failure:    err,
 		Finished:   time.Now(),
+		LocalAddr:  s.safeAddrString(pconn.LocalAddr()),
 		Network:    addr.Network(),
 		Operation:  netxlite.WriteToOperation,
 		RemoteAddr: addr.String(),
@@ -39,8 +41,10 @@ func (s *Saver) ReadFrom(pconn model.UDPLikeConn, buf []byte) (int, net.Addr, er
 	count, addr, err := pconn.ReadFrom(buf)
 	s.appendNetworkEvent(&NetworkEvent{
 		Count:      count,
+		Data:       append([]byte{}, buf[:count]...), // the caller may reuse buf
 		Failure:    err,
 		Finished:   time.Now(),
+		LocalAddr:  s.safeAddrString(pconn.LocalAddr()),
 		Network:    "udp", // must be always set even on failure
 		Operation:  netxlite.ReadFromOperation,
 		RemoteAddr: s.safeAddrString(addr),
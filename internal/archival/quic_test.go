@@ -35,6 +35,9 @@ func TestSaverWriteTo(t *testing.T) {
 	// newConn is a helper function for creating a new connection.
 	newConn := func(numBytes int, err error) model.UDPLikeConn {
 		return &mocks.UDPLikeConn{
+			MockLocalAddr: func() net.Addr {
+				return &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 54321}
+			},
 			MockWriteTo: func(p []byte, addr net.Addr) (int, error) {
 				time.Sleep(time.Microsecond)
 				return numBytes, err
@@ -50,7 +53,9 @@ func TestSaverWriteTo(t *testing.T) {
 		saver := NewSaver()
 		v := &SingleNetworkEventValidator{
 			ExpectedCount:   mockedNumBytes,
+			ExpectedData:    make([]byte, mockedNumBytes),
 			ExpectedErr:     nil,
+			ExpectedLocal:   "10.0.0.1:54321",
 			ExpectedNetwork: "udp",
 			ExpectedOp:      netxlite.WriteToOperation,
 			ExpectedEpnt:    mockedEndpoint,
@@ -78,6 +83,7 @@ func TestSaverWriteTo(t *testing.T) {
 		v := &SingleNetworkEventValidator{
 			ExpectedCount:   0,
 			ExpectedErr:     mockedError,
+			ExpectedLocal:   "10.0.0.1:54321",
 			ExpectedNetwork: "udp",
 			ExpectedOp:      netxlite.WriteToOperation,
 			ExpectedEpnt:    mockedEndpoint,
@@ -113,6 +119,9 @@ func TestSaverReadFrom(t *testing.T) {
 	// newConn is a helper function for creating a new connection.
 	newConn := func(numBytes int, addr net.Addr, err error) model.UDPLikeConn {
 		return &mocks.UDPLikeConn{
+			MockLocalAddr: func() net.Addr {
+				return &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 54321}
+			},
 			MockReadFrom: func(p []byte) (int, net.Addr, error) {
 				time.Sleep(time.Microsecond)
 				return numBytes, addr, err
@@ -128,7 +137,9 @@ func TestSaverReadFrom(t *testing.T) {
 		saver := NewSaver()
 		v := &SingleNetworkEventValidator{
 			ExpectedCount:   mockedNumBytes,
+			ExpectedData:    make([]byte, mockedNumBytes),
 			ExpectedErr:     nil,
+			ExpectedLocal:   "10.0.0.1:54321",
 			ExpectedNetwork: "udp",
 			ExpectedOp:      netxlite.ReadFromOperation,
 			ExpectedEpnt:    mockedEndpoint,
@@ -160,6 +171,7 @@ func TestSaverReadFrom(t *testing.T) {
 		v := &SingleNetworkEventValidator{
 			ExpectedCount:   0,
 			ExpectedErr:     mockedError,
+			ExpectedLocal:   "10.0.0.1:54321",
 			ExpectedNetwork: "udp",
 			ExpectedOp:      netxlite.ReadFromOperation,
 			ExpectedEpnt:    "",
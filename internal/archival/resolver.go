@@ -6,6 +6,7 @@ package archival
 
 import (
 	"context"
+	"net"
 	"time"
 
 	"github.com/ooni/probe-cli/v3/internal/model"
@@ -19,6 +20,7 @@ type DNSLookupEvent struct {
 	Failure         error
 	Finished        time.Time
 	LookupType      string
+	Records         []*model.DNSRecord
 	ResolverAddress string
 	ResolverNetwork string
 	Started         time.Time
@@ -74,6 +76,99 @@ func (s *Saver) appendLookupHTTPSEvent(ev *DNSLookupEvent) {
 	s.mu.Unlock()
 }
 
+// LookupSVCB is like LookupHTTPS but performs an SVCB lookup.
+func (s *Saver) LookupSVCB(ctx context.Context, reso model.Resolver, domain string) (*model.HTTPSSvc, error) {
+	started := time.Now()
+	svcb, err := reso.LookupSVCB(ctx, domain)
+	s.appendLookupHTTPSEvent(&DNSLookupEvent{
+		ALPNs:           s.safeALPNs(svcb),
+		Addresses:       s.safeAddresses(svcb),
+		Domain:          domain,
+		Failure:         err,
+		Finished:        time.Now(),
+		LookupType:      "svcb",
+		ResolverAddress: reso.Address(),
+		ResolverNetwork: reso.Network(),
+		Started:         started,
+	})
+	return svcb, err
+}
+
+// LookupCNAME performs a CNAME lookup using the given resolver
+// and saves the resulting CNAME chain into the saver.
+func (s *Saver) LookupCNAME(ctx context.Context, reso model.Resolver, domain string) ([]string, error) {
+	started := time.Now()
+	cnames, err := reso.LookupCNAME(ctx, domain)
+	var records []*model.DNSRecord
+	for _, cname := range cnames {
+		records = append(records, &model.DNSRecord{Type: "CNAME", Value: cname})
+	}
+	s.appendLookupRecordsEvent(reso, domain, "cname", records, err, started)
+	return cnames, err
+}
+
+// LookupNS performs an NS lookup using the given resolver
+// and saves the results into the saver.
+func (s *Saver) LookupNS(ctx context.Context, reso model.Resolver, domain string) ([]*net.NS, error) {
+	started := time.Now()
+	nss, err := reso.LookupNS(ctx, domain)
+	var records []*model.DNSRecord
+	for _, ns := range nss {
+		records = append(records, &model.DNSRecord{Type: "NS", Value: ns.Host})
+	}
+	s.appendLookupRecordsEvent(reso, domain, "ns", records, err, started)
+	return nss, err
+}
+
+// LookupMX performs an MX lookup using the given resolver
+// and saves the results into the saver.
+func (s *Saver) LookupMX(ctx context.Context, reso model.Resolver, domain string) ([]*net.MX, error) {
+	started := time.Now()
+	mxs, err := reso.LookupMX(ctx, domain)
+	var records []*model.DNSRecord
+	for _, mx := range mxs {
+		records = append(records, &model.DNSRecord{
+			Type:       "MX",
+			Value:      mx.Host,
+			Preference: mx.Pref,
+		})
+	}
+	s.appendLookupRecordsEvent(reso, domain, "mx", records, err, started)
+	return mxs, err
+}
+
+// LookupTXT performs a TXT lookup using the given resolver
+// and saves the results into the saver.
+func (s *Saver) LookupTXT(ctx context.Context, reso model.Resolver, domain string) ([]string, error) {
+	started := time.Now()
+	txts, err := reso.LookupTXT(ctx, domain)
+	var records []*model.DNSRecord
+	for _, txt := range txts {
+		records = append(records, &model.DNSRecord{Type: "TXT", Value: txt})
+	}
+	s.appendLookupRecordsEvent(reso, domain, "txt", records, err, started)
+	return txts, err
+}
+
+func (s *Saver) appendLookupRecordsEvent(reso model.Resolver, domain, lookupType string,
+	records []*model.DNSRecord, err error, started time.Time) {
+	ev := &DNSLookupEvent{
+		ALPNs:           nil,
+		Addresses:       nil,
+		Domain:          domain,
+		Failure:         err,
+		Finished:        time.Now(),
+		LookupType:      lookupType,
+		Records:         records,
+		ResolverAddress: reso.Address(),
+		ResolverNetwork: reso.Network(),
+		Started:         started,
+	}
+	s.mu.Lock()
+	s.trace.DNSLookupRecords = append(s.trace.DNSLookupRecords, ev)
+	s.mu.Unlock()
+}
+
 func (s *Saver) safeALPNs(https *model.HTTPSSvc) (out []string) {
 	if https != nil {
 		out = https.ALPN
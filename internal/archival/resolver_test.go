@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"io"
+	"net"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -175,6 +176,164 @@ func TestSaverLookupHTTPS(t *testing.T) {
 	})
 }
 
+func TestSaverLookupSVCB(t *testing.T) {
+	expectALPN := []string{"h3", "h2"}
+	expectA := []string{"8.8.8.8"}
+	reso := &mocks.Resolver{
+		MockLookupSVCB: func(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+			return &model.HTTPSSvc{ALPN: expectALPN, IPv4: expectA}, nil
+		},
+		MockAddress: func() string {
+			return "8.8.8.8:53"
+		},
+		MockNetwork: func() string {
+			return "udp"
+		},
+	}
+	const domain = "_dns.dns.google"
+	saver := NewSaver()
+	v := &SingleDNSLookupValidator{
+		ExpectALPNs:           expectALPN,
+		ExpectAddrs:           expectA,
+		ExpectDomain:          domain,
+		ExpectLookupType:      "svcb",
+		ExpectFailure:         nil,
+		ExpectResolverAddress: "8.8.8.8:53",
+		ExpectResolverNetwork: "udp",
+		Saver:                 saver,
+	}
+	svcb, err := saver.LookupSVCB(context.Background(), reso, domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(expectALPN, svcb.ALPN); diff != "" {
+		t.Fatal(diff)
+	}
+	if err := v.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSaverLookupRecords(t *testing.T) {
+	// newResolver helps to create a new resolver.
+	newResolver := func(err error) *mocks.Resolver {
+		return &mocks.Resolver{
+			MockLookupCNAME: func(ctx context.Context, domain string) ([]string, error) {
+				if err != nil {
+					return nil, err
+				}
+				return []string{"www.example.com.", "example.com."}, nil
+			},
+			MockLookupNS: func(ctx context.Context, domain string) ([]*net.NS, error) {
+				if err != nil {
+					return nil, err
+				}
+				return []*net.NS{{Host: "a.iana-servers.net."}}, nil
+			},
+			MockLookupMX: func(ctx context.Context, domain string) ([]*net.MX, error) {
+				if err != nil {
+					return nil, err
+				}
+				return []*net.MX{{Host: "mx.example.com.", Pref: 10}}, nil
+			},
+			MockLookupTXT: func(ctx context.Context, domain string) ([]string, error) {
+				if err != nil {
+					return nil, err
+				}
+				return []string{"v=spf1 -all"}, nil
+			},
+			MockAddress: func() string {
+				return "8.8.8.8:53"
+			},
+			MockNetwork: func() string {
+				return "udp"
+			},
+		}
+	}
+
+	// lookup performs the lookup of the given type using the saver.
+	lookup := func(saver *Saver, reso model.Resolver, lookupType string) error {
+		ctx := context.Background()
+		var err error
+		switch lookupType {
+		case "cname":
+			_, err = saver.LookupCNAME(ctx, reso, "example.com")
+		case "ns":
+			_, err = saver.LookupNS(ctx, reso, "example.com")
+		case "mx":
+			_, err = saver.LookupMX(ctx, reso, "example.com")
+		case "txt":
+			_, err = saver.LookupTXT(ctx, reso, "example.com")
+		}
+		return err
+	}
+
+	expectRecords := map[string][]*model.DNSRecord{
+		"cname": {{
+			Type:  "CNAME",
+			Value: "www.example.com.",
+		}, {
+			Type:  "CNAME",
+			Value: "example.com.",
+		}},
+		"ns": {{
+			Type:  "NS",
+			Value: "a.iana-servers.net.",
+		}},
+		"mx": {{
+			Type:       "MX",
+			Value:      "mx.example.com.",
+			Preference: 10,
+		}},
+		"txt": {{
+			Type:  "TXT",
+			Value: "v=spf1 -all",
+		}},
+	}
+
+	for _, lookupType := range []string{"cname", "ns", "mx", "txt"} {
+		t.Run(lookupType+" on success", func(t *testing.T) {
+			saver := NewSaver()
+			v := &SingleDNSLookupValidator{
+				ExpectDomain:          "example.com",
+				ExpectLookupType:      lookupType,
+				ExpectFailure:         nil,
+				ExpectResolverAddress: "8.8.8.8:53",
+				ExpectResolverNetwork: "udp",
+				ExpectRecords:         expectRecords[lookupType],
+				Saver:                 saver,
+			}
+			if err := lookup(saver, newResolver(nil), lookupType); err != nil {
+				t.Fatal(err)
+			}
+			if err := v.Validate(); err != nil {
+				t.Fatal(err)
+			}
+		})
+
+		t.Run(lookupType+" on failure", func(t *testing.T) {
+			mockedError := netxlite.NewTopLevelGenericErrWrapper(io.EOF)
+			saver := NewSaver()
+			v := &SingleDNSLookupValidator{
+				ExpectDomain:          "example.com",
+				ExpectLookupType:      lookupType,
+				ExpectFailure:         mockedError,
+				ExpectResolverAddress: "8.8.8.8:53",
+				ExpectResolverNetwork: "udp",
+				ExpectRecords:         nil,
+				Saver:                 saver,
+			}
+			err := lookup(saver, newResolver(mockedError), lookupType)
+			if !errors.Is(err, mockedError) {
+				t.Fatal("unexpected err", err)
+			}
+			if err := v.Validate(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
 type SingleDNSLookupValidator struct {
 	ExpectALPNs           []string
 	ExpectAddrs           []string
@@ -183,6 +342,7 @@ type SingleDNSLookupValidator struct {
 	ExpectFailure         error
 	ExpectResolverAddress string
 	ExpectResolverNetwork string
+	ExpectRecords         []*model.DNSRecord
 	Saver                 *Saver
 }
 
@@ -192,8 +352,10 @@ func (v *SingleDNSLookupValidator) Validate() error {
 	switch v.ExpectLookupType {
 	case "getaddrinfo":
 		entries = trace.DNSLookupHost
-	case "https":
+	case "https", "svcb":
 		entries = trace.DNSLookupHTTPS
+	case "cname", "ns", "mx", "txt":
+		entries = trace.DNSLookupRecords
 	default:
 		return errors.New("invalid v.ExpectLookupType")
 	}
@@ -207,6 +369,12 @@ func (v *SingleDNSLookupValidator) Validate() error {
 	if diff := cmp.Diff(v.ExpectAddrs, entry.Addresses); diff != "" {
 		return errors.New(diff)
 	}
+	if diff := cmp.Diff(v.ExpectRecords, entry.Records); diff != "" {
+		return errors.New(diff)
+	}
+	if v.ExpectLookupType != entry.LookupType {
+		return errors.New("invalid .LookupType value")
+	}
 	if v.ExpectDomain != entry.Domain {
 		return errors.New("invalid .Domain value")
 	}
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/miekg/dns"
 	"github.com/ooni/probe-cli/v3/internal/engine/geolocate"
 	"github.com/ooni/probe-cli/v3/internal/model"
 	"github.com/ooni/probe-cli/v3/internal/netxlite"
@@ -25,6 +26,9 @@ type Trace struct {
 	// DNSLookupHost contains DNSLookupHost events.
 	DNSLookupHost []*DNSLookupEvent
 
+	// DNSLookupRecords contains CNAME, NS, MX, and TXT lookup events.
+	DNSLookupRecords []*DNSLookupEvent
+
 	// DNSRoundTrip contains DNSRoundTrip events.
 	DNSRoundTrip []*DNSRoundTripEvent
 
@@ -169,7 +173,7 @@ func (t *Trace) newHTTPHeadersMap(source http.Header) (out map[string]model.Arch
 // archival data format out of the results saved inside the trace.
 func (t *Trace) NewArchivalDNSLookupResultList(begin time.Time) (out []model.ArchivalDNSLookupResult) {
 	for _, ev := range t.DNSLookupHost {
-		out = append(out, model.ArchivalDNSLookupResult{
+		out = append(out, t.withReplyInfo(ev, "A", model.ArchivalDNSLookupResult{
 			Answers:          t.gatherA(ev.Addresses),
 			Engine:           ev.ResolverNetwork,
 			Failure:          t.newFailure(ev.Failure),
@@ -179,14 +183,14 @@ func (t *Trace) NewArchivalDNSLookupResultList(begin time.Time) (out []model.Arc
 			ResolverPort:     nil, // legacy
 			ResolverAddress:  ev.ResolverAddress,
 			T:                ev.Finished.Sub(begin).Seconds(),
-		})
+		}))
 		aaaa := t.gatherAAAA(ev.Addresses)
 		if len(aaaa) <= 0 && ev.Failure == nil {
 			// We don't have any AAAA results. Historically we do not
 			// create a record for AAAA with no results when A succeeded
 			continue
 		}
-		out = append(out, model.ArchivalDNSLookupResult{
+		out = append(out, t.withReplyInfo(ev, "AAAA", model.ArchivalDNSLookupResult{
 			Answers:          aaaa,
 			Engine:           ev.ResolverNetwork,
 			Failure:          t.newFailure(ev.Failure),
@@ -196,8 +200,84 @@ func (t *Trace) NewArchivalDNSLookupResultList(begin time.Time) (out []model.Arc
 			ResolverPort:     nil, // legacy
 			ResolverAddress:  ev.ResolverAddress,
 			T:                ev.Finished.Sub(begin).Seconds(),
+		}))
+	}
+	for _, ev := range t.DNSLookupRecords {
+		qtype := strings.ToUpper(ev.LookupType)
+		wireQtype := qtype
+		if wireQtype == "CNAME" {
+			wireQtype = "A" // see netxlite.SerialResolver.LookupCNAME
+		}
+		out = append(out, t.withReplyInfo(ev, wireQtype, model.ArchivalDNSLookupResult{
+			Answers:          t.gatherRecords(ev.Records),
+			Engine:           ev.ResolverNetwork,
+			Failure:          t.newFailure(ev.Failure),
+			Hostname:         ev.Domain,
+			QueryType:        qtype,
+			ResolverHostname: nil, // legacy
+			ResolverPort:     nil, // legacy
+			ResolverAddress:  ev.ResolverAddress,
+			T:                ev.Finished.Sub(begin).Seconds(),
+		}))
+	}
+	return
+}
+
+// withReplyInfo sets the AD bit, the RRSIG presence and the extended DNS
+// errors of entry using the last DNS round trip for the same resolver
+// address, name, and qtype that happened during the given lookup.
+func (t *Trace) withReplyInfo(ev *DNSLookupEvent, qtype string,
+	entry model.ArchivalDNSLookupResult) model.ArchivalDNSLookupResult {
+	var reply []byte
+	for _, rtx := range t.DNSRoundTrip {
+		if rtx.Address != ev.ResolverAddress || rtx.Reply == nil {
+			continue
+		}
+		if rtx.Started.Before(ev.Started) || rtx.Finished.After(ev.Finished) {
+			continue
+		}
+		query := new(dns.Msg)
+		if err := query.Unpack(rtx.Query); err != nil || len(query.Question) != 1 {
+			continue
+		}
+		if query.Question[0].Name != dns.Fqdn(ev.Domain) ||
+			dns.TypeToString[query.Question[0].Qtype] != qtype {
+			continue
+		}
+		reply = rtx.Reply
+	}
+	if reply == nil {
+		return entry
+	}
+	decoder := &netxlite.DNSDecoderMiekg{}
+	info, err := decoder.DecodeReplyInfo(reply)
+	if err != nil {
+		return entry
+	}
+	entry.AuthenticData = info.AuthenticData
+	entry.HasRRSIG = info.HasRRSIG
+	for _, ede := range info.ExtendedErrors {
+		entry.ExtendedErrors = append(entry.ExtendedErrors, model.ArchivalDNSExtendedError{
+			InfoCode:  ede.InfoCode,
+			Name:      netxlite.DNSExtendedErrorName(ede.InfoCode),
+			ExtraText: ede.ExtraText,
 		})
 	}
+	return entry
+}
+
+func (t *Trace) gatherRecords(records []*model.DNSRecord) (out []model.ArchivalDNSAnswer) {
+	for _, record := range records {
+		answer := model.ArchivalDNSAnswer{AnswerType: record.Type}
+		switch record.Type {
+		case "TXT":
+			answer.Text = record.Value
+		default:
+			answer.Hostname = record.Value
+			answer.Preference = record.Preference
+		}
+		out = append(out, answer)
+	}
 	return
 }
 
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/miekg/dns"
 	"github.com/ooni/probe-cli/v3/internal/model"
 	"github.com/ooni/probe-cli/v3/internal/netxlite"
 )
@@ -518,13 +519,14 @@ func TestTraceNewArchivalHTTPRequestResultList(t *testing.T) {
 
 func TestTraceNewArchivalDNSLookupResultList(t *testing.T) {
 	type fields struct {
-		DNSLookupHTTPS []*DNSLookupEvent
-		DNSLookupHost  []*DNSLookupEvent
-		DNSRoundTrip   []*DNSRoundTripEvent
-		HTTPRoundTrip  []*HTTPRoundTripEvent
-		Network        []*NetworkEvent
-		QUICHandshake  []*QUICTLSHandshakeEvent
-		TLSHandshake   []*QUICTLSHandshakeEvent
+		DNSLookupHTTPS   []*DNSLookupEvent
+		DNSLookupHost    []*DNSLookupEvent
+		DNSLookupRecords []*DNSLookupEvent
+		DNSRoundTrip     []*DNSRoundTripEvent
+		HTTPRoundTrip    []*HTTPRoundTripEvent
+		Network          []*NetworkEvent
+		QUICHandshake    []*QUICTLSHandshakeEvent
+		TLSHandshake     []*QUICTLSHandshakeEvent
 	}
 	type args struct {
 		begin time.Time
@@ -718,17 +720,142 @@ func TestTraceNewArchivalDNSLookupResultList(t *testing.T) {
 			ResolverAddress:  "8.8.8.8:53",
 			T:                deltaSinceTraceTime(2),
 		}},
+	}, {
+		name: "with CNAME, MX, and TXT lookups",
+		fields: fields{
+			DNSLookupHTTPS: []*DNSLookupEvent{},
+			DNSLookupHost:  []*DNSLookupEvent{},
+			DNSLookupRecords: []*DNSLookupEvent{{
+				Domain:     "www.example.com",
+				Failure:    nil,
+				Finished:   traceTime(2),
+				LookupType: "cname",
+				Records: []*model.DNSRecord{{
+					Type:  "CNAME",
+					Value: "example.com.",
+				}},
+				ResolverAddress: "8.8.8.8:53",
+				ResolverNetwork: "udp",
+				Started:         traceTime(1),
+			}, {
+				Domain:     "example.com",
+				Failure:    nil,
+				Finished:   traceTime(4),
+				LookupType: "mx",
+				Records: []*model.DNSRecord{{
+					Type:       "MX",
+					Value:      "mx.example.com.",
+					Preference: 10,
+				}},
+				ResolverAddress: "8.8.8.8:53",
+				ResolverNetwork: "udp",
+				Started:         traceTime(3),
+			}, {
+				Domain:          "example.com",
+				Failure:         netxlite.NewTopLevelGenericErrWrapper(errors.New(netxlite.DNSNoSuchHostSuffix)),
+				Finished:        traceTime(6),
+				LookupType:      "txt",
+				Records:         nil,
+				ResolverAddress: "8.8.8.8:53",
+				ResolverNetwork: "udp",
+				Started:         traceTime(5),
+			}},
+			DNSRoundTrip:  []*DNSRoundTripEvent{},
+			HTTPRoundTrip: []*HTTPRoundTripEvent{},
+			Network:       []*NetworkEvent{},
+			QUICHandshake: []*QUICTLSHandshakeEvent{},
+			TLSHandshake:  []*QUICTLSHandshakeEvent{},
+		},
+		args: args{
+			begin: traceTime(0),
+		},
+		wantOut: []model.ArchivalDNSLookupResult{{
+			Answers: []model.ArchivalDNSAnswer{{
+				AnswerType: "CNAME",
+				Hostname:   "example.com.",
+			}},
+			Engine:          "udp",
+			Failure:         nil,
+			Hostname:        "www.example.com",
+			QueryType:       "CNAME",
+			ResolverAddress: "8.8.8.8:53",
+			T:               deltaSinceTraceTime(2),
+		}, {
+			Answers: []model.ArchivalDNSAnswer{{
+				AnswerType: "MX",
+				Hostname:   "mx.example.com.",
+				Preference: 10,
+			}},
+			Engine:          "udp",
+			Failure:         nil,
+			Hostname:        "example.com",
+			QueryType:       "MX",
+			ResolverAddress: "8.8.8.8:53",
+			T:               deltaSinceTraceTime(4),
+		}, {
+			Answers:         nil,
+			Engine:          "udp",
+			Failure:         failureFromString(netxlite.FailureDNSNXDOMAINError),
+			Hostname:        "example.com",
+			QueryType:       "TXT",
+			ResolverAddress: "8.8.8.8:53",
+			T:               deltaSinceTraceTime(6),
+		}},
+	}, {
+		name: "with DNSSEC and extended DNS errors",
+		fields: fields{
+			DNSLookupHost: []*DNSLookupEvent{{
+				Addresses:       []string{"1.1.1.1"},
+				Domain:          "example.com",
+				Finished:        traceTime(4),
+				ResolverAddress: "8.8.8.8:53",
+				ResolverNetwork: "udp",
+				Started:         traceTime(1),
+			}},
+			DNSRoundTrip: []*DNSRoundTripEvent{{
+				Address:  "8.8.8.8:53",
+				Finished: traceTime(3),
+				Network:  "udp",
+				Query:    traceDNSQuery(t, "example.com", dns.TypeA),
+				Reply:    traceDNSReplyWithInfo(t, "example.com", dns.TypeA),
+				Started:  traceTime(2),
+			}},
+		},
+		args: args{
+			begin: traceTime(0),
+		},
+		wantOut: []model.ArchivalDNSLookupResult{{
+			Answers: []model.ArchivalDNSAnswer{{
+				ASN:        13335,
+				ASOrgName:  "Cloudflare, Inc.",
+				AnswerType: "A",
+				IPv4:       "1.1.1.1",
+			}},
+			AuthenticData: true,
+			Engine:        "udp",
+			ExtendedErrors: []model.ArchivalDNSExtendedError{{
+				InfoCode:  dns.ExtendedErrorCodeStaleAnswer,
+				Name:      "Stale Answer",
+				ExtraText: "stale",
+			}},
+			HasRRSIG:        true,
+			Hostname:        "example.com",
+			QueryType:       "A",
+			ResolverAddress: "8.8.8.8:53",
+			T:               deltaSinceTraceTime(4),
+		}},
 	}}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			tr := &Trace{
-				DNSLookupHTTPS: tt.fields.DNSLookupHTTPS,
-				DNSLookupHost:  tt.fields.DNSLookupHost,
-				DNSRoundTrip:   tt.fields.DNSRoundTrip,
-				HTTPRoundTrip:  tt.fields.HTTPRoundTrip,
-				Network:        tt.fields.Network,
-				QUICHandshake:  tt.fields.QUICHandshake,
-				TLSHandshake:   tt.fields.TLSHandshake,
+				DNSLookupHTTPS:   tt.fields.DNSLookupHTTPS,
+				DNSLookupHost:    tt.fields.DNSLookupHost,
+				DNSLookupRecords: tt.fields.DNSLookupRecords,
+				DNSRoundTrip:     tt.fields.DNSRoundTrip,
+				HTTPRoundTrip:    tt.fields.HTTPRoundTrip,
+				Network:          tt.fields.Network,
+				QUICHandshake:    tt.fields.QUICHandshake,
+				TLSHandshake:     tt.fields.TLSHandshake,
 			}
 			gotOut := tr.NewArchivalDNSLookupResultList(tt.args.begin)
 			if diff := cmp.Diff(tt.wantOut, gotOut); diff != "" {
@@ -919,3 +1046,44 @@ func TestTraceNewArchivalTLSHandshakeResultList(t *testing.T) {
 		})
 	}
 }
+
+// traceDNSQuery returns a raw query for domain and qtype.
+func traceDNSQuery(t *testing.T, domain string, qtype uint16) []byte {
+	query := new(dns.Msg)
+	query.SetQuestion(dns.Fqdn(domain), qtype)
+	data, err := query.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// traceDNSReplyWithInfo returns a raw reply for domain and qtype with
+// the AD bit set, an RRSIG record and an extended DNS error.
+func traceDNSReplyWithInfo(t *testing.T, domain string, qtype uint16) []byte {
+	query := new(dns.Msg)
+	query.SetQuestion(dns.Fqdn(domain), qtype)
+	reply := new(dns.Msg)
+	reply.SetReply(query)
+	reply.AuthenticatedData = true
+	reply.Answer = append(reply.Answer, &dns.RRSIG{
+		Hdr: dns.RR_Header{
+			Name:   dns.Fqdn(domain),
+			Rrtype: dns.TypeRRSIG,
+			Class:  dns.ClassINET,
+		},
+		TypeCovered: qtype,
+		SignerName:  dns.Fqdn(domain),
+	})
+	opt := &dns.OPT{Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeOPT}}
+	opt.Option = append(opt.Option, &dns.EDNS0_EDE{
+		InfoCode:  dns.ExtendedErrorCodeStaleAnswer,
+		ExtraText: "stale",
+	})
+	reply.Extra = append(reply.Extra, opt)
+	data, err := reply.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
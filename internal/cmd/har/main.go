@@ -0,0 +1,80 @@
+// Command har converts the measurements inside a JSONL file (e.g.,
+// the report.jsonl file written by miniooni) to an HTTP Archive (HAR)
+// 1.2 file that browser developer tools and HAR viewers can load.
+//
+// Each measurement becomes a HAR page containing an entry for each
+// HTTP round trip. We warn about and skip measurements we cannot convert.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"os"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-cli/v3/internal/har"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/version"
+)
+
+var osExit = os.Exit
+
+func fatalOnError(err error, message string) {
+	if err != nil {
+		log.WithError(err).Error(message)
+		osExit(1) // overridable from tests
+	}
+}
+
+var (
+	input  = flag.String("input", "report.jsonl", "JSONL file containing measurements")
+	output = flag.String("output", "", "HAR file to write (default: stdout)")
+)
+
+func main() {
+	flag.Parse()
+	filep, err := os.Open(*input)
+	fatalOnError(err, "cannot open input file")
+	defer filep.Close()
+	archive := har.NewArchive("har", version.Version)
+	err = addMeasurements(archive, filep)
+	fatalOnError(err, "cannot convert measurements")
+	data, err := json.MarshalIndent(archive, "", "  ")
+	fatalOnError(err, "cannot serialize HAR")
+	data = append(data, '\n')
+	if *output == "" {
+		_, err = os.Stdout.Write(data)
+		fatalOnError(err, "cannot write HAR")
+		return
+	}
+	err = os.WriteFile(*output, data, 0600)
+	fatalOnError(err, "cannot write HAR file")
+}
+
+// addMeasurements adds to the archive the measurements read from r,
+// which contains a measurement for each line.
+func addMeasurements(archive *har.Archive, r io.Reader) error {
+	reader := bufio.NewReader(r)
+	for lineno := 1; ; lineno++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var m model.Measurement
+			if err := json.Unmarshal(line, &m); err != nil {
+				return err
+			}
+			if err := archive.AddMeasurement(&m); err != nil {
+				log.WithError(err).Warnf("skipping measurement at line %d", lineno)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+	}
+}
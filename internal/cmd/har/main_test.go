@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ooni/probe-cli/v3/internal/har"
+)
+
+const measurements = `{"input":"http://example.com/","measurement_start_time":"2021-11-10 14:44:10","test_keys":{"requests":[{"failure":null,"request":{"method":"GET","url":"http://example.com/","headers_list":[],"headers":{}},"response":{"code":200,"headers_list":[["Content-Type","text/html"]],"headers":{"Content-Type":"text/html"},"body":"<html>"},"t":0.1}]},"test_name":"urlgetter"}
+
+{"input":"http://example.org/","measurement_start_time":"2021-11-10 14:44:11","test_keys":null,"test_name":"urlgetter"}
+`
+
+func TestConvert(t *testing.T) {
+	dir := t.TempDir()
+	*input = filepath.Join(dir, "report.jsonl")
+	*output = filepath.Join(dir, "report.har")
+	if err := os.WriteFile(*input, []byte(measurements), 0600); err != nil {
+		t.Fatal(err)
+	}
+	main()
+	data, err := os.ReadFile(*output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var archive har.Archive
+	if err := json.Unmarshal(data, &archive); err != nil {
+		t.Fatal(err)
+	}
+	if archive.Log.Version != har.Version || len(archive.Log.Pages) != 1 {
+		t.Fatal("unexpected archive", archive.Log)
+	}
+	if len(archive.Log.Entries) != 1 || archive.Log.Entries[0].Response.Status != 200 {
+		t.Fatal("unexpected entries", archive.Log.Entries)
+	}
+}
+
+func TestMainWithMissingInput(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("the code did not panic")
+		}
+	}()
+	osExit = func(code int) {
+		panic(fmt.Errorf("%d", code))
+	}
+	*input = filepath.Join(t.TempDir(), "nonexistent.jsonl")
+	main()
+}
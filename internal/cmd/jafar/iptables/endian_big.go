@@ -0,0 +1,9 @@
+//go:build armbe || arm64be || m68k || mips || mips64 || mips64p32 || ppc || ppc64 || s390 || s390x || shbe || sparc || sparc64
+// +build armbe arm64be m68k mips mips64 mips64p32 ppc ppc64 s390 s390x shbe sparc sparc64
+
+package iptables
+
+import "encoding/binary"
+
+// nativeEndian is the byte order of this system.
+var nativeEndian binary.ByteOrder = binary.BigEndian
@@ -1,9 +1,13 @@
-// Package iptables contains code for managing firewall rules. This package
-// really only works reliably on Linux. In all other systems the functionality
-// in here is just a set of stubs returning errors.
+// Package iptables contains code for managing firewall rules using either
+// iptables or nftables. This package really only works reliably on Linux. In
+// all other systems the functionality in here is just a set of stubs
+// returning errors.
 package iptables
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/ooni/probe-cli/v3/internal/runtimex"
 )
 
@@ -42,6 +46,59 @@ func NewCensoringPolicy() *CensoringPolicy {
 	}
 }
 
+// Backend is the program we use to manage the firewall.
+type Backend string
+
+const (
+	// BackendIPTables manages the firewall using iptables.
+	BackendIPTables = Backend("iptables")
+
+	// BackendNFTables manages the firewall using nftables. Because
+	// nftables cannot match keywords, we match them in userspace
+	// using NFQUEUE, hence jafar must keep running to enforce them.
+	BackendNFTables = Backend("nftables")
+)
+
+// ErrUnknownBackend indicates that a backend does not exist.
+var ErrUnknownBackend = errors.New("iptables: unknown backend")
+
+// ErrKeywordsRootless indicates that we cannot match keywords using the
+// nftables backend inside a rootless namespace, since we cannot enter it
+// to receive the packets queued by nftables.
+var ErrKeywordsRootless = errors.New(
+	"iptables: the nftables backend cannot match keywords inside a rootless namespace " +
+		"(use the iptables backend or run as root)")
+
+// Namespace is a network namespace where we can apply the policy.
+type Namespace interface {
+	// Command returns the command line for running the
+	// given command inside the namespace.
+	Command(argv ...string) []string
+
+	// Do runs f on a thread living inside the namespace.
+	Do(f func() error) error
+}
+
+// NewCensoringPolicyWithBackend returns a new censoring policy using the given
+// backend. When ns is not nil, we apply the policy inside ns, where jafar's
+// proxies do not live, hence we do not exempt root's traffic from hijacking.
+func NewCensoringPolicyWithBackend(backend Backend, ns Namespace) (*CensoringPolicy, error) {
+	var sh shell
+	switch {
+	case backend == BackendIPTables && ns == nil:
+		sh = newShell()
+	case backend == BackendIPTables:
+		sh = newNamespacedShell(ns)
+	case backend == BackendNFTables && ns == nil:
+		sh = newNFTablesShell()
+	case backend == BackendNFTables:
+		sh = newNamespacedNFTablesShell(ns)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownBackend, backend)
+	}
+	return &CensoringPolicy{sh: sh}, nil
+}
+
 // Apply applies the censorship policy
 func (c *CensoringPolicy) Apply() (err error) {
 	defer func() {
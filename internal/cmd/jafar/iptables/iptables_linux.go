@@ -9,7 +9,26 @@ import (
 	"github.com/ooni/probe-cli/v3/internal/shellx"
 )
 
-type linuxShell struct{}
+type linuxShell struct {
+	// command is the command we run to invoke iptables.
+	command []string
+
+	// exemptRoot indicates whether to exempt root's traffic from
+	// hijacking, such that jafar's own proxies do not loop.
+	exemptRoot bool
+}
+
+// iptables runs iptables with the given arguments.
+func (s *linuxShell) iptables(arg ...string) error {
+	argv := append(append([]string{}, s.command...), arg...)
+	return shellx.Run(log.Log, argv[0], argv[1:]...)
+}
+
+// iptablesQuiet is like iptables but does not log.
+func (s *linuxShell) iptablesQuiet(arg ...string) error {
+	argv := append(append([]string{}, s.command...), arg...)
+	return shellx.RunQuiet(argv[0], argv[1:]...)
+}
 
 func (s *linuxShell) createChains() (err error) {
 	defer func() {
@@ -17,57 +36,56 @@ func (s *linuxShell) createChains() (err error) {
 			// JUST KNOW WE'VE BEEN HERE
 		}
 	}()
-	err = shellx.Run(log.Log, "sudo", "iptables", "-N", "JAFAR_INPUT")
+	err = s.iptables("-N", "JAFAR_INPUT")
 	runtimex.PanicOnError(err, "cannot create JAFAR_INPUT chain")
-	err = shellx.Run(log.Log, "sudo", "iptables", "-N", "JAFAR_OUTPUT")
+	err = s.iptables("-N", "JAFAR_OUTPUT")
 	runtimex.PanicOnError(err, "cannot create JAFAR_OUTPUT chain")
-	err = shellx.Run(log.Log, "sudo", "iptables", "-t", "nat", "-N", "JAFAR_NAT_OUTPUT")
+	err = s.iptables("-t", "nat", "-N", "JAFAR_NAT_OUTPUT")
 	runtimex.PanicOnError(err, "cannot create JAFAR_NAT_OUTPUT chain")
-	err = shellx.Run(log.Log, "sudo", "iptables", "-I", "OUTPUT", "-j", "JAFAR_OUTPUT")
+	err = s.iptables("-I", "OUTPUT", "-j", "JAFAR_OUTPUT")
 	runtimex.PanicOnError(err, "cannot insert jump to JAFAR_OUTPUT")
-	err = shellx.Run(log.Log, "sudo", "iptables", "-I", "INPUT", "-j", "JAFAR_INPUT")
+	err = s.iptables("-I", "INPUT", "-j", "JAFAR_INPUT")
 	runtimex.PanicOnError(err, "cannot insert jump to JAFAR_INPUT")
-	err = shellx.Run(log.Log, "sudo", "iptables", "-t", "nat", "-I", "OUTPUT", "-j", "JAFAR_NAT_OUTPUT")
+	err = s.iptables("-t", "nat", "-I", "OUTPUT", "-j", "JAFAR_NAT_OUTPUT")
 	runtimex.PanicOnError(err, "cannot insert jump to JAFAR_NAT_OUTPUT")
 	return nil
 }
 
 func (s *linuxShell) dropIfDestinationEquals(ip string) error {
-	return shellx.Run(log.Log,
-		"sudo", "iptables", "-A", "JAFAR_OUTPUT", "-d", ip, "-j", "DROP")
+	return s.iptables("-A", "JAFAR_OUTPUT", "-d", ip, "-j", "DROP")
 }
 
 func (s *linuxShell) rstIfDestinationEqualsAndIsTCP(ip string) error {
-	return shellx.Run(log.Log,
-		"sudo", "iptables", "-A", "JAFAR_OUTPUT", "--proto", "tcp", "-d", ip,
+	return s.iptables(
+		"-A", "JAFAR_OUTPUT", "--proto", "tcp", "-d", ip,
 		"-j", "REJECT", "--reject-with", "tcp-reset",
 	)
 }
 
 func (s *linuxShell) dropIfContainsKeywordHex(keyword string) error {
-	return shellx.Run(log.Log,
-		"sudo", "iptables", "-A", "JAFAR_OUTPUT", "-m", "string", "--algo", "kmp",
+	return s.iptables(
+		"-A", "JAFAR_OUTPUT", "-m", "string", "--algo", "kmp",
 		"--hex-string", keyword, "-j", "DROP",
 	)
 }
 
 func (s *linuxShell) dropIfContainsKeyword(keyword string) error {
-	return shellx.Run(log.Log,
-		"sudo", "iptables", "-A", "JAFAR_OUTPUT", "-m", "string", "--algo", "kmp",
+	return s.iptables(
+		"-A", "JAFAR_OUTPUT", "-m", "string", "--algo", "kmp",
 		"--string", keyword, "-j", "DROP",
 	)
 }
 
 func (s *linuxShell) rstIfContainsKeywordHexAndIsTCP(keyword string) error {
-	return shellx.Run(log.Log,
-		"sudo", "iptables", "-A", "JAFAR_OUTPUT", "-m", "string", "--proto", "tcp", "--algo",
+	return s.iptables(
+		"-A", "JAFAR_OUTPUT", "-m", "string", "--proto", "tcp", "--algo",
 		"kmp", "--hex-string", keyword, "-j", "REJECT", "--reject-with", "tcp-reset",
 	)
 }
 
 func (s *linuxShell) rstIfContainsKeywordAndIsTCP(keyword string) error {
-	return shellx.Run(log.Log,
-		"sudo", "iptables", "-A", "JAFAR_OUTPUT", "-m", "string", "--proto", "tcp", "--algo",
+	return s.iptables(
+		"-A", "JAFAR_OUTPUT", "-m", "string", "--proto", "tcp", "--algo",
 		"kmp", "--string", keyword, "-j", "REJECT", "--reject-with", "tcp-reset",
 	)
 }
@@ -76,45 +94,48 @@ func (s *linuxShell) hijackDNS(address string) error {
 	// Hijack any DNS query, like the Vodafone station does when using the
 	// secure network feature. Our transparent proxies will use DoT, in order
 	// to bypass this restriction and avoid routing loop.
-	return shellx.Run(log.Log,
-		"sudo", "iptables", "-t", "nat", "-A", "JAFAR_NAT_OUTPUT", "-p", "udp",
+	return s.iptables(
+		"-t", "nat", "-A", "JAFAR_NAT_OUTPUT", "-p", "udp",
 		"--dport", "53", "-j", "DNAT", "--to", address,
 	)
 }
 
 func (s *linuxShell) hijackHTTPS(address string) error {
-	// We need to whitelist root otherwise the traffic sent by Jafar
-	// itself will match the rule and loop.
-	return shellx.Run(log.Log,
-		"sudo", "iptables", "-t", "nat", "-A", "JAFAR_NAT_OUTPUT", "-p", "tcp",
-		"--dport", "443", "-m", "owner", "!", "--uid-owner", "0",
-		"-j", "DNAT", "--to", address,
-	)
+	return s.hijackTCP("443", address)
 }
 
 func (s *linuxShell) hijackHTTP(address string) error {
-	// We need to whitelist root otherwise the traffic sent by Jafar
-	// itself will match the rule and loop.
-	return shellx.Run(log.Log,
-		"sudo", "iptables", "-t", "nat", "-A", "JAFAR_NAT_OUTPUT", "-p", "tcp",
-		"--dport", "80", "-m", "owner", "!", "--uid-owner", "0",
-		"-j", "DNAT", "--to", address,
-	)
+	return s.hijackTCP("80", address)
+}
+
+// hijackTCP hijacks the TCP traffic to port towards address.
+func (s *linuxShell) hijackTCP(port, address string) error {
+	args := []string{"-t", "nat", "-A", "JAFAR_NAT_OUTPUT", "-p", "tcp", "--dport", port}
+	if s.exemptRoot {
+		// We need to whitelist root otherwise the traffic sent by Jafar
+		// itself will match the rule and loop.
+		args = append(args, "-m", "owner", "!", "--uid-owner", "0")
+	}
+	return s.iptables(append(args, "-j", "DNAT", "--to", address)...)
 }
 
 func (s *linuxShell) waive() error {
-	shellx.RunQuiet("sudo", "iptables", "-D", "OUTPUT", "-j", "JAFAR_OUTPUT")
-	shellx.RunQuiet("sudo", "iptables", "-D", "INPUT", "-j", "JAFAR_INPUT")
-	shellx.RunQuiet("sudo", "iptables", "-t", "nat", "-D", "OUTPUT", "-j", "JAFAR_NAT_OUTPUT")
-	shellx.RunQuiet("sudo", "iptables", "-F", "JAFAR_INPUT")
-	shellx.RunQuiet("sudo", "iptables", "-X", "JAFAR_INPUT")
-	shellx.RunQuiet("sudo", "iptables", "-F", "JAFAR_OUTPUT")
-	shellx.RunQuiet("sudo", "iptables", "-X", "JAFAR_OUTPUT")
-	shellx.RunQuiet("sudo", "iptables", "-t", "nat", "-F", "JAFAR_NAT_OUTPUT")
-	shellx.RunQuiet("sudo", "iptables", "-t", "nat", "-X", "JAFAR_NAT_OUTPUT")
+	s.iptablesQuiet("-D", "OUTPUT", "-j", "JAFAR_OUTPUT")
+	s.iptablesQuiet("-D", "INPUT", "-j", "JAFAR_INPUT")
+	s.iptablesQuiet("-t", "nat", "-D", "OUTPUT", "-j", "JAFAR_NAT_OUTPUT")
+	s.iptablesQuiet("-F", "JAFAR_INPUT")
+	s.iptablesQuiet("-X", "JAFAR_INPUT")
+	s.iptablesQuiet("-F", "JAFAR_OUTPUT")
+	s.iptablesQuiet("-X", "JAFAR_OUTPUT")
+	s.iptablesQuiet("-t", "nat", "-F", "JAFAR_NAT_OUTPUT")
+	s.iptablesQuiet("-t", "nat", "-X", "JAFAR_NAT_OUTPUT")
 	return nil
 }
 
 func newShell() *linuxShell {
-	return &linuxShell{}
+	return &linuxShell{command: []string{"sudo", "iptables"}, exemptRoot: true}
+}
+
+func newNamespacedShell(ns Namespace) *linuxShell {
+	return &linuxShell{command: ns.Command("iptables")}
 }
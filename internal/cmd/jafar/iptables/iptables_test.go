@@ -0,0 +1,18 @@
+package iptables
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewCensoringPolicyWithBackend(t *testing.T) {
+	for _, backend := range []Backend{BackendIPTables, BackendNFTables} {
+		policy, err := NewCensoringPolicyWithBackend(backend, nil)
+		if err != nil || policy == nil {
+			t.Fatal("unexpected result", backend, err)
+		}
+	}
+	if _, err := NewCensoringPolicyWithBackend("pf", nil); !errors.Is(err, ErrUnknownBackend) {
+		t.Fatal("unexpected err", err)
+	}
+}
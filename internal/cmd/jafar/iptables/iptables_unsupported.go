@@ -44,3 +44,15 @@ func (*otherwiseShell) waive() error {
 func newShell() *otherwiseShell {
 	return &otherwiseShell{}
 }
+
+func newNamespacedShell(ns Namespace) *otherwiseShell {
+	return &otherwiseShell{}
+}
+
+func newNFTablesShell() *otherwiseShell {
+	return &otherwiseShell{}
+}
+
+func newNamespacedNFTablesShell(ns Namespace) *otherwiseShell {
+	return &otherwiseShell{}
+}
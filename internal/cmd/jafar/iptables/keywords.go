@@ -0,0 +1,270 @@
+package iptables
+
+//
+// Keyword matching for the nftables backend. Unlike iptables, nftables
+// cannot search for a string inside packets, so we ask nftables to queue
+// the packets to us using NFQUEUE. We search for the keywords and, when
+// a packet matches, we return it to the kernel with a mark, such that the
+// nftables rules matching the mark drop the packet or reset the flow.
+//
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"sync"
+)
+
+const (
+	// keywordsQueue is the NFQUEUE queue number we use.
+	keywordsQueue = 7117
+
+	// keywordsDropMark is the mark of packets to drop.
+	keywordsDropMark = 0x6a616664 // "jafd"
+
+	// keywordsResetMark is the mark of packets whose flow we reset.
+	keywordsResetMark = 0x6a616672 // "jafr"
+)
+
+// keywordRule is a keyword matching rule.
+type keywordRule struct {
+	// keyword is the keyword to search for.
+	keyword []byte
+
+	// reset indicates that we reset TCP flows rather than dropping.
+	reset bool
+}
+
+// keywordMatcher classifies packets using keyword rules.
+type keywordMatcher struct {
+	mu    sync.Mutex
+	rules []keywordRule
+}
+
+// add adds a new rule to the matcher.
+func (m *keywordMatcher) add(keyword []byte, reset bool) {
+	m.mu.Lock()
+	m.rules = append(m.rules, keywordRule{keyword: keyword, reset: reset})
+	m.mu.Unlock()
+}
+
+// classify returns the mark of the given IPv4 packet or zero if the
+// packet does not match any rule. Like iptables, we search the whole
+// packet, and we only reset TCP flows. Reset rules take precedence.
+func (m *keywordMatcher) classify(packet []byte) uint32 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	isTCP := len(packet) > 9 && packet[9] == 6
+	for _, rule := range m.rules {
+		if rule.reset && isTCP && bytes.Contains(packet, rule.keyword) {
+			return keywordsResetMark
+		}
+	}
+	for _, rule := range m.rules {
+		if !rule.reset && bytes.Contains(packet, rule.keyword) {
+			return keywordsDropMark
+		}
+	}
+	return 0
+}
+
+// errInvalidKeywordHex indicates that an hex keyword is not valid.
+var errInvalidKeywordHex = errors.New("iptables: invalid hex keyword")
+
+// parseKeywordHex parses a keyword using the iptables --hex-string
+// syntax, where bytes in hex are between pipes, e.g., `|0d 0a|Host:`.
+func parseKeywordHex(keyword string) ([]byte, error) {
+	var (
+		digits []byte
+		inHex  bool
+		out    []byte
+	)
+	for idx := 0; idx < len(keyword); idx++ {
+		switch ch := keyword[idx]; {
+		case ch == '|' && inHex:
+			data, err := hex.DecodeString(string(digits))
+			if err != nil {
+				return nil, errInvalidKeywordHex
+			}
+			out, digits, inHex = append(out, data...), nil, false
+		case ch == '|':
+			inHex = true
+		case inHex && ch == ' ':
+			// nothing
+		case inHex:
+			digits = append(digits, ch)
+		default:
+			out = append(out, ch)
+		}
+	}
+	if inHex || len(out) <= 0 {
+		return nil, errInvalidKeywordHex
+	}
+	return out, nil
+}
+
+//
+// NFQUEUE netlink messages. The netlink headers use the native byte
+// order (see endian_big.go and endian_little.go) while the NFQUEUE
+// payloads use the network byte order.
+//
+
+const (
+	nlmsgHeaderLen = 16
+	nlmsgError     = 2
+	nlmFRequest    = 1
+	nlmFAck        = 4
+
+	nfnlSubsysQueue = 3
+	nfgenmsgLen     = 4
+
+	nfqnlMsgPacket  = 0
+	nfqnlMsgVerdict = 1
+	nfqnlMsgConfig  = 2
+
+	nfqaPacketHdr  = 1
+	nfqaVerdictHdr = 2
+	nfqaMark       = 3
+	nfqaPayload    = 10
+
+	nfqaCfgCmd    = 1
+	nfqaCfgParams = 2
+
+	nfqnlCfgCmdBind = 1
+	nfqnlCopyPacket = 2
+
+	nfAccept = 1
+	nfRepeat = 4
+)
+
+// nfqAttr is a netlink attribute.
+type nfqAttr struct {
+	typ  uint16
+	data []byte
+}
+
+// nfqAlign aligns size to four bytes as required by netlink.
+func nfqAlign(size int) int {
+	return (size + 3) &^ 3
+}
+
+// nfqMessage serializes an NFQUEUE netlink message.
+func nfqMessage(msgType, flags uint16, seq uint32, attrs ...nfqAttr) []byte {
+	out := make([]byte, nlmsgHeaderLen+nfgenmsgLen)
+	nativeEndian.PutUint16(out[4:6], nfnlSubsysQueue<<8|msgType)
+	nativeEndian.PutUint16(out[6:8], flags)
+	nativeEndian.PutUint32(out[8:12], seq)
+	// nfgenmsg: AF_UNSPEC, NFNETLINK_V0, queue number
+	binary.BigEndian.PutUint16(out[nlmsgHeaderLen+2:], keywordsQueue)
+	for _, attr := range attrs {
+		header := make([]byte, 4)
+		nativeEndian.PutUint16(header[0:2], uint16(4+len(attr.data)))
+		nativeEndian.PutUint16(header[2:4], attr.typ)
+		out = append(out, header...)
+		out = append(out, attr.data...)
+		out = append(out, make([]byte, nfqAlign(len(attr.data))-len(attr.data))...)
+	}
+	nativeEndian.PutUint32(out[0:4], uint32(len(out)))
+	return out
+}
+
+// nfqBindMessages returns the messages binding the queue and
+// asking the kernel to send us the whole packets.
+func nfqBindMessages() [][]byte {
+	cmd := []byte{nfqnlCfgCmdBind, 0, 0, 2} // AF_INET
+	params := make([]byte, 5)
+	binary.BigEndian.PutUint32(params[0:4], 0xffff)
+	params[4] = nfqnlCopyPacket
+	return [][]byte{
+		nfqMessage(nfqnlMsgConfig, nlmFRequest|nlmFAck, 1, nfqAttr{nfqaCfgCmd, cmd}),
+		nfqMessage(nfqnlMsgConfig, nlmFRequest|nlmFAck, 2, nfqAttr{nfqaCfgParams, params}),
+	}
+}
+
+// nfqVerdictMessage returns the verdict for the given packet id. A
+// nonzero mark causes the kernel to repeat the hook with the mark set.
+func nfqVerdictMessage(id, mark uint32) []byte {
+	verdict := make([]byte, 8)
+	binary.BigEndian.PutUint32(verdict[4:8], id)
+	if mark == 0 {
+		binary.BigEndian.PutUint32(verdict[0:4], nfAccept)
+		return nfqMessage(nfqnlMsgVerdict, nlmFRequest, 0, nfqAttr{nfqaVerdictHdr, verdict})
+	}
+	binary.BigEndian.PutUint32(verdict[0:4], nfRepeat)
+	markData := make([]byte, 4)
+	binary.BigEndian.PutUint32(markData, mark)
+	return nfqMessage(nfqnlMsgVerdict, nlmFRequest, 0,
+		nfqAttr{nfqaVerdictHdr, verdict}, nfqAttr{nfqaMark, markData})
+}
+
+// errInvalidNetlinkMessage indicates that a netlink message is not valid.
+var errInvalidNetlinkMessage = errors.New("iptables: invalid netlink message")
+
+// nfqMessages splits the given buffer into netlink messages.
+func nfqMessages(buf []byte) ([][]byte, error) {
+	var out [][]byte
+	for len(buf) >= nlmsgHeaderLen {
+		size := int(nativeEndian.Uint32(buf[0:4]))
+		if size < nlmsgHeaderLen || size > len(buf) {
+			return nil, errInvalidNetlinkMessage
+		}
+		out = append(out, buf[:size])
+		if nfqAlign(size) >= len(buf) {
+			break
+		}
+		buf = buf[nfqAlign(size):]
+	}
+	return out, nil
+}
+
+// nfqMessageType returns the type of a netlink message.
+func nfqMessageType(msg []byte) uint16 {
+	return nativeEndian.Uint16(msg[4:6])
+}
+
+// nfqAckError returns the error carried by a netlink ack message.
+func nfqAckError(msg []byte) (int32, error) {
+	if nfqMessageType(msg) != nlmsgError || len(msg) < nlmsgHeaderLen+4 {
+		return 0, errInvalidNetlinkMessage
+	}
+	return int32(nativeEndian.Uint32(msg[nlmsgHeaderLen:])), nil
+}
+
+// nfqParsePacket returns the id and the payload of an NFQUEUE packet.
+func nfqParsePacket(msg []byte) (uint32, []byte, error) {
+	if nfqMessageType(msg) != nfnlSubsysQueue<<8|nfqnlMsgPacket {
+		return 0, nil, errInvalidNetlinkMessage
+	}
+	var (
+		foundID bool
+		id      uint32
+		payload []byte
+	)
+	attrs := msg[nlmsgHeaderLen+nfgenmsgLen:]
+	for len(attrs) >= 4 {
+		size := int(nativeEndian.Uint16(attrs[0:2]))
+		typ := nativeEndian.Uint16(attrs[2:4]) & 0x3fff // ignore flags
+		if size < 4 || size > len(attrs) {
+			return 0, nil, errInvalidNetlinkMessage
+		}
+		data := attrs[4:size]
+		switch typ {
+		case nfqaPacketHdr:
+			if len(data) < 4 {
+				return 0, nil, errInvalidNetlinkMessage
+			}
+			id, foundID = binary.BigEndian.Uint32(data[0:4]), true
+		case nfqaPayload:
+			payload = data
+		}
+		if nfqAlign(size) >= len(attrs) {
+			break
+		}
+		attrs = attrs[nfqAlign(size):]
+	}
+	if !foundID {
+		return 0, nil, errInvalidNetlinkMessage
+	}
+	return id, payload, nil
+}
@@ -0,0 +1,137 @@
+package iptables
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseKeywordHex(t *testing.T) {
+	t.Run("with valid keywords", func(t *testing.T) {
+		inputs := map[string]string{
+			"|77 65 62|":            "web",
+			"|7765|b.|74 65|legram": "web.telegram",
+			"plain":                 "plain",
+		}
+		for input, expected := range inputs {
+			output, err := parseKeywordHex(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(output) != expected {
+				t.Fatal("unexpected output", input, string(output))
+			}
+		}
+	})
+
+	t.Run("with invalid keywords", func(t *testing.T) {
+		for _, input := range []string{"", "||", "|77 6", "|7g|", "|77"} {
+			if _, err := parseKeywordHex(input); !errors.Is(err, errInvalidKeywordHex) {
+				t.Fatal("unexpected err", input, err)
+			}
+		}
+	})
+}
+
+func TestKeywordMatcher(t *testing.T) {
+	// newPacket returns a fake IPv4 packet with the given protocol.
+	newPacket := func(proto byte, payload string) []byte {
+		packet := make([]byte, 20)
+		packet[9] = proto
+		return append(packet, payload...)
+	}
+	matcher := &keywordMatcher{}
+	matcher.add([]byte("Host: nexa"), false)
+	matcher.add([]byte("example.com"), true)
+	matcher.add([]byte("example"), false)
+	inputs := []struct {
+		packet []byte
+		mark   uint32
+	}{
+		{newPacket(6, "GET / HTTP/1.1\r\nHost: nexa.polito.it\r\n"), keywordsDropMark},
+		{newPacket(6, "\x16\x03\x01 example.com"), keywordsResetMark},
+		{newPacket(17, "\x16\x03\x01 example.com"), keywordsDropMark},
+		{newPacket(6, "\x16\x03\x01 ooni.org"), 0},
+		{nil, 0},
+	}
+	for idx, input := range inputs {
+		if mark := matcher.classify(input.packet); mark != input.mark {
+			t.Fatal("unexpected mark", idx, mark)
+		}
+	}
+}
+
+func TestNFQMessages(t *testing.T) {
+	t.Run("packet roundtrip", func(t *testing.T) {
+		header := make([]byte, 7)
+		binary.BigEndian.PutUint32(header, 1234)
+		buf := nfqMessage(nfqnlMsgPacket, 0, 0,
+			nfqAttr{nfqaPacketHdr, header}, nfqAttr{nfqaPayload, []byte("abcde")})
+		buf = append(buf, buf...)
+		msgs, err := nfqMessages(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(msgs) != 2 {
+			t.Fatal("unexpected number of messages", len(msgs))
+		}
+		id, payload, err := nfqParsePacket(msgs[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != 1234 || string(payload) != "abcde" {
+			t.Fatal("unexpected packet", id, string(payload))
+		}
+	})
+
+	t.Run("verdicts", func(t *testing.T) {
+		msg := nfqVerdictMessage(1234, 0)
+		expected := []byte{0, 0, 0, nfAccept, 0, 0, 0x04, 0xd2}
+		if diff := cmp.Diff(expected, msg[len(msg)-8:]); diff != "" {
+			t.Fatal(diff)
+		}
+		msg = nfqVerdictMessage(1234, keywordsDropMark)
+		expected = []byte{
+			12, 0, nfqaVerdictHdr, 0, 0, 0, 0, nfRepeat, 0, 0, 0x04, 0xd2,
+			8, 0, nfqaMark, 0, 'j', 'a', 'f', 'd',
+		}
+		if nativeEndian == binary.BigEndian {
+			expected[0], expected[1], expected[2], expected[3] = 0, 12, 0, nfqaVerdictHdr
+			expected[12], expected[13], expected[14], expected[15] = 0, 8, 0, nfqaMark
+		}
+		if diff := cmp.Diff(expected, msg[nlmsgHeaderLen+nfgenmsgLen:]); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("acks", func(t *testing.T) {
+		msg := make([]byte, nlmsgHeaderLen+4)
+		nativeEndian.PutUint16(msg[4:6], nlmsgError)
+		nativeEndian.PutUint32(msg[nlmsgHeaderLen:], uint32(0xffffffff))
+		code, err := nfqAckError(msg)
+		if err != nil || code != -1 {
+			t.Fatal("unexpected result", code, err)
+		}
+		if _, err := nfqAckError(msg[:nlmsgHeaderLen]); !errors.Is(err, errInvalidNetlinkMessage) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+
+	t.Run("invalid messages", func(t *testing.T) {
+		buf := nfqMessage(nfqnlMsgPacket, 0, 0)
+		nativeEndian.PutUint32(buf[0:4], 1024)
+		if _, err := nfqMessages(buf); !errors.Is(err, errInvalidNetlinkMessage) {
+			t.Fatal("unexpected err", err)
+		}
+		buf = nfqMessage(nfqnlMsgPacket, 0, 0, nfqAttr{nfqaPayload, []byte("abc")})
+		if _, _, err := nfqParsePacket(buf); !errors.Is(err, errInvalidNetlinkMessage) {
+			t.Fatal("unexpected err", err)
+		}
+		buf = nfqMessage(nfqnlMsgVerdict, 0, 0)
+		if _, _, err := nfqParsePacket(buf); !errors.Is(err, errInvalidNetlinkMessage) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+}
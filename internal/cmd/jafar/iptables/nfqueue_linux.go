@@ -0,0 +1,127 @@
+//go:build linux
+// +build linux
+
+package iptables
+
+import (
+	"errors"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// nfqConn is the netlink connection through which we receive
+// the packets queued by nftables and return the verdicts.
+type nfqConn struct {
+	done    chan struct{}
+	fd      int
+	matcher *keywordMatcher
+	stop    chan struct{}
+}
+
+// newNFQConn binds the keywords queue and starts classifying the
+// queued packets using matcher. When ns is not nil, we bind the
+// queue of the given network namespace.
+func newNFQConn(matcher *keywordMatcher, ns Namespace) (*nfqConn, error) {
+	fd := -1
+	open := func() (err error) {
+		fd, err = unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_NETFILTER)
+		return
+	}
+	var err error
+	if ns != nil {
+		err = ns.Do(open)
+	} else {
+		err = open()
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn := &nfqConn{
+		done:    make(chan struct{}),
+		fd:      fd,
+		matcher: matcher,
+		stop:    make(chan struct{}),
+	}
+	if err := conn.bind(); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	go conn.loop()
+	return conn, nil
+}
+
+// bind binds the socket to the keywords queue.
+func (c *nfqConn) bind() error {
+	if err := unix.Bind(c.fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return err
+	}
+	buf := make([]byte, 4096)
+	for _, msg := range nfqBindMessages() {
+		if err := c.send(msg); err != nil {
+			return err
+		}
+		count, _, err := unix.Recvfrom(c.fd, buf, 0)
+		if err != nil {
+			return err
+		}
+		msgs, err := nfqMessages(buf[:count])
+		if err != nil || len(msgs) <= 0 {
+			return errInvalidNetlinkMessage
+		}
+		code, err := nfqAckError(msgs[0])
+		if err != nil {
+			return err
+		}
+		if code != 0 {
+			return syscall.Errno(-code)
+		}
+	}
+	// use a timeout such that loop notices when we're closed
+	timeout := unix.Timeval{Usec: 100000}
+	return unix.SetsockoptTimeval(c.fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &timeout)
+}
+
+// send sends a message to the kernel.
+func (c *nfqConn) send(msg []byte) error {
+	return unix.Sendto(c.fd, msg, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK})
+}
+
+// loop classifies the queued packets until we're closed.
+func (c *nfqConn) loop() {
+	defer close(c.done)
+	buf := make([]byte, 1<<17)
+	for {
+		select {
+		case <-c.stop:
+			return
+		default:
+		}
+		count, _, err := unix.Recvfrom(c.fd, buf, 0)
+		if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) || errors.Is(err, unix.ENOBUFS) {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		msgs, err := nfqMessages(buf[:count])
+		if err != nil {
+			continue
+		}
+		for _, msg := range msgs {
+			id, payload, err := nfqParsePacket(msg)
+			if err != nil {
+				continue
+			}
+			c.send(nfqVerdictMessage(id, c.matcher.classify(payload)))
+		}
+	}
+}
+
+// Close closes the connection. The kernel drops the packets
+// for which we did not return a verdict.
+func (c *nfqConn) Close() error {
+	close(c.stop)
+	<-c.done
+	return unix.Close(c.fd)
+}
@@ -0,0 +1,114 @@
+package iptables
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/execabs"
+)
+
+func newNFTablesCensoringPolicy(t *testing.T) *CensoringPolicy {
+	if runtime.GOOS != "linux" {
+		t.Skip("not implemented on this platform")
+	}
+	if testing.Short() {
+		t.Skip("skip test in short mode")
+	}
+	if _, err := execabs.LookPath("nft"); err != nil {
+		t.Skip("nft is not installed")
+	}
+	policy, err := NewCensoringPolicyWithBackend(BackendNFTables, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy.Waive() // start over to allow for repeated tests on failure
+	return policy
+}
+
+func TestNFTablesCreateChainsError(t *testing.T) {
+	policy := newNFTablesCensoringPolicy(t)
+	defer policy.Waive()
+	if err := policy.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	// you should not be able to apply the policy when there is
+	// already a policy, you need to waive it first
+	if err := policy.Apply(); err == nil {
+		t.Fatal("expected an error here")
+	}
+}
+
+func TestNFTablesDropIP(t *testing.T) {
+	policy := newNFTablesCensoringPolicy(t)
+	defer policy.Waive()
+	policy.DropIPs = []string{"1.1.1.1"}
+	if err := policy.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", "1.1.1.1:853")
+	if err == nil {
+		conn.Close()
+		t.Fatal("expected an error here")
+	}
+	var nerr net.Error
+	if !errors.As(err, &nerr) || !nerr.Timeout() {
+		t.Fatal("unexpected error occurred", err)
+	}
+}
+
+// nfTablesEcho writes data on a loopback connection and returns the
+// error that occurred while reading the echoed data.
+func nfTablesEcho(t *testing.T, data string) error {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Write([]byte(data)); err != nil {
+		return err
+	}
+	_, err = io.ReadFull(conn, make([]byte, len(data)))
+	return err
+}
+
+func TestNFTablesKeywords(t *testing.T) {
+	policy := newNFTablesCensoringPolicy(t)
+	defer policy.Waive()
+	policy.DropKeywords = []string{"ooni-drop"}
+	policy.ResetKeywordsHex = []string{"|6f 6f 6e 69|-reset"}
+	if err := policy.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	if err := nfTablesEcho(t, "hello, world"); err != nil {
+		t.Fatal(err)
+	}
+	var nerr net.Error
+	if err := nfTablesEcho(t, "ooni-drop"); !errors.As(err, &nerr) || !nerr.Timeout() {
+		t.Fatal("unexpected error occurred", err)
+	}
+	if err := nfTablesEcho(t, "ooni-reset"); !errors.Is(err, syscall.ECONNRESET) {
+		t.Fatal("unexpected error occurred", err)
+	}
+}
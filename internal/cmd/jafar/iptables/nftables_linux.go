@@ -0,0 +1,189 @@
+//go:build linux
+// +build linux
+
+package iptables
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-cli/v3/internal/cmd/jafar/netns"
+	"github.com/ooni/probe-cli/v3/internal/shellx"
+)
+
+// nftShell implements shell using nftables. We keep all our rules
+// inside the jafar table, which allows us to waive them at once.
+type nftShell struct {
+	// command is the command we run to invoke nft.
+	command []string
+
+	// exemptRoot indicates whether to exempt root's traffic from
+	// hijacking, such that jafar's own proxies do not loop.
+	exemptRoot bool
+
+	// matcher contains the keyword rules.
+	matcher *keywordMatcher
+
+	// ns is the OPTIONAL namespace where we apply the rules.
+	ns Namespace
+
+	// queue is the queue that receives the packets to match
+	// against the keywords, or nil if we have no keywords.
+	queue *nfqConn
+}
+
+// nft runs nft with the given arguments.
+func (s *nftShell) nft(arg ...string) error {
+	argv := append(append([]string{}, s.command...), arg...)
+	return shellx.Run(log.Log, argv[0], argv[1:]...)
+}
+
+// nftQuiet is like nft but does not log.
+func (s *nftShell) nftQuiet(arg ...string) error {
+	argv := append(append([]string{}, s.command...), arg...)
+	return shellx.RunQuiet(argv[0], argv[1:]...)
+}
+
+func (s *nftShell) createChains() error {
+	// Implementation note: we use `create` for the table such that we fail
+	// like iptables does when the chains already exist. The chain matching
+	// keywords runs after the output chain and contains the rules enforcing
+	// the verdicts of the keywordMatcher (see keywords.go).
+	commands := [][]string{
+		{"create", "table", "ip", "jafar"},
+		{"add", "chain", "ip", "jafar", "output",
+			"{", "type", "filter", "hook", "output", "priority", "0", ";", "}"},
+		{"add", "chain", "ip", "jafar", "keywords",
+			"{", "type", "filter", "hook", "output", "priority", "1", ";", "}"},
+		{"add", "chain", "ip", "jafar", "nat_output",
+			"{", "type", "nat", "hook", "output", "priority", "-100", ";", "}"},
+		{"add", "rule", "ip", "jafar", "keywords", "meta", "mark", strconv.Itoa(keywordsResetMark),
+			"ip", "protocol", "tcp", "reject", "with", "tcp", "reset"},
+		{"add", "rule", "ip", "jafar", "keywords", "meta", "mark", strconv.Itoa(keywordsDropMark), "drop"},
+	}
+	for _, arg := range commands {
+		if err := s.nft(arg...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *nftShell) dropIfDestinationEquals(ip string) error {
+	return s.nft("add", "rule", "ip", "jafar", "output", "ip", "daddr", ip, "drop")
+}
+
+func (s *nftShell) rstIfDestinationEqualsAndIsTCP(ip string) error {
+	return s.nft(
+		"add", "rule", "ip", "jafar", "output", "ip", "daddr", ip,
+		"ip", "protocol", "tcp", "reject", "with", "tcp", "reset",
+	)
+}
+
+func (s *nftShell) dropIfContainsKeywordHex(keyword string) error {
+	return s.addKeywordHex(keyword, false)
+}
+
+func (s *nftShell) dropIfContainsKeyword(keyword string) error {
+	return s.addKeyword([]byte(keyword), false)
+}
+
+func (s *nftShell) rstIfContainsKeywordHexAndIsTCP(keyword string) error {
+	return s.addKeywordHex(keyword, true)
+}
+
+func (s *nftShell) rstIfContainsKeywordAndIsTCP(keyword string) error {
+	return s.addKeyword([]byte(keyword), true)
+}
+
+// addKeywordHex is like addKeyword for hex keywords.
+func (s *nftShell) addKeywordHex(keyword string, reset bool) error {
+	data, err := parseKeywordHex(keyword)
+	if err != nil {
+		return err
+	}
+	return s.addKeyword(data, reset)
+}
+
+// addKeyword adds a keyword rule and, if needed, starts
+// queueing packets such that we can match them.
+func (s *nftShell) addKeyword(keyword []byte, reset bool) error {
+	s.matcher.add(keyword, reset)
+	if s.queue != nil {
+		return nil
+	}
+	queue, err := newNFQConn(s.matcher, s.ns)
+	if errors.Is(err, netns.ErrRootless) {
+		return ErrKeywordsRootless
+	}
+	if err != nil {
+		return err
+	}
+	s.queue = queue
+	// We only queue TCP and UDP packets, which carry the keywords we're
+	// interested to, and, when we're not inside a namespace, we exempt
+	// root such that we do not queue the traffic of jafar itself.
+	args := []string{
+		"add", "rule", "ip", "jafar", "keywords", "meta", "l4proto", "{", "tcp,", "udp", "}",
+	}
+	if s.exemptRoot {
+		args = append(args, "meta", "skuid", "!=", "0")
+	}
+	return s.nft(append(args, "queue", "num", strconv.Itoa(keywordsQueue), "bypass")...)
+}
+
+func (s *nftShell) hijackDNS(address string) error {
+	// Hijack any DNS query, like the Vodafone station does when using the
+	// secure network feature. Our transparent proxies will use DoT, in order
+	// to bypass this restriction and avoid routing loop.
+	return s.nft(
+		"add", "rule", "ip", "jafar", "nat_output", "udp", "dport", "53",
+		"dnat", "to", address,
+	)
+}
+
+func (s *nftShell) hijackHTTPS(address string) error {
+	return s.hijackTCP("443", address)
+}
+
+func (s *nftShell) hijackHTTP(address string) error {
+	return s.hijackTCP("80", address)
+}
+
+// hijackTCP hijacks the TCP traffic to port towards address.
+func (s *nftShell) hijackTCP(port, address string) error {
+	args := []string{"add", "rule", "ip", "jafar", "nat_output", "tcp", "dport", port}
+	if s.exemptRoot {
+		// We need to whitelist root otherwise the traffic sent by Jafar
+		// itself will match the rule and loop.
+		args = append(args, "meta", "skuid", "!=", "0")
+	}
+	return s.nft(append(args, "dnat", "to", address)...)
+}
+
+func (s *nftShell) waive() error {
+	if s.queue != nil {
+		s.queue.Close()
+		s.queue = nil
+	}
+	s.matcher = &keywordMatcher{}
+	s.nftQuiet("delete", "table", "ip", "jafar")
+	return nil
+}
+
+func newNFTablesShell() *nftShell {
+	return &nftShell{
+		command:    []string{"sudo", "nft"},
+		exemptRoot: true,
+		matcher:    &keywordMatcher{},
+	}
+}
+
+func newNamespacedNFTablesShell(ns Namespace) *nftShell {
+	return &nftShell{
+		command: ns.Command("nft"),
+		matcher: &keywordMatcher{},
+		ns:      ns,
+	}
+}
@@ -0,0 +1,29 @@
+package iptables
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ooni/probe-cli/v3/internal/cmd/jafar/netns"
+)
+
+// rootlessNamespace is a Namespace we cannot enter.
+type rootlessNamespace struct{}
+
+func (rootlessNamespace) Command(argv ...string) []string {
+	return append([]string{"true"}, argv...)
+}
+
+func (rootlessNamespace) Do(f func() error) error {
+	return netns.ErrRootless
+}
+
+func TestNFTablesKeywordsRootless(t *testing.T) {
+	sh := newNamespacedNFTablesShell(rootlessNamespace{})
+	if err := sh.dropIfContainsKeyword("example.com"); !errors.Is(err, ErrKeywordsRootless) {
+		t.Fatal("unexpected err", err)
+	}
+	if sh.queue != nil {
+		t.Fatal("expected nil queue")
+	}
+}
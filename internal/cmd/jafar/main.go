@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 
@@ -22,6 +23,7 @@ import (
 	"github.com/ooni/probe-cli/v3/internal/cmd/jafar/flagx"
 	"github.com/ooni/probe-cli/v3/internal/cmd/jafar/httpproxy"
 	"github.com/ooni/probe-cli/v3/internal/cmd/jafar/iptables"
+	"github.com/ooni/probe-cli/v3/internal/cmd/jafar/netns"
 	"github.com/ooni/probe-cli/v3/internal/cmd/jafar/resolver"
 	"github.com/ooni/probe-cli/v3/internal/cmd/jafar/tlsproxy"
 	"github.com/ooni/probe-cli/v3/internal/cmd/jafar/uncensored"
@@ -42,6 +44,7 @@ var (
 	httpProxyAddress *string
 	httpProxyBlock   flagx.StringArray
 
+	iptablesBackend         *string
 	iptablesDropIP          flagx.StringArray
 	iptablesDropKeywordHex  flagx.StringArray
 	iptablesDropKeyword     flagx.StringArray
@@ -56,6 +59,8 @@ var (
 	mainCommand *string
 	mainUser    *string
 
+	netnsEnabled *bool
+
 	tag *string
 
 	tlsProxyAddress *string
@@ -108,6 +113,10 @@ func init() {
 	)
 
 	// iptables
+	iptablesBackend = flag.String(
+		"iptables-backend", "iptables",
+		"Program managing the firewall rules: iptables or nftables",
+	)
 	flag.Var(
 		&iptablesDropIP, "iptables-drop-ip",
 		"Drop traffic to the specified IP address",
@@ -153,6 +162,12 @@ func init() {
 	mainCommand = flag.String("main-command", "", "Optional command to execute")
 	mainUser = flag.String("main-user", "nobody", "Run command as user")
 
+	// netns
+	netnsEnabled = flag.Bool(
+		"netns", false,
+		"Apply iptables rules and run the command inside a network namespace",
+	)
+
 	// tag
 	tag = flag.String("tag", "", "Add tag to a specific run")
 
@@ -208,8 +223,15 @@ func httpProxyStart(uncensored *uncensored.Client) *http.Server {
 	return server
 }
 
-func iptablesStart() *iptables.CensoringPolicy {
-	policy := iptables.NewCensoringPolicy()
+func iptablesStart(ns *netns.Namespace) *iptables.CensoringPolicy {
+	var namespace iptables.Namespace
+	if ns != nil {
+		namespace = ns
+	}
+	policy, err := iptables.NewCensoringPolicyWithBackend(
+		iptables.Backend(*iptablesBackend), namespace,
+	)
+	runtimex.PanicOnError(err, "iptables.NewCensoringPolicyWithBackend failed")
 	// For robustness waive the policy so we start afresh
 	policy.Waive()
 	policy.DropIPs = iptablesDropIP
@@ -221,11 +243,112 @@ func iptablesStart() *iptables.CensoringPolicy {
 	policy.ResetIPs = iptablesResetIP
 	policy.ResetKeywordsHex = iptablesResetKeywordHex
 	policy.ResetKeywords = iptablesResetKeyword
-	err := policy.Apply()
+	err = policy.Apply()
 	runtimex.PanicOnError(err, "policy.Apply failed")
 	return policy
 }
 
+// netnsStart creates the network namespace and adapts the addresses
+// of the proxies and of the hijacking rules to the namespace.
+func netnsStart() *netns.Namespace {
+	ns := netns.New()
+	err := ns.Start()
+	runtimex.PanicOnError(err, "ns.Start failed")
+	// The namespace cannot reach the resolver of the host when it
+	// listens on localhost, so we always hijack DNS to our proxy.
+	if *iptablesHijackDNSTo == "" {
+		*iptablesHijackDNSTo = *dnsProxyAddress
+	}
+	proxies := []*string{
+		badProxyAddress, badProxyAddressTLS, dnsProxyAddress,
+		httpProxyAddress, tlsProxyAddress,
+	}
+	hijacks := []*string{
+		iptablesHijackDNSTo, iptablesHijackHTTPSTo, iptablesHijackHTTPTo,
+	}
+	if ns.Rootless {
+		// We cannot listen on privileged ports, so we listen on free ports
+		// and DNAT to them inside the namespace. Because DNAT happens only
+		// once, the hijacking rules must directly use the free ports.
+		ports := netnsForwardPrivilegedPorts(ns, proxies)
+		for _, address := range hijacks {
+			*address = netnsRemapPort(*address, ports)
+		}
+	}
+	for _, address := range hijacks {
+		*address = netnsAddress(*address, ns.GatewayIP())
+	}
+	for _, address := range proxies {
+		*address = netnsAddress(*address, ns.ListenIP())
+	}
+	return ns
+}
+
+// netnsForwardPrivilegedPorts makes the proxies listening on a privileged
+// loopback port listen on a free port, forwards the privileged port to the
+// free port inside the namespace, and returns the mapping between ports.
+func netnsForwardPrivilegedPorts(ns *netns.Namespace, proxies []*string) map[string]string {
+	ports := make(map[string]string)
+	for _, address := range proxies {
+		host, port, err := net.SplitHostPort(*address)
+		if err != nil || net.ParseIP(host) == nil || !net.ParseIP(host).IsLoopback() {
+			continue
+		}
+		if number, err := strconv.Atoi(port); err != nil || number <= 0 || number >= 1024 {
+			continue
+		}
+		if _, found := ports[port]; !found {
+			// Keep the listener open until we're done such that we do not
+			// pick the same free port twice.
+			listener, err := net.Listen("tcp", net.JoinHostPort(ns.ListenIP(), "0"))
+			runtimex.PanicOnError(err, "net.Listen failed")
+			defer listener.Close()
+			_, freePort, err := net.SplitHostPort(listener.Addr().String())
+			runtimex.PanicOnError(err, "net.SplitHostPort failed")
+			err = ns.Forward(port, freePort)
+			runtimex.PanicOnError(err, "ns.Forward failed")
+			ports[port] = freePort
+		}
+		*address = netnsRemapPort(*address, ports)
+	}
+	return ports
+}
+
+// netnsRemapPort replaces the port of address with the port to which
+// ports maps it, if any, provided that address uses a loopback IP.
+func netnsRemapPort(address string, ports map[string]string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || net.ParseIP(host) == nil || !net.ParseIP(host).IsLoopback() {
+		return address
+	}
+	if newPort, found := ports[port]; found {
+		return net.JoinHostPort(host, newPort)
+	}
+	return address
+}
+
+// netnsAddress replaces a loopback IP address in address with ip.
+func netnsAddress(address, ip string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || net.ParseIP(host) == nil || !net.ParseIP(host).IsLoopback() {
+		return address
+	}
+	return net.JoinHostPort(ip, port)
+}
+
+// mainCommandLine returns the command line for running the main command.
+func mainCommandLine(ns *netns.Namespace) string {
+	if ns == nil {
+		return fmt.Sprintf("sudo -u '%s' -- %s", *mainUser, *mainCommand)
+	}
+	if ns.Rootless {
+		// Inside a rootless namespace we cannot switch to another user.
+		log.Warnf("jafar: ignoring -main-user inside a rootless namespace")
+		return strings.Join(ns.Command(), " ") + " " + *mainCommand
+	}
+	return strings.Join(ns.Command("sudo", "-u", *mainUser, "--"), " ") + " " + *mainCommand
+}
+
 func tlsProxyStart(uncensored *uncensored.Client) net.Listener {
 	proxy := tlsproxy.NewCensoringProxy(tlsProxyBlock, uncensored)
 	listener, err := proxy.Start(*tlsProxyAddress)
@@ -260,6 +383,10 @@ func main() {
 	log.SetHandler(cli.Default)
 	log.Infof("jafar command line: [%s]", strings.Join(os.Args, ", "))
 	log.Infof("jafar tag: %s", *tag)
+	var ns *netns.Namespace
+	if *netnsEnabled {
+		ns = netnsStart()
+	}
 	uncensoredClient := newUncensoredClient()
 	defer uncensoredClient.CloseIdleConnections()
 	badlistener := badProxyStart()
@@ -272,15 +399,19 @@ func main() {
 	defer httpproxy.Close()
 	tlslistener := tlsProxyStart(uncensoredClient)
 	defer tlslistener.Close()
-	policy := iptablesStart()
+	policy := iptablesStart(ns)
 	var err error
 	if *mainCommand != "" {
-		err = shellx.RunCommandline(log.Log, fmt.Sprintf(
-			"sudo -u '%s' -- %s", *mainUser, *mainCommand,
-		))
+		err = shellx.RunCommandline(log.Log, mainCommandLine(ns))
 	} else {
+		if ns != nil {
+			log.Infof("jafar: use `%s` to enter the namespace", strings.Join(ns.Command("sh"), " "))
+		}
 		<-mainCh
 	}
 	policy.Waive()
+	if ns != nil {
+		ns.Close()
+	}
 	mustx(err, "subcommand failed", os.Exit)
 }
@@ -4,10 +4,12 @@ import (
 	"errors"
 	"os"
 	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/apex/log"
 	"github.com/ooni/probe-cli/v3/internal/cmd/jafar/iptables"
+	"github.com/ooni/probe-cli/v3/internal/cmd/jafar/netns"
 	"github.com/ooni/probe-cli/v3/internal/shellx"
 )
 
@@ -44,6 +46,66 @@ func TestWithCommand(t *testing.T) {
 	main()
 }
 
+func TestNetnsAddress(t *testing.T) {
+	inputs := map[string]string{
+		"127.0.0.1:53":    "10.117.0.1:53",
+		"[::1]:443":       "10.117.0.1:443",
+		"8.8.8.8:53":      "8.8.8.8:53",
+		"example.com:443": "example.com:443",
+		"":                "",
+	}
+	for input, expected := range inputs {
+		if output := netnsAddress(input, "10.117.0.1"); output != expected {
+			t.Fatal("unexpected output", input, output)
+		}
+	}
+}
+
+func TestNetnsRemapPort(t *testing.T) {
+	ports := map[string]string{"53": "40053", "443": "40443"}
+	inputs := map[string]string{
+		"127.0.0.1:53":    "127.0.0.1:40053",
+		"[::1]:443":       "[::1]:40443",
+		"127.0.0.1:8080":  "127.0.0.1:8080",
+		"8.8.8.8:53":      "8.8.8.8:53",
+		"example.com:443": "example.com:443",
+		"":                "",
+	}
+	for input, expected := range inputs {
+		if output := netnsRemapPort(input, ports); output != expected {
+			t.Fatal("unexpected output", input, output)
+		}
+	}
+}
+
+func TestMainCommandLine(t *testing.T) {
+	*mainCommand = "whoami"
+	defer func() {
+		*mainCommand = ""
+	}()
+	t.Run("without namespace", func(t *testing.T) {
+		if cmdline := mainCommandLine(nil); cmdline != "sudo -u 'nobody' -- whoami" {
+			t.Fatal("unexpected command line", cmdline)
+		}
+	})
+	t.Run("with namespace", func(t *testing.T) {
+		ns := netns.New()
+		ns.Rootless = false
+		cmdline := mainCommandLine(ns)
+		if cmdline != "sudo nsenter --target 0 --net -- sudo -u nobody -- whoami" {
+			t.Fatal("unexpected command line", cmdline)
+		}
+	})
+	t.Run("with rootless namespace", func(t *testing.T) {
+		ns := netns.New()
+		ns.Rootless = true
+		cmdline := mainCommandLine(ns)
+		if !strings.HasSuffix(cmdline, "-- env XTABLES_LOCKFILE=xtables.lock whoami") {
+			t.Fatal("unexpected command line", cmdline)
+		}
+	})
+}
+
 func TestMustx(t *testing.T) {
 	t.Run("with no error", func(t *testing.T) {
 		var called int
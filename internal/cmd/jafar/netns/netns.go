@@ -0,0 +1,270 @@
+// Package netns contains code for running jafar's main command inside an
+// isolated network namespace, where we apply the censorship rules, such
+// that jafar does not modify the firewall rules of the host. This package
+// really only works on Linux. In all other systems the functionality in
+// here is just a set of stubs returning errors.
+//
+// When running as root, we connect the namespace to the host using a veth
+// pair and NAT its traffic. Otherwise, we create the network namespace
+// inside a user namespace and use slirp4netns to connect it to the host.
+//
+// The namespace lives as long as a holder process that the kernel kills
+// when jafar exits. Therefore, the namespace and everything inside it
+// (including the censorship rules and the veth pair) disappear even if
+// jafar crashes. When running as root, the only state we leave behind
+// after a crash is the NAT configuration of the host, which we remove
+// when we start again, and IP forwarding, which we leave enabled. The
+// README of jafar explains how to remove this state manually.
+package netns
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-cli/v3/internal/shellx"
+	"golang.org/x/sys/execabs"
+)
+
+// Namespace is an isolated network namespace.
+type Namespace struct {
+	// HostDevice is the name of the host side of the veth pair.
+	HostDevice string
+
+	// HostIP is the IP address of the host side of the veth pair.
+	HostIP string
+
+	// NamespaceDevice is the name of the namespace side of the veth pair.
+	NamespaceDevice string
+
+	// NamespaceIP is the IP address of the namespace side of the veth pair.
+	NamespaceIP string
+
+	// Network is the network containing HostIP and NamespaceIP.
+	Network string
+
+	// Rootless indicates that we create the network namespace inside
+	// a user namespace and use slirp4netns rather than a veth pair.
+	Rootless bool
+
+	holder     *execabs.Cmd
+	forwarding string
+	slirp      *execabs.Cmd
+	tempDir    string
+}
+
+// New creates a new Namespace. The namespace is rootless when we are
+// not running as root. You must call Start to create the namespace.
+func New() *Namespace {
+	return &Namespace{
+		HostDevice:      "jafar0",
+		HostIP:          "10.117.0.1",
+		NamespaceDevice: "jafar1",
+		NamespaceIP:     "10.117.0.2",
+		Network:         "10.117.0.0/30",
+		Rootless:        os.Geteuid() != 0,
+	}
+}
+
+// slirpGatewayIP is the IP address through which slirp4netns allows
+// the namespace to reach the loopback interface of the host.
+const slirpGatewayIP = "10.0.2.2"
+
+// ErrNotStarted indicates that the namespace has not been started.
+var ErrNotStarted = errors.New("netns: namespace not started")
+
+// Start creates the namespace and connects it to the host.
+func (ns *Namespace) Start() error {
+	if !ns.Rootless {
+		ns.waive() // for robustness, remove leftovers of previous runs
+	}
+	holder, err := startHolder(ns.Rootless)
+	if err != nil {
+		return err
+	}
+	ns.holder = holder
+	if err := ns.configure(); err != nil {
+		ns.Close()
+		return err
+	}
+	return nil
+}
+
+// configure connects the namespace to the host.
+func (ns *Namespace) configure() error {
+	if ns.Rootless {
+		tempDir, err := os.MkdirTemp("", "jafar-netns")
+		if err != nil {
+			return err
+		}
+		ns.tempDir = tempDir
+		slirp, err := startSlirp(ns.PID())
+		if err != nil {
+			return err
+		}
+		ns.slirp = slirp
+		return ns.run(ns.Command("ip", "link", "set", "lo", "up"))
+	}
+	forwarding, err := os.ReadFile("/proc/sys/net/ipv4/ip_forward")
+	if err != nil {
+		return err
+	}
+	ns.forwarding = strings.TrimSpace(string(forwarding))
+	_, network, err := net.ParseCIDR(ns.Network)
+	if err != nil {
+		return err
+	}
+	ones, _ := network.Mask.Size()
+	prefix := strconv.Itoa(ones)
+	commands := [][]string{
+		{"sudo", "ip", "link", "add", ns.HostDevice, "type", "veth", "peer", "name", ns.NamespaceDevice},
+		{"sudo", "ip", "link", "set", ns.NamespaceDevice, "netns", strconv.Itoa(ns.PID())},
+		{"sudo", "ip", "addr", "add", ns.HostIP + "/" + prefix, "dev", ns.HostDevice},
+		{"sudo", "ip", "link", "set", ns.HostDevice, "up"},
+		ns.Command("ip", "link", "set", "lo", "up"),
+		ns.Command("ip", "addr", "add", ns.NamespaceIP+"/"+prefix, "dev", ns.NamespaceDevice),
+		ns.Command("ip", "link", "set", ns.NamespaceDevice, "up"),
+		ns.Command("ip", "route", "add", "default", "via", ns.HostIP),
+		{"sudo", "sysctl", "-w", "net.ipv4.ip_forward=1"},
+		{"sudo", "iptables", "-t", "nat", "-N", "JAFAR_NETNS_POSTROUTING"},
+		{"sudo", "iptables", "-t", "nat", "-I", "POSTROUTING", "-j", "JAFAR_NETNS_POSTROUTING"},
+		{"sudo", "iptables", "-t", "nat", "-A", "JAFAR_NETNS_POSTROUTING", "-s", ns.Network,
+			"!", "-o", ns.HostDevice, "-j", "MASQUERADE"},
+		{"sudo", "iptables", "-N", "JAFAR_NETNS_FORWARD"},
+		{"sudo", "iptables", "-I", "FORWARD", "-j", "JAFAR_NETNS_FORWARD"},
+		{"sudo", "iptables", "-A", "JAFAR_NETNS_FORWARD", "-i", ns.HostDevice, "-j", "ACCEPT"},
+		{"sudo", "iptables", "-A", "JAFAR_NETNS_FORWARD", "-o", ns.HostDevice, "-j", "ACCEPT"},
+	}
+	for _, argv := range commands {
+		if err := ns.run(argv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// run runs the given command.
+func (ns *Namespace) run(argv []string) error {
+	return shellx.Run(log.Log, argv[0], argv[1:]...)
+}
+
+// PID returns the PID of the process holding the namespace.
+func (ns *Namespace) PID() int {
+	if ns.holder == nil {
+		return 0
+	}
+	return ns.holder.Process.Pid
+}
+
+// Command returns the command line for running the given command
+// inside the namespace. When rootless, the command line also tells
+// iptables to use a lock file we can write, since we cannot write
+// the default one, which lives in /run.
+func (ns *Namespace) Command(argv ...string) []string {
+	pid := strconv.Itoa(ns.PID())
+	if ns.Rootless {
+		lockFile := filepath.Join(ns.tempDir, "xtables.lock")
+		return append([]string{
+			"nsenter", "--target", pid, "--user", "--net", "--preserve-credentials",
+			"--", "env", "XTABLES_LOCKFILE=" + lockFile,
+		}, argv...)
+	}
+	return append([]string{"sudo", "nsenter", "--target", pid, "--net", "--"}, argv...)
+}
+
+// ErrRootless indicates that we cannot enter a rootless namespace, which
+// belongs to a user namespace where we do not live.
+var ErrRootless = errors.New("netns: cannot enter a rootless namespace")
+
+// Do runs f on a thread living inside the namespace. Note that the sockets
+// created by f remain inside the namespace after Do returns.
+func (ns *Namespace) Do(f func() error) error {
+	if ns.holder == nil {
+		return ErrNotStarted
+	}
+	if ns.Rootless {
+		return ErrRootless
+	}
+	return doInNamespace(ns.PID(), f)
+}
+
+// ListenIP returns the IP address on which the servers running on the
+// host should listen to be reachable from inside the namespace.
+func (ns *Namespace) ListenIP() string {
+	if ns.Rootless {
+		return "127.0.0.1"
+	}
+	return ns.HostIP
+}
+
+// GatewayIP returns the IP address that the namespace should use
+// for connecting to the servers listening on ListenIP.
+func (ns *Namespace) GatewayIP() string {
+	if ns.Rootless {
+		return slirpGatewayIP
+	}
+	return ns.HostIP
+}
+
+// Forward makes a server listening on hostPort on the loopback interface
+// of the host reachable from inside the namespace using GatewayIP and port.
+// We need this when rootless, because we cannot listen on privileged ports,
+// hence we listen on an unprivileged port and DNAT to it.
+func (ns *Namespace) Forward(port, hostPort string) error {
+	if ns.holder == nil {
+		return ErrNotStarted
+	}
+	gateway := ns.GatewayIP()
+	for _, proto := range []string{"tcp", "udp"} {
+		argv := ns.Command(
+			"iptables", "-t", "nat", "-A", "OUTPUT", "-d", gateway, "-p", proto,
+			"--dport", port, "-j", "DNAT", "--to-destination",
+			net.JoinHostPort(gateway, hostPort),
+		)
+		if err := ns.run(argv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close destroys the namespace. This method is idempotent.
+func (ns *Namespace) Close() error {
+	if ns.holder == nil {
+		return ErrNotStarted
+	}
+	for _, cmd := range []*execabs.Cmd{ns.slirp, ns.holder} {
+		if cmd != nil && cmd.ProcessState == nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+		}
+	}
+	if ns.tempDir != "" {
+		os.RemoveAll(ns.tempDir)
+		ns.tempDir = ""
+	}
+	if !ns.Rootless {
+		ns.waive()
+		if ns.forwarding != "" && ns.forwarding != "1" {
+			shellx.RunQuiet("sudo", "sysctl", "-w", fmt.Sprintf("net.ipv4.ip_forward=%s", ns.forwarding))
+		}
+		ns.forwarding = ""
+	}
+	return nil
+}
+
+// waive removes the configuration that we add to the host.
+func (ns *Namespace) waive() {
+	shellx.RunQuiet("sudo", "ip", "link", "del", ns.HostDevice)
+	shellx.RunQuiet("sudo", "iptables", "-t", "nat", "-D", "POSTROUTING", "-j", "JAFAR_NETNS_POSTROUTING")
+	shellx.RunQuiet("sudo", "iptables", "-t", "nat", "-F", "JAFAR_NETNS_POSTROUTING")
+	shellx.RunQuiet("sudo", "iptables", "-t", "nat", "-X", "JAFAR_NETNS_POSTROUTING")
+	shellx.RunQuiet("sudo", "iptables", "-D", "FORWARD", "-j", "JAFAR_NETNS_FORWARD")
+	shellx.RunQuiet("sudo", "iptables", "-F", "JAFAR_NETNS_FORWARD")
+	shellx.RunQuiet("sudo", "iptables", "-X", "JAFAR_NETNS_FORWARD")
+}
@@ -0,0 +1,106 @@
+//go:build linux
+// +build linux
+
+package netns
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/execabs"
+	"golang.org/x/sys/unix"
+)
+
+// startHolder starts the process holding the network namespace. The
+// kernel kills this process when jafar exits, which in turn causes the
+// kernel to destroy the namespace once no process lives inside it.
+func startHolder(rootless bool) (*execabs.Cmd, error) {
+	cmd := execabs.Command("sleep", "infinity")
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWNET,
+		Pdeathsig:  syscall.SIGKILL,
+	}
+	if rootless {
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWUSER
+		cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{
+			ContainerID: 0,
+			HostID:      os.Getuid(),
+			Size:        1,
+		}}
+		cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{
+			ContainerID: 0,
+			HostID:      os.Getgid(),
+			Size:        1,
+		}}
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+// startSlirp starts slirp4netns to connect the namespace held by
+// the given PID to the host and waits for it to be ready.
+func startSlirp(pid int) (*execabs.Cmd, error) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	cmd := execabs.Command(
+		"slirp4netns", "--configure", "--mtu=65520", "--ready-fd=3",
+		strconv.Itoa(pid), "tap0",
+	)
+	cmd.ExtraFiles = []*os.File{writer} // becomes fd 3 in the child
+	cmd.SysProcAttr = &syscall.SysProcAttr{Pdeathsig: syscall.SIGKILL}
+	err = cmd.Start()
+	writer.Close()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := reader.Read(make([]byte, 1)); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, fmt.Errorf("netns: slirp4netns failed: %w", err)
+	}
+	return cmd, nil
+}
+
+// doInNamespace runs f on a thread living inside the network namespace of
+// the given PID. We use a dedicated goroutine and we only unlock its thread
+// after restoring the original namespace. Otherwise, the thread terminates
+// with the goroutine rather than serving other goroutines.
+func doInNamespace(pid int, f func() error) error {
+	errch := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		origin, err := os.Open("/proc/thread-self/ns/net")
+		if err != nil {
+			runtime.UnlockOSThread()
+			errch <- err
+			return
+		}
+		defer origin.Close()
+		target, err := os.Open(fmt.Sprintf("/proc/%d/ns/net", pid))
+		if err != nil {
+			runtime.UnlockOSThread()
+			errch <- err
+			return
+		}
+		defer target.Close()
+		if err := unix.Setns(int(target.Fd()), unix.CLONE_NEWNET); err != nil {
+			runtime.UnlockOSThread()
+			errch <- err
+			return
+		}
+		err = f()
+		if unix.Setns(int(origin.Fd()), unix.CLONE_NEWNET) == nil {
+			runtime.UnlockOSThread()
+		}
+		errch <- err
+	}()
+	return <-errch
+}
@@ -0,0 +1,118 @@
+package netns
+
+import (
+	"errors"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/sys/execabs"
+)
+
+func TestNamespace(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("not implemented on this platform")
+	}
+	if testing.Short() {
+		t.Skip("skip test in short mode")
+	}
+	ns := New()
+	if err := ns.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer ns.Close()
+	argv := ns.Command("ip", "-4", "addr", "show")
+	output, err := execabs.Command(argv[0], argv[1:]...).CombinedOutput()
+	if err != nil {
+		t.Fatal(err, string(output))
+	}
+	if !ns.Rootless && !strings.Contains(string(output), ns.NamespaceIP) {
+		t.Fatal("the namespace is not configured", string(output))
+	}
+	if !strings.Contains(string(output), "127.0.0.1") {
+		t.Fatal("the loopback interface is not configured", string(output))
+	}
+	if !ns.Rootless {
+		var names []string
+		err := ns.Do(func() error {
+			interfaces, err := net.Interfaces()
+			for _, iface := range interfaces {
+				names = append(names, iface.Name)
+			}
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"lo", ns.NamespaceDevice}, names); diff != "" {
+			t.Fatal(diff)
+		}
+	}
+	holder := ns.holder
+	if err := ns.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if holder.ProcessState == nil {
+		t.Fatal("the holder is still running")
+	}
+	if _, err := os.Stat("/sys/class/net/" + ns.HostDevice); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal("the veth pair still exists", err)
+	}
+	if err := ns.Close(); err != nil {
+		t.Fatal("Close is not idempotent", err)
+	}
+}
+
+func TestCloseBeforeStart(t *testing.T) {
+	if err := New().Close(); !errors.Is(err, ErrNotStarted) {
+		t.Fatal("unexpected err", err)
+	}
+}
+
+func TestDoBeforeStart(t *testing.T) {
+	err := New().Do(func() error {
+		return nil
+	})
+	if !errors.Is(err, ErrNotStarted) {
+		t.Fatal("unexpected err", err)
+	}
+}
+
+func TestForwardBeforeStart(t *testing.T) {
+	if err := New().Forward("53", "5353"); !errors.Is(err, ErrNotStarted) {
+		t.Fatal("unexpected err", err)
+	}
+}
+
+func TestAddresses(t *testing.T) {
+	t.Run("when running as root", func(t *testing.T) {
+		ns := New()
+		ns.Rootless = false
+		if ns.ListenIP() != ns.HostIP || ns.GatewayIP() != ns.HostIP {
+			t.Fatal("unexpected addresses")
+		}
+		expected := []string{"sudo", "nsenter", "--target", "0", "--net", "--", "true"}
+		if diff := cmp.Diff(expected, ns.Command("true")); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("when rootless", func(t *testing.T) {
+		ns := New()
+		ns.Rootless = true
+		ns.tempDir = "/tmp/x"
+		if ns.ListenIP() != "127.0.0.1" || ns.GatewayIP() != slirpGatewayIP {
+			t.Fatal("unexpected addresses")
+		}
+		expected := []string{
+			"nsenter", "--target", "0", "--user", "--net", "--preserve-credentials",
+			"--", "env", "XTABLES_LOCKFILE=/tmp/x/xtables.lock", "true",
+		}
+		if diff := cmp.Diff(expected, ns.Command("true")); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+// +build !linux
+
+package netns
+
+import (
+	"errors"
+
+	"golang.org/x/sys/execabs"
+)
+
+func startHolder(rootless bool) (*execabs.Cmd, error) {
+	return nil, errors.New("not implemented")
+}
+
+func startSlirp(pid int) (*execabs.Cmd, error) {
+	return nil, errors.New("not implemented")
+}
+
+func doInNamespace(pid int, f func() error) error {
+	return errors.New("not implemented")
+}
@@ -0,0 +1,402 @@
+package regression
+
+// telegramPOPs contains the IP addresses of the Telegram POPs.
+var telegramPOPs = []string{
+	"149.154.175.50",
+	"149.154.167.51",
+	"149.154.175.100",
+	"149.154.167.91",
+	"149.154.171.5",
+	"95.161.76.100",
+}
+
+// argsForEach returns the flag and value pairs for each value.
+func argsForEach(flag string, values ...string) []string {
+	var out []string
+	for _, value := range values {
+		out = append(out, flag, value)
+	}
+	return out
+}
+
+// Cases is the expected-verdict table. For each jafar technique, it
+// contains one or more experiments along with the test keys we expect
+// them to produce. The verdicts are the ones checked by the QA scripts
+// in the QA directory, which these cases aim to replace.
+var Cases = []*Case{
+
+	//
+	// no censorship
+	//
+
+	{
+		Name:       "webconnectivity_https_successful_website",
+		Technique:  "none",
+		Experiment: "web_connectivity",
+		Input:      "https://example.com/",
+		Expect: map[string]interface{}{
+			"dns_experiment_failure":  nil,
+			"control_failure":         nil,
+			"http_experiment_failure": nil,
+			"blocking":                false,
+			"accessible":              true,
+		},
+	}, {
+		Name:       "dnscheck_successful_lookups",
+		Technique:  "none",
+		Experiment: "dnscheck",
+		Input:      "dot://dns.google",
+		Expect: map[string]interface{}{
+			"bootstrap_failure": nil,
+			"lookups/*/failure": nil,
+		},
+	}, {
+		Name:       "sniblocking_successful_handshake",
+		Technique:  "none",
+		Experiment: "sniblocking",
+		Input:      "example.com",
+		Expect: map[string]interface{}{
+			"result": "success.got_server_hello",
+		},
+	}, {
+		Name:       "telegram_successful",
+		Technique:  "none",
+		Experiment: "telegram",
+		Expect: map[string]interface{}{
+			"telegram_tcp_blocking":  false,
+			"telegram_http_blocking": false,
+			"telegram_web_failure":   nil,
+			"telegram_web_status":    "ok",
+		},
+	},
+
+	//
+	// dns-proxy-block
+	//
+
+	{
+		Name:       "webconnectivity_dns_blocking_nxdomain",
+		Technique:  "dns-proxy-block",
+		Experiment: "web_connectivity",
+		Input:      "https://example.com/",
+		JafarArgs: []string{
+			"-iptables-hijack-dns-to", "127.0.0.1:53",
+			"-dns-proxy-block", "example.com",
+		},
+		Expect: map[string]interface{}{
+			"dns_experiment_failure":  "dns_nxdomain_error",
+			"control_failure":         nil,
+			"http_experiment_failure": nil,
+			"blocking":                "dns",
+			"accessible":              false,
+		},
+	}, {
+		Name:       "dnscheck_bootstrap_nxdomain",
+		Technique:  "dns-proxy-block",
+		Experiment: "dnscheck",
+		Input:      "dot://dns.google",
+		JafarArgs: []string{
+			"-iptables-hijack-dns-to", "127.0.0.1:53",
+			"-dns-proxy-block", "dns.google",
+		},
+		Expect: map[string]interface{}{
+			"bootstrap_failure": "dns_nxdomain_error",
+		},
+	},
+
+	//
+	// dns-proxy-hijack
+	//
+
+	{
+		Name:       "webconnectivity_dns_hijacking",
+		Technique:  "dns-proxy-hijack",
+		Experiment: "web_connectivity",
+		Input:      "https://example.org/",
+		JafarArgs: []string{
+			"-iptables-hijack-dns-to", "127.0.0.1:53",
+			"-dns-proxy-hijack", "example.org",
+		},
+		Expect: map[string]interface{}{
+			"dns_experiment_failure":  nil,
+			"dns_consistency":         "inconsistent",
+			"control_failure":         nil,
+			"http_experiment_failure": nil,
+			"blocking":                false,
+			"accessible":              true,
+		},
+	},
+
+	//
+	// http-proxy-block
+	//
+
+	{
+		Name:       "webconnectivity_http_diff_with_consistent_dns",
+		Technique:  "http-proxy-block",
+		Experiment: "web_connectivity",
+		Input:      "http://example.org/",
+		JafarArgs: []string{
+			"-iptables-hijack-http-to", "127.0.0.1:80",
+			"-http-proxy-block", "example.org",
+		},
+		Expect: map[string]interface{}{
+			"dns_experiment_failure":  nil,
+			"control_failure":         nil,
+			"http_experiment_failure": nil,
+			"blocking":                "http-diff",
+			"accessible":              false,
+		},
+	},
+
+	//
+	// bad-proxy
+	//
+
+	{
+		Name:       "webconnectivity_http_eof_error_with_consistent_dns",
+		Technique:  "bad-proxy",
+		Experiment: "web_connectivity",
+		Input:      "http://nexa.polito.it/",
+		JafarArgs: []string{
+			"-iptables-hijack-dns-to", "127.0.0.1:53",
+			"-dns-proxy-hijack", "nexa.polito.it",
+			"-iptables-hijack-http-to", "127.0.0.1:7117",
+		},
+		Expect: map[string]interface{}{
+			"dns_experiment_failure":  nil,
+			"control_failure":         nil,
+			"http_experiment_failure": "eof_error",
+			"blocking":                "http-failure",
+			"accessible":              false,
+		},
+	},
+
+	//
+	// iptables-drop-keyword
+	//
+
+	{
+		Name:       "webconnectivity_http_generic_timeout_error_with_consistent_dns",
+		Technique:  "iptables-drop-keyword",
+		Experiment: "web_connectivity",
+		Input:      "http://nexa.polito.it/",
+		JafarArgs: []string{
+			"-iptables-hijack-dns-to", "127.0.0.1:53",
+			"-dns-proxy-hijack", "nexa.polito.it",
+			"-iptables-drop-keyword", "Host: nexa",
+		},
+		Expect: map[string]interface{}{
+			"dns_experiment_failure":  nil,
+			"control_failure":         nil,
+			"http_experiment_failure": "generic_timeout_error",
+			"blocking":                "http-failure",
+			"accessible":              false,
+		},
+	}, {
+		Name:       "sniblocking_drop_keyword",
+		Technique:  "iptables-drop-keyword",
+		Experiment: "sniblocking",
+		Input:      "example.com",
+		JafarArgs: []string{
+			"-iptables-drop-keyword", "example.com",
+		},
+		Expect: map[string]interface{}{
+			"result": "anomaly.timeout",
+		},
+	},
+
+	//
+	// iptables-reset-keyword
+	//
+
+	{
+		Name:       "webconnectivity_http_connection_reset_with_consistent_dns",
+		Technique:  "iptables-reset-keyword",
+		Experiment: "web_connectivity",
+		Input:      "http://nexa.polito.it/",
+		JafarArgs: []string{
+			"-iptables-reset-keyword", "Host: nexa",
+		},
+		Expect: map[string]interface{}{
+			"dns_experiment_failure":  nil,
+			"control_failure":         nil,
+			"http_experiment_failure": "connection_reset",
+			"blocking":                "http-failure",
+			"accessible":              false,
+		},
+	}, {
+		Name:       "webconnectivity_https_ok_with_control_failure",
+		Technique:  "iptables-reset-keyword",
+		Experiment: "web_connectivity",
+		Input:      "https://example.com/",
+		JafarArgs: []string{
+			"-iptables-reset-keyword", "wcth.ooni.io",
+			"-iptables-reset-keyword", "th.ooni.org",
+		},
+		Expect: map[string]interface{}{
+			"dns_experiment_failure":  nil,
+			"control_failure":         "connection_reset",
+			"http_experiment_failure": nil,
+			"blocking":                false,
+			"accessible":              true,
+		},
+	}, {
+		Name:       "dnscheck_dot_connection_reset",
+		Technique:  "iptables-reset-keyword",
+		Experiment: "dnscheck",
+		Input:      "dot://dns.google",
+		JafarArgs: []string{
+			"-iptables-reset-keyword", "dns.google",
+		},
+		Expect: map[string]interface{}{
+			"bootstrap_failure": nil,
+			"lookups/*/failure": "connection_reset",
+		},
+	}, {
+		Name:       "sniblocking_reset_keyword",
+		Technique:  "iptables-reset-keyword",
+		Experiment: "sniblocking",
+		Input:      "example.com",
+		JafarArgs: []string{
+			"-iptables-reset-keyword", "example.com",
+		},
+		Expect: map[string]interface{}{
+			"result": "interference.reset",
+		},
+	}, {
+		Name:       "telegram_http_blocking_all",
+		Technique:  "iptables-reset-keyword",
+		Experiment: "telegram",
+		JafarArgs:  argsForEach("-iptables-reset-keyword", telegramPOPs...),
+		Expect: map[string]interface{}{
+			"telegram_tcp_blocking":  false,
+			"telegram_http_blocking": true,
+			"telegram_web_failure":   nil,
+			"telegram_web_status":    "ok",
+		},
+	}, {
+		Name:       "telegram_web_failure_http",
+		Technique:  "iptables-reset-keyword",
+		Experiment: "telegram",
+		JafarArgs: []string{
+			"-iptables-reset-keyword", "Host: web.telegram.org",
+		},
+		Expect: map[string]interface{}{
+			"telegram_tcp_blocking":  false,
+			"telegram_http_blocking": false,
+			"telegram_web_failure":   "connection_reset",
+			"telegram_web_status":    "blocked",
+		},
+	},
+
+	//
+	// iptables-reset-keyword-hex
+	//
+
+	{
+		Name:       "telegram_web_failure_https",
+		Technique:  "iptables-reset-keyword-hex",
+		Experiment: "telegram",
+		JafarArgs: []string{
+			// SNI extension containing web.telegram.org
+			"-iptables-reset-keyword-hex",
+			"|00 00 00 15 00 13 00 00 10 77 65 62 2e 74 65 6c 65 67 72 61 6d 2e 6f 72 67|",
+		},
+		Expect: map[string]interface{}{
+			"telegram_tcp_blocking":  false,
+			"telegram_http_blocking": false,
+			"telegram_web_failure":   "connection_reset",
+			"telegram_web_status":    "blocked",
+		},
+	},
+
+	//
+	// iptables-reset-ip
+	//
+
+	{
+		Name:       "telegram_tcp_blocking_all",
+		Technique:  "iptables-reset-ip",
+		Experiment: "telegram",
+		JafarArgs:  argsForEach("-iptables-reset-ip", telegramPOPs...),
+		Expect: map[string]interface{}{
+			"telegram_tcp_blocking":  true,
+			"telegram_http_blocking": true,
+			"telegram_web_failure":   nil,
+			"telegram_web_status":    "ok",
+		},
+	}, {
+		Name:       "dnscheck_connection_refused",
+		Technique:  "iptables-reset-ip",
+		Experiment: "dnscheck",
+		Input:      "dot://dns.google",
+		JafarArgs:  argsForEach("-iptables-reset-ip", "8.8.8.8", "8.8.4.4"),
+		Expect: map[string]interface{}{
+			"bootstrap_failure": nil,
+			"lookups/*/failure": "connection_refused",
+		},
+	},
+
+	//
+	// iptables-drop-ip
+	//
+
+	{
+		Name:       "webconnectivity_tcpip_blocking_with_consistent_dns",
+		Technique:  "iptables-drop-ip",
+		Experiment: "web_connectivity",
+		Input:      "http://nexa.polito.it/",
+		JafarArgs: []string{
+			"-iptables-drop-ip", "130.192.16.171", // nexa.polito.it
+		},
+		Expect: map[string]interface{}{
+			"dns_experiment_failure":  nil,
+			"control_failure":         nil,
+			"http_experiment_failure": "generic_timeout_error",
+			"blocking":                "tcp_ip",
+			"accessible":              false,
+		},
+	},
+
+	//
+	// iptables-hijack-https-to
+	//
+
+	{
+		Name:       "webconnectivity_transparent_https_proxy",
+		Technique:  "iptables-hijack-https-to",
+		Experiment: "web_connectivity",
+		Input:      "https://example.org/",
+		JafarArgs: []string{
+			"-iptables-hijack-https-to", "127.0.0.1:443",
+		},
+		Expect: map[string]interface{}{
+			"dns_experiment_failure":  nil,
+			"dns_consistency":         "consistent",
+			"control_failure":         nil,
+			"http_experiment_failure": nil,
+			"blocking":                false,
+			"accessible":              true,
+		},
+	},
+
+	//
+	// tls-proxy-block
+	//
+
+	{
+		Name:       "sniblocking_tls_proxy_alert",
+		Technique:  "tls-proxy-block",
+		Experiment: "sniblocking",
+		Input:      "example.com",
+		JafarArgs: []string{
+			"-iptables-hijack-https-to", "127.0.0.1:443",
+			"-tls-proxy-block", "example.com",
+		},
+		Expect: map[string]interface{}{
+			// the proxy sends an alert, hence ssl_failed_handshake
+			"result": "anomaly.unexpected_failure",
+		},
+	},
+}
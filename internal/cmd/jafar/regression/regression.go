@@ -0,0 +1,326 @@
+// Package regression runs experiments inside jafar and checks whether
+// the resulting test keys match the verdicts we expect for each of
+// the censorship techniques that jafar supports.
+package regression
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-cli/v3/internal/shellx"
+)
+
+// Case is a regression test case.
+type Case struct {
+	// Name is the unique name of the case.
+	Name string
+
+	// Technique is the jafar censorship technique we're using.
+	Technique string
+
+	// Experiment is the experiment to run.
+	Experiment string
+
+	// Input is the OPTIONAL experiment input.
+	Input string
+
+	// Options contains OPTIONAL experiment options (KEY=VALUE).
+	Options []string
+
+	// JafarArgs contains the jafar command line arguments
+	// implementing the censorship technique.
+	JafarArgs []string
+
+	// Expect maps a test keys path to its expected value. A path
+	// is a sequence of keys separated by `/` where `*` matches all
+	// the values of a map or all the elements of an array. For
+	// example, `lookups/*/failure` requires each entry of the
+	// `lookups` map to contain the expected `failure`.
+	Expect map[string]interface{}
+}
+
+// Mismatch is a test keys path whose value differs from the expected one.
+type Mismatch struct {
+	// Path is the test keys path.
+	Path string
+
+	// Expected is the expected value.
+	Expected interface{}
+
+	// Got is the value we got.
+	Got interface{}
+
+	// Missing indicates that the path does not exist.
+	Missing bool
+}
+
+// Result is the result of running a Case.
+type Result struct {
+	// Case is the case we run.
+	Case *Case
+
+	// Err is the error that prevented us from checking the
+	// test keys (e.g., we could not read the report).
+	Err error
+
+	// Mismatches contains the paths whose value is not expected.
+	Mismatches []*Mismatch
+}
+
+// Passed returns whether the case passed.
+func (r *Result) Passed() bool {
+	return r.Err == nil && len(r.Mismatches) <= 0
+}
+
+// Runner runs regression test cases.
+type Runner struct {
+	// Jafar is the path of the jafar binary.
+	Jafar string
+
+	// MainUser is the user that runs miniooni inside jafar.
+	MainUser string
+
+	// Miniooni is the path of the miniooni binary.
+	Miniooni string
+
+	// WorkDir is the directory where we write the reports. It must
+	// be writable by MainUser, which also uses it as home.
+	WorkDir string
+
+	// run allows mocking shellx.Run in tests.
+	run func(name string, arg ...string) error
+}
+
+// NewRunner creates a new Runner using jafar and miniooni binaries
+// at the given paths and writing the reports inside workDir.
+func NewRunner(jafar, miniooni, workDir string) *Runner {
+	return &Runner{
+		Jafar:    jafar,
+		MainUser: "nobody",
+		Miniooni: miniooni,
+		WorkDir:  workDir,
+		run: func(name string, arg ...string) error {
+			return shellx.Run(log.Log, name, arg...)
+		},
+	}
+}
+
+// ErrWorkDirNotWritable indicates that MainUser cannot write WorkDir.
+var ErrWorkDirNotWritable = errors.New("regression: work dir not writable by main user")
+
+// CheckWorkDir returns ErrWorkDirNotWritable if MainUser
+// cannot write into WorkDir and nil otherwise.
+func (r *Runner) CheckWorkDir() error {
+	if err := r.run("sudo", "-u", r.MainUser, "--", "test", "-w", r.WorkDir); err != nil {
+		return fmt.Errorf("%w: %s (%s)", ErrWorkDirNotWritable, r.WorkDir, err.Error())
+	}
+	return nil
+}
+
+// Run runs the given case.
+func (r *Runner) Run(c *Case) *Result {
+	result := &Result{Case: c}
+	reportFile := filepath.Join(r.WorkDir, c.Name+".jsonl")
+	if err := os.Remove(reportFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		result.Err = err
+		return result
+	}
+	// Note: jafar propagates the exit code of miniooni. We ignore it
+	// because the report tells us everything we need to know and
+	// miniooni may fail once it has written the measurement.
+	err := r.run(r.Jafar, r.jafarArgs(c, reportFile)...)
+	testKeys, rerr := readTestKeys(reportFile)
+	if rerr != nil {
+		if err != nil {
+			rerr = fmt.Errorf("%w (jafar: %s)", rerr, err.Error())
+		}
+		result.Err = rerr
+		return result
+	}
+	result.Mismatches = Compare(c.Expect, testKeys)
+	return result
+}
+
+// jafarArgs returns the jafar arguments for running the given case.
+func (r *Runner) jafarArgs(c *Case, reportFile string) []string {
+	command := []string{
+		r.Miniooni, "--yes", "-n", "--home", r.WorkDir, "-o", reportFile,
+	}
+	if c.Input != "" {
+		command = append(command, "-i", c.Input)
+	}
+	for _, option := range c.Options {
+		command = append(command, "-O", option)
+	}
+	command = append(command, c.Experiment)
+	var quoted []string
+	for _, arg := range command {
+		quoted = append(quoted, "'"+strings.ReplaceAll(arg, "'", `'"'"'`)+"'")
+	}
+	args := []string{
+		"-main-command", strings.Join(quoted, " "),
+		"-main-user", r.MainUser,
+		"-tag", c.Name,
+	}
+	return append(args, c.JafarArgs...)
+}
+
+// ErrEmptyReport indicates that the report contains no measurement.
+var ErrEmptyReport = errors.New("regression: the report contains no measurement")
+
+// readTestKeys reads the test keys of the first measurement in reportFile.
+func readTestKeys(reportFile string) (interface{}, error) {
+	filep, err := os.Open(reportFile)
+	if err != nil {
+		return nil, err
+	}
+	defer filep.Close()
+	reader := bufio.NewReader(filep)
+	line, err := reader.ReadBytes('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if len(line) <= 0 {
+		return nil, ErrEmptyReport
+	}
+	var measurement struct {
+		TestKeys interface{} `json:"test_keys"`
+	}
+	if err := json.Unmarshal(line, &measurement); err != nil {
+		return nil, err
+	}
+	return measurement.TestKeys, nil
+}
+
+// Compare compares the expected values with the given test keys, which
+// should have been obtained by parsing JSON, and returns the mismatches.
+func Compare(expect map[string]interface{}, testKeys interface{}) []*Mismatch {
+	var out []*Mismatch
+	for _, path := range sortedKeys(expect) {
+		expected := normalize(expect[path])
+		values := lookup(testKeys, strings.Split(path, "/"))
+		if len(values) <= 0 {
+			out = append(out, &Mismatch{Path: path, Expected: expected, Missing: true})
+			continue
+		}
+		for _, got := range values {
+			if !reflect.DeepEqual(expected, got) {
+				out = append(out, &Mismatch{Path: path, Expected: expected, Got: got})
+				break
+			}
+		}
+	}
+	return out
+}
+
+// lookup returns all the values matching the given path.
+func lookup(value interface{}, path []string) []interface{} {
+	if len(path) <= 0 {
+		return []interface{}{value}
+	}
+	var children []interface{}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if path[0] == "*" {
+			for _, key := range sortedKeys(v) {
+				children = append(children, v[key])
+			}
+		} else if child, found := v[path[0]]; found {
+			children = append(children, child)
+		}
+	case []interface{}:
+		if path[0] == "*" {
+			children = v
+		}
+	}
+	var out []interface{}
+	for _, child := range children {
+		out = append(out, lookup(child, path[1:])...)
+	}
+	return out
+}
+
+// normalize converts a Go value to the value we would have
+// obtained by parsing its JSON serialization (e.g., an int
+// becomes a float64) so we can compare it with the test keys.
+func normalize(value interface{}) interface{} {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return value
+	}
+	return out
+}
+
+// sortedKeys returns the sorted keys of a map.
+func sortedKeys(m map[string]interface{}) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Select returns the cases whose name matches the given regexp.
+func Select(cases []*Case, pattern string) ([]*Case, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var out []*Case
+	for _, c := range cases {
+		if re.MatchString(c.Name) {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+// WriteReport writes a human readable report of the results on w and
+// returns whether all the cases passed.
+func WriteReport(w io.Writer, results []*Result) bool {
+	var passed int
+	for _, r := range results {
+		if r.Passed() {
+			passed++
+			fmt.Fprintf(w, "PASS %s (%s, %s)\n", r.Case.Name, r.Case.Technique, r.Case.Experiment)
+			continue
+		}
+		fmt.Fprintf(w, "FAIL %s (%s, %s)\n", r.Case.Name, r.Case.Technique, r.Case.Experiment)
+		if r.Err != nil {
+			fmt.Fprintf(w, "    error: %s\n", r.Err.Error())
+		}
+		for _, m := range r.Mismatches {
+			got := format(m.Got)
+			if m.Missing {
+				got = "nothing"
+			}
+			fmt.Fprintf(w, "    %s: expected %s, got %s\n", m.Path, format(m.Expected), got)
+		}
+	}
+	fmt.Fprintf(w, "%d/%d cases passed\n", passed, len(results))
+	return passed == len(results)
+}
+
+// format formats a value using JSON.
+func format(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%+v", value)
+	}
+	return string(data)
+}
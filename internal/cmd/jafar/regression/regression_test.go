@@ -0,0 +1,289 @@
+package regression
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/shlex"
+)
+
+func TestCases(t *testing.T) {
+	names := make(map[string]bool)
+	for _, c := range Cases {
+		if names[c.Name] {
+			t.Fatal("duplicate name", c.Name)
+		}
+		names[c.Name] = true
+		if c.Technique == "" || c.Experiment == "" || len(c.Expect) <= 0 {
+			t.Fatal("incomplete case", c.Name)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	testKeys := map[string]interface{}{
+		"blocking":        "dns",
+		"accessible":      false,
+		"body_length":     float64(1234),
+		"control_failure": nil,
+		"lookups": map[string]interface{}{
+			"dot://8.8.8.8:853": map[string]interface{}{"failure": "connection_reset"},
+			"dot://8.8.4.4:853": map[string]interface{}{"failure": "connection_reset"},
+		},
+		"requests": []interface{}{
+			map[string]interface{}{"failure": nil},
+			map[string]interface{}{"failure": "eof_error"},
+		},
+	}
+
+	t.Run("when everything matches", func(t *testing.T) {
+		expect := map[string]interface{}{
+			"blocking":          "dns",
+			"accessible":        false,
+			"body_length":       1234,
+			"control_failure":   nil,
+			"lookups/*/failure": "connection_reset",
+		}
+		if mismatches := Compare(expect, testKeys); len(mismatches) != 0 {
+			t.Fatal("unexpected mismatches", mismatches)
+		}
+	})
+
+	t.Run("with mismatches", func(t *testing.T) {
+		expect := map[string]interface{}{
+			"blocking":           false,
+			"nonexistent":        nil,
+			"requests/*/failure": nil,
+		}
+		expected := []*Mismatch{{
+			Path:     "blocking",
+			Expected: false,
+			Got:      "dns",
+		}, {
+			Path:    "nonexistent",
+			Missing: true,
+		}, {
+			Path:     "requests/*/failure",
+			Expected: nil,
+			Got:      "eof_error",
+		}}
+		if diff := cmp.Diff(expected, Compare(expect, testKeys)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("with wildcards not matching anything", func(t *testing.T) {
+		expect := map[string]interface{}{
+			"blocking/*": "dns",
+		}
+		mismatches := Compare(expect, testKeys)
+		if len(mismatches) != 1 || !mismatches[0].Missing {
+			t.Fatal("unexpected mismatches", mismatches)
+		}
+	})
+}
+
+func TestRunner(t *testing.T) {
+	c := &Case{
+		Name:       "dnscheck_example",
+		Technique:  "iptables-reset-keyword",
+		Experiment: "dnscheck",
+		Input:      "dot://dns.google",
+		Options:    []string{"DefaultAddrs=8.8.8.8"},
+		JafarArgs:  []string{"-iptables-reset-keyword", "dns.google"},
+		Expect: map[string]interface{}{
+			"bootstrap_failure": nil,
+		},
+	}
+
+	// newRunner returns a runner that writes data as the report.
+	newRunner := func(t *testing.T, data string, err error) (*Runner, *[]string) {
+		runner := NewRunner("./jafar", "./miniooni", t.TempDir())
+		var gotArgs []string
+		runner.run = func(name string, arg ...string) error {
+			gotArgs = append([]string{name}, arg...)
+			if data != "" {
+				reportFile := filepath.Join(runner.WorkDir, c.Name+".jsonl")
+				if err := os.WriteFile(reportFile, []byte(data), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			return err
+		}
+		return runner, &gotArgs
+	}
+
+	t.Run("with a passing case", func(t *testing.T) {
+		runner, gotArgs := newRunner(
+			t, `{"test_keys":{"bootstrap_failure":null}}`+"\n", errors.New("mocked error"))
+		result := runner.Run(c)
+		if !result.Passed() {
+			t.Fatal("the case did not pass", result.Err, result.Mismatches)
+		}
+		args := *gotArgs
+		if len(args) != 9 || args[0] != "./jafar" || args[1] != "-main-command" {
+			t.Fatal("unexpected args", args)
+		}
+		command, err := shlex.Split(args[2])
+		if err != nil {
+			t.Fatal(err)
+		}
+		reportFile := filepath.Join(runner.WorkDir, c.Name+".jsonl")
+		expected := []string{
+			"./miniooni", "--yes", "-n", "--home", runner.WorkDir, "-o", reportFile,
+			"-i", "dot://dns.google", "-O", "DefaultAddrs=8.8.8.8", "dnscheck",
+		}
+		if diff := cmp.Diff(expected, command); diff != "" {
+			t.Fatal(diff)
+		}
+		expected = []string{
+			"-main-user", "nobody", "-tag", c.Name, "-iptables-reset-keyword", "dns.google",
+		}
+		if diff := cmp.Diff(expected, args[3:]); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("with a failing case", func(t *testing.T) {
+		runner, _ := newRunner(t, `{"test_keys":{"bootstrap_failure":"eof_error"}}`, nil)
+		result := runner.Run(c)
+		if result.Passed() || result.Err != nil || len(result.Mismatches) != 1 {
+			t.Fatal("unexpected result", result.Err, result.Mismatches)
+		}
+	})
+
+	t.Run("without a report", func(t *testing.T) {
+		runner, _ := newRunner(t, "", errors.New("mocked error"))
+		result := runner.Run(c)
+		if !errors.Is(result.Err, os.ErrNotExist) {
+			t.Fatal("unexpected err", result.Err)
+		}
+		if !strings.HasSuffix(result.Err.Error(), "(jafar: mocked error)") {
+			t.Fatal("the error does not mention jafar", result.Err)
+		}
+	})
+
+	t.Run("with an empty report", func(t *testing.T) {
+		runner, _ := newRunner(t, "", nil)
+		runner.run = func(name string, arg ...string) error {
+			reportFile := filepath.Join(runner.WorkDir, c.Name+".jsonl")
+			return os.WriteFile(reportFile, nil, 0600)
+		}
+		result := runner.Run(c)
+		if !errors.Is(result.Err, ErrEmptyReport) {
+			t.Fatal("unexpected err", result.Err)
+		}
+	})
+
+	t.Run("with a report containing invalid JSON", func(t *testing.T) {
+		runner, _ := newRunner(t, "{\n", nil)
+		result := runner.Run(c)
+		if result.Err == nil || result.Err.Error() != "unexpected end of JSON input" {
+			t.Fatal("unexpected err", result.Err)
+		}
+	})
+
+	t.Run("with a stale report", func(t *testing.T) {
+		runner, _ := newRunner(t, "", nil)
+		reportFile := filepath.Join(runner.WorkDir, c.Name+".jsonl")
+		data := []byte(`{"test_keys":{"bootstrap_failure":null}}`)
+		if err := os.WriteFile(reportFile, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		result := runner.Run(c)
+		if !errors.Is(result.Err, os.ErrNotExist) {
+			t.Fatal("unexpected err", result.Err)
+		}
+	})
+}
+
+func TestRunnerCheckWorkDir(t *testing.T) {
+	t.Run("when the main user can write", func(t *testing.T) {
+		runner := NewRunner("./jafar", "./miniooni", "/tmp/jafarqa")
+		runner.MainUser = "alice"
+		var gotArgs []string
+		runner.run = func(name string, arg ...string) error {
+			gotArgs = append([]string{name}, arg...)
+			return nil
+		}
+		if err := runner.CheckWorkDir(); err != nil {
+			t.Fatal(err)
+		}
+		expected := []string{"sudo", "-u", "alice", "--", "test", "-w", "/tmp/jafarqa"}
+		if diff := cmp.Diff(expected, gotArgs); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("when the main user cannot write", func(t *testing.T) {
+		runner := NewRunner("./jafar", "./miniooni", "/tmp/jafarqa")
+		runner.run = func(name string, arg ...string) error {
+			return errors.New("mocked error")
+		}
+		if err := runner.CheckWorkDir(); !errors.Is(err, ErrWorkDirNotWritable) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+}
+
+func TestSelect(t *testing.T) {
+	cases, err := Select(Cases, "^telegram_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) <= 0 {
+		t.Fatal("expected some cases")
+	}
+	for _, c := range cases {
+		if c.Experiment != "telegram" {
+			t.Fatal("unexpected case", c.Name)
+		}
+	}
+	if _, err := Select(Cases, "("); err == nil {
+		t.Fatal("expected an error here")
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	c := &Case{Name: "example", Technique: "none", Experiment: "web_connectivity"}
+	results := []*Result{{
+		Case: c,
+	}, {
+		Case: c,
+		Err:  errors.New("mocked error"),
+	}, {
+		Case: c,
+		Mismatches: []*Mismatch{{
+			Path:     "blocking",
+			Expected: false,
+			Got:      "dns",
+		}, {
+			Path:     "accessible",
+			Expected: true,
+			Missing:  true,
+		}},
+	}}
+	w := &bytes.Buffer{}
+	if WriteReport(w, results) {
+		t.Fatal("expected failure")
+	}
+	expected := `PASS example (none, web_connectivity)
+FAIL example (none, web_connectivity)
+    error: mocked error
+FAIL example (none, web_connectivity)
+    blocking: expected false, got "dns"
+    accessible: expected true, got nothing
+1/3 cases passed
+`
+	if diff := cmp.Diff(expected, w.String()); diff != "" {
+		t.Fatal(diff)
+	}
+	if !WriteReport(&bytes.Buffer{}, results[:1]) {
+		t.Fatal("expected success")
+	}
+}
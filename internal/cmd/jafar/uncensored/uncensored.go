@@ -67,6 +67,31 @@ func (c *Client) LookupHTTPS(ctx context.Context, domain string) (*model.HTTPSSv
 	return nil, errors.New("not implemented")
 }
 
+// LookupSVCB implements model.Resolver.LookupSVCB.
+func (c *Client) LookupSVCB(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+	return nil, errors.New("not implemented")
+}
+
+// LookupCNAME implements model.Resolver.LookupCNAME.
+func (c *Client) LookupCNAME(ctx context.Context, domain string) ([]string, error) {
+	return c.dnsClient.LookupCNAME(ctx, domain)
+}
+
+// LookupNS implements model.Resolver.LookupNS.
+func (c *Client) LookupNS(ctx context.Context, domain string) ([]*net.NS, error) {
+	return c.dnsClient.LookupNS(ctx, domain)
+}
+
+// LookupMX implements model.Resolver.LookupMX.
+func (c *Client) LookupMX(ctx context.Context, domain string) ([]*net.MX, error) {
+	return c.dnsClient.LookupMX(ctx, domain)
+}
+
+// LookupTXT implements model.Resolver.LookupTXT.
+func (c *Client) LookupTXT(ctx context.Context, domain string) ([]string, error) {
+	return c.dnsClient.LookupTXT(ctx, domain)
+}
+
 // Network implements Resolver.Network
 func (c *Client) Network() string {
 	return c.dnsClient.Network()
@@ -0,0 +1,62 @@
+// Command jafarqa runs the jafar regression test cases and prints a
+// pass/fail report. It must run as root, since jafar does.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/cli"
+	"github.com/ooni/probe-cli/v3/internal/cmd/jafar/regression"
+	"github.com/ooni/probe-cli/v3/internal/runtimex"
+)
+
+var (
+	jafar    = flag.String("jafar", "./jafar", "Path of the jafar binary")
+	list     = flag.Bool("list", false, "List the test cases and exit")
+	mainUser = flag.String("main-user", "nobody", "User that runs miniooni")
+	miniooni = flag.String("miniooni", "./miniooni", "Path of the miniooni binary")
+	run      = flag.String("run", "", "Only run the test cases whose name matches this regexp")
+	verbose  = flag.Bool("verbose", false, "Print the jafar and miniooni logs")
+	workDir  = flag.String("work-dir", "", "Directory where to write the reports, which must be writable by -main-user (default: a temporary directory)")
+)
+
+func main() {
+	flag.Parse()
+	log.SetHandler(cli.Default)
+	log.SetLevel(log.WarnLevel)
+	if *verbose {
+		log.SetLevel(log.InfoLevel)
+	}
+	cases, err := regression.Select(regression.Cases, *run)
+	runtimex.PanicOnError(err, "regression.Select failed")
+	if *list {
+		for _, c := range cases {
+			fmt.Printf("%s (%s, %s)\n", c.Name, c.Technique, c.Experiment)
+		}
+		return
+	}
+	if *workDir == "" {
+		*workDir, err = os.MkdirTemp("", "jafarqa")
+		runtimex.PanicOnError(err, "os.MkdirTemp failed")
+		// the main user must be able to write the reports
+		err = os.Chmod(*workDir, 0777)
+		runtimex.PanicOnError(err, "os.Chmod failed")
+	}
+	runner := regression.NewRunner(*jafar, *miniooni, *workDir)
+	runner.MainUser = *mainUser
+	// we don't change the mode of a user-supplied work dir
+	err = runner.CheckWorkDir()
+	runtimex.PanicOnError(err, "runner.CheckWorkDir failed")
+	var results []*regression.Result
+	for _, c := range cases {
+		fmt.Printf("=== RUN %s\n", c.Name)
+		results = append(results, runner.Run(c))
+	}
+	if !regression.WriteReport(os.Stdout, results) {
+		fmt.Printf("the reports are in %s\n", *workDir)
+		os.Exit(1)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	crand "crypto/rand"
 	"errors"
 	"fmt"
 	"io"
@@ -22,6 +23,7 @@ import (
 	"github.com/ooni/probe-cli/v3/internal/model"
 	"github.com/ooni/probe-cli/v3/internal/netxlite"
 	"github.com/ooni/probe-cli/v3/internal/netxlite/filtering"
+	"github.com/ooni/probe-cli/v3/internal/netxlite/replay"
 	"github.com/ooni/probe-cli/v3/internal/runtimex"
 	"github.com/ooni/probe-cli/v3/internal/version"
 	"github.com/pborman/getopt/v2"
@@ -39,12 +41,18 @@ type Options struct {
 	MaxRuntime       int64
 	NoJSON           bool
 	NoCollector      bool
+	Pcapng           string
 	ProbeServicesURL string
 	Proxy            string
 	Random           bool
 	ReportFile       string
 	TorArgs          []string
 	TorBinary        string
+	TProxyRecord     string
+	TProxyReplay     string
+	TProxyScenario   string
+	TLSSplit         string
+	TLSSplitDelay    int64
 	Tunnel           string
 	Verbose          bool
 	Version          bool
@@ -99,6 +107,10 @@ func init() {
 	getopt.FlagLong(
 		&globalOptions.NoCollector, "no-collector", 'n', "Don't use a collector",
 	)
+	getopt.FlagLong(
+		&globalOptions.Pcapng, "pcapng", 0,
+		"Appends the packets synthesized from each measurement to a pcapng file", "FILE",
+	)
 	getopt.FlagLong(
 		&globalOptions.ProbeServicesURL, "probe-services", 0,
 		"Set the URL of the probe-services instance you want to use", "URL",
@@ -121,6 +133,27 @@ func init() {
 		&globalOptions.TorBinary, "tor-binary", 0,
 		"Specify path to a specific tor binary",
 	)
+	getopt.FlagLong(
+		&globalOptions.TProxyRecord, "tproxy-record", 0,
+		"Records the network operations to a trace file for replaying them with --tproxy-replay (the trace contains secrets allowing to decrypt the measurement traffic)", "FILE",
+	)
+	getopt.FlagLong(
+		&globalOptions.TProxyReplay, "tproxy-replay", 0,
+		"Replays the network operations recorded with --tproxy-record without using the network", "FILE",
+	)
+	getopt.FlagLong(
+		&globalOptions.TProxyScenario, "tproxy-scenario", 0,
+		fmt.Sprintf("Specifies a censorship scenario file or bundled profile (one of %s) to apply for QA purposes",
+			strings.Join(filtering.TProxyProfiles(), ", ")), "FILE|PROFILE",
+	)
+	getopt.FlagLong(
+		&globalOptions.TLSSplit, "tls-split", 0,
+		"Splits the TLS ClientHello sent by the session (one of: sni_segments, 8_4_rest, random_32_64, record_fragment)", "STRATEGY",
+	)
+	getopt.FlagLong(
+		&globalOptions.TLSSplitDelay, "tls-split-delay", 0,
+		"Milliseconds to wait between the segments of the ClientHello split using --tls-split", "N",
+	)
 	getopt.FlagLong(
 		&globalOptions.Tunnel, "tunnel", 0,
 		"Name of the tunnel to use (one of `tor`, `psiphon`)",
@@ -289,6 +322,31 @@ equivalent of setting --proxy=psiphon:///. This MAY change in a future version
 of miniooni, when we will allow a tunnel to use a proxy.
 `
 
+// censorAndScenario is the text printed when the user specifies
+// both the --censor and the --tproxy-scenario options
+const censorAndScenario = `USAGE ERROR: The --censor option and the --tproxy-scenario
+option cannot be specified at the same time. Both options configure the
+censorship rules to apply for QA purposes. Use --tproxy-scenario for scenario
+files and bundled profiles and --censor for plain filtering.TProxyConfig files.
+`
+
+// replayAndOtherTProxy is the text printed when the user specifies
+// --tproxy-replay along with options that also configure the tproxy
+const replayAndOtherTProxy = `USAGE ERROR: The --tproxy-replay option cannot be
+specified along with the --censor, --tproxy-scenario or --tproxy-record options.
+When replaying, we do not use the network, so there is nothing to censor or to
+record. If you recorded a run using --censor or --tproxy-scenario, the trace
+already contains the effects of the censorship rules.
+`
+
+// pcapngNotSupported is the text printed when the user specifies
+// --pcapng for an experiment that cannot write pcapng files
+const pcapngNotSupported = `USAGE ERROR: The --pcapng option requires an experiment
+with the PcapngFile option (e.g., urlgetter or web_connectivity). The other
+experiments do not save the bytes they read and write, hence we cannot
+synthesize their packets.
+`
+
 // MainWithConfiguration is the miniooni main with a specific configuration
 // represented by the experiment name and the current options.
 //
@@ -298,6 +356,11 @@ func MainWithConfiguration(experimentName string, currentOptions Options) {
 	fatalIfFalse(currentOptions.Limit == 0, limitRemoved)
 	fatalIfTrue(currentOptions.Proxy != "" && currentOptions.Tunnel != "",
 		tunnelAndProxy)
+	fatalIfTrue(currentOptions.Censor != "" && currentOptions.TProxyScenario != "",
+		censorAndScenario)
+	fatalIfTrue(currentOptions.TProxyReplay != "" && (currentOptions.Censor != "" ||
+		currentOptions.TProxyScenario != "" || currentOptions.TProxyRecord != ""),
+		replayAndOtherTProxy)
 	if currentOptions.Tunnel != "" {
 		currentOptions.Proxy = fmt.Sprintf("%s:///", currentOptions.Tunnel)
 	}
@@ -327,6 +390,47 @@ func MainWithConfiguration(experimentName string, currentOptions Options) {
 		currentOptions.NoCollector = true
 	}
 
+	if currentOptions.TProxyScenario != "" {
+		config, err := filtering.NewTProxyConfigFromScenario(currentOptions.TProxyScenario)
+		runtimex.PanicOnError(err, "cannot load --tproxy-scenario")
+		tproxy, err := filtering.NewTProxy(config, log.Log)
+		runtimex.PanicOnError(err, "cannot create tproxy instance")
+		defer tproxy.Close()
+		netxlite.TProxy = tproxy
+		log.Infof("miniooni: disabling submission with --tproxy-scenario to avoid pulluting OONI data")
+		currentOptions.NoCollector = true
+	}
+
+	// tlsRand is the entropy source for the measurement TLS and QUIC
+	// handshakes when recording or replaying, and nil otherwise.
+	var tlsRand io.Reader
+
+	if currentOptions.TProxyRecord != "" {
+		filep, err := os.Create(currentOptions.TProxyRecord)
+		runtimex.PanicOnError(err, "cannot create --tproxy-record file")
+		defer filep.Close()
+		recorder := replay.NewRecorder(netxlite.TProxy, filep)
+		defer func() {
+			warnOnError(recorder.Err(), "cannot write --tproxy-record file")
+		}()
+		netxlite.TProxy = recorder
+		tlsRand = recorder.Entropy(crand.Reader)
+		log.Infof("miniooni: recording network operations to %s", currentOptions.TProxyRecord)
+		log.Warnf("miniooni: the trace contains secrets allowing to decrypt the measurement traffic")
+		log.Infof("miniooni: disabling submission with --tproxy-record to avoid recording backend traffic")
+		currentOptions.NoCollector = true
+	}
+
+	if currentOptions.TProxyReplay != "" {
+		events, err := replay.ReadTraceFile(currentOptions.TProxyReplay)
+		runtimex.PanicOnError(err, "cannot read --tproxy-replay file")
+		replayer := replay.NewReplayer(events, log.Log)
+		netxlite.TProxy = replayer
+		tlsRand = replayer.Entropy(crand.Reader)
+		log.Infof("miniooni: disabling submission with --tproxy-replay to avoid pulluting OONI data")
+		currentOptions.NoCollector = true
+	}
+
 	//Mon Jan 2 15:04:05 -0700 MST 2006
 	log.Infof("Current time: %s", time.Now().Format("2006-01-02 15:04:05 MST"))
 
@@ -376,6 +480,12 @@ func MainWithConfiguration(experimentName string, currentOptions Options) {
 		TorBinary:       currentOptions.TorBinary,
 		TunnelDir:       tunnelDir,
 	}
+	if currentOptions.TLSSplit != "" {
+		config.TLSSplit = &netxlite.TLSSplitConfig{
+			Strategy: currentOptions.TLSSplit,
+			Delay:    time.Duration(currentOptions.TLSSplitDelay) * time.Millisecond,
+		}
+	}
 	if currentOptions.ProbeServicesURL != "" {
 		config.AvailableProbeServices = []model.OOAPIService{{
 			Address: currentOptions.ProbeServicesURL,
@@ -432,6 +542,14 @@ func MainWithConfiguration(experimentName string, currentOptions Options) {
 		})
 	}
 
+	if currentOptions.Pcapng != "" {
+		options, err := builder.Options()
+		fatalOnError(err, "cannot get the experiment options")
+		_, found := options["PcapngFile"]
+		fatalIfFalse(found, pcapngNotSupported)
+		extraOptions["PcapngFile"] = currentOptions.Pcapng
+	}
+
 	err = builder.SetOptionsGuessType(extraOptions)
 	fatalOnError(err, "cannot parse extraOptions")
 
@@ -461,8 +579,9 @@ func MainWithConfiguration(experimentName string, currentOptions Options) {
 	inputProcessor := &engine.InputProcessor{
 		Annotations: annotations,
 		Experiment: &experimentWrapper{
-			child: engine.NewInputProcessorExperimentWrapper(experiment),
-			total: len(inputs),
+			child:   engine.NewInputProcessorExperimentWrapper(experiment),
+			tlsRand: tlsRand,
+			total:   len(inputs),
 		},
 		Inputs:     inputs,
 		MaxRuntime: time.Duration(currentOptions.MaxRuntime) * time.Second,
@@ -477,8 +596,9 @@ func MainWithConfiguration(experimentName string, currentOptions Options) {
 }
 
 type experimentWrapper struct {
-	child engine.InputProcessorExperimentWrapper
-	total int
+	child   engine.InputProcessorExperimentWrapper
+	tlsRand io.Reader
+	total   int
 }
 
 func (ew *experimentWrapper) MeasureAsync(
@@ -486,6 +606,10 @@ func (ew *experimentWrapper) MeasureAsync(
 	if input != "" {
 		log.Infof("[%d/%d] running with input: %s", idx+1, ew.total, input)
 	}
+	if ew.tlsRand != nil {
+		// only the measurement handshakes use the recorded entropy
+		ctx = netxlite.ContextWithTLSRand(ctx, ew.tlsRand)
+	}
 	return ew.child.MeasureAsync(ctx, input, idx)
 }
 
@@ -56,6 +56,26 @@ func (c FakeResolver) LookupHTTPS(ctx context.Context, domain string) (*model.HT
 	return nil, errors.New("not implemented")
 }
 
+func (c FakeResolver) LookupSVCB(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c FakeResolver) LookupCNAME(ctx context.Context, domain string) ([]string, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c FakeResolver) LookupNS(ctx context.Context, domain string) ([]*net.NS, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c FakeResolver) LookupMX(ctx context.Context, domain string) ([]*net.MX, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c FakeResolver) LookupTXT(ctx context.Context, domain string) ([]string, error) {
+	return nil, errors.New("not implemented")
+}
+
 var _ model.Resolver = FakeResolver{}
 
 type FakeTransport struct {
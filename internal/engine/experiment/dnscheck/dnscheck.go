@@ -73,25 +73,37 @@ func (e *Endpoints) maybeRegister(resolverURL string) {
 
 // Config contains the experiment's configuration.
 type Config struct {
-	DefaultAddrs  string `json:"default_addrs" ooni:"default addresses for domain"`
-	Domain        string `json:"domain" ooni:"domain to resolve using the specified resolver"`
-	HTTP3Enabled  bool   `json:"http3_enabled" ooni:"use http3 instead of http/1.1 or http2"`
-	HTTPHost      string `json:"http_host" ooni:"force using specific HTTP Host header"`
-	TLSServerName string `json:"tls_server_name" ooni:"force TLS to using a specific SNI in Client Hello"`
-	TLSVersion    string `json:"tls_version" ooni:"Force specific TLS version (e.g. 'TLSv1.3')"`
+	DNSClientSubnet     string `json:"dns_client_subnet" ooni:"EDNS Client Subnet to send with DNS queries (e.g. '130.192.91.0/24')"`
+	DNSDuplicatesWindow int64  `json:"dns_duplicates_window" ooni:"milliseconds to wait for duplicate DNS-over-UDP responses (0 = disabled)"`
+	DNSPaddingBlockSize int64  `json:"dns_padding_block_size" ooni:"pad DNS queries to a multiple of this size (0 = transport default, -1 = never)"`
+	DNSSECOK            bool   `json:"dnssec_ok" ooni:"set the DNSSEC OK bit in DNS queries"`
+	DNSUDPPayloadSize   int64  `json:"dns_udp_payload_size" ooni:"EDNS0 UDP payload size for DNS queries (0 = default)"`
+	DefaultAddrs        string `json:"default_addrs" ooni:"default addresses for domain"`
+	Domain              string `json:"domain" ooni:"domain to resolve using the specified resolver"`
+	HTTP3Enabled        bool   `json:"http3_enabled" ooni:"use http3 instead of http/1.1 or http2"`
+	HTTPHost            string `json:"http_host" ooni:"force using specific HTTP Host header"`
+	TLSFingerprint      string `json:"tls_fingerprint" ooni:"parrot a TLS Client Hello (one of: chrome, firefox, ios, randomized, go)"`
+	TLSServerName       string `json:"tls_server_name" ooni:"force TLS to using a specific SNI in Client Hello"`
+	TLSVersion          string `json:"tls_version" ooni:"Force specific TLS version (e.g. 'TLSv1.3')"`
 }
 
 // TestKeys contains the results of the dnscheck experiment.
 type TestKeys struct {
-	DefaultAddrs     string                        `json:"x_default_addrs"`
-	Domain           string                        `json:"domain"`
-	HTTP3Enabled     bool                          `json:"x_http3_enabled,omitempty"`
-	HTTPHost         string                        `json:"x_http_host,omitempty"`
-	TLSServerName    string                        `json:"x_tls_server_name,omitempty"`
-	TLSVersion       string                        `json:"x_tls_version,omitempty"`
-	Bootstrap        *urlgetter.TestKeys           `json:"bootstrap"`
-	BootstrapFailure *string                       `json:"bootstrap_failure"`
-	Lookups          map[string]urlgetter.TestKeys `json:"lookups"`
+	DNSClientSubnet     string                        `json:"x_dns_client_subnet,omitempty"`
+	DNSDuplicatesWindow int64                         `json:"x_dns_duplicates_window,omitempty"`
+	DNSPaddingBlockSize int64                         `json:"x_dns_padding_block_size,omitempty"`
+	DNSSECOK            bool                          `json:"x_dnssec_ok,omitempty"`
+	DNSUDPPayloadSize   int64                         `json:"x_dns_udp_payload_size,omitempty"`
+	DefaultAddrs        string                        `json:"x_default_addrs"`
+	Domain              string                        `json:"domain"`
+	HTTP3Enabled        bool                          `json:"x_http3_enabled,omitempty"`
+	HTTPHost            string                        `json:"x_http_host,omitempty"`
+	TLSFingerprint      string                        `json:"x_tls_fingerprint,omitempty"`
+	TLSServerName       string                        `json:"x_tls_server_name,omitempty"`
+	TLSVersion          string                        `json:"x_tls_version,omitempty"`
+	Bootstrap           *urlgetter.TestKeys           `json:"bootstrap"`
+	BootstrapFailure    *string                       `json:"bootstrap_failure"`
+	Lookups             map[string]urlgetter.TestKeys `json:"lookups"`
 }
 
 // Measurer performs the measurement.
@@ -138,8 +150,14 @@ func (m *Measurer) Run(
 	}
 	tk.DefaultAddrs = m.Config.DefaultAddrs
 	tk.Domain = domain
+	tk.DNSClientSubnet = m.Config.DNSClientSubnet
+	tk.DNSDuplicatesWindow = m.Config.DNSDuplicatesWindow
+	tk.DNSPaddingBlockSize = m.Config.DNSPaddingBlockSize
+	tk.DNSSECOK = m.Config.DNSSECOK
+	tk.DNSUDPPayloadSize = m.Config.DNSUDPPayloadSize
 	tk.HTTP3Enabled = m.Config.HTTP3Enabled
 	tk.HTTPHost = m.Config.HTTPHost
+	tk.TLSFingerprint = m.Config.TLSFingerprint
 	tk.TLSServerName = m.Config.TLSServerName
 	tk.TLSVersion = m.Config.TLSVersion
 
@@ -153,7 +171,7 @@ func (m *Measurer) Run(
 		return fmt.Errorf("%w: %s", ErrInvalidURL, err.Error())
 	}
 	switch URL.Scheme {
-	case "https", "dot", "udp", "tcp":
+	case "https", "dot", "doq", "udp", "tcp":
 		// all good
 	default:
 		return ErrUnsupportedURLScheme
@@ -206,13 +224,19 @@ func (m *Measurer) Run(
 	for addr := range allAddrs {
 		inputs = append(inputs, urlgetter.MultiInput{
 			Config: urlgetter.Config{
-				DNSHTTPHost:      m.httpHost(URL.Host),
-				DNSTLSServerName: m.tlsServerName(URL.Hostname()),
-				DNSTLSVersion:    m.Config.TLSVersion,
-				HTTP3Enabled:     m.Config.HTTP3Enabled,
-				RejectDNSBogons:  true, // bogons are errors in this context
-				ResolverURL:      makeResolverURL(URL, addr),
-				Timeout:          45 * time.Second,
+				DNSClientSubnet:     m.Config.DNSClientSubnet,
+				DNSDuplicatesWindow: m.Config.DNSDuplicatesWindow,
+				DNSHTTPHost:         m.httpHost(URL.Host),
+				DNSPaddingBlockSize: m.Config.DNSPaddingBlockSize,
+				DNSSECOK:            m.Config.DNSSECOK,
+				DNSTLSServerName:    m.tlsServerName(URL.Hostname()),
+				DNSTLSVersion:       m.Config.TLSVersion,
+				DNSUDPPayloadSize:   m.Config.DNSUDPPayloadSize,
+				HTTP3Enabled:        m.Config.HTTP3Enabled,
+				RejectDNSBogons:     true, // bogons are errors in this context
+				TLSFingerprint:      m.Config.TLSFingerprint,
+				ResolverURL:         makeResolverURL(URL, addr),
+				Timeout:             45 * time.Second,
 			},
 			Target: fmt.Sprintf("dnslookup://%s", domain), // urlgetter wants a URL
 		})
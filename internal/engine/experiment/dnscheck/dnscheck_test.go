@@ -10,6 +10,9 @@ import (
 	"github.com/apex/log"
 	"github.com/ooni/probe-cli/v3/internal/engine/mockable"
 	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+	"github.com/ooni/probe-cli/v3/internal/netxlite/filtering"
+	"github.com/ooni/probe-cli/v3/internal/netxlite/vnet"
 )
 
 func TestHTTPHostWithOverride(t *testing.T) {
@@ -224,3 +227,83 @@ func TestDNSCheckWait(t *testing.T) {
 		t.Fatal("did not sleep")
 	}
 }
+
+func TestWithVirtualNetwork(t *testing.T) {
+	network, err := vnet.NewNetwork(&vnet.Config{
+		Hosts: []*vnet.Host{{
+			Addresses: []string{"8.8.8.8", "8.8.4.4"},
+			Domains:   []string{"dns.google"},
+			DNS:       true,
+		}, {
+			Addresses: []string{"93.184.216.34"},
+			Domains:   []string{"example.org"},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer network.Close()
+
+	run := func(t *testing.T, underlying model.UnderlyingNetworkLibrary, input string) *TestKeys {
+		netxlite.TProxy = underlying
+		defer func() {
+			netxlite.TProxy = &netxlite.TProxyStdlib{}
+		}()
+		measurer := NewExperimentMeasurer(Config{})
+		measurement := model.Measurement{Input: model.MeasurementTarget(input)}
+		err := measurer.Run(
+			context.Background(),
+			newsession(),
+			&measurement,
+			model.NewPrinterCallbacks(log.Log),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return measurement.TestKeys.(*TestKeys)
+	}
+
+	t.Run("uncensored", func(t *testing.T) {
+		for _, input := range []string{"udp://dns.google", "tcp://dns.google", "dot://dns.google", "https://dns.google/dns-query"} {
+			tk := run(t, network, input)
+			if tk.BootstrapFailure != nil {
+				t.Fatal("unexpected bootstrap failure", *tk.BootstrapFailure)
+			}
+			if len(tk.Lookups) != 2 {
+				t.Fatal("unexpected number of lookups", len(tk.Lookups))
+			}
+			for URL, lookup := range tk.Lookups {
+				if lookup.Failure != nil {
+					t.Fatal(URL, *lookup.Failure)
+				}
+			}
+		}
+	})
+
+	t.Run("censored", func(t *testing.T) {
+		proxy, err := filtering.NewTProxyWithUnderlyingNetwork(&filtering.TProxyConfig{
+			Endpoints: map[string]filtering.TProxyPolicy{
+				"8.8.8.8:853/tcp": filtering.TProxyPolicyTCPRejectSYN,
+			},
+		}, log.Log, network)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer proxy.Close()
+		tk := run(t, proxy, "dot://dns.google")
+		lookup, found := tk.Lookups["dot://8.8.8.8"]
+		if !found {
+			t.Fatal("missing lookup for 8.8.8.8")
+		}
+		if lookup.Failure == nil || *lookup.Failure != netxlite.FailureConnectionRefused {
+			t.Fatal("unexpected failure", lookup.Failure)
+		}
+		lookup, found = tk.Lookups["dot://8.8.4.4"]
+		if !found {
+			t.Fatal("missing lookup for 8.8.4.4")
+		}
+		if lookup.Failure != nil {
+			t.Fatal("unexpected failure", *lookup.Failure)
+		}
+	})
+}
@@ -2,6 +2,7 @@ package quicping
 
 import (
 	"context"
+	"crypto/x509"
 	"encoding/hex"
 	"errors"
 	"net"
@@ -75,6 +76,11 @@ func (f *FailStdLib) NewSimpleDialer(timeout time.Duration) model.SimpleDialer {
 	return nil
 }
 
+// DefaultCertPool implements UnderlyingNetworkLibrary.DefaultCertPool.
+func (f *FailStdLib) DefaultCertPool() *x509.CertPool {
+	return nil
+}
+
 func TestNewExperimentMeasurer(t *testing.T) {
 	measurer := NewExperimentMeasurer(Config{})
 	if measurer.ExperimentName() != "quicping" {
@@ -2,6 +2,7 @@ package signal_test
 
 import (
 	"context"
+	"net/http"
 	"testing"
 
 	"github.com/apex/log"
@@ -10,6 +11,8 @@ import (
 	"github.com/ooni/probe-cli/v3/internal/engine/mockable"
 	"github.com/ooni/probe-cli/v3/internal/model"
 	"github.com/ooni/probe-cli/v3/internal/netxlite"
+	"github.com/ooni/probe-cli/v3/internal/netxlite/filtering"
+	"github.com/ooni/probe-cli/v3/internal/netxlite/vnet"
 )
 
 func TestNewExperimentMeasurer(t *testing.T) {
@@ -127,3 +130,74 @@ func TestGetSummaryInvalidType(t *testing.T) {
 		t.Fatal("expected nil output here")
 	}
 }
+
+func TestWithVirtualNetwork(t *testing.T) {
+	network, err := vnet.NewNetwork(&vnet.Config{
+		Hosts: []*vnet.Host{{
+			Addresses: []string{"13.248.212.111"},
+			Domains: []string{
+				"textsecure-service.whispersystems.org", "storage.signal.org",
+				"api.directory.signal.org", "cdn.signal.org", "cdn2.signal.org",
+				"sfu.voip.signal.org", "uptime.signal.org",
+			},
+			Handler: http.NotFoundHandler(),
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer network.Close()
+
+	run := func(t *testing.T, underlying model.UnderlyingNetworkLibrary) *signal.TestKeys {
+		netxlite.TProxy = underlying
+		defer func() {
+			netxlite.TProxy = &netxlite.TProxyStdlib{}
+		}()
+		measurer := signal.NewExperimentMeasurer(signal.Config{})
+		measurement := new(model.Measurement)
+		err := measurer.Run(
+			context.Background(),
+			&mockable.Session{
+				MockableLogger: log.Log,
+			},
+			measurement,
+			model.NewPrinterCallbacks(log.Log),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return measurement.TestKeys.(*signal.TestKeys)
+	}
+
+	t.Run("uncensored", func(t *testing.T) {
+		tk := run(t, network)
+		if tk.SignalBackendFailure != nil {
+			t.Fatal("unexpected SignalBackendFailure", *tk.SignalBackendFailure)
+		}
+		if tk.SignalBackendStatus != "ok" {
+			t.Fatal("unexpected SignalBackendStatus", tk.SignalBackendStatus)
+		}
+	})
+
+	t.Run("censored", func(t *testing.T) {
+		proxy, err := filtering.NewTProxyWithUnderlyingNetwork(&filtering.TProxyConfig{
+			Endpoints: map[string]filtering.TProxyPolicy{
+				"13.248.212.111:443/tcp": filtering.TProxyPolicyHijackTLS,
+			},
+			SNIs: map[string]filtering.TLSAction{
+				"storage.signal.org": filtering.TLSActionReset,
+			},
+		}, log.Log, network)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer proxy.Close()
+		tk := run(t, proxy)
+		if tk.SignalBackendFailure == nil || *tk.SignalBackendFailure != netxlite.FailureConnectionReset {
+			t.Fatal("unexpected SignalBackendFailure", tk.SignalBackendFailure)
+		}
+		if tk.SignalBackendStatus != "blocked" {
+			t.Fatal("unexpected SignalBackendStatus", tk.SignalBackendStatus)
+		}
+	})
+}
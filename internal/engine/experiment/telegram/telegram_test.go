@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/http"
 	"testing"
 
 	"github.com/apex/log"
@@ -13,6 +14,8 @@ import (
 	"github.com/ooni/probe-cli/v3/internal/engine/mockable"
 	"github.com/ooni/probe-cli/v3/internal/model"
 	"github.com/ooni/probe-cli/v3/internal/netxlite"
+	"github.com/ooni/probe-cli/v3/internal/netxlite/filtering"
+	"github.com/ooni/probe-cli/v3/internal/netxlite/vnet"
 )
 
 func TestNewExperimentMeasurer(t *testing.T) {
@@ -414,3 +417,110 @@ func TestSummaryKeysWorksAsIntended(t *testing.T) {
 		})
 	}
 }
+
+// newVirtualTelegram returns the config of a virtual network
+// containing the Telegram access points and Telegram Web.
+func newVirtualTelegram() *vnet.Config {
+	dc := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotImplemented)
+	})
+	web := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><head><title>Telegram Web</title></head></html>`))
+	})
+	config := &vnet.Config{}
+	for _, addr := range []string{
+		"149.154.175.50", "149.154.167.51", "149.154.175.100",
+		"149.154.167.91", "149.154.171.5", "95.161.76.100",
+	} {
+		config.Hosts = append(config.Hosts, &vnet.Host{
+			Addresses:  []string{addr},
+			Handler:    dc,
+			HTTPPorts:  []int{80, 443},
+			HTTPSPorts: []int{},
+		})
+	}
+	config.Hosts = append(config.Hosts, &vnet.Host{
+		Addresses: []string{"149.154.167.99"},
+		Domains:   []string{"web.telegram.org"},
+		Handler:   web,
+	})
+	return config
+}
+
+func TestWithVirtualNetwork(t *testing.T) {
+	run := func(t *testing.T, underlying model.UnderlyingNetworkLibrary) *telegram.TestKeys {
+		netxlite.TProxy = underlying
+		defer func() {
+			netxlite.TProxy = &netxlite.TProxyStdlib{}
+		}()
+		measurer := telegram.NewExperimentMeasurer(telegram.Config{})
+		measurement := new(model.Measurement)
+		err := measurer.Run(
+			context.Background(),
+			&mockable.Session{
+				MockableLogger: log.Log,
+			},
+			measurement,
+			model.NewPrinterCallbacks(log.Log),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return measurement.TestKeys.(*telegram.TestKeys)
+	}
+
+	network, err := vnet.NewNetwork(newVirtualTelegram())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer network.Close()
+
+	t.Run("uncensored", func(t *testing.T) {
+		tk := run(t, network)
+		if tk.TelegramTCPBlocking {
+			t.Fatal("unexpected TelegramTCPBlocking")
+		}
+		if tk.TelegramHTTPBlocking {
+			t.Fatal("unexpected TelegramHTTPBlocking")
+		}
+		if tk.TelegramWebStatus != "ok" {
+			t.Fatal("unexpected TelegramWebStatus", tk.TelegramWebStatus)
+		}
+	})
+
+	t.Run("censored", func(t *testing.T) {
+		config := &filtering.TProxyConfig{
+			Endpoints: map[string]filtering.TProxyPolicy{
+				"*:80/tcp":               filtering.TProxyPolicyTCPRejectSYN,
+				"*:443/tcp":              filtering.TProxyPolicyTCPRejectSYN,
+				"149.154.167.99:443/tcp": filtering.TProxyPolicyHijackTLS,
+				"149.154.167.99:80/tcp":  filtering.TProxyPolicyHijackHTTP,
+			},
+			SNIs: map[string]filtering.TLSAction{
+				"web.telegram.org": filtering.TLSActionReset,
+			},
+			Hosts: map[string]filtering.HTTPAction{
+				"web.telegram.org": filtering.HTTPAction451,
+			},
+		}
+		config.CanonicalizeDNS()
+		proxy, err := filtering.NewTProxyWithUnderlyingNetwork(config, log.Log, network)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer proxy.Close()
+		tk := run(t, proxy)
+		if !tk.TelegramTCPBlocking {
+			t.Fatal("expected TelegramTCPBlocking")
+		}
+		if !tk.TelegramHTTPBlocking {
+			t.Fatal("expected TelegramHTTPBlocking")
+		}
+		if tk.TelegramWebStatus != "blocked" {
+			t.Fatal("unexpected TelegramWebStatus", tk.TelegramWebStatus)
+		}
+		if tk.TelegramWebFailure == nil || *tk.TelegramWebFailure != netxlite.FailureConnectionReset {
+			t.Fatal("unexpected TelegramWebFailure", tk.TelegramWebFailure)
+		}
+	})
+}
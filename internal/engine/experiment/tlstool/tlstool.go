@@ -12,24 +12,23 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
-	"net"
 	"time"
 
-	"github.com/ooni/probe-cli/v3/internal/engine/experiment/tlstool/internal"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/archival"
 	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
 	"github.com/ooni/probe-cli/v3/internal/runtimex"
 )
 
 const (
 	testName    = "tlstool"
-	testVersion = "0.1.0"
+	testVersion = "0.2.0"
 )
 
 // Config contains the experiment configuration.
 type Config struct {
-	Delay int64  `ooni:"Milliseconds to wait between writes"`
+	Delay int64  `ooni:"Milliseconds to wait between ClientHello segments"`
 	SNI   string `ooni:"Force using the specified SNI"`
 }
 
@@ -59,22 +58,21 @@ func (m Measurer) ExperimentVersion() string {
 }
 
 type method struct {
-	name      string
-	newDialer func(internal.DialerConfig) internal.Dialer
+	name     string
+	strategy string // empty means we do not split the ClientHello
 }
 
 var allMethods = []method{{
-	name:      "vanilla",
-	newDialer: internal.NewVanillaDialer,
+	name: "vanilla",
 }, {
-	name:      "snisplit",
-	newDialer: internal.NewSNISplitterDialer,
+	name:     "snisplit",
+	strategy: netxlite.TLSSplitSNISegments,
 }, {
-	name:      "random",
-	newDialer: internal.NewRandomSplitterDialer,
+	name:     "random",
+	strategy: netxlite.TLSSplitRandom32To64,
 }, {
-	name:      "thrice",
-	newDialer: internal.NewThriceSplitterDialer,
+	name:     "thrice",
+	strategy: netxlite.TLSSplit84Rest,
 }}
 
 // Run implements ExperimentMeasurer.Run.
@@ -94,9 +92,9 @@ func (m Measurer) Run(
 		// TODO(bassosimone): here we actually want to use urlgetter
 		// if possible and collect standard test keys.
 		err := m.run(ctx, runConfig{
-			address:   address,
-			logger:    sess.Logger(),
-			newDialer: meth.newDialer,
+			address:  address,
+			logger:   sess.Logger(),
+			strategy: meth.strategy,
 		})
 		percent := float64(idx) / float64(len(allMethods))
 		callbacks.OnProgress(percent, fmt.Sprintf("%s: %+v", meth.name, err))
@@ -117,21 +115,17 @@ func (m Measurer) newDialer(logger model.Logger) model.Dialer {
 }
 
 type runConfig struct {
-	address   string
-	logger    model.Logger
-	newDialer func(internal.DialerConfig) internal.Dialer
+	address  string
+	logger   model.Logger
+	strategy string
 }
 
 func (m Measurer) run(ctx context.Context, config runConfig) error {
-	dialer := config.newDialer(internal.DialerConfig{
-		Dialer: m.newDialer(config.logger),
-		Delay:  time.Duration(m.config.Delay) * time.Millisecond,
-		SNI:    m.pattern(config.address),
-	})
 	tdialer := netx.NewTLSDialer(netx.Config{
-		Dialer:    dialer,
+		Dialer:    m.newDialer(config.logger),
 		Logger:    config.logger,
 		TLSConfig: m.tlsConfig(),
+		TLSSplit:  m.tlsSplitConfig(config.strategy),
 	})
 	conn, err := tdialer.DialTLSContext(ctx, "tcp", config.address)
 	if err != nil {
@@ -148,14 +142,18 @@ func (m Measurer) tlsConfig() *tls.Config {
 	return nil
 }
 
-func (m Measurer) pattern(address string) string {
-	if m.config.SNI != "" {
-		return m.config.SNI
+// tlsSplitConfig returns the config for splitting the ClientHello
+// using the given strategy or nil if the strategy is empty. We split
+// using the SNI in the ClientHello, i.e., either the configured SNI
+// or the hostname inside the input address.
+func (m Measurer) tlsSplitConfig(strategy string) *netxlite.TLSSplitConfig {
+	if strategy == "" {
+		return nil
+	}
+	return &netxlite.TLSSplitConfig{
+		Strategy: strategy,
+		Delay:    time.Duration(m.config.Delay) * time.Millisecond,
 	}
-	addr, _, err := net.SplitHostPort(address)
-	// TODO(bassosimone): replace this panic with proper error checking.
-	runtimex.PanicOnError(err, "cannot split address")
-	return addr
 }
 
 // NewExperimentMeasurer creates a new ExperimentMeasurer.
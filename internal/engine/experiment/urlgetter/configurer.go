@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/ooni/probe-cli/v3/internal/engine/netx"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/trace"
@@ -36,6 +37,13 @@ func (c Configuration) CloseIdleConnections() {
 
 // NewConfiguration builds a new measurement configuration.
 func (c Configurer) NewConfiguration() (Configuration, error) {
+	queryOptions, err := c.newDNSQueryOptions()
+	if err != nil {
+		return Configuration{}, err
+	}
+	if _, err := netxlite.NewConnForTLSFingerprint(c.Config.TLSFingerprint); err != nil {
+		return Configuration{}, err
+	}
 	// set up defaults
 	configuration := Configuration{
 		HTTPConfig: netx.Config{
@@ -43,12 +51,15 @@ func (c Configurer) NewConfiguration() (Configuration, error) {
 			CacheResolutions:    true,
 			CertPool:            c.Config.CertPool,
 			ContextByteCounting: true,
+			DNSDuplicatesWindow: time.Duration(c.Config.DNSDuplicatesWindow) * time.Millisecond,
+			DNSQueryOptions:     queryOptions,
 			DialSaver:           c.Saver,
 			HTTP3Enabled:        c.Config.HTTP3Enabled,
 			HTTPSaver:           c.Saver,
 			Logger:              c.Logger,
 			ReadWriteSaver:      c.Saver,
 			ResolveSaver:        c.Saver,
+			TLSFingerprint:      c.Config.TLSFingerprint,
 			TLSSaver:            c.Saver,
 		},
 	}
@@ -97,7 +108,43 @@ func (c Configurer) NewConfiguration() (Configuration, error) {
 		return configuration, err
 	}
 	configuration.HTTPConfig.NoTLSVerify = c.Config.NoTLSVerify
+	if c.Config.TLSSplit != "" {
+		split := &netxlite.TLSSplitConfig{
+			Strategy: c.Config.TLSSplit,
+			Delay:    time.Duration(c.Config.TLSSplitDelay) * time.Millisecond,
+		}
+		if err := split.Validate(); err != nil {
+			return configuration, err
+		}
+		configuration.HTTPConfig.TLSSplit = split
+	}
 	// configure proxy
 	configuration.HTTPConfig.ProxyURL = c.ProxyURL
 	return configuration, nil
 }
+
+// newDNSQueryOptions returns the EDNS0 options selected by the user
+// or nil, if the user did not select any EDNS0 option.
+func (c Configurer) newDNSQueryOptions() (*model.DNSQueryOptions, error) {
+	if !c.Config.DNSSECOK && c.Config.DNSClientSubnet == "" &&
+		c.Config.DNSUDPPayloadSize == 0 && c.Config.DNSPaddingBlockSize == 0 {
+		return nil, nil
+	}
+	if c.Config.DNSClientSubnet != "" {
+		if _, _, err := net.ParseCIDR(c.Config.DNSClientSubnet); err != nil {
+			return nil, errors.New("invalid DNSClientSubnet")
+		}
+	}
+	if c.Config.DNSUDPPayloadSize < 0 || c.Config.DNSUDPPayloadSize > 65535 {
+		return nil, errors.New("invalid DNSUDPPayloadSize")
+	}
+	if c.Config.DNSPaddingBlockSize > 65535 {
+		return nil, errors.New("invalid DNSPaddingBlockSize")
+	}
+	return &model.DNSQueryOptions{
+		DNSSECOK:         c.Config.DNSSECOK,
+		ClientSubnet:     c.Config.DNSClientSubnet,
+		UDPPayloadSize:   uint16(c.Config.DNSUDPPayloadSize),
+		PaddingBlockSize: int(c.Config.DNSPaddingBlockSize),
+	}, nil
+}
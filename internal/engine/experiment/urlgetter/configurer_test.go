@@ -6,11 +6,14 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/apex/log"
+	"github.com/google/go-cmp/cmp"
 	"github.com/ooni/probe-cli/v3/internal/engine/experiment/urlgetter"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/resolver"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/trace"
+	"github.com/ooni/probe-cli/v3/internal/model"
 	"github.com/ooni/probe-cli/v3/internal/netxlite"
 )
 
@@ -116,7 +119,7 @@ func TestConfigurerNewConfigurationResolverDNSOverHTTPSPowerdns(t *testing.T) {
 	if configuration.HTTPConfig.BaseResolver == nil {
 		t.Fatal("not the BaseResolver we expected")
 	}
-	sr, ok := configuration.HTTPConfig.BaseResolver.(*netxlite.SerialResolver)
+	sr, ok := configuration.HTTPConfig.BaseResolver.(*netxlite.ParallelResolver)
 	if !ok {
 		t.Fatal("not the resolver we expected")
 	}
@@ -192,7 +195,7 @@ func TestConfigurerNewConfigurationResolverDNSOverHTTPSGoogle(t *testing.T) {
 	if configuration.HTTPConfig.BaseResolver == nil {
 		t.Fatal("not the BaseResolver we expected")
 	}
-	sr, ok := configuration.HTTPConfig.BaseResolver.(*netxlite.SerialResolver)
+	sr, ok := configuration.HTTPConfig.BaseResolver.(*netxlite.ParallelResolver)
 	if !ok {
 		t.Fatal("not the resolver we expected")
 	}
@@ -268,7 +271,7 @@ func TestConfigurerNewConfigurationResolverDNSOverHTTPSCloudflare(t *testing.T)
 	if configuration.HTTPConfig.BaseResolver == nil {
 		t.Fatal("not the BaseResolver we expected")
 	}
-	sr, ok := configuration.HTTPConfig.BaseResolver.(*netxlite.SerialResolver)
+	sr, ok := configuration.HTTPConfig.BaseResolver.(*netxlite.ParallelResolver)
 	if !ok {
 		t.Fatal("not the resolver we expected")
 	}
@@ -344,7 +347,7 @@ func TestConfigurerNewConfigurationResolverUDP(t *testing.T) {
 	if configuration.HTTPConfig.BaseResolver == nil {
 		t.Fatal("not the BaseResolver we expected")
 	}
-	sr, ok := configuration.HTTPConfig.BaseResolver.(*netxlite.SerialResolver)
+	sr, ok := configuration.HTTPConfig.BaseResolver.(*netxlite.ParallelResolver)
 	if !ok {
 		t.Fatal("not the resolver we expected")
 	}
@@ -376,6 +379,75 @@ func TestConfigurerNewConfigurationResolverUDP(t *testing.T) {
 	}
 }
 
+func TestConfigurerNewConfigurationResolverUDPWithDuplicates(t *testing.T) {
+	saver := new(trace.Saver)
+	configurer := urlgetter.Configurer{
+		Config: urlgetter.Config{
+			DNSDuplicatesWindow: 500,
+			ResolverURL:         "udp://8.8.8.8:53",
+		},
+		Logger: log.Log,
+		Saver:  saver,
+	}
+	configuration, err := configurer.NewConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer configuration.CloseIdleConnections()
+	if configuration.HTTPConfig.DNSDuplicatesWindow != 500*time.Millisecond {
+		t.Fatal("not the DNSDuplicatesWindow we expected")
+	}
+	sr, ok := configuration.HTTPConfig.BaseResolver.(*netxlite.ParallelResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	stxp, ok := sr.Txp.(resolver.SaverDNSTransportWithDuplicates)
+	if !ok {
+		t.Fatal("not the DNS transport we expected")
+	}
+	udptxp, ok := stxp.DNSTransportWithDuplicates.(*netxlite.DNSOverUDP)
+	if !ok {
+		t.Fatal("not the DNS transport we expected")
+	}
+	if udptxp.Address() != "8.8.8.8:53" {
+		t.Fatal("not the UDP address we expected")
+	}
+}
+
+func TestConfigurerNewConfigurationResolverDoQ(t *testing.T) {
+	saver := new(trace.Saver)
+	configurer := urlgetter.Configurer{
+		Config: urlgetter.Config{
+			ResolverURL: "doq://94.140.14.14:853",
+		},
+		Logger: log.Log,
+		Saver:  saver,
+	}
+	configuration, err := configurer.NewConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer configuration.CloseIdleConnections()
+	sr, ok := configuration.HTTPConfig.BaseResolver.(*netxlite.ParallelResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	stxp, ok := sr.Txp.(resolver.SaverDNSTransport)
+	if !ok {
+		t.Fatal("not the DNS transport we expected")
+	}
+	doqtxp, ok := stxp.DNSTransport.(*netxlite.DNSOverQUIC)
+	if !ok {
+		t.Fatal("not the DNS transport we expected")
+	}
+	if doqtxp.Address() != "94.140.14.14:853" {
+		t.Fatal("not the DoQ address we expected")
+	}
+	if doqtxp.Network() != "doq" {
+		t.Fatal("not the DoQ network we expected")
+	}
+}
+
 func TestConfigurerNewConfigurationDNSCacheInvalidString(t *testing.T) {
 	saver := new(trace.Saver)
 	configurer := urlgetter.Configurer{
@@ -732,3 +804,142 @@ func TestConfigurerNewConfigurationProxyURL(t *testing.T) {
 		t.Fatal("invalid ProxyURL")
 	}
 }
+
+func TestConfigurerNewConfigurationDNSQueryOptions(t *testing.T) {
+	saver := new(trace.Saver)
+	configurer := urlgetter.Configurer{
+		Config: urlgetter.Config{
+			DNSClientSubnet:     "130.192.91.0/24",
+			DNSPaddingBlockSize: -1,
+			DNSSECOK:            true,
+			DNSUDPPayloadSize:   1232,
+		},
+		Logger: log.Log,
+		Saver:  saver,
+	}
+	configuration, err := configurer.NewConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := &model.DNSQueryOptions{
+		DNSSECOK:         true,
+		ClientSubnet:     "130.192.91.0/24",
+		UDPPayloadSize:   1232,
+		PaddingBlockSize: -1,
+	}
+	if diff := cmp.Diff(expect, configuration.HTTPConfig.DNSQueryOptions); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestConfigurerNewConfigurationDNSQueryOptionsDefault(t *testing.T) {
+	saver := new(trace.Saver)
+	configurer := urlgetter.Configurer{
+		Logger: log.Log,
+		Saver:  saver,
+	}
+	configuration, err := configurer.NewConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configuration.HTTPConfig.DNSQueryOptions != nil {
+		t.Fatal("expected nil DNSQueryOptions")
+	}
+}
+
+func TestConfigurerNewConfigurationDNSQueryOptionsInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		config urlgetter.Config
+		expect string
+	}{{
+		name:   "with invalid client subnet",
+		config: urlgetter.Config{DNSClientSubnet: "130.192.91.0"},
+		expect: "invalid DNSClientSubnet",
+	}, {
+		name:   "with invalid UDP payload size",
+		config: urlgetter.Config{DNSUDPPayloadSize: 65536},
+		expect: "invalid DNSUDPPayloadSize",
+	}, {
+		name:   "with invalid padding block size",
+		config: urlgetter.Config{DNSPaddingBlockSize: 65536},
+		expect: "invalid DNSPaddingBlockSize",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configurer := urlgetter.Configurer{
+				Config: tt.config,
+				Logger: log.Log,
+				Saver:  new(trace.Saver),
+			}
+			_, err := configurer.NewConfiguration()
+			if err == nil || err.Error() != tt.expect {
+				t.Fatalf("not the error we expected: %+v", err)
+			}
+		})
+	}
+}
+
+func TestConfigurerNewConfigurationTLSSplit(t *testing.T) {
+	saver := new(trace.Saver)
+	configurer := urlgetter.Configurer{
+		Config: urlgetter.Config{
+			TLSSplit:      netxlite.TLSSplitRecordFragment,
+			TLSSplitDelay: 10,
+		},
+		Logger: log.Log,
+		Saver:  saver,
+	}
+	configuration, err := configurer.NewConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &netxlite.TLSSplitConfig{
+		Strategy: netxlite.TLSSplitRecordFragment,
+		Delay:    10 * time.Millisecond,
+	}
+	if diff := cmp.Diff(expected, configuration.HTTPConfig.TLSSplit); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestConfigurerNewConfigurationTLSSplitInvalid(t *testing.T) {
+	configurer := urlgetter.Configurer{
+		Config: urlgetter.Config{TLSSplit: "antani"},
+		Logger: log.Log,
+		Saver:  new(trace.Saver),
+	}
+	_, err := configurer.NewConfiguration()
+	if !errors.Is(err, netxlite.ErrUnknownTLSSplitStrategy) {
+		t.Fatal("not the error we expected", err)
+	}
+}
+
+func TestConfigurerNewConfigurationTLSFingerprint(t *testing.T) {
+	t.Run("with a valid fingerprint", func(t *testing.T) {
+		configurer := urlgetter.Configurer{
+			Config: urlgetter.Config{TLSFingerprint: netxlite.TLSFingerprintChrome},
+			Logger: log.Log,
+			Saver:  new(trace.Saver),
+		}
+		configuration, err := configurer.NewConfiguration()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if configuration.HTTPConfig.TLSFingerprint != netxlite.TLSFingerprintChrome {
+			t.Fatal("not the TLSFingerprint we expected")
+		}
+	})
+
+	t.Run("with an invalid fingerprint", func(t *testing.T) {
+		configurer := urlgetter.Configurer{
+			Config: urlgetter.Config{TLSFingerprint: "antani"},
+			Logger: log.Log,
+			Saver:  new(trace.Saver),
+		}
+		_, err := configurer.NewConfiguration()
+		if !errors.Is(err, netxlite.ErrUnknownTLSFingerprint) {
+			t.Fatal("not the error we expected", err)
+		}
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/archival"
+	"github.com/ooni/probe-cli/v3/internal/engine/netx/pcapng"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/trace"
 	"github.com/ooni/probe-cli/v3/internal/model"
 	"github.com/ooni/probe-cli/v3/internal/netxlite"
@@ -60,7 +61,14 @@ func (g Getter) Get(ctx context.Context) (TestKeys, error) {
 	tk.FailedOperation = archival.NewFailedOperation(err)
 	tk.Failure = archival.NewFailure(err)
 	events := saver.Read()
+	if g.Config.PcapngFile != "" {
+		if err := pcapng.AppendFile(g.Config.PcapngFile, events); err != nil {
+			g.Session.Logger().Warnf("urlgetter: cannot write pcapng file: %s", err.Error())
+		}
+	}
 	tk.Queries = append(tk.Queries, archival.NewDNSQueriesList(g.Begin, events)...)
+	tk.DNSResponses = append(
+		tk.DNSResponses, archival.NewDNSResponsesList(g.Begin, events)...)
 	tk.NetworkEvents = append(
 		tk.NetworkEvents, archival.NewNetworkEventsList(g.Begin, events)...,
 	)
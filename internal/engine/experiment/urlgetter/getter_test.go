@@ -1,9 +1,13 @@
 package urlgetter
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/apex/log"
@@ -71,3 +75,37 @@ func TestGetterHTTPSWithTunnelCannotCreateTempDir(t *testing.T) {
 		t.Fatal("not the HTTPResponseBody we expected")
 	}
 }
+
+func TestGetterWithPcapngFile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Bonsoir, Elliot!"))
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "capture.pcapng")
+	g := Getter{
+		Config: Config{
+			PcapngFile: path,
+		},
+		Session: &mockable.Session{
+			MockableLogger: log.Log,
+		},
+		Target: server.URL,
+	}
+	tk, err := g.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tk.HTTPResponseBody != "Bonsoir, Elliot!" {
+		t.Fatal("not the HTTPResponseBody we expected")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte{0x0A, 0x0D, 0x0D, 0x0A}) {
+		t.Fatal("expected a pcapng section header block")
+	}
+	if !bytes.Contains(data, []byte("Bonsoir, Elliot!")) {
+		t.Fatal("expected the response body inside the capture")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
+	"strings"
 
 	"github.com/ooni/probe-cli/v3/internal/engine/httpheader"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx"
@@ -17,6 +18,10 @@ import (
 
 const httpRequestFailed = "http_request_failed"
 
+// ErrUnsupportedDNSQueryType indicates that Config.DNSQueryTypes
+// contains a query type that we do not support.
+var ErrUnsupportedDNSQueryType = errors.New("urlgetter: unsupported DNS query type")
+
 // ErrHTTPRequestFailed indicates that the HTTP request failed.
 var ErrHTTPRequestFailed = &netxlite.ErrWrapper{
 	Failure:    httpRequestFailed,
@@ -104,11 +109,46 @@ func (r Runner) httpGet(ctx context.Context, url string) error {
 }
 
 func (r Runner) dnsLookup(ctx context.Context, hostname string) error {
+	qtypes, err := r.dnsQueryTypes()
+	if err != nil {
+		return err
+	}
 	resolver := netx.NewResolver(r.HTTPConfig)
-	_, err := resolver.LookupHost(ctx, hostname)
+	_, err = resolver.LookupHost(ctx, hostname)
+	// Implementation note: the extra lookups are saved into the
+	// queries by the resolver. We do not want them to change the
+	// overall result, which still depends on LookupHost.
+	for _, qtype := range qtypes {
+		switch qtype {
+		case "CNAME":
+			resolver.LookupCNAME(ctx, hostname)
+		case "NS":
+			resolver.LookupNS(ctx, hostname)
+		case "MX":
+			resolver.LookupMX(ctx, hostname)
+		case "TXT":
+			resolver.LookupTXT(ctx, hostname)
+		}
+	}
 	return err
 }
 
+// dnsQueryTypes parses Config.DNSQueryTypes.
+func (r Runner) dnsQueryTypes() (out []string, err error) {
+	for _, entry := range strings.Split(r.Config.DNSQueryTypes, ",") {
+		qtype := strings.ToUpper(strings.TrimSpace(entry))
+		switch qtype {
+		case "":
+			continue
+		case "CNAME", "NS", "MX", "TXT":
+			out = append(out, qtype)
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedDNSQueryType, entry)
+		}
+	}
+	return
+}
+
 func (r Runner) tlsHandshake(ctx context.Context, address string) error {
 	tlsDialer := netx.NewTLSDialer(r.HTTPConfig)
 	conn, err := tlsDialer.DialTLSContext(ctx, "tcp", address)
@@ -3,14 +3,22 @@ package urlgetter_test
 import (
 	"context"
 	"errors"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/ooni/probe-cli/v3/internal/atomicx"
 	"github.com/ooni/probe-cli/v3/internal/engine/experiment/urlgetter"
 	"github.com/ooni/probe-cli/v3/internal/engine/httpheader"
+	"github.com/ooni/probe-cli/v3/internal/engine/netx"
+	"github.com/ooni/probe-cli/v3/internal/engine/netx/archival"
+	"github.com/ooni/probe-cli/v3/internal/engine/netx/trace"
+	"github.com/ooni/probe-cli/v3/internal/model/mocks"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
 )
 
 func TestRunnerWithInvalidURLScheme(t *testing.T) {
@@ -110,6 +118,71 @@ func TestRunnerDNSLookupSuccess(t *testing.T) {
 	}
 }
 
+func TestRunnerDNSLookupWithUnsupportedQueryType(t *testing.T) {
+	r := urlgetter.Runner{
+		Config: urlgetter.Config{DNSQueryTypes: "CNAME,SOA"},
+		Target: "dnslookup://www.example.com",
+	}
+	err := r.Run(context.Background())
+	if !errors.Is(err, urlgetter.ErrUnsupportedDNSQueryType) {
+		t.Fatal("not the error we expected", err)
+	}
+}
+
+func TestRunnerDNSLookupWithExtraQueryTypes(t *testing.T) {
+	saver := &trace.Saver{}
+	var calls []string
+	reso := &mocks.Resolver{
+		MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+			calls = append(calls, "A")
+			return []string{"93.184.216.34"}, nil
+		},
+		MockLookupCNAME: func(ctx context.Context, domain string) ([]string, error) {
+			calls = append(calls, "CNAME")
+			return nil, netxlite.ErrOODNSNoAnswer
+		},
+		MockLookupNS: func(ctx context.Context, domain string) ([]*net.NS, error) {
+			calls = append(calls, "NS")
+			return []*net.NS{{Host: "a.iana-servers.net."}}, nil
+		},
+		MockLookupMX: func(ctx context.Context, domain string) ([]*net.MX, error) {
+			calls = append(calls, "MX")
+			return []*net.MX{{Host: ".", Pref: 0}}, nil
+		},
+		MockLookupTXT: func(ctx context.Context, domain string) ([]string, error) {
+			calls = append(calls, "TXT")
+			return []string{"v=spf1 -all"}, nil
+		},
+		MockNetwork: func() string {
+			return "udp"
+		},
+		MockAddress: func() string {
+			return "8.8.8.8:53"
+		},
+	}
+	r := urlgetter.Runner{
+		Config: urlgetter.Config{DNSQueryTypes: "cname, ns,MX,TXT"},
+		HTTPConfig: netx.Config{
+			BaseResolver: reso,
+			ResolveSaver: saver,
+		},
+		Target: "dnslookup://example.com",
+	}
+	if err := r.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"A", "CNAME", "NS", "MX", "TXT"}, calls); diff != "" {
+		t.Fatal(diff)
+	}
+	var qtypes []string
+	for _, entry := range archival.NewDNSQueriesList(time.Now(), saver.Read()) {
+		qtypes = append(qtypes, entry.QueryType)
+	}
+	if diff := cmp.Diff([]string{"A", "CNAME", "NS", "MX", "TXT"}, qtypes); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
 func TestRunnerHTTPSSuccess(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skip test in short mode")
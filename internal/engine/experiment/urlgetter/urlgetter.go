@@ -24,39 +24,50 @@ type Config struct {
 	Timeout  time.Duration
 
 	// settable from command line
-	DNSCache          string `ooni:"Add 'DOMAIN IP...' to cache"`
-	DNSHTTPHost       string `ooni:"Force using specific HTTP Host header for DNS requests"`
-	DNSTLSServerName  string `ooni:"Force TLS to using a specific SNI for encrypted DNS requests"`
-	DNSTLSVersion     string `ooni:"Force specific TLS version used for DoT/DoH (e.g. 'TLSv1.3')"`
-	FailOnHTTPError   bool   `ooni:"Fail HTTP request if status code is 400 or above"`
-	HTTP3Enabled      bool   `ooni:"use http3 instead of http/1.1 or http2"`
-	HTTPHost          string `ooni:"Force using specific HTTP Host header"`
-	Method            string `ooni:"Force HTTP method different than GET"`
-	NoFollowRedirects bool   `ooni:"Disable following redirects"`
-	NoTLSVerify       bool   `ooni:"Disable TLS verification"`
-	RejectDNSBogons   bool   `ooni:"Fail DNS lookup if response contains bogons"`
-	ResolverURL       string `ooni:"URL describing the resolver to use"`
-	TLSServerName     string `ooni:"Force TLS to using a specific SNI in Client Hello"`
-	TLSVersion        string `ooni:"Force specific TLS version (e.g. 'TLSv1.3')"`
-	Tunnel            string `ooni:"Run experiment over a tunnel, e.g. psiphon"`
-	UserAgent         string `ooni:"Use the specified User-Agent"`
+	DNSCache            string `ooni:"Add 'DOMAIN IP...' to cache"`
+	DNSClientSubnet     string `ooni:"EDNS Client Subnet to send with DNS queries (e.g. '130.192.91.0/24')"`
+	DNSDuplicatesWindow int64  `ooni:"Milliseconds to wait for duplicate DNS-over-UDP responses (0 = disabled)"`
+	DNSHTTPHost         string `ooni:"Force using specific HTTP Host header for DNS requests"`
+	DNSPaddingBlockSize int64  `ooni:"Pad DNS queries to a multiple of this size (0 = transport default, -1 = never)"`
+	DNSQueryTypes       string `ooni:"Comma-separated extra query types for dnslookup:// (e.g. 'CNAME,NS,MX,TXT')"`
+	DNSSECOK            bool   `ooni:"Set the DNSSEC OK bit in DNS queries"`
+	DNSTLSServerName    string `ooni:"Force TLS to using a specific SNI for encrypted DNS requests"`
+	DNSTLSVersion       string `ooni:"Force specific TLS version used for DoT/DoH (e.g. 'TLSv1.3')"`
+	DNSUDPPayloadSize   int64  `ooni:"EDNS0 UDP payload size for DNS queries (0 = default)"`
+	FailOnHTTPError     bool   `ooni:"Fail HTTP request if status code is 400 or above"`
+	HTTP3Enabled        bool   `ooni:"use http3 instead of http/1.1 or http2"`
+	HTTPHost            string `ooni:"Force using specific HTTP Host header"`
+	Method              string `ooni:"Force HTTP method different than GET"`
+	NoFollowRedirects   bool   `ooni:"Disable following redirects"`
+	NoTLSVerify         bool   `ooni:"Disable TLS verification"`
+	PcapngFile          string `ooni:"Append the synthesized packets of the measurement to this pcapng file"`
+	RejectDNSBogons     bool   `ooni:"Fail DNS lookup if response contains bogons"`
+	ResolverURL         string `ooni:"URL describing the resolver to use"`
+	TLSFingerprint      string `ooni:"Parrot a TLS Client Hello (one of: chrome, firefox, ios, randomized, go)"`
+	TLSServerName       string `ooni:"Force TLS to using a specific SNI in Client Hello"`
+	TLSSplit            string `ooni:"Split the Client Hello (one of: sni_segments, 8_4_rest, random_32_64, record_fragment)"`
+	TLSSplitDelay       int64  `ooni:"Milliseconds to wait between the Client Hello segments"`
+	TLSVersion          string `ooni:"Force specific TLS version (e.g. 'TLSv1.3')"`
+	Tunnel              string `ooni:"Run experiment over a tunnel, e.g. psiphon"`
+	UserAgent           string `ooni:"Use the specified User-Agent"`
 }
 
 // TestKeys contains the experiment's result.
 type TestKeys struct {
 	// The following fields are part of the typical JSON emitted by OONI.
-	Agent           string                     `json:"agent"`
-	BootstrapTime   float64                    `json:"bootstrap_time,omitempty"`
-	DNSCache        []string                   `json:"dns_cache,omitempty"`
-	FailedOperation *string                    `json:"failed_operation"`
-	Failure         *string                    `json:"failure"`
-	NetworkEvents   []archival.NetworkEvent    `json:"network_events"`
-	Queries         []archival.DNSQueryEntry   `json:"queries"`
-	Requests        []archival.RequestEntry    `json:"requests"`
-	SOCKSProxy      string                     `json:"socksproxy,omitempty"`
-	TCPConnect      []archival.TCPConnectEntry `json:"tcp_connect"`
-	TLSHandshakes   []archival.TLSHandshake    `json:"tls_handshakes"`
-	Tunnel          string                     `json:"tunnel,omitempty"`
+	Agent           string                       `json:"agent"`
+	BootstrapTime   float64                      `json:"bootstrap_time,omitempty"`
+	DNSCache        []string                     `json:"dns_cache,omitempty"`
+	DNSResponses    []archival.DNSResponsesEntry `json:"dns_responses,omitempty"`
+	FailedOperation *string                      `json:"failed_operation"`
+	Failure         *string                      `json:"failure"`
+	NetworkEvents   []archival.NetworkEvent      `json:"network_events"`
+	Queries         []archival.DNSQueryEntry     `json:"queries"`
+	Requests        []archival.RequestEntry      `json:"requests"`
+	SOCKSProxy      string                       `json:"socksproxy,omitempty"`
+	TCPConnect      []archival.TCPConnectEntry   `json:"tcp_connect"`
+	TLSHandshakes   []archival.TLSHandshake      `json:"tls_handshakes"`
+	Tunnel          string                       `json:"tunnel,omitempty"`
 
 	// The following fields are not serialised but are useful to simplify
 	// analysing the measurements in telegram, whatsapp, etc.
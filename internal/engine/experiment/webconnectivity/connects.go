@@ -3,6 +3,7 @@ package webconnectivity
 import (
 	"context"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/ooni/probe-cli/v3/internal/engine/experiment/urlgetter"
@@ -12,8 +13,11 @@ import (
 // ConnectsConfig contains the config for Connects
 type ConnectsConfig struct {
 	Begin         time.Time
+	PcapngFile    string // append the synthesized packets to this file
 	Session       model.ExperimentSession
 	TargetURL     *url.URL
+	TLSSplit      string // split the ClientHello using this strategy
+	TLSSplitDelay int64  // milliseconds between the ClientHello segments
 	URLGetterURLs []string
 }
 
@@ -24,6 +28,10 @@ type ConnectsResult struct {
 	AllKeys   []urlgetter.TestKeys
 	Successes int
 	Total     int
+
+	// FailedTLSHandshakes contains the URLs of the endpoints
+	// for which connect succeeded and the TLS handshake failed.
+	FailedTLSHandshakes []string
 }
 
 // Connects performs 0..N connects (either using TCP or TLS) to
@@ -35,7 +43,10 @@ func Connects(ctx context.Context, config ConnectsConfig) (out ConnectsResult) {
 	for _, url := range config.URLGetterURLs {
 		inputs = append(inputs, urlgetter.MultiInput{
 			Config: urlgetter.Config{
+				PcapngFile:    config.PcapngFile,
 				TLSServerName: config.TargetURL.Hostname(),
+				TLSSplit:      config.TLSSplit,
+				TLSSplitDelay: config.TLSSplitDelay,
 			},
 			Target: url,
 		})
@@ -43,12 +54,18 @@ func Connects(ctx context.Context, config ConnectsConfig) (out ConnectsResult) {
 	outputs := multi.Collect(ctx, inputs, "check", ConnectsNoCallbacks{})
 	for multiout := range outputs {
 		out.AllKeys = append(out.AllKeys, multiout.TestKeys)
+		connected := false
 		for _, entry := range multiout.TestKeys.TCPConnect {
 			if entry.Status.Success {
+				connected = true
 				out.Successes++
 			}
 			out.Total++
 		}
+		if connected && multiout.TestKeys.Failure != nil &&
+			strings.HasPrefix(multiout.Input.Target, "tlshandshake://") {
+			out.FailedTLSHandshakes = append(out.FailedTLSHandshakes, multiout.Input.Target)
+		}
 	}
 	return
 }
@@ -2,10 +2,18 @@ package webconnectivity_test
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/apex/log"
+	"github.com/google/go-cmp/cmp"
 	"github.com/ooni/probe-cli/v3/internal/engine/experiment/webconnectivity"
+	"github.com/ooni/probe-cli/v3/internal/engine/mockable"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
 )
 
 func TestConnectsSuccess(t *testing.T) {
@@ -53,3 +61,62 @@ func TestConnectsNoInput(t *testing.T) {
 		t.Fatal("unexpected number of attempts")
 	}
 }
+
+func TestConnectsFailedTLSHandshakes(t *testing.T) {
+	// the server certificate is not trusted, so we connect
+	// successfully but the TLS handshake fails
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	URL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := "tlshandshake://" + URL.Host
+	r := webconnectivity.Connects(context.Background(), webconnectivity.ConnectsConfig{
+		Session:       &mockable.Session{MockableLogger: log.Log},
+		TargetURL:     &url.URL{Scheme: "https", Host: "example.com", Path: "/"},
+		TLSSplit:      netxlite.TLSSplitRecordFragment,
+		URLGetterURLs: []string{target, "tcpconnect://" + URL.Host},
+	})
+	if r.Successes != 2 || r.Total != 2 {
+		t.Fatal("unexpected number of successes or attempts", r.Successes, r.Total)
+	}
+	if diff := cmp.Diff([]string{target}, r.FailedTLSHandshakes); diff != "" {
+		t.Fatal(diff)
+	}
+	var strategies []string
+	for _, tk := range r.AllKeys {
+		for _, ev := range tk.TLSHandshakes {
+			strategies = append(strategies, ev.ClientHelloSplit)
+		}
+	}
+	if diff := cmp.Diff([]string{netxlite.TLSSplitRecordFragment}, strategies); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestConnectsWithPcapngFile(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	URL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "capture.pcapng")
+	r := webconnectivity.Connects(context.Background(), webconnectivity.ConnectsConfig{
+		PcapngFile:    path,
+		Session:       &mockable.Session{MockableLogger: log.Log},
+		TargetURL:     &url.URL{Scheme: "http", Host: "example.com", Path: "/"},
+		URLGetterURLs: []string{"tcpconnect://" + URL.Host},
+	})
+	if r.Successes != 1 || r.Total != 1 {
+		t.Fatal("unexpected number of successes or attempts", r.Successes, r.Total)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() <= 0 {
+		t.Fatal("expected a non-empty pcapng file")
+	}
+}
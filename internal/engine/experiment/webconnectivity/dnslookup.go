@@ -13,9 +13,12 @@ import (
 
 // DNSLookupConfig contains settings for the DNS lookup.
 type DNSLookupConfig struct {
-	Begin   time.Time
-	Session model.ExperimentSession
-	URL     *url.URL
+	Begin               time.Time
+	DNSDuplicatesWindow int64
+	PcapngFile          string
+	ResolverURL         string
+	Session             model.ExperimentSession
+	URL                 *url.URL
 }
 
 // DNSLookupResult contains the result of the DNS lookup.
@@ -30,7 +33,15 @@ func DNSLookup(ctx context.Context, config DNSLookupConfig) (out DNSLookupResult
 	target := fmt.Sprintf("dnslookup://%s", config.URL.Hostname())
 	config.Session.Logger().Infof("%s...", target)
 	result, err := urlgetter.Getter{
-		Begin: config.Begin, Session: config.Session, Target: target}.Get(ctx)
+		Begin: config.Begin,
+		Config: urlgetter.Config{
+			DNSDuplicatesWindow: config.DNSDuplicatesWindow,
+			PcapngFile:          config.PcapngFile,
+			ResolverURL:         config.ResolverURL,
+		},
+		Session: config.Session,
+		Target:  target,
+	}.Get(ctx)
 	out.Addrs = make(map[string]int64)
 	for _, query := range result.Queries {
 		for _, answer := range query.Answers {
@@ -14,10 +14,11 @@ import (
 
 // HTTPGetConfig contains the config for HTTPGet
 type HTTPGetConfig struct {
-	Addresses []string
-	Begin     time.Time
-	Session   model.ExperimentSession
-	TargetURL *url.URL
+	Addresses  []string
+	Begin      time.Time
+	PcapngFile string
+	Session    model.ExperimentSession
+	TargetURL  *url.URL
 }
 
 // TODO(bassosimone): we should normalize the timings
@@ -58,7 +59,8 @@ func HTTPGet(ctx context.Context, config HTTPGetConfig) (out HTTPGetResult) {
 	result, err := urlgetter.Getter{
 		Begin: config.Begin,
 		Config: urlgetter.Config{
-			DNSCache: HTTPGetMakeDNSCache(domain, addresses),
+			DNSCache:   HTTPGetMakeDNSCache(domain, addresses),
+			PcapngFile: config.PcapngFile,
 		},
 		Session: config.Session,
 		Target:  target,
@@ -12,6 +12,7 @@ import (
 	"github.com/ooni/probe-cli/v3/internal/engine/httpheader"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/archival"
 	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
 )
 
 const (
@@ -20,7 +21,29 @@ const (
 )
 
 // Config contains the experiment config.
-type Config struct{}
+type Config struct {
+	// DNSDuplicatesWindow is the number of milliseconds during which we
+	// wait for duplicate responses after the first DNS response. It only
+	// has an effect when ResolverURL is a udp:// URL.
+	DNSDuplicatesWindow int64 `ooni:"milliseconds to wait for duplicate DNS-over-UDP responses (0 = disabled)"`
+
+	// PcapngFile is the file to which we append the packets we
+	// synthesize from the network events of the measurement.
+	PcapngFile string `ooni:"Append the synthesized packets of the measurement to this pcapng file"`
+
+	// ResolverURL is the URL of the resolver to use for the DNS
+	// experiment. When empty, we use the system resolver.
+	ResolverURL string `ooni:"URL describing the resolver to use (e.g., udp://8.8.8.8:53)"`
+
+	// TLSSplit is the strategy for splitting the ClientHello when
+	// we retry the TLS handshakes that failed. When empty, we do not
+	// retry. We tag the retries using TLSSplitFollowUpTag.
+	TLSSplit string `ooni:"Retry failed TLS handshakes splitting the Client Hello (one of: sni_segments, 8_4_rest, random_32_64, record_fragment)"`
+
+	// TLSSplitDelay is the number of milliseconds to wait
+	// between the segments of the split ClientHello.
+	TLSSplitDelay int64 `ooni:"Milliseconds to wait between the Client Hello segments"`
+}
 
 // TestKeys contains webconnectivity test keys.
 type TestKeys struct {
@@ -39,8 +62,9 @@ type TestKeys struct {
 	TLSHandshakes []archival.TLSHandshake `json:"tls_handshakes"`
 
 	// DNS experiment
-	Queries              []archival.DNSQueryEntry `json:"queries"`
-	DNSExperimentFailure *string                  `json:"dns_experiment_failure"`
+	Queries              []archival.DNSQueryEntry     `json:"queries"`
+	DNSResponses         []archival.DNSResponsesEntry `json:"dns_responses,omitempty"`
+	DNSExperimentFailure *string                      `json:"dns_experiment_failure"`
 	DNSAnalysisResult
 
 	// Control experiment
@@ -119,6 +143,10 @@ const (
 
 	// HTTPExperimentTag is a tag indicating the HTTP experiment.
 	HTTPExperimentTag = "http_experiment"
+
+	// TLSSplitFollowUpTag is a tag indicating that we retried a
+	// failed TLS handshake splitting the ClientHello.
+	TLSSplitFollowUpTag = "tls_split_follow_up"
 )
 
 // Run implements ExperimentMeasurer.Run.
@@ -144,6 +172,12 @@ func (m Measurer) Run(
 	if URL.Scheme != "http" && URL.Scheme != "https" {
 		return ErrUnsupportedInput
 	}
+	if m.Config.TLSSplit != "" {
+		split := &netxlite.TLSSplitConfig{Strategy: m.Config.TLSSplit}
+		if err := split.Validate(); err != nil {
+			return err
+		}
+	}
 	// 1. find test helper
 	testhelpers, _ := sess.GetTestHelpersByName("web-connectivity")
 	var testhelper *model.OOAPIService
@@ -162,10 +196,16 @@ func (m Measurer) Run(
 	// 2. perform the DNS lookup step
 	dnsBegin := time.Now()
 	dnsResult := DNSLookup(ctx, DNSLookupConfig{
-		Begin:   measurement.MeasurementStartTimeSaved,
-		Session: sess, URL: URL})
+		Begin:               measurement.MeasurementStartTimeSaved,
+		DNSDuplicatesWindow: m.Config.DNSDuplicatesWindow,
+		PcapngFile:          m.Config.PcapngFile,
+		ResolverURL:         m.Config.ResolverURL,
+		Session:             sess,
+		URL:                 URL,
+	})
 	tk.DNSRuntime = time.Since(dnsBegin)
 	tk.Queries = append(tk.Queries, dnsResult.TestKeys.Queries...)
+	tk.DNSResponses = append(tk.DNSResponses, dnsResult.TestKeys.DNSResponses...)
 	tk.DNSExperimentFailure = dnsResult.Failure
 	epnts := NewEndpoints(URL, dnsResult.Addresses())
 	sess.Logger().Infof("using control: %s", testhelper.Address)
@@ -197,6 +237,7 @@ func (m Measurer) Run(
 	tcptlsBegin := time.Now()
 	connectsResult := Connects(ctx, ConnectsConfig{
 		Begin:         measurement.MeasurementStartTimeSaved,
+		PcapngFile:    m.Config.PcapngFile,
 		Session:       sess,
 		TargetURL:     URL,
 		URLGetterURLs: epnts.URLs(),
@@ -220,13 +261,46 @@ func (m Measurer) Run(
 	}
 	tk.TCPConnectAttempts = connectsResult.Total
 	tk.TCPConnectSuccesses = connectsResult.Successes
+	// 5b. if configured, retry the failed TLS handshakes splitting the
+	// ClientHello, to see whether splitting evades SNI based blocking
+	//
+	// Note: we do not add the retries to TCPConnect because they do
+	// not have a corresponding control measurement.
+	if m.Config.TLSSplit != "" && len(connectsResult.FailedTLSHandshakes) > 0 {
+		followUps := Connects(ctx, ConnectsConfig{
+			Begin:         measurement.MeasurementStartTimeSaved,
+			PcapngFile:    m.Config.PcapngFile,
+			Session:       sess,
+			TargetURL:     URL,
+			TLSSplit:      m.Config.TLSSplit,
+			TLSSplitDelay: m.Config.TLSSplitDelay,
+			URLGetterURLs: connectsResult.FailedTLSHandshakes,
+		})
+		var succeeded int
+		for _, tcpkeys := range followUps.AllKeys {
+			if tcpkeys.Failure == nil {
+				succeeded++
+			}
+			for _, ev := range tcpkeys.NetworkEvents {
+				ev.Tags = []string{TLSSplitFollowUpTag}
+				tk.NetworkEvents = append(tk.NetworkEvents, ev)
+			}
+			for _, ev := range tcpkeys.TLSHandshakes {
+				ev.Tags = []string{TLSSplitFollowUpTag}
+				tk.TLSHandshakes = append(tk.TLSHandshakes, ev)
+			}
+		}
+		sess.Logger().Infof("TLS split follow-ups: %d/%d handshakes succeeded",
+			succeeded, len(followUps.AllKeys))
+	}
 	// 6. perform HTTP/HTTPS measurement
 	httpBegin := time.Now()
 	httpResult := HTTPGet(ctx, HTTPGetConfig{
-		Addresses: dnsResult.Addresses(),
-		Begin:     measurement.MeasurementStartTimeSaved,
-		Session:   sess,
-		TargetURL: URL,
+		Addresses:  dnsResult.Addresses(),
+		Begin:      measurement.MeasurementStartTimeSaved,
+		PcapngFile: m.Config.PcapngFile,
+		Session:    sess,
+		TargetURL:  URL,
 	})
 	tk.HTTPRuntime = time.Since(httpBegin)
 	tk.HTTPExperimentFailure = httpResult.Failure
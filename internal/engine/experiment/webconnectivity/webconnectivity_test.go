@@ -2,18 +2,26 @@ package webconnectivity_test
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/apex/log"
 	"github.com/google/go-cmp/cmp"
 	engine "github.com/ooni/probe-cli/v3/internal/engine"
 	"github.com/ooni/probe-cli/v3/internal/engine/experiment/webconnectivity"
+	"github.com/ooni/probe-cli/v3/internal/engine/mockable"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/archival"
 	"github.com/ooni/probe-cli/v3/internal/model"
 	"github.com/ooni/probe-cli/v3/internal/netxlite"
+	"github.com/ooni/probe-cli/v3/internal/netxlite/filtering"
+	"github.com/ooni/probe-cli/v3/internal/netxlite/vnet"
 )
 
 func TestNewExperimentMeasurer(t *testing.T) {
@@ -144,6 +152,19 @@ func TestMeasureWithInputNotBeingAnURL(t *testing.T) {
 	// TODO(bassosimone): write further checks here?
 }
 
+func TestMeasureWithInvalidTLSSplit(t *testing.T) {
+	measurer := webconnectivity.NewExperimentMeasurer(webconnectivity.Config{
+		TLSSplit: "antani",
+	})
+	measurement := &model.Measurement{Input: "https://example.com/"}
+	callbacks := model.NewPrinterCallbacks(log.Log)
+	sess := &mockable.Session{MockableLogger: log.Log}
+	err := measurer.Run(context.Background(), sess, measurement, callbacks)
+	if !errors.Is(err, netxlite.ErrUnknownTLSSplitStrategy) {
+		t.Fatal("not the error we expected", err)
+	}
+}
+
 func TestMeasureWithUnsupportedInput(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skip test in short mode")
@@ -414,3 +435,156 @@ func TestSummaryKeysWorksAsIntended(t *testing.T) {
 		})
 	}
 }
+
+// virtualTestHelper is a Web Connectivity test helper measuring using
+// a virtual network directly, so that it is never censored.
+type virtualTestHelper struct {
+	network *vnet.Network
+}
+
+// ServeHTTP implements http.Handler.
+func (th *virtualTestHelper) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var creq webconnectivity.ControlRequest
+	if err := json.NewDecoder(r.Body).Decode(&creq); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	URL, err := url.Parse(creq.HTTPRequest)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+	cresp := webconnectivity.ControlResponse{
+		TCPConnect: map[string]webconnectivity.ControlTCPConnectResult{},
+	}
+	cresp.DNS.Addrs, err = th.network.LookupHost(ctx, URL.Hostname())
+	cresp.DNS.Failure = th.failure(err)
+	dialer := th.network.NewSimpleDialer(time.Second)
+	for _, endpoint := range creq.TCPConnect {
+		conn, err := dialer.DialContext(ctx, "tcp", endpoint)
+		if err != nil {
+			cresp.TCPConnect[endpoint] = webconnectivity.ControlTCPConnectResult{
+				Failure: th.failure(err),
+			}
+			continue
+		}
+		conn.Close()
+		cresp.TCPConnect[endpoint] = webconnectivity.ControlTCPConnectResult{Status: true}
+	}
+	client := &http.Client{Transport: th.transport()}
+	defer client.CloseIdleConnections()
+	resp, err := client.Get(creq.HTTPRequest)
+	if err != nil {
+		cresp.HTTPRequest.Failure = th.failure(err)
+	} else {
+		defer resp.Body.Close()
+		data, _ := netxlite.ReadAllContext(ctx, resp.Body)
+		cresp.HTTPRequest.BodyLength = int64(len(data))
+		cresp.HTTPRequest.StatusCode = int64(resp.StatusCode)
+		cresp.HTTPRequest.Title = webconnectivity.GetTitle(string(data))
+		cresp.HTTPRequest.Headers = map[string]string{}
+		for key := range resp.Header {
+			cresp.HTTPRequest.Headers[key] = resp.Header.Get(key)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cresp)
+}
+
+// failure converts err to a failure string like the test helper does.
+func (th *virtualTestHelper) failure(err error) *string {
+	if err == nil {
+		return nil
+	}
+	return archival.NewFailure(netxlite.NewTopLevelGenericErrWrapper(err))
+}
+
+// transport returns an HTTP transport using the virtual network directly.
+func (th *virtualTestHelper) transport() *http.Transport {
+	return &http.Transport{
+		DialContext:     th.network.NewSimpleDialer(time.Second).DialContext,
+		TLSClientConfig: &tls.Config{RootCAs: th.network.DefaultCertPool()},
+	}
+}
+
+func TestWithVirtualNetwork(t *testing.T) {
+	th := &virtualTestHelper{}
+	network, err := vnet.NewNetwork(&vnet.Config{
+		Hosts: []*vnet.Host{{
+			Addresses: []string{"93.184.216.34"},
+			Domains:   []string{"www.example.com"},
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`<html><head><title>Example Domain</title></head></html>`))
+			}),
+		}, {
+			Addresses: []string{"37.218.241.94"},
+			Domains:   []string{"th.ooni.org"},
+			Handler:   th,
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer network.Close()
+	th.network = network
+
+	run := func(t *testing.T, underlying model.UnderlyingNetworkLibrary) *webconnectivity.TestKeys {
+		netxlite.TProxy = underlying
+		defer func() {
+			netxlite.TProxy = &netxlite.TProxyStdlib{}
+		}()
+		sess := &mockable.Session{
+			MockableLogger: log.Log,
+			MockableTestHelpers: map[string][]model.OOAPIService{
+				"web-connectivity": {{Address: "https://th.ooni.org", Type: "https"}},
+			},
+			// The session talks to the test helper without censorship.
+			MockableHTTPClient: &http.Client{Transport: th.transport()},
+		}
+		measurer := webconnectivity.NewExperimentMeasurer(webconnectivity.Config{})
+		measurement := &model.Measurement{Input: "http://www.example.com/"}
+		err := measurer.Run(context.Background(), sess, measurement, model.NewPrinterCallbacks(log.Log))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return measurement.TestKeys.(*webconnectivity.TestKeys)
+	}
+
+	t.Run("uncensored", func(t *testing.T) {
+		tk := run(t, network)
+		if tk.ControlFailure != nil {
+			t.Fatal("unexpected control failure", *tk.ControlFailure)
+		}
+		if tk.Accessible == nil || !*tk.Accessible {
+			t.Fatal("expected the website to be accessible")
+		}
+		if tk.Blocking != false {
+			t.Fatal("unexpected blocking", tk.Blocking)
+		}
+	})
+
+	t.Run("censored", func(t *testing.T) {
+		config := &filtering.TProxyConfig{
+			Domains: map[string]filtering.DNSAction{
+				"www.example.com": filtering.DNSActionNXDOMAIN,
+			},
+		}
+		config.CanonicalizeDNS()
+		proxy, err := filtering.NewTProxyWithUnderlyingNetwork(config, log.Log, network)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer proxy.Close()
+		tk := run(t, proxy)
+		if tk.ControlFailure != nil {
+			t.Fatal("unexpected control failure", *tk.ControlFailure)
+		}
+		if tk.Accessible == nil || *tk.Accessible {
+			t.Fatal("expected the website not to be accessible")
+		}
+		if tk.BlockingReason == nil || *tk.BlockingReason != "dns" {
+			t.Fatal("unexpected blocking reason", tk.BlockingReason)
+		}
+	})
+}
@@ -15,13 +15,14 @@ import (
 
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/archival"
 	"github.com/ooni/probe-cli/v3/internal/measurex"
+	"github.com/ooni/probe-cli/v3/internal/measurex/analysis"
 	"github.com/ooni/probe-cli/v3/internal/model"
 	"github.com/ooni/probe-cli/v3/internal/netxlite"
 )
 
 const (
 	testName    = "websteps"
-	testVersion = "0.0.3"
+	testVersion = "0.0.4"
 )
 
 // Config contains the experiment config.
@@ -30,6 +31,9 @@ type Config struct{}
 // TestKeys contains the experiment's test keys.
 type TestKeys struct {
 	*measurex.ArchivalURLMeasurement
+
+	// Analysis compares the probe and the TH results.
+	Analysis *analysis.URLAnalysis `json:"analysis"`
 }
 
 // Measurer performs the measurement.
@@ -143,6 +147,7 @@ func (mx *Measurer) runAsync(ctx context.Context, sess model.ExperimentSession,
 			MeasurementRuntime: m.TotalRuntime.Seconds(),
 			TestKeys: &TestKeys{
 				ArchivalURLMeasurement: measurex.NewArchivalURLMeasurement(m),
+				Analysis:               analysis.AnalyzeURL(m),
 			},
 		}
 	}
@@ -218,6 +223,18 @@ type SummaryKeys struct {
 
 // GetSummaryKeys implements model.ExperimentMeasurer.GetSummaryKeys.
 func (mx *Measurer) GetSummaryKeys(measurement *model.Measurement) (interface{}, error) {
-	sk := SummaryKeys{}
+	sk := SummaryKeys{IsAnomaly: false}
+	tk, ok := measurement.TestKeys.(*TestKeys)
+	if !ok {
+		return sk, errors.New("invalid test keys type")
+	}
+	if tk.Analysis == nil {
+		return sk, nil
+	}
+	sk.Accessible = tk.Analysis.Accessible
+	if tk.Analysis.Verdict.IsBlocked() {
+		sk.Blocking = string(tk.Analysis.Verdict)
+		sk.IsAnomaly = true
+	}
 	return sk, nil
 }
@@ -0,0 +1,78 @@
+package webstepsx_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/engine/experiment/webstepsx"
+	"github.com/ooni/probe-cli/v3/internal/measurex/analysis"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+func TestSummaryKeysInvalidType(t *testing.T) {
+	measurement := new(model.Measurement)
+	m := &webstepsx.Measurer{}
+	_, err := m.GetSummaryKeys(measurement)
+	if err == nil || err.Error() != "invalid test keys type" {
+		t.Fatal("not the error we expected", err)
+	}
+}
+
+func TestSummaryKeysWithNilAnalysis(t *testing.T) {
+	measurement := &model.Measurement{TestKeys: &webstepsx.TestKeys{}}
+	m := &webstepsx.Measurer{}
+	osk, err := m.GetSummaryKeys(measurement)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := webstepsx.SummaryKeys{}
+	if diff := cmp.Diff(expected, osk.(webstepsx.SummaryKeys)); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestSummaryKeysWithAnalysis(t *testing.T) {
+	type testcase struct {
+		name     string
+		analysis *analysis.URLAnalysis
+		expected webstepsx.SummaryKeys
+	}
+	var testcases = []testcase{{
+		name: "with a consistent URL",
+		analysis: &analysis.URLAnalysis{
+			Verdict:    analysis.VerdictConsistent,
+			Accessible: true,
+		},
+		expected: webstepsx.SummaryKeys{Accessible: true},
+	}, {
+		name: "with a blocked URL",
+		analysis: &analysis.URLAnalysis{
+			Verdict: analysis.VerdictBlockedTLS,
+		},
+		expected: webstepsx.SummaryKeys{
+			Blocking:  string(analysis.VerdictBlockedTLS),
+			IsAnomaly: true,
+		},
+	}, {
+		name: "with an inconclusive result",
+		analysis: &analysis.URLAnalysis{
+			Verdict: analysis.VerdictInconclusive,
+		},
+		expected: webstepsx.SummaryKeys{},
+	}}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			measurement := &model.Measurement{TestKeys: &webstepsx.TestKeys{
+				Analysis: tc.analysis,
+			}}
+			m := &webstepsx.Measurer{}
+			osk, err := m.GetSummaryKeys(measurement)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.expected, osk.(webstepsx.SummaryKeys)); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
@@ -15,13 +15,42 @@ type childResolver interface {
 	CloseIdleConnections()
 }
 
-// timeLimitedLookup performs a time-limited lookup using the given re.
-func (r *Resolver) timeLimitedLookup(ctx context.Context, re childResolver, hostname string) ([]string, error) {
+// childResolverWithTTL is a childResolver that also knows the TTL
+// of the addresses it returns (see model.ResolverWithTTL).
+type childResolverWithTTL interface {
+	// LookupHostWithTTL performs a DNS lookup and returns the TTL.
+	LookupHostWithTTL(ctx context.Context, domain string) ([]string, time.Duration, error)
+}
+
+// When a child resolver does not know the TTL (e.g., the system resolver), we
+// use these TTLs so that the netxlite.CachingResolver wrapping the session
+// resolver can still cache the results. They are both quite short because
+// the operating system may already be caching the results.
+const (
+	// defaultTTL is the TTL of successful lookups.
+	defaultTTL = time.Minute
+
+	// negativeTTL is the TTL of failed lookups.
+	negativeTTL = 30 * time.Second
+)
+
+// timeLimitedLookup performs a time-limited lookup using the given re. We
+// also return the TTL when re is a childResolverWithTTL and, otherwise, either
+// defaultTTL or negativeTTL depending on whether the lookup failed.
+func (r *Resolver) timeLimitedLookup(ctx context.Context,
+	re childResolver, hostname string) ([]string, time.Duration, error) {
 	// Algorithm similar to Firefox TRR2 mode. See:
 	// https://wiki.mozilla.org/Trusted_Recursive_Resolver#DNS-over-HTTPS_Prefs_in_Firefox
 	// We use a higher timeout than Firefox's timeout (1.5s) to be on the safe side
 	// and therefore see to use DoH more often.
 	ctx, cancel := context.WithTimeout(ctx, 4*time.Second)
 	defer cancel()
-	return re.LookupHost(ctx, hostname)
+	if reso, ok := re.(childResolverWithTTL); ok {
+		return reso.LookupHostWithTTL(ctx, hostname)
+	}
+	addrs, err := re.LookupHost(ctx, hostname)
+	if err != nil {
+		return nil, negativeTTL, err
+	}
+	return addrs, defaultTTL, nil
 }
@@ -36,13 +36,48 @@ func TestTimeLimitedLookupSuccess(t *testing.T) {
 		Data: []string{"8.8.8.8", "8.8.4.4"},
 	}
 	ctx := context.Background()
-	out, err := reso.timeLimitedLookup(ctx, re, "dns.google")
+	out, ttl, err := reso.timeLimitedLookup(ctx, re, "dns.google")
 	if err != nil {
 		t.Fatal(err)
 	}
 	if diff := cmp.Diff(re.Data, out); diff != "" {
 		t.Fatal(diff)
 	}
+	if ttl != defaultTTL {
+		t.Fatal("unexpected TTL", ttl)
+	}
+}
+
+type FakeResolverWithTTL struct {
+	FakeResolver
+	TTL time.Duration
+}
+
+func (r *FakeResolverWithTTL) LookupHostWithTTL(
+	ctx context.Context, hostname string) ([]string, time.Duration, error) {
+	addrs, err := r.LookupHost(ctx, hostname)
+	return addrs, r.TTL, err
+}
+
+func TestTimeLimitedLookupWithTTL(t *testing.T) {
+	reso := &Resolver{}
+	re := &FakeResolverWithTTL{
+		FakeResolver: FakeResolver{
+			Data: []string{"8.8.8.8", "8.8.4.4"},
+		},
+		TTL: 300 * time.Second,
+	}
+	ctx := context.Background()
+	out, ttl, err := reso.timeLimitedLookup(ctx, re, "dns.google")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(re.Data, out); diff != "" {
+		t.Fatal(diff)
+	}
+	if ttl != re.TTL {
+		t.Fatal("unexpected TTL", ttl)
+	}
 }
 
 func TestTimeLimitedLookupFailure(t *testing.T) {
@@ -51,13 +86,16 @@ func TestTimeLimitedLookupFailure(t *testing.T) {
 		Err: io.EOF,
 	}
 	ctx := context.Background()
-	out, err := reso.timeLimitedLookup(ctx, re, "dns.google")
+	out, ttl, err := reso.timeLimitedLookup(ctx, re, "dns.google")
 	if !errors.Is(err, re.Err) {
 		t.Fatal("not the error we expected", err)
 	}
 	if out != nil {
 		t.Fatal("expected nil here")
 	}
+	if ttl != negativeTTL {
+		t.Fatal("unexpected TTL", ttl)
+	}
 }
 
 func TestTimeLimitedLookupWillTimeout(t *testing.T) {
@@ -70,7 +108,7 @@ func TestTimeLimitedLookupWillTimeout(t *testing.T) {
 		Sleep: 20 * time.Second,
 	}
 	ctx := context.Background()
-	out, err := reso.timeLimitedLookup(ctx, re, "dns.google")
+	out, _, err := reso.timeLimitedLookup(ctx, re, "dns.google")
 	if !errors.Is(err, context.DeadlineExceeded) {
 		t.Fatal("not the error we expected", err)
 	}
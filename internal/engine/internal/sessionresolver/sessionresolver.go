@@ -29,6 +29,7 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"net"
 	"net/url"
 	"sync"
 	"time"
@@ -36,6 +37,7 @@ import (
 	"github.com/ooni/probe-cli/v3/internal/bytecounter"
 	"github.com/ooni/probe-cli/v3/internal/model"
 	"github.com/ooni/probe-cli/v3/internal/multierror"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
 	"github.com/ooni/probe-cli/v3/internal/runtimex"
 )
 
@@ -115,6 +117,31 @@ func (r *Resolver) LookupHTTPS(ctx context.Context, domain string) (*model.HTTPS
 	return nil, errors.New("not implemented")
 }
 
+// LookupSVCB implements Resolver.LookupSVCB.
+func (r *Resolver) LookupSVCB(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+	return nil, errors.New("not implemented")
+}
+
+// LookupCNAME implements Resolver.LookupCNAME.
+func (r *Resolver) LookupCNAME(ctx context.Context, domain string) ([]string, error) {
+	return nil, errors.New("not implemented")
+}
+
+// LookupNS implements Resolver.LookupNS.
+func (r *Resolver) LookupNS(ctx context.Context, domain string) ([]*net.NS, error) {
+	return nil, errors.New("not implemented")
+}
+
+// LookupMX implements Resolver.LookupMX.
+func (r *Resolver) LookupMX(ctx context.Context, domain string) ([]*net.MX, error) {
+	return nil, errors.New("not implemented")
+}
+
+// LookupTXT implements Resolver.LookupTXT.
+func (r *Resolver) LookupTXT(ctx context.Context, domain string) ([]string, error) {
+	return nil, errors.New("not implemented")
+}
+
 // ErrLookupHost indicates that LookupHost failed.
 var ErrLookupHost = errors.New("sessionresolver: LookupHost failed")
 
@@ -122,22 +149,81 @@ var ErrLookupHost = errors.New("sessionresolver: LookupHost failed")
 // multierror.Union error on failure, so you can see individual errors
 // and get a better picture of what's been going wrong.
 func (r *Resolver) LookupHost(ctx context.Context, hostname string) ([]string, error) {
+	addrs, _, err := r.LookupHostWithTTL(ctx, hostname)
+	return addrs, err
+}
+
+// LookupHostWithTTL implements model.ResolverWithTTL.LookupHostWithTTL. The
+// TTL is the one returned by the child resolver that succeeded or defaultTTL
+// when such a resolver does not know the TTL (e.g., the system resolver).
+//
+// When all the child resolvers fail with NXDOMAIN or "no answer", we return
+// an ErrWrapper with such failure, wrapping the usual ErrLookupHost multierror,
+// and the smallest negative TTL, so that the caller may cache the failure.
+func (r *Resolver) LookupHostWithTTL(ctx context.Context, hostname string) ([]string, time.Duration, error) {
 	state := r.readstatedefault()
 	r.maybeConfusion(state, time.Now().UnixNano())
 	defer r.writestate(state)
 	me := multierror.New(ErrLookupHost)
+	nr := &negativeReply{}
 	for _, e := range state {
 		if r.ProxyURL != nil && r.shouldSkipWithProxy(e) {
 			r.logger().Infof("sessionresolver: skipping with proxy: %+v", e)
 			continue // we cannot proxy this URL so ignore it
 		}
-		addrs, err := r.lookupHost(ctx, e, hostname)
+		addrs, ttl, err := r.lookupHost(ctx, e, hostname)
 		if err == nil {
-			return addrs, nil
+			return addrs, ttl, nil
 		}
 		me.Add(&errwrapper{error: err, URL: e.URL})
+		nr.add(err, ttl)
+	}
+	return nr.result(me)
+}
+
+// negativeReply checks whether all the child resolvers
+// failed with errors that we can negatively cache.
+type negativeReply struct {
+	// failure is the failure of the first child resolver.
+	failure string
+
+	// mixed indicates that we have seen other failures.
+	mixed bool
+
+	// ttl is the smallest TTL we have seen.
+	ttl time.Duration
+}
+
+// add registers the error and the TTL of a child resolver.
+func (nr *negativeReply) add(err error, ttl time.Duration) {
+	failure := netxlite.NewTopLevelGenericErrWrapper(err).Failure
+	switch failure {
+	case netxlite.FailureDNSNXDOMAINError, netxlite.FailureDNSNoAnswer:
+	default:
+		nr.mixed = true
+		return
+	}
+	if nr.failure == "" {
+		nr.failure, nr.ttl = failure, ttl
+		return
+	}
+	if ttl < nr.ttl {
+		nr.ttl = ttl
+	}
+}
+
+// result returns the result of LookupHostWithTTL given the multierror
+// containing the errors of all the child resolvers.
+func (nr *negativeReply) result(me *multierror.Union) ([]string, time.Duration, error) {
+	if nr.mixed || nr.failure == "" {
+		return nil, 0, me
+	}
+	err := &netxlite.ErrWrapper{
+		Failure:    nr.failure,
+		Operation:  netxlite.ResolveOperation,
+		WrappedErr: me,
 	}
-	return nil, me
+	return nil, nr.ttl, err
 }
 
 func (r *Resolver) shouldSkipWithProxy(e *resolverinfo) bool {
@@ -153,23 +239,24 @@ func (r *Resolver) shouldSkipWithProxy(e *resolverinfo) bool {
 	}
 }
 
-func (r *Resolver) lookupHost(ctx context.Context, ri *resolverinfo, hostname string) ([]string, error) {
+func (r *Resolver) lookupHost(ctx context.Context,
+	ri *resolverinfo, hostname string) ([]string, time.Duration, error) {
 	const ewma = 0.9 // the last sample is very important
 	re, err := r.getresolver(ri.URL)
 	if err != nil {
 		r.logger().Warnf("sessionresolver: getresolver: %s", err.Error())
 		ri.Score = 0 // this is a hard error
-		return nil, err
+		return nil, 0, err
 	}
-	addrs, err := r.timeLimitedLookup(ctx, re, hostname)
+	addrs, ttl, err := r.timeLimitedLookup(ctx, re, hostname)
 	if err == nil {
 		r.logger().Infof("sessionresolver: %s... %v", ri.URL, nil)
 		ri.Score = ewma*1.0 + (1-ewma)*ri.Score // increase score
-		return addrs, nil
+		return addrs, ttl, nil
 	}
 	r.logger().Warnf("sessionresolver: %s... %s", ri.URL, err.Error())
 	ri.Score = ewma*0.0 + (1-ewma)*ri.Score // decrease score
-	return nil, err
+	return nil, ttl, err
 }
 
 // maybeConfusion will rearrange the  first elements of the vector
@@ -7,11 +7,13 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/ooni/probe-cli/v3/internal/atomicx"
 	"github.com/ooni/probe-cli/v3/internal/kvstore"
 	"github.com/ooni/probe-cli/v3/internal/multierror"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
 )
 
 func TestNetworkWorks(t *testing.T) {
@@ -97,11 +99,139 @@ func TestTypicalUsageWithSuccess(t *testing.T) {
 	}
 }
 
+func TestLookupHostWithTTL(t *testing.T) {
+	t.Run("with a child resolver knowing the TTL", func(t *testing.T) {
+		reso := &Resolver{
+			KVStore: &kvstore.Memory{},
+			dnsClientMaker: &fakeDNSClientMaker{
+				reso: &FakeResolverWithTTL{
+					FakeResolver: FakeResolver{Data: []string{"8.8.8.8"}},
+					TTL:          300 * time.Second,
+				},
+			},
+		}
+		_, ttl, err := reso.LookupHostWithTTL(context.Background(), "dns.google")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ttl != 300*time.Second {
+			t.Fatal("unexpected TTL", ttl)
+		}
+	})
+
+	t.Run("with a child resolver not knowing the TTL", func(t *testing.T) {
+		reso := &Resolver{
+			KVStore: &kvstore.Memory{},
+			dnsClientMaker: &fakeDNSClientMaker{
+				reso: &FakeResolver{Data: []string{"8.8.8.8"}},
+			},
+		}
+		_, ttl, err := reso.LookupHostWithTTL(context.Background(), "dns.google")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ttl != defaultTTL {
+			t.Fatal("unexpected TTL", ttl)
+		}
+	})
+
+	t.Run("when all child resolvers return NXDOMAIN", func(t *testing.T) {
+		reso := &Resolver{
+			KVStore: &kvstore.Memory{},
+			dnsClientMaker: &fakeDNSClientMaker{
+				reso: &FakeResolverWithTTL{
+					FakeResolver: FakeResolver{Err: netxlite.ErrOODNSNoSuchHost},
+					TTL:          10 * time.Second,
+				},
+			},
+		}
+		addrs, ttl, err := reso.LookupHostWithTTL(context.Background(), "antani.ooni.org")
+		if !errors.Is(err, ErrLookupHost) {
+			t.Fatal("not the error we expected", err)
+		}
+		if err.Error() != netxlite.FailureDNSNXDOMAINError {
+			t.Fatal("unexpected failure", err)
+		}
+		if addrs != nil {
+			t.Fatal("expected nil addrs here")
+		}
+		if ttl != 10*time.Second {
+			t.Fatal("unexpected TTL", ttl)
+		}
+	})
+
+	t.Run("when all child resolvers fail otherwise", func(t *testing.T) {
+		reso := &Resolver{
+			KVStore: &kvstore.Memory{},
+			dnsClientMaker: &fakeDNSClientMaker{
+				reso: &FakeResolverWithTTL{
+					FakeResolver: FakeResolver{Err: netxlite.ErrOODNSRefused},
+					TTL:          10 * time.Second,
+				},
+			},
+		}
+		_, ttl, err := reso.LookupHostWithTTL(context.Background(), "antani.ooni.org")
+		var me *multierror.Union
+		if !errors.As(err, &me) {
+			t.Fatal("not the error we expected", err)
+		}
+		var ew *netxlite.ErrWrapper
+		if errors.As(err, &ew) {
+			t.Fatal("did not expect an ErrWrapper here")
+		}
+		if ttl != 0 {
+			t.Fatal("unexpected TTL", ttl)
+		}
+	})
+}
+
+func TestNegativeReply(t *testing.T) {
+	t.Run("uses the first failure and the smallest TTL", func(t *testing.T) {
+		nr := &negativeReply{}
+		nr.add(netxlite.ErrOODNSNoAnswer, 30*time.Second)
+		nr.add(netxlite.ErrOODNSNoSuchHost, 10*time.Second)
+		nr.add(netxlite.ErrOODNSNoSuchHost, 20*time.Second)
+		_, ttl, err := nr.result(multierror.New(ErrLookupHost))
+		if err.Error() != netxlite.FailureDNSNoAnswer {
+			t.Fatal("unexpected failure", err)
+		}
+		if ttl != 10*time.Second {
+			t.Fatal("unexpected TTL", ttl)
+		}
+	})
+
+	t.Run("returns the multierror with other failures", func(t *testing.T) {
+		nr := &negativeReply{}
+		nr.add(netxlite.ErrOODNSNoSuchHost, 10*time.Second)
+		nr.add(context.DeadlineExceeded, negativeTTL)
+		me := multierror.New(ErrLookupHost)
+		_, ttl, err := nr.result(me)
+		if err != me {
+			t.Fatal("not the error we expected", err)
+		}
+		if ttl != 0 {
+			t.Fatal("unexpected TTL", ttl)
+		}
+	})
+
+	t.Run("returns the multierror without failures", func(t *testing.T) {
+		nr := &negativeReply{}
+		me := multierror.New(ErrLookupHost)
+		_, ttl, err := nr.result(me)
+		if err != me {
+			t.Fatal("not the error we expected", err)
+		}
+		if ttl != 0 {
+			t.Fatal("unexpected TTL", ttl)
+		}
+	})
+}
+
 func TestLittleLLookupHostWithInvalidURL(t *testing.T) {
 	reso := &Resolver{}
 	ctx := context.Background()
 	ri := &resolverinfo{URL: "\t\t\t", Score: 0.99}
-	addrs, err := reso.lookupHost(ctx, ri, "ooni.org")
+	addrs, _, err := reso.lookupHost(ctx, ri, "ooni.org")
 	if err == nil || !strings.HasSuffix(err.Error(), "invalid control character in URL") {
 		t.Fatal("not the error we expected", err)
 	}
@@ -122,7 +252,7 @@ func TestLittleLLookupHostWithSuccess(t *testing.T) {
 	}
 	ctx := context.Background()
 	ri := &resolverinfo{URL: "dot://dns-nonexistent.ooni.org", Score: 0.1}
-	addrs, err := reso.lookupHost(ctx, ri, "dns.google")
+	addrs, _, err := reso.lookupHost(ctx, ri, "dns.google")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -143,7 +273,7 @@ func TestLittleLLookupHostWithFailure(t *testing.T) {
 	}
 	ctx := context.Background()
 	ri := &resolverinfo{URL: "dot://dns-nonexistent.ooni.org", Score: 0.95}
-	addrs, err := reso.lookupHost(ctx, ri, "dns.google")
+	addrs, _, err := reso.lookupHost(ctx, ri, "dns.google")
 	if !errors.Is(err, errMocked) {
 		t.Fatal("not the error we expected", err)
 	}
@@ -6,6 +6,7 @@ package archival
 import (
 	"crypto/x509"
 	"errors"
+	"fmt"
 	"net"
 	"net/http"
 	"sort"
@@ -13,6 +14,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/miekg/dns"
 	"github.com/ooni/probe-cli/v3/internal/engine/geolocate"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/trace"
 	"github.com/ooni/probe-cli/v3/internal/model"
@@ -21,19 +23,21 @@ import (
 
 // Compatibility types
 type (
-	ExtSpec          = model.ArchivalExtSpec
-	TCPConnectEntry  = model.ArchivalTCPConnectResult
-	TCPConnectStatus = model.ArchivalTCPConnectStatus
-	MaybeBinaryValue = model.ArchivalMaybeBinaryData
-	DNSQueryEntry    = model.ArchivalDNSLookupResult
-	DNSAnswerEntry   = model.ArchivalDNSAnswer
-	TLSHandshake     = model.ArchivalTLSOrQUICHandshakeResult
-	HTTPBody         = model.ArchivalHTTPBody
-	HTTPHeader       = model.ArchivalHTTPHeader
-	RequestEntry     = model.ArchivalHTTPRequestResult
-	HTTPRequest      = model.ArchivalHTTPRequest
-	HTTPResponse     = model.ArchivalHTTPResponse
-	NetworkEvent     = model.ArchivalNetworkEvent
+	ExtSpec           = model.ArchivalExtSpec
+	TCPConnectEntry   = model.ArchivalTCPConnectResult
+	TCPConnectStatus  = model.ArchivalTCPConnectStatus
+	MaybeBinaryValue  = model.ArchivalMaybeBinaryData
+	DNSQueryEntry     = model.ArchivalDNSLookupResult
+	DNSAnswerEntry    = model.ArchivalDNSAnswer
+	DNSResponsesEntry = model.ArchivalDNSResponses
+	DNSResponseEntry  = model.ArchivalDNSResponse
+	TLSHandshake      = model.ArchivalTLSOrQUICHandshakeResult
+	HTTPBody          = model.ArchivalHTTPBody
+	HTTPHeader        = model.ArchivalHTTPHeader
+	RequestEntry      = model.ArchivalHTTPRequestResult
+	HTTPRequest       = model.ArchivalHTTPRequest
+	HTTPResponse      = model.ArchivalHTTPResponse
+	NetworkEvent      = model.ArchivalNetworkEvent
 )
 
 // Compatibility variables
@@ -178,14 +182,33 @@ func newRequestList(begin time.Time, events []trace.Event) []RequestEntry {
 
 type dnsQueryType string
 
-// NewDNSQueriesList returns a list of DNS queries.
+// NewDNSQueriesList returns a list of DNS queries. When the events also
+// contain the DNS round trips, we use the raw replies to fill the AD bit,
+// the RRSIG presence, and the extended DNS errors of each query.
 func NewDNSQueriesList(begin time.Time, events []trace.Event) []DNSQueryEntry {
-	// TODO(bassosimone): add support for CNAME lookups.
 	var out []DNSQueryEntry
+	replies := make(map[string][]byte)
 	for _, ev := range events {
+		if ev.Name == "dns_round_trip_done" {
+			if key, ok := dnsRoundTripKey(ev.Address, ev.DNSQuery); ok {
+				replies[key] = ev.DNSReply // nil on failure
+			}
+			continue
+		}
 		if ev.Name != "resolve_done" {
 			continue
 		}
+		if ev.DNSQueryType != "" {
+			// This event has been emitted by a CNAME, NS, MX or TXT
+			// lookup, so we know exactly which query we sent.
+			entry := dnsQueryType(ev.DNSQueryType).makequeryentry(begin, ev)
+			for _, record := range ev.DNSRecords {
+				entry.Answers = append(entry.Answers, makerecordentry(record))
+			}
+			setDNSReplyInfo(&entry, replies, ev)
+			out = append(out, entry)
+			continue
+		}
 		for _, qtype := range []dnsQueryType{"A", "AAAA"} {
 			entry := qtype.makequeryentry(begin, ev)
 			for _, addr := range ev.Addresses {
@@ -204,12 +227,62 @@ func NewDNSQueriesList(begin time.Time, events []trace.Event) []DNSQueryEntry {
 				// this output is just our best guess.
 				continue
 			}
+			setDNSReplyInfo(&entry, replies, ev)
 			out = append(out, entry)
 		}
 	}
 	return out
 }
 
+// dnsRoundTripKey returns the key identifying a round trip with
+// the given resolver address and raw query. The key contains the
+// query name and type. Returns false if we cannot parse the query.
+func dnsRoundTripKey(address string, rawQuery []byte) (string, bool) {
+	query := new(dns.Msg)
+	if err := query.Unpack(rawQuery); err != nil || len(query.Question) != 1 {
+		return "", false
+	}
+	question := query.Question[0]
+	qtype := dns.TypeToString[question.Qtype]
+	return dnsReplyKey(address, question.Name, qtype), true
+}
+
+// dnsReplyKey is the key used to index the replies.
+func dnsReplyKey(address, name, qtype string) string {
+	return fmt.Sprintf("%s %s %s", address, dns.Fqdn(name), qtype)
+}
+
+// setDNSReplyInfo sets the AD bit, the RRSIG presence and the extended
+// DNS errors of entry using the most recent reply we received for the
+// query that entry represents (if any). We consume the reply, so that
+// we do not use it again for a subsequent lookup of the same name.
+func setDNSReplyInfo(entry *DNSQueryEntry, replies map[string][]byte, ev trace.Event) {
+	qtype := entry.QueryType
+	if qtype == "CNAME" {
+		qtype = "A" // see netxlite.SerialResolver.LookupCNAME
+	}
+	key := dnsReplyKey(ev.Address, ev.Hostname, qtype)
+	reply, found := replies[key]
+	delete(replies, key)
+	if !found || reply == nil {
+		return
+	}
+	decoder := &netxlite.DNSDecoderMiekg{}
+	info, err := decoder.DecodeReplyInfo(reply)
+	if err != nil {
+		return
+	}
+	entry.AuthenticData = info.AuthenticData
+	entry.HasRRSIG = info.HasRRSIG
+	for _, ede := range info.ExtendedErrors {
+		entry.ExtendedErrors = append(entry.ExtendedErrors, model.ArchivalDNSExtendedError{
+			InfoCode:  ede.InfoCode,
+			Name:      netxlite.DNSExtendedErrorName(ede.InfoCode),
+			ExtraText: ede.ExtraText,
+		})
+	}
+}
+
 func (qtype dnsQueryType) ipoftype(addr string) bool {
 	switch qtype {
 	case "A":
@@ -234,6 +307,18 @@ func (qtype dnsQueryType) makeanswerentry(addr string) DNSAnswerEntry {
 	return answer
 }
 
+func makerecordentry(record *model.DNSRecord) DNSAnswerEntry {
+	answer := DNSAnswerEntry{AnswerType: record.Type}
+	switch record.Type {
+	case "TXT":
+		answer.Text = record.Value
+	default:
+		answer.Hostname = record.Value
+		answer.Preference = record.Preference
+	}
+	return answer
+}
+
 func (qtype dnsQueryType) makequeryentry(begin time.Time, ev trace.Event) DNSQueryEntry {
 	return DNSQueryEntry{
 		Engine:          ev.Proto,
@@ -245,6 +330,64 @@ func (qtype dnsQueryType) makequeryentry(begin time.Time, ev trace.Event) DNSQue
 	}
 }
 
+// NewDNSResponsesList returns the list of all the responses received for
+// each DNS query. Only the transports wrapped by resolver.SaverDNSTransportWithDuplicates
+// emit the dns_response events we need to build this list.
+func NewDNSResponsesList(begin time.Time, events []trace.Event) []DNSResponsesEntry {
+	var out []DNSResponsesEntry
+	index := make(map[string]int)
+	for _, ev := range events {
+		if ev.Name != "dns_response" {
+			continue
+		}
+		key := ev.Address + " " + string(ev.DNSQuery)
+		idx, found := index[key]
+		if !found {
+			idx = len(out)
+			index[key] = idx
+			out = append(out, newDNSResponsesEntry(begin, ev))
+		}
+		out[idx].Responses = append(out[idx].Responses,
+			newDNSResponseEntry(begin, ev, out[idx].QueryType))
+	}
+	for idx := range out {
+		var replies [][]byte
+		for _, response := range out[idx].Responses {
+			replies = append(replies, response.RawReply)
+		}
+		out[idx].Conflicting, _ = netxlite.DNSRepliesConflict(replies...)
+	}
+	return out
+}
+
+func newDNSResponsesEntry(begin time.Time, ev trace.Event) DNSResponsesEntry {
+	entry := DNSResponsesEntry{
+		Engine:          ev.Proto,
+		ResolverAddress: ev.Address,
+		T:               ev.Time.Sub(begin).Seconds(),
+	}
+	query := new(dns.Msg)
+	if err := query.Unpack(ev.DNSQuery); err == nil && len(query.Question) == 1 {
+		entry.Hostname = strings.TrimSuffix(query.Question[0].Name, ".")
+		entry.QueryType = dns.TypeToString[query.Question[0].Qtype]
+	}
+	return entry
+}
+
+func newDNSResponseEntry(begin time.Time, ev trace.Event, qtype string) DNSResponseEntry {
+	entry := DNSResponseEntry{
+		RawReply: ev.DNSReply,
+		T:        ev.Time.Sub(begin).Seconds(),
+	}
+	addrs, err := (&netxlite.DNSDecoderMiekg{}).DecodeLookupHost(
+		dns.StringToType[qtype], ev.DNSReply)
+	entry.Failure = NewFailure(err)
+	for _, addr := range addrs {
+		entry.Answers = append(entry.Answers, dnsQueryType(qtype).makeanswerentry(addr))
+	}
+	return entry
+}
+
 // NewNetworkEventsList returns a list of DNS queries.
 func NewNetworkEventsList(begin time.Time, events []trace.Event) []NetworkEvent {
 	var out []NetworkEvent
@@ -314,14 +457,17 @@ func NewTLSHandshakesList(begin time.Time, events []trace.Event) []TLSHandshake
 			continue
 		}
 		out = append(out, TLSHandshake{
-			CipherSuite:        ev.TLSCipherSuite,
-			Failure:            NewFailure(ev.Err),
-			NegotiatedProtocol: ev.TLSNegotiatedProto,
-			NoTLSVerify:        ev.NoTLSVerify,
-			PeerCertificates:   makePeerCerts(ev.TLSPeerCerts),
-			ServerName:         ev.TLSServerName,
-			T:                  ev.Time.Sub(begin).Seconds(),
-			TLSVersion:         ev.TLSVersion,
+			CipherSuite:            ev.TLSCipherSuite,
+			ClientHelloFingerprint: ev.TLSFingerprint,
+			ClientHelloSplit:       ev.TLSSplitStrategy,
+			ClientHelloSplitDelay:  ev.TLSSplitDelay.Seconds(),
+			Failure:                NewFailure(ev.Err),
+			NegotiatedProtocol:     ev.TLSNegotiatedProto,
+			NoTLSVerify:            ev.NoTLSVerify,
+			PeerCertificates:       makePeerCerts(ev.TLSPeerCerts),
+			ServerName:             ev.TLSServerName,
+			T:                      ev.Time.Sub(begin).Seconds(),
+			TLSVersion:             ev.TLSVersion,
 		})
 	}
 	return out
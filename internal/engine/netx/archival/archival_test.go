@@ -5,6 +5,7 @@ import (
 	"crypto/x509"
 	"errors"
 	"io"
+	"net"
 	"net/http"
 	"reflect"
 	"testing"
@@ -12,8 +13,10 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/gorilla/websocket"
+	"github.com/miekg/dns"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/archival"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/trace"
+	"github.com/ooni/probe-cli/v3/internal/model"
 	"github.com/ooni/probe-cli/v3/internal/netxlite"
 )
 
@@ -284,6 +287,25 @@ func TestNewRequestList(t *testing.T) {
 
 func TestNewDNSQueriesList(t *testing.T) {
 	begin := time.Now()
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", dns.TypeTXT)
+	rawQuery, err := query.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply := new(dns.Msg)
+	reply.SetReply(query)
+	reply.AuthenticatedData = true
+	opt := &dns.OPT{Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeOPT}}
+	opt.Option = append(opt.Option, &dns.EDNS0_EDE{
+		InfoCode:  dns.ExtendedErrorCodeFiltered,
+		ExtraText: "blocked",
+	})
+	reply.Extra = append(reply.Extra, opt)
+	rawReply, err := reply.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
 	type args struct {
 		begin  time.Time
 		events []trace.Event
@@ -293,6 +315,89 @@ func TestNewDNSQueriesList(t *testing.T) {
 		args args
 		want []archival.DNSQueryEntry
 	}{{
+		name: "with record type lookups",
+		args: args{
+			begin: begin,
+			events: []trace.Event{{
+				Address:      "8.8.8.8:53",
+				DNSQueryType: "MX",
+				DNSRecords: []*model.DNSRecord{{
+					Type:       "MX",
+					Value:      "mx.example.com.",
+					Preference: 10,
+				}},
+				Hostname: "example.com",
+				Name:     "resolve_done",
+				Proto:    "udp",
+				Time:     begin.Add(100 * time.Millisecond),
+			}, {
+				Address:      "8.8.8.8:53",
+				DNSQueryType: "TXT",
+				DNSRecords: []*model.DNSRecord{{
+					Type:  "TXT",
+					Value: "v=spf1 -all",
+				}},
+				Hostname: "example.com",
+				Name:     "resolve_done",
+				Proto:    "udp",
+				Time:     begin.Add(200 * time.Millisecond),
+			}},
+		},
+		want: []archival.DNSQueryEntry{{
+			Answers: []archival.DNSAnswerEntry{{
+				AnswerType: "MX",
+				Hostname:   "mx.example.com.",
+				Preference: 10,
+			}},
+			Engine:          "udp",
+			Hostname:        "example.com",
+			QueryType:       "MX",
+			ResolverAddress: "8.8.8.8:53",
+			T:               0.1,
+		}, {
+			Answers: []archival.DNSAnswerEntry{{
+				AnswerType: "TXT",
+				Text:       "v=spf1 -all",
+			}},
+			Engine:          "udp",
+			Hostname:        "example.com",
+			QueryType:       "TXT",
+			ResolverAddress: "8.8.8.8:53",
+			T:               0.2,
+		}},
+	}, {
+		name: "with DNSSEC and extended DNS errors",
+		args: args{
+			begin: begin,
+			events: []trace.Event{{
+				Address:  "8.8.8.8:53",
+				DNSQuery: rawQuery,
+				DNSReply: rawReply,
+				Name:     "dns_round_trip_done",
+				Time:     begin.Add(90 * time.Millisecond),
+			}, {
+				Address:      "8.8.8.8:53",
+				DNSQueryType: "TXT",
+				Hostname:     "example.com",
+				Name:         "resolve_done",
+				Proto:        "udp",
+				Time:         begin.Add(100 * time.Millisecond),
+			}},
+		},
+		want: []archival.DNSQueryEntry{{
+			AuthenticData: true,
+			Engine:        "udp",
+			ExtendedErrors: []model.ArchivalDNSExtendedError{{
+				InfoCode:  dns.ExtendedErrorCodeFiltered,
+				Name:      "Filtered",
+				ExtraText: "blocked",
+			}},
+			Hostname:        "example.com",
+			QueryType:       "TXT",
+			ResolverAddress: "8.8.8.8:53",
+			T:               0.1,
+		}},
+	}, {
 		name: "empty run",
 		args: args{
 			begin:  begin,
@@ -555,6 +660,28 @@ func TestNewTLSHandshakesList(t *testing.T) {
 			T:          0.055,
 			TLSVersion: "TLSv1.3",
 		}},
+	}, {
+		name: "with ClientHello splitting and fingerprint",
+		args: args{
+			begin: begin,
+			events: []trace.Event{{
+				Name:             "tls_handshake_done",
+				TLSFingerprint:   netxlite.TLSFingerprintChrome,
+				TLSServerName:    "x.org",
+				TLSSplitDelay:    250 * time.Millisecond,
+				TLSSplitStrategy: netxlite.TLSSplitSNISegments,
+				TLSVersion:       "TLSv1.3",
+				Time:             begin.Add(55 * time.Millisecond),
+			}},
+		},
+		want: []archival.TLSHandshake{{
+			ClientHelloFingerprint: netxlite.TLSFingerprintChrome,
+			ClientHelloSplit:       netxlite.TLSSplitSNISegments,
+			ClientHelloSplitDelay:  0.25,
+			ServerName:             "x.org",
+			T:                      0.055,
+			TLSVersion:             "TLSv1.3",
+		}},
 	}}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -706,3 +833,108 @@ func TestNewFailedOperation(t *testing.T) {
 		})
 	}
 }
+
+func TestNewDNSResponsesList(t *testing.T) {
+	begin := time.Now()
+	query := new(dns.Msg)
+	query.SetQuestion("www.example.com.", dns.TypeA)
+	rawQuery, err := query.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	newReply := func(addr string) []byte {
+		reply := new(dns.Msg)
+		reply.SetReply(query)
+		reply.Answer = append(reply.Answer, &dns.A{
+			Hdr: dns.RR_Header{
+				Name:   "www.example.com.",
+				Rrtype: dns.TypeA,
+				Class:  dns.ClassINET,
+			},
+			A: net.ParseIP(addr),
+		})
+		data, err := reply.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	injected, legit := newReply("10.10.34.35"), newReply("93.184.216.34")
+	events := []trace.Event{{
+		Address:  "8.8.8.8:53",
+		DNSQuery: rawQuery,
+		Name:     "dns_round_trip_start",
+		Proto:    "udp",
+		Time:     begin,
+	}, {
+		Address:  "8.8.8.8:53",
+		DNSQuery: rawQuery,
+		DNSReply: injected,
+		Name:     "dns_response",
+		Proto:    "udp",
+		Time:     begin.Add(10 * time.Millisecond),
+	}, {
+		Address:  "8.8.8.8:53",
+		DNSQuery: rawQuery,
+		DNSReply: legit,
+		Name:     "dns_response",
+		Proto:    "udp",
+		Time:     begin.Add(50 * time.Millisecond),
+	}, {
+		Address:  "8.8.8.8:53",
+		DNSQuery: rawQuery,
+		DNSReply: injected,
+		Name:     "dns_round_trip_done",
+		Proto:    "udp",
+		Time:     begin.Add(time.Second),
+	}}
+
+	t.Run("with conflicting responses", func(t *testing.T) {
+		out := archival.NewDNSResponsesList(begin, events)
+		if len(out) != 1 {
+			t.Fatal("unexpected number of entries", len(out))
+		}
+		entry := out[0]
+		if !entry.Conflicting {
+			t.Fatal("expected conflicting responses")
+		}
+		if entry.Engine != "udp" || entry.ResolverAddress != "8.8.8.8:53" {
+			t.Fatal("unexpected engine or resolver address")
+		}
+		if entry.Hostname != "www.example.com" || entry.QueryType != "A" {
+			t.Fatal("unexpected hostname or query type")
+		}
+		if len(entry.Responses) != 2 {
+			t.Fatal("unexpected number of responses")
+		}
+		if entry.Responses[0].Answers[0].IPv4 != "10.10.34.35" {
+			t.Fatal("unexpected first answer")
+		}
+		if entry.Responses[1].Answers[0].IPv4 != "93.184.216.34" {
+			t.Fatal("unexpected second answer")
+		}
+		if entry.Responses[0].Failure != nil || entry.Responses[1].Failure != nil {
+			t.Fatal("unexpected failure")
+		}
+		if entry.Responses[0].T >= entry.Responses[1].T {
+			t.Fatal("unexpected response times")
+		}
+	})
+
+	t.Run("with a single response", func(t *testing.T) {
+		out := archival.NewDNSResponsesList(begin, events[:2])
+		if len(out) != 1 {
+			t.Fatal("unexpected number of entries", len(out))
+		}
+		if out[0].Conflicting {
+			t.Fatal("a single response cannot conflict")
+		}
+	})
+
+	t.Run("without dns_response events", func(t *testing.T) {
+		out := archival.NewDNSResponsesList(begin, []trace.Event{events[0], events[3]})
+		if len(out) != 0 {
+			t.Fatal("expected no entries")
+		}
+	})
+}
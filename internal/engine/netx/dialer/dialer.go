@@ -33,6 +33,13 @@ type Config struct {
 	// set, we will not save any dialing event.
 	DialSaver *trace.Saver
 
+	// HappyEyeballs optionally configures dialing using the Happy
+	// Eyeballs algorithm (RFC8305). By default we try each address in
+	// sequence, which is deterministic and therefore what we want
+	// when measuring. You should enable this setting for session
+	// traffic, where we only care about connecting quickly.
+	HappyEyeballs bool
+
 	// Logger is the optional logger. If not set, there
 	// will be no logging from the new dialer.
 	Logger model.DebugLogger
@@ -59,9 +66,13 @@ func New(config *Config, resolver model.Resolver) model.Dialer {
 	if config.ReadWriteSaver != nil {
 		d = &saverConnDialer{Dialer: d, Saver: config.ReadWriteSaver}
 	}
-	d = &netxlite.DialerResolver{
-		Resolver: resolver,
-		Dialer:   d,
+	if config.HappyEyeballs {
+		d = netxlite.NewDialerHappyEyeballsLegacy(config.Logger, resolver, d)
+	} else {
+		d = &netxlite.DialerResolver{
+			Resolver: resolver,
+			Dialer:   d,
+		}
 	}
 	d = &proxyDialer{ProxyURL: config.ProxyURL, Dialer: d}
 	if config.ContextByteCounting {
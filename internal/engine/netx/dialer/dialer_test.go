@@ -55,3 +55,27 @@ func TestNewCreatesTheExpectedChain(t *testing.T) {
 		t.Fatal("not a DialerSystem")
 	}
 }
+
+func TestNewWithHappyEyeballs(t *testing.T) {
+	saver := &trace.Saver{}
+	dlr := New(&Config{
+		DialSaver:     saver,
+		HappyEyeballs: true,
+		Logger:        log.Log,
+	}, netxlite.DefaultResolver)
+	shd, ok := dlr.(*shapingDialer)
+	if !ok {
+		t.Fatal("not a shapingDialer")
+	}
+	pd, ok := shd.Dialer.(*proxyDialer)
+	if !ok {
+		t.Fatal("not a proxyDialer")
+	}
+	// the happy eyeballs dialer is unexported, so we can only check
+	// that it does not add another logging or error wrapping layer
+	// on top of the chain we already built
+	switch pd.Dialer.(type) {
+	case *netxlite.DialerLogger, *netxlite.ErrorWrapperDialer, *saverDialer:
+		t.Fatalf("unexpected dialer type: %T", pd.Dialer)
+	}
+}
@@ -22,16 +22,26 @@ func (d *saverDialer) DialContext(ctx context.Context, network, address string)
 	conn, err := d.Dialer.DialContext(ctx, network, address)
 	stop := time.Now()
 	d.Saver.Write(trace.Event{
-		Address:  address,
-		Duration: stop.Sub(start),
-		Err:      err,
-		Name:     netxlite.ConnectOperation,
-		Proto:    network,
-		Time:     stop,
+		Address:      address,
+		Duration:     stop.Sub(start),
+		Err:          err,
+		LocalAddress: safeLocalAddress(conn),
+		Name:         netxlite.ConnectOperation,
+		Proto:        network,
+		Time:         stop,
 	})
 	return conn, err
 }
 
+// safeLocalAddress returns the local address of conn or an
+// empty string if conn is nil.
+func safeLocalAddress(conn net.Conn) (out string) {
+	if conn != nil && conn.LocalAddr() != nil {
+		out = conn.LocalAddr().String()
+	}
+	return
+}
+
 // saverConnDialer wraps the returned connection such that we
 // collect all the read/write events that occur.
 type saverConnDialer struct {
@@ -45,12 +55,21 @@ func (d *saverConnDialer) DialContext(ctx context.Context, network, address stri
 	if err != nil {
 		return nil, err
 	}
-	return &saverConn{saver: d.Saver, Conn: conn}, nil
+	return &saverConn{
+		Conn:       conn,
+		network:    network,
+		remoteAddr: address,
+		saver:      d.Saver,
+	}, nil
 }
 
+// saverConn saves read and write events. We save the network and the
+// address we dialed, rather than calling RemoteAddr, which may be nil.
 type saverConn struct {
 	net.Conn
-	saver *trace.Saver
+	network    string
+	remoteAddr string
+	saver      *trace.Saver
 }
 
 func (c *saverConn) Read(p []byte) (int, error) {
@@ -58,12 +77,15 @@ func (c *saverConn) Read(p []byte) (int, error) {
 	count, err := c.Conn.Read(p)
 	stop := time.Now()
 	c.saver.Write(trace.Event{
-		Data:     p[:count],
-		Duration: stop.Sub(start),
-		Err:      err,
-		NumBytes: count,
-		Name:     netxlite.ReadOperation,
-		Time:     stop,
+		Address:      c.remoteAddr,
+		Data:         append([]byte{}, p[:count]...), // the caller may reuse p
+		Duration:     stop.Sub(start),
+		Err:          err,
+		LocalAddress: safeLocalAddress(c.Conn),
+		NumBytes:     count,
+		Name:         netxlite.ReadOperation,
+		Proto:        c.network,
+		Time:         stop,
 	})
 	return count, err
 }
@@ -73,12 +95,15 @@ func (c *saverConn) Write(p []byte) (int, error) {
 	count, err := c.Conn.Write(p)
 	stop := time.Now()
 	c.saver.Write(trace.Event{
-		Data:     p[:count],
-		Duration: stop.Sub(start),
-		Err:      err,
-		NumBytes: count,
-		Name:     netxlite.WriteOperation,
-		Time:     stop,
+		Address:      c.remoteAddr,
+		Data:         append([]byte{}, p[:count]...), // the caller may reuse p
+		Duration:     stop.Sub(start),
+		Err:          err,
+		LocalAddress: safeLocalAddress(c.Conn),
+		NumBytes:     count,
+		Name:         netxlite.WriteOperation,
+		Proto:        c.network,
+		Time:         stop,
 	})
 	return count, err
 }
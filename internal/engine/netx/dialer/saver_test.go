@@ -101,7 +101,7 @@ func TestSaverConnDialerSuccess(t *testing.T) {
 		},
 		Saver: saver,
 	}
-	conn, err := dlr.DialContext(context.Background(), "tcp", "www.google.com:443")
+	conn, err := dlr.DialContext(context.Background(), "tcp", "8.8.8.8:443")
 	if err != nil {
 		t.Fatal("not the error we expected", err)
 	}
@@ -131,9 +131,21 @@ func saverCheckConnectEvent(t *testing.T, ev *trace.Event) {
 }
 
 func saverCheckReadEvent(t *testing.T, ev *trace.Event) {
-	// TODO(bassosimone): implement
+	saverCheckConnAddresses(t, ev)
 }
 
 func saverCheckWriteEvent(t *testing.T, ev *trace.Event) {
-	// TODO(bassosimone): implement
+	saverCheckConnAddresses(t, ev)
+}
+
+func saverCheckConnAddresses(t *testing.T, ev *trace.Event) {
+	if ev.Address != "8.8.8.8:443" {
+		t.Fatal("unexpected Address", ev.Address)
+	}
+	if ev.LocalAddress != ":12345" {
+		t.Fatal("unexpected LocalAddress", ev.LocalAddress)
+	}
+	if ev.Proto != "tcp" {
+		t.Fatal("unexpected Proto", ev.Proto)
+	}
 }
@@ -11,10 +11,10 @@
 // By default, this library uses the system resolver. In addition, it
 // is possible to configure alternative DNS transports and remote
 // servers. We support DNS over UDP, DNS over TCP, DNS over TLS (DoT),
-// and DNS over HTTPS (DoH). When using an alternative transport, we
-// are also able to intercept and save DNS messages, as well as any
-// other interaction with the remote server (e.g., the result of the
-// TLS handshake for DoT and DoH).
+// DNS over HTTPS (DoH), and DNS over QUIC (DoQ). When using an alternative
+// transport, we are also able to intercept and save DNS messages, as well
+// as any other interaction with the remote server (e.g., the result of the
+// TLS handshake for DoT and DoH, or the QUIC handshake for DoQ).
 //
 // We described the design and implementation of the most recent version of
 // this package at <https://github.com/ooni/probe-engine/issues/359>. Such
@@ -29,6 +29,7 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/ooni/probe-cli/v3/internal/bytecounter"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/dialer"
@@ -47,27 +48,33 @@ import (
 // We use different savers for different kind of events such that the
 // user of this library can choose what to save.
 type Config struct {
-	BaseResolver        model.Resolver       // default: system resolver
-	BogonIsError        bool                 // default: bogon is not error
-	ByteCounter         *bytecounter.Counter // default: no explicit byte counting
-	CacheResolutions    bool                 // default: no caching
-	CertPool            *x509.CertPool       // default: use vendored gocertifi
-	ContextByteCounting bool                 // default: no implicit byte counting
-	DNSCache            map[string][]string  // default: cache is empty
-	DialSaver           *trace.Saver         // default: not saving dials
-	Dialer              model.Dialer         // default: dialer.DNSDialer
-	FullResolver        model.Resolver       // default: base resolver + goodies
-	QUICDialer          model.QUICDialer     // default: quicdialer.DNSDialer
-	HTTP3Enabled        bool                 // default: disabled
-	HTTPSaver           *trace.Saver         // default: not saving HTTP
-	Logger              model.DebugLogger    // default: no logging
-	NoTLSVerify         bool                 // default: perform TLS verify
-	ProxyURL            *url.URL             // default: no proxy
-	ReadWriteSaver      *trace.Saver         // default: not saving read/write
-	ResolveSaver        *trace.Saver         // default: not saving resolves
-	TLSConfig           *tls.Config          // default: attempt using h2
-	TLSDialer           model.TLSDialer      // default: dialer.TLSDialer
-	TLSSaver            *trace.Saver         // default: not saving TLS
+	BaseResolver        model.Resolver           // default: system resolver
+	BogonIsError        bool                     // default: bogon is not error
+	ByteCounter         *bytecounter.Counter     // default: no explicit byte counting
+	CacheResolutions    bool                     // default: no caching
+	CacheResolutionsTTL bool                     // default: no TTL-aware caching
+	CertPool            *x509.CertPool           // default: use vendored gocertifi
+	ContextByteCounting bool                     // default: no implicit byte counting
+	DNSCache            map[string][]string      // default: cache is empty
+	DNSDuplicatesWindow time.Duration            // default: do not collect duplicate UDP responses
+	DNSQueryOptions     *model.DNSQueryOptions   // default: netxlite's EDNS0 policy
+	DialSaver           *trace.Saver             // default: not saving dials
+	Dialer              model.Dialer             // default: dialer.DNSDialer
+	FullResolver        model.Resolver           // default: base resolver + goodies
+	HappyEyeballs       bool                     // default: dial addresses sequentially
+	QUICDialer          model.QUICDialer         // default: quicdialer.DNSDialer
+	HTTP3Enabled        bool                     // default: disabled
+	HTTPSaver           *trace.Saver             // default: not saving HTTP
+	Logger              model.DebugLogger        // default: no logging
+	NoTLSVerify         bool                     // default: perform TLS verify
+	ProxyURL            *url.URL                 // default: no proxy
+	ReadWriteSaver      *trace.Saver             // default: not saving read/write
+	ResolveSaver        *trace.Saver             // default: not saving resolves
+	TLSConfig           *tls.Config              // default: attempt using h2
+	TLSDialer           model.TLSDialer          // default: dialer.TLSDialer
+	TLSFingerprint      string                   // default: use the crypto/tls ClientHello
+	TLSSaver            *trace.Saver             // default: not saving TLS
+	TLSSplit            *netxlite.TLSSplitConfig // default: do not split the ClientHello
 }
 
 type tlsHandshaker interface {
@@ -75,7 +82,16 @@ type tlsHandshaker interface {
 		net.Conn, tls.ConnectionState, error)
 }
 
-var defaultCertPool *x509.CertPool = netxlite.NewDefaultCertPool()
+// tlsHandshakerFailing is a tlsHandshaker that always fails.
+type tlsHandshakerFailing struct {
+	err error
+}
+
+// Handshake implements tlsHandshaker.Handshake.
+func (h tlsHandshakerFailing) Handshake(ctx context.Context, conn net.Conn,
+	config *tls.Config) (net.Conn, tls.ConnectionState, error) {
+	return nil, tls.ConnectionState{}, h.err
+}
 
 // NewResolver creates a new resolver from the specified config
 func NewResolver(config Config) model.Resolver {
@@ -83,6 +99,9 @@ func NewResolver(config Config) model.Resolver {
 		config.BaseResolver = &netxlite.ResolverSystem{}
 	}
 	var r model.Resolver = config.BaseResolver
+	if config.CacheResolutionsTTL {
+		r = netxlite.NewCachingResolver(r)
+	}
 	r = &netxlite.AddressResolver{
 		Resolver: r,
 	}
@@ -120,6 +139,7 @@ func NewDialer(config Config) model.Dialer {
 	return dialer.New(&dialer.Config{
 		ContextByteCounting: config.ContextByteCounting,
 		DialSaver:           config.DialSaver,
+		HappyEyeballs:       config.HappyEyeballs,
 		Logger:              config.Logger,
 		ProxyURL:            config.ProxyURL,
 		ReadWriteSaver:      config.ReadWriteSaver,
@@ -160,22 +180,35 @@ func NewTLSDialer(config Config) model.TLSDialer {
 	if config.Dialer == nil {
 		config.Dialer = NewDialer(config)
 	}
-	var h tlsHandshaker = &netxlite.TLSHandshakerConfigurable{}
+	var h tlsHandshaker
+	newConn, err := netxlite.NewConnForTLSFingerprint(config.TLSFingerprint)
+	if err != nil {
+		// Callers should validate the fingerprint (e.g., urlgetter does that
+		// when building its configuration), so we end up here only because
+		// of a programming error. Fail every handshake rather than panicking.
+		h = tlsHandshakerFailing{err: err}
+	} else {
+		h = &netxlite.TLSHandshakerConfigurable{NewConn: newConn}
+	}
+	if config.TLSSplit != nil {
+		h = netxlite.WrapTLSHandshakerSplit(h, config.TLSSplit)
+	}
 	h = &netxlite.ErrorWrapperTLSHandshaker{TLSHandshaker: h}
 	if config.Logger != nil {
 		h = &netxlite.TLSHandshakerLogger{DebugLogger: config.Logger, TLSHandshaker: h}
 	}
 	if config.TLSSaver != nil {
-		h = tlsdialer.SaverTLSHandshaker{TLSHandshaker: h, Saver: config.TLSSaver}
+		h = tlsdialer.SaverTLSHandshaker{
+			TLSHandshaker: h,
+			Fingerprint:   config.TLSFingerprint,
+			Saver:         config.TLSSaver,
+			Split:         config.TLSSplit,
+		}
 	}
 	if config.TLSConfig == nil {
 		config.TLSConfig = &tls.Config{NextProtos: []string{"h2", "http/1.1"}}
 	}
-	if config.CertPool == nil {
-		config.CertPool = defaultCertPool
-	}
-	config.TLSConfig.RootCAs = config.CertPool
-	config.TLSConfig.InsecureSkipVerify = config.NoTLSVerify
+	applyCertPoolAndNoTLSVerify(&config)
 	return &netxlite.TLSDialerLegacy{
 		Config:        config.TLSConfig,
 		Dialer:        config.Dialer,
@@ -183,6 +216,18 @@ func NewTLSDialer(config Config) model.TLSDialer {
 	}
 }
 
+// applyCertPoolAndNoTLSVerify sets the RootCAs and InsecureSkipVerify
+// fields of config.TLSConfig, which MUST NOT be nil, according to the
+// config.CertPool (default: netxlite.DefaultCertPool()) and the
+// config.NoTLSVerify settings.
+func applyCertPoolAndNoTLSVerify(config *Config) {
+	if config.CertPool == nil {
+		config.CertPool = netxlite.DefaultCertPool()
+	}
+	config.TLSConfig.RootCAs = config.CertPool
+	config.TLSConfig.InsecureSkipVerify = config.NoTLSVerify
+}
+
 // NewHTTPTransport creates a new HTTPRoundTripper. You can further extend the returned
 // HTTPRoundTripper before wrapping it into an http.Client.
 func NewHTTPTransport(config Config) model.HTTPTransport {
@@ -197,6 +242,9 @@ func NewHTTPTransport(config Config) model.HTTPTransport {
 	}
 
 	tInfo := allTransportsInfo[config.HTTP3Enabled]
+	if !config.HTTP3Enabled && usesTLSParroting(config) {
+		tInfo = parrotingTransportInfo
+	}
 	txp := tInfo.Factory(httptransport.Config{
 		Dialer: config.Dialer, QUICDialer: config.QUICDialer, TLSDialer: config.TLSDialer,
 		TLSConfig: config.TLSConfig})
@@ -236,6 +284,24 @@ var allTransportsInfo = map[bool]httpTransportInfo{
 	},
 }
 
+// parrotingTransportInfo is the transport we use when we are parroting
+// a TLS ClientHello. The parrots always offer HTTP/2 via ALPN and the
+// stdlib only speaks HTTP/2 over crypto/tls connections, so we need to
+// use netxlite's transport, which is based on ooni/oohttp.
+var parrotingTransportInfo = httpTransportInfo{
+	Factory: func(config httptransport.Config) model.HTTPTransport {
+		return netxlite.NewOOHTTPBaseTransport(config.Dialer, config.TLSDialer)
+	},
+	TransportName: "tcp",
+}
+
+// usesTLSParroting returns whether the config requires us to
+// parrot a TLS ClientHello rather than using crypto/tls.
+func usesTLSParroting(config Config) bool {
+	newConn, _ := netxlite.NewConnForTLSFingerprint(config.TLSFingerprint)
+	return newConn != nil
+}
+
 // NewDNSClient creates a new DNS client. The config argument is used to
 // create the underlying Dialer and/or HTTP transport, if needed. The URL
 // argument describes the kind of client that we want to make:
@@ -249,6 +315,10 @@ var allTransportsInfo = map[bool]httpTransportInfo{
 // - if the URL starts with `udp://`, then we create a client using
 // a resolver that uses the specified UDP endpoint.
 //
+// - if the URL starts with `tcp://`, `dot://` or `doq://`, then we
+// create a client using, respectively, DNS-over-TCP, DNS-over-TLS
+// or DNS-over-QUIC with the specified endpoint.
+//
 // We return error if the URL does not parse or the URL scheme does not
 // fall into one of the cases described above.
 //
@@ -258,6 +328,14 @@ func NewDNSClient(config Config, URL string) (model.Resolver, error) {
 	return NewDNSClientWithOverrides(config, URL, "", "", "")
 }
 
+// newParallelResolver creates a new parallel resolver using the
+// given transport and the EDNS0 options inside config.
+func newParallelResolver(config Config, txp model.DNSTransport) *netxlite.ParallelResolver {
+	reso := netxlite.NewParallelResolver(txp)
+	reso.QueryOptions = config.DNSQueryOptions
+	return reso
+}
+
 // NewDNSClientWithOverrides creates a new DNS client, similar to NewDNSClient,
 // with the option to override the default Hostname and SNI.
 func NewDNSClientWithOverrides(config Config, URL, hostOverride, SNIOverride,
@@ -294,13 +372,24 @@ func NewDNSClientWithOverrides(config Config, URL, hostOverride, SNIOverride,
 				Saver:        config.ResolveSaver,
 			}
 		}
-		return netxlite.NewSerialResolver(txp), nil
+		return newParallelResolver(config, txp), nil
 	case "udp":
 		dialer := NewDialer(config)
 		endpoint, err := makeValidEndpoint(resolverURL)
 		if err != nil {
 			return nil, err
 		}
+		if config.DNSDuplicatesWindow > 0 {
+			var txp model.DNSTransportWithDuplicates = netxlite.NewDNSOverUDPWithDuplicates(
+				dialer, endpoint, config.DNSDuplicatesWindow)
+			if config.ResolveSaver != nil {
+				return newParallelResolver(config, resolver.SaverDNSTransportWithDuplicates{
+					DNSTransportWithDuplicates: txp,
+					Saver:                      config.ResolveSaver,
+				}), nil
+			}
+			return newParallelResolver(config, txp), nil
+		}
 		var txp model.DNSTransport = netxlite.NewDNSOverUDP(
 			dialer, endpoint)
 		if config.ResolveSaver != nil {
@@ -309,7 +398,7 @@ func NewDNSClientWithOverrides(config Config, URL, hostOverride, SNIOverride,
 				Saver:        config.ResolveSaver,
 			}
 		}
-		return netxlite.NewSerialResolver(txp), nil
+		return newParallelResolver(config, txp), nil
 	case "dot":
 		config.TLSConfig.NextProtos = []string{"dot"}
 		tlsDialer := NewTLSDialer(config)
@@ -325,7 +414,23 @@ func NewDNSClientWithOverrides(config Config, URL, hostOverride, SNIOverride,
 				Saver:        config.ResolveSaver,
 			}
 		}
-		return netxlite.NewSerialResolver(txp), nil
+		return newParallelResolver(config, txp), nil
+	case "doq":
+		applyCertPoolAndNoTLSVerify(&config)
+		quicDialer := NewQUICDialer(config)
+		endpoint, err := makeValidEndpoint(resolverURL)
+		if err != nil {
+			return nil, err
+		}
+		var txp model.DNSTransport = netxlite.NewDNSOverQUICWithTLSConfig(
+			quicDialer, endpoint, config.TLSConfig)
+		if config.ResolveSaver != nil {
+			txp = resolver.SaverDNSTransport{
+				DNSTransport: txp,
+				Saver:        config.ResolveSaver,
+			}
+		}
+		return newParallelResolver(config, txp), nil
 	case "tcp":
 		dialer := NewDialer(config)
 		endpoint, err := makeValidEndpoint(resolverURL)
@@ -340,17 +445,17 @@ func NewDNSClientWithOverrides(config Config, URL, hostOverride, SNIOverride,
 				Saver:        config.ResolveSaver,
 			}
 		}
-		return netxlite.NewSerialResolver(txp), nil
+		return newParallelResolver(config, txp), nil
 	default:
 		return nil, errors.New("unsupported resolver scheme")
 	}
 }
 
-// makeValidEndpoint makes a valid endpoint for DoT and Do53 given the
-// input URL representing such endpoint. Specifically, we are
+// makeValidEndpoint makes a valid endpoint for DoT, DoQ and Do53 given
+// the input URL representing such endpoint. Specifically, we are
 // concerned with the case where the port is missing. In such a
 // case, we ensure that we are using the default port 853 for DoT
-// and default port 53 for TCP and UDP.
+// and DoQ and default port 53 for TCP and UDP.
 func makeValidEndpoint(URL *url.URL) (string, error) {
 	// Implementation note: when we're using a quoted IPv6
 	// address, URL.Host contains the quotes but instead the
@@ -384,7 +489,7 @@ func makeValidEndpoint(URL *url.URL) (string, error) {
 	// For this reason we check again whether we can split it using
 	// net.SplitHostPort. If we cannot, we were in case four.
 	host := URL.Host
-	if URL.Scheme == "dot" {
+	if URL.Scheme == "dot" || URL.Scheme == "doq" {
 		host += ":853"
 	} else {
 		host += ":53"
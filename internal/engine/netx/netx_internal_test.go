@@ -1,8 +1,39 @@
 package netx
 
-import "crypto/x509"
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
 
 // DefaultCertPool allows tests to access the default cert pool.
 func DefaultCertPool() *x509.CertPool {
-	return defaultCertPool
+	return netxlite.DefaultCertPool()
+}
+
+func TestApplyCertPoolAndNoTLSVerify(t *testing.T) {
+	t.Run("with the default settings", func(t *testing.T) {
+		config := &Config{TLSConfig: &tls.Config{}}
+		applyCertPoolAndNoTLSVerify(config)
+		if config.TLSConfig.RootCAs != netxlite.DefaultCertPool() {
+			t.Fatal("not the RootCAs we expected")
+		}
+		if config.TLSConfig.InsecureSkipVerify {
+			t.Fatal("expected InsecureSkipVerify to be false")
+		}
+	})
+
+	t.Run("with custom settings", func(t *testing.T) {
+		pool := x509.NewCertPool()
+		config := &Config{CertPool: pool, NoTLSVerify: true, TLSConfig: &tls.Config{}}
+		applyCertPoolAndNoTLSVerify(config)
+		if config.TLSConfig.RootCAs != pool {
+			t.Fatal("not the RootCAs we expected")
+		}
+		if !config.TLSConfig.InsecureSkipVerify {
+			t.Fatal("expected InsecureSkipVerify to be true")
+		}
+	})
 }
@@ -6,8 +6,10 @@ import (
 	"errors"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/apex/log"
 	"github.com/ooni/probe-cli/v3/internal/bytecounter"
@@ -178,6 +180,32 @@ func TestNewResolverWithReadWriteCache(t *testing.T) {
 	}
 }
 
+func TestNewResolverWithTTLCaching(t *testing.T) {
+	r := netx.NewResolver(netx.Config{
+		CacheResolutionsTTL: true,
+	})
+	ir, ok := r.(*netxlite.ResolverIDNA)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	ewr, ok := ir.Resolver.(*netxlite.ErrorWrapperResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	ar, ok := ewr.Resolver.(*netxlite.AddressResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	cr, ok := ar.Resolver.(*netxlite.CachingResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	_, ok = cr.Resolver.(*netxlite.ResolverSystem)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+}
+
 func TestNewResolverWithPrefilledReadonlyCache(t *testing.T) {
 	r := netx.NewResolver(netx.Config{
 		DNSCache: map[string][]string{
@@ -350,6 +378,82 @@ func TestNewTLSDialerWithSaver(t *testing.T) {
 	}
 }
 
+func TestNewTLSDialerWithTLSSplit(t *testing.T) {
+	saver := new(trace.Saver)
+	split := &netxlite.TLSSplitConfig{Strategy: netxlite.TLSSplitSNISegments}
+	td := netx.NewTLSDialer(netx.Config{
+		TLSSaver: saver,
+		TLSSplit: split,
+	})
+	rtd, ok := td.(*netxlite.TLSDialerLegacy)
+	if !ok {
+		t.Fatal("not the TLSDialer we expected")
+	}
+	sth, ok := rtd.TLSHandshaker.(tlsdialer.SaverTLSHandshaker)
+	if !ok {
+		t.Fatal("not the TLSHandshaker we expected")
+	}
+	if sth.Split != split {
+		t.Fatal("not the TLSSplitConfig we expected")
+	}
+	ewth, ok := sth.TLSHandshaker.(*netxlite.ErrorWrapperTLSHandshaker)
+	if !ok {
+		t.Fatal("not the TLSHandshaker we expected")
+	}
+	if _, ok := ewth.TLSHandshaker.(*netxlite.TLSHandshakerConfigurable); ok {
+		t.Fatal("expected the TLSHandshakerConfigurable to be wrapped")
+	}
+}
+
+func TestNewTLSDialerWithTLSFingerprint(t *testing.T) {
+	t.Run("with a valid fingerprint", func(t *testing.T) {
+		saver := new(trace.Saver)
+		td := netx.NewTLSDialer(netx.Config{
+			TLSFingerprint: netxlite.TLSFingerprintChrome,
+			TLSSaver:       saver,
+		})
+		rtd, ok := td.(*netxlite.TLSDialerLegacy)
+		if !ok {
+			t.Fatal("not the TLSDialer we expected")
+		}
+		sth, ok := rtd.TLSHandshaker.(tlsdialer.SaverTLSHandshaker)
+		if !ok {
+			t.Fatal("not the TLSHandshaker we expected")
+		}
+		if sth.Fingerprint != netxlite.TLSFingerprintChrome {
+			t.Fatal("not the Fingerprint we expected")
+		}
+		ewth, ok := sth.TLSHandshaker.(*netxlite.ErrorWrapperTLSHandshaker)
+		if !ok {
+			t.Fatal("not the TLSHandshaker we expected")
+		}
+		configurable, ok := ewth.TLSHandshaker.(*netxlite.TLSHandshakerConfigurable)
+		if !ok {
+			t.Fatal("not the TLSHandshaker we expected")
+		}
+		if configurable.NewConn == nil {
+			t.Fatal("expected non-nil NewConn")
+		}
+	})
+
+	t.Run("with an invalid fingerprint", func(t *testing.T) {
+		td := netx.NewTLSDialer(netx.Config{TLSFingerprint: "antani"})
+		conn := &mocks.Conn{
+			MockClose: func() error {
+				return nil
+			},
+		}
+		rtd := td.(*netxlite.TLSDialerLegacy)
+		tlsConn, _, err := rtd.TLSHandshaker.Handshake(context.Background(), conn, &tls.Config{})
+		if !errors.Is(err, netxlite.ErrUnknownTLSFingerprint) {
+			t.Fatal("not the error we expected", err)
+		}
+		if tlsConn != nil {
+			t.Fatal("expected nil conn")
+		}
+	})
+}
+
 func TestNewTLSDialerWithNoTLSVerifyAndConfig(t *testing.T) {
 	td := netx.NewTLSDialer(netx.Config{
 		TLSConfig:   new(tls.Config),
@@ -425,6 +529,53 @@ func TestNewVanilla(t *testing.T) {
 	}
 }
 
+func TestNewWithTLSFingerprint(t *testing.T) {
+	t.Run("when parroting", func(t *testing.T) {
+		txp := netx.NewHTTPTransport(netx.Config{
+			TLSFingerprint: netxlite.TLSFingerprintFirefox,
+		})
+		if _, ok := txp.(*httptransport.SystemTransportWrapper); ok {
+			t.Fatal("not the transport we expected")
+		}
+	})
+
+	t.Run("when using crypto/tls", func(t *testing.T) {
+		txp := netx.NewHTTPTransport(netx.Config{
+			TLSFingerprint: netxlite.TLSFingerprintGo,
+		})
+		if _, ok := txp.(*httptransport.SystemTransportWrapper); !ok {
+			t.Fatal("not the transport we expected")
+		}
+	})
+
+	t.Run("we can speak HTTP/2 when parroting", func(t *testing.T) {
+		srvr := httptest.NewUnstartedServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(r.Proto))
+			}))
+		srvr.EnableHTTP2 = true
+		srvr.StartTLS()
+		defer srvr.Close()
+		txp := netx.NewHTTPTransport(netx.Config{
+			NoTLSVerify:    true,
+			TLSFingerprint: netxlite.TLSFingerprintChrome,
+		})
+		client := &http.Client{Transport: txp}
+		resp, err := client.Get(srvr.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, err := netxlite.ReadAllContext(context.Background(), resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "HTTP/2.0" {
+			t.Fatal("unexpected protocol", string(data))
+		}
+	})
+}
+
 func TestNewWithDialer(t *testing.T) {
 	expected := errors.New("mocked error")
 	dialer := netx.FakeDialer{Err: expected}
@@ -582,7 +733,7 @@ func TestNewDNSClientPowerdnsDoH(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	r, ok := dnsclient.(*netxlite.SerialResolver)
+	r, ok := dnsclient.(*netxlite.ParallelResolver)
 	if !ok {
 		t.Fatal("not the resolver we expected")
 	}
@@ -598,7 +749,7 @@ func TestNewDNSClientGoogleDoH(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	r, ok := dnsclient.(*netxlite.SerialResolver)
+	r, ok := dnsclient.(*netxlite.ParallelResolver)
 	if !ok {
 		t.Fatal("not the resolver we expected")
 	}
@@ -614,7 +765,7 @@ func TestNewDNSClientCloudflareDoH(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	r, ok := dnsclient.(*netxlite.SerialResolver)
+	r, ok := dnsclient.(*netxlite.ParallelResolver)
 	if !ok {
 		t.Fatal("not the resolver we expected")
 	}
@@ -631,7 +782,7 @@ func TestNewDNSClientCloudflareDoHSaver(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	r, ok := dnsclient.(*netxlite.SerialResolver)
+	r, ok := dnsclient.(*netxlite.ParallelResolver)
 	if !ok {
 		t.Fatal("not the resolver we expected")
 	}
@@ -651,7 +802,7 @@ func TestNewDNSClientUDP(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	r, ok := dnsclient.(*netxlite.SerialResolver)
+	r, ok := dnsclient.(*netxlite.ParallelResolver)
 	if !ok {
 		t.Fatal("not the resolver we expected")
 	}
@@ -668,7 +819,7 @@ func TestNewDNSClientUDPDNSSaver(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	r, ok := dnsclient.(*netxlite.SerialResolver)
+	r, ok := dnsclient.(*netxlite.ParallelResolver)
 	if !ok {
 		t.Fatal("not the resolver we expected")
 	}
@@ -682,13 +833,52 @@ func TestNewDNSClientUDPDNSSaver(t *testing.T) {
 	dnsclient.CloseIdleConnections()
 }
 
+func TestNewDNSClientUDPWithDuplicates(t *testing.T) {
+	dnsclient, err := netx.NewDNSClient(
+		netx.Config{DNSDuplicatesWindow: time.Second}, "udp://8.8.8.8:53")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, ok := dnsclient.(*netxlite.ParallelResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	if _, ok := r.Transport().(*netxlite.DNSOverUDP); !ok {
+		t.Fatal("not the transport we expected")
+	}
+	dnsclient.CloseIdleConnections()
+}
+
+func TestNewDNSClientUDPWithDuplicatesDNSSaver(t *testing.T) {
+	saver := new(trace.Saver)
+	dnsclient, err := netx.NewDNSClient(netx.Config{
+		DNSDuplicatesWindow: time.Second,
+		ResolveSaver:        saver,
+	}, "udp://8.8.8.8:53")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, ok := dnsclient.(*netxlite.ParallelResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	txp, ok := r.Transport().(resolver.SaverDNSTransportWithDuplicates)
+	if !ok {
+		t.Fatal("not the transport we expected")
+	}
+	if _, ok := txp.DNSTransportWithDuplicates.(*netxlite.DNSOverUDP); !ok {
+		t.Fatal("not the transport we expected")
+	}
+	dnsclient.CloseIdleConnections()
+}
+
 func TestNewDNSClientTCP(t *testing.T) {
 	dnsclient, err := netx.NewDNSClient(
 		netx.Config{}, "tcp://8.8.8.8:53")
 	if err != nil {
 		t.Fatal(err)
 	}
-	r, ok := dnsclient.(*netxlite.SerialResolver)
+	r, ok := dnsclient.(*netxlite.ParallelResolver)
 	if !ok {
 		t.Fatal("not the resolver we expected")
 	}
@@ -709,7 +899,7 @@ func TestNewDNSClientTCPDNSSaver(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	r, ok := dnsclient.(*netxlite.SerialResolver)
+	r, ok := dnsclient.(*netxlite.ParallelResolver)
 	if !ok {
 		t.Fatal("not the resolver we expected")
 	}
@@ -733,7 +923,7 @@ func TestNewDNSClientDoT(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	r, ok := dnsclient.(*netxlite.SerialResolver)
+	r, ok := dnsclient.(*netxlite.ParallelResolver)
 	if !ok {
 		t.Fatal("not the resolver we expected")
 	}
@@ -754,7 +944,7 @@ func TestNewDNSClientDoTDNSSaver(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	r, ok := dnsclient.(*netxlite.SerialResolver)
+	r, ok := dnsclient.(*netxlite.ParallelResolver)
 	if !ok {
 		t.Fatal("not the resolver we expected")
 	}
@@ -772,6 +962,70 @@ func TestNewDNSClientDoTDNSSaver(t *testing.T) {
 	dnsclient.CloseIdleConnections()
 }
 
+func TestNewDNSClientDoQ(t *testing.T) {
+	dnsclient, err := netx.NewDNSClient(
+		netx.Config{}, "doq://94.140.14.14:853")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, ok := dnsclient.(*netxlite.ParallelResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	txp, ok := r.Transport().(*netxlite.DNSOverQUIC)
+	if !ok {
+		t.Fatal("not the transport we expected")
+	}
+	if txp.Network() != "doq" {
+		t.Fatal("not the Network we expected")
+	}
+	dnsclient.CloseIdleConnections()
+}
+
+func TestNewDNSClientDoQDNSSaver(t *testing.T) {
+	saver := new(trace.Saver)
+	dnsclient, err := netx.NewDNSClient(
+		netx.Config{ResolveSaver: saver}, "doq://94.140.14.14:853")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, ok := dnsclient.(*netxlite.ParallelResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	txp, ok := r.Transport().(resolver.SaverDNSTransport)
+	if !ok {
+		t.Fatal("not the transport we expected")
+	}
+	doq, ok := txp.DNSTransport.(*netxlite.DNSOverQUIC)
+	if !ok {
+		t.Fatal("not the transport we expected")
+	}
+	if doq.Network() != "doq" {
+		t.Fatal("not the Network we expected")
+	}
+	dnsclient.CloseIdleConnections()
+}
+
+func TestNewDNSCLientDoQWithoutPort(t *testing.T) {
+	c, err := netx.NewDNSClientWithOverrides(
+		netx.Config{}, "doq://94.140.14.14", "", "dns.adguard.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Address() != "94.140.14.14:853" {
+		t.Fatal("expected default port to be added")
+	}
+}
+
+func TestNewDNSClientBadDoQEndpoint(t *testing.T) {
+	_, err := netx.NewDNSClient(
+		netx.Config{}, "doq://bad:endpoint:853")
+	if err == nil || !strings.Contains(err.Error(), "too many colons in address") {
+		t.Fatal("expected error with bad endpoint")
+	}
+}
+
 func TestNewDNSCLientDoTWithoutPort(t *testing.T) {
 	c, err := netx.NewDNSClientWithOverrides(
 		netx.Config{}, "dot://8.8.8.8", "", "8.8.8.8", "")
@@ -0,0 +1,466 @@
+// Package pcapng writes the network events saved by a trace.Saver in
+// the pcapng format, so that you can open them using Wireshark. You can
+// also write the network events saved by an archival.Saver by converting
+// them using NewEventsFromArchivalTrace.
+//
+// The saver only sees the logical flows (i.e., connect, read, write,
+// read_from and write_to events along with their payloads and timings)
+// rather than the actual packets. Therefore, we synthesize the packets:
+// we emit the TCP three-way handshake when a connect succeeds, a SYN
+// when it fails, TCP segments carrying the bytes read and written with
+// consistent sequence and acknowledgement numbers, a FIN or a RST when
+// a read fails with EOF or a connection reset, and a UDP datagram for
+// each datagram read or written. Because the packets are synthesized,
+// the capture does not contain retransmissions, window updates, etc.
+//
+// We use the raw IP link type, which allows us to mix IPv4 and IPv6
+// packets in the same capture. When we do not know the local address
+// (e.g., for a failed connect), we use the unspecified address.
+//
+// See https://datatracker.ietf.org/doc/draft-ietf-opsawg-pcapng/.
+package pcapng
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ooni/probe-cli/v3/internal/archival"
+	"github.com/ooni/probe-cli/v3/internal/engine/netx/trace"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+// Writer writes trace events in pcapng format.
+//
+// You MUST use NewWriter to create a new instance.
+type Writer struct {
+	// flows contains the state of the TCP flows.
+	flows map[string]*tcpFlow
+
+	// ipID is the ID of the next IPv4 packet.
+	ipID uint16
+
+	// w is the underlying writer.
+	w io.Writer
+
+	// wroteHeader indicates whether we wrote the section header
+	// and the interface description blocks.
+	wroteHeader bool
+}
+
+// NewWriter creates a new Writer writing to w. We write the header
+// of the capture the first time you call WriteEvents.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		flows: map[string]*tcpFlow{},
+		w:     w,
+	}
+}
+
+// WriteEvents synthesizes packets for the given events and writes them.
+func (w *Writer) WriteEvents(events []trace.Event) error {
+	if !w.wroteHeader {
+		if err := w.writeHeader(); err != nil {
+			return err
+		}
+		w.wroteHeader = true
+	}
+	var packets []*packet
+	for _, ev := range events {
+		packets = append(packets, w.synthesize(&ev)...)
+	}
+	sort.SliceStable(packets, func(i, j int) bool {
+		return packets[i].t.Before(packets[j].t)
+	})
+	for _, pkt := range packets {
+		if err := w.writePacket(pkt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendMu serializes the writes performed by AppendFile.
+var appendMu sync.Mutex
+
+// AppendFile appends the packets synthesized for the given events to the
+// given pcapng file, creating it if needed. It is safe to call this function
+// from several goroutines (e.g., to save several measurements to a file).
+func AppendFile(path string, events []trace.Event) error {
+	appendMu.Lock()
+	defer appendMu.Unlock()
+	filep, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := filep.Stat()
+	if err != nil {
+		filep.Close()
+		return err
+	}
+	w := NewWriter(filep)
+	w.wroteHeader = info.Size() > 0
+	if err := w.WriteEvents(events); err != nil {
+		filep.Close()
+		return err
+	}
+	return filep.Close()
+}
+
+// NewEventsFromArchivalTrace converts the network events inside the
+// given archival.Trace to events you can pass to WriteEvents or AppendFile.
+func NewEventsFromArchivalTrace(tr *archival.Trace) (out []trace.Event) {
+	for _, ev := range tr.Network {
+		out = append(out, trace.Event{
+			Address:      ev.RemoteAddr,
+			Data:         ev.Data,
+			Duration:     ev.Finished.Sub(ev.Started),
+			Err:          ev.Failure,
+			LocalAddress: ev.LocalAddr,
+			Name:         ev.Operation,
+			NumBytes:     ev.Count,
+			Proto:        ev.Network,
+			Time:         ev.Finished,
+		})
+	}
+	return
+}
+
+//
+// Packets synthesis
+//
+
+// packet is a synthesized packet.
+type packet struct {
+	comment string
+	data    []byte
+	t       time.Time
+}
+
+// endpoint is a TCP or UDP endpoint.
+type endpoint struct {
+	ip   net.IP
+	port uint16
+}
+
+// newEndpoint parses an endpoint. When the address is empty, or the IP
+// is missing, we use the unspecified address of the family of peer.
+func newEndpoint(address string, peer *endpoint) *endpoint {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		host, port = "", "0"
+	}
+	out := &endpoint{}
+	if portnum, err := strconv.ParseUint(port, 10, 16); err == nil {
+		out.port = uint16(portnum)
+	}
+	out.ip = net.ParseIP(host)
+	if out.ip == nil || (peer != nil && (out.ip.To4() == nil) != (peer.ip.To4() == nil)) {
+		out.ip = net.IPv4zero
+		if peer != nil && peer.ip.To4() == nil {
+			out.ip = net.IPv6unspecified
+		}
+	}
+	return out
+}
+
+// tcpFlow is the state of a TCP flow.
+type tcpFlow struct {
+	local, remote *endpoint
+	localSeq      uint32
+	remoteSeq     uint32
+}
+
+// The TCP flags we use.
+const (
+	tcpFIN = 1 << 0
+	tcpSYN = 1 << 1
+	tcpRST = 1 << 2
+	tcpPSH = 1 << 3
+	tcpACK = 1 << 4
+)
+
+// maxSegmentSize is the maximum size of the synthesized TCP segments.
+const maxSegmentSize = 1460
+
+// flow returns the TCP flow for the given event, creating it if needed.
+func (w *Writer) flow(ev *trace.Event) *tcpFlow {
+	key := ev.LocalAddress + " " + ev.Address
+	if f := w.flows[key]; f != nil {
+		return f
+	}
+	remote := newEndpoint(ev.Address, nil)
+	f := &tcpFlow{
+		local:  newEndpoint(ev.LocalAddress, remote),
+		remote: remote,
+		// Wireshark shows relative sequence numbers by default, so
+		// the actual initial sequence numbers are not important.
+		localSeq:  uint32(len(w.flows)+1) << 20,
+		remoteSeq: uint32(len(w.flows)+1) << 24,
+	}
+	w.flows[key] = f
+	return f
+}
+
+// isTCP returns whether the given network is TCP.
+func isTCP(network string) bool {
+	return network == "tcp" || network == "tcp4" || network == "tcp6"
+}
+
+// failure returns the failure string of the given error or an empty string.
+func failure(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// synthesize returns the packets corresponding to the given event.
+func (w *Writer) synthesize(ev *trace.Event) []*packet {
+	switch ev.Name {
+	case netxlite.ConnectOperation:
+		if isTCP(ev.Proto) {
+			return w.synthesizeConnect(ev)
+		}
+	case netxlite.ReadOperation, netxlite.WriteOperation:
+		if isTCP(ev.Proto) {
+			return w.synthesizeTCPData(ev)
+		}
+		return w.synthesizeUDP(ev, ev.Name == netxlite.ReadOperation)
+	case netxlite.ReadFromOperation:
+		return w.synthesizeUDP(ev, true)
+	case netxlite.WriteToOperation:
+		return w.synthesizeUDP(ev, false)
+	}
+	return nil
+}
+
+// synthesizeConnect synthesizes the TCP three-way handshake.
+func (w *Writer) synthesizeConnect(ev *trace.Event) []*packet {
+	f := w.flow(ev)
+	started := ev.Time.Add(-ev.Duration)
+	syn := w.tcp(started, f, true, tcpSYN, nil)
+	if ev.Err != nil {
+		syn.comment = "connect: " + failure(ev.Err)
+		out := []*packet{syn}
+		if failure(ev.Err) == netxlite.FailureConnectionRefused {
+			out = append(out, w.tcp(ev.Time, f, false, tcpRST|tcpACK, nil))
+		}
+		return out
+	}
+	f.localSeq++ // the SYN consumes a sequence number
+	synack := w.tcp(ev.Time, f, false, tcpSYN|tcpACK, nil)
+	f.remoteSeq++
+	ack := w.tcp(ev.Time, f, true, tcpACK, nil)
+	return []*packet{syn, synack, ack}
+}
+
+// synthesizeTCPData synthesizes the segments carrying the bytes read
+// or written and, possibly, a FIN or RST segment.
+func (w *Writer) synthesizeTCPData(ev *trace.Event) []*packet {
+	f := w.flow(ev)
+	fromLocal := ev.Name == netxlite.WriteOperation
+	var out []*packet
+	for data := ev.Data; len(data) > 0; {
+		count := len(data)
+		if count > maxSegmentSize {
+			count = maxSegmentSize
+		}
+		out = append(out, w.tcp(ev.Time, f, fromLocal, tcpPSH|tcpACK, data[:count]))
+		data = data[count:]
+	}
+	if fromLocal || ev.Err == nil {
+		return out
+	}
+	switch {
+	case errors.Is(ev.Err, io.EOF) || failure(ev.Err) == netxlite.FailureEOFError:
+		out = append(out, w.tcp(ev.Time, f, false, tcpFIN|tcpACK, nil))
+		f.remoteSeq++ // the FIN consumes a sequence number
+	case failure(ev.Err) == netxlite.FailureConnectionReset:
+		out = append(out, w.tcp(ev.Time, f, false, tcpRST|tcpACK, nil))
+	}
+	return out
+}
+
+// synthesizeUDP synthesizes a UDP datagram.
+func (w *Writer) synthesizeUDP(ev *trace.Event, fromRemote bool) []*packet {
+	if len(ev.Data) <= 0 {
+		return nil
+	}
+	remote := newEndpoint(ev.Address, nil)
+	local := newEndpoint(ev.LocalAddress, remote)
+	src, dst := local, remote
+	if fromRemote {
+		src, dst = remote, local
+	}
+	segment := make([]byte, 8, 8+len(ev.Data))
+	binary.BigEndian.PutUint16(segment[0:], src.port)
+	binary.BigEndian.PutUint16(segment[2:], dst.port)
+	binary.BigEndian.PutUint16(segment[4:], uint16(8+len(ev.Data)))
+	segment = append(segment, ev.Data...)
+	return []*packet{{data: w.ip(src.ip, dst.ip, ipProtoUDP, segment, 6), t: ev.Time}}
+}
+
+// tcp synthesizes a TCP segment and advances the sequence numbers.
+func (w *Writer) tcp(t time.Time, f *tcpFlow, fromLocal bool, flags byte, data []byte) *packet {
+	src, dst, seq, ack := f.local, f.remote, &f.localSeq, f.remoteSeq
+	if !fromLocal {
+		src, dst, seq, ack = f.remote, f.local, &f.remoteSeq, f.localSeq
+	}
+	if flags&tcpACK == 0 {
+		ack = 0
+	}
+	segment := make([]byte, 20, 20+len(data))
+	binary.BigEndian.PutUint16(segment[0:], src.port)
+	binary.BigEndian.PutUint16(segment[2:], dst.port)
+	binary.BigEndian.PutUint32(segment[4:], *seq)
+	binary.BigEndian.PutUint32(segment[8:], ack)
+	segment[12] = 5 << 4 // data offset in 32 bit words
+	segment[13] = flags
+	binary.BigEndian.PutUint16(segment[14:], 65535) // window
+	segment = append(segment, data...)
+	*seq += uint32(len(data))
+	return &packet{data: w.ip(src.ip, dst.ip, ipProtoTCP, segment, 16), t: t}
+}
+
+// The IP protocol numbers we use.
+const (
+	ipProtoTCP = 6
+	ipProtoUDP = 17
+)
+
+// ip wraps the given TCP or UDP segment into an IP packet. The checksum
+// argument is the offset of the checksum inside the segment.
+func (w *Writer) ip(src, dst net.IP, proto byte, segment []byte, checksum int) []byte {
+	var pseudo []byte
+	var header []byte
+	if src4, dst4 := src.To4(), dst.To4(); src4 != nil && dst4 != nil {
+		header = make([]byte, 20)
+		header[0] = 0x45 // version and header length
+		binary.BigEndian.PutUint16(header[2:], uint16(20+len(segment)))
+		binary.BigEndian.PutUint16(header[4:], w.ipID)
+		w.ipID++
+		binary.BigEndian.PutUint16(header[6:], 0x4000) // don't fragment
+		header[8] = 64                                 // TTL
+		header[9] = proto
+		copy(header[12:], src4)
+		copy(header[16:], dst4)
+		binary.BigEndian.PutUint16(header[10:], internetChecksum(header))
+		pseudo = append(append(pseudo, src4...), dst4...)
+		pseudo = append(pseudo, 0, proto, byte(len(segment)>>8), byte(len(segment)))
+	} else {
+		header = make([]byte, 40)
+		header[0] = 0x60 // version
+		binary.BigEndian.PutUint16(header[4:], uint16(len(segment)))
+		header[6] = proto
+		header[7] = 64 // hop limit
+		copy(header[8:], src.To16())
+		copy(header[24:], dst.To16())
+		pseudo = append(append(pseudo, src.To16()...), dst.To16()...)
+		pseudo = append(pseudo, 0, 0, byte(len(segment)>>8), byte(len(segment)), 0, 0, 0, proto)
+	}
+	sum := internetChecksum(append(pseudo, segment...))
+	if proto == ipProtoUDP && sum == 0 {
+		sum = 0xffff // zero means no checksum for UDP
+	}
+	binary.BigEndian.PutUint16(segment[checksum:], sum)
+	return append(header, segment...)
+}
+
+// internetChecksum computes the checksum defined by RFC 1071.
+func internetChecksum(data []byte) uint16 {
+	var sum uint32
+	for len(data) >= 2 {
+		sum += uint32(data[0])<<8 | uint32(data[1])
+		data = data[2:]
+	}
+	if len(data) > 0 {
+		sum += uint32(data[0]) << 8
+	}
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+	return ^uint16(sum)
+}
+
+//
+// pcapng blocks
+//
+
+// The pcapng block types we use.
+const (
+	blockTypeSectionHeader        = 0x0A0D0D0A
+	blockTypeInterfaceDescription = 0x00000001
+	blockTypeEnhancedPacket       = 0x00000006
+)
+
+// linkTypeRaw is the raw IP link type.
+const linkTypeRaw = 101
+
+// optionComment is the code of the opt_comment option.
+const optionComment = 1
+
+// writeHeader writes the section header and the interface description.
+func (w *Writer) writeHeader() error {
+	shb := make([]byte, 16)
+	binary.LittleEndian.PutUint32(shb[0:], 0x1A2B3C4D) // byte-order magic
+	binary.LittleEndian.PutUint16(shb[4:], 1)          // major version
+	binary.LittleEndian.PutUint16(shb[6:], 0)          // minor version
+	binary.LittleEndian.PutUint64(shb[8:], ^uint64(0)) // unknown section length
+	if err := w.writeBlock(blockTypeSectionHeader, shb, ""); err != nil {
+		return err
+	}
+	idb := make([]byte, 8)
+	binary.LittleEndian.PutUint16(idb[0:], linkTypeRaw)
+	// We leave the snaplen to zero (i.e., no limit) and we use the default
+	// timestamp resolution, which is microseconds.
+	return w.writeBlock(blockTypeInterfaceDescription, idb, "")
+}
+
+// writePacket writes an enhanced packet block.
+func (w *Writer) writePacket(pkt *packet) error {
+	body := make([]byte, 20, 20+len(pkt.data)+3)
+	usec := uint64(pkt.t.UnixNano() / 1000)
+	binary.LittleEndian.PutUint32(body[0:], 0) // interface ID
+	binary.LittleEndian.PutUint32(body[4:], uint32(usec>>32))
+	binary.LittleEndian.PutUint32(body[8:], uint32(usec))
+	binary.LittleEndian.PutUint32(body[12:], uint32(len(pkt.data))) // captured length
+	binary.LittleEndian.PutUint32(body[16:], uint32(len(pkt.data))) // original length
+	body = append(body, pad(pkt.data)...)
+	return w.writeBlock(blockTypeEnhancedPacket, body, pkt.comment)
+}
+
+// writeBlock writes a block with the given type, body and optional comment.
+func (w *Writer) writeBlock(blockType uint32, body []byte, comment string) error {
+	if comment != "" {
+		option := make([]byte, 4)
+		binary.LittleEndian.PutUint16(option[0:], optionComment)
+		binary.LittleEndian.PutUint16(option[2:], uint16(len(comment)))
+		body = append(body, option...)
+		body = append(body, pad([]byte(comment))...)
+		body = append(body, 0, 0, 0, 0) // opt_endofopt
+	}
+	length := uint32(12 + len(body))
+	block := make([]byte, 8, length)
+	binary.LittleEndian.PutUint32(block[0:], blockType)
+	binary.LittleEndian.PutUint32(block[4:], length)
+	block = append(block, body...)
+	block = append(block, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(block[length-4:], length)
+	_, err := w.w.Write(block)
+	return err
+}
+
+// pad pads data to a multiple of four bytes.
+func pad(data []byte) []byte {
+	if rem := len(data) % 4; rem != 0 {
+		data = append(append([]byte{}, data...), make([]byte, 4-rem)...)
+	}
+	return data
+}
@@ -0,0 +1,317 @@
+package pcapng
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/archival"
+	"github.com/ooni/probe-cli/v3/internal/engine/netx/trace"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+// block is a parsed pcapng block.
+type block struct {
+	blockType uint32
+	body      []byte
+}
+
+// parseBlocks parses the pcapng blocks.
+func parseBlocks(t *testing.T, data []byte) (out []*block) {
+	for len(data) > 0 {
+		if len(data) < 12 {
+			t.Fatal("truncated block")
+		}
+		length := binary.LittleEndian.Uint32(data[4:])
+		if length%4 != 0 || int(length) > len(data) {
+			t.Fatal("invalid block length", length)
+		}
+		if binary.LittleEndian.Uint32(data[length-4:]) != length {
+			t.Fatal("mismatch between the block lengths")
+		}
+		out = append(out, &block{
+			blockType: binary.LittleEndian.Uint32(data[0:]),
+			body:      data[8 : length-4],
+		})
+		data = data[length:]
+	}
+	return
+}
+
+// parsedPacket is the parsed content of an enhanced packet block.
+type parsedPacket struct {
+	comment string
+	data    []byte
+	t       time.Time
+}
+
+// parsePackets parses the enhanced packet blocks and verifies the checksums.
+func parsePackets(t *testing.T, blocks []*block) (out []*parsedPacket) {
+	for _, b := range blocks {
+		if b.blockType != blockTypeEnhancedPacket {
+			continue
+		}
+		usec := uint64(binary.LittleEndian.Uint32(b.body[4:]))<<32 |
+			uint64(binary.LittleEndian.Uint32(b.body[8:]))
+		length := binary.LittleEndian.Uint32(b.body[12:])
+		pkt := &parsedPacket{
+			data: b.body[20 : 20+length],
+			t:    time.Unix(0, int64(usec)*1000),
+		}
+		options := b.body[20+len(pad(pkt.data)):]
+		if len(options) > 0 {
+			if binary.LittleEndian.Uint16(options[0:]) != optionComment {
+				t.Fatal("unexpected option")
+			}
+			pkt.comment = string(options[4 : 4+binary.LittleEndian.Uint16(options[2:])])
+		}
+		verifyChecksums(t, pkt.data)
+		out = append(out, pkt)
+	}
+	return
+}
+
+// verifyChecksums verifies the IP and TCP/UDP checksums.
+func verifyChecksums(t *testing.T, data []byte) {
+	var pseudo, segment []byte
+	switch data[0] >> 4 {
+	case 4:
+		if internetChecksum(data[:20]) != 0 {
+			t.Fatal("invalid IPv4 checksum")
+		}
+		segment = data[20:]
+		pseudo = append(append(pseudo, data[12:20]...), 0, data[9])
+	case 6:
+		segment = data[40:]
+		pseudo = append(append(pseudo, data[8:40]...), 0, 0, 0, data[6])
+	default:
+		t.Fatal("unexpected IP version")
+	}
+	pseudo = append(pseudo, byte(len(segment)>>8), byte(len(segment)))
+	if internetChecksum(append(pseudo, segment...)) != 0 {
+		t.Fatal("invalid TCP/UDP checksum")
+	}
+}
+
+// tcpFlags returns the flags of an IPv4 TCP segment.
+func tcpFlags(data []byte) byte {
+	return data[20+13]
+}
+
+func TestWriteEvents(t *testing.T) {
+	begin := time.Now()
+	events := []trace.Event{{
+		Address:      "93.184.216.34:80",
+		Duration:     10 * time.Millisecond,
+		LocalAddress: "10.0.0.1:54321",
+		Name:         netxlite.ConnectOperation,
+		Proto:        "tcp",
+		Time:         begin.Add(10 * time.Millisecond),
+	}, {
+		Address:      "93.184.216.34:80",
+		Data:         []byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"),
+		LocalAddress: "10.0.0.1:54321",
+		Name:         netxlite.WriteOperation,
+		NumBytes:     37,
+		Proto:        "tcp",
+		Time:         begin.Add(11 * time.Millisecond),
+	}, {
+		Address:      "93.184.216.34:80",
+		Data:         bytes.Repeat([]byte("a"), 2000),
+		LocalAddress: "10.0.0.1:54321",
+		Name:         netxlite.ReadOperation,
+		NumBytes:     2000,
+		Proto:        "tcp",
+		Time:         begin.Add(20 * time.Millisecond),
+	}, {
+		Address:      "93.184.216.34:80",
+		Err:          io.EOF,
+		LocalAddress: "10.0.0.1:54321",
+		Name:         netxlite.ReadOperation,
+		Proto:        "tcp",
+		Time:         begin.Add(21 * time.Millisecond),
+	}, {
+		Address:  "93.184.216.34:443",
+		Duration: 5 * time.Millisecond,
+		Err:      errors.New(netxlite.FailureConnectionRefused),
+		Name:     netxlite.ConnectOperation,
+		Proto:    "tcp",
+		Time:     begin.Add(30 * time.Millisecond),
+	}, {
+		Address:      "[2001:4860:4860::8888]:53",
+		Data:         []byte("query"),
+		LocalAddress: "[::]:5353",
+		Name:         netxlite.WriteToOperation,
+		NumBytes:     5,
+		Time:         begin.Add(40 * time.Millisecond),
+	}, {
+		Address:      "[2001:4860:4860::8888]:53",
+		Data:         []byte("reply"),
+		LocalAddress: "[::]:5353",
+		Name:         netxlite.ReadFromOperation,
+		NumBytes:     5,
+		Time:         begin.Add(50 * time.Millisecond),
+	}}
+	buf := &bytes.Buffer{}
+	if err := NewWriter(buf).WriteEvents(events); err != nil {
+		t.Fatal(err)
+	}
+	blocks := parseBlocks(t, buf.Bytes())
+	if blocks[0].blockType != blockTypeSectionHeader || blocks[1].blockType != blockTypeInterfaceDescription {
+		t.Fatal("unexpected header blocks")
+	}
+	packets := parsePackets(t, blocks)
+	if len(packets) != 11 {
+		t.Fatal("unexpected number of packets", len(packets))
+	}
+
+	t.Run("TCP flow", func(t *testing.T) {
+		var flags []byte
+		var payload []byte
+		for _, pkt := range packets[:8] {
+			flags = append(flags, tcpFlags(pkt.data))
+			payload = append(payload, pkt.data[40:]...)
+		}
+		expectFlags := []byte{
+			tcpSYN, tcpSYN | tcpACK, tcpACK, // handshake
+			tcpPSH | tcpACK,                  // request
+			tcpPSH | tcpACK, tcpPSH | tcpACK, // response segments
+			tcpFIN | tcpACK, // EOF
+			tcpSYN,          // failed connect
+		}
+		if diff := cmp.Diff(expectFlags, flags); diff != "" {
+			t.Fatal(diff)
+		}
+		expectPayload := append([]byte(events[1].Data), events[2].Data...)
+		if diff := cmp.Diff(expectPayload, payload); diff != "" {
+			t.Fatal(diff)
+		}
+		// the first response segment must acknowledge the request
+		request := packets[3].data
+		response := packets[4].data
+		requestSeq := binary.BigEndian.Uint32(request[24:])
+		responseAck := binary.BigEndian.Uint32(response[28:])
+		if responseAck != requestSeq+uint32(len(events[1].Data)) {
+			t.Fatal("unexpected ack number")
+		}
+		if !packets[0].t.Equal(begin.Truncate(time.Microsecond)) {
+			t.Fatal("unexpected SYN time", packets[0].t, begin)
+		}
+	})
+
+	t.Run("failed connect", func(t *testing.T) {
+		syn, rst := packets[7], packets[8]
+		if syn.comment != "connect: connection_refused" {
+			t.Fatal("unexpected comment", syn.comment)
+		}
+		if tcpFlags(rst.data) != tcpRST|tcpACK {
+			t.Fatal("expected a RST")
+		}
+		if !bytes.Equal(syn.data[12:16], []byte{0, 0, 0, 0}) {
+			t.Fatal("expected the unspecified address")
+		}
+	})
+
+	t.Run("UDP over IPv6", func(t *testing.T) {
+		query, reply := packets[9], packets[10]
+		if query.data[0]>>4 != 6 || query.data[6] != ipProtoUDP {
+			t.Fatal("expected UDP over IPv6")
+		}
+		if string(query.data[48:]) != "query" || string(reply.data[48:]) != "reply" {
+			t.Fatal("unexpected payloads")
+		}
+		if binary.BigEndian.Uint16(query.data[42:]) != 53 || binary.BigEndian.Uint16(reply.data[40:]) != 53 {
+			t.Fatal("unexpected ports")
+		}
+	})
+}
+
+func TestAppendFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.pcapng")
+	events := []trace.Event{{
+		Address:      "8.8.8.8:53",
+		Data:         []byte("query"),
+		LocalAddress: "10.0.0.1:5353",
+		Name:         netxlite.WriteOperation,
+		Proto:        "udp",
+		Time:         time.Now(),
+	}}
+	for i := 0; i < 2; i++ {
+		if err := AppendFile(path, events); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []uint32
+	for _, b := range parseBlocks(t, data) {
+		types = append(types, b.blockType)
+	}
+	expect := []uint32{
+		blockTypeSectionHeader, blockTypeInterfaceDescription,
+		blockTypeEnhancedPacket, blockTypeEnhancedPacket,
+	}
+	if diff := cmp.Diff(expect, types); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestNewEventsFromArchivalTrace(t *testing.T) {
+	begin := time.Now()
+	tr := &archival.Trace{
+		Network: []*archival.NetworkEvent{{
+			Finished:   begin.Add(10 * time.Millisecond),
+			LocalAddr:  "10.0.0.1:54321",
+			Network:    "tcp",
+			Operation:  netxlite.ConnectOperation,
+			RemoteAddr: "93.184.216.34:80",
+			Started:    begin,
+		}, {
+			Count:      4,
+			Data:       []byte("ping"),
+			Finished:   begin.Add(11 * time.Millisecond),
+			LocalAddr:  "10.0.0.1:54321",
+			Network:    "tcp",
+			Operation:  netxlite.WriteOperation,
+			RemoteAddr: "93.184.216.34:80",
+			Started:    begin.Add(10 * time.Millisecond),
+		}},
+	}
+	events := NewEventsFromArchivalTrace(tr)
+	expect := []trace.Event{{
+		Address:      "93.184.216.34:80",
+		Duration:     10 * time.Millisecond,
+		LocalAddress: "10.0.0.1:54321",
+		Name:         netxlite.ConnectOperation,
+		Proto:        "tcp",
+		Time:         begin.Add(10 * time.Millisecond),
+	}, {
+		Address:      "93.184.216.34:80",
+		Data:         []byte("ping"),
+		Duration:     time.Millisecond,
+		LocalAddress: "10.0.0.1:54321",
+		Name:         netxlite.WriteOperation,
+		NumBytes:     4,
+		Proto:        "tcp",
+		Time:         begin.Add(11 * time.Millisecond),
+	}}
+	if diff := cmp.Diff(expect, events); diff != "" {
+		t.Fatal(diff)
+	}
+	buf := &bytes.Buffer{}
+	if err := NewWriter(buf).WriteEvents(events); err != nil {
+		t.Fatal(err)
+	}
+	packets := parsePackets(t, parseBlocks(t, buf.Bytes()))
+	if len(packets) != 4 {
+		t.Fatal("unexpected number of packets", len(packets))
+	}
+}
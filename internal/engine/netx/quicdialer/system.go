@@ -42,13 +42,14 @@ func (c *saverUDPConn) WriteTo(p []byte, addr net.Addr) (int, error) {
 	count, err := c.UDPLikeConn.WriteTo(p, addr)
 	stop := time.Now()
 	c.saver.Write(trace.Event{
-		Address:  addr.String(),
-		Data:     p[:count],
-		Duration: stop.Sub(start),
-		Err:      err,
-		NumBytes: count,
-		Name:     netxlite.WriteToOperation,
-		Time:     stop,
+		Address:      addr.String(),
+		Data:         append([]byte{}, p[:count]...), // the caller may reuse p
+		Duration:     stop.Sub(start),
+		Err:          err,
+		LocalAddress: c.safeAddrString(c.UDPLikeConn.LocalAddr()),
+		NumBytes:     count,
+		Name:         netxlite.WriteToOperation,
+		Time:         stop,
 	})
 	return count, err
 }
@@ -59,16 +60,17 @@ func (c *saverUDPConn) ReadFrom(b []byte) (int, net.Addr, error) {
 	stop := time.Now()
 	var data []byte
 	if n > 0 {
-		data = b[:n]
+		data = append([]byte{}, b[:n]...) // the caller may reuse b
 	}
 	c.saver.Write(trace.Event{
-		Address:  c.safeAddrString(addr),
-		Data:     data,
-		Duration: stop.Sub(start),
-		Err:      err,
-		NumBytes: n,
-		Name:     netxlite.ReadFromOperation,
-		Time:     stop,
+		Address:      c.safeAddrString(addr),
+		Data:         data,
+		Duration:     stop.Sub(start),
+		Err:          err,
+		LocalAddress: c.safeAddrString(c.UDPLikeConn.LocalAddr()),
+		NumBytes:     n,
+		Name:         netxlite.ReadFromOperation,
+		Time:         stop,
 	})
 	return n, addr, err
 }
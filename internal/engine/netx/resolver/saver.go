@@ -2,6 +2,7 @@ package resolver
 
 import (
 	"context"
+	"net"
 	"time"
 
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/trace"
@@ -39,6 +40,87 @@ func (r SaverResolver) LookupHost(ctx context.Context, hostname string) ([]strin
 	return addrs, err
 }
 
+// LookupCNAME implements Resolver.LookupCNAME
+func (r SaverResolver) LookupCNAME(ctx context.Context, hostname string) ([]string, error) {
+	start := r.writeStart(hostname, "CNAME")
+	cnames, err := r.Resolver.LookupCNAME(ctx, hostname)
+	var records []*model.DNSRecord
+	for _, cname := range cnames {
+		records = append(records, &model.DNSRecord{Type: "CNAME", Value: cname})
+	}
+	r.writeDone(hostname, "CNAME", records, err, start)
+	return cnames, err
+}
+
+// LookupNS implements Resolver.LookupNS
+func (r SaverResolver) LookupNS(ctx context.Context, hostname string) ([]*net.NS, error) {
+	start := r.writeStart(hostname, "NS")
+	nss, err := r.Resolver.LookupNS(ctx, hostname)
+	var records []*model.DNSRecord
+	for _, ns := range nss {
+		records = append(records, &model.DNSRecord{Type: "NS", Value: ns.Host})
+	}
+	r.writeDone(hostname, "NS", records, err, start)
+	return nss, err
+}
+
+// LookupMX implements Resolver.LookupMX
+func (r SaverResolver) LookupMX(ctx context.Context, hostname string) ([]*net.MX, error) {
+	start := r.writeStart(hostname, "MX")
+	mxs, err := r.Resolver.LookupMX(ctx, hostname)
+	var records []*model.DNSRecord
+	for _, mx := range mxs {
+		records = append(records, &model.DNSRecord{
+			Type:       "MX",
+			Value:      mx.Host,
+			Preference: mx.Pref,
+		})
+	}
+	r.writeDone(hostname, "MX", records, err, start)
+	return mxs, err
+}
+
+// LookupTXT implements Resolver.LookupTXT
+func (r SaverResolver) LookupTXT(ctx context.Context, hostname string) ([]string, error) {
+	start := r.writeStart(hostname, "TXT")
+	txts, err := r.Resolver.LookupTXT(ctx, hostname)
+	var records []*model.DNSRecord
+	for _, txt := range txts {
+		records = append(records, &model.DNSRecord{Type: "TXT", Value: txt})
+	}
+	r.writeDone(hostname, "TXT", records, err, start)
+	return txts, err
+}
+
+func (r SaverResolver) writeStart(hostname, qtype string) time.Time {
+	start := time.Now()
+	r.Saver.Write(trace.Event{
+		Address:      r.Resolver.Address(),
+		DNSQueryType: qtype,
+		Hostname:     hostname,
+		Name:         "resolve_start",
+		Proto:        r.Resolver.Network(),
+		Time:         start,
+	})
+	return start
+}
+
+func (r SaverResolver) writeDone(hostname, qtype string,
+	records []*model.DNSRecord, err error, start time.Time) {
+	stop := time.Now()
+	r.Saver.Write(trace.Event{
+		Address:      r.Resolver.Address(),
+		DNSQueryType: qtype,
+		DNSRecords:   records,
+		Duration:     stop.Sub(start),
+		Err:          err,
+		Hostname:     hostname,
+		Name:         "resolve_done",
+		Proto:        r.Resolver.Network(),
+		Time:         stop,
+	})
+}
+
 // SaverDNSTransport is a DNS transport that saves events
 type SaverDNSTransport struct {
 	model.DNSTransport
@@ -70,5 +152,54 @@ func (txp SaverDNSTransport) RoundTrip(ctx context.Context, query []byte) ([]byt
 	return reply, err
 }
 
+// SaverDNSTransportWithDuplicates is like SaverDNSTransport but it
+// additionally saves a dns_response event for each response received
+// by the underlying transport, including duplicate responses.
+type SaverDNSTransportWithDuplicates struct {
+	model.DNSTransportWithDuplicates
+	Saver *trace.Saver
+}
+
+// RoundTrip implements RoundTripper.RoundTrip
+func (txp SaverDNSTransportWithDuplicates) RoundTrip(
+	ctx context.Context, query []byte) ([]byte, error) {
+	start := time.Now()
+	txp.Saver.Write(trace.Event{
+		Address:  txp.Address(),
+		DNSQuery: query,
+		Name:     "dns_round_trip_start",
+		Proto:    txp.Network(),
+		Time:     start,
+	})
+	var reply []byte
+	responses, err := txp.DNSTransportWithDuplicates.RoundTripWithDuplicates(ctx, query)
+	for _, response := range responses {
+		txp.Saver.Write(trace.Event{
+			Address:  txp.Address(),
+			DNSQuery: query,
+			DNSReply: response.Reply,
+			Name:     "dns_response",
+			Proto:    txp.Network(),
+			Time:     response.Received,
+		})
+	}
+	if len(responses) > 0 {
+		reply = responses[0].Reply
+	}
+	stop := time.Now()
+	txp.Saver.Write(trace.Event{
+		Address:  txp.Address(),
+		DNSQuery: query,
+		DNSReply: reply,
+		Duration: stop.Sub(start),
+		Err:      err,
+		Name:     "dns_round_trip_done",
+		Proto:    txp.Network(),
+		Time:     stop,
+	})
+	return reply, err
+}
+
 var _ model.Resolver = SaverResolver{}
 var _ model.DNSTransport = SaverDNSTransport{}
+var _ model.DNSTransport = SaverDNSTransportWithDuplicates{}
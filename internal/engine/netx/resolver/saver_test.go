@@ -4,12 +4,15 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"net"
 	"reflect"
 	"testing"
 	"time"
 
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/resolver"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/trace"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/model/mocks"
 )
 
 func TestSaverResolverFailure(t *testing.T) {
@@ -61,6 +64,148 @@ func TestSaverResolverFailure(t *testing.T) {
 	}
 }
 
+func TestSaverResolverLookupMX(t *testing.T) {
+	t.Run("on success", func(t *testing.T) {
+		expected := []*net.MX{{Host: "mx.example.com.", Pref: 10}}
+		saver := &trace.Saver{}
+		reso := resolver.SaverResolver{
+			Resolver: &mocks.Resolver{
+				MockLookupMX: func(ctx context.Context, domain string) ([]*net.MX, error) {
+					return expected, nil
+				},
+				MockAddress: func() string {
+					return "8.8.8.8:53"
+				},
+				MockNetwork: func() string {
+					return "udp"
+				},
+			},
+			Saver: saver,
+		}
+		mxs, err := reso.LookupMX(context.Background(), "example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(mxs, expected) {
+			t.Fatal("not the result we expected")
+		}
+		ev := saver.Read()
+		if len(ev) != 2 {
+			t.Fatal("expected number of events")
+		}
+		if ev[0].Name != "resolve_start" || ev[0].DNSQueryType != "MX" {
+			t.Fatal("unexpected first event")
+		}
+		if ev[1].Name != "resolve_done" || ev[1].DNSQueryType != "MX" {
+			t.Fatal("unexpected second event")
+		}
+		expectRecords := []*model.DNSRecord{{
+			Type:       "MX",
+			Value:      "mx.example.com.",
+			Preference: 10,
+		}}
+		if !reflect.DeepEqual(ev[1].DNSRecords, expectRecords) {
+			t.Fatal("unexpected DNSRecords")
+		}
+		if ev[1].Address != "8.8.8.8:53" || ev[1].Proto != "udp" {
+			t.Fatal("unexpected resolver information")
+		}
+	})
+
+	t.Run("on failure", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		saver := &trace.Saver{}
+		reso := resolver.SaverResolver{
+			Resolver: &mocks.Resolver{
+				MockLookupMX: func(ctx context.Context, domain string) ([]*net.MX, error) {
+					return nil, expected
+				},
+				MockAddress: func() string {
+					return "8.8.8.8:53"
+				},
+				MockNetwork: func() string {
+					return "udp"
+				},
+			},
+			Saver: saver,
+		}
+		mxs, err := reso.LookupMX(context.Background(), "example.com")
+		if !errors.Is(err, expected) {
+			t.Fatal("not the error we expected")
+		}
+		if mxs != nil {
+			t.Fatal("expected nil result")
+		}
+		ev := saver.Read()
+		if len(ev) != 2 {
+			t.Fatal("expected number of events")
+		}
+		if !errors.Is(ev[1].Err, expected) {
+			t.Fatal("unexpected Err")
+		}
+		if ev[1].DNSRecords != nil {
+			t.Fatal("unexpected DNSRecords")
+		}
+	})
+}
+
+func TestSaverResolverLookupRecordTypes(t *testing.T) {
+	saver := &trace.Saver{}
+	reso := resolver.SaverResolver{
+		Resolver: &mocks.Resolver{
+			MockLookupCNAME: func(ctx context.Context, domain string) ([]string, error) {
+				return []string{"example.com."}, nil
+			},
+			MockLookupNS: func(ctx context.Context, domain string) ([]*net.NS, error) {
+				return []*net.NS{{Host: "a.iana-servers.net."}}, nil
+			},
+			MockLookupTXT: func(ctx context.Context, domain string) ([]string, error) {
+				return []string{"v=spf1 -all"}, nil
+			},
+			MockAddress: func() string {
+				return "8.8.8.8:53"
+			},
+			MockNetwork: func() string {
+				return "udp"
+			},
+		},
+		Saver: saver,
+	}
+	ctx := context.Background()
+	if _, err := reso.LookupCNAME(ctx, "www.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reso.LookupNS(ctx, "example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reso.LookupTXT(ctx, "example.com"); err != nil {
+		t.Fatal(err)
+	}
+	ev := saver.Read()
+	if len(ev) != 6 {
+		t.Fatal("expected number of events")
+	}
+	expect := []*model.DNSRecord{{
+		Type:  "CNAME",
+		Value: "example.com.",
+	}, {
+		Type:  "NS",
+		Value: "a.iana-servers.net.",
+	}, {
+		Type:  "TXT",
+		Value: "v=spf1 -all",
+	}}
+	for idx, record := range expect {
+		done := ev[2*idx+1]
+		if done.DNSQueryType != record.Type {
+			t.Fatal("unexpected DNSQueryType", done.DNSQueryType)
+		}
+		if len(done.DNSRecords) != 1 || !reflect.DeepEqual(done.DNSRecords[0], record) {
+			t.Fatal("unexpected DNSRecords")
+		}
+	}
+}
+
 func TestSaverResolverSuccess(t *testing.T) {
 	expected := []string{"8.8.8.8", "8.8.4.4"}
 	saver := &trace.Saver{}
@@ -209,3 +354,98 @@ func TestSaverDNSTransportSuccess(t *testing.T) {
 		t.Fatal("the saved time is wrong")
 	}
 }
+
+func TestSaverDNSTransportWithDuplicatesFailure(t *testing.T) {
+	expected := errors.New("mocked error")
+	saver := &trace.Saver{}
+	txp := resolver.SaverDNSTransportWithDuplicates{
+		DNSTransportWithDuplicates: &mocks.DNSTransportWithDuplicates{
+			MockRoundTripWithDuplicates: func(ctx context.Context, query []byte) ([]*model.DNSResponse, error) {
+				return nil, expected
+			},
+			MockNetwork: func() string {
+				return "udp"
+			},
+			MockAddress: func() string {
+				return "8.8.8.8:53"
+			},
+		},
+		Saver: saver,
+	}
+	reply, err := txp.RoundTrip(context.Background(), []byte("abc"))
+	if !errors.Is(err, expected) {
+		t.Fatal("not the error we expected")
+	}
+	if reply != nil {
+		t.Fatal("expected nil reply here")
+	}
+	ev := saver.Read()
+	if len(ev) != 2 {
+		t.Fatal("unexpected number of events")
+	}
+	if ev[0].Name != "dns_round_trip_start" || ev[1].Name != "dns_round_trip_done" {
+		t.Fatal("unexpected events")
+	}
+	if !errors.Is(ev[1].Err, expected) {
+		t.Fatal("unexpected Err")
+	}
+}
+
+func TestSaverDNSTransportWithDuplicatesSuccess(t *testing.T) {
+	saver := &trace.Saver{}
+	first, second := []byte("def"), []byte("ghi")
+	received := time.Now()
+	txp := resolver.SaverDNSTransportWithDuplicates{
+		DNSTransportWithDuplicates: &mocks.DNSTransportWithDuplicates{
+			MockRoundTripWithDuplicates: func(ctx context.Context, query []byte) ([]*model.DNSResponse, error) {
+				return []*model.DNSResponse{{
+					Reply:    first,
+					Received: received,
+				}, {
+					Reply:    second,
+					Received: received.Add(time.Millisecond),
+				}}, nil
+			},
+			MockNetwork: func() string {
+				return "udp"
+			},
+			MockAddress: func() string {
+				return "8.8.8.8:53"
+			},
+		},
+		Saver: saver,
+	}
+	query := []byte("abc")
+	reply, err := txp.RoundTrip(context.Background(), query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reply, first) {
+		t.Fatal("did not return the first reply")
+	}
+	ev := saver.Read()
+	if len(ev) != 4 {
+		t.Fatal("unexpected number of events")
+	}
+	for idx, expected := range [][]byte{first, second} {
+		e := ev[idx+1]
+		if e.Name != "dns_response" {
+			t.Fatal("unexpected name")
+		}
+		if !bytes.Equal(e.DNSQuery, query) {
+			t.Fatal("unexpected DNSQuery")
+		}
+		if !bytes.Equal(e.DNSReply, expected) {
+			t.Fatal("unexpected DNSReply")
+		}
+		if e.Address != "8.8.8.8:53" || e.Proto != "udp" {
+			t.Fatal("unexpected address or proto")
+		}
+	}
+	if !ev[1].Time.Equal(received) {
+		t.Fatal("unexpected response time")
+	}
+	if !bytes.Equal(ev[3].DNSReply, first) {
+		t.Fatal("unexpected DNSReply")
+	}
+}
@@ -15,6 +15,14 @@ import (
 type SaverTLSHandshaker struct {
 	model.TLSHandshaker
 	Saver *trace.Saver
+
+	// Fingerprint is the OPTIONAL name of the TLS ClientHello
+	// fingerprint we're using, which we record.
+	Fingerprint string
+
+	// Split is the OPTIONAL config we use for splitting the ClientHello,
+	// which we record such that we know which strategy we used.
+	Split *netxlite.TLSSplitConfig
 }
 
 // Handshake implements TLSHandshaker.Handshake
@@ -31,19 +39,25 @@ func (h SaverTLSHandshaker) Handshake(
 	})
 	tlsconn, state, err := h.TLSHandshaker.Handshake(ctx, conn, config)
 	stop := time.Now()
-	h.Saver.Write(trace.Event{
+	ev := trace.Event{
 		Duration:           stop.Sub(start),
 		Err:                err,
 		Name:               "tls_handshake_done",
 		NoTLSVerify:        config.InsecureSkipVerify,
 		TLSCipherSuite:     netxlite.TLSCipherSuiteString(state.CipherSuite),
+		TLSFingerprint:     h.Fingerprint,
 		TLSNegotiatedProto: state.NegotiatedProtocol,
 		TLSNextProtos:      config.NextProtos,
 		TLSPeerCerts:       trace.PeerCerts(state, err),
 		TLSServerName:      config.ServerName,
 		TLSVersion:         netxlite.TLSVersionString(state.Version),
 		Time:               stop,
-	})
+	}
+	if h.Split != nil {
+		ev.TLSSplitDelay = h.Split.Delay
+		ev.TLSSplitStrategy = h.Split.Strategy
+	}
+	h.Saver.Write(ev)
 	return tlsconn, state, err
 }
 
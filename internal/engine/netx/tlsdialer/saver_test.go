@@ -3,6 +3,8 @@ package tlsdialer_test
 import (
 	"context"
 	"crypto/tls"
+	"io"
+	"net"
 	"reflect"
 	"testing"
 	"time"
@@ -10,6 +12,7 @@ import (
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/dialer"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/tlsdialer"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/trace"
+	"github.com/ooni/probe-cli/v3/internal/model/mocks"
 	"github.com/ooni/probe-cli/v3/internal/netxlite"
 )
 
@@ -307,3 +310,35 @@ func TestSaverTLSHandshakerNoTLSVerify(t *testing.T) {
 		}
 	}
 }
+
+func TestSaverTLSHandshakerWithSplitAndFingerprint(t *testing.T) {
+	saver := &trace.Saver{}
+	th := tlsdialer.SaverTLSHandshaker{
+		TLSHandshaker: &mocks.TLSHandshaker{
+			MockHandshake: func(ctx context.Context, conn net.Conn,
+				config *tls.Config) (net.Conn, tls.ConnectionState, error) {
+				return nil, tls.ConnectionState{}, io.EOF
+			},
+		},
+		Fingerprint: netxlite.TLSFingerprintIOS,
+		Saver:       saver,
+		Split: &netxlite.TLSSplitConfig{
+			Strategy: netxlite.TLSSplitRecordFragment,
+			Delay:    time.Second,
+		},
+	}
+	th.Handshake(context.Background(), &mocks.Conn{}, &tls.Config{})
+	ev := saver.Read()
+	if len(ev) != 2 {
+		t.Fatal("unexpected number of events")
+	}
+	if ev[1].TLSSplitStrategy != netxlite.TLSSplitRecordFragment {
+		t.Fatal("unexpected TLSSplitStrategy")
+	}
+	if ev[1].TLSSplitDelay != time.Second {
+		t.Fatal("unexpected TLSSplitDelay")
+	}
+	if ev[1].TLSFingerprint != netxlite.TLSFingerprintIOS {
+		t.Fatal("unexpected TLSFingerprint")
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"errors"
 	"net/http"
 	"time"
+
+	"github.com/ooni/probe-cli/v3/internal/model"
 )
 
 // Event is one of the events within a trace
@@ -13,6 +15,8 @@ type Event struct {
 	Addresses          []string            `json:",omitempty"`
 	Address            string              `json:",omitempty"`
 	DNSQuery           []byte              `json:",omitempty"`
+	DNSQueryType       string              `json:",omitempty"`
+	DNSRecords         []*model.DNSRecord  `json:",omitempty"`
 	DNSReply           []byte              `json:",omitempty"`
 	DataIsTruncated    bool                `json:",omitempty"`
 	Data               []byte              `json:",omitempty"`
@@ -23,15 +27,19 @@ type Event struct {
 	HTTPStatusCode     int                 `json:",omitempty"`
 	HTTPURL            string              `json:",omitempty"`
 	Hostname           string              `json:",omitempty"`
+	LocalAddress       string              `json:",omitempty"`
 	Name               string              `json:",omitempty"`
 	NoTLSVerify        bool                `json:",omitempty"`
 	NumBytes           int                 `json:",omitempty"`
 	Proto              string              `json:",omitempty"`
 	TLSServerName      string              `json:",omitempty"`
 	TLSCipherSuite     string              `json:",omitempty"`
+	TLSFingerprint     string              `json:",omitempty"`
 	TLSNegotiatedProto string              `json:",omitempty"`
 	TLSNextProtos      []string            `json:",omitempty"`
 	TLSPeerCerts       []*x509.Certificate `json:",omitempty"`
+	TLSSplitDelay      time.Duration       `json:",omitempty"`
+	TLSSplitStrategy   string              `json:",omitempty"`
 	TLSVersion         string              `json:",omitempty"`
 	Time               time.Time           `json:",omitempty"`
 	Transport          string              `json:",omitempty"`
@@ -18,6 +18,7 @@ import (
 	"github.com/ooni/probe-cli/v3/internal/engine/probeservices"
 	"github.com/ooni/probe-cli/v3/internal/kvstore"
 	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
 	"github.com/ooni/probe-cli/v3/internal/platform"
 	"github.com/ooni/probe-cli/v3/internal/tunnel"
 	"github.com/ooni/probe-cli/v3/internal/version"
@@ -41,6 +42,11 @@ type SessionConfig struct {
 	// case, starting a tunnel will fail because there
 	// is no directory where to store state.
 	TunnelDir string
+
+	// TLSSplit is the OPTIONAL config for splitting the TLS
+	// ClientHello sent by the session's HTTP client, which helps
+	// when the network blocks the OONI backend by SNI.
+	TLSSplit *netxlite.TLSSplitConfig
 }
 
 // Session is a measurement session. It contains shared information
@@ -51,6 +57,7 @@ type Session struct {
 	availableProbeServices   []model.OOAPIService
 	availableTestHelpers     map[string][]model.OOAPIService
 	byteCounter              *bytecounter.Counter
+	cachingResolver          *netxlite.CachingResolver
 	httpDefaultTransport     model.HTTPTransport
 	kvStore                  model.KeyValueStore
 	location                 *geolocate.Results
@@ -144,6 +151,11 @@ func NewSession(ctx context.Context, config SessionConfig) (*Session, error) {
 	if config.SoftwareVersion == "" {
 		return nil, errors.New("SoftwareVersion is empty")
 	}
+	if config.TLSSplit != nil {
+		if err := config.TLSSplit.Validate(); err != nil {
+			return nil, err
+		}
+	}
 	if config.KVStore == nil {
 		config.KVStore = &kvstore.Memory{}
 	}
@@ -192,10 +204,12 @@ func NewSession(ctx context.Context, config SessionConfig) (*Session, error) {
 	}
 	sess.proxyURL = proxyURL
 	httpConfig := netx.Config{
-		ByteCounter:  sess.byteCounter,
-		BogonIsError: true,
-		Logger:       sess.logger,
-		ProxyURL:     proxyURL,
+		ByteCounter:   sess.byteCounter,
+		BogonIsError:  true,
+		HappyEyeballs: true,
+		Logger:        sess.logger,
+		ProxyURL:      proxyURL,
+		TLSSplit:      config.TLSSplit,
 	}
 	sess.resolver = &sessionresolver.Resolver{
 		ByteCounter: sess.byteCounter,
@@ -203,7 +217,10 @@ func NewSession(ctx context.Context, config SessionConfig) (*Session, error) {
 		Logger:      sess.logger,
 		ProxyURL:    proxyURL,
 	}
-	httpConfig.FullResolver = sess.resolver
+	// We cache the session resolver's results because the probe resolves
+	// the same probe services and test helpers names again and again.
+	sess.cachingResolver = netxlite.NewCachingResolver(sess.resolver)
+	httpConfig.FullResolver = sess.cachingResolver
 	sess.httpDefaultTransport = netx.NewHTTPTransport(httpConfig)
 	return sess, nil
 }
@@ -654,6 +671,11 @@ func (s *Session) MaybeLookupBackendsContext(ctx context.Context) error {
 // LookupLocationContext performs a location lookup. If you want memoisation
 // of the results, you should use MaybeLookupLocationContext.
 func (s *Session) LookupLocationContext(ctx context.Context) (*geolocate.Results, error) {
+	// A new location lookup suggests that we may be using a different
+	// network, hence we forget the addresses we have cached so far.
+	if s.cachingResolver != nil {
+		s.cachingResolver.Flush()
+	}
 	task := geolocate.NewTask(geolocate.Config{
 		Logger:    s.Logger(),
 		Resolver:  s.resolver,
@@ -66,6 +66,14 @@ func TestNewSessionBuilderChecks(t *testing.T) {
 			TempDir:         "./nonexistent",
 		})
 	})
+	t.Run("with software version and invalid TLS split config", func(t *testing.T) {
+		newSessionMustFail(t, SessionConfig{
+			Logger:          model.DiscardLogger,
+			SoftwareName:    "ooniprobe-engine",
+			SoftwareVersion: "0.0.1",
+			TLSSplit:        &netxlite.TLSSplitConfig{Strategy: "antani"},
+		})
+	})
 }
 
 func TestNewSessionBuilderGood(t *testing.T) {
@@ -11,6 +11,8 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/ooni/probe-cli/v3/internal/engine/geolocate"
 	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/model/mocks"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
 )
 
 func (s *Session) GetAvailableProbeServices() []model.OOAPIService {
@@ -291,3 +293,27 @@ func TestNewSessionWithFakeTunnelAndCancelledContext(t *testing.T) {
 		t.Fatal("expected nil session here")
 	}
 }
+
+func TestSessionLookupLocationContextFlushesTheDNSCache(t *testing.T) {
+	sess := newSessionForTestingNoLookups(t)
+	defer sess.Close()
+	sess.cachingResolver = netxlite.NewCachingResolver(&mocks.Resolver{
+		MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+			return []string{"8.8.8.8"}, nil
+		},
+	})
+	if _, err := sess.cachingResolver.LookupHost(context.Background(), "dns.google"); err != nil {
+		t.Fatal(err)
+	}
+	if sess.cachingResolver.Len() != 1 {
+		t.Fatal("expected one entry in the cache")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // fail immediately
+	if _, err := sess.LookupLocationContext(ctx); err == nil {
+		t.Fatal("expected an error here")
+	}
+	if sess.cachingResolver.Len() != 0 {
+		t.Fatal("expected the cache to be empty")
+	}
+}
@@ -47,3 +47,29 @@ type filesystem struct{}
 func (filesystem) Open(pathname string) (fs.File, error) {
 	return os.Open(pathname)
 }
+
+// ReadAssetFunc returns a function reading the file at the given
+// path inside fsys. You can use this function along with the one
+// returned by ReadAssetDirFunc to load database migrations from an
+// embedded file system using github.com/rubenv/sql-migrate.
+func ReadAssetFunc(fsys fs.FS) func(path string) ([]byte, error) {
+	return func(path string) ([]byte, error) {
+		return fs.ReadFile(fsys, path)
+	}
+}
+
+// ReadAssetDirFunc returns a function listing the names of the
+// entries of the directory at the given path inside fsys.
+func ReadAssetDirFunc(fsys fs.FS) func(path string) ([]string, error) {
+	return func(path string) ([]string, error) {
+		entries, err := fs.ReadDir(fsys, path)
+		if err != nil {
+			return nil, err
+		}
+		var out []string
+		for _, e := range entries {
+			out = append(out, e.Name())
+		}
+		return out, nil
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"syscall"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/ooni/probe-cli/v3/internal/atomicx"
 )
 
@@ -82,3 +83,44 @@ func TestOpeningExistingFileShouldWork(t *testing.T) {
 	}
 	defer file.Close()
 }
+
+func TestReadAssetFunc(t *testing.T) {
+	readAsset := ReadAssetFunc(os.DirFS(baseDir))
+	t.Run("with an existing file", func(t *testing.T) {
+		data, err := readAsset("testfile.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) <= 0 {
+			t.Fatal("expected some data")
+		}
+	})
+
+	t.Run("with a nonexistent file", func(t *testing.T) {
+		_, err := readAsset("invalidtestfile.txt")
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Fatal("not the error we expected", err)
+		}
+	})
+}
+
+func TestReadAssetDirFunc(t *testing.T) {
+	readAssetDir := ReadAssetDirFunc(os.DirFS(baseDir))
+	t.Run("with an existing directory", func(t *testing.T) {
+		names, err := readAssetDir(".")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []string{".gitignore", "testfile.txt"}
+		if diff := cmp.Diff(expected, names); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("with a nonexistent directory", func(t *testing.T) {
+		_, err := readAssetDir("invaliddir")
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Fatal("not the error we expected", err)
+		}
+	})
+}
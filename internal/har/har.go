@@ -0,0 +1,426 @@
+// Package har converts OONI measurements to HTTP Archive (HAR) 1.2
+// files, which browser developer tools and HAR viewers can load.
+//
+// We support the test keys of experiments using netx (e.g., urlgetter)
+// and of experiments using measurex (e.g., websteps). We emit an
+// entry for each HTTP round trip, with the timings of each phase
+// computed from the DNS, connect and TLS events, the redirect
+// location and the body snapshot. Because a HAR entry only describes
+// successful exchanges, we save the OONI failure of each entry into
+// the nonstandard `_failure` field (HAR 1.2 allows custom fields
+// starting with an underscore).
+//
+// See http://www.softwareishard.com/blog/har-12-spec/.
+package har
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ooni/probe-cli/v3/internal/measurex"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+// Version is the version of the HAR format we emit.
+const Version = "1.2"
+
+// Archive is an HTTP Archive.
+type Archive struct {
+	Log *Log `json:"log"`
+}
+
+// Log is the root of the HTTP Archive.
+type Log struct {
+	Version string   `json:"version"`
+	Creator *Creator `json:"creator"`
+	Pages   []*Page  `json:"pages"`
+	Entries []*Entry `json:"entries"`
+}
+
+// Creator describes the software that created the measurements.
+type Creator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Page groups the entries of a single measurement.
+type Page struct {
+	StartedDateTime time.Time    `json:"startedDateTime"`
+	ID              string       `json:"id"`
+	Title           string       `json:"title"`
+	PageTimings     *PageTimings `json:"pageTimings"`
+}
+
+// PageTimings contains the page timings. We always set both the
+// fields to -1, since we do not load pages like browsers do.
+type PageTimings struct {
+	OnContentLoad float64 `json:"onContentLoad"`
+	OnLoad        float64 `json:"onLoad"`
+}
+
+// Entry is an HTTP round trip.
+type Entry struct {
+	Pageref         string    `json:"pageref"`
+	StartedDateTime time.Time `json:"startedDateTime"`
+	Time            float64   `json:"time"`
+	Request         *Request  `json:"request"`
+	Response        *Response `json:"response"`
+	Cache           struct{}  `json:"cache"`
+	Timings         *Timings  `json:"timings"`
+	ServerIPAddress string    `json:"serverIPAddress,omitempty"`
+
+	// Failure is the OONI failure of the round trip, if any.
+	Failure string `json:"_failure,omitempty"`
+}
+
+// Request is an HTTP request.
+type Request struct {
+	Method      string       `json:"method"`
+	URL         string       `json:"url"`
+	HTTPVersion string       `json:"httpVersion"`
+	Cookies     []*Cookie    `json:"cookies"`
+	Headers     []*NameValue `json:"headers"`
+	QueryString []*NameValue `json:"queryString"`
+	PostData    *PostData    `json:"postData,omitempty"`
+	HeadersSize int64        `json:"headersSize"`
+	BodySize    int64        `json:"bodySize"`
+}
+
+// Response is an HTTP response.
+type Response struct {
+	Status      int64        `json:"status"`
+	StatusText  string       `json:"statusText"`
+	HTTPVersion string       `json:"httpVersion"`
+	Cookies     []*Cookie    `json:"cookies"`
+	Headers     []*NameValue `json:"headers"`
+	Content     *Content     `json:"content"`
+	RedirectURL string       `json:"redirectURL"`
+	HeadersSize int64        `json:"headersSize"`
+	BodySize    int64        `json:"bodySize"`
+}
+
+// Cookie is an HTTP cookie.
+type Cookie struct {
+	Name     string     `json:"name"`
+	Value    string     `json:"value"`
+	Path     string     `json:"path,omitempty"`
+	Domain   string     `json:"domain,omitempty"`
+	Expires  *time.Time `json:"expires,omitempty"`
+	HTTPOnly bool       `json:"httpOnly,omitempty"`
+	Secure   bool       `json:"secure,omitempty"`
+}
+
+// NameValue is a header or a query string parameter.
+type NameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// PostData is the body of a request.
+type PostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+// Content is the body of a response. When the body snapshot is not
+// valid UTF-8, Text contains the base64 encoding of the body.
+type Content struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// Timings contains the duration of each phase of an entry in
+// milliseconds. A -1 value means that the phase does not apply
+// to the entry (e.g., because we reused a connection).
+type Timings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// total returns the total duration of the entry. As mandated by the
+// spec, SSL is not part of the total because Connect includes it.
+func (t *Timings) total() (out float64) {
+	for _, v := range []float64{t.Blocked, t.DNS, t.Connect, t.Send, t.Wait, t.Receive} {
+		if v > 0 {
+			out += v
+		}
+	}
+	return
+}
+
+// NewArchive creates a new, empty Archive.
+func NewArchive(creator, version string) *Archive {
+	return &Archive{
+		Log: &Log{
+			Version: Version,
+			Creator: &Creator{Name: creator, Version: version},
+			Pages:   []*Page{},
+			Entries: []*Entry{},
+		},
+	}
+}
+
+// NewPage adds a new page to the archive. The started argument is the
+// time relative to which the measurement events are timed.
+func (a *Archive) NewPage(started time.Time, title string) *Page {
+	page := &Page{
+		StartedDateTime: started,
+		ID:              fmt.Sprintf("page_%d", len(a.Log.Pages)+1),
+		Title:           title,
+		PageTimings:     &PageTimings{OnContentLoad: -1, OnLoad: -1},
+	}
+	a.Log.Pages = append(a.Log.Pages, page)
+	return page
+}
+
+// addEntries adds entries to the archive, keeping the
+// entries sorted by starting time.
+func (a *Archive) addEntries(entries ...*Entry) {
+	a.Log.Entries = append(a.Log.Entries, entries...)
+	sort.SliceStable(a.Log.Entries, func(i, j int) bool {
+		return a.Log.Entries[i].StartedDateTime.Before(a.Log.Entries[j].StartedDateTime)
+	})
+}
+
+// dateFormat is the format of the measurement_start_time field.
+const dateFormat = "2006-01-02 15:04:05"
+
+// ErrNoTestKeys indicates that a measurement does not have test keys.
+var ErrNoTestKeys = errors.New("har: measurement without test keys")
+
+// AddMeasurement adds a new page containing the HTTP round
+// trips of the given measurement to the archive.
+func (a *Archive) AddMeasurement(m *model.Measurement) error {
+	if m.TestKeys == nil {
+		return ErrNoTestKeys
+	}
+	started, err := time.Parse(dateFormat, m.MeasurementStartTime)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(m.TestKeys)
+	if err != nil {
+		return err
+	}
+	// measurex experiments have "endpoints" in their test keys.
+	var kind struct {
+		Endpoints json.RawMessage `json:"endpoints"`
+	}
+	if err := json.Unmarshal(data, &kind); err != nil {
+		return err
+	}
+	title := string(m.Input)
+	if title == "" {
+		title = m.TestName
+	}
+	if len(kind.Endpoints) > 0 && string(kind.Endpoints) != "null" {
+		var tk measurex.ArchivalURLMeasurement
+		if err := json.Unmarshal(data, &tk); err != nil {
+			return err
+		}
+		a.AddMeasurexEntries(a.NewPage(started, title), &tk)
+		return nil
+	}
+	var tk NetxTestKeys
+	if err := json.Unmarshal(data, &tk); err != nil {
+		return err
+	}
+	a.AddNetxEntries(a.NewPage(started, title), &tk)
+	return nil
+}
+
+// at converts the seconds elapsed since the beginning
+// of the measurement to a time.Time.
+func (p *Page) at(seconds float64) time.Time {
+	return p.StartedDateTime.Add(time.Duration(seconds * float64(time.Second)))
+}
+
+// millis converts a duration in seconds to milliseconds. We round
+// to the microsecond to avoid floating point noise.
+func millis(seconds float64) float64 {
+	return math.Round(seconds*1e6) / 1e3
+}
+
+// positiveMillis is like millis but returns zero for negative
+// durations, which may happen for phases we cannot measure.
+func positiveMillis(seconds float64) float64 {
+	return math.Max(millis(seconds), 0)
+}
+
+// httpVersion returns the HTTP version given the endpoint
+// network and the protocol negotiated using ALPN.
+func httpVersion(network, alpn string) string {
+	switch {
+	case network == string(measurex.NetworkQUIC):
+		return "HTTP/3"
+	case alpn == "h2":
+		return "HTTP/2.0"
+	default:
+		return "HTTP/1.1"
+	}
+}
+
+// newHeader converts a list of name-value pairs to an http.Header.
+func newHeader(headers []*NameValue) http.Header {
+	out := http.Header{}
+	for _, h := range headers {
+		out.Add(h.Name, h.Value)
+	}
+	return out
+}
+
+// sortHeaders sorts headers by name and then by value.
+func sortHeaders(headers []*NameValue) []*NameValue {
+	sort.SliceStable(headers, func(i, j int) bool {
+		if headers[i].Name != headers[j].Name {
+			return headers[i].Name < headers[j].Name
+		}
+		return headers[i].Value < headers[j].Value
+	})
+	return headers
+}
+
+// newCookies converts a list of cookies.
+func newCookies(in []*http.Cookie) []*Cookie {
+	out := []*Cookie{}
+	for _, c := range in {
+		cookie := &Cookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Path:     c.Path,
+			Domain:   c.Domain,
+			HTTPOnly: c.HttpOnly,
+			Secure:   c.Secure,
+		}
+		if !c.Expires.IsZero() {
+			expires := c.Expires
+			cookie.Expires = &expires
+		}
+		out = append(out, cookie)
+	}
+	return out
+}
+
+// newRequest creates a new Request.
+func newRequest(method, URL, version string, headers []*NameValue, body []byte) *Request {
+	header := newHeader(headers)
+	req := &Request{
+		Method:      method,
+		URL:         URL,
+		HTTPVersion: version,
+		Cookies:     newCookies((&http.Request{Header: header}).Cookies()),
+		Headers:     sortHeaders(headers),
+		QueryString: []*NameValue{},
+		HeadersSize: -1,
+		BodySize:    int64(len(body)),
+	}
+	if u, err := url.Parse(URL); err == nil {
+		for key, values := range u.Query() {
+			for _, value := range values {
+				req.QueryString = append(req.QueryString, &NameValue{Name: key, Value: value})
+			}
+		}
+		sortHeaders(req.QueryString)
+	}
+	if len(body) > 0 {
+		req.PostData = &PostData{
+			MimeType: header.Get("Content-Type"),
+			Text:     string(body),
+		}
+	}
+	return req
+}
+
+// newResponse creates a new Response. The requestURL argument allows
+// us to resolve relative Location headers. A zero status code means
+// that we did not receive any response.
+func newResponse(status int64, version, requestURL string,
+	headers []*NameValue, body []byte, truncated bool) *Response {
+	if status == 0 {
+		return &Response{
+			Cookies:     []*Cookie{},
+			Headers:     []*NameValue{},
+			Content:     &Content{MimeType: "x-unknown"},
+			HeadersSize: -1,
+			BodySize:    -1,
+		}
+	}
+	header := newHeader(headers)
+	resp := &Response{
+		Status:      status,
+		StatusText:  http.StatusText(int(status)),
+		HTTPVersion: version,
+		Cookies:     newCookies((&http.Response{Header: header}).Cookies()),
+		Headers:     sortHeaders(headers),
+		Content:     newContent(body, header.Get("Content-Type"), truncated),
+		RedirectURL: redirectURL(requestURL, header.Get("Location")),
+		HeadersSize: -1,
+		BodySize:    int64(len(body)),
+	}
+	if truncated {
+		resp.BodySize = -1 // we only know the snapshot size
+	}
+	return resp
+}
+
+// newContent creates the Content of a response from a body snapshot.
+func newContent(body []byte, mimeType string, truncated bool) *Content {
+	if mimeType == "" {
+		mimeType = "x-unknown"
+	}
+	content := &Content{
+		Size:     int64(len(body)),
+		MimeType: mimeType,
+	}
+	switch {
+	case utf8.Valid(body):
+		content.Text = string(body)
+	default:
+		content.Text = base64.StdEncoding.EncodeToString(body)
+		content.Encoding = "base64"
+	}
+	if truncated {
+		content.Comment = fmt.Sprintf("body snapshot truncated to %d bytes", len(body))
+	}
+	return content
+}
+
+// redirectURL resolves the location against the request URL.
+func redirectURL(requestURL, location string) string {
+	if location == "" {
+		return ""
+	}
+	base, err := url.Parse(requestURL)
+	if err != nil {
+		return location
+	}
+	ref, err := url.Parse(location)
+	if err != nil {
+		return location
+	}
+	return base.ResolveReference(ref).String()
+}
+
+// stringOrEmpty returns the value of s or an empty string.
+func stringOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
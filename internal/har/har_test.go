@@ -0,0 +1,325 @@
+package har
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/engine/netx/archival"
+	"github.com/ooni/probe-cli/v3/internal/measurex"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+// failure returns a pointer to the given failure.
+func failure(s string) *string {
+	return &s
+}
+
+// newMeasurement creates a new measurement with the given test keys.
+func newMeasurement(tk interface{}) *model.Measurement {
+	return &model.Measurement{
+		Input:                "http://example.com/",
+		MeasurementStartTime: "2021-11-10 14:44:10",
+		TestKeys:             tk,
+		TestName:             "urlgetter",
+	}
+}
+
+// addMeasurement converts the measurement and returns the archive.
+func addMeasurement(t *testing.T, m *model.Measurement) *Archive {
+	archive := NewArchive("miniooni", "3.14.0")
+	if err := archive.AddMeasurement(m); err != nil {
+		t.Fatal(err)
+	}
+	if len(archive.Log.Pages) != 1 {
+		t.Fatal("expected a single page")
+	}
+	return archive
+}
+
+// netxRequest creates a netx request entry.
+func netxRequest(t float64, URL string, code int64, headers http.Header, body string) archival.RequestEntry {
+	entry := archival.RequestEntry{T: t}
+	entry.Request.Method = "GET"
+	entry.Request.URL = URL
+	entry.Request.Transport = "tcp"
+	entry.Request.HeadersList = []archival.HTTPHeader{{
+		Key:   "Cookie",
+		Value: archival.MaybeBinaryValue{Value: "a=b"},
+	}}
+	entry.Response.Code = code
+	for key, values := range headers {
+		for _, value := range values {
+			entry.Response.HeadersList = append(entry.Response.HeadersList, archival.HTTPHeader{
+				Key:   key,
+				Value: archival.MaybeBinaryValue{Value: value},
+			})
+		}
+	}
+	entry.Response.Body.Value = body
+	return entry
+}
+
+// netxEvents creates the network events of a transaction.
+func netxEvents(operations []string, times []float64, address string) (out []archival.NetworkEvent) {
+	for idx, operation := range operations {
+		ev := archival.NetworkEvent{Operation: operation, T: times[idx]}
+		if operation == netxlite.ConnectOperation {
+			ev.Address, ev.Proto = address, "tcp"
+		}
+		out = append(out, ev)
+	}
+	return
+}
+
+func TestAddNetxEntries(t *testing.T) {
+	tk := &NetxTestKeys{
+		// OONI's convention is that the last request appears first
+		Requests: []archival.RequestEntry{
+			netxRequest(0.5, "https://www.example.com/", 200, http.Header{
+				"Content-Type": {"application/octet-stream"},
+			}, "\xff\xfe"),
+			netxRequest(0.1, "http://example.com/?q=1", 301, http.Header{
+				"Location":   {"https://www.example.com/"},
+				"Set-Cookie": {"c=d; Path=/", "e=f"},
+			}, "moved"),
+		},
+		TLSHandshakes: []archival.TLSHandshake{{
+			NegotiatedProtocol: "h2",
+			T:                  0.65,
+		}},
+	}
+	tk.Requests[0].Response.BodyIsTruncated = true
+	tk.NetworkEvents = append(tk.NetworkEvents, netxEvents([]string{
+		"http_transaction_start", "http_request_metadata", "resolve_start",
+		"resolve_done", "connect", "http_response_metadata",
+		"http_response_body_snapshot", "http_transaction_done",
+	}, []float64{0.1, 0.1, 0.11, 0.15, 0.2, 0.3, 0.35, 0.36}, "93.184.216.34:80")...)
+	tk.NetworkEvents = append(tk.NetworkEvents, netxEvents([]string{
+		"http_transaction_start", "http_request_metadata", "resolve_start",
+		"resolve_done", "connect", "tls_handshake_start", "tls_handshake_done",
+		"http_response_metadata", "http_response_body_snapshot", "http_transaction_done",
+	}, []float64{0.5, 0.5, 0.5, 0.52, 0.55, 0.55, 0.65, 0.7, 0.8, 0.8}, "93.184.216.34:443")...)
+	archive := addMeasurement(t, newMeasurement(tk))
+	entries := archive.Log.Entries
+	if len(entries) != 2 {
+		t.Fatal("unexpected number of entries", len(entries))
+	}
+
+	t.Run("the first entry is the redirect", func(t *testing.T) {
+		entry := entries[0]
+		expect := &Timings{Blocked: -1, DNS: 40, Connect: 50, Wait: 100, Receive: 50, SSL: -1}
+		if diff := cmp.Diff(expect, entry.Timings); diff != "" {
+			t.Fatal(diff)
+		}
+		if entry.Time != 240 {
+			t.Fatal("unexpected time", entry.Time)
+		}
+		if entry.Response.RedirectURL != "https://www.example.com/" {
+			t.Fatal("unexpected redirect URL", entry.Response.RedirectURL)
+		}
+		if entry.Response.Content.Text != "moved" || entry.Response.Content.Encoding != "" {
+			t.Fatal("unexpected content", entry.Response.Content)
+		}
+		if len(entry.Response.Cookies) != 2 || len(entry.Request.Cookies) != 1 {
+			t.Fatal("unexpected cookies")
+		}
+		expectQuery := []*NameValue{{Name: "q", Value: "1"}}
+		if diff := cmp.Diff(expectQuery, entry.Request.QueryString); diff != "" {
+			t.Fatal(diff)
+		}
+		if entry.ServerIPAddress != "93.184.216.34" || entry.Request.HTTPVersion != "HTTP/1.1" {
+			t.Fatal("unexpected entry", entry)
+		}
+		if entry.StartedDateTime.Format("15:04:05.000") != "14:44:10.100" {
+			t.Fatal("unexpected started date time", entry.StartedDateTime)
+		}
+	})
+
+	t.Run("the second entry has a binary and truncated body", func(t *testing.T) {
+		entry := entries[1]
+		expect := &Timings{Blocked: -1, DNS: 20, Connect: 130, Wait: 50, Receive: 100, SSL: 100}
+		if diff := cmp.Diff(expect, entry.Timings); diff != "" {
+			t.Fatal(diff)
+		}
+		expectContent := &Content{
+			Size:     2,
+			MimeType: "application/octet-stream",
+			Text:     "//4=",
+			Encoding: "base64",
+			Comment:  "body snapshot truncated to 2 bytes",
+		}
+		if diff := cmp.Diff(expectContent, entry.Response.Content); diff != "" {
+			t.Fatal(diff)
+		}
+		if entry.Response.BodySize != -1 || entry.Response.HTTPVersion != "HTTP/2.0" {
+			t.Fatal("unexpected response", entry.Response)
+		}
+	})
+
+	t.Run("without network events we only know when requests started", func(t *testing.T) {
+		tk.NetworkEvents = nil
+		archive := addMeasurement(t, newMeasurement(tk))
+		expect := &Timings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1}
+		for _, entry := range archive.Log.Entries {
+			if diff := cmp.Diff(expect, entry.Timings); diff != "" {
+				t.Fatal(diff)
+			}
+		}
+	})
+}
+
+// newEndpoint creates the measurement of an endpoint of https://example.com/.
+func newEndpoint(address string, m *measurex.Measurement) *measurex.HTTPEndpointMeasurement {
+	return &measurex.HTTPEndpointMeasurement{
+		URL:         "https://example.com/",
+		Network:     measurex.NetworkTCP,
+		Address:     address,
+		Measurement: m,
+	}
+}
+
+func TestAddMeasurexEntries(t *testing.T) {
+	const (
+		ipv4 = "93.184.216.34"
+		ipv6 = "2606:2800:220:1:248:1893:25c8:1946"
+	)
+	m := &measurex.URLMeasurement{
+		URL: "https://example.com/",
+		DNS: []*measurex.DNSMeasurement{{
+			Domain: "example.com",
+			Measurement: &measurex.Measurement{
+				LookupHost: []*measurex.DNSLookupEvent{{
+					Network:   "system",
+					Domain:    "example.com",
+					QueryType: "ANY",
+					Started:   0.1,
+					Finished:  0.2,
+					A:         []string{ipv4},
+					AAAA:      []string{ipv6},
+				}},
+			},
+		}},
+		Endpoints: []*measurex.HTTPEndpointMeasurement{
+			newEndpoint(ipv4+":443", &measurex.Measurement{
+				Connect: []*measurex.NetworkEvent{{
+					RemoteAddr: ipv4 + ":443",
+					Operation:  "connect",
+					Network:    "tcp",
+					Started:    0.5,
+					Finished:   0.6,
+				}},
+				TLSHandshake: []*measurex.QUICTLSHandshakeEvent{{
+					NegotiatedProto: "h2",
+					RemoteAddr:      ipv4 + ":443",
+					SNI:             "example.com",
+					Network:         "tcp",
+					Started:         0.6,
+					Finished:        0.8,
+				}},
+				HTTPRoundTrip: []*measurex.HTTPRoundTripEvent{{
+					Method:             "GET",
+					URL:                "https://example.com/",
+					RequestHeaders:     http.Header{"Accept": {"*/*"}},
+					StatusCode:         200,
+					ResponseHeaders:    http.Header{"Content-Type": {"text/html"}},
+					ResponseBody:       []byte("<html>"),
+					ResponseBodyLength: 6,
+					ResponseBodyIsUTF8: true,
+					Started:            0.8,
+					Finished:           1.0,
+				}},
+			}),
+			newEndpoint("["+ipv6+"]:443", &measurex.Measurement{
+				Connect: []*measurex.NetworkEvent{{
+					RemoteAddr: "[" + ipv6 + "]:443",
+					Failure:    failure(netxlite.FailureConnectionRefused),
+					Operation:  "connect",
+					Network:    "tcp",
+					Started:    0.5,
+					Finished:   0.7,
+				}},
+			}),
+		},
+	}
+	m.TH = &measurex.THMeasurement{Endpoints: m.Endpoints} // we ignore the TH
+	archive := addMeasurement(t, newMeasurement(measurex.NewArchivalURLMeasurement(m)))
+	entries := archive.Log.Entries
+	if len(entries) != 2 {
+		t.Fatal("unexpected number of entries", len(entries))
+	}
+
+	t.Run("for the successful endpoint", func(t *testing.T) {
+		entry := entries[0]
+		expect := &Timings{Blocked: 300, DNS: 100, Connect: 300, Wait: 200, SSL: 200}
+		if diff := cmp.Diff(expect, entry.Timings); diff != "" {
+			t.Fatal(diff)
+		}
+		if entry.Time != 900 || entry.ServerIPAddress != ipv4 || entry.Failure != "" {
+			t.Fatal("unexpected entry", entry)
+		}
+		if entry.Response.Status != 200 || entry.Response.Content.Text != "<html>" {
+			t.Fatal("unexpected response", entry.Response)
+		}
+		if entry.Response.Content.MimeType != "text/html" || entry.Response.HTTPVersion != "HTTP/2.0" {
+			t.Fatal("unexpected response", entry.Response)
+		}
+		if entry.StartedDateTime.Format("15:04:05.000") != "14:44:10.100" {
+			t.Fatal("unexpected started date time", entry.StartedDateTime)
+		}
+	})
+
+	t.Run("for the endpoint where connect failed", func(t *testing.T) {
+		entry := entries[1]
+		expect := &Timings{Blocked: 300, DNS: 100, Connect: 200, SSL: -1}
+		if diff := cmp.Diff(expect, entry.Timings); diff != "" {
+			t.Fatal(diff)
+		}
+		if entry.Failure != netxlite.FailureConnectionRefused || entry.ServerIPAddress != ipv6 {
+			t.Fatal("unexpected entry", entry)
+		}
+		if entry.Request.URL != "https://example.com/" || entry.Response.Status != 0 {
+			t.Fatal("unexpected entry", entry)
+		}
+	})
+}
+
+func TestAddMeasurement(t *testing.T) {
+	t.Run("without test keys", func(t *testing.T) {
+		archive := NewArchive("miniooni", "3.14.0")
+		err := archive.AddMeasurement(newMeasurement(nil))
+		if !errors.Is(err, ErrNoTestKeys) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+
+	t.Run("with an invalid measurement start time", func(t *testing.T) {
+		archive := NewArchive("miniooni", "3.14.0")
+		m := newMeasurement(&NetxTestKeys{})
+		m.MeasurementStartTime = "antani"
+		if err := archive.AddMeasurement(m); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("we create a page for each measurement", func(t *testing.T) {
+		archive := NewArchive("miniooni", "3.14.0")
+		for _, input := range []model.MeasurementTarget{"", "https://example.com/"} {
+			m := newMeasurement(&NetxTestKeys{})
+			m.Input = input
+			if err := archive.AddMeasurement(m); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var titles []string
+		for _, page := range archive.Log.Pages {
+			titles = append(titles, page.ID+" "+page.Title)
+		}
+		expect := []string{"page_1 urlgetter", "page_2 https://example.com/"}
+		if diff := cmp.Diff(expect, titles); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
@@ -0,0 +1,193 @@
+package har
+
+//
+// Measurex
+//
+// This file converts the test keys of experiments using measurex.
+//
+
+import (
+	"math"
+	"net"
+	"net/url"
+
+	"github.com/ooni/probe-cli/v3/internal/measurex"
+)
+
+// AddMeasurexEntries adds to the page an entry for each HTTP round trip
+// performed by the probe (we ignore the test helper results). When we
+// could not send any request using an endpoint (e.g., because connect
+// failed), we add an entry without response, so that HAR viewers show
+// the failed request. The DNS timing is the time spent resolving the
+// URL's domain, which is the same for all endpoints, and the blocked
+// timing is the time between resolving and connecting. Because measurex
+// does not save when we receive the response headers, we account for
+// the whole round trip as wait time.
+func (a *Archive) AddMeasurexEntries(page *Page, m *measurex.ArchivalURLMeasurement) {
+	dns := newMeasurexDNSPhase(m)
+	var entries []*Entry
+	for _, epnt := range m.Endpoints {
+		entries = append(entries, newMeasurexEntries(page, dns, epnt)...)
+	}
+	a.addEntries(entries...)
+}
+
+// phase is a phase of a measurement (e.g., connect).
+type phase struct {
+	started  float64
+	finished float64
+	failure  *string
+}
+
+// millis returns the duration of the phase or -1 if the phase is nil.
+func (p *phase) millis() float64 {
+	if p == nil {
+		return -1
+	}
+	return positiveMillis(p.finished - p.started)
+}
+
+// newMeasurexDNSPhase returns the phase spanning all the
+// lookups of the URL's domain or nil if there are none.
+func newMeasurexDNSPhase(m *measurex.ArchivalURLMeasurement) (out *phase) {
+	u, err := url.Parse(m.URL)
+	if err != nil {
+		return nil
+	}
+	for _, dns := range m.DNS {
+		if dns.Domain != u.Hostname() || dns.ArchivalMeasurement == nil {
+			continue
+		}
+		for _, ev := range dns.Queries {
+			if out == nil {
+				out = &phase{started: ev.Started, finished: ev.Finished}
+				continue
+			}
+			out.started = math.Min(out.started, ev.Started)
+			out.finished = math.Max(out.finished, ev.Finished)
+		}
+	}
+	return
+}
+
+// newMeasurexConnectPhases returns the connect phase, which includes the
+// TLS or QUIC handshake, the handshake phase, and the negotiated protocol.
+func newMeasurexConnectPhases(m *measurex.ArchivalMeasurement) (connect, handshake *phase, alpn string) {
+	if len(m.TCPConnect) > 0 {
+		ev := m.TCPConnect[0]
+		connect = &phase{started: ev.Started, finished: ev.Finished}
+		if ev.Status != nil {
+			connect.failure = ev.Status.Failure
+		}
+	}
+	var handshakes []*measurex.ArchivalQUICTLSHandshakeEvent
+	handshakes = append(handshakes, m.TLSHandshakes...)
+	handshakes = append(handshakes, m.QUICHandshakes...)
+	if len(handshakes) <= 0 {
+		return
+	}
+	ev := handshakes[0]
+	handshake = &phase{started: ev.Started, finished: ev.Finished, failure: ev.Failure}
+	alpn = ev.NegotiatedProto
+	if connect == nil {
+		connect = &phase{started: ev.Started, finished: ev.Finished, failure: ev.Failure}
+		return
+	}
+	connect.finished = math.Max(connect.finished, ev.Finished)
+	if connect.failure == nil {
+		connect.failure = ev.Failure
+	}
+	return
+}
+
+// setMeasurexSetupTimings sets the timings of the phases preceding the
+// first round trip using an endpoint and returns when the entry started.
+func setMeasurexSetupTimings(t *Timings, dns, connect, handshake *phase, started float64) float64 {
+	if connect != nil {
+		t.Connect = connect.millis()
+		t.SSL = handshake.millis()
+		started = connect.started
+	}
+	if dns != nil {
+		t.DNS = dns.millis()
+		t.Blocked = positiveMillis(started - dns.finished)
+		started = dns.started
+	}
+	return started
+}
+
+// newMeasurexEntries creates the entries for the given endpoint.
+func newMeasurexEntries(page *Page, dns *phase,
+	epnt *measurex.ArchivalHTTPEndpointMeasurement) (out []*Entry) {
+	m := epnt.ArchivalMeasurement
+	if m == nil {
+		m = &measurex.ArchivalMeasurement{}
+	}
+	connect, handshake, alpn := newMeasurexConnectPhases(m)
+	version := httpVersion(string(epnt.Network), alpn)
+	serverIPAddress, _, err := net.SplitHostPort(epnt.Address)
+	if err != nil {
+		serverIPAddress = epnt.Address
+	}
+	for idx, rtx := range m.Requests {
+		if rtx.Request == nil {
+			continue
+		}
+		timings := &Timings{
+			Blocked: -1,
+			DNS:     -1,
+			Connect: -1,
+			Wait:    positiveMillis(rtx.Finished - rtx.Started),
+			SSL:     -1,
+		}
+		started := rtx.Started
+		if idx == 0 {
+			started = setMeasurexSetupTimings(timings, dns, connect, handshake, started)
+		}
+		response := newResponse(0, "", "", nil, nil, false)
+		if resp := rtx.Response; resp != nil {
+			var body []byte
+			if resp.Body != nil {
+				body = resp.Body.Data
+			}
+			response = newResponse(resp.Code, version, rtx.Request.URL,
+				measurexHeaders(resp.Headers), body, resp.BodyIsTruncated)
+		}
+		out = append(out, &Entry{
+			Pageref:         page.ID,
+			StartedDateTime: page.at(started),
+			Time:            timings.total(),
+			Request: newRequest(rtx.Request.Method, rtx.Request.URL, version,
+				measurexHeaders(rtx.Request.Headers), nil),
+			Response:        response,
+			Timings:         timings,
+			ServerIPAddress: serverIPAddress,
+			Failure:         stringOrEmpty(rtx.Failure),
+		})
+	}
+	if len(out) > 0 || connect == nil || connect.failure == nil {
+		return
+	}
+	timings := &Timings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1}
+	started := setMeasurexSetupTimings(timings, dns, connect, handshake, connect.started)
+	out = append(out, &Entry{
+		Pageref:         page.ID,
+		StartedDateTime: page.at(started),
+		Time:            timings.total(),
+		Request:         newRequest("GET", epnt.URL, version, []*NameValue{}, nil),
+		Response:        newResponse(0, "", "", nil, nil, false),
+		Timings:         timings,
+		ServerIPAddress: serverIPAddress,
+		Failure:         *connect.failure,
+	})
+	return
+}
+
+// measurexHeaders converts measurex headers.
+func measurexHeaders(headers measurex.ArchivalHeaders) []*NameValue {
+	out := []*NameValue{}
+	for key, value := range headers {
+		out = append(out, &NameValue{Name: key, Value: value})
+	}
+	return out
+}
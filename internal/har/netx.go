@@ -0,0 +1,209 @@
+package har
+
+//
+// Netx
+//
+// This file converts the test keys of experiments using netx.
+//
+
+import (
+	"math"
+	"net"
+	"sort"
+
+	"github.com/ooni/probe-cli/v3/internal/engine/netx/archival"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+// NetxTestKeys contains the fields of the test keys of experiments
+// using netx (e.g., urlgetter) that we need to create HAR entries.
+type NetxTestKeys struct {
+	NetworkEvents []archival.NetworkEvent `json:"network_events"`
+	Requests      []archival.RequestEntry `json:"requests"`
+	TLSHandshakes []archival.TLSHandshake `json:"tls_handshakes"`
+}
+
+// AddNetxEntries adds to the page an entry for each request in tk,
+// including the requests that follow redirects. We compute the timings
+// using the network events, which netx saves when the HTTP transaction
+// starts, when resolving, connecting and handshaking, when receiving
+// the response headers and body, and when the transaction is done. When
+// there are no network events, we only know when each request started.
+func (a *Archive) AddNetxEntries(page *Page, tk *NetxTestKeys) {
+	// OONI's convention is that the last request appears first
+	var requests []archival.RequestEntry
+	for i := len(tk.Requests) - 1; i >= 0; i-- {
+		requests = append(requests, tk.Requests[i])
+	}
+	sort.SliceStable(requests, func(i, j int) bool {
+		return requests[i].T < requests[j].T
+	})
+	transactions := netxTransactions(tk.NetworkEvents)
+	var entries []*Entry
+	for idx := range requests {
+		var events []archival.NetworkEvent
+		if idx < len(transactions) {
+			events = transactions[idx]
+		}
+		entries = append(entries, newNetxEntry(page, &requests[idx], events, tk.TLSHandshakes))
+	}
+	a.addEntries(entries...)
+}
+
+// netxTransactions splits the network events by HTTP transaction.
+func netxTransactions(events []archival.NetworkEvent) (out [][]archival.NetworkEvent) {
+	var current []archival.NetworkEvent
+	for _, ev := range events {
+		switch ev.Operation {
+		case "http_transaction_start":
+			current = []archival.NetworkEvent{ev}
+		case "http_transaction_done":
+			if current != nil {
+				out = append(out, append(current, ev))
+				current = nil
+			}
+		default:
+			if current != nil {
+				current = append(current, ev)
+			}
+		}
+	}
+	return
+}
+
+// newNetxEntry creates a new Entry for the given request.
+func newNetxEntry(page *Page, req *archival.RequestEntry,
+	events []archival.NetworkEvent, handshakes []archival.TLSHandshake) *Entry {
+	timings := newNetxTimings(events)
+	version := httpVersion(req.Request.Transport, netxALPN(events, handshakes))
+	return &Entry{
+		Pageref:         page.ID,
+		StartedDateTime: page.at(req.T),
+		Time:            timings.total(),
+		Request: newRequest(
+			req.Request.Method, req.Request.URL, version,
+			netxHeaders(req.Request.HeadersList, req.Request.Headers),
+			[]byte(req.Request.Body.Value),
+		),
+		Response: newResponse(
+			req.Response.Code, version, req.Request.URL,
+			netxHeaders(req.Response.HeadersList, req.Response.Headers),
+			[]byte(req.Response.Body.Value), req.Response.BodyIsTruncated,
+		),
+		Timings:         timings,
+		ServerIPAddress: netxServerIPAddress(events),
+		Failure:         stringOrEmpty(req.Failure),
+	}
+}
+
+// newNetxTimings computes the timings of a transaction. Since netx only
+// saves when we finished connecting, we assume that we started connecting
+// when we finished resolving or, if we did not resolve, when we started
+// sending the request. Since netx does not save when we finished sending
+// the request, we account for that time as part of the wait time.
+func newNetxTimings(events []archival.NetworkEvent) *Timings {
+	t := &Timings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1}
+	if len(events) <= 0 {
+		return t
+	}
+	first, last := map[string]float64{}, map[string]float64{}
+	for _, ev := range events {
+		if _, found := first[ev.Operation]; !found {
+			first[ev.Operation] = ev.T
+		}
+		last[ev.Operation] = ev.T
+	}
+	setupDone := events[0].T
+	if v, found := first["http_request_metadata"]; found {
+		setupDone = v
+	}
+	if start, found := first["resolve_start"]; found {
+		if done, found := first["resolve_done"]; found {
+			t.DNS = positiveMillis(done - start)
+			setupDone = done
+		}
+	}
+	connectDone, connected := last[netxlite.ConnectOperation]
+	for _, prefix := range []string{"tls", "quic"} {
+		start, foundStart := first[prefix+"_handshake_start"]
+		done, foundDone := first[prefix+"_handshake_done"]
+		if foundStart && foundDone {
+			t.SSL = positiveMillis(done - start)
+			connectDone, connected = math.Max(connectDone, done), true
+		}
+	}
+	if connected {
+		t.Connect = positiveMillis(connectDone - setupDone)
+		setupDone = connectDone
+	}
+	done := last["http_transaction_done"]
+	if headers, found := first["http_response_metadata"]; found {
+		t.Wait = positiveMillis(headers - setupDone)
+		if body, found := first["http_response_body_snapshot"]; found {
+			done = body
+		}
+		t.Receive = positiveMillis(done - headers)
+		return t
+	}
+	t.Wait = positiveMillis(done - setupDone)
+	return t
+}
+
+// netxALPN returns the protocol negotiated by the handshake that
+// occurred during the transaction, if any.
+func netxALPN(events []archival.NetworkEvent, handshakes []archival.TLSHandshake) string {
+	for _, ev := range events {
+		if ev.Operation != "tls_handshake_done" && ev.Operation != "quic_handshake_done" {
+			continue
+		}
+		for _, hs := range handshakes {
+			if hs.T == ev.T {
+				return hs.NegotiatedProtocol
+			}
+		}
+	}
+	return ""
+}
+
+// netxServerIPAddress returns the IP address of the server we successfully
+// connected to or, for QUIC, the last one we sent datagrams to. (We also send
+// datagrams to DNS-over-UDP resolvers, but we do that before using QUIC.)
+func netxServerIPAddress(events []archival.NetworkEvent) string {
+	var connect, writeTo string
+	for _, ev := range events {
+		if ev.Failure != nil {
+			continue
+		}
+		addr, _, err := net.SplitHostPort(ev.Address)
+		if err != nil {
+			continue
+		}
+		switch ev.Operation {
+		case netxlite.ConnectOperation:
+			connect = addr
+		case netxlite.WriteToOperation:
+			writeTo = addr
+		}
+	}
+	if connect != "" {
+		return connect
+	}
+	return writeTo
+}
+
+// netxHeaders converts netx headers. We prefer the list representation
+// because the map one only contains the first value of each header.
+func netxHeaders(list []archival.HTTPHeader,
+	headers map[string]archival.MaybeBinaryValue) []*NameValue {
+	out := []*NameValue{}
+	if len(list) > 0 {
+		for _, h := range list {
+			out = append(out, &NameValue{Name: h.Key, Value: h.Value.Value})
+		}
+		return out
+	}
+	for key, value := range headers {
+		out = append(out, &NameValue{Name: key, Value: value.Value})
+	}
+	return out
+}
@@ -0,0 +1,135 @@
+// Package analysis compares the results of the probe with the
+// results of the test helper (TH) for a measurex.URLMeasurement.
+//
+// measurex marks unexpected results (e.g., a TCP connect timeout)
+// with an Oddity. An oddity alone does not indicate censorship, since
+// the server may be down. Here we promote an oddity to an anomaly
+// when the TH sees a different result, and we produce a verdict for
+// each DNS lookup, for each endpoint and for the whole URL.
+package analysis
+
+import (
+	"github.com/ooni/probe-cli/v3/internal/measurex"
+)
+
+// Verdict is the result of comparing the probe and the TH.
+type Verdict string
+
+// This enumeration lists all the possible verdicts.
+const (
+	// VerdictConsistent means that the probe and the TH saw
+	// the same results, including the same failures.
+	VerdictConsistent = Verdict("consistent")
+
+	// VerdictBlockedDNS means that the probe DNS results are
+	// not consistent with the TH results.
+	VerdictBlockedDNS = Verdict("blocked-dns")
+
+	// VerdictBlockedTCP means that the probe cannot connect
+	// while the TH can.
+	VerdictBlockedTCP = Verdict("blocked-tcp")
+
+	// VerdictBlockedTLS means that the probe TLS or QUIC handshake
+	// fails while the TH handshake succeeds.
+	VerdictBlockedTLS = Verdict("blocked-tls")
+
+	// VerdictBlockedHTTP means that the probe HTTP round trip fails
+	// or returns a different status code than the TH one.
+	VerdictBlockedHTTP = Verdict("blocked-http")
+
+	// VerdictInconclusive means that we cannot tell whether there
+	// is blocking (e.g., because we could not contact the TH).
+	VerdictInconclusive = Verdict("inconclusive")
+)
+
+// IsBlocked returns whether the verdict indicates blocking.
+func (v Verdict) IsBlocked() bool {
+	switch v {
+	case VerdictBlockedDNS, VerdictBlockedTCP, VerdictBlockedTLS, VerdictBlockedHTTP:
+		return true
+	default:
+		return false
+	}
+}
+
+// URLAnalysis is the analysis of a measurex.URLMeasurement.
+type URLAnalysis struct {
+	// URL is the URL we measured.
+	URL string `json:"url"`
+
+	// Verdict is the verdict for the URL.
+	Verdict Verdict `json:"verdict"`
+
+	// Explanation explains the verdict.
+	Explanation string `json:"explanation"`
+
+	// Accessible indicates whether the probe fetched the URL
+	// and got the same status code as the TH.
+	Accessible bool `json:"accessible"`
+
+	// DNS contains the analysis of each DNS lookup.
+	DNS []*DNSAnalysis `json:"dns"`
+
+	// Endpoints contains the analysis of each endpoint.
+	Endpoints []*EndpointAnalysis `json:"endpoints"`
+}
+
+// AnalyzeURL analyzes the given URL measurement.
+func AnalyzeURL(m *measurex.URLMeasurement) *URLAnalysis {
+	out := &URLAnalysis{URL: m.URL}
+	for _, dns := range m.DNS {
+		for _, ev := range dns.LookupHost {
+			out.DNS = append(out.DNS, analyzeDNSLookup(ev, m.TH))
+		}
+	}
+	for _, epnt := range m.Endpoints {
+		out.Endpoints = append(out.Endpoints, analyzeEndpoint(epnt, m.TH))
+	}
+	out.Verdict, out.Explanation, out.Accessible = out.summarize()
+	return out
+}
+
+// layers contains the endpoint verdicts indicating blocking in the order
+// in which we check them. When the endpoints are blocked in different ways
+// (e.g., some fail to connect and others fail the TLS handshake), we use the
+// verdict for the lowest layer.
+var layers = []Verdict{VerdictBlockedTCP, VerdictBlockedTLS, VerdictBlockedHTTP}
+
+// summarize computes the verdict for the URL from the verdicts for
+// the DNS lookups and the endpoints. DNS blocking prevails, since
+// it affects every user of the blocked resolver, even if we could
+// fetch the URL using addresses from other resolvers. Otherwise, the
+// URL is accessible if at least one endpoint worked as expected.
+func (a *URLAnalysis) summarize() (Verdict, string, bool) {
+	for _, dns := range a.DNS {
+		if dns.Verdict == VerdictBlockedDNS {
+			return dns.Verdict, dns.Explanation, false
+		}
+	}
+	for _, epnt := range a.Endpoints {
+		if epnt.Verdict == VerdictConsistent && epnt.Failure == "" {
+			return VerdictConsistent, "the probe fetched the URL from " + epnt.Address, true
+		}
+	}
+	for _, layer := range layers {
+		for _, epnt := range a.Endpoints {
+			if epnt.Verdict == layer {
+				return epnt.Verdict, epnt.Explanation, false
+			}
+		}
+	}
+	if len(a.DNS) <= 0 && len(a.Endpoints) <= 0 {
+		return VerdictInconclusive, "there is nothing to analyze", false
+	}
+	for _, dns := range a.DNS {
+		if dns.Verdict != VerdictConsistent {
+			return VerdictInconclusive, dns.Explanation, false
+		}
+	}
+	for _, epnt := range a.Endpoints {
+		if epnt.Verdict != VerdictConsistent {
+			return VerdictInconclusive, epnt.Explanation, false
+		}
+	}
+	return VerdictConsistent, "the probe and the test helper fail in the same way", false
+}
@@ -0,0 +1,304 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/ooni/probe-cli/v3/internal/measurex"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+// failure returns a pointer to the given failure.
+func failure(s string) *string {
+	return &s
+}
+
+// newDNS returns a DNS measurement for example.com.
+func newDNS(failure *string, addrs ...string) *measurex.DNSMeasurement {
+	return &measurex.DNSMeasurement{
+		Domain: "example.com",
+		Measurement: &measurex.Measurement{
+			LookupHost: []*measurex.DNSLookupEvent{{
+				Network:   "system",
+				Failure:   failure,
+				Domain:    "example.com",
+				QueryType: "A",
+				A:         addrs,
+			}},
+		},
+	}
+}
+
+// endpointResult describes the result of an endpoint measurement.
+type endpointResult struct {
+	connect    *string
+	handshake  *string
+	roundTrip  *string
+	statusCode int64
+}
+
+// newEndpoint returns an endpoint measurement for https://example.com/.
+func newEndpoint(address string, r endpointResult) *measurex.HTTPEndpointMeasurement {
+	m := &measurex.Measurement{
+		Connect: []*measurex.NetworkEvent{{
+			Operation:  "connect",
+			Network:    "tcp",
+			RemoteAddr: address,
+			Failure:    r.connect,
+		}},
+	}
+	if r.connect == nil {
+		m.TLSHandshake = []*measurex.QUICTLSHandshakeEvent{{
+			RemoteAddr: address,
+			SNI:        "example.com",
+			Failure:    r.handshake,
+		}}
+	}
+	if r.connect == nil && r.handshake == nil {
+		m.HTTPRoundTrip = []*measurex.HTTPRoundTripEvent{{
+			Method:     "GET",
+			URL:        "https://example.com/",
+			Failure:    r.roundTrip,
+			StatusCode: r.statusCode,
+		}}
+	}
+	return &measurex.HTTPEndpointMeasurement{
+		URL:         "https://example.com/",
+		Network:     measurex.NetworkTCP,
+		Address:     address,
+		Measurement: m,
+	}
+}
+
+var (
+	// success is the result of a successful fetch.
+	success = endpointResult{statusCode: 200}
+
+	// timeout is the result of a connect timeout.
+	timeout = endpointResult{connect: failure(netxlite.FailureGenericTimeoutError)}
+)
+
+func TestAnalyzeURL(t *testing.T) {
+	const (
+		addr    = "93.184.216.34"
+		epnt    = "93.184.216.34:443"
+		bogon   = "10.10.34.35"
+		cdnEpnt = "104.16.1.1:443"
+	)
+
+	type testcase struct {
+		name       string
+		m          *measurex.URLMeasurement
+		verdict    Verdict
+		dnsVerdict Verdict
+		accessible bool
+	}
+
+	var testcases = []testcase{{
+		name: "without the test helper",
+		m: &measurex.URLMeasurement{
+			DNS:       []*measurex.DNSMeasurement{newDNS(nil, addr)},
+			Endpoints: []*measurex.HTTPEndpointMeasurement{newEndpoint(epnt, success)},
+		},
+		verdict:    VerdictInconclusive,
+		dnsVerdict: VerdictInconclusive,
+	}, {
+		name: "when everything is consistent",
+		m: &measurex.URLMeasurement{
+			DNS:       []*measurex.DNSMeasurement{newDNS(nil, addr)},
+			Endpoints: []*measurex.HTTPEndpointMeasurement{newEndpoint(epnt, success)},
+			TH: &measurex.THMeasurement{
+				DNS:       []*measurex.DNSMeasurement{newDNS(nil, addr)},
+				Endpoints: []*measurex.HTTPEndpointMeasurement{newEndpoint(epnt, success)},
+			},
+		},
+		verdict:    VerdictConsistent,
+		dnsVerdict: VerdictConsistent,
+		accessible: true,
+	}, {
+		name: "when the probe resolves a bogon",
+		m: &measurex.URLMeasurement{
+			DNS: []*measurex.DNSMeasurement{newDNS(nil, bogon)},
+			Endpoints: []*measurex.HTTPEndpointMeasurement{
+				newEndpoint(bogon+":443", timeout),
+			},
+			TH: &measurex.THMeasurement{
+				DNS:       []*measurex.DNSMeasurement{newDNS(nil, addr)},
+				Endpoints: []*measurex.HTTPEndpointMeasurement{newEndpoint(epnt, success)},
+			},
+		},
+		verdict:    VerdictBlockedDNS,
+		dnsVerdict: VerdictBlockedDNS,
+	}, {
+		name: "when only the probe gets NXDOMAIN",
+		m: &measurex.URLMeasurement{
+			DNS: []*measurex.DNSMeasurement{
+				newDNS(failure(netxlite.FailureDNSNXDOMAINError)),
+			},
+			TH: &measurex.THMeasurement{
+				DNS:       []*measurex.DNSMeasurement{newDNS(nil, addr)},
+				Endpoints: []*measurex.HTTPEndpointMeasurement{newEndpoint(epnt, success)},
+			},
+		},
+		verdict:    VerdictBlockedDNS,
+		dnsVerdict: VerdictBlockedDNS,
+	}, {
+		name: "when both get NXDOMAIN",
+		m: &measurex.URLMeasurement{
+			DNS: []*measurex.DNSMeasurement{
+				newDNS(failure(netxlite.FailureDNSNXDOMAINError)),
+			},
+			TH: &measurex.THMeasurement{
+				DNS: []*measurex.DNSMeasurement{
+					newDNS(failure(netxlite.FailureDNSNXDOMAINError)),
+				},
+			},
+		},
+		verdict:    VerdictConsistent,
+		dnsVerdict: VerdictConsistent,
+	}, {
+		name: "when the TH cannot use the addresses resolved by the probe",
+		m: &measurex.URLMeasurement{
+			DNS: []*measurex.DNSMeasurement{newDNS(nil, "104.16.1.1")},
+			Endpoints: []*measurex.HTTPEndpointMeasurement{
+				newEndpoint(cdnEpnt, endpointResult{
+					handshake: failure(netxlite.FailureSSLInvalidHostname),
+				}),
+			},
+			TH: &measurex.THMeasurement{
+				DNS: []*measurex.DNSMeasurement{newDNS(nil, addr)},
+				Endpoints: []*measurex.HTTPEndpointMeasurement{
+					newEndpoint(epnt, success),
+					newEndpoint(cdnEpnt, endpointResult{
+						handshake: failure(netxlite.FailureSSLInvalidHostname),
+					}),
+				},
+			},
+		},
+		verdict:    VerdictBlockedDNS,
+		dnsVerdict: VerdictBlockedDNS,
+	}, {
+		name: "when the TH can use the addresses resolved by the probe",
+		m: &measurex.URLMeasurement{
+			DNS:       []*measurex.DNSMeasurement{newDNS(nil, "104.16.1.1")},
+			Endpoints: []*measurex.HTTPEndpointMeasurement{newEndpoint(cdnEpnt, success)},
+			TH: &measurex.THMeasurement{
+				DNS: []*measurex.DNSMeasurement{newDNS(nil, addr)},
+				Endpoints: []*measurex.HTTPEndpointMeasurement{
+					newEndpoint(epnt, success),
+					newEndpoint(cdnEpnt, success),
+				},
+			},
+		},
+		verdict:    VerdictConsistent,
+		dnsVerdict: VerdictConsistent,
+		accessible: true,
+	}, {
+		name: "when only the probe cannot connect",
+		m: &measurex.URLMeasurement{
+			DNS:       []*measurex.DNSMeasurement{newDNS(nil, addr)},
+			Endpoints: []*measurex.HTTPEndpointMeasurement{newEndpoint(epnt, timeout)},
+			TH: &measurex.THMeasurement{
+				DNS:       []*measurex.DNSMeasurement{newDNS(nil, addr)},
+				Endpoints: []*measurex.HTTPEndpointMeasurement{newEndpoint(epnt, success)},
+			},
+		},
+		verdict:    VerdictBlockedTCP,
+		dnsVerdict: VerdictConsistent,
+	}, {
+		name: "when only the probe handshake fails",
+		m: &measurex.URLMeasurement{
+			DNS: []*measurex.DNSMeasurement{newDNS(nil, addr)},
+			Endpoints: []*measurex.HTTPEndpointMeasurement{
+				newEndpoint(epnt, endpointResult{
+					handshake: failure(netxlite.FailureConnectionReset),
+				}),
+			},
+			TH: &measurex.THMeasurement{
+				DNS:       []*measurex.DNSMeasurement{newDNS(nil, addr)},
+				Endpoints: []*measurex.HTTPEndpointMeasurement{newEndpoint(epnt, success)},
+			},
+		},
+		verdict:    VerdictBlockedTLS,
+		dnsVerdict: VerdictConsistent,
+	}, {
+		name: "when the status codes differ",
+		m: &measurex.URLMeasurement{
+			DNS: []*measurex.DNSMeasurement{newDNS(nil, addr)},
+			Endpoints: []*measurex.HTTPEndpointMeasurement{
+				newEndpoint(epnt, endpointResult{statusCode: 403}),
+			},
+			TH: &measurex.THMeasurement{
+				DNS:       []*measurex.DNSMeasurement{newDNS(nil, addr)},
+				Endpoints: []*measurex.HTTPEndpointMeasurement{newEndpoint(epnt, success)},
+			},
+		},
+		verdict:    VerdictBlockedHTTP,
+		dnsVerdict: VerdictConsistent,
+	}, {
+		name: "when both cannot connect",
+		m: &measurex.URLMeasurement{
+			DNS:       []*measurex.DNSMeasurement{newDNS(nil, addr)},
+			Endpoints: []*measurex.HTTPEndpointMeasurement{newEndpoint(epnt, timeout)},
+			TH: &measurex.THMeasurement{
+				DNS:       []*measurex.DNSMeasurement{newDNS(nil, addr)},
+				Endpoints: []*measurex.HTTPEndpointMeasurement{newEndpoint(epnt, timeout)},
+			},
+		},
+		verdict:    VerdictConsistent,
+		dnsVerdict: VerdictConsistent,
+	}, {
+		name: "when one of the endpoints works",
+		m: &measurex.URLMeasurement{
+			DNS: []*measurex.DNSMeasurement{newDNS(nil, addr, "93.184.216.35")},
+			Endpoints: []*measurex.HTTPEndpointMeasurement{
+				newEndpoint(epnt, timeout),
+				newEndpoint("93.184.216.35:443", success),
+			},
+			TH: &measurex.THMeasurement{
+				DNS: []*measurex.DNSMeasurement{newDNS(nil, addr, "93.184.216.35")},
+				Endpoints: []*measurex.HTTPEndpointMeasurement{
+					newEndpoint(epnt, success),
+					newEndpoint("93.184.216.35:443", success),
+				},
+			},
+		},
+		verdict:    VerdictConsistent,
+		dnsVerdict: VerdictConsistent,
+		accessible: true,
+	}}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.m.URL = "https://example.com/"
+			a := AnalyzeURL(tc.m)
+			if a.Verdict != tc.verdict {
+				t.Fatal("unexpected verdict", a.Verdict, a.Explanation)
+			}
+			if a.Explanation == "" {
+				t.Fatal("expected an explanation")
+			}
+			if a.Accessible != tc.accessible {
+				t.Fatal("unexpected accessible", a.Accessible)
+			}
+			if len(a.DNS) != 1 || a.DNS[0].Verdict != tc.dnsVerdict {
+				t.Fatal("unexpected DNS analysis", a.DNS)
+			}
+			if len(a.Endpoints) != len(tc.m.Endpoints) {
+				t.Fatal("unexpected number of endpoint analyses")
+			}
+		})
+	}
+}
+
+func TestVerdictIsBlocked(t *testing.T) {
+	for _, v := range []Verdict{VerdictConsistent, VerdictInconclusive} {
+		if v.IsBlocked() {
+			t.Fatal("unexpected blocked verdict", v)
+		}
+	}
+	for _, v := range []Verdict{VerdictBlockedDNS, VerdictBlockedTCP, VerdictBlockedTLS, VerdictBlockedHTTP} {
+		if !v.IsBlocked() {
+			t.Fatal("expected a blocked verdict", v)
+		}
+	}
+}
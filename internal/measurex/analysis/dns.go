@@ -0,0 +1,178 @@
+package analysis
+
+//
+// DNS
+//
+// This file contains the analysis of the DNS lookups.
+//
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/ooni/probe-cli/v3/internal/measurex"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+// DNSAnalysis is the analysis of a probe DNS lookup.
+type DNSAnalysis struct {
+	// Domain is the domain we resolved.
+	Domain string `json:"domain"`
+
+	// QueryType is the query type (e.g., "A").
+	QueryType string `json:"query_type"`
+
+	// ResolverNetwork is the network of the resolver (e.g., "system").
+	ResolverNetwork string `json:"resolver_network"`
+
+	// ResolverAddress is the address of the resolver (if any).
+	ResolverAddress string `json:"resolver_address"`
+
+	// Verdict is the verdict for the lookup.
+	Verdict Verdict `json:"verdict"`
+
+	// Explanation explains the verdict.
+	Explanation string `json:"explanation"`
+}
+
+// analyzeDNSLookup compares a probe lookup with the TH lookups for the
+// same domain and query type. When the probe and the TH addresses do
+// not overlap (which is common for CDNs), we check whether the TH could
+// use the probe addresses, since the TH also measures the endpoints
+// discovered by the probe.
+func analyzeDNSLookup(ev *measurex.DNSLookupEvent, th *measurex.THMeasurement) *DNSAnalysis {
+	out := &DNSAnalysis{
+		Domain:          ev.Domain,
+		QueryType:       ev.QueryType,
+		ResolverNetwork: ev.Network,
+		ResolverAddress: ev.Address,
+	}
+	out.Verdict, out.Explanation = compareDNSLookup(ev, th)
+	return out
+}
+
+func compareDNSLookup(ev *measurex.DNSLookupEvent, th *measurex.THMeasurement) (Verdict, string) {
+	if th == nil {
+		return VerdictInconclusive, "we do not have any test helper measurement"
+	}
+	thLookups := lookupsForDomain(th, ev.Domain, ev.QueryType)
+	if len(thLookups) <= 0 {
+		return VerdictInconclusive, "the test helper did not resolve " + ev.Domain
+	}
+	if ev.Failure != nil {
+		var thFailures []string
+		for _, thev := range thLookups {
+			if thev.Failure == nil {
+				return VerdictBlockedDNS, fmt.Sprintf(
+					"the probe failed to resolve %s with %s, while the test helper resolved it",
+					ev.Domain, *ev.Failure)
+			}
+			thFailures = append(thFailures, *thev.Failure)
+		}
+		for _, failure := range thFailures {
+			if failure != *ev.Failure {
+				return VerdictInconclusive, fmt.Sprintf(
+					"the probe failed to resolve %s with %s, while the test helper failed with %s",
+					ev.Domain, *ev.Failure, strings.Join(thFailures, ", "))
+			}
+		}
+		return VerdictConsistent, fmt.Sprintf(
+			"both the probe and the test helper failed to resolve %s with %s",
+			ev.Domain, *ev.Failure)
+	}
+	thAddrs := map[string]bool{}
+	for _, thev := range thLookups {
+		for _, addr := range thev.Addrs() {
+			thAddrs[addr] = true
+		}
+	}
+	probeAddrs := ev.Addrs()
+	if len(probeAddrs) <= 0 {
+		if len(thAddrs) <= 0 {
+			return VerdictConsistent, fmt.Sprintf(
+				"neither the probe nor the test helper found %s addresses for %s",
+				ev.QueryType, ev.Domain)
+		}
+		return VerdictInconclusive, fmt.Sprintf(
+			"the probe did not find %s addresses for %s, while the test helper did",
+			ev.QueryType, ev.Domain)
+	}
+	for _, addr := range probeAddrs {
+		if netxlite.IsBogon(addr) && !thAddrs[addr] {
+			return VerdictBlockedDNS, fmt.Sprintf(
+				"the probe resolved %s to the bogon address %s", ev.Domain, addr)
+		}
+	}
+	for _, addr := range probeAddrs {
+		if thAddrs[addr] {
+			return VerdictConsistent, fmt.Sprintf(
+				"the probe and the test helper both resolved %s to %s", ev.Domain, addr)
+		}
+	}
+	unknown := false
+	for _, addr := range probeAddrs {
+		switch thWorksWithAddress(th, addr) {
+		case addressWorks:
+			return VerdictConsistent, fmt.Sprintf(
+				"the test helper successfully used %s, which the probe resolved for %s",
+				addr, ev.Domain)
+		case addressUnknown:
+			unknown = true
+		}
+	}
+	if unknown {
+		return VerdictInconclusive, fmt.Sprintf(
+			"the probe and the test helper resolved %s to different addresses", ev.Domain)
+	}
+	return VerdictBlockedDNS, fmt.Sprintf(
+		"the test helper cannot use any of the addresses the probe resolved for %s (%s)",
+		ev.Domain, strings.Join(probeAddrs, ", "))
+}
+
+// lookupsForDomain returns the TH lookups for the domain and query type.
+func lookupsForDomain(th *measurex.THMeasurement,
+	domain, qtype string) (out []*measurex.DNSLookupEvent) {
+	for _, dns := range th.DNS {
+		if dns.Domain != domain {
+			continue
+		}
+		for _, ev := range dns.LookupHost {
+			if ev.QueryType == qtype {
+				out = append(out, ev)
+			}
+		}
+	}
+	return
+}
+
+// addressStatus tells whether the TH could use an address.
+type addressStatus int
+
+const (
+	// addressUnknown means the TH did not measure the address.
+	addressUnknown = addressStatus(iota)
+
+	// addressWorks means the TH fetched using the address.
+	addressWorks
+
+	// addressFails means all the TH fetches using the address failed.
+	addressFails
+)
+
+// thWorksWithAddress tells whether the TH fetched the URL using
+// an endpoint with the given IP address.
+func thWorksWithAddress(th *measurex.THMeasurement, addr string) addressStatus {
+	status := addressUnknown
+	for _, epnt := range th.Endpoints {
+		host, _, err := net.SplitHostPort(epnt.Address)
+		if err != nil || host != addr {
+			continue
+		}
+		if step, _ := firstFailure(epnt); step == "" && len(epnt.HTTPRoundTrip) > 0 {
+			return addressWorks
+		}
+		status = addressFails
+	}
+	return status
+}
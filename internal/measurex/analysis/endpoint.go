@@ -0,0 +1,144 @@
+package analysis
+
+//
+// Endpoint
+//
+// This file contains the analysis of the endpoints.
+//
+
+import (
+	"fmt"
+
+	"github.com/ooni/probe-cli/v3/internal/measurex"
+)
+
+// EndpointAnalysis is the analysis of a probe endpoint measurement.
+type EndpointAnalysis struct {
+	// URL is the URL we fetched.
+	URL string `json:"url"`
+
+	// Network is the endpoint network (e.g., "tcp").
+	Network measurex.EndpointNetwork `json:"network"`
+
+	// Address is the endpoint address (e.g., "8.8.8.8:443").
+	Address string `json:"address"`
+
+	// Failure is the first failure seen by the probe or empty.
+	Failure string `json:"failure"`
+
+	// Verdict is the verdict for the endpoint.
+	Verdict Verdict `json:"verdict"`
+
+	// Explanation explains the verdict.
+	Explanation string `json:"explanation"`
+}
+
+// analyzeEndpoint compares a probe endpoint measurement with the
+// TH measurement of the same endpoint.
+func analyzeEndpoint(
+	epnt *measurex.HTTPEndpointMeasurement, th *measurex.THMeasurement) *EndpointAnalysis {
+	out := &EndpointAnalysis{
+		URL:     epnt.URL,
+		Network: epnt.Network,
+		Address: epnt.Address,
+	}
+	var step Verdict
+	step, out.Failure = firstFailure(epnt)
+	out.Verdict, out.Explanation = compareEndpoint(epnt, step, out.Failure, th)
+	return out
+}
+
+func compareEndpoint(epnt *measurex.HTTPEndpointMeasurement,
+	step Verdict, failure string, th *measurex.THMeasurement) (Verdict, string) {
+	if th == nil {
+		return VerdictInconclusive, "we do not have any test helper measurement"
+	}
+	thEpnt := findEndpoint(th, epnt)
+	if thEpnt == nil {
+		return VerdictInconclusive, "the test helper did not measure " + epnt.Address
+	}
+	thStep, thFailure := firstFailure(thEpnt)
+	switch {
+	case step == "" && thStep == "":
+		code, thCode := lastStatusCode(epnt), lastStatusCode(thEpnt)
+		if code != thCode {
+			return VerdictBlockedHTTP, fmt.Sprintf(
+				"the probe got status code %d from %s, while the test helper got %d",
+				code, epnt.Address, thCode)
+		}
+		return VerdictConsistent, fmt.Sprintf(
+			"the probe and the test helper got status code %d from %s", code, epnt.Address)
+	case step == "":
+		return VerdictInconclusive, fmt.Sprintf(
+			"the probe fetched from %s, while the test helper failed with %s",
+			epnt.Address, thFailure)
+	case thStep == "" || layerIndex(thStep) > layerIndex(step):
+		return step, fmt.Sprintf(
+			"the probe failed with %s using %s, while the test helper did not",
+			failure, epnt.Address)
+	case thStep == step && thFailure == failure:
+		return VerdictConsistent, fmt.Sprintf(
+			"both the probe and the test helper failed with %s using %s",
+			failure, epnt.Address)
+	default:
+		return VerdictInconclusive, fmt.Sprintf(
+			"the probe failed with %s using %s, while the test helper failed with %s",
+			failure, epnt.Address, thFailure)
+	}
+}
+
+// findEndpoint returns the TH measurement of the given endpoint or nil.
+func findEndpoint(th *measurex.THMeasurement,
+	epnt *measurex.HTTPEndpointMeasurement) *measurex.HTTPEndpointMeasurement {
+	for _, thEpnt := range th.Endpoints {
+		if thEpnt.Network == epnt.Network && thEpnt.Address == epnt.Address {
+			return thEpnt
+		}
+	}
+	return nil
+}
+
+// firstFailure returns the first failure of an endpoint measurement, if
+// any, along with the verdict we would emit if the failure is blocking. We
+// return empty strings if the endpoint measurement did not fail.
+func firstFailure(epnt *measurex.HTTPEndpointMeasurement) (Verdict, string) {
+	for _, ev := range epnt.Connect {
+		if ev.Failure != nil {
+			return VerdictBlockedTCP, *ev.Failure
+		}
+	}
+	for _, ev := range epnt.TLSHandshake {
+		if ev.Failure != nil {
+			return VerdictBlockedTLS, *ev.Failure
+		}
+	}
+	for _, ev := range epnt.QUICHandshake {
+		if ev.Failure != nil {
+			return VerdictBlockedTLS, *ev.Failure
+		}
+	}
+	for _, ev := range epnt.HTTPRoundTrip {
+		if ev.Failure != nil {
+			return VerdictBlockedHTTP, *ev.Failure
+		}
+	}
+	return "", ""
+}
+
+// layerIndex returns the index of the verdict inside layers.
+func layerIndex(v Verdict) int {
+	for idx, layer := range layers {
+		if layer == v {
+			return idx
+		}
+	}
+	return len(layers)
+}
+
+// lastStatusCode returns the status code of the last round trip.
+func lastStatusCode(epnt *measurex.HTTPEndpointMeasurement) int64 {
+	if len(epnt.HTTPRoundTrip) <= 0 {
+		return 0
+	}
+	return epnt.HTTPRoundTrip[len(epnt.HTTPRoundTrip)-1].StatusCode
+}
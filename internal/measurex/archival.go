@@ -6,6 +6,9 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
 )
 
 //
@@ -96,11 +99,28 @@ type ArchivalDNSRoundTripEvent struct {
 	Finished float64             `json:"t"`
 	Failure  *string             `json:"failure"`
 	Reply    *ArchivalBinaryData `json:"raw_reply"`
+
+	// Conflicting and Responses are only set when we have
+	// been collecting duplicate responses.
+	Conflicting bool                        `json:"conflicting,omitempty"`
+	Responses   []*ArchivalDNSResponseEvent `json:"responses,omitempty"`
+
+	// AuthenticData, HasRRSIG, and ExtendedErrors describe the
+	// DNSSEC and RFC8914 information inside the reply.
+	AuthenticData  bool                             `json:"authentic_data,omitempty"`
+	HasRRSIG       bool                             `json:"has_rrsig,omitempty"`
+	ExtendedErrors []model.ArchivalDNSExtendedError `json:"extended_dns_errors,omitempty"`
+}
+
+// ArchivalDNSResponseEvent is the archival format of a DNSResponseEvent.
+type ArchivalDNSResponseEvent struct {
+	Reply    *ArchivalBinaryData `json:"raw_reply"`
+	Received float64             `json:"t"`
 }
 
 // NewArchivalDNSRoundTripEvent converts a DNSRoundTripEvent into is archival format.
 func NewArchivalDNSRoundTripEvent(in *DNSRoundTripEvent) *ArchivalDNSRoundTripEvent {
-	return &ArchivalDNSRoundTripEvent{
+	out := &ArchivalDNSRoundTripEvent{
 		Network:  in.Network,
 		Address:  in.Address,
 		Query:    NewArchivalBinaryData(in.Query),
@@ -109,6 +129,30 @@ func NewArchivalDNSRoundTripEvent(in *DNSRoundTripEvent) *ArchivalDNSRoundTripEv
 		Failure:  in.Failure,
 		Reply:    NewArchivalBinaryData(in.Reply),
 	}
+	var replies [][]byte
+	for _, response := range in.Responses {
+		out.Responses = append(out.Responses, &ArchivalDNSResponseEvent{
+			Reply:    NewArchivalBinaryData(response.Reply),
+			Received: response.Received,
+		})
+		replies = append(replies, response.Reply)
+	}
+	out.Conflicting, _ = netxlite.DNSRepliesConflict(replies...)
+	if in.Reply != nil {
+		decoder := &netxlite.DNSDecoderMiekg{}
+		if info, err := decoder.DecodeReplyInfo(in.Reply); err == nil {
+			out.AuthenticData = info.AuthenticData
+			out.HasRRSIG = info.HasRRSIG
+			for _, ede := range info.ExtendedErrors {
+				out.ExtendedErrors = append(out.ExtendedErrors, model.ArchivalDNSExtendedError{
+					InfoCode:  ede.InfoCode,
+					Name:      netxlite.DNSExtendedErrorName(ede.InfoCode),
+					ExtraText: ede.ExtraText,
+				})
+			}
+		}
+	}
+	return out
 }
 
 // NewArchivalDNSRoundTripEventList converts a DNSRoundTripEvent
@@ -234,13 +278,14 @@ type ArchivalQUICTLSHandshakeEvent struct {
 
 	// JSON names that are consistent with the
 	// spirit of the spec but are not in it
-	RemoteAddr string   `json:"address"`
-	SNI        string   `json:"server_name"` // used in prod
-	ALPN       []string `json:"alpn"`
-	SkipVerify bool     `json:"no_tls_verify"` // used in prod
-	Oddity     Oddity   `json:"oddity"`
-	Network    string   `json:"proto"`
-	Started    float64  `json:"started"`
+	Fingerprint string   `json:"client_hello_fingerprint,omitempty"`
+	RemoteAddr  string   `json:"address"`
+	SNI         string   `json:"server_name"` // used in prod
+	ALPN        []string `json:"alpn"`
+	SkipVerify  bool     `json:"no_tls_verify"` // used in prod
+	Oddity      Oddity   `json:"oddity"`
+	Network     string   `json:"proto"`
+	Started     float64  `json:"started"`
 }
 
 // NewArchivalTLSCertList builds a new []ArchivalBinaryData
@@ -265,6 +310,7 @@ func NewArchivalQUICTLSHandshakeEvent(in *QUICTLSHandshakeEvent) *ArchivalQUICTL
 		TLSVersion:      in.TLSVersion,
 		PeerCerts:       NewArchivalTLSCerts(in.PeerCerts),
 		Finished:        in.Finished,
+		Fingerprint:     in.Fingerprint,
 		RemoteAddr:      in.RemoteAddr,
 		SNI:             in.SNI,
 		ALPN:            in.ALPN,
@@ -11,6 +11,7 @@ import (
 	"net"
 	"time"
 
+	"github.com/ooni/probe-cli/v3/internal/atomicx"
 	"github.com/ooni/probe-cli/v3/internal/model"
 	"github.com/ooni/probe-cli/v3/internal/netxlite"
 )
@@ -49,9 +50,35 @@ type dialerDB struct {
 	db    WritableDB
 }
 
+// connIDCounter generates the connection IDs.
+var connIDCounter = &atomicx.Int64{}
+
+// newConnID returns a new connection ID. We assign an ID to each
+// TCP connect and to each QUIC socket, so that we can tell apart the
+// events of different connections to the same endpoint.
+func newConnID() int64 {
+	return connIDCounter.Add(1)
+}
+
+// connIDGetter is a Conn that knows its connection ID.
+type connIDGetter interface {
+	ConnID() int64
+}
+
+// connIDOf returns the ID of the given Conn or zero if we did not
+// create the Conn using a Dialer returned by WrapDialer.
+func connIDOf(conn Conn) int64 {
+	if c, ok := conn.(connIDGetter); ok {
+		return c.ConnID()
+	}
+	return 0
+}
+
 // NetworkEvent contains a network event. This kind of events
-// are generated by Dialer, QUICDialer, Conn, QUICConn.
+// are generated by Dialer, QUICDialer, Conn, QUICConn. The ConnID
+// field identifies the connection (zero means unknown).
 type NetworkEvent struct {
+	ConnID     int64
 	RemoteAddr string
 	Failure    *string
 	Count      int
@@ -64,10 +91,12 @@ type NetworkEvent struct {
 
 func (d *dialerDB) DialContext(
 	ctx context.Context, network, address string) (Conn, error) {
+	connID := newConnID()
 	started := time.Since(d.begin).Seconds()
 	conn, err := d.Dialer.DialContext(ctx, network, address)
 	finished := time.Since(d.begin).Seconds()
 	d.db.InsertIntoDial(&NetworkEvent{
+		ConnID:     connID,
 		Operation:  "connect",
 		Network:    network,
 		RemoteAddr: address,
@@ -83,6 +112,7 @@ func (d *dialerDB) DialContext(
 	return &connDB{
 		Conn:       conn,
 		begin:      d.begin,
+		connID:     connID,
 		db:         d.db,
 		network:    network,
 		remoteAddr: address,
@@ -108,16 +138,23 @@ func (c *dialerDB) computeOddity(err error) Oddity {
 type connDB struct {
 	net.Conn
 	begin      time.Time
+	connID     int64
 	db         WritableDB
 	network    string
 	remoteAddr string
 }
 
+// ConnID returns the connection ID.
+func (c *connDB) ConnID() int64 {
+	return c.connID
+}
+
 func (c *connDB) Read(b []byte) (int, error) {
 	started := time.Since(c.begin).Seconds()
 	count, err := c.Conn.Read(b)
 	finished := time.Since(c.begin).Seconds()
 	c.db.InsertIntoReadWrite(&NetworkEvent{
+		ConnID:     c.connID,
 		Operation:  "read",
 		Network:    c.network,
 		RemoteAddr: c.remoteAddr,
@@ -134,6 +171,7 @@ func (c *connDB) Write(b []byte) (int, error) {
 	count, err := c.Conn.Write(b)
 	finished := time.Since(c.begin).Seconds()
 	c.db.InsertIntoReadWrite(&NetworkEvent{
+		ConnID:     c.connID,
 		Operation:  "write",
 		Network:    c.network,
 		RemoteAddr: c.remoteAddr,
@@ -150,6 +188,7 @@ func (c *connDB) Close() error {
 	err := c.Conn.Close()
 	finished := time.Since(c.begin).Seconds()
 	c.db.InsertIntoClose(&NetworkEvent{
+		ConnID:     c.connID,
 		Operation:  "close",
 		Network:    c.network,
 		RemoteAddr: c.remoteAddr,
@@ -34,6 +34,17 @@ type DNSRoundTripEvent struct {
 	Finished float64
 	Failure  *string
 	Reply    []byte
+
+	// Responses contains all the responses we received for the
+	// query, including duplicates. This field is only set when
+	// the transport was wrapped using WrapDNSXRoundTripperWithDuplicates.
+	Responses []*DNSResponseEvent
+}
+
+// DNSResponseEvent is one of the responses received for a query.
+type DNSResponseEvent struct {
+	Reply    []byte
+	Received float64
 }
 
 func (txp *dnsxRoundTripperDB) RoundTrip(ctx context.Context, query []byte) ([]byte, error) {
@@ -51,3 +62,44 @@ func (txp *dnsxRoundTripperDB) RoundTrip(ctx context.Context, query []byte) ([]b
 	})
 	return reply, err
 }
+
+// WrapDNSXRoundTripperWithDuplicates is like WrapDNSXRoundTripper
+// but also saves all the responses received for each query, including
+// duplicate responses, into the DNSRoundTripEvent.
+func (mx *Measurer) WrapDNSXRoundTripperWithDuplicates(
+	db WritableDB, rtx model.DNSTransportWithDuplicates) model.DNSTransport {
+	return &dnsxRoundTripperWithDuplicatesDB{
+		db: db, DNSTransportWithDuplicates: rtx, begin: mx.Begin}
+}
+
+type dnsxRoundTripperWithDuplicatesDB struct {
+	model.DNSTransportWithDuplicates
+	begin time.Time
+	db    WritableDB
+}
+
+func (txp *dnsxRoundTripperWithDuplicatesDB) RoundTrip(
+	ctx context.Context, query []byte) ([]byte, error) {
+	started := time.Since(txp.begin).Seconds()
+	responses, err := txp.DNSTransportWithDuplicates.RoundTripWithDuplicates(ctx, query)
+	finished := time.Since(txp.begin).Seconds()
+	ev := &DNSRoundTripEvent{
+		Network:  txp.DNSTransportWithDuplicates.Network(),
+		Address:  txp.DNSTransportWithDuplicates.Address(),
+		Query:    query,
+		Started:  started,
+		Finished: finished,
+		Failure:  NewFailure(err),
+	}
+	for _, response := range responses {
+		ev.Responses = append(ev.Responses, &DNSResponseEvent{
+			Reply:    response.Reply,
+			Received: response.Received.Sub(txp.begin).Seconds(),
+		})
+	}
+	if len(responses) > 0 {
+		ev.Reply = responses[0].Reply
+	}
+	txp.db.InsertIntoDNSRoundTrip(ev)
+	return ev.Reply, err
+}
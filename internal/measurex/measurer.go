@@ -39,6 +39,19 @@ type Measurer struct {
 	// the shorter watchdog timeout will prevail.
 	DNSLookupTimeout time.Duration
 
+	// DNSDuplicatesWindow is the OPTIONAL time during which DNS-over-UDP
+	// resolvers keep waiting for duplicate responses after the first
+	// response. If not set, we stop reading after the first response.
+	//
+	// Receiving several responses for the same query, especially when
+	// they are conflicting, is a strong signal of DNS injection.
+	DNSDuplicatesWindow time.Duration
+
+	// DNSQueryOptions contains the OPTIONAL EDNS0 options used by
+	// the resolvers created by NewResolverUDP. If not set, we use
+	// the default options of netxlite.
+	DNSQueryOptions *model.DNSQueryOptions
+
 	// HTTPClient is the MANDATORY HTTP client for the WCTH.
 	HTTPClient model.HTTPClient
 
@@ -92,6 +105,13 @@ type Measurer struct {
 
 	// TLSHandshaker is the MANDATORY TLS handshaker.
 	TLSHandshaker model.TLSHandshaker
+
+	// TLSFingerprint is the OPTIONAL name of the ClientHello fingerprint
+	// used by TLSHandshaker (see netxlite's TLSFingerprint constants), which
+	// we save along with the TLS handshake events. You should create a
+	// TLSHandshaker using such a fingerprint with the
+	// netxlite.NewTLSHandshakerFingerprint factory.
+	TLSFingerprint string
 }
 
 // NewMeasurerWithDefaultSettings creates a new Measurer
@@ -311,7 +331,8 @@ func (mx *Measurer) TCPConnectWithDB(ctx context.Context, db WritableDB, address
 //
 // In the latter case, the content of the ClientHello message
 // will not only depend on the config field but also on the
-// utls.ClientHelloID thay you're using.
+// utls.ClientHelloID thay you're using. Set mx.TLSFingerprint
+// to record which fingerprint you're using.
 //
 // Returns an EndpointMeasurement.
 func (mx *Measurer) TLSConnectAndHandshake(ctx context.Context,
@@ -19,8 +19,9 @@ import (
 
 type quicListenerDB struct {
 	model.QUICListener
-	begin time.Time
-	db    WritableDB
+	begin  time.Time
+	connID int64
+	db     WritableDB
 }
 
 func (ql *quicListenerDB) Listen(addr *net.UDPAddr) (model.UDPLikeConn, error) {
@@ -31,14 +32,16 @@ func (ql *quicListenerDB) Listen(addr *net.UDPAddr) (model.UDPLikeConn, error) {
 	return &udpLikeConnDB{
 		UDPLikeConn: pconn,
 		begin:       ql.begin,
+		connID:      ql.connID,
 		db:          ql.db,
 	}, nil
 }
 
 type udpLikeConnDB struct {
 	model.UDPLikeConn
-	begin time.Time
-	db    WritableDB
+	begin  time.Time
+	connID int64
+	db     WritableDB
 }
 
 func (c *udpLikeConnDB) WriteTo(p []byte, addr net.Addr) (int, error) {
@@ -46,6 +49,7 @@ func (c *udpLikeConnDB) WriteTo(p []byte, addr net.Addr) (int, error) {
 	count, err := c.UDPLikeConn.WriteTo(p, addr)
 	finished := time.Since(c.begin).Seconds()
 	c.db.InsertIntoReadWrite(&NetworkEvent{
+		ConnID:     c.connID,
 		Operation:  "write_to",
 		Network:    "quic",
 		RemoteAddr: addr.String(),
@@ -62,6 +66,7 @@ func (c *udpLikeConnDB) ReadFrom(b []byte) (int, net.Addr, error) {
 	count, addr, err := c.UDPLikeConn.ReadFrom(b)
 	finished := time.Since(c.begin).Seconds()
 	c.db.InsertIntoReadWrite(&NetworkEvent{
+		ConnID:     c.connID,
 		Operation:  "read_from",
 		Network:    "quic",
 		RemoteAddr: addrStringIfNotNil(addr),
@@ -78,6 +83,7 @@ func (c *udpLikeConnDB) Close() error {
 	err := c.UDPLikeConn.Close()
 	finished := time.Since(c.begin).Seconds()
 	c.db.InsertIntoClose(&NetworkEvent{
+		ConnID:     c.connID,
 		Operation:  "close",
 		Network:    "quic",
 		RemoteAddr: "",
@@ -107,11 +113,15 @@ type quicDialerDB struct {
 
 func (qh *quicDialerDB) DialContext(ctx context.Context, network, address string,
 	tlsConfig *tls.Config, quicConfig *quic.Config) (quic.EarlySession, error) {
+	// Each dial uses a new listener and hence a new socket, so
+	// all the events of this dial share the same connection ID.
+	connID := newConnID()
 	started := time.Since(qh.begin).Seconds()
 	var state tls.ConnectionState
 	listener := &quicListenerDB{
 		QUICListener: netxlite.NewQUICListener(),
 		begin:        qh.begin,
+		connID:       connID,
 		db:           qh.db,
 	}
 	dialer := netxlite.NewQUICDialerWithoutResolver(listener, qh.logger)
@@ -127,6 +137,7 @@ func (qh *quicDialerDB) DialContext(ctx context.Context, network, address string
 	}
 	finished := time.Since(qh.begin).Seconds()
 	qh.db.InsertIntoQUICHandshake(&QUICTLSHandshakeEvent{
+		ConnID:          connID,
 		Network:         "quic",
 		RemoteAddr:      address,
 		SNI:             tlsConfig.ServerName,
@@ -41,14 +41,22 @@ func (mx *Measurer) NewResolverSystem(db WritableDB, logger model.Logger) model.
 // - logger is the logger;
 //
 // - address is the resolver address (e.g., "1.1.1.1:53").
+//
+// When mx.DNSDuplicatesWindow is positive, the resolver collects all
+// the responses received within such window after the first one. The
+// resolver uses mx.DNSQueryOptions to encode queries.
 func (mx *Measurer) NewResolverUDP(db WritableDB, logger model.Logger, address string) model.Resolver {
-	return mx.WrapResolver(db, netxlite.WrapResolver(
-		logger, netxlite.NewSerialResolver(
-			mx.WrapDNSXRoundTripper(db, netxlite.NewDNSOverUDP(
-				mx.NewDialerWithSystemResolver(db, logger),
-				address,
-			)))),
-	)
+	dialer := mx.NewDialerWithSystemResolver(db, logger)
+	var txp model.DNSTransport
+	if mx.DNSDuplicatesWindow > 0 {
+		txp = mx.WrapDNSXRoundTripperWithDuplicates(db,
+			netxlite.NewDNSOverUDPWithDuplicates(dialer, address, mx.DNSDuplicatesWindow))
+	} else {
+		txp = mx.WrapDNSXRoundTripper(db, netxlite.NewDNSOverUDP(dialer, address))
+	}
+	reso := netxlite.NewParallelResolver(txp)
+	reso.QueryOptions = mx.DNSQueryOptions
+	return mx.WrapResolver(db, netxlite.WrapResolver(logger, reso))
 }
 
 type resolverDB struct {
@@ -0,0 +1,282 @@
+-- +migrate Down
+-- +migrate StatementBegin
+
+DROP TABLE `http_redirect`;
+DROP TABLE `http_round_trip`;
+DROP TABLE `dns_round_trip`;
+DROP TABLE `lookup_https_svc`;
+DROP TABLE `lookup_host`;
+DROP TABLE `quic_handshake`;
+DROP TABLE `tls_handshake`;
+DROP TABLE `close`;
+DROP TABLE `read_write`;
+DROP TABLE `dial`;
+DROP TABLE `connections`;
+DROP TABLE `measurements`;
+
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+
+-- A measurement groups the events saved using the same MeasurementDB. It
+-- corresponds to a measurex.Measurement.
+CREATE TABLE `measurements` (
+  `measurement_id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `created_at` DATETIME NOT NULL
+);
+
+-- We assign an ID to each measurex connection ID of a measurement when
+-- we see it for the first time, so that we can select all the events of
+-- a connection. The network and address are the ones of the first event.
+CREATE TABLE `connections` (
+  `conn_id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `measurement_id` INTEGER NOT NULL,
+  `network` VARCHAR(16) NOT NULL,
+  `address` VARCHAR(64) NOT NULL,
+
+  FOREIGN KEY (`measurement_id`) REFERENCES `measurements`(`measurement_id`)
+    ON DELETE CASCADE
+);
+CREATE INDEX `connections_measurement_id` ON `connections`(`measurement_id`);
+
+-- The dial, read_write and close tables contain measurex.NetworkEvent.
+CREATE TABLE `dial` (
+  `event_id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `measurement_id` INTEGER NOT NULL,
+  `conn_id` INTEGER,
+  `operation` VARCHAR(16) NOT NULL,
+  `network` VARCHAR(16) NOT NULL,
+  `remote_addr` VARCHAR(64) NOT NULL,
+  `failure` VARCHAR(255),
+  `count` INTEGER NOT NULL,
+  `oddity` VARCHAR(64) NOT NULL,
+  `started` REAL NOT NULL,
+  `finished` REAL NOT NULL,
+
+  FOREIGN KEY (`measurement_id`) REFERENCES `measurements`(`measurement_id`)
+    ON DELETE CASCADE,
+  FOREIGN KEY (`conn_id`) REFERENCES `connections`(`conn_id`)
+);
+CREATE INDEX `dial_measurement_id` ON `dial`(`measurement_id`);
+CREATE INDEX `dial_conn_id` ON `dial`(`conn_id`);
+CREATE INDEX `dial_failure` ON `dial`(`failure`);
+
+CREATE TABLE `read_write` (
+  `event_id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `measurement_id` INTEGER NOT NULL,
+  `conn_id` INTEGER,
+  `operation` VARCHAR(16) NOT NULL,
+  `network` VARCHAR(16) NOT NULL,
+  `remote_addr` VARCHAR(64) NOT NULL,
+  `failure` VARCHAR(255),
+  `count` INTEGER NOT NULL,
+  `oddity` VARCHAR(64) NOT NULL,
+  `started` REAL NOT NULL,
+  `finished` REAL NOT NULL,
+
+  FOREIGN KEY (`measurement_id`) REFERENCES `measurements`(`measurement_id`)
+    ON DELETE CASCADE,
+  FOREIGN KEY (`conn_id`) REFERENCES `connections`(`conn_id`)
+);
+CREATE INDEX `read_write_measurement_id` ON `read_write`(`measurement_id`);
+CREATE INDEX `read_write_conn_id` ON `read_write`(`conn_id`);
+CREATE INDEX `read_write_failure` ON `read_write`(`failure`);
+
+CREATE TABLE `close` (
+  `event_id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `measurement_id` INTEGER NOT NULL,
+  `conn_id` INTEGER,
+  `operation` VARCHAR(16) NOT NULL,
+  `network` VARCHAR(16) NOT NULL,
+  `remote_addr` VARCHAR(64) NOT NULL,
+  `failure` VARCHAR(255),
+  `count` INTEGER NOT NULL,
+  `oddity` VARCHAR(64) NOT NULL,
+  `started` REAL NOT NULL,
+  `finished` REAL NOT NULL,
+
+  FOREIGN KEY (`measurement_id`) REFERENCES `measurements`(`measurement_id`)
+    ON DELETE CASCADE,
+  FOREIGN KEY (`conn_id`) REFERENCES `connections`(`conn_id`)
+);
+CREATE INDEX `close_measurement_id` ON `close`(`measurement_id`);
+CREATE INDEX `close_conn_id` ON `close`(`conn_id`);
+CREATE INDEX `close_failure` ON `close`(`failure`);
+
+-- The tls_handshake and quic_handshake tables contain
+-- measurex.QUICTLSHandshakeEvent. The `alpn` and `peer_certs`
+-- columns contain JSON arrays.
+CREATE TABLE `tls_handshake` (
+  `event_id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `measurement_id` INTEGER NOT NULL,
+  `conn_id` INTEGER,
+  `network` VARCHAR(16) NOT NULL,
+  `remote_addr` VARCHAR(64) NOT NULL,
+  `sni` VARCHAR(255) NOT NULL,
+  `alpn` JSON NOT NULL,
+  `skip_verify` TINYINT(1) NOT NULL,
+  `fingerprint` VARCHAR(64) NOT NULL,
+  `cipher_suite` VARCHAR(64) NOT NULL,
+  `negotiated_proto` VARCHAR(64) NOT NULL,
+  `tls_version` VARCHAR(16) NOT NULL,
+  `peer_certs` JSON NOT NULL,
+  `failure` VARCHAR(255),
+  `oddity` VARCHAR(64) NOT NULL,
+  `started` REAL NOT NULL,
+  `finished` REAL NOT NULL,
+
+  FOREIGN KEY (`measurement_id`) REFERENCES `measurements`(`measurement_id`)
+    ON DELETE CASCADE,
+  FOREIGN KEY (`conn_id`) REFERENCES `connections`(`conn_id`)
+);
+CREATE INDEX `tls_handshake_measurement_id` ON `tls_handshake`(`measurement_id`);
+CREATE INDEX `tls_handshake_conn_id` ON `tls_handshake`(`conn_id`);
+CREATE INDEX `tls_handshake_sni` ON `tls_handshake`(`sni`);
+CREATE INDEX `tls_handshake_failure` ON `tls_handshake`(`failure`);
+
+CREATE TABLE `quic_handshake` (
+  `event_id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `measurement_id` INTEGER NOT NULL,
+  `conn_id` INTEGER,
+  `network` VARCHAR(16) NOT NULL,
+  `remote_addr` VARCHAR(64) NOT NULL,
+  `sni` VARCHAR(255) NOT NULL,
+  `alpn` JSON NOT NULL,
+  `skip_verify` TINYINT(1) NOT NULL,
+  `fingerprint` VARCHAR(64) NOT NULL,
+  `cipher_suite` VARCHAR(64) NOT NULL,
+  `negotiated_proto` VARCHAR(64) NOT NULL,
+  `tls_version` VARCHAR(16) NOT NULL,
+  `peer_certs` JSON NOT NULL,
+  `failure` VARCHAR(255),
+  `oddity` VARCHAR(64) NOT NULL,
+  `started` REAL NOT NULL,
+  `finished` REAL NOT NULL,
+
+  FOREIGN KEY (`measurement_id`) REFERENCES `measurements`(`measurement_id`)
+    ON DELETE CASCADE,
+  FOREIGN KEY (`conn_id`) REFERENCES `connections`(`conn_id`)
+);
+CREATE INDEX `quic_handshake_measurement_id` ON `quic_handshake`(`measurement_id`);
+CREATE INDEX `quic_handshake_conn_id` ON `quic_handshake`(`conn_id`);
+CREATE INDEX `quic_handshake_sni` ON `quic_handshake`(`sni`);
+CREATE INDEX `quic_handshake_failure` ON `quic_handshake`(`failure`);
+
+-- The lookup_host and lookup_https_svc tables contain
+-- measurex.DNSLookupEvent. The `a`, `aaaa` and `alpn`
+-- columns contain JSON arrays.
+CREATE TABLE `lookup_host` (
+  `event_id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `measurement_id` INTEGER NOT NULL,
+  `network` VARCHAR(16) NOT NULL,
+  `address` VARCHAR(255) NOT NULL,
+  `domain` VARCHAR(255) NOT NULL,
+  `query_type` VARCHAR(16) NOT NULL,
+  `a` JSON NOT NULL,
+  `aaaa` JSON NOT NULL,
+  `alpn` JSON NOT NULL,
+  `failure` VARCHAR(255),
+  `oddity` VARCHAR(64) NOT NULL,
+  `started` REAL NOT NULL,
+  `finished` REAL NOT NULL,
+
+  FOREIGN KEY (`measurement_id`) REFERENCES `measurements`(`measurement_id`)
+    ON DELETE CASCADE
+);
+CREATE INDEX `lookup_host_measurement_id` ON `lookup_host`(`measurement_id`);
+CREATE INDEX `lookup_host_domain` ON `lookup_host`(`domain`);
+CREATE INDEX `lookup_host_failure` ON `lookup_host`(`failure`);
+
+CREATE TABLE `lookup_https_svc` (
+  `event_id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `measurement_id` INTEGER NOT NULL,
+  `network` VARCHAR(16) NOT NULL,
+  `address` VARCHAR(255) NOT NULL,
+  `domain` VARCHAR(255) NOT NULL,
+  `query_type` VARCHAR(16) NOT NULL,
+  `a` JSON NOT NULL,
+  `aaaa` JSON NOT NULL,
+  `alpn` JSON NOT NULL,
+  `failure` VARCHAR(255),
+  `oddity` VARCHAR(64) NOT NULL,
+  `started` REAL NOT NULL,
+  `finished` REAL NOT NULL,
+
+  FOREIGN KEY (`measurement_id`) REFERENCES `measurements`(`measurement_id`)
+    ON DELETE CASCADE
+);
+CREATE INDEX `lookup_https_svc_measurement_id` ON `lookup_https_svc`(`measurement_id`);
+CREATE INDEX `lookup_https_svc_domain` ON `lookup_https_svc`(`domain`);
+CREATE INDEX `lookup_https_svc_failure` ON `lookup_https_svc`(`failure`);
+
+-- The dns_round_trip table contains measurex.DNSRoundTripEvent. The
+-- `domain` column contains the queried domain, which we parse from the
+-- query, and the `responses` column contains a JSON array.
+CREATE TABLE `dns_round_trip` (
+  `event_id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `measurement_id` INTEGER NOT NULL,
+  `network` VARCHAR(16) NOT NULL,
+  `address` VARCHAR(255) NOT NULL,
+  `domain` VARCHAR(255) NOT NULL,
+  `query` BLOB,
+  `reply` BLOB,
+  `responses` JSON NOT NULL,
+  `failure` VARCHAR(255),
+  `started` REAL NOT NULL,
+  `finished` REAL NOT NULL,
+
+  FOREIGN KEY (`measurement_id`) REFERENCES `measurements`(`measurement_id`)
+    ON DELETE CASCADE
+);
+CREATE INDEX `dns_round_trip_measurement_id` ON `dns_round_trip`(`measurement_id`);
+CREATE INDEX `dns_round_trip_domain` ON `dns_round_trip`(`domain`);
+CREATE INDEX `dns_round_trip_failure` ON `dns_round_trip`(`failure`);
+
+-- The http_round_trip table contains measurex.HTTPRoundTripEvent. The
+-- `domain` column contains the host of the URL and the headers columns
+-- contain JSON objects.
+CREATE TABLE `http_round_trip` (
+  `event_id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `measurement_id` INTEGER NOT NULL,
+  `method` VARCHAR(16) NOT NULL,
+  `url` TEXT NOT NULL,
+  `domain` VARCHAR(255) NOT NULL,
+  `request_headers` JSON NOT NULL,
+  `status_code` INTEGER NOT NULL,
+  `response_headers` JSON NOT NULL,
+  `response_body` BLOB,
+  `response_body_length` INTEGER NOT NULL,
+  `response_body_is_truncated` TINYINT(1) NOT NULL,
+  `response_body_is_utf8` TINYINT(1) NOT NULL,
+  `failure` VARCHAR(255),
+  `oddity` VARCHAR(64) NOT NULL,
+  `started` REAL NOT NULL,
+  `finished` REAL NOT NULL,
+
+  FOREIGN KEY (`measurement_id`) REFERENCES `measurements`(`measurement_id`)
+    ON DELETE CASCADE
+);
+CREATE INDEX `http_round_trip_measurement_id` ON `http_round_trip`(`measurement_id`);
+CREATE INDEX `http_round_trip_domain` ON `http_round_trip`(`domain`);
+CREATE INDEX `http_round_trip_failure` ON `http_round_trip`(`failure`);
+
+-- The http_redirect table contains measurex.HTTPRedirectEvent. The
+-- `domain` column contains the host of the URL, the `cookies` column
+-- contains a JSON array and the `error` column the error string.
+CREATE TABLE `http_redirect` (
+  `event_id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `measurement_id` INTEGER NOT NULL,
+  `url` TEXT NOT NULL,
+  `domain` VARCHAR(255) NOT NULL,
+  `location` TEXT NOT NULL,
+  `cookies` JSON NOT NULL,
+  `error` VARCHAR(255),
+
+  FOREIGN KEY (`measurement_id`) REFERENCES `measurements`(`measurement_id`)
+    ON DELETE CASCADE
+);
+CREATE INDEX `http_redirect_measurement_id` ON `http_redirect`(`measurement_id`);
+CREATE INDEX `http_redirect_domain` ON `http_redirect`(`domain`);
+
+-- +migrate StatementEnd
@@ -0,0 +1,452 @@
+package sqlitedb
+
+//
+// Models
+//
+// This file maps measurex events to the rows of the tables
+// created by the migrations and back.
+//
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-cli/v3/internal/measurex"
+)
+
+// Connection is a row of the connections table.
+type Connection struct {
+	// ID is the connection ID.
+	ID int64 `db:"conn_id,omitempty"`
+
+	// MeasurementID is the ID of the measurement.
+	MeasurementID int64 `db:"measurement_id"`
+
+	// Network is the network (e.g., "tcp", "quic").
+	Network string `db:"network"`
+
+	// Address is the remote address (e.g., "8.8.8.8:443").
+	Address string `db:"address"`
+}
+
+// networkEventRow is a row of the dial, read_write and close tables.
+type networkEventRow struct {
+	ID            int64          `db:"event_id,omitempty"`
+	MeasurementID int64          `db:"measurement_id"`
+	ConnID        sql.NullInt64  `db:"conn_id"`
+	Operation     string         `db:"operation"`
+	Network       string         `db:"network"`
+	RemoteAddr    string         `db:"remote_addr"`
+	Failure       sql.NullString `db:"failure"`
+	Count         int            `db:"count"`
+	Oddity        string         `db:"oddity"`
+	Started       float64        `db:"started"`
+	Finished      float64        `db:"finished"`
+}
+
+func newNetworkEventRow(measurementID int64,
+	connID sql.NullInt64, ev *measurex.NetworkEvent) *networkEventRow {
+	return &networkEventRow{
+		MeasurementID: measurementID,
+		ConnID:        connID,
+		Operation:     ev.Operation,
+		Network:       ev.Network,
+		RemoteAddr:    ev.RemoteAddr,
+		Failure:       newNullString(ev.Failure),
+		Count:         ev.Count,
+		Oddity:        string(ev.Oddity),
+		Started:       ev.Started,
+		Finished:      ev.Finished,
+	}
+}
+
+func (r *networkEventRow) event() *measurex.NetworkEvent {
+	return &measurex.NetworkEvent{
+		ConnID:     r.ConnID.Int64,
+		RemoteAddr: r.RemoteAddr,
+		Failure:    stringPtr(r.Failure),
+		Count:      r.Count,
+		Operation:  r.Operation,
+		Network:    r.Network,
+		Oddity:     measurex.Oddity(r.Oddity),
+		Finished:   r.Finished,
+		Started:    r.Started,
+	}
+}
+
+// handshakeRow is a row of the tls_handshake and quic_handshake tables.
+type handshakeRow struct {
+	ID              int64          `db:"event_id,omitempty"`
+	MeasurementID   int64          `db:"measurement_id"`
+	ConnID          sql.NullInt64  `db:"conn_id"`
+	Network         string         `db:"network"`
+	RemoteAddr      string         `db:"remote_addr"`
+	SNI             string         `db:"sni"`
+	ALPN            string         `db:"alpn"`
+	SkipVerify      bool           `db:"skip_verify"`
+	Fingerprint     string         `db:"fingerprint"`
+	CipherSuite     string         `db:"cipher_suite"`
+	NegotiatedProto string         `db:"negotiated_proto"`
+	TLSVersion      string         `db:"tls_version"`
+	PeerCerts       string         `db:"peer_certs"`
+	Failure         sql.NullString `db:"failure"`
+	Oddity          string         `db:"oddity"`
+	Started         float64        `db:"started"`
+	Finished        float64        `db:"finished"`
+}
+
+func newHandshakeRow(measurementID int64,
+	connID sql.NullInt64, ev *measurex.QUICTLSHandshakeEvent) (*handshakeRow, error) {
+	alpn, err := json.Marshal(ev.ALPN)
+	if err != nil {
+		return nil, err
+	}
+	peerCerts, err := json.Marshal(ev.PeerCerts)
+	if err != nil {
+		return nil, err
+	}
+	return &handshakeRow{
+		MeasurementID:   measurementID,
+		ConnID:          connID,
+		Network:         ev.Network,
+		RemoteAddr:      ev.RemoteAddr,
+		SNI:             ev.SNI,
+		ALPN:            string(alpn),
+		SkipVerify:      ev.SkipVerify,
+		Fingerprint:     ev.Fingerprint,
+		CipherSuite:     ev.CipherSuite,
+		NegotiatedProto: ev.NegotiatedProto,
+		TLSVersion:      ev.TLSVersion,
+		PeerCerts:       string(peerCerts),
+		Failure:         newNullString(ev.Failure),
+		Oddity:          string(ev.Oddity),
+		Started:         ev.Started,
+		Finished:        ev.Finished,
+	}, nil
+}
+
+func (r *handshakeRow) event() (*measurex.QUICTLSHandshakeEvent, error) {
+	ev := &measurex.QUICTLSHandshakeEvent{
+		ConnID:          r.ConnID.Int64,
+		CipherSuite:     r.CipherSuite,
+		Fingerprint:     r.Fingerprint,
+		Failure:         stringPtr(r.Failure),
+		NegotiatedProto: r.NegotiatedProto,
+		TLSVersion:      r.TLSVersion,
+		Finished:        r.Finished,
+		RemoteAddr:      r.RemoteAddr,
+		SNI:             r.SNI,
+		SkipVerify:      r.SkipVerify,
+		Oddity:          measurex.Oddity(r.Oddity),
+		Network:         r.Network,
+		Started:         r.Started,
+	}
+	if err := json.Unmarshal([]byte(r.ALPN), &ev.ALPN); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(r.PeerCerts), &ev.PeerCerts); err != nil {
+		return nil, err
+	}
+	return ev, nil
+}
+
+// lookupRow is a row of the lookup_host and lookup_https_svc tables.
+type lookupRow struct {
+	ID            int64          `db:"event_id,omitempty"`
+	MeasurementID int64          `db:"measurement_id"`
+	Network       string         `db:"network"`
+	Address       string         `db:"address"`
+	Domain        string         `db:"domain"`
+	QueryType     string         `db:"query_type"`
+	A             string         `db:"a"`
+	AAAA          string         `db:"aaaa"`
+	ALPN          string         `db:"alpn"`
+	Failure       sql.NullString `db:"failure"`
+	Oddity        string         `db:"oddity"`
+	Started       float64        `db:"started"`
+	Finished      float64        `db:"finished"`
+}
+
+func newLookupRow(measurementID int64, ev *measurex.DNSLookupEvent) (*lookupRow, error) {
+	a, err := json.Marshal(ev.A)
+	if err != nil {
+		return nil, err
+	}
+	aaaa, err := json.Marshal(ev.AAAA)
+	if err != nil {
+		return nil, err
+	}
+	alpn, err := json.Marshal(ev.ALPN)
+	if err != nil {
+		return nil, err
+	}
+	return &lookupRow{
+		MeasurementID: measurementID,
+		Network:       ev.Network,
+		Address:       ev.Address,
+		Domain:        ev.Domain,
+		QueryType:     ev.QueryType,
+		A:             string(a),
+		AAAA:          string(aaaa),
+		ALPN:          string(alpn),
+		Failure:       newNullString(ev.Failure),
+		Oddity:        string(ev.Oddity),
+		Started:       ev.Started,
+		Finished:      ev.Finished,
+	}, nil
+}
+
+func (r *lookupRow) event() (*measurex.DNSLookupEvent, error) {
+	ev := &measurex.DNSLookupEvent{
+		Network:   r.Network,
+		Failure:   stringPtr(r.Failure),
+		Domain:    r.Domain,
+		QueryType: r.QueryType,
+		Address:   r.Address,
+		Finished:  r.Finished,
+		Started:   r.Started,
+		Oddity:    measurex.Oddity(r.Oddity),
+	}
+	if err := json.Unmarshal([]byte(r.A), &ev.A); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(r.AAAA), &ev.AAAA); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(r.ALPN), &ev.ALPN); err != nil {
+		return nil, err
+	}
+	return ev, nil
+}
+
+// dnsRoundTripRow is a row of the dns_round_trip table.
+type dnsRoundTripRow struct {
+	ID            int64          `db:"event_id,omitempty"`
+	MeasurementID int64          `db:"measurement_id"`
+	Network       string         `db:"network"`
+	Address       string         `db:"address"`
+	Domain        string         `db:"domain"`
+	Query         []byte         `db:"query"`
+	Reply         []byte         `db:"reply"`
+	Responses     string         `db:"responses"`
+	Failure       sql.NullString `db:"failure"`
+	Started       float64        `db:"started"`
+	Finished      float64        `db:"finished"`
+}
+
+func newDNSRoundTripRow(measurementID int64, ev *measurex.DNSRoundTripEvent) (*dnsRoundTripRow, error) {
+	responses, err := json.Marshal(ev.Responses)
+	if err != nil {
+		return nil, err
+	}
+	return &dnsRoundTripRow{
+		MeasurementID: measurementID,
+		Network:       ev.Network,
+		Address:       ev.Address,
+		Domain:        queryDomain(ev.Query),
+		Query:         ev.Query,
+		Reply:         ev.Reply,
+		Responses:     string(responses),
+		Failure:       newNullString(ev.Failure),
+		Started:       ev.Started,
+		Finished:      ev.Finished,
+	}, nil
+}
+
+func (r *dnsRoundTripRow) event() (*measurex.DNSRoundTripEvent, error) {
+	ev := &measurex.DNSRoundTripEvent{
+		Network:  r.Network,
+		Address:  r.Address,
+		Query:    r.Query,
+		Started:  r.Started,
+		Finished: r.Finished,
+		Failure:  stringPtr(r.Failure),
+		Reply:    r.Reply,
+	}
+	if err := json.Unmarshal([]byte(r.Responses), &ev.Responses); err != nil {
+		return nil, err
+	}
+	return ev, nil
+}
+
+// queryDomain returns the domain of a DNS query or an
+// empty string if we cannot parse the query.
+func queryDomain(query []byte) string {
+	msg := &dns.Msg{}
+	if err := msg.Unpack(query); err != nil || len(msg.Question) <= 0 {
+		return ""
+	}
+	return strings.TrimSuffix(msg.Question[0].Name, ".")
+}
+
+// httpRoundTripRow is a row of the http_round_trip table.
+type httpRoundTripRow struct {
+	ID                      int64          `db:"event_id,omitempty"`
+	MeasurementID           int64          `db:"measurement_id"`
+	Method                  string         `db:"method"`
+	URL                     string         `db:"url"`
+	Domain                  string         `db:"domain"`
+	RequestHeaders          string         `db:"request_headers"`
+	StatusCode              int64          `db:"status_code"`
+	ResponseHeaders         string         `db:"response_headers"`
+	ResponseBody            []byte         `db:"response_body"`
+	ResponseBodyLength      int64          `db:"response_body_length"`
+	ResponseBodyIsTruncated bool           `db:"response_body_is_truncated"`
+	ResponseBodyIsUTF8      bool           `db:"response_body_is_utf8"`
+	Failure                 sql.NullString `db:"failure"`
+	Oddity                  string         `db:"oddity"`
+	Started                 float64        `db:"started"`
+	Finished                float64        `db:"finished"`
+}
+
+func newHTTPRoundTripRow(measurementID int64, ev *measurex.HTTPRoundTripEvent) (*httpRoundTripRow, error) {
+	requestHeaders, err := json.Marshal(ev.RequestHeaders)
+	if err != nil {
+		return nil, err
+	}
+	responseHeaders, err := json.Marshal(ev.ResponseHeaders)
+	if err != nil {
+		return nil, err
+	}
+	return &httpRoundTripRow{
+		MeasurementID:           measurementID,
+		Method:                  ev.Method,
+		URL:                     ev.URL,
+		Domain:                  urlDomain(ev.URL),
+		RequestHeaders:          string(requestHeaders),
+		StatusCode:              ev.StatusCode,
+		ResponseHeaders:         string(responseHeaders),
+		ResponseBody:            ev.ResponseBody,
+		ResponseBodyLength:      ev.ResponseBodyLength,
+		ResponseBodyIsTruncated: ev.ResponseBodyIsTruncated,
+		ResponseBodyIsUTF8:      ev.ResponseBodyIsUTF8,
+		Failure:                 newNullString(ev.Failure),
+		Oddity:                  string(ev.Oddity),
+		Started:                 ev.Started,
+		Finished:                ev.Finished,
+	}, nil
+}
+
+func (r *httpRoundTripRow) event() (*measurex.HTTPRoundTripEvent, error) {
+	ev := &measurex.HTTPRoundTripEvent{
+		Failure:                 stringPtr(r.Failure),
+		Method:                  r.Method,
+		URL:                     r.URL,
+		StatusCode:              r.StatusCode,
+		ResponseBody:            r.ResponseBody,
+		ResponseBodyLength:      r.ResponseBodyLength,
+		ResponseBodyIsTruncated: r.ResponseBodyIsTruncated,
+		ResponseBodyIsUTF8:      r.ResponseBodyIsUTF8,
+		Finished:                r.Finished,
+		Started:                 r.Started,
+		Oddity:                  measurex.Oddity(r.Oddity),
+	}
+	if err := json.Unmarshal([]byte(r.RequestHeaders), &ev.RequestHeaders); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(r.ResponseHeaders), &ev.ResponseHeaders); err != nil {
+		return nil, err
+	}
+	return ev, nil
+}
+
+// urlDomain returns the host of an URL without the port or an
+// empty string if we cannot parse the URL.
+func urlDomain(URL string) string {
+	parsed, err := url.Parse(URL)
+	if err != nil {
+		return ""
+	}
+	return parsed.Hostname()
+}
+
+// httpRedirectRow is a row of the http_redirect table.
+type httpRedirectRow struct {
+	ID            int64          `db:"event_id,omitempty"`
+	MeasurementID int64          `db:"measurement_id"`
+	URL           string         `db:"url"`
+	Domain        string         `db:"domain"`
+	Location      string         `db:"location"`
+	Cookies       string         `db:"cookies"`
+	Error         sql.NullString `db:"error"`
+}
+
+func newHTTPRedirectRow(measurementID int64, ev *measurex.HTTPRedirectEvent) (*httpRedirectRow, error) {
+	cookies, err := json.Marshal(ev.Cookies)
+	if err != nil {
+		return nil, err
+	}
+	row := &httpRedirectRow{
+		MeasurementID: measurementID,
+		Cookies:       string(cookies),
+		Error:         newNullString(measurex.NewFailure(ev.Error)),
+	}
+	if ev.URL != nil {
+		row.URL = ev.URL.String()
+		row.Domain = ev.URL.Hostname()
+	}
+	if ev.Location != nil {
+		row.Location = ev.Location.String()
+	}
+	return row, nil
+}
+
+// redirectErrors contains the errors that measurex saves
+// into the Error field of an HTTPRedirectEvent.
+var redirectErrors = []error{
+	http.ErrUseLastResponse,
+	measurex.ErrHTTPTooManyRedirects,
+}
+
+func (r *httpRedirectRow) event() (*measurex.HTTPRedirectEvent, error) {
+	ev := &measurex.HTTPRedirectEvent{}
+	var err error
+	if ev.URL, err = parseOptionalURL(r.URL); err != nil {
+		return nil, err
+	}
+	if ev.Location, err = parseOptionalURL(r.Location); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(r.Cookies), &ev.Cookies); err != nil {
+		return nil, err
+	}
+	if r.Error.Valid {
+		ev.Error = errors.New(r.Error.String)
+		for _, e := range redirectErrors {
+			if e.Error() == r.Error.String {
+				ev.Error = e
+				break
+			}
+		}
+	}
+	return ev, nil
+}
+
+// parseOptionalURL parses an URL. It returns nil when the URL is empty.
+func parseOptionalURL(URL string) (*url.URL, error) {
+	if URL == "" {
+		return nil, nil
+	}
+	return url.Parse(URL)
+}
+
+// newNullString converts a failure to a sql.NullString.
+func newNullString(s *string) sql.NullString {
+	if s == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: *s, Valid: true}
+}
+
+// stringPtr converts a sql.NullString to a failure.
+func stringPtr(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
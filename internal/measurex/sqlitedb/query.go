@@ -0,0 +1,258 @@
+package sqlitedb
+
+//
+// Query
+//
+// This file contains the functions selecting events from
+// the database and rebuilding measurex.Measurement.
+//
+
+import (
+	"strings"
+
+	"github.com/ooni/probe-cli/v3/internal/measurex"
+)
+
+// filter selects events from all the tables. Each field is the
+// condition for the tables containing a given event type. An empty
+// condition means that we skip such tables. Each "?" inside a
+// condition is a placeholder for the value.
+type filter struct {
+	// network is the condition for dial, read_write and close.
+	network string
+
+	// handshake is the condition for tls_handshake and quic_handshake.
+	handshake string
+
+	// lookup is the condition for lookup_host and lookup_https_svc.
+	lookup string
+
+	// dnsRoundTrip is the condition for dns_round_trip.
+	dnsRoundTrip string
+
+	// httpRoundTrip is the condition for http_round_trip.
+	httpRoundTrip string
+
+	// httpRedirect is the condition for http_redirect.
+	httpRedirect string
+
+	// value is the value to compare with.
+	value interface{}
+}
+
+// where returns the arguments of Where for the given condition.
+func (f *filter) where(cond string) []interface{} {
+	out := []interface{}{cond}
+	for i := 0; i < strings.Count(cond, "?"); i++ {
+		out = append(out, f.value)
+	}
+	return out
+}
+
+// SelectByMeasurementID rebuilds the measurement with the given ID.
+func (db *DB) SelectByMeasurementID(id int64) (*measurex.Measurement, error) {
+	const cond = "measurement_id = ?"
+	return db.selectWhere(&filter{
+		network:       cond,
+		handshake:     cond,
+		lookup:        cond,
+		dnsRoundTrip:  cond,
+		httpRoundTrip: cond,
+		httpRedirect:  cond,
+		value:         id,
+	})
+}
+
+// SelectByConnID returns a measurement containing all the events
+// of the connection with the given ID. See also Connections.
+func (db *DB) SelectByConnID(connID int64) (*measurex.Measurement, error) {
+	const cond = "conn_id = ?"
+	return db.selectWhere(&filter{
+		network:   cond,
+		handshake: cond,
+		value:     connID,
+	})
+}
+
+// SelectByDomain returns a measurement containing all the events
+// for the given domain: the DNS lookups and round trips for the
+// domain, the handshakes using the domain as the SNI along with all
+// the events of their connections, and the HTTP round trips and
+// redirects whose URL host is the domain.
+func (db *DB) SelectByDomain(domain string) (*measurex.Measurement, error) {
+	return db.selectWhere(&filter{
+		network: "conn_id IN (SELECT conn_id FROM tls_handshake WHERE sni = ? " +
+			"UNION SELECT conn_id FROM quic_handshake WHERE sni = ?)",
+		handshake:     "sni = ?",
+		lookup:        "domain = ?",
+		dnsRoundTrip:  "domain = ?",
+		httpRoundTrip: "domain = ?",
+		httpRedirect:  "domain = ?",
+		value:         domain,
+	})
+}
+
+// SelectByFailure returns a measurement containing all the events
+// that failed with the given failure (e.g., "connection_reset"). We
+// do not select HTTP redirects, which do not have a failure.
+func (db *DB) SelectByFailure(failure string) (*measurex.Measurement, error) {
+	const cond = "failure = ?"
+	return db.selectWhere(&filter{
+		network:       cond,
+		handshake:     cond,
+		lookup:        cond,
+		dnsRoundTrip:  cond,
+		httpRoundTrip: cond,
+		value:         failure,
+	})
+}
+
+// Connections returns all the connections of the given measurement.
+func (db *DB) Connections(measurementID int64) ([]*Connection, error) {
+	var out []*Connection
+	err := db.sess.SelectFrom("connections").Where(
+		"measurement_id = ?", measurementID).OrderBy("conn_id").All(&out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// selectWhere builds a measurement from the events selected by the filter.
+func (db *DB) selectWhere(f *filter) (*measurex.Measurement, error) {
+	var err error
+	m := &measurex.Measurement{}
+	if m.Connect, err = db.selectNetworkEvents("dial", f, f.network); err != nil {
+		return nil, err
+	}
+	if m.ReadWrite, err = db.selectNetworkEvents("read_write", f, f.network); err != nil {
+		return nil, err
+	}
+	if m.Close, err = db.selectNetworkEvents("close", f, f.network); err != nil {
+		return nil, err
+	}
+	if m.TLSHandshake, err = db.selectHandshakes("tls_handshake", f, f.handshake); err != nil {
+		return nil, err
+	}
+	if m.QUICHandshake, err = db.selectHandshakes("quic_handshake", f, f.handshake); err != nil {
+		return nil, err
+	}
+	if m.LookupHost, err = db.selectLookups("lookup_host", f, f.lookup); err != nil {
+		return nil, err
+	}
+	if m.LookupHTTPSSvc, err = db.selectLookups("lookup_https_svc", f, f.lookup); err != nil {
+		return nil, err
+	}
+	if m.DNSRoundTrip, err = db.selectDNSRoundTrips(f, f.dnsRoundTrip); err != nil {
+		return nil, err
+	}
+	if m.HTTPRoundTrip, err = db.selectHTTPRoundTrips(f, f.httpRoundTrip); err != nil {
+		return nil, err
+	}
+	if m.HTTPRedirect, err = db.selectHTTPRedirects(f, f.httpRedirect); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// selectRows selects the rows of a table matching the condition in
+// the order in which we inserted them. It does nothing when the
+// condition is empty.
+func (db *DB) selectRows(table string, f *filter, cond string, rows interface{}) error {
+	if cond == "" {
+		return nil
+	}
+	return db.sess.SelectFrom(table).Where(f.where(cond)...).OrderBy("event_id").All(rows)
+}
+
+func (db *DB) selectNetworkEvents(
+	table string, f *filter, cond string) (out []*measurex.NetworkEvent, err error) {
+	var rows []*networkEventRow
+	if err := db.selectRows(table, f, cond, &rows); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		out = append(out, row.event())
+	}
+	return
+}
+
+func (db *DB) selectHandshakes(
+	table string, f *filter, cond string) (out []*measurex.QUICTLSHandshakeEvent, err error) {
+	var rows []*handshakeRow
+	if err := db.selectRows(table, f, cond, &rows); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		ev, err := row.event()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ev)
+	}
+	return
+}
+
+func (db *DB) selectLookups(
+	table string, f *filter, cond string) (out []*measurex.DNSLookupEvent, err error) {
+	var rows []*lookupRow
+	if err := db.selectRows(table, f, cond, &rows); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		ev, err := row.event()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ev)
+	}
+	return
+}
+
+func (db *DB) selectDNSRoundTrips(
+	f *filter, cond string) (out []*measurex.DNSRoundTripEvent, err error) {
+	var rows []*dnsRoundTripRow
+	if err := db.selectRows("dns_round_trip", f, cond, &rows); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		ev, err := row.event()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ev)
+	}
+	return
+}
+
+func (db *DB) selectHTTPRoundTrips(
+	f *filter, cond string) (out []*measurex.HTTPRoundTripEvent, err error) {
+	var rows []*httpRoundTripRow
+	if err := db.selectRows("http_round_trip", f, cond, &rows); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		ev, err := row.event()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ev)
+	}
+	return
+}
+
+func (db *DB) selectHTTPRedirects(
+	f *filter, cond string) (out []*measurex.HTTPRedirectEvent, err error) {
+	var rows []*httpRedirectRow
+	if err := db.selectRows("http_redirect", f, cond, &rows); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		ev, err := row.event()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ev)
+	}
+	return
+}
@@ -0,0 +1,263 @@
+// Package sqlitedb contains a measurex.WritableDB saving events
+// into a SQLite database.
+//
+// measurex.MeasurementDB keeps all the events in memory until we
+// call AsMeasurement. When we run many measurements (e.g., during
+// a long websteps crawl), you may want to use a MeasurementDB from
+// this package instead, which saves each event as soon as it occurs,
+// and rebuild the measurex.Measurement only when you need it.
+//
+// Each event type has its own table and we keep the events of all
+// the measurements in the same database. Therefore, you can also
+// select events across measurements (e.g., all the events with a
+// given failure). We assign an ID to each connection the first time
+// we see the ConnID of a measurex event, so concurrent connections to
+// the same endpoint have distinct IDs. When we rebuild events, their
+// ConnID is the ID of the connection in the database. See the
+// migrations for the schema of the database.
+package sqlitedb
+
+import (
+	"database/sql"
+	"embed"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-cli/v3/internal/fsx"
+	"github.com/ooni/probe-cli/v3/internal/measurex"
+	migrate "github.com/rubenv/sql-migrate"
+	"upper.io/db.v3/lib/sqlbuilder"
+	"upper.io/db.v3/sqlite"
+)
+
+//go:embed migrations/*.sql
+var efs embed.FS
+
+// runMigrations runs the database migrations.
+func runMigrations(db *sql.DB) error {
+	migrations := &migrate.AssetMigrationSource{
+		Asset:    fsx.ReadAssetFunc(efs),
+		AssetDir: fsx.ReadAssetDirFunc(efs),
+		Dir:      "migrations",
+	}
+	n, err := migrate.Exec(db, "sqlite3", migrations, migrate.Up)
+	if err != nil {
+		return err
+	}
+	log.Debugf("sqlitedb: performed %d migrations", n)
+	return nil
+}
+
+// DB is a SQLite database containing measurex events.
+type DB struct {
+	sess sqlbuilder.Database
+}
+
+// Open opens the database at the given path, creating it
+// if needed. Remember to Close the database when done.
+func Open(path string) (*DB, error) {
+	settings := sqlite.ConnectionURL{
+		Database: path,
+		Options: map[string]string{
+			"_foreign_keys": "1",
+			"_journal_mode": "WAL",
+			"_synchronous":  "NORMAL",
+		},
+	}
+	sess, err := sqlite.Open(settings)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite only allows one writer at a time. Using a single connection
+	// serializes concurrent inserts instead of failing them.
+	sess.SetMaxOpenConns(1)
+	if err := runMigrations(sess.Driver().(*sql.DB)); err != nil {
+		sess.Close()
+		return nil, err
+	}
+	return &DB{sess: sess}, nil
+}
+
+// Close closes the database.
+func (db *DB) Close() error {
+	return db.sess.Close()
+}
+
+// NewMeasurementDB creates a new measurement inside the database and
+// returns a MeasurementDB saving events into such a measurement.
+func (db *DB) NewMeasurementDB() (*MeasurementDB, error) {
+	// Note: we're not using Collection.Insert because upper.io/db.v3
+	// emits DEFAULT VALUES when inserting a single column.
+	res, err := db.sess.Exec(
+		"INSERT INTO measurements (created_at) VALUES (?)", time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return &MeasurementDB{
+		conns: map[int64]int64{},
+		db:    db,
+		id:    id,
+	}, nil
+}
+
+// MeasurementDB is a measurex.WritableDB saving the events of
+// a single measurement into a DB.
+//
+// The methods of measurex.WritableDB cannot return errors. When
+// we cannot save an event, we log a warning and remember the
+// error, which you can get by calling Err.
+type MeasurementDB struct {
+	// conns maps the measurex connection IDs to the IDs
+	// of the corresponding connections in the DB.
+	conns map[int64]int64
+
+	// db is the underlying DB.
+	db *DB
+
+	// err is the first error that occurred.
+	err error
+
+	// id is the ID of the measurement.
+	id int64
+
+	// mu protects conns and err.
+	mu sync.Mutex
+}
+
+var _ measurex.WritableDB = &MeasurementDB{}
+
+// ID returns the ID of the measurement.
+func (db *MeasurementDB) ID() int64 {
+	return db.id
+}
+
+// Err returns the first error that occurred when saving events.
+func (db *MeasurementDB) Err() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.err
+}
+
+// AsMeasurement reads back all the events saved so far
+// and rebuilds the corresponding measurex.Measurement.
+func (db *MeasurementDB) AsMeasurement() (*measurex.Measurement, error) {
+	return db.db.SelectByMeasurementID(db.id)
+}
+
+// setErr remembers the first error that occurred.
+func (db *MeasurementDB) setErr(err error) {
+	db.mu.Lock()
+	db.setErrLocked(err)
+	db.mu.Unlock()
+}
+
+// setErrLocked is like setErr but assumes we're holding the mutex.
+func (db *MeasurementDB) setErrLocked(err error) {
+	log.Warnf("sqlitedb: cannot save event: %s", err.Error())
+	if db.err == nil {
+		db.err = err
+	}
+}
+
+// insert inserts a row into a table.
+func (db *MeasurementDB) insert(table string, row interface{}, err error) {
+	if err == nil {
+		_, err = db.db.sess.Collection(table).Insert(row)
+	}
+	if err != nil {
+		db.setErr(err)
+	}
+}
+
+// connID returns the ID of the connection with the given measurex
+// connection ID, creating a new connection if we have not seen it yet.
+// We return a NULL ID when the measurex connection ID is zero (i.e.,
+// unknown) or when we cannot create the connection.
+func (db *MeasurementDB) connID(mxConnID int64, network, address string) sql.NullInt64 {
+	if mxConnID == 0 {
+		return sql.NullInt64{}
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if id, found := db.conns[mxConnID]; found {
+		return sql.NullInt64{Int64: id, Valid: true}
+	}
+	id, err := db.db.sess.Collection("connections").Insert(&Connection{
+		MeasurementID: db.id,
+		Network:       network,
+		Address:       address,
+	})
+	if err != nil {
+		db.setErrLocked(err)
+		return sql.NullInt64{}
+	}
+	db.conns[mxConnID] = id.(int64)
+	return sql.NullInt64{Int64: id.(int64), Valid: true}
+}
+
+// InsertIntoDial implements WritableDB.InsertIntoDial.
+func (db *MeasurementDB) InsertIntoDial(ev *measurex.NetworkEvent) {
+	connID := db.connID(ev.ConnID, ev.Network, ev.RemoteAddr)
+	db.insert("dial", newNetworkEventRow(db.id, connID, ev), nil)
+}
+
+// InsertIntoReadWrite implements WritableDB.InsertIntoReadWrite.
+func (db *MeasurementDB) InsertIntoReadWrite(ev *measurex.NetworkEvent) {
+	connID := db.connID(ev.ConnID, ev.Network, ev.RemoteAddr)
+	db.insert("read_write", newNetworkEventRow(db.id, connID, ev), nil)
+}
+
+// InsertIntoClose implements WritableDB.InsertIntoClose.
+func (db *MeasurementDB) InsertIntoClose(ev *measurex.NetworkEvent) {
+	connID := db.connID(ev.ConnID, ev.Network, ev.RemoteAddr)
+	db.insert("close", newNetworkEventRow(db.id, connID, ev), nil)
+}
+
+// InsertIntoTLSHandshake implements WritableDB.InsertIntoTLSHandshake.
+func (db *MeasurementDB) InsertIntoTLSHandshake(ev *measurex.QUICTLSHandshakeEvent) {
+	connID := db.connID(ev.ConnID, ev.Network, ev.RemoteAddr)
+	row, err := newHandshakeRow(db.id, connID, ev)
+	db.insert("tls_handshake", row, err)
+}
+
+// InsertIntoLookupHost implements WritableDB.InsertIntoLookupHost.
+func (db *MeasurementDB) InsertIntoLookupHost(ev *measurex.DNSLookupEvent) {
+	row, err := newLookupRow(db.id, ev)
+	db.insert("lookup_host", row, err)
+}
+
+// InsertIntoLookupHTTPSSvc implements WritableDB.InsertIntoLookupHTTPSSvc.
+func (db *MeasurementDB) InsertIntoLookupHTTPSSvc(ev *measurex.DNSLookupEvent) {
+	row, err := newLookupRow(db.id, ev)
+	db.insert("lookup_https_svc", row, err)
+}
+
+// InsertIntoDNSRoundTrip implements WritableDB.InsertIntoDNSRoundTrip.
+func (db *MeasurementDB) InsertIntoDNSRoundTrip(ev *measurex.DNSRoundTripEvent) {
+	row, err := newDNSRoundTripRow(db.id, ev)
+	db.insert("dns_round_trip", row, err)
+}
+
+// InsertIntoHTTPRoundTrip implements WritableDB.InsertIntoHTTPRoundTrip.
+func (db *MeasurementDB) InsertIntoHTTPRoundTrip(ev *measurex.HTTPRoundTripEvent) {
+	row, err := newHTTPRoundTripRow(db.id, ev)
+	db.insert("http_round_trip", row, err)
+}
+
+// InsertIntoHTTPRedirect implements WritableDB.InsertIntoHTTPRedirect.
+func (db *MeasurementDB) InsertIntoHTTPRedirect(ev *measurex.HTTPRedirectEvent) {
+	row, err := newHTTPRedirectRow(db.id, ev)
+	db.insert("http_redirect", row, err)
+}
+
+// InsertIntoQUICHandshake implements WritableDB.InsertIntoQUICHandshake.
+func (db *MeasurementDB) InsertIntoQUICHandshake(ev *measurex.QUICTLSHandshakeEvent) {
+	connID := db.connID(ev.ConnID, ev.Network, ev.RemoteAddr)
+	row, err := newHandshakeRow(db.id, connID, ev)
+	db.insert("quic_handshake", row, err)
+}
@@ -0,0 +1,323 @@
+package sqlitedb
+
+import (
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-cli/v3/internal/measurex"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+// failure returns a pointer to the given failure.
+func failure(s string) *string {
+	return &s
+}
+
+// dnsQuery returns a DNS query for the given domain.
+func dnsQuery(t *testing.T, domain string) []byte {
+	msg := &dns.Msg{}
+	msg.SetQuestion(dns.Fqdn(domain), dns.TypeA)
+	msg.Id = 0x1234 // make the query deterministic
+	data, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// insertEvents inserts into db the events of a measurement of
+// https://example.com/ with a QUIC handshake to 8.8.8.8 and two
+// concurrent connections to 93.184.216.34:443, the second of which
+// fails. The ConnIDs we use are the ones that a fresh DB assigns to
+// the connections, so that we can compare with measurex.MeasurementDB.
+func insertEvents(t *testing.T, db measurex.WritableDB) {
+	db.InsertIntoDNSRoundTrip(&measurex.DNSRoundTripEvent{
+		Network:  "udp",
+		Address:  "8.8.8.8:53",
+		Query:    dnsQuery(t, "example.com"),
+		Started:  0.1,
+		Finished: 0.2,
+		Reply:    []byte{0x11, 0x22},
+		Responses: []*measurex.DNSResponseEvent{{
+			Reply:    []byte{0x11, 0x22},
+			Received: 0.15,
+		}},
+	})
+	db.InsertIntoLookupHost(&measurex.DNSLookupEvent{
+		Network:   "udp",
+		Domain:    "example.com",
+		QueryType: "A",
+		Address:   "8.8.8.8:53",
+		Started:   0.1,
+		Finished:  0.2,
+		A:         []string{"93.184.216.34"},
+	})
+	db.InsertIntoLookupHTTPSSvc(&measurex.DNSLookupEvent{
+		Network:   "udp",
+		Failure:   failure(netxlite.FailureDNSNXDOMAINError),
+		Domain:    "example.com",
+		QueryType: "HTTPS",
+		Address:   "8.8.8.8:53",
+		Started:   0.1,
+		Finished:  0.2,
+		Oddity:    measurex.OddityDNSLookupNXDOMAIN,
+	})
+	// We interleave the events of the two connections to the same
+	// endpoint, as it happens when we use them concurrently.
+	connFailures := []*string{nil, failure(netxlite.FailureConnectionReset)}
+	for idx := range connFailures {
+		db.InsertIntoDial(&measurex.NetworkEvent{
+			ConnID:     int64(idx + 1),
+			RemoteAddr: "93.184.216.34:443",
+			Operation:  "connect",
+			Network:    "tcp",
+			Started:    0.3,
+			Finished:   0.4,
+		})
+	}
+	for idx, connFailure := range connFailures {
+		db.InsertIntoReadWrite(&measurex.NetworkEvent{
+			ConnID:     int64(idx + 1),
+			RemoteAddr: "93.184.216.34:443",
+			Failure:    connFailure,
+			Count:      517,
+			Operation:  "write",
+			Network:    "tcp",
+			Started:    0.41,
+			Finished:   0.42,
+		})
+	}
+	for idx, connFailure := range connFailures {
+		db.InsertIntoTLSHandshake(&measurex.QUICTLSHandshakeEvent{
+			ConnID:          int64(idx + 1),
+			CipherSuite:     "TLS_AES_128_GCM_SHA256",
+			Failure:         connFailure,
+			NegotiatedProto: "h2",
+			TLSVersion:      "TLSv1.3",
+			PeerCerts:       [][]byte{{0x30, 0x82}, {0x30, 0x83}},
+			Finished:        0.5,
+			RemoteAddr:      "93.184.216.34:443",
+			SNI:             "example.com",
+			ALPN:            []string{"h2", "http/1.1"},
+			Network:         "tcp",
+			Started:         0.4,
+		})
+	}
+	for idx := range connFailures {
+		db.InsertIntoClose(&measurex.NetworkEvent{
+			ConnID:     int64(idx + 1),
+			RemoteAddr: "93.184.216.34:443",
+			Operation:  "close",
+			Network:    "tcp",
+			Started:    0.6,
+			Finished:   0.6,
+		})
+	}
+	db.InsertIntoReadWrite(&measurex.NetworkEvent{
+		ConnID:     3,
+		RemoteAddr: "8.8.8.8:443",
+		Count:      1252,
+		Operation:  "write_to",
+		Network:    "quic",
+		Started:    0.7,
+		Finished:   0.7,
+	})
+	db.InsertIntoQUICHandshake(&measurex.QUICTLSHandshakeEvent{
+		ConnID:     3,
+		Failure:    failure(netxlite.FailureGenericTimeoutError),
+		RemoteAddr: "8.8.8.8:443",
+		SNI:        "dns.google",
+		ALPN:       []string{"h3"},
+		Network:    "quic",
+		Oddity:     measurex.OddityQUICHandshakeTimeout,
+		Started:    0.7,
+		Finished:   0.8,
+	})
+	db.InsertIntoClose(&measurex.NetworkEvent{
+		ConnID:    3,
+		Operation: "close",
+		Network:   "quic",
+		Started:   0.8,
+		Finished:  0.8,
+	})
+	db.InsertIntoHTTPRoundTrip(&measurex.HTTPRoundTripEvent{
+		Method:                  "GET",
+		URL:                     "https://example.com/",
+		RequestHeaders:          http.Header{"Accept": {"*/*"}},
+		StatusCode:              301,
+		ResponseHeaders:         http.Header{"Location": {"https://www.example.com/"}},
+		ResponseBody:            []byte("moved"),
+		ResponseBodyLength:      5,
+		ResponseBodyIsTruncated: true,
+		ResponseBodyIsUTF8:      true,
+		Finished:                0.9,
+		Started:                 0.5,
+	})
+	db.InsertIntoHTTPRedirect(&measurex.HTTPRedirectEvent{
+		URL:      &url.URL{Scheme: "https", Host: "example.com", Path: "/"},
+		Location: &url.URL{Scheme: "https", Host: "www.example.com", Path: "/"},
+		Cookies:  []*http.Cookie{{Name: "a", Value: "b", Raw: "a=b"}},
+		Error:    http.ErrUseLastResponse,
+	})
+}
+
+// openDB opens a new database in a temporary directory.
+func openDB(t *testing.T) (*DB, string) {
+	path := filepath.Join(t.TempDir(), "measurex.sqlite3")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, path
+}
+
+// newMeasurementDB creates a new MeasurementDB containing the events.
+func newMeasurementDB(t *testing.T, db *DB) *MeasurementDB {
+	mdb, err := db.NewMeasurementDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	insertEvents(t, mdb)
+	if err := mdb.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return mdb
+}
+
+// diffMeasurements compares two measurements.
+func diffMeasurements(expect, got *measurex.Measurement) string {
+	return cmp.Diff(expect, got, cmpopts.EquateErrors(), cmpopts.IgnoreUnexported(url.URL{}))
+}
+
+func TestMeasurementDB(t *testing.T) {
+	t.Run("AsMeasurement is like measurex.MeasurementDB.AsMeasurement", func(t *testing.T) {
+		expect := &measurex.MeasurementDB{}
+		insertEvents(t, expect)
+		db, _ := openDB(t)
+		defer db.Close()
+		got, err := newMeasurementDB(t, db).AsMeasurement()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := diffMeasurements(expect.AsMeasurement(), got); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we can read measurements saved by previous runs", func(t *testing.T) {
+		db, path := openDB(t)
+		first := newMeasurementDB(t, db)
+		second := newMeasurementDB(t, db)
+		expect, err := first.AsMeasurement()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+		db, err = Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		got, err := db.SelectByMeasurementID(first.ID())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := diffMeasurements(expect, got); diff != "" {
+			t.Fatal(diff)
+		}
+		if second.ID() == first.ID() {
+			t.Fatal("expected different measurement IDs")
+		}
+	})
+}
+
+func TestDBQueries(t *testing.T) {
+	db, _ := openDB(t)
+	defer db.Close()
+	mdb := newMeasurementDB(t, db)
+	newMeasurementDB(t, db) // make sure we select across measurements
+
+	t.Run("Connections and SelectByConnID", func(t *testing.T) {
+		conns, err := db.Connections(mdb.ID())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var endpoints []string
+		for _, conn := range conns {
+			endpoints = append(endpoints, conn.Address+"/"+conn.Network)
+		}
+		expectEndpoints := []string{"93.184.216.34:443/tcp", "93.184.216.34:443/tcp", "8.8.8.8:443/quic"}
+		if diff := cmp.Diff(expectEndpoints, endpoints); diff != "" {
+			t.Fatal(diff)
+		}
+		m, err := db.SelectByConnID(conns[1].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(m.Connect) != 1 || len(m.ReadWrite) != 1 || len(m.TLSHandshake) != 1 || len(m.Close) != 1 {
+			t.Fatal("unexpected events", m)
+		}
+		if m.ReadWrite[0].Failure == nil || *m.ReadWrite[0].Failure != netxlite.FailureConnectionReset {
+			t.Fatal("expected the events of the second connection")
+		}
+		if m.TLSHandshake[0].Failure == nil || *m.TLSHandshake[0].Failure != netxlite.FailureConnectionReset {
+			t.Fatal("expected the events of the second connection")
+		}
+		if len(m.LookupHost) != 0 || len(m.HTTPRoundTrip) != 0 || len(m.QUICHandshake) != 0 {
+			t.Fatal("unexpected events", m)
+		}
+	})
+
+	t.Run("SelectByDomain", func(t *testing.T) {
+		m, err := db.SelectByDomain("dns.google")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(m.QUICHandshake) != 2 || len(m.ReadWrite) != 2 || len(m.Close) != 2 {
+			t.Fatal("unexpected events", m)
+		}
+		if len(m.Connect) != 0 || len(m.TLSHandshake) != 0 || len(m.LookupHost) != 0 {
+			t.Fatal("unexpected events", m)
+		}
+		m, err = db.SelectByDomain("example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts := []int{
+			len(m.Connect), len(m.ReadWrite), len(m.Close), len(m.TLSHandshake),
+			len(m.QUICHandshake), len(m.LookupHost), len(m.LookupHTTPSSvc),
+			len(m.DNSRoundTrip), len(m.HTTPRoundTrip), len(m.HTTPRedirect),
+		}
+		expectCounts := []int{4, 4, 4, 4, 0, 2, 2, 2, 2, 2}
+		if diff := cmp.Diff(expectCounts, counts); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("SelectByFailure", func(t *testing.T) {
+		m, err := db.SelectByFailure(netxlite.FailureConnectionReset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(m.ReadWrite) != 2 || len(m.TLSHandshake) != 2 {
+			t.Fatal("unexpected events", m)
+		}
+		if len(m.Connect) != 0 || len(m.Close) != 0 || len(m.HTTPRedirect) != 0 {
+			t.Fatal("unexpected events", m)
+		}
+		m, err = db.SelectByFailure(netxlite.FailureDNSNXDOMAINError)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(m.LookupHTTPSSvc) != 2 || len(m.LookupHost) != 0 {
+			t.Fatal("unexpected events", m)
+		}
+	})
+}
@@ -19,26 +19,42 @@ import (
 )
 
 // WrapTLSHandshaker wraps a netxlite.TLSHandshaker to return a new
-// instance of TLSHandshaker that saves events into the DB.
+// instance of TLSHandshaker that saves events into the DB. We assume
+// that thx uses the ClientHello described by mx.TLSFingerprint.
 func (mx *Measurer) WrapTLSHandshaker(db WritableDB, thx model.TLSHandshaker) model.TLSHandshaker {
-	return &tlsHandshakerDB{TLSHandshaker: thx, db: db, begin: mx.Begin}
+	return mx.wrapTLSHandshaker(db, thx, mx.TLSFingerprint)
 }
 
 // NewTLSHandshakerStdlib creates a new TLS handshaker that
 // saves results into the DB and uses the stdlib for TLS.
 func (mx *Measurer) NewTLSHandshakerStdlib(db WritableDB, logger model.Logger) model.TLSHandshaker {
-	return mx.WrapTLSHandshaker(db, netxlite.NewTLSHandshakerStdlib(logger))
+	return mx.wrapTLSHandshaker(
+		db, netxlite.NewTLSHandshakerStdlib(logger), netxlite.TLSFingerprintGo)
+}
+
+func (mx *Measurer) wrapTLSHandshaker(db WritableDB,
+	thx model.TLSHandshaker, fingerprint string) model.TLSHandshaker {
+	return &tlsHandshakerDB{
+		TLSHandshaker: thx,
+		begin:         mx.Begin,
+		db:            db,
+		fingerprint:   fingerprint,
+	}
 }
 
 type tlsHandshakerDB struct {
 	model.TLSHandshaker
-	begin time.Time
-	db    WritableDB
+	begin       time.Time
+	db          WritableDB
+	fingerprint string
 }
 
-// QUICTLSHandshakeEvent contains a QUIC or TLS handshake event.
+// QUICTLSHandshakeEvent contains a QUIC or TLS handshake event. The
+// ConnID field identifies the connection (zero means unknown).
 type QUICTLSHandshakeEvent struct {
+	ConnID          int64
 	CipherSuite     string
+	Fingerprint     string
 	Failure         *string
 	NegotiatedProto string
 	TLSVersion      string
@@ -61,6 +77,7 @@ func (thx *tlsHandshakerDB) Handshake(ctx context.Context,
 	tconn, state, err := thx.TLSHandshaker.Handshake(ctx, conn, config)
 	finished := time.Since(thx.begin).Seconds()
 	thx.db.InsertIntoTLSHandshake(&QUICTLSHandshakeEvent{
+		ConnID:          connIDOf(conn),
 		Network:         network,
 		RemoteAddr:      remoteAddr,
 		SNI:             config.ServerName,
@@ -72,6 +89,7 @@ func (thx *tlsHandshakerDB) Handshake(ctx context.Context,
 		Oddity:          thx.computeOddity(err),
 		TLSVersion:      netxlite.TLSVersionString(state.Version),
 		CipherSuite:     netxlite.TLSCipherSuiteString(state.CipherSuite),
+		Fingerprint:     thx.fingerprint,
 		NegotiatedProto: state.NegotiatedProtocol,
 		PeerCerts:       peerCerts(err, &state),
 	})
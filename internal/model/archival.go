@@ -112,15 +112,27 @@ func (hb *ArchivalMaybeBinaryData) UnmarshalJSON(d []byte) error {
 //
 // See https://github.com/ooni/spec/blob/master/data-formats/df-002-dnst.md.
 type ArchivalDNSLookupResult struct {
-	Answers          []ArchivalDNSAnswer `json:"answers"`
-	Engine           string              `json:"engine"`
-	Failure          *string             `json:"failure"`
-	Hostname         string              `json:"hostname"`
-	QueryType        string              `json:"query_type"`
-	ResolverHostname *string             `json:"resolver_hostname"`
-	ResolverPort     *string             `json:"resolver_port"`
-	ResolverAddress  string              `json:"resolver_address"`
-	T                float64             `json:"t"`
+	Answers          []ArchivalDNSAnswer        `json:"answers"`
+	AuthenticData    bool                       `json:"authentic_data,omitempty"`
+	Engine           string                     `json:"engine"`
+	ExtendedErrors   []ArchivalDNSExtendedError `json:"extended_dns_errors,omitempty"`
+	Failure          *string                    `json:"failure"`
+	HasRRSIG         bool                       `json:"has_rrsig,omitempty"`
+	Hostname         string                     `json:"hostname"`
+	QueryType        string                     `json:"query_type"`
+	ResolverHostname *string                    `json:"resolver_hostname"`
+	ResolverPort     *string                    `json:"resolver_port"`
+	ResolverAddress  string                     `json:"resolver_address"`
+	T                float64                    `json:"t"`
+}
+
+// ArchivalDNSExtendedError is an RFC8914 extended DNS error. Resolvers
+// that filter domains may use codes such as 15 ("Blocked"), 16
+// ("Censored"), or 17 ("Filtered") to tell us what they did.
+type ArchivalDNSExtendedError struct {
+	InfoCode  uint16 `json:"info_code"`
+	Name      string `json:"name,omitempty"`
+	ExtraText string `json:"extra_text,omitempty"`
 }
 
 // ArchivalDNSAnswer is a DNS answer.
@@ -131,9 +143,33 @@ type ArchivalDNSAnswer struct {
 	Hostname   string  `json:"hostname,omitempty"`
 	IPv4       string  `json:"ipv4,omitempty"`
 	IPv6       string  `json:"ipv6,omitempty"`
+	Preference uint16  `json:"preference,omitempty"`
+	Text       string  `json:"text,omitempty"`
 	TTL        *uint32 `json:"ttl"`
 }
 
+// ArchivalDNSResponses contains all the responses we received
+// for a single DNS query sent using DNS-over-UDP. Receiving more than
+// one response for the same query typically indicates that someone
+// on path is injecting forged responses.
+type ArchivalDNSResponses struct {
+	Conflicting     bool                  `json:"conflicting"`
+	Engine          string                `json:"engine"`
+	Hostname        string                `json:"hostname"`
+	QueryType       string                `json:"query_type"`
+	ResolverAddress string                `json:"resolver_address"`
+	Responses       []ArchivalDNSResponse `json:"responses"`
+	T               float64               `json:"t"`
+}
+
+// ArchivalDNSResponse is one of the responses inside ArchivalDNSResponses.
+type ArchivalDNSResponse struct {
+	Answers  []ArchivalDNSAnswer `json:"answers"`
+	Failure  *string             `json:"failure"`
+	RawReply []byte              `json:"raw_reply"`
+	T        float64             `json:"t"`
+}
+
 //
 // TCP connect
 //
@@ -163,15 +199,18 @@ type ArchivalTCPConnectStatus struct {
 //
 // See https://github.com/ooni/spec/blob/master/data-formats/df-006-tlshandshake.md
 type ArchivalTLSOrQUICHandshakeResult struct {
-	CipherSuite        string                    `json:"cipher_suite"`
-	Failure            *string                   `json:"failure"`
-	NegotiatedProtocol string                    `json:"negotiated_protocol"`
-	NoTLSVerify        bool                      `json:"no_tls_verify"`
-	PeerCertificates   []ArchivalMaybeBinaryData `json:"peer_certificates"`
-	ServerName         string                    `json:"server_name"`
-	T                  float64                   `json:"t"`
-	Tags               []string                  `json:"tags"`
-	TLSVersion         string                    `json:"tls_version"`
+	CipherSuite            string                    `json:"cipher_suite"`
+	ClientHelloFingerprint string                    `json:"client_hello_fingerprint,omitempty"`
+	ClientHelloSplit       string                    `json:"client_hello_split,omitempty"`
+	ClientHelloSplitDelay  float64                   `json:"client_hello_split_delay,omitempty"`
+	Failure                *string                   `json:"failure"`
+	NegotiatedProtocol     string                    `json:"negotiated_protocol"`
+	NoTLSVerify            bool                      `json:"no_tls_verify"`
+	PeerCertificates       []ArchivalMaybeBinaryData `json:"peer_certificates"`
+	ServerName             string                    `json:"server_name"`
+	T                      float64                   `json:"t"`
+	Tags                   []string                  `json:"tags"`
+	TLSVersion             string                    `json:"tls_version"`
 }
 
 //
@@ -1,12 +1,31 @@
 package mocks
 
-import "github.com/ooni/probe-cli/v3/internal/model"
+import (
+	"net"
+	"time"
+
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
 
 // DNSDecoder allows mocking dnsx.DNSDecoder.
 type DNSDecoder struct {
 	MockDecodeLookupHost func(qtype uint16, reply []byte) ([]string, error)
 
 	MockDecodeHTTPS func(reply []byte) (*model.HTTPSSvc, error)
+
+	MockDecodeSVCB func(reply []byte) (*model.HTTPSSvc, error)
+
+	MockDecodeCNAME func(reply []byte) ([]string, error)
+
+	MockDecodeNS func(reply []byte) ([]*net.NS, error)
+
+	MockDecodeMX func(reply []byte) ([]*net.MX, error)
+
+	MockDecodeTXT func(reply []byte) ([]string, error)
+
+	MockDecodeReplyInfo func(reply []byte) (*model.DNSReplyInfo, error)
+
+	MockDecodeTTL func(reply []byte) (time.Duration, error)
 }
 
 // DecodeLookupHost calls MockDecodeLookupHost.
@@ -18,3 +37,38 @@ func (e *DNSDecoder) DecodeLookupHost(qtype uint16, reply []byte) ([]string, err
 func (e *DNSDecoder) DecodeHTTPS(reply []byte) (*model.HTTPSSvc, error) {
 	return e.MockDecodeHTTPS(reply)
 }
+
+// DecodeSVCB calls MockDecodeSVCB.
+func (e *DNSDecoder) DecodeSVCB(reply []byte) (*model.HTTPSSvc, error) {
+	return e.MockDecodeSVCB(reply)
+}
+
+// DecodeCNAME calls MockDecodeCNAME.
+func (e *DNSDecoder) DecodeCNAME(reply []byte) ([]string, error) {
+	return e.MockDecodeCNAME(reply)
+}
+
+// DecodeNS calls MockDecodeNS.
+func (e *DNSDecoder) DecodeNS(reply []byte) ([]*net.NS, error) {
+	return e.MockDecodeNS(reply)
+}
+
+// DecodeMX calls MockDecodeMX.
+func (e *DNSDecoder) DecodeMX(reply []byte) ([]*net.MX, error) {
+	return e.MockDecodeMX(reply)
+}
+
+// DecodeTXT calls MockDecodeTXT.
+func (e *DNSDecoder) DecodeTXT(reply []byte) ([]string, error) {
+	return e.MockDecodeTXT(reply)
+}
+
+// DecodeReplyInfo calls MockDecodeReplyInfo.
+func (e *DNSDecoder) DecodeReplyInfo(reply []byte) (*model.DNSReplyInfo, error) {
+	return e.MockDecodeReplyInfo(reply)
+}
+
+// DecodeTTL calls MockDecodeTTL.
+func (e *DNSDecoder) DecodeTTL(reply []byte) (time.Duration, error) {
+	return e.MockDecodeTTL(reply)
+}
@@ -2,7 +2,9 @@ package mocks
 
 import (
 	"errors"
+	"net"
 	"testing"
+	"time"
 
 	"github.com/miekg/dns"
 	"github.com/ooni/probe-cli/v3/internal/model"
@@ -40,4 +42,116 @@ func TestDNSDecoder(t *testing.T) {
 			t.Fatal("unexpected out")
 		}
 	})
+
+	t.Run("DecodeSVCB", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		e := &DNSDecoder{
+			MockDecodeSVCB: func(reply []byte) (*model.HTTPSSvc, error) {
+				return nil, expected
+			},
+		}
+		out, err := e.DecodeSVCB(make([]byte, 17))
+		if !errors.Is(err, expected) {
+			t.Fatal("unexpected err", err)
+		}
+		if out != nil {
+			t.Fatal("unexpected out")
+		}
+	})
+
+	t.Run("DecodeCNAME", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		e := &DNSDecoder{
+			MockDecodeCNAME: func(reply []byte) ([]string, error) {
+				return nil, expected
+			},
+		}
+		out, err := e.DecodeCNAME(make([]byte, 17))
+		if !errors.Is(err, expected) {
+			t.Fatal("unexpected err", err)
+		}
+		if out != nil {
+			t.Fatal("unexpected out")
+		}
+	})
+
+	t.Run("DecodeNS", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		e := &DNSDecoder{
+			MockDecodeNS: func(reply []byte) ([]*net.NS, error) {
+				return nil, expected
+			},
+		}
+		out, err := e.DecodeNS(make([]byte, 17))
+		if !errors.Is(err, expected) {
+			t.Fatal("unexpected err", err)
+		}
+		if out != nil {
+			t.Fatal("unexpected out")
+		}
+	})
+
+	t.Run("DecodeMX", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		e := &DNSDecoder{
+			MockDecodeMX: func(reply []byte) ([]*net.MX, error) {
+				return nil, expected
+			},
+		}
+		out, err := e.DecodeMX(make([]byte, 17))
+		if !errors.Is(err, expected) {
+			t.Fatal("unexpected err", err)
+		}
+		if out != nil {
+			t.Fatal("unexpected out")
+		}
+	})
+
+	t.Run("DecodeTXT", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		e := &DNSDecoder{
+			MockDecodeTXT: func(reply []byte) ([]string, error) {
+				return nil, expected
+			},
+		}
+		out, err := e.DecodeTXT(make([]byte, 17))
+		if !errors.Is(err, expected) {
+			t.Fatal("unexpected err", err)
+		}
+		if out != nil {
+			t.Fatal("unexpected out")
+		}
+	})
+
+	t.Run("DecodeReplyInfo", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		e := &DNSDecoder{
+			MockDecodeReplyInfo: func(reply []byte) (*model.DNSReplyInfo, error) {
+				return nil, expected
+			},
+		}
+		out, err := e.DecodeReplyInfo(make([]byte, 17))
+		if !errors.Is(err, expected) {
+			t.Fatal("unexpected err", err)
+		}
+		if out != nil {
+			t.Fatal("unexpected out")
+		}
+	})
+
+	t.Run("DecodeTTL", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		e := &DNSDecoder{
+			MockDecodeTTL: func(reply []byte) (time.Duration, error) {
+				return 0, expected
+			},
+		}
+		out, err := e.DecodeTTL(make([]byte, 17))
+		if !errors.Is(err, expected) {
+			t.Fatal("unexpected err", err)
+		}
+		if out != 0 {
+			t.Fatal("unexpected out")
+		}
+	})
 }
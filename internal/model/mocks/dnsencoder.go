@@ -1,11 +1,22 @@
 package mocks
 
+import "github.com/ooni/probe-cli/v3/internal/model"
+
 // DNSEncoder allows mocking dnsx.DNSEncoder.
 type DNSEncoder struct {
 	MockEncode func(domain string, qtype uint16, padding bool) ([]byte, error)
+
+	MockEncodeWithOptions func(domain string, qtype uint16,
+		options *model.DNSQueryOptions) ([]byte, error)
 }
 
 // Encode calls MockEncode.
 func (e *DNSEncoder) Encode(domain string, qtype uint16, padding bool) ([]byte, error) {
 	return e.MockEncode(domain, qtype, padding)
 }
+
+// EncodeWithOptions calls MockEncodeWithOptions.
+func (e *DNSEncoder) EncodeWithOptions(
+	domain string, qtype uint16, options *model.DNSQueryOptions) ([]byte, error) {
+	return e.MockEncodeWithOptions(domain, qtype, options)
+}
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/miekg/dns"
+	"github.com/ooni/probe-cli/v3/internal/model"
 )
 
 func TestDNSEncoder(t *testing.T) {
@@ -23,4 +24,21 @@ func TestDNSEncoder(t *testing.T) {
 			t.Fatal("unexpected out")
 		}
 	})
+
+	t.Run("EncodeWithOptions", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		e := &DNSEncoder{
+			MockEncodeWithOptions: func(domain string, qtype uint16,
+				options *model.DNSQueryOptions) ([]byte, error) {
+				return nil, expected
+			},
+		}
+		out, err := e.EncodeWithOptions("dns.google", dns.TypeA, &model.DNSQueryOptions{})
+		if !errors.Is(err, expected) {
+			t.Fatal("unexpected err", err)
+		}
+		if out != nil {
+			t.Fatal("unexpected out")
+		}
+	})
 }
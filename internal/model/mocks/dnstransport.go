@@ -1,6 +1,10 @@
 package mocks
 
-import "context"
+import (
+	"context"
+
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
 
 // DNSTransport allows mocking dnsx.DNSTransport.
 type DNSTransport struct {
@@ -39,3 +43,49 @@ func (txp *DNSTransport) Address() string {
 func (txp *DNSTransport) CloseIdleConnections() {
 	txp.MockCloseIdleConnections()
 }
+
+// DNSTransportWithDuplicates allows mocking model.DNSTransportWithDuplicates.
+type DNSTransportWithDuplicates struct {
+	MockRoundTripWithDuplicates func(ctx context.Context, query []byte) ([]*model.DNSResponse, error)
+
+	MockRoundTrip func(ctx context.Context, query []byte) ([]byte, error)
+
+	MockRequiresPadding func() bool
+
+	MockNetwork func() string
+
+	MockAddress func() string
+
+	MockCloseIdleConnections func()
+}
+
+// RoundTripWithDuplicates calls MockRoundTripWithDuplicates.
+func (txp *DNSTransportWithDuplicates) RoundTripWithDuplicates(
+	ctx context.Context, query []byte) ([]*model.DNSResponse, error) {
+	return txp.MockRoundTripWithDuplicates(ctx, query)
+}
+
+// RoundTrip calls MockRoundTrip.
+func (txp *DNSTransportWithDuplicates) RoundTrip(ctx context.Context, query []byte) ([]byte, error) {
+	return txp.MockRoundTrip(ctx, query)
+}
+
+// RequiresPadding calls MockRequiresPadding.
+func (txp *DNSTransportWithDuplicates) RequiresPadding() bool {
+	return txp.MockRequiresPadding()
+}
+
+// Network calls MockNetwork.
+func (txp *DNSTransportWithDuplicates) Network() string {
+	return txp.MockNetwork()
+}
+
+// Address calls MockAddress.
+func (txp *DNSTransportWithDuplicates) Address() string {
+	return txp.MockAddress()
+}
+
+// CloseIdleConnections calls MockCloseIdleConnections.
+func (txp *DNSTransportWithDuplicates) CloseIdleConnections() {
+	txp.MockCloseIdleConnections()
+}
@@ -139,6 +139,72 @@ func (s *QUICEarlySession) ReceiveMessage() ([]byte, error) {
 	return s.MockReceiveMessage()
 }
 
+// QUICStream is a mockable quic.Stream.
+type QUICStream struct {
+	MockStreamID         func() quic.StreamID
+	MockRead             func(b []byte) (int, error)
+	MockCancelRead       func(code quic.StreamErrorCode)
+	MockSetReadDeadline  func(t time.Time) error
+	MockWrite            func(b []byte) (int, error)
+	MockClose            func() error
+	MockCancelWrite      func(code quic.StreamErrorCode)
+	MockContext          func() context.Context
+	MockSetWriteDeadline func(t time.Time) error
+	MockSetDeadline      func(t time.Time) error
+}
+
+var _ quic.Stream = &QUICStream{}
+
+// StreamID calls MockStreamID.
+func (s *QUICStream) StreamID() quic.StreamID {
+	return s.MockStreamID()
+}
+
+// Read calls MockRead.
+func (s *QUICStream) Read(b []byte) (int, error) {
+	return s.MockRead(b)
+}
+
+// CancelRead calls MockCancelRead.
+func (s *QUICStream) CancelRead(code quic.StreamErrorCode) {
+	s.MockCancelRead(code)
+}
+
+// SetReadDeadline calls MockSetReadDeadline.
+func (s *QUICStream) SetReadDeadline(t time.Time) error {
+	return s.MockSetReadDeadline(t)
+}
+
+// Write calls MockWrite.
+func (s *QUICStream) Write(b []byte) (int, error) {
+	return s.MockWrite(b)
+}
+
+// Close calls MockClose.
+func (s *QUICStream) Close() error {
+	return s.MockClose()
+}
+
+// CancelWrite calls MockCancelWrite.
+func (s *QUICStream) CancelWrite(code quic.StreamErrorCode) {
+	s.MockCancelWrite(code)
+}
+
+// Context calls MockContext.
+func (s *QUICStream) Context() context.Context {
+	return s.MockContext()
+}
+
+// SetWriteDeadline calls MockSetWriteDeadline.
+func (s *QUICStream) SetWriteDeadline(t time.Time) error {
+	return s.MockSetWriteDeadline(t)
+}
+
+// SetDeadline calls MockSetDeadline.
+func (s *QUICStream) SetDeadline(t time.Time) error {
+	return s.MockSetDeadline(t)
+}
+
 // UDPLikeConn is an UDP conn used by QUIC.
 type UDPLikeConn struct {
 	MockWriteTo          func(p []byte, addr net.Addr) (int, error)
@@ -441,3 +441,138 @@ func TestQUICUDPLikeConn(t *testing.T) {
 		}
 	})
 }
+
+func TestQUICStream(t *testing.T) {
+	t.Run("StreamID", func(t *testing.T) {
+		s := &QUICStream{
+			MockStreamID: func() quic.StreamID {
+				return 4
+			},
+		}
+		if s.StreamID() != 4 {
+			t.Fatal("unexpected stream ID")
+		}
+	})
+
+	t.Run("Read", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		s := &QUICStream{
+			MockRead: func(b []byte) (int, error) {
+				return 0, expected
+			},
+		}
+		count, err := s.Read(make([]byte, 128))
+		if !errors.Is(err, expected) {
+			t.Fatal("not the error we expected", err)
+		}
+		if count != 0 {
+			t.Fatal("invalid count")
+		}
+	})
+
+	t.Run("CancelRead", func(t *testing.T) {
+		var called bool
+		s := &QUICStream{
+			MockCancelRead: func(code quic.StreamErrorCode) {
+				called = true
+			},
+		}
+		s.CancelRead(0)
+		if !called {
+			t.Fatal("not called")
+		}
+	})
+
+	t.Run("SetReadDeadline", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		s := &QUICStream{
+			MockSetReadDeadline: func(t time.Time) error {
+				return expected
+			},
+		}
+		err := s.SetReadDeadline(time.Time{})
+		if !errors.Is(err, expected) {
+			t.Fatal("not the error we expected", err)
+		}
+	})
+
+	t.Run("Write", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		s := &QUICStream{
+			MockWrite: func(b []byte) (int, error) {
+				return 0, expected
+			},
+		}
+		count, err := s.Write(make([]byte, 128))
+		if !errors.Is(err, expected) {
+			t.Fatal("not the error we expected", err)
+		}
+		if count != 0 {
+			t.Fatal("invalid count")
+		}
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		s := &QUICStream{
+			MockClose: func() error {
+				return expected
+			},
+		}
+		err := s.Close()
+		if !errors.Is(err, expected) {
+			t.Fatal("not the error we expected", err)
+		}
+	})
+
+	t.Run("CancelWrite", func(t *testing.T) {
+		var called bool
+		s := &QUICStream{
+			MockCancelWrite: func(code quic.StreamErrorCode) {
+				called = true
+			},
+		}
+		s.CancelWrite(0)
+		if !called {
+			t.Fatal("not called")
+		}
+	})
+
+	t.Run("Context", func(t *testing.T) {
+		ctx := context.Background()
+		s := &QUICStream{
+			MockContext: func() context.Context {
+				return ctx
+			},
+		}
+		if s.Context() != ctx {
+			t.Fatal("not the context we expected")
+		}
+	})
+
+	t.Run("SetWriteDeadline", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		s := &QUICStream{
+			MockSetWriteDeadline: func(t time.Time) error {
+				return expected
+			},
+		}
+		err := s.SetWriteDeadline(time.Time{})
+		if !errors.Is(err, expected) {
+			t.Fatal("not the error we expected", err)
+		}
+	})
+
+	t.Run("SetDeadline", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		s := &QUICStream{
+			MockSetDeadline: func(t time.Time) error {
+				return expected
+			},
+		}
+		err := s.SetDeadline(time.Time{})
+		if !errors.Is(err, expected) {
+			t.Fatal("not the error we expected", err)
+		}
+	})
+}
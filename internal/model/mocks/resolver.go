@@ -2,6 +2,7 @@ package mocks
 
 import (
 	"context"
+	"net"
 
 	"github.com/ooni/probe-cli/v3/internal/model"
 )
@@ -13,6 +14,11 @@ type Resolver struct {
 	MockAddress              func() string
 	MockCloseIdleConnections func()
 	MockLookupHTTPS          func(ctx context.Context, domain string) (*model.HTTPSSvc, error)
+	MockLookupSVCB           func(ctx context.Context, domain string) (*model.HTTPSSvc, error)
+	MockLookupCNAME          func(ctx context.Context, domain string) ([]string, error)
+	MockLookupNS             func(ctx context.Context, domain string) ([]*net.NS, error)
+	MockLookupMX             func(ctx context.Context, domain string) ([]*net.MX, error)
+	MockLookupTXT            func(ctx context.Context, domain string) ([]string, error)
 }
 
 // LookupHost calls MockLookupHost.
@@ -39,3 +45,28 @@ func (r *Resolver) CloseIdleConnections() {
 func (r *Resolver) LookupHTTPS(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
 	return r.MockLookupHTTPS(ctx, domain)
 }
+
+// LookupSVCB calls MockLookupSVCB.
+func (r *Resolver) LookupSVCB(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+	return r.MockLookupSVCB(ctx, domain)
+}
+
+// LookupCNAME calls MockLookupCNAME.
+func (r *Resolver) LookupCNAME(ctx context.Context, domain string) ([]string, error) {
+	return r.MockLookupCNAME(ctx, domain)
+}
+
+// LookupNS calls MockLookupNS.
+func (r *Resolver) LookupNS(ctx context.Context, domain string) ([]*net.NS, error) {
+	return r.MockLookupNS(ctx, domain)
+}
+
+// LookupMX calls MockLookupMX.
+func (r *Resolver) LookupMX(ctx context.Context, domain string) ([]*net.MX, error) {
+	return r.MockLookupMX(ctx, domain)
+}
+
+// LookupTXT calls MockLookupTXT.
+func (r *Resolver) LookupTXT(ctx context.Context, domain string) ([]string, error) {
+	return r.MockLookupTXT(ctx, domain)
+}
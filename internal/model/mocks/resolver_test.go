@@ -3,6 +3,7 @@ package mocks
 import (
 	"context"
 	"errors"
+	"net"
 	"testing"
 
 	"github.com/ooni/probe-cli/v3/internal/model"
@@ -77,4 +78,89 @@ func TestResolver(t *testing.T) {
 			t.Fatal("expected nil addr")
 		}
 	})
+
+	t.Run("LookupSVCB", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		r := &Resolver{
+			MockLookupSVCB: func(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+				return nil, expected
+			},
+		}
+		ctx := context.Background()
+		out, err := r.LookupSVCB(ctx, "dns.google")
+		if !errors.Is(err, expected) {
+			t.Fatal("unexpected error", err)
+		}
+		if out != nil {
+			t.Fatal("expected nil out")
+		}
+	})
+
+	t.Run("LookupCNAME", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		r := &Resolver{
+			MockLookupCNAME: func(ctx context.Context, domain string) ([]string, error) {
+				return nil, expected
+			},
+		}
+		ctx := context.Background()
+		out, err := r.LookupCNAME(ctx, "dns.google")
+		if !errors.Is(err, expected) {
+			t.Fatal("unexpected error", err)
+		}
+		if out != nil {
+			t.Fatal("expected nil out")
+		}
+	})
+
+	t.Run("LookupNS", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		r := &Resolver{
+			MockLookupNS: func(ctx context.Context, domain string) ([]*net.NS, error) {
+				return nil, expected
+			},
+		}
+		ctx := context.Background()
+		out, err := r.LookupNS(ctx, "dns.google")
+		if !errors.Is(err, expected) {
+			t.Fatal("unexpected error", err)
+		}
+		if out != nil {
+			t.Fatal("expected nil out")
+		}
+	})
+
+	t.Run("LookupMX", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		r := &Resolver{
+			MockLookupMX: func(ctx context.Context, domain string) ([]*net.MX, error) {
+				return nil, expected
+			},
+		}
+		ctx := context.Background()
+		out, err := r.LookupMX(ctx, "dns.google")
+		if !errors.Is(err, expected) {
+			t.Fatal("unexpected error", err)
+		}
+		if out != nil {
+			t.Fatal("expected nil out")
+		}
+	})
+
+	t.Run("LookupTXT", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		r := &Resolver{
+			MockLookupTXT: func(ctx context.Context, domain string) ([]string, error) {
+				return nil, expected
+			},
+		}
+		ctx := context.Background()
+		out, err := r.LookupTXT(ctx, "dns.google")
+		if !errors.Is(err, expected) {
+			t.Fatal("unexpected error", err)
+		}
+		if out != nil {
+			t.Fatal("expected nil out")
+		}
+	})
 }
@@ -3,6 +3,7 @@ package model
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"net"
 	"net/http"
 	"syscall"
@@ -47,6 +48,71 @@ type DNSDecoder interface {
 	// contain at least a valid ALPN entry. It will not return
 	// an error, though, when there are no IPv4/IPv6 hints in the reply.
 	DecodeHTTPS(data []byte) (*HTTPSSvc, error)
+
+	// DecodeSVCB is like DecodeHTTPS but decodes an SVCB reply.
+	DecodeSVCB(data []byte) (*HTTPSSvc, error)
+
+	// DecodeCNAME decodes the CNAME records inside a reply.
+	//
+	// The argument is the reply as read by the DNSTransport.
+	//
+	// On success, this function returns the targets of the CNAME
+	// records in the order in which they appear inside the reply
+	// (i.e., the CNAME chain) and a nil error. On failure, the
+	// list is nil and the error is non-nil. This function returns
+	// an error when the reply does not contain any CNAME record.
+	DecodeCNAME(data []byte) ([]string, error)
+
+	// DecodeNS decodes an NS reply. This function returns an error
+	// when the reply does not contain any NS record.
+	DecodeNS(data []byte) ([]*net.NS, error)
+
+	// DecodeMX decodes an MX reply. This function returns an error
+	// when the reply does not contain any MX record.
+	DecodeMX(data []byte) ([]*net.MX, error)
+
+	// DecodeTXT decodes a TXT reply. This function returns an error
+	// when the reply does not contain any TXT record. When a TXT
+	// record contains several strings, we join them together.
+	DecodeTXT(data []byte) ([]string, error)
+
+	// DecodeReplyInfo extracts DNSSEC and EDNS0 information from a
+	// reply. Unlike the other methods, this method does not check the
+	// response code, because extended DNS errors are most useful when
+	// the server refuses to resolve a domain. It returns an error
+	// only if it cannot parse the reply.
+	DecodeReplyInfo(data []byte) (*DNSReplyInfo, error)
+
+	// DecodeTTL returns the TTL of a reply. For a positive reply, this
+	// is the minimum TTL of the records in the answer section. For a
+	// negative reply (e.g., NXDOMAIN), this is the RFC2308 negative
+	// caching TTL, i.e., the minimum between the TTL of the SOA record
+	// inside the authority section and its MINIMUM field. Like
+	// DecodeReplyInfo, this method does not check the response code. It
+	// returns an error if it cannot parse the reply or the reply does
+	// not contain any record from which we can obtain a TTL.
+	DecodeTTL(data []byte) (time.Duration, error)
+}
+
+// DNSReplyInfo contains DNSSEC and EDNS0 information about a reply.
+type DNSReplyInfo struct {
+	// AuthenticData is the AD bit of the reply.
+	AuthenticData bool
+
+	// HasRRSIG indicates whether the reply contains RRSIG records.
+	HasRRSIG bool
+
+	// ExtendedErrors contains the RFC8914 extended DNS errors.
+	ExtendedErrors []*DNSExtendedError
+}
+
+// DNSExtendedError is an RFC8914 extended DNS error.
+type DNSExtendedError struct {
+	// InfoCode is the INFO-CODE (e.g., 15 for "Blocked").
+	InfoCode uint16
+
+	// ExtraText is the optional EXTRA-TEXT.
+	ExtraText string
 }
 
 // The DNSEncoder encodes DNS queries to bytes
@@ -64,6 +130,31 @@ type DNSEncoder interface {
 	// On success, this function returns a valid byte array and
 	// a nil error. On failure, we have an error and the byte array is nil.
 	Encode(domain string, qtype uint16, padding bool) ([]byte, error)
+
+	// EncodeWithOptions is like Encode but uses the given options
+	// to decide which EDNS0 options to include into the query.
+	EncodeWithOptions(domain string, qtype uint16, options *DNSQueryOptions) ([]byte, error)
+}
+
+// DNSQueryOptions contains the EDNS0 options to use when encoding
+// a DNS query. The zero value does not add an OPT record.
+type DNSQueryOptions struct {
+	// DNSSECOK sets the DNSSEC OK (DO) bit.
+	DNSSECOK bool
+
+	// ClientSubnet is the optional EDNS Client Subnet (RFC7871) to
+	// send expressed in CIDR notation (e.g., "130.192.91.0/24").
+	ClientSubnet string
+
+	// UDPPayloadSize is the EDNS0 UDP payload size. When zero and
+	// we need to add an OPT record, we use a 4096 bytes size.
+	UDPPayloadSize uint16
+
+	// PaddingBlockSize controls RFC8467 padding. When it is positive,
+	// we pad queries to a multiple of this size. When it is zero, we
+	// pad to a multiple of 128 bytes only if the transport requires
+	// padding. When it is negative, we never pad queries.
+	PaddingBlockSize int
 }
 
 // DNSTransport represents an abstract DNS transport.
@@ -84,6 +175,28 @@ type DNSTransport interface {
 	CloseIdleConnections()
 }
 
+// DNSResponse is a raw DNS response along with the time when we received it.
+type DNSResponse struct {
+	// Reply contains the raw response bytes.
+	Reply []byte
+
+	// Received is when we received the response.
+	Received time.Time
+}
+
+// DNSTransportWithDuplicates is a DNSTransport that is able to
+// return all the responses received for a given query.
+type DNSTransportWithDuplicates interface {
+	// A DNSTransportWithDuplicates is also a DNSTransport.
+	DNSTransport
+
+	// RoundTripWithDuplicates sends a query and returns all the responses
+	// sorted by arrival time. On success, the returned list contains at
+	// least one response and the first one is the one that RoundTrip would
+	// have returned. On failure, the list is nil.
+	RoundTripWithDuplicates(ctx context.Context, query []byte) ([]*DNSResponse, error)
+}
+
 // SimpleDialer establishes network connections.
 type SimpleDialer interface {
 	// DialContext behaves like net.Dialer.DialContext.
@@ -118,7 +231,7 @@ type HTTPTransport interface {
 	CloseIdleConnections()
 }
 
-// HTTPSSvc is the reply to an HTTPS DNS query.
+// HTTPSSvc is the reply to an HTTPS or SVCB DNS query.
 type HTTPSSvc struct {
 	// ALPN contains the ALPNs inside the HTTPS reply.
 	ALPN []string
@@ -130,6 +243,21 @@ type HTTPSSvc struct {
 	IPv6 []string
 }
 
+// DNSRecord is a CNAME, NS, MX or TXT record returned
+// by one of the Resolver lookup methods. We use this type
+// to save these records into the measurement trace.
+type DNSRecord struct {
+	// Type is the record type (e.g., "CNAME").
+	Type string
+
+	// Value is the target hostname for CNAME, NS, and MX
+	// records and the record text for TXT records.
+	Value string
+
+	// Preference is the MX preference (zero for other types).
+	Preference uint16
+}
+
 // QUICListener listens for QUIC connections.
 type QUICListener interface {
 	// Listen creates a new listening UDPLikeConn.
@@ -175,6 +303,37 @@ type Resolver interface {
 	// LookupHTTPS issues an HTTPS query for a domain.
 	LookupHTTPS(
 		ctx context.Context, domain string) (*HTTPSSvc, error)
+
+	// LookupSVCB issues an SVCB query for a domain.
+	LookupSVCB(
+		ctx context.Context, domain string) (*HTTPSSvc, error)
+
+	// LookupCNAME returns the CNAME chain of a domain, i.e., the list
+	// of the targets of the CNAME records we need to follow, in order,
+	// to reach the canonical name, which is the last entry.
+	LookupCNAME(ctx context.Context, domain string) ([]string, error)
+
+	// LookupNS issues an NS query for a domain.
+	LookupNS(ctx context.Context, domain string) ([]*net.NS, error)
+
+	// LookupMX issues an MX query for a domain.
+	LookupMX(ctx context.Context, domain string) ([]*net.MX, error)
+
+	// LookupTXT issues a TXT query for a domain.
+	LookupTXT(ctx context.Context, domain string) ([]string, error)
+}
+
+// ResolverWithTTL is a Resolver that also knows the TTL of the
+// addresses returned by LookupHost. The netxlite.CachingResolver
+// uses this interface to decide for how long to cache a reply.
+type ResolverWithTTL interface {
+	Resolver
+
+	// LookupHostWithTTL is like LookupHost but also returns the TTL
+	// of the returned addresses. On failure, the TTL is the negative
+	// caching TTL, if known. A zero TTL means that we should not
+	// cache the result (e.g., because the TTL is unknown).
+	LookupHostWithTTL(ctx context.Context, hostname string) ([]string, time.Duration, error)
 }
 
 // TLSDialer is a Dialer dialing TLS connections.
@@ -250,4 +409,9 @@ type UnderlyingNetworkLibrary interface {
 
 	// NewSimpleDialer returns a new SimpleDialer.
 	NewSimpleDialer(timeout time.Duration) SimpleDialer
+
+	// DefaultCertPool returns the x509 certificate pool that TLS
+	// clients should use by default. Every invocation returns a
+	// distinct *x509.CertPool that the caller may modify.
+	DefaultCertPool() *x509.CertPool
 }
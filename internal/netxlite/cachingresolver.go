@@ -0,0 +1,272 @@
+package netxlite
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+// CachingResolver is a Resolver that caches the results of LookupHost
+// according to the TTL of the replies. When the underlying resolver
+// implements model.ResolverWithTTL, we use the TTL it returns, otherwise
+// we use DefaultTTL and NegativeTTL. We also cache NXDOMAIN and "no
+// answer" failures (i.e., negative caching as described by RFC2308). We
+// do not cache any other kind of failure. We do not cache the results
+// of lookups other than LookupHost, which we just forward.
+//
+// You should not use this resolver for measuring, because a measurement
+// should always observe what the network is currently doing. It is
+// instead useful to avoid resolving again and again the same names (e.g.,
+// probe services and test helpers) when the probe itself needs to
+// communicate with the OONI backend.
+//
+// You should probably use NewCachingResolver to create a new instance.
+type CachingResolver struct {
+	// DefaultTTL is the OPTIONAL TTL for successful lookups when the
+	// underlying resolver does not tell us the TTL. If zero, we use
+	// a one minute TTL.
+	DefaultTTL time.Duration
+
+	// MaxEntries is the OPTIONAL maximum number of cached entries. When
+	// the cache is full, we first remove the expired entries and then the
+	// entry expiring first. If zero, we use 1024 entries.
+	MaxEntries int
+
+	// MaxTTL is the OPTIONAL maximum TTL. We use this value when the
+	// TTL of a reply is larger. If zero, we use a one hour TTL.
+	MaxTTL time.Duration
+
+	// NegativeTTL is the OPTIONAL TTL for failed lookups when the
+	// underlying resolver does not tell us the TTL. If zero, we use
+	// a 30 seconds TTL.
+	NegativeTTL time.Duration
+
+	// Resolver is the MANDATORY underlying resolver.
+	Resolver model.Resolver
+
+	// entries contains the cached entries.
+	entries map[string]*cachingResolverEntry
+
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+
+	// timeNow is the OPTIONAL function returning the current time.
+	timeNow func() time.Time
+}
+
+// cachingResolverEntry is an entry inside the CachingResolver.
+type cachingResolverEntry struct {
+	// addrs contains the addresses of a successful lookup.
+	addrs []string
+
+	// err is the error of a failed lookup.
+	err error
+
+	// expire is the moment in which this entry expires.
+	expire time.Time
+}
+
+// NewCachingResolver creates a new CachingResolver instance
+// wrapping the given resolver and using default settings.
+func NewCachingResolver(reso model.Resolver) *CachingResolver {
+	return &CachingResolver{Resolver: reso}
+}
+
+// LookupHost implements model.Resolver.LookupHost.
+func (r *CachingResolver) LookupHost(ctx context.Context, hostname string) ([]string, error) {
+	if entry := r.get(hostname); entry != nil {
+		if entry.err != nil {
+			return nil, entry.err
+		}
+		// copy so the caller cannot modify the cached entry
+		return append([]string{}, entry.addrs...), nil
+	}
+	addrs, ttl, err := r.lookupHostWithTTL(ctx, hostname)
+	if err != nil && !r.isNegativeReply(err) {
+		return nil, err
+	}
+	r.set(hostname, &cachingResolverEntry{addrs: addrs, err: err}, ttl)
+	return addrs, err
+}
+
+// lookupHostWithTTL performs a lookup and returns the TTL to use.
+func (r *CachingResolver) lookupHostWithTTL(
+	ctx context.Context, hostname string) ([]string, time.Duration, error) {
+	if reso, ok := r.Resolver.(model.ResolverWithTTL); ok {
+		return reso.LookupHostWithTTL(ctx, hostname)
+	}
+	addrs, err := r.Resolver.LookupHost(ctx, hostname)
+	if err != nil {
+		return nil, r.negativeTTL(), err
+	}
+	return addrs, r.defaultTTL(), nil
+}
+
+// isNegativeReply returns whether err is a failure we can cache.
+func (r *CachingResolver) isNegativeReply(err error) bool {
+	switch classifyResolverError(err) {
+	case FailureDNSNXDOMAINError, FailureDNSNoAnswer:
+		return true
+	default:
+		return false
+	}
+}
+
+// get returns the entry for hostname or nil if there is no
+// such entry or the entry is expired.
+func (r *CachingResolver) get(hostname string) *cachingResolverEntry {
+	defer r.mu.Unlock()
+	r.mu.Lock()
+	entry, found := r.entries[hostname]
+	if !found {
+		return nil
+	}
+	if !r.now().Before(entry.expire) {
+		delete(r.entries, hostname)
+		return nil
+	}
+	return entry
+}
+
+// set adds the entry for hostname unless the TTL is zero.
+func (r *CachingResolver) set(hostname string, entry *cachingResolverEntry, ttl time.Duration) {
+	if ttl <= 0 {
+		return // the reply MUST NOT be cached
+	}
+	if ttl > r.maxTTL() {
+		ttl = r.maxTTL()
+	}
+	defer r.mu.Unlock()
+	r.mu.Lock()
+	now := r.now()
+	entry.expire = now.Add(ttl)
+	if r.entries == nil {
+		r.entries = make(map[string]*cachingResolverEntry)
+	}
+	if _, found := r.entries[hostname]; !found && len(r.entries) >= r.maxEntries() {
+		r.evict(now)
+	}
+	r.entries[hostname] = entry
+}
+
+// evict removes the expired entries and, if this is not enough to make
+// room for a new entry, the entry expiring first. This function MUST
+// be called while holding the mutex.
+func (r *CachingResolver) evict(now time.Time) {
+	var (
+		first    string
+		firstExp time.Time
+	)
+	for hostname, entry := range r.entries {
+		if !now.Before(entry.expire) {
+			delete(r.entries, hostname)
+			continue
+		}
+		if first == "" || entry.expire.Before(firstExp) {
+			first, firstExp = hostname, entry.expire
+		}
+	}
+	if len(r.entries) >= r.maxEntries() {
+		delete(r.entries, first)
+	}
+}
+
+// Flush removes all the entries from the cache.
+func (r *CachingResolver) Flush() {
+	r.mu.Lock()
+	r.entries = nil
+	r.mu.Unlock()
+}
+
+// Len returns the number of entries inside the cache, including
+// the expired entries that we have not removed yet.
+func (r *CachingResolver) Len() int {
+	defer r.mu.Unlock()
+	r.mu.Lock()
+	return len(r.entries)
+}
+
+func (r *CachingResolver) defaultTTL() time.Duration {
+	if r.DefaultTTL > 0 {
+		return r.DefaultTTL
+	}
+	return time.Minute
+}
+
+func (r *CachingResolver) maxEntries() int {
+	if r.MaxEntries > 0 {
+		return r.MaxEntries
+	}
+	return 1024
+}
+
+func (r *CachingResolver) maxTTL() time.Duration {
+	if r.MaxTTL > 0 {
+		return r.MaxTTL
+	}
+	return time.Hour
+}
+
+func (r *CachingResolver) negativeTTL() time.Duration {
+	if r.NegativeTTL > 0 {
+		return r.NegativeTTL
+	}
+	return 30 * time.Second
+}
+
+func (r *CachingResolver) now() time.Time {
+	if r.timeNow != nil {
+		return r.timeNow()
+	}
+	return time.Now()
+}
+
+// Network implements model.Resolver.Network.
+func (r *CachingResolver) Network() string {
+	return r.Resolver.Network()
+}
+
+// Address implements model.Resolver.Address.
+func (r *CachingResolver) Address() string {
+	return r.Resolver.Address()
+}
+
+// CloseIdleConnections implements model.Resolver.CloseIdleConnections.
+func (r *CachingResolver) CloseIdleConnections() {
+	r.Resolver.CloseIdleConnections()
+}
+
+// LookupHTTPS implements model.Resolver.LookupHTTPS.
+func (r *CachingResolver) LookupHTTPS(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+	return r.Resolver.LookupHTTPS(ctx, domain)
+}
+
+// LookupSVCB implements model.Resolver.LookupSVCB.
+func (r *CachingResolver) LookupSVCB(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+	return r.Resolver.LookupSVCB(ctx, domain)
+}
+
+// LookupCNAME implements model.Resolver.LookupCNAME.
+func (r *CachingResolver) LookupCNAME(ctx context.Context, domain string) ([]string, error) {
+	return r.Resolver.LookupCNAME(ctx, domain)
+}
+
+// LookupNS implements model.Resolver.LookupNS.
+func (r *CachingResolver) LookupNS(ctx context.Context, domain string) ([]*net.NS, error) {
+	return r.Resolver.LookupNS(ctx, domain)
+}
+
+// LookupMX implements model.Resolver.LookupMX.
+func (r *CachingResolver) LookupMX(ctx context.Context, domain string) ([]*net.MX, error) {
+	return r.Resolver.LookupMX(ctx, domain)
+}
+
+// LookupTXT implements model.Resolver.LookupTXT.
+func (r *CachingResolver) LookupTXT(ctx context.Context, domain string) ([]string, error) {
+	return r.Resolver.LookupTXT(ctx, domain)
+}
+
+var _ model.Resolver = &CachingResolver{}
@@ -0,0 +1,320 @@
+package netxlite
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/model/mocks"
+)
+
+// cachingResolverTTLMock is a mocks.Resolver that also
+// implements model.ResolverWithTTL.
+type cachingResolverTTLMock struct {
+	mocks.Resolver
+	MockLookupHostWithTTL func(ctx context.Context, domain string) ([]string, time.Duration, error)
+}
+
+func (r *cachingResolverTTLMock) LookupHostWithTTL(
+	ctx context.Context, domain string) ([]string, time.Duration, error) {
+	return r.MockLookupHostWithTTL(ctx, domain)
+}
+
+// cachingResolverClock is a fake clock for the CachingResolver.
+type cachingResolverClock struct {
+	now time.Time
+}
+
+func (c *cachingResolverClock) Now() time.Time {
+	return c.now
+}
+
+func TestCachingResolver(t *testing.T) {
+	// newResolverWithTTL returns a CachingResolver using a fake clock and
+	// wrapping a resolver that always returns addrs, ttl, err. The returned
+	// counter tracks the number of calls to the underlying resolver.
+	newResolverWithTTL := func(addrs []string, ttl time.Duration,
+		err error) (*CachingResolver, *cachingResolverClock, *int) {
+		var count int
+		clock := &cachingResolverClock{now: time.Now()}
+		reso := &CachingResolver{
+			Resolver: &cachingResolverTTLMock{
+				MockLookupHostWithTTL: func(ctx context.Context, domain string) ([]string, time.Duration, error) {
+					count++
+					return addrs, ttl, err
+				},
+			},
+			timeNow: clock.Now,
+		}
+		return reso, clock, &count
+	}
+
+	t.Run("NewCachingResolver", func(t *testing.T) {
+		child := &mocks.Resolver{}
+		reso := NewCachingResolver(child)
+		if reso.Resolver != child {
+			t.Fatal("invalid resolver")
+		}
+		if reso.Len() != 0 {
+			t.Fatal("expected empty cache")
+		}
+	})
+
+	t.Run("LookupHost", func(t *testing.T) {
+		t.Run("caches according to the TTL", func(t *testing.T) {
+			expected := []string{"8.8.8.8", "8.8.4.4"}
+			reso, clock, count := newResolverWithTTL(expected, 10*time.Second, nil)
+			for i := 0; i < 2; i++ {
+				addrs, err := reso.LookupHost(context.Background(), "dns.google")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(expected, addrs); diff != "" {
+					t.Fatal(diff)
+				}
+			}
+			if *count != 1 {
+				t.Fatal("unexpected number of lookups", *count)
+			}
+			clock.now = clock.now.Add(10 * time.Second)
+			if _, err := reso.LookupHost(context.Background(), "dns.google"); err != nil {
+				t.Fatal(err)
+			}
+			if *count != 2 {
+				t.Fatal("unexpected number of lookups", *count)
+			}
+		})
+
+		t.Run("the caller cannot modify cached entries", func(t *testing.T) {
+			reso, _, _ := newResolverWithTTL([]string{"8.8.8.8"}, 10*time.Second, nil)
+			reso.LookupHost(context.Background(), "dns.google")
+			addrs, _ := reso.LookupHost(context.Background(), "dns.google")
+			addrs[0] = "10.0.0.1"
+			addrs, _ = reso.LookupHost(context.Background(), "dns.google")
+			if diff := cmp.Diff([]string{"8.8.8.8"}, addrs); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+
+		t.Run("does not cache when the TTL is zero", func(t *testing.T) {
+			reso, _, count := newResolverWithTTL([]string{"8.8.8.8"}, 0, nil)
+			reso.LookupHost(context.Background(), "dns.google")
+			reso.LookupHost(context.Background(), "dns.google")
+			if *count != 2 {
+				t.Fatal("unexpected number of lookups", *count)
+			}
+			if reso.Len() != 0 {
+				t.Fatal("expected empty cache")
+			}
+		})
+
+		t.Run("caches NXDOMAIN", func(t *testing.T) {
+			reso, _, count := newResolverWithTTL(nil, 10*time.Second, ErrOODNSNoSuchHost)
+			for i := 0; i < 2; i++ {
+				addrs, err := reso.LookupHost(context.Background(), "dns.google")
+				if !errors.Is(err, ErrOODNSNoSuchHost) {
+					t.Fatal("not the error we expected", err)
+				}
+				if addrs != nil {
+					t.Fatal("expected nil addrs")
+				}
+			}
+			if *count != 1 {
+				t.Fatal("unexpected number of lookups", *count)
+			}
+		})
+
+		t.Run("does not cache other errors", func(t *testing.T) {
+			expected := errors.New("mocked error")
+			reso, _, count := newResolverWithTTL(nil, 10*time.Second, expected)
+			for i := 0; i < 2; i++ {
+				addrs, err := reso.LookupHost(context.Background(), "dns.google")
+				if !errors.Is(err, expected) {
+					t.Fatal("not the error we expected", err)
+				}
+				if addrs != nil {
+					t.Fatal("expected nil addrs")
+				}
+			}
+			if *count != 2 {
+				t.Fatal("unexpected number of lookups", *count)
+			}
+		})
+
+		t.Run("enforces MaxTTL", func(t *testing.T) {
+			reso, clock, count := newResolverWithTTL([]string{"8.8.8.8"}, 24*time.Hour, nil)
+			reso.MaxTTL = time.Minute
+			reso.LookupHost(context.Background(), "dns.google")
+			clock.now = clock.now.Add(time.Minute)
+			reso.LookupHost(context.Background(), "dns.google")
+			if *count != 2 {
+				t.Fatal("unexpected number of lookups", *count)
+			}
+		})
+
+		t.Run("enforces MaxEntries", func(t *testing.T) {
+			reso, clock, _ := newResolverWithTTL([]string{"8.8.8.8"}, 10*time.Second, nil)
+			reso.MaxEntries = 2
+			reso.LookupHost(context.Background(), "a.example.com")
+			clock.now = clock.now.Add(time.Second)
+			reso.LookupHost(context.Background(), "b.example.com")
+			clock.now = clock.now.Add(time.Second)
+			reso.LookupHost(context.Background(), "c.example.com")
+			if reso.Len() != 2 {
+				t.Fatal("unexpected number of entries", reso.Len())
+			}
+			if reso.get("a.example.com") != nil {
+				t.Fatal("expected the entry expiring first to be evicted")
+			}
+			if reso.get("b.example.com") == nil || reso.get("c.example.com") == nil {
+				t.Fatal("expected to find the most recent entries")
+			}
+		})
+
+		t.Run("evicts expired entries first", func(t *testing.T) {
+			reso, clock, _ := newResolverWithTTL([]string{"8.8.8.8"}, 10*time.Second, nil)
+			reso.MaxEntries = 2
+			reso.LookupHost(context.Background(), "a.example.com")
+			reso.LookupHost(context.Background(), "b.example.com")
+			clock.now = clock.now.Add(time.Minute)
+			reso.LookupHost(context.Background(), "c.example.com")
+			if reso.Len() != 1 {
+				t.Fatal("unexpected number of entries", reso.Len())
+			}
+		})
+
+		t.Run("with a resolver without TTL", func(t *testing.T) {
+			t.Run("on success", func(t *testing.T) {
+				var count int
+				clock := &cachingResolverClock{now: time.Now()}
+				reso := &CachingResolver{
+					DefaultTTL: 10 * time.Second,
+					Resolver: &mocks.Resolver{
+						MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+							count++
+							return []string{"8.8.8.8"}, nil
+						},
+					},
+					timeNow: clock.Now,
+				}
+				reso.LookupHost(context.Background(), "dns.google")
+				clock.now = clock.now.Add(9 * time.Second)
+				reso.LookupHost(context.Background(), "dns.google")
+				if count != 1 {
+					t.Fatal("unexpected number of lookups", count)
+				}
+				clock.now = clock.now.Add(time.Second)
+				reso.LookupHost(context.Background(), "dns.google")
+				if count != 2 {
+					t.Fatal("unexpected number of lookups", count)
+				}
+			})
+
+			t.Run("on failure", func(t *testing.T) {
+				var count int
+				clock := &cachingResolverClock{now: time.Now()}
+				reso := &CachingResolver{
+					NegativeTTL: 5 * time.Second,
+					Resolver: &mocks.Resolver{
+						MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+							count++
+							return nil, &net.DNSError{Err: DNSNoSuchHostSuffix}
+						},
+					},
+					timeNow: clock.Now,
+				}
+				reso.LookupHost(context.Background(), "dns.google")
+				clock.now = clock.now.Add(4 * time.Second)
+				reso.LookupHost(context.Background(), "dns.google")
+				if count != 1 {
+					t.Fatal("unexpected number of lookups", count)
+				}
+				clock.now = clock.now.Add(time.Second)
+				reso.LookupHost(context.Background(), "dns.google")
+				if count != 2 {
+					t.Fatal("unexpected number of lookups", count)
+				}
+			})
+		})
+	})
+
+	t.Run("Flush", func(t *testing.T) {
+		reso, _, count := newResolverWithTTL([]string{"8.8.8.8"}, 10*time.Second, nil)
+		reso.LookupHost(context.Background(), "dns.google")
+		reso.Flush()
+		if reso.Len() != 0 {
+			t.Fatal("expected empty cache")
+		}
+		reso.LookupHost(context.Background(), "dns.google")
+		if *count != 2 {
+			t.Fatal("unexpected number of lookups", *count)
+		}
+	})
+
+	t.Run("forwards other calls to the underlying resolver", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		var closed bool
+		reso := NewCachingResolver(&mocks.Resolver{
+			MockNetwork: func() string {
+				return "doh"
+			},
+			MockAddress: func() string {
+				return "https://dns.google/dns-query"
+			},
+			MockCloseIdleConnections: func() {
+				closed = true
+			},
+			MockLookupHTTPS: func(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+				return nil, expected
+			},
+			MockLookupSVCB: func(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+				return nil, expected
+			},
+			MockLookupCNAME: func(ctx context.Context, domain string) ([]string, error) {
+				return nil, expected
+			},
+			MockLookupNS: func(ctx context.Context, domain string) ([]*net.NS, error) {
+				return nil, expected
+			},
+			MockLookupMX: func(ctx context.Context, domain string) ([]*net.MX, error) {
+				return nil, expected
+			},
+			MockLookupTXT: func(ctx context.Context, domain string) ([]string, error) {
+				return nil, expected
+			},
+		})
+		if reso.Network() != "doh" {
+			t.Fatal("invalid network")
+		}
+		if reso.Address() != "https://dns.google/dns-query" {
+			t.Fatal("invalid address")
+		}
+		reso.CloseIdleConnections()
+		if !closed {
+			t.Fatal("not closed")
+		}
+		ctx := context.Background()
+		if _, err := reso.LookupHTTPS(ctx, "dns.google"); !errors.Is(err, expected) {
+			t.Fatal("unexpected err", err)
+		}
+		if _, err := reso.LookupSVCB(ctx, "dns.google"); !errors.Is(err, expected) {
+			t.Fatal("unexpected err", err)
+		}
+		if _, err := reso.LookupCNAME(ctx, "dns.google"); !errors.Is(err, expected) {
+			t.Fatal("unexpected err", err)
+		}
+		if _, err := reso.LookupNS(ctx, "dns.google"); !errors.Is(err, expected) {
+			t.Fatal("unexpected err", err)
+		}
+		if _, err := reso.LookupMX(ctx, "dns.google"); !errors.Is(err, expected) {
+			t.Fatal("unexpected err", err)
+		}
+		if _, err := reso.LookupTXT(ctx, "dns.google"); !errors.Is(err, expected) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+}
@@ -42,6 +42,8 @@ func NewDialerWithResolver(logger model.DebugLogger, resolver model.Resolver) mo
 // the CloseIdleConnection call to its resolver (which is
 // instrumental to manage a DoH resolver connections properly).
 //
+// See WrapDialerHappyEyeballs for a dialer racing the endpoints.
+//
 // In general, do not use WrapDialer directly but try to use
 // more high-level factories, e.g., NewDialerWithResolver.
 func WrapDialer(logger model.DebugLogger, resolver model.Resolver, dialer model.Dialer) model.Dialer {
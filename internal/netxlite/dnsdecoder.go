@@ -1,6 +1,10 @@
 package netxlite
 
 import (
+	"net"
+	"strings"
+	"time"
+
 	"github.com/miekg/dns"
 	"github.com/ooni/probe-cli/v3/internal/model"
 )
@@ -28,26 +32,43 @@ func (d *DNSDecoderMiekg) parseReply(data []byte) (*dns.Msg, error) {
 }
 
 func (d *DNSDecoderMiekg) DecodeHTTPS(data []byte) (*model.HTTPSSvc, error) {
+	return d.decodeSVCB(data, dns.TypeHTTPS)
+}
+
+func (d *DNSDecoderMiekg) DecodeSVCB(data []byte) (*model.HTTPSSvc, error) {
+	return d.decodeSVCB(data, dns.TypeSVCB)
+}
+
+// decodeSVCB decodes HTTPS and SVCB replies, which share the same format.
+func (d *DNSDecoderMiekg) decodeSVCB(data []byte, qtype uint16) (*model.HTTPSSvc, error) {
 	reply, err := d.parseReply(data)
 	if err != nil {
 		return nil, err
 	}
 	out := &model.HTTPSSvc{}
 	for _, answer := range reply.Answer {
+		var values []dns.SVCBKeyValue
 		switch avalue := answer.(type) {
 		case *dns.HTTPS:
-			for _, v := range avalue.Value {
-				switch extv := v.(type) {
-				case *dns.SVCBAlpn:
-					out.ALPN = extv.Alpn
-				case *dns.SVCBIPv4Hint:
-					for _, ip := range extv.Hint {
-						out.IPv4 = append(out.IPv4, ip.String())
-					}
-				case *dns.SVCBIPv6Hint:
-					for _, ip := range extv.Hint {
-						out.IPv6 = append(out.IPv6, ip.String())
-					}
+			if qtype == dns.TypeHTTPS {
+				values = avalue.Value
+			}
+		case *dns.SVCB:
+			if qtype == dns.TypeSVCB {
+				values = avalue.Value
+			}
+		}
+		for _, v := range values {
+			switch extv := v.(type) {
+			case *dns.SVCBAlpn:
+				out.ALPN = extv.Alpn
+			case *dns.SVCBIPv4Hint:
+				for _, ip := range extv.Hint {
+					out.IPv4 = append(out.IPv4, ip.String())
+				}
+			case *dns.SVCBIPv6Hint:
+				for _, ip := range extv.Hint {
+					out.IPv6 = append(out.IPv6, ip.String())
 				}
 			}
 		}
@@ -58,6 +79,74 @@ func (d *DNSDecoderMiekg) DecodeHTTPS(data []byte) (*model.HTTPSSvc, error) {
 	return out, nil
 }
 
+func (d *DNSDecoderMiekg) DecodeCNAME(data []byte) ([]string, error) {
+	reply, err := d.parseReply(data)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, answer := range reply.Answer {
+		if rr, ok := answer.(*dns.CNAME); ok {
+			out = append(out, rr.Target)
+		}
+	}
+	if len(out) <= 0 {
+		return nil, ErrOODNSNoAnswer
+	}
+	return out, nil
+}
+
+func (d *DNSDecoderMiekg) DecodeNS(data []byte) ([]*net.NS, error) {
+	reply, err := d.parseReply(data)
+	if err != nil {
+		return nil, err
+	}
+	var out []*net.NS
+	for _, answer := range reply.Answer {
+		if rr, ok := answer.(*dns.NS); ok {
+			out = append(out, &net.NS{Host: rr.Ns})
+		}
+	}
+	if len(out) <= 0 {
+		return nil, ErrOODNSNoAnswer
+	}
+	return out, nil
+}
+
+func (d *DNSDecoderMiekg) DecodeMX(data []byte) ([]*net.MX, error) {
+	reply, err := d.parseReply(data)
+	if err != nil {
+		return nil, err
+	}
+	var out []*net.MX
+	for _, answer := range reply.Answer {
+		if rr, ok := answer.(*dns.MX); ok {
+			out = append(out, &net.MX{Host: rr.Mx, Pref: rr.Preference})
+		}
+	}
+	if len(out) <= 0 {
+		return nil, ErrOODNSNoAnswer
+	}
+	return out, nil
+}
+
+func (d *DNSDecoderMiekg) DecodeTXT(data []byte) ([]string, error) {
+	reply, err := d.parseReply(data)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, answer := range reply.Answer {
+		if rr, ok := answer.(*dns.TXT); ok {
+			out = append(out, strings.Join(rr.Txt, ""))
+		}
+	}
+	if len(out) <= 0 {
+		return nil, ErrOODNSNoAnswer
+	}
+	return out, nil
+}
+
 func (d *DNSDecoderMiekg) DecodeLookupHost(qtype uint16, data []byte) ([]string, error) {
 	reply, err := d.parseReply(data)
 	if err != nil {
@@ -84,4 +173,69 @@ func (d *DNSDecoderMiekg) DecodeLookupHost(qtype uint16, data []byte) ([]string,
 	return addrs, nil
 }
 
+func (d *DNSDecoderMiekg) DecodeReplyInfo(data []byte) (*model.DNSReplyInfo, error) {
+	reply := new(dns.Msg)
+	if err := reply.Unpack(data); err != nil {
+		return nil, err
+	}
+	out := &model.DNSReplyInfo{AuthenticData: reply.AuthenticatedData}
+	for _, section := range [][]dns.RR{reply.Answer, reply.Ns} {
+		for _, rr := range section {
+			if _, ok := rr.(*dns.RRSIG); ok {
+				out.HasRRSIG = true
+			}
+		}
+	}
+	if opt := reply.IsEdns0(); opt != nil {
+		for _, option := range opt.Option {
+			if ede, ok := option.(*dns.EDNS0_EDE); ok {
+				out.ExtendedErrors = append(out.ExtendedErrors, &model.DNSExtendedError{
+					InfoCode:  ede.InfoCode,
+					ExtraText: ede.ExtraText,
+				})
+			}
+		}
+	}
+	return out, nil
+}
+
+func (d *DNSDecoderMiekg) DecodeTTL(data []byte) (time.Duration, error) {
+	reply := new(dns.Msg)
+	if err := reply.Unpack(data); err != nil {
+		return 0, err
+	}
+	var (
+		found bool
+		ttl   uint32
+	)
+	update := func(value uint32) {
+		if !found || value < ttl {
+			ttl = value
+		}
+		found = true
+	}
+	for _, answer := range reply.Answer {
+		update(answer.Header().Ttl)
+	}
+	if !found {
+		for _, authority := range reply.Ns {
+			if soa, ok := authority.(*dns.SOA); ok {
+				update(soa.Hdr.Ttl)
+				update(soa.Minttl)
+			}
+		}
+	}
+	if !found {
+		return 0, ErrOODNSNoAnswer
+	}
+	return time.Duration(ttl) * time.Second, nil
+}
+
+// DNSExtendedErrorName returns the RFC8914 name of the given
+// extended DNS error INFO-CODE (e.g., "Blocked" for 15). If the
+// code is unknown, this function returns an empty string.
+func DNSExtendedErrorName(code uint16) string {
+	return dns.ExtendedErrorCodeToString[code]
+}
+
 var _ model.DNSDecoder = &DNSDecoderMiekg{}
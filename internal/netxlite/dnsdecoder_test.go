@@ -5,9 +5,11 @@ import (
 	"net"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/miekg/dns"
+	"github.com/ooni/probe-cli/v3/internal/model"
 )
 
 func TestDNSDecoder(t *testing.T) {
@@ -181,6 +183,372 @@ func TestDNSDecoder(t *testing.T) {
 			}
 		})
 	})
+
+	t.Run("DecodeSVCB", func(t *testing.T) {
+		t.Run("with HTTPS answer", func(t *testing.T) {
+			data := dnsGenHTTPSReplySuccess(t, []string{"h3"}, nil, nil)
+			d := &DNSDecoderMiekg{}
+			reply, err := d.DecodeSVCB(data)
+			if !errors.Is(err, ErrOODNSNoAnswer) {
+				t.Fatal("unexpected err", err)
+			}
+			if reply != nil {
+				t.Fatal("expected nil reply")
+			}
+		})
+
+		t.Run("with full answer", func(t *testing.T) {
+			data := dnsGenReplyWithAnswers(t, dns.TypeSVCB, &dns.SVCB{
+				Hdr:    dnsGenRRHeader(dns.TypeSVCB),
+				Target: dns.Fqdn("dns.x.org"),
+				Value: []dns.SVCBKeyValue{
+					&dns.SVCBAlpn{Alpn: []string{"dot"}},
+					&dns.SVCBIPv4Hint{Hint: []net.IP{net.ParseIP("1.1.1.1")}},
+				},
+			})
+			d := &DNSDecoderMiekg{}
+			reply, err := d.DecodeSVCB(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff([]string{"dot"}, reply.ALPN); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff([]string{"1.1.1.1"}, reply.IPv4); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	})
+
+	t.Run("DecodeCNAME", func(t *testing.T) {
+		t.Run("with nil data", func(t *testing.T) {
+			d := &DNSDecoderMiekg{}
+			cnames, err := d.DecodeCNAME(nil)
+			if err == nil || err.Error() != "dns: overflow unpacking uint16" {
+				t.Fatal("not the error we expected", err)
+			}
+			if cnames != nil {
+				t.Fatal("expected nil reply")
+			}
+		})
+
+		t.Run("without CNAME records", func(t *testing.T) {
+			data := dnsGenLookupHostReplySuccess(t, dns.TypeA, "1.1.1.1")
+			d := &DNSDecoderMiekg{}
+			cnames, err := d.DecodeCNAME(data)
+			if !errors.Is(err, ErrOODNSNoAnswer) {
+				t.Fatal("unexpected err", err)
+			}
+			if cnames != nil {
+				t.Fatal("expected nil reply")
+			}
+		})
+
+		t.Run("with CNAME chain", func(t *testing.T) {
+			data := dnsGenReplyWithAnswers(t, dns.TypeA, &dns.CNAME{
+				Hdr:    dnsGenRRHeader(dns.TypeCNAME),
+				Target: "www.x.org.",
+			}, &dns.CNAME{
+				Hdr:    dns.RR_Header{Name: "www.x.org.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET},
+				Target: "cdn.x.org.",
+			}, &dns.A{
+				Hdr: dns.RR_Header{Name: "cdn.x.org.", Rrtype: dns.TypeA, Class: dns.ClassINET},
+				A:   net.ParseIP("1.1.1.1"),
+			})
+			d := &DNSDecoderMiekg{}
+			cnames, err := d.DecodeCNAME(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff([]string{"www.x.org.", "cdn.x.org."}, cnames); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	})
+
+	t.Run("DecodeNS", func(t *testing.T) {
+		t.Run("with NXDOMAIN", func(t *testing.T) {
+			data := dnsGenReplyWithError(t, dns.TypeNS, dns.RcodeNameError)
+			d := &DNSDecoderMiekg{}
+			nss, err := d.DecodeNS(data)
+			if err == nil || !strings.HasSuffix(err.Error(), "no such host") {
+				t.Fatal("not the error we expected", err)
+			}
+			if nss != nil {
+				t.Fatal("expected nil reply")
+			}
+		})
+
+		t.Run("with empty answer", func(t *testing.T) {
+			data := dnsGenReplyWithAnswers(t, dns.TypeNS)
+			d := &DNSDecoderMiekg{}
+			nss, err := d.DecodeNS(data)
+			if !errors.Is(err, ErrOODNSNoAnswer) {
+				t.Fatal("unexpected err", err)
+			}
+			if nss != nil {
+				t.Fatal("expected nil reply")
+			}
+		})
+
+		t.Run("with full answer", func(t *testing.T) {
+			data := dnsGenReplyWithAnswers(t, dns.TypeNS, &dns.NS{
+				Hdr: dnsGenRRHeader(dns.TypeNS),
+				Ns:  "ns1.x.org.",
+			})
+			d := &DNSDecoderMiekg{}
+			nss, err := d.DecodeNS(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff([]*net.NS{{Host: "ns1.x.org."}}, nss); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	})
+
+	t.Run("DecodeMX", func(t *testing.T) {
+		t.Run("with empty answer", func(t *testing.T) {
+			data := dnsGenReplyWithAnswers(t, dns.TypeMX)
+			d := &DNSDecoderMiekg{}
+			mxs, err := d.DecodeMX(data)
+			if !errors.Is(err, ErrOODNSNoAnswer) {
+				t.Fatal("unexpected err", err)
+			}
+			if mxs != nil {
+				t.Fatal("expected nil reply")
+			}
+		})
+
+		t.Run("with full answer", func(t *testing.T) {
+			data := dnsGenReplyWithAnswers(t, dns.TypeMX, &dns.MX{
+				Hdr:        dnsGenRRHeader(dns.TypeMX),
+				Preference: 10,
+				Mx:         "mx.x.org.",
+			})
+			d := &DNSDecoderMiekg{}
+			mxs, err := d.DecodeMX(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff([]*net.MX{{Host: "mx.x.org.", Pref: 10}}, mxs); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	})
+
+	t.Run("DecodeTXT", func(t *testing.T) {
+		t.Run("with empty answer", func(t *testing.T) {
+			data := dnsGenReplyWithAnswers(t, dns.TypeTXT)
+			d := &DNSDecoderMiekg{}
+			txts, err := d.DecodeTXT(data)
+			if !errors.Is(err, ErrOODNSNoAnswer) {
+				t.Fatal("unexpected err", err)
+			}
+			if txts != nil {
+				t.Fatal("expected nil reply")
+			}
+		})
+
+		t.Run("with full answer", func(t *testing.T) {
+			data := dnsGenReplyWithAnswers(t, dns.TypeTXT, &dns.TXT{
+				Hdr: dnsGenRRHeader(dns.TypeTXT),
+				Txt: []string{"v=spf1 ", "-all"},
+			}, &dns.TXT{
+				Hdr: dnsGenRRHeader(dns.TypeTXT),
+				Txt: []string{"hello"},
+			})
+			d := &DNSDecoderMiekg{}
+			txts, err := d.DecodeTXT(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff([]string{"v=spf1 -all", "hello"}, txts); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	})
+
+	t.Run("DecodeReplyInfo", func(t *testing.T) {
+		t.Run("with nil data", func(t *testing.T) {
+			d := &DNSDecoderMiekg{}
+			info, err := d.DecodeReplyInfo(nil)
+			if err == nil || err.Error() != "dns: overflow unpacking uint16" {
+				t.Fatal("not the error we expected", err)
+			}
+			if info != nil {
+				t.Fatal("expected nil info")
+			}
+		})
+
+		t.Run("with plain reply", func(t *testing.T) {
+			data := dnsGenLookupHostReplySuccess(t, dns.TypeA, "1.1.1.1")
+			d := &DNSDecoderMiekg{}
+			info, err := d.DecodeReplyInfo(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(&model.DNSReplyInfo{}, info); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+
+		t.Run("with AD bit and RRSIG", func(t *testing.T) {
+			query := new(dns.Msg)
+			query.SetQuestion("x.org.", dns.TypeA)
+			reply := new(dns.Msg)
+			reply.SetReply(query)
+			reply.AuthenticatedData = true
+			reply.Answer = append(reply.Answer, &dns.A{
+				Hdr: dnsGenRRHeader(dns.TypeA),
+				A:   net.IPv4(1, 1, 1, 1),
+			}, &dns.RRSIG{
+				Hdr:         dnsGenRRHeader(dns.TypeRRSIG),
+				TypeCovered: dns.TypeA,
+				SignerName:  "x.org.",
+				Signature:   "AAAA",
+			})
+			data, err := reply.Pack()
+			if err != nil {
+				t.Fatal(err)
+			}
+			d := &DNSDecoderMiekg{}
+			info, err := d.DecodeReplyInfo(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := &model.DNSReplyInfo{AuthenticData: true, HasRRSIG: true}
+			if diff := cmp.Diff(expected, info); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+
+		t.Run("with extended DNS errors and a failure rcode", func(t *testing.T) {
+			query := new(dns.Msg)
+			query.SetQuestion("x.org.", dns.TypeA)
+			reply := new(dns.Msg)
+			reply.SetRcode(query, dns.RcodeRefused)
+			reply.SetEdns0(1232, false)
+			reply.IsEdns0().Option = append(reply.IsEdns0().Option, &dns.EDNS0_EDE{
+				InfoCode:  dns.ExtendedErrorCodeCensored,
+				ExtraText: "blocked by court order",
+			})
+			data, err := reply.Pack()
+			if err != nil {
+				t.Fatal(err)
+			}
+			d := &DNSDecoderMiekg{}
+			info, err := d.DecodeReplyInfo(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := &model.DNSReplyInfo{
+				ExtendedErrors: []*model.DNSExtendedError{{
+					InfoCode:  dns.ExtendedErrorCodeCensored,
+					ExtraText: "blocked by court order",
+				}},
+			}
+			if diff := cmp.Diff(expected, info); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	})
+
+	t.Run("DecodeTTL", func(t *testing.T) {
+		t.Run("with nil data", func(t *testing.T) {
+			d := &DNSDecoderMiekg{}
+			ttl, err := d.DecodeTTL(nil)
+			if err == nil || err.Error() != "dns: overflow unpacking uint16" {
+				t.Fatal("not the error we expected", err)
+			}
+			if ttl != 0 {
+				t.Fatal("expected zero TTL")
+			}
+		})
+
+		t.Run("with empty reply", func(t *testing.T) {
+			data := dnsGenReplyWithAnswers(t, dns.TypeA)
+			d := &DNSDecoderMiekg{}
+			ttl, err := d.DecodeTTL(data)
+			if !errors.Is(err, ErrOODNSNoAnswer) {
+				t.Fatal("not the error we expected", err)
+			}
+			if ttl != 0 {
+				t.Fatal("expected zero TTL")
+			}
+		})
+
+		t.Run("with answers", func(t *testing.T) {
+			data := dnsGenReplyWithAnswers(t, dns.TypeA, &dns.A{
+				Hdr: dns.RR_Header{
+					Name:   dns.Fqdn("x.org"),
+					Rrtype: dns.TypeA,
+					Class:  dns.ClassINET,
+					Ttl:    300,
+				},
+				A: net.IPv4(1, 1, 1, 1),
+			}, &dns.A{
+				Hdr: dnsGenRRHeader(dns.TypeA),
+				A:   net.IPv4(1, 0, 0, 1),
+			})
+			d := &DNSDecoderMiekg{}
+			ttl, err := d.DecodeTTL(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ttl != 100*time.Second {
+				t.Fatal("unexpected TTL", ttl)
+			}
+		})
+
+		t.Run("with NXDOMAIN and SOA", func(t *testing.T) {
+			data := dnsGenNXDOMAINReplyWithSOA(t, 3600, 60)
+			d := &DNSDecoderMiekg{}
+			ttl, err := d.DecodeTTL(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ttl != 60*time.Second {
+				t.Fatal("unexpected TTL", ttl)
+			}
+		})
+	})
+}
+
+func TestDNSExtendedErrorName(t *testing.T) {
+	if name := DNSExtendedErrorName(dns.ExtendedErrorCodeBlocked); name != "Blocked" {
+		t.Fatal("unexpected name", name)
+	}
+	if name := DNSExtendedErrorName(65535); name != "" {
+		t.Fatal("unexpected name", name)
+	}
+}
+
+// dnsGenRRHeader generates a resource record header for x.org.
+func dnsGenRRHeader(rrtype uint16) dns.RR_Header {
+	return dns.RR_Header{
+		Name:   dns.Fqdn("x.org"),
+		Rrtype: rrtype,
+		Class:  dns.ClassINET,
+		Ttl:    100,
+	}
+}
+
+// dnsGenReplyWithAnswers generates a successful DNS reply for
+// the given qtype containing the given answers.
+func dnsGenReplyWithAnswers(t *testing.T, qtype uint16, answers ...dns.RR) []byte {
+	query := new(dns.Msg)
+	query.SetQuestion(dns.Fqdn("x.org"), qtype)
+	reply := new(dns.Msg)
+	reply.Compress = true
+	reply.MsgHdr.RecursionAvailable = true
+	reply.SetReply(query)
+	reply.Answer = answers
+	data, err := reply.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
 }
 
 // dnsGenReplyWithError generates a DNS reply for the given
@@ -207,6 +575,31 @@ func dnsGenReplyWithError(t *testing.T, qtype uint16, code int) []byte {
 	return data
 }
 
+// dnsGenNXDOMAINReplyWithSOA generates an NXDOMAIN reply for an A query
+// for x.org including a SOA record with the given TTL and MINIMUM.
+func dnsGenNXDOMAINReplyWithSOA(t *testing.T, ttl, minttl uint32) []byte {
+	query := new(dns.Msg)
+	query.SetQuestion(dns.Fqdn("x.org"), dns.TypeA)
+	reply := new(dns.Msg)
+	reply.SetRcode(query, dns.RcodeNameError)
+	reply.Ns = append(reply.Ns, &dns.SOA{
+		Hdr: dns.RR_Header{
+			Name:   dns.Fqdn("x.org"),
+			Rrtype: dns.TypeSOA,
+			Class:  dns.ClassINET,
+			Ttl:    ttl,
+		},
+		Ns:     dns.Fqdn("ns.x.org"),
+		Mbox:   dns.Fqdn("hostmaster.x.org"),
+		Minttl: minttl,
+	})
+	data, err := reply.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
 // dnsGenLookupHostReplySuccess generates a successful DNS reply for the given
 // qtype (e.g., dns.TypeA) containing the given ips... in the answer.
 func dnsGenLookupHostReplySuccess(t *testing.T, qtype uint16, ips ...string) []byte {
@@ -1,6 +1,9 @@
 package netxlite
 
 import (
+	"errors"
+	"net"
+
 	"github.com/miekg/dns"
 	"github.com/ooni/probe-cli/v3/internal/model"
 )
@@ -19,7 +22,22 @@ const (
 	dnsDNSSECEnabled = true
 )
 
+// ErrInvalidClientSubnet indicates that DNSQueryOptions.ClientSubnet
+// is not a valid IPv4 or IPv6 network in CIDR notation.
+var ErrInvalidClientSubnet = errors.New("netxlite: invalid EDNS client subnet")
+
 func (e *DNSEncoderMiekg) Encode(domain string, qtype uint16, padding bool) ([]byte, error) {
+	options := &model.DNSQueryOptions{}
+	if padding {
+		options.DNSSECOK = dnsDNSSECEnabled
+		options.UDPPayloadSize = dnsEDNS0MaxResponseSize
+		options.PaddingBlockSize = dnsPaddingDesiredBlockSize
+	}
+	return e.EncodeWithOptions(domain, qtype, options)
+}
+
+func (e *DNSEncoderMiekg) EncodeWithOptions(
+	domain string, qtype uint16, options *model.DNSQueryOptions) ([]byte, error) {
 	question := dns.Question{
 		Name:   dns.Fqdn(domain),
 		Qtype:  qtype,
@@ -30,15 +48,28 @@ func (e *DNSEncoderMiekg) Encode(domain string, qtype uint16, padding bool) ([]b
 	query.RecursionDesired = true
 	query.Question = make([]dns.Question, 1)
 	query.Question[0] = question
-	if padding {
-		query.SetEdns0(dnsEDNS0MaxResponseSize, dnsDNSSECEnabled)
+	if options == nil || !dnsQueryOptionsNeedEDNS0(options) {
+		return query.Pack()
+	}
+	size := options.UDPPayloadSize
+	if size <= 0 {
+		size = dnsEDNS0MaxResponseSize
+	}
+	query.SetEdns0(size, options.DNSSECOK)
+	if options.ClientSubnet != "" {
+		subnet, err := dnsNewClientSubnet(options.ClientSubnet)
+		if err != nil {
+			return nil, err
+		}
+		query.IsEdns0().Option = append(query.IsEdns0().Option, subnet)
+	}
+	if options.PaddingBlockSize > 0 {
 		// Clients SHOULD pad queries to the closest multiple of
-		// 128 octets RFC8467#section-4.1. We inflate the query
-		// length by the size of the option (i.e. 4 octets). The
-		// cast to uint is necessary to make the modulus operation
-		// work as intended when the desiredBlockSize is smaller
-		// than (query.Len()+4) ¯\_(ツ)_/¯.
-		remainder := (dnsPaddingDesiredBlockSize - uint(query.Len()+4)) % dnsPaddingDesiredBlockSize
+		// 128 octets RFC8467#section-4.1. We allow the caller to
+		// choose a different block size. We inflate the query
+		// length by the size of the option (i.e. 4 octets).
+		blockSize := uint(options.PaddingBlockSize)
+		remainder := (blockSize - uint(query.Len()+4)%blockSize) % blockSize
 		opt := new(dns.EDNS0_PADDING)
 		opt.Padding = make([]byte, remainder)
 		query.IsEdns0().Option = append(query.IsEdns0().Option, opt)
@@ -46,4 +77,50 @@ func (e *DNSEncoderMiekg) Encode(domain string, qtype uint16, padding bool) ([]b
 	return query.Pack()
 }
 
+// dnsQueryOptionsNeedEDNS0 returns whether we need to add
+// an OPT record to honour the given options.
+func dnsQueryOptionsNeedEDNS0(options *model.DNSQueryOptions) bool {
+	return options.DNSSECOK || options.ClientSubnet != "" ||
+		options.UDPPayloadSize > 0 || options.PaddingBlockSize > 0
+}
+
+// dnsNewClientSubnet creates an RFC7871 EDNS Client Subnet
+// option from a network expressed in CIDR notation.
+func dnsNewClientSubnet(cidr string) (*dns.EDNS0_SUBNET, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, ErrInvalidClientSubnet
+	}
+	ones, _ := network.Mask.Size()
+	subnet := &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		SourceNetmask: uint8(ones),
+		SourceScope:   0,
+	}
+	if ipv4 := network.IP.To4(); ipv4 != nil {
+		subnet.Family = 1
+		subnet.Address = ipv4
+	} else {
+		subnet.Family = 2
+		subnet.Address = network.IP
+	}
+	return subnet, nil
+}
+
+// dnsEncodeQuery encodes a query for domain and qtype using the given
+// encoder. When options is nil, we use the transport's padding policy
+// like we did before DNSQueryOptions existed. Otherwise, we apply the
+// transport's padding policy only if options.PaddingBlockSize is zero.
+func dnsEncodeQuery(encoder model.DNSEncoder, txp model.DNSTransport,
+	options *model.DNSQueryOptions, domain string, qtype uint16) ([]byte, error) {
+	if options == nil {
+		return encoder.Encode(domain, qtype, txp.RequiresPadding())
+	}
+	effective := *options
+	if effective.PaddingBlockSize == 0 && txp.RequiresPadding() {
+		effective.PaddingBlockSize = dnsPaddingDesiredBlockSize
+	}
+	return encoder.EncodeWithOptions(domain, qtype, &effective)
+}
+
 var _ model.DNSEncoder = &DNSEncoderMiekg{}
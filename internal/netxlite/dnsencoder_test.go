@@ -1,10 +1,13 @@
 package netxlite
 
 import (
+	"errors"
 	"strings"
 	"testing"
 
 	"github.com/miekg/dns"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/model/mocks"
 )
 
 func TestDNSEncoder(t *testing.T) {
@@ -60,6 +63,209 @@ func TestDNSEncoder(t *testing.T) {
 			}
 		}
 	})
+
+	t.Run("EncodeWithOptions", func(t *testing.T) {
+		// decode parses the query generated using the given options.
+		decode := func(options *model.DNSQueryOptions) (*dns.Msg, int) {
+			e := &DNSEncoderMiekg{}
+			data, err := e.EncodeWithOptions("x.org", dns.TypeA, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			query := new(dns.Msg)
+			if err := query.Unpack(data); err != nil {
+				t.Fatal(err)
+			}
+			return query, len(data)
+		}
+
+		t.Run("with nil or empty options", func(t *testing.T) {
+			for _, options := range []*model.DNSQueryOptions{nil, {}, {PaddingBlockSize: -1}} {
+				query, _ := decode(options)
+				if query.IsEdns0() != nil {
+					t.Fatal("did not expect an OPT record")
+				}
+			}
+		})
+
+		t.Run("with DNSSEC OK and custom payload size", func(t *testing.T) {
+			query, _ := decode(&model.DNSQueryOptions{DNSSECOK: true, UDPPayloadSize: 1232})
+			opt := query.IsEdns0()
+			if opt == nil {
+				t.Fatal("expected an OPT record")
+			}
+			if !opt.Do() {
+				t.Fatal("expected the DO bit to be set")
+			}
+			if opt.UDPSize() != 1232 {
+				t.Fatal("unexpected UDP payload size", opt.UDPSize())
+			}
+		})
+
+		t.Run("with default payload size", func(t *testing.T) {
+			query, _ := decode(&model.DNSQueryOptions{ClientSubnet: "130.192.91.0/24"})
+			opt := query.IsEdns0()
+			if opt == nil {
+				t.Fatal("expected an OPT record")
+			}
+			if opt.Do() {
+				t.Fatal("did not expect the DO bit to be set")
+			}
+			if opt.UDPSize() != dnsEDNS0MaxResponseSize {
+				t.Fatal("unexpected UDP payload size", opt.UDPSize())
+			}
+		})
+
+		t.Run("with client subnet", func(t *testing.T) {
+			var tests = []struct {
+				cidr    string
+				family  uint16
+				netmask uint8
+				address string
+			}{{
+				cidr:    "130.192.91.211/24",
+				family:  1,
+				netmask: 24,
+				address: "130.192.91.0",
+			}, {
+				cidr:    "2001:db8:1234::1/48",
+				family:  2,
+				netmask: 48,
+				address: "2001:db8:1234::",
+			}}
+			for _, tt := range tests {
+				query, _ := decode(&model.DNSQueryOptions{ClientSubnet: tt.cidr})
+				opt := query.IsEdns0()
+				if opt == nil || len(opt.Option) != 1 {
+					t.Fatal("expected a single EDNS0 option")
+				}
+				subnet, ok := opt.Option[0].(*dns.EDNS0_SUBNET)
+				if !ok {
+					t.Fatal("expected an EDNS0_SUBNET option")
+				}
+				if subnet.Family != tt.family {
+					t.Fatal("unexpected family", subnet.Family)
+				}
+				if subnet.SourceNetmask != tt.netmask {
+					t.Fatal("unexpected netmask", subnet.SourceNetmask)
+				}
+				if subnet.Address.String() != tt.address {
+					t.Fatal("unexpected address", subnet.Address.String())
+				}
+			}
+		})
+
+		t.Run("with invalid client subnet", func(t *testing.T) {
+			e := &DNSEncoderMiekg{}
+			data, err := e.EncodeWithOptions("x.org", dns.TypeA, &model.DNSQueryOptions{
+				ClientSubnet: "130.192.91.211",
+			})
+			if !errors.Is(err, ErrInvalidClientSubnet) {
+				t.Fatal("not the error we expected", err)
+			}
+			if data != nil {
+				t.Fatal("expected nil data")
+			}
+		})
+
+		t.Run("with custom padding block size", func(t *testing.T) {
+			for _, blockSize := range []int{128, 468} {
+				query, length := decode(&model.DNSQueryOptions{
+					ClientSubnet:     "130.192.91.0/24",
+					PaddingBlockSize: blockSize,
+				})
+				if length%blockSize != 0 {
+					t.Fatal("query length is not a multiple of the block size", length)
+				}
+				options := query.IsEdns0().Option
+				if _, ok := options[len(options)-1].(*dns.EDNS0_PADDING); !ok {
+					t.Fatal("expected padding to be the last option")
+				}
+			}
+		})
+	})
+
+	t.Run("dnsEncodeQuery", func(t *testing.T) {
+		// newTransport creates a transport with the given padding policy.
+		newTransport := func(padding bool) model.DNSTransport {
+			return &mocks.DNSTransport{
+				MockRequiresPadding: func() bool {
+					return padding
+				},
+			}
+		}
+
+		t.Run("with nil options", func(t *testing.T) {
+			var gotPadding bool
+			encoder := &mocks.DNSEncoder{
+				MockEncode: func(domain string, qtype uint16, padding bool) ([]byte, error) {
+					gotPadding = padding
+					return []byte{0}, nil
+				},
+			}
+			if _, err := dnsEncodeQuery(encoder, newTransport(true), nil, "x.org", dns.TypeA); err != nil {
+				t.Fatal(err)
+			}
+			if !gotPadding {
+				t.Fatal("expected padding")
+			}
+		})
+
+		t.Run("with options", func(t *testing.T) {
+			var tests = []struct {
+				name         string
+				txpPadding   bool
+				blockSize    int
+				expectedSize int
+			}{{
+				name:         "transport requiring padding and default block size",
+				txpPadding:   true,
+				blockSize:    0,
+				expectedSize: dnsPaddingDesiredBlockSize,
+			}, {
+				name:         "transport requiring padding and padding disabled",
+				txpPadding:   true,
+				blockSize:    -1,
+				expectedSize: -1,
+			}, {
+				name:         "transport not requiring padding and default block size",
+				txpPadding:   false,
+				blockSize:    0,
+				expectedSize: 0,
+			}, {
+				name:         "transport not requiring padding and custom block size",
+				txpPadding:   false,
+				blockSize:    468,
+				expectedSize: 468,
+			}}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					var got *model.DNSQueryOptions
+					encoder := &mocks.DNSEncoder{
+						MockEncodeWithOptions: func(domain string, qtype uint16,
+							options *model.DNSQueryOptions) ([]byte, error) {
+							got = options
+							return []byte{0}, nil
+						},
+					}
+					options := &model.DNSQueryOptions{DNSSECOK: true, PaddingBlockSize: tt.blockSize}
+					_, err := dnsEncodeQuery(encoder, newTransport(tt.txpPadding), options, "x.org", dns.TypeA)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if got.PaddingBlockSize != tt.expectedSize {
+						t.Fatal("unexpected padding block size", got.PaddingBlockSize)
+					}
+					if !got.DNSSECOK {
+						t.Fatal("expected DNSSECOK to be preserved")
+					}
+					if options.PaddingBlockSize != tt.blockSize {
+						t.Fatal("the caller's options have been modified")
+					}
+				})
+			}
+		})
+	})
 }
 
 // dnsValidateEncodedQueryBytes validates the query serialized in data
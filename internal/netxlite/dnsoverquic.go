@@ -0,0 +1,134 @@
+package netxlite
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"math"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+// DNSOverQUIC is a DNS-over-QUIC DNSTransport (see RFC9250).
+//
+// Bug: this implementation always creates a new QUIC session for
+// each query, while RFC9250 recommends to reuse sessions.
+type DNSOverQUIC struct {
+	dialer    model.QUICDialer
+	address   string
+	tlsConfig *tls.Config
+}
+
+// NewDNSOverQUIC creates a new DNSOverQUIC transport.
+//
+// Arguments:
+//
+// - dialer is any type that implements the QUICDialer interface;
+//
+// - address is the endpoint address (e.g., dns.adguard.com:853).
+func NewDNSOverQUIC(dialer model.QUICDialer, address string) *DNSOverQUIC {
+	return NewDNSOverQUICWithTLSConfig(dialer, address, &tls.Config{})
+}
+
+// NewDNSOverQUICWithTLSConfig is like NewDNSOverQUIC but allows
+// you to specify the TLS config (e.g., to override the SNI). If the
+// config does not specify any ALPN, we will use "doq".
+func NewDNSOverQUICWithTLSConfig(
+	dialer model.QUICDialer, address string, config *tls.Config) *DNSOverQUIC {
+	config = config.Clone()
+	if len(config.NextProtos) <= 0 {
+		// See https://www.rfc-editor.org/rfc/rfc9250.html#section-4.1.1
+		config.NextProtos = []string{"doq"}
+	}
+	return &DNSOverQUIC{dialer: dialer, address: address, tlsConfig: config}
+}
+
+// RoundTrip sends a query and receives a reply.
+func (t *DNSOverQUIC) RoundTrip(ctx context.Context, query []byte) ([]byte, error) {
+	if len(query) > math.MaxUint16 {
+		return nil, errors.New("query too long")
+	}
+	if len(query) < 2 {
+		return nil, errors.New("query too short")
+	}
+	sess, err := t.dialer.DialContext(
+		ctx, "udp", t.address, t.tlsConfig, &quic.Config{})
+	if err != nil {
+		return nil, err
+	}
+	defer sess.CloseWithError(0, "")
+	stream, err := sess.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = stream.SetDeadline(dnsOverQUICDeadline(ctx)); err != nil {
+		return nil, err
+	}
+	// Write request. The message ID MUST be zero (RFC9250 Sect. 4.2.1).
+	buf := []byte{byte(len(query) >> 8)}
+	buf = append(buf, byte(len(query)))
+	buf = append(buf, 0, 0)
+	buf = append(buf, query[2:]...)
+	if _, err = stream.Write(buf); err != nil {
+		return nil, err
+	}
+	// The client MUST indicate that there are no more queries on
+	// this stream by closing the write side (RFC9250 Sect. 4.2).
+	if err = stream.Close(); err != nil {
+		return nil, err
+	}
+	// Read response
+	header := make([]byte, 2)
+	if _, err = io.ReadFull(stream, header); err != nil {
+		return nil, err
+	}
+	length := int(header[0])<<8 | int(header[1])
+	reply := make([]byte, length)
+	if _, err = io.ReadFull(stream, reply); err != nil {
+		return nil, err
+	}
+	if len(reply) >= 2 {
+		// Restore the original message ID so that the caller can
+		// match the reply with the query as usual.
+		reply[0], reply[1] = query[0], query[1]
+	}
+	return reply, nil
+}
+
+// dnsOverQUICDefaultTimeout is the stream timeout we use
+// when the context passed to RoundTrip has no deadline.
+const dnsOverQUICDefaultTimeout = 10 * time.Second
+
+// dnsOverQUICDeadline returns the deadline of the stream, which is the
+// deadline of ctx, if any, or a deadline using the default timeout.
+func dnsOverQUICDeadline(ctx context.Context) time.Time {
+	if deadline, ok := ctx.Deadline(); ok {
+		return deadline
+	}
+	return time.Now().Add(dnsOverQUICDefaultTimeout)
+}
+
+// RequiresPadding returns true for DoQ according to RFC9250.
+func (t *DNSOverQUIC) RequiresPadding() bool {
+	return true
+}
+
+// Network returns the transport network, i.e., "doq".
+func (t *DNSOverQUIC) Network() string {
+	return "doq"
+}
+
+// Address returns the upstream server endpoint (e.g., "1.1.1.1:853").
+func (t *DNSOverQUIC) Address() string {
+	return t.address
+}
+
+// CloseIdleConnections closes idle connections, if any.
+func (t *DNSOverQUIC) CloseIdleConnections() {
+	t.dialer.CloseIdleConnections()
+}
+
+var _ model.DNSTransport = &DNSOverQUIC{}
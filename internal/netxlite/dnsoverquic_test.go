@@ -0,0 +1,365 @@
+package netxlite
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/ooni/probe-cli/v3/internal/model/mocks"
+)
+
+func TestDNSOverQUIC(t *testing.T) {
+	// newSession returns a mocked session whose streams are
+	// created by calling the given function.
+	newSession := func(openStream func() (quic.Stream, error)) *mocks.QUICEarlySession {
+		return &mocks.QUICEarlySession{
+			MockOpenStreamSync: func(ctx context.Context) (quic.Stream, error) {
+				return openStream()
+			},
+			MockCloseWithError: func(code quic.ApplicationErrorCode, reason string) error {
+				return nil
+			},
+		}
+	}
+
+	// newDialer returns a mocked dialer returning the given session.
+	newDialer := func(sess quic.EarlySession) *mocks.QUICDialer {
+		return &mocks.QUICDialer{
+			MockDialContext: func(ctx context.Context, network, address string,
+				tlsConfig *tls.Config, quicConfig *quic.Config) (quic.EarlySession, error) {
+				return sess, nil
+			},
+		}
+	}
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		t.Run("query too large", func(t *testing.T) {
+			const address = "94.140.14.14:853"
+			txp := NewDNSOverQUIC(&mocks.QUICDialer{}, address)
+			reply, err := txp.RoundTrip(context.Background(), make([]byte, 1<<18))
+			if err == nil {
+				t.Fatal("expected an error here")
+			}
+			if reply != nil {
+				t.Fatal("expected nil reply here")
+			}
+		})
+
+		t.Run("query too short", func(t *testing.T) {
+			const address = "94.140.14.14:853"
+			txp := NewDNSOverQUIC(&mocks.QUICDialer{}, address)
+			reply, err := txp.RoundTrip(context.Background(), make([]byte, 1))
+			if err == nil {
+				t.Fatal("expected an error here")
+			}
+			if reply != nil {
+				t.Fatal("expected nil reply here")
+			}
+		})
+
+		t.Run("dial failure", func(t *testing.T) {
+			const address = "94.140.14.14:853"
+			mocked := errors.New("mocked error")
+			var gotALPN []string
+			fakedialer := &mocks.QUICDialer{
+				MockDialContext: func(ctx context.Context, network, address string,
+					tlsConfig *tls.Config, quicConfig *quic.Config) (quic.EarlySession, error) {
+					gotALPN = tlsConfig.NextProtos
+					return nil, mocked
+				},
+			}
+			txp := NewDNSOverQUIC(fakedialer, address)
+			reply, err := txp.RoundTrip(context.Background(), make([]byte, 1<<11))
+			if !errors.Is(err, mocked) {
+				t.Fatal("not the error we expected")
+			}
+			if reply != nil {
+				t.Fatal("expected nil reply here")
+			}
+			if len(gotALPN) != 1 || gotALPN[0] != "doq" {
+				t.Fatal("unexpected ALPN", gotALPN)
+			}
+		})
+
+		t.Run("OpenStreamSync failure", func(t *testing.T) {
+			const address = "94.140.14.14:853"
+			mocked := errors.New("mocked error")
+			var closed bool
+			sess := newSession(func() (quic.Stream, error) {
+				return nil, mocked
+			})
+			sess.MockCloseWithError = func(code quic.ApplicationErrorCode, reason string) error {
+				closed = true
+				return nil
+			}
+			txp := NewDNSOverQUIC(newDialer(sess), address)
+			reply, err := txp.RoundTrip(context.Background(), make([]byte, 1<<11))
+			if !errors.Is(err, mocked) {
+				t.Fatal("not the error we expected")
+			}
+			if reply != nil {
+				t.Fatal("expected nil reply here")
+			}
+			if !closed {
+				t.Fatal("did not close the session")
+			}
+		})
+
+		t.Run("SetDeadline failure", func(t *testing.T) {
+			const address = "94.140.14.14:853"
+			mocked := errors.New("mocked error")
+			sess := newSession(func() (quic.Stream, error) {
+				return &mocks.QUICStream{
+					MockSetDeadline: func(t time.Time) error {
+						return mocked
+					},
+				}, nil
+			})
+			txp := NewDNSOverQUIC(newDialer(sess), address)
+			reply, err := txp.RoundTrip(context.Background(), make([]byte, 1<<11))
+			if !errors.Is(err, mocked) {
+				t.Fatal("not the error we expected")
+			}
+			if reply != nil {
+				t.Fatal("expected nil reply here")
+			}
+		})
+
+		t.Run("SetDeadline uses the context deadline", func(t *testing.T) {
+			const address = "94.140.14.14:853"
+			mocked := errors.New("mocked error")
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			expected, _ := ctx.Deadline()
+			var got time.Time
+			sess := newSession(func() (quic.Stream, error) {
+				return &mocks.QUICStream{
+					MockSetDeadline: func(t time.Time) error {
+						got = t
+						return mocked
+					},
+				}, nil
+			})
+			txp := NewDNSOverQUIC(newDialer(sess), address)
+			if _, err := txp.RoundTrip(ctx, make([]byte, 1<<11)); !errors.Is(err, mocked) {
+				t.Fatal("not the error we expected")
+			}
+			if !got.Equal(expected) {
+				t.Fatal("unexpected deadline", got)
+			}
+		})
+
+		t.Run("SetDeadline without a context deadline", func(t *testing.T) {
+			const address = "94.140.14.14:853"
+			mocked := errors.New("mocked error")
+			var got time.Time
+			sess := newSession(func() (quic.Stream, error) {
+				return &mocks.QUICStream{
+					MockSetDeadline: func(t time.Time) error {
+						got = t
+						return mocked
+					},
+				}, nil
+			})
+			txp := NewDNSOverQUIC(newDialer(sess), address)
+			before := time.Now()
+			if _, err := txp.RoundTrip(context.Background(), make([]byte, 1<<11)); !errors.Is(err, mocked) {
+				t.Fatal("not the error we expected")
+			}
+			if got.Before(before.Add(dnsOverQUICDefaultTimeout)) || got.After(time.Now().Add(dnsOverQUICDefaultTimeout)) {
+				t.Fatal("unexpected deadline", got)
+			}
+		})
+
+		t.Run("write failure", func(t *testing.T) {
+			const address = "94.140.14.14:853"
+			mocked := errors.New("mocked error")
+			sess := newSession(func() (quic.Stream, error) {
+				return &mocks.QUICStream{
+					MockSetDeadline: func(t time.Time) error {
+						return nil
+					},
+					MockWrite: func(b []byte) (int, error) {
+						return 0, mocked
+					},
+				}, nil
+			})
+			txp := NewDNSOverQUIC(newDialer(sess), address)
+			reply, err := txp.RoundTrip(context.Background(), make([]byte, 1<<11))
+			if !errors.Is(err, mocked) {
+				t.Fatal("not the error we expected")
+			}
+			if reply != nil {
+				t.Fatal("expected nil reply here")
+			}
+		})
+
+		t.Run("close failure", func(t *testing.T) {
+			const address = "94.140.14.14:853"
+			mocked := errors.New("mocked error")
+			sess := newSession(func() (quic.Stream, error) {
+				return &mocks.QUICStream{
+					MockSetDeadline: func(t time.Time) error {
+						return nil
+					},
+					MockWrite: func(b []byte) (int, error) {
+						return len(b), nil
+					},
+					MockClose: func() error {
+						return mocked
+					},
+				}, nil
+			})
+			txp := NewDNSOverQUIC(newDialer(sess), address)
+			reply, err := txp.RoundTrip(context.Background(), make([]byte, 1<<11))
+			if !errors.Is(err, mocked) {
+				t.Fatal("not the error we expected")
+			}
+			if reply != nil {
+				t.Fatal("expected nil reply here")
+			}
+		})
+
+		t.Run("first read fails", func(t *testing.T) {
+			const address = "94.140.14.14:853"
+			mocked := errors.New("mocked error")
+			sess := newSession(func() (quic.Stream, error) {
+				return &mocks.QUICStream{
+					MockSetDeadline: func(t time.Time) error {
+						return nil
+					},
+					MockWrite: func(b []byte) (int, error) {
+						return len(b), nil
+					},
+					MockClose: func() error {
+						return nil
+					},
+					MockRead: func(b []byte) (int, error) {
+						return 0, mocked
+					},
+				}, nil
+			})
+			txp := NewDNSOverQUIC(newDialer(sess), address)
+			reply, err := txp.RoundTrip(context.Background(), make([]byte, 1<<11))
+			if !errors.Is(err, mocked) {
+				t.Fatal("not the error we expected")
+			}
+			if reply != nil {
+				t.Fatal("expected nil reply here")
+			}
+		})
+
+		t.Run("second read fails", func(t *testing.T) {
+			const address = "94.140.14.14:853"
+			mocked := errors.New("mocked error")
+			input := io.MultiReader(
+				bytes.NewReader([]byte{byte(0), byte(2)}),
+				&mocks.Reader{
+					MockRead: func(b []byte) (int, error) {
+						return 0, mocked
+					},
+				},
+			)
+			sess := newSession(func() (quic.Stream, error) {
+				return &mocks.QUICStream{
+					MockSetDeadline: func(t time.Time) error {
+						return nil
+					},
+					MockWrite: func(b []byte) (int, error) {
+						return len(b), nil
+					},
+					MockClose: func() error {
+						return nil
+					},
+					MockRead: input.Read,
+				}, nil
+			})
+			txp := NewDNSOverQUIC(newDialer(sess), address)
+			reply, err := txp.RoundTrip(context.Background(), make([]byte, 1<<11))
+			if !errors.Is(err, mocked) {
+				t.Fatal("not the error we expected")
+			}
+			if reply != nil {
+				t.Fatal("expected nil reply here")
+			}
+		})
+
+		t.Run("successful case", func(t *testing.T) {
+			const address = "94.140.14.14:853"
+			input := bytes.NewReader([]byte{byte(0), byte(3), byte(0), byte(0), byte(1)})
+			var written []byte
+			sess := newSession(func() (quic.Stream, error) {
+				return &mocks.QUICStream{
+					MockSetDeadline: func(t time.Time) error {
+						return nil
+					},
+					MockWrite: func(b []byte) (int, error) {
+						written = append(written, b...)
+						return len(b), nil
+					},
+					MockClose: func() error {
+						return nil
+					},
+					MockRead: input.Read,
+				}, nil
+			})
+			txp := NewDNSOverQUIC(newDialer(sess), address)
+			query := []byte{byte(0xca), byte(0xfe), byte(1)}
+			reply, err := txp.RoundTrip(context.Background(), query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectWritten := []byte{byte(0), byte(3), byte(0), byte(0), byte(1)}
+			if !bytes.Equal(written, expectWritten) {
+				t.Fatal("did not zero the message ID", written)
+			}
+			expectReply := []byte{byte(0xca), byte(0xfe), byte(1)}
+			if !bytes.Equal(reply, expectReply) {
+				t.Fatal("did not restore the message ID", reply)
+			}
+		})
+	})
+
+	t.Run("custom TLS config", func(t *testing.T) {
+		config := &tls.Config{ServerName: "dns.adguard.com"}
+		txp := NewDNSOverQUICWithTLSConfig(&mocks.QUICDialer{}, "94.140.14.14:853", config)
+		if txp.tlsConfig.ServerName != "dns.adguard.com" {
+			t.Fatal("did not copy the ServerName")
+		}
+		if len(txp.tlsConfig.NextProtos) != 1 || txp.tlsConfig.NextProtos[0] != "doq" {
+			t.Fatal("did not set the ALPN")
+		}
+		if len(config.NextProtos) != 0 {
+			t.Fatal("did modify the original config")
+		}
+	})
+
+	t.Run("other functions okay", func(t *testing.T) {
+		const address = "94.140.14.14:853"
+		var called bool
+		fakedialer := &mocks.QUICDialer{
+			MockCloseIdleConnections: func() {
+				called = true
+			},
+		}
+		txp := NewDNSOverQUIC(fakedialer, address)
+		if txp.RequiresPadding() != true {
+			t.Fatal("invalid RequiresPadding")
+		}
+		if txp.Network() != "doq" {
+			t.Fatal("invalid Network")
+		}
+		if txp.Address() != address {
+			t.Fatal("invalid Address")
+		}
+		txp.CloseIdleConnections()
+		if !called {
+			t.Fatal("did not call CloseIdleConnections")
+		}
+	})
+}
@@ -2,8 +2,13 @@ package netxlite
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/miekg/dns"
 	"github.com/ooni/probe-cli/v3/internal/model"
 )
 
@@ -11,6 +16,11 @@ import (
 type DNSOverUDP struct {
 	dialer  model.Dialer
 	address string
+
+	// duplicatesWindow is the time during which we keep reading
+	// from the socket after the first response. When zero, we close
+	// the socket as soon as we have received the first response.
+	duplicatesWindow time.Duration
 }
 
 // NewDNSOverUDP creates a DNSOverUDP instance.
@@ -24,8 +34,33 @@ func NewDNSOverUDP(dialer model.Dialer, address string) *DNSOverUDP {
 	return &DNSOverUDP{dialer: dialer, address: address}
 }
 
+// NewDNSOverUDPWithDuplicates is like NewDNSOverUDP except that,
+// after receiving the first response, the returned transport keeps
+// the socket open for the given window to collect any other response
+// carrying the same query ID. This mode allows to detect on-path
+// DNS injection, where a forged response arrives before the one
+// sent by the real server. Use RoundTripWithDuplicates to obtain all
+// the responses. RoundTrip returns the first response after the window
+// has expired, so using this mode slows down every lookup.
+func NewDNSOverUDPWithDuplicates(
+	dialer model.Dialer, address string, window time.Duration) *DNSOverUDP {
+	return &DNSOverUDP{dialer: dialer, address: address, duplicatesWindow: window}
+}
+
 // RoundTrip sends a query and receives a reply.
 func (t *DNSOverUDP) RoundTrip(ctx context.Context, query []byte) ([]byte, error) {
+	responses, err := t.RoundTripWithDuplicates(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return responses[0].Reply, nil
+}
+
+// RoundTripWithDuplicates implements model.DNSTransportWithDuplicates. If this
+// transport was not created using NewDNSOverUDPWithDuplicates, the returned
+// list always contains a single response.
+func (t *DNSOverUDP) RoundTripWithDuplicates(
+	ctx context.Context, query []byte) ([]*model.DNSResponse, error) {
 	conn, err := t.dialer.DialContext(ctx, "udp", t.address)
 	if err != nil {
 		return nil, err
@@ -45,7 +80,31 @@ func (t *DNSOverUDP) RoundTrip(ctx context.Context, query []byte) ([]byte, error
 	if err != nil {
 		return nil, err
 	}
-	return reply[:n], nil
+	first := &model.DNSResponse{Reply: reply[:n], Received: time.Now()}
+	responses := []*model.DNSResponse{first}
+	if t.duplicatesWindow <= 0 || len(query) < 2 {
+		return responses, nil
+	}
+	if err := conn.SetDeadline(first.Received.Add(t.duplicatesWindow)); err != nil {
+		return responses, nil // we already have a valid response
+	}
+	for {
+		buffer := make([]byte, 1<<17)
+		n, err := conn.Read(buffer)
+		if err != nil {
+			// Typically, the error is a timeout meaning that the window
+			// has expired. Any other error is also fine to stop reading
+			// because we already have at least one valid response.
+			return responses, nil
+		}
+		if n < 2 || buffer[0] != query[0] || buffer[1] != query[1] {
+			continue // not a response to our query
+		}
+		responses = append(responses, &model.DNSResponse{
+			Reply:    buffer[:n],
+			Received: time.Now(),
+		})
+	}
 }
 
 // RequiresPadding returns false for UDP according to RFC8467.
@@ -68,4 +127,51 @@ func (t *DNSOverUDP) CloseIdleConnections() {
 	// nothing to do
 }
 
-var _ model.DNSTransport = &DNSOverUDP{}
+var _ model.DNSTransportWithDuplicates = &DNSOverUDP{}
+
+// errDNSTooFewReplies indicates that DNSRepliesConflict
+// was called with less than two replies.
+var errDNSTooFewReplies = errors.New("netxlite: too few DNS replies")
+
+// DNSRepliesConflict returns true when the given raw DNS replies for
+// the same query do not all contain the same response code and the same
+// set of A/AAAA/CNAME answers. This happens, e.g., when an on-path
+// injector races with the real server. Replies that we cannot parse
+// conflict with any other reply. This function returns an error if
+// it is passed less than two replies.
+func DNSRepliesConflict(replies ...[]byte) (bool, error) {
+	if len(replies) < 2 {
+		return false, errDNSTooFewReplies
+	}
+	first := dnsReplyFingerprint(replies[0])
+	for _, reply := range replies[1:] {
+		fp := dnsReplyFingerprint(reply)
+		if first == "" || fp == "" || fp != first {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// dnsReplyFingerprint returns a string summarizing the response code
+// and the A/AAAA/CNAME answers of a raw reply. Returns an empty string
+// if the reply cannot be parsed.
+func dnsReplyFingerprint(data []byte) string {
+	reply := new(dns.Msg)
+	if err := reply.Unpack(data); err != nil {
+		return ""
+	}
+	var answers []string
+	for _, answer := range reply.Answer {
+		switch v := answer.(type) {
+		case *dns.A:
+			answers = append(answers, "A "+v.A.String())
+		case *dns.AAAA:
+			answers = append(answers, "AAAA "+v.AAAA.String())
+		case *dns.CNAME:
+			answers = append(answers, "CNAME "+v.Target)
+		}
+	}
+	sort.Strings(answers)
+	return fmt.Sprintf("%d %s", reply.Rcode, strings.Join(answers, ","))
+}
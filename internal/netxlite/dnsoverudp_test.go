@@ -5,10 +5,12 @@ import (
 	"context"
 	"errors"
 	"net"
+	"os"
 	"testing"
 	"time"
 
 	"github.com/apex/log"
+	"github.com/miekg/dns"
 	"github.com/ooni/probe-cli/v3/internal/model/mocks"
 )
 
@@ -146,6 +148,121 @@ func TestDNSOverUDP(t *testing.T) {
 		})
 	})
 
+	t.Run("RoundTripWithDuplicates", func(t *testing.T) {
+		// newConn returns a conn whose reads return the given
+		// datagrams in order and then fail with the given error.
+		newConn := func(datagrams [][]byte, final error) *mocks.Conn {
+			return &mocks.Conn{
+				MockSetDeadline: func(t time.Time) error {
+					return nil
+				},
+				MockWrite: func(b []byte) (int, error) {
+					return len(b), nil
+				},
+				MockRead: func(b []byte) (int, error) {
+					if len(datagrams) <= 0 {
+						return 0, final
+					}
+					n := copy(b, datagrams[0])
+					datagrams = datagrams[1:]
+					return n, nil
+				},
+				MockClose: func() error {
+					return nil
+				},
+			}
+		}
+
+		t.Run("without window we only read once", func(t *testing.T) {
+			conn := newConn([][]byte{{0xca, 0xfe, 1}, {0xca, 0xfe, 2}}, os.ErrDeadlineExceeded)
+			txp := NewDNSOverUDP(&mocks.Dialer{
+				MockDialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+					return conn, nil
+				},
+			}, "9.9.9.9:53")
+			responses, err := txp.RoundTripWithDuplicates(
+				context.Background(), []byte{0xca, 0xfe, 0})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(responses) != 1 {
+				t.Fatal("unexpected number of responses", len(responses))
+			}
+		})
+
+		t.Run("with window we collect matching responses", func(t *testing.T) {
+			conn := newConn([][]byte{
+				{0xca, 0xfe, 1},
+				{0xde, 0xad, 2}, // different ID
+				{0xca},          // too short
+				{0xca, 0xfe, 3},
+			}, os.ErrDeadlineExceeded)
+			var deadlines []time.Time
+			conn.MockSetDeadline = func(t time.Time) error {
+				deadlines = append(deadlines, t)
+				return nil
+			}
+			txp := NewDNSOverUDPWithDuplicates(&mocks.Dialer{
+				MockDialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+					return conn, nil
+				},
+			}, "9.9.9.9:53", 250*time.Millisecond)
+			responses, err := txp.RoundTripWithDuplicates(
+				context.Background(), []byte{0xca, 0xfe, 0})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(responses) != 2 {
+				t.Fatal("unexpected number of responses", len(responses))
+			}
+			if !bytes.Equal(responses[0].Reply, []byte{0xca, 0xfe, 1}) {
+				t.Fatal("unexpected first response")
+			}
+			if !bytes.Equal(responses[1].Reply, []byte{0xca, 0xfe, 3}) {
+				t.Fatal("unexpected second response")
+			}
+			if len(deadlines) != 2 {
+				t.Fatal("did not update the deadline")
+			}
+			reply, err := NewDNSOverUDPWithDuplicates(&mocks.Dialer{
+				MockDialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+					return newConn([][]byte{{0xca, 0xfe, 1}, {0xca, 0xfe, 3}}, os.ErrDeadlineExceeded), nil
+				},
+			}, "9.9.9.9:53", time.Millisecond).RoundTrip(
+				context.Background(), []byte{0xca, 0xfe, 0})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(reply, []byte{0xca, 0xfe, 1}) {
+				t.Fatal("RoundTrip did not return the first response")
+			}
+		})
+
+		t.Run("second SetDeadline failure", func(t *testing.T) {
+			conn := newConn([][]byte{{0xca, 0xfe, 1}, {0xca, 0xfe, 2}}, os.ErrDeadlineExceeded)
+			var count int
+			conn.MockSetDeadline = func(t time.Time) error {
+				if count++; count > 1 {
+					return errors.New("mocked error")
+				}
+				return nil
+			}
+			txp := NewDNSOverUDPWithDuplicates(&mocks.Dialer{
+				MockDialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+					return conn, nil
+				},
+			}, "9.9.9.9:53", time.Second)
+			responses, err := txp.RoundTripWithDuplicates(
+				context.Background(), []byte{0xca, 0xfe, 0})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(responses) != 1 {
+				t.Fatal("unexpected number of responses", len(responses))
+			}
+		})
+	})
+
 	t.Run("other functions okay", func(t *testing.T) {
 		const address = "9.9.9.9:53"
 		txp := NewDNSOverUDP(NewDialerWithoutResolver(log.Log), address)
@@ -160,3 +277,91 @@ func TestDNSOverUDP(t *testing.T) {
 		}
 	})
 }
+
+func TestDNSRepliesConflict(t *testing.T) {
+	// newReply creates a raw reply with the given rcode and A records.
+	newReply := func(rcode int, addrs ...string) []byte {
+		query := new(dns.Msg)
+		query.SetQuestion("example.com.", dns.TypeA)
+		reply := new(dns.Msg)
+		reply.SetRcode(query, rcode)
+		for _, addr := range addrs {
+			reply.Answer = append(reply.Answer, &dns.A{
+				Hdr: dns.RR_Header{
+					Name:   "example.com.",
+					Rrtype: dns.TypeA,
+					Class:  dns.ClassINET,
+					Ttl:    60,
+				},
+				A: net.ParseIP(addr),
+			})
+		}
+		data, err := reply.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	t.Run("too few replies", func(t *testing.T) {
+		conflict, err := DNSRepliesConflict(newReply(dns.RcodeSuccess))
+		if err == nil {
+			t.Fatal("expected an error here")
+		}
+		if conflict {
+			t.Fatal("expected no conflict")
+		}
+	})
+
+	t.Run("same answers in different order", func(t *testing.T) {
+		conflict, err := DNSRepliesConflict(
+			newReply(dns.RcodeSuccess, "93.184.216.34", "1.1.1.1"),
+			newReply(dns.RcodeSuccess, "1.1.1.1", "93.184.216.34"),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conflict {
+			t.Fatal("expected no conflict")
+		}
+	})
+
+	t.Run("different answers", func(t *testing.T) {
+		conflict, err := DNSRepliesConflict(
+			newReply(dns.RcodeSuccess, "10.10.34.35"),
+			newReply(dns.RcodeSuccess, "93.184.216.34"),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !conflict {
+			t.Fatal("expected conflict")
+		}
+	})
+
+	t.Run("different rcode", func(t *testing.T) {
+		conflict, err := DNSRepliesConflict(
+			newReply(dns.RcodeNameError),
+			newReply(dns.RcodeSuccess, "93.184.216.34"),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !conflict {
+			t.Fatal("expected conflict")
+		}
+	})
+
+	t.Run("unparsable reply", func(t *testing.T) {
+		conflict, err := DNSRepliesConflict(
+			newReply(dns.RcodeSuccess, "93.184.216.34"),
+			[]byte{0xca, 0xfe},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !conflict {
+			t.Fatal("expected conflict")
+		}
+	})
+}
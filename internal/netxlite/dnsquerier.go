@@ -0,0 +1,146 @@
+package netxlite
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-cli/v3/internal/atomicx"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+// dnsQuerier contains the code shared by SerialResolver and
+// ParallelResolver for sending a single query using a transport
+// and decoding the corresponding reply.
+type dnsQuerier struct {
+	// decoder is the MANDATORY decoder to use.
+	decoder model.DNSDecoder
+
+	// encoder is the MANDATORY encoder to use.
+	encoder model.DNSEncoder
+
+	// numTimeouts is MANDATORY and counts the number of timeouts.
+	numTimeouts *atomicx.Int64
+
+	// options contains the OPTIONAL EDNS0 options to use.
+	options *model.DNSQueryOptions
+
+	// txp is the MANDATORY underlying DNS transport.
+	txp model.DNSTransport
+}
+
+// roundTrip sends a query for the given hostname and qtype
+// and returns the raw reply without retrying on failure.
+func (q *dnsQuerier) roundTrip(
+	ctx context.Context, hostname string, qtype uint16) ([]byte, error) {
+	querydata, err := dnsEncodeQuery(q.encoder, q.txp, q.options, hostname, qtype)
+	if err != nil {
+		return nil, err
+	}
+	return q.txp.RoundTrip(ctx, querydata)
+}
+
+// lookupHTTPS sends an HTTPS query for hostname.
+func (q *dnsQuerier) lookupHTTPS(ctx context.Context, hostname string) (*model.HTTPSSvc, error) {
+	replydata, err := q.roundTrip(ctx, hostname, dns.TypeHTTPS)
+	if err != nil {
+		return nil, err
+	}
+	return q.decoder.DecodeHTTPS(replydata)
+}
+
+// lookupSVCB sends an SVCB query for hostname.
+func (q *dnsQuerier) lookupSVCB(ctx context.Context, hostname string) (*model.HTTPSSvc, error) {
+	replydata, err := q.roundTrip(ctx, hostname, dns.TypeSVCB)
+	if err != nil {
+		return nil, err
+	}
+	return q.decoder.DecodeSVCB(replydata)
+}
+
+// lookupCNAME returns the CNAME chain of hostname. We send an A query
+// because recursive resolvers include the whole CNAME chain in the
+// answer to such a query, while they only include the first CNAME
+// record when answering to a CNAME query.
+func (q *dnsQuerier) lookupCNAME(ctx context.Context, hostname string) ([]string, error) {
+	replydata, err := q.roundTrip(ctx, hostname, dns.TypeA)
+	if err != nil {
+		return nil, err
+	}
+	return q.decoder.DecodeCNAME(replydata)
+}
+
+// lookupNS sends an NS query for hostname.
+func (q *dnsQuerier) lookupNS(ctx context.Context, hostname string) ([]*net.NS, error) {
+	replydata, err := q.roundTrip(ctx, hostname, dns.TypeNS)
+	if err != nil {
+		return nil, err
+	}
+	return q.decoder.DecodeNS(replydata)
+}
+
+// lookupMX sends an MX query for hostname.
+func (q *dnsQuerier) lookupMX(ctx context.Context, hostname string) ([]*net.MX, error) {
+	replydata, err := q.roundTrip(ctx, hostname, dns.TypeMX)
+	if err != nil {
+		return nil, err
+	}
+	return q.decoder.DecodeMX(replydata)
+}
+
+// lookupTXT sends a TXT query for hostname.
+func (q *dnsQuerier) lookupTXT(ctx context.Context, hostname string) ([]string, error) {
+	replydata, err := q.roundTrip(ctx, hostname, dns.TypeTXT)
+	if err != nil {
+		return nil, err
+	}
+	return q.decoder.DecodeTXT(replydata)
+}
+
+// lookupHostWithRetry issues a lookup host query for the specified
+// qtype (dns.A or dns.AAAA) and retries on timeout.
+func (q *dnsQuerier) lookupHostWithRetry(
+	ctx context.Context, hostname string, qtype uint16) ([]string, time.Duration, error) {
+	var (
+		errorslist []error
+		ttlslist   []time.Duration
+	)
+	for i := 0; i < 3; i++ {
+		replies, ttl, err := q.lookupHostWithoutRetry(ctx, hostname, qtype)
+		if err == nil {
+			return replies, ttl, nil
+		}
+		errorslist = append(errorslist, err)
+		ttlslist = append(ttlslist, ttl)
+		var operr *net.OpError
+		if !errors.As(err, &operr) || !operr.Timeout() {
+			// The first error is the one that is most likely to be caused
+			// by the network. Subsequent errors are more likely to be caused
+			// by context deadlines. So, the first error is attached to an
+			// operation, while subsequent errors may possibly not be. If
+			// so, the resulting failing operation is not correct.
+			break
+		}
+		q.numTimeouts.Add(1)
+	}
+	// bugfix: we MUST return one of the errors otherwise we confuse the
+	// mechanism in errwrap that classifies the root cause operation, since
+	// it would not be able to find a child with a major operation error
+	return nil, ttlslist[0], errorslist[0]
+}
+
+// lookupHostWithoutRetry issues a lookup host query for the specified
+// qtype (dns.A or dns.AAAA) without retrying on failure. The returned
+// TTL is zero when we did not receive a reply or we cannot decode it.
+func (q *dnsQuerier) lookupHostWithoutRetry(
+	ctx context.Context, hostname string, qtype uint16) ([]string, time.Duration, error) {
+	replydata, err := q.roundTrip(ctx, hostname, qtype)
+	if err != nil {
+		return nil, 0, err
+	}
+	ttl, _ := q.decoder.DecodeTTL(replydata)
+	addrs, err := q.decoder.DecodeLookupHost(qtype, replydata)
+	return addrs, ttl, err
+}
@@ -0,0 +1,152 @@
+package filtering
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+)
+
+// CA is a locally generated certification authority that TLSProxy
+// uses to issue certificates on the fly when performing a TLS
+// man-in-the-middle. Clients trusting this CA would not notice the
+// MITM. Clients not trusting it should fail with ssl_unknown_authority,
+// like it happens with national MITM roots not shipped by browsers.
+type CA struct {
+	// cert is the CA certificate.
+	cert *x509.Certificate
+
+	// key is the CA private key.
+	key crypto.Signer
+
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+
+	// cache maps a name to the certificate we issued for it.
+	cache map[string]*tls.Certificate
+
+	// timeNow is the function returning the current time.
+	timeNow func() time.Time
+}
+
+// NewCA creates a new CA with a freshly generated key.
+func NewCA() (*CA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(now.UnixNano()),
+		Subject: pkix.Name{
+			CommonName:   "jafar CA",
+			Organization: []string{"OONI"},
+		},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	ca := &CA{
+		cert:    cert,
+		key:     key,
+		cache:   map[string]*tls.Certificate{},
+		timeNow: time.Now,
+	}
+	return ca, nil
+}
+
+// Certificate returns the CA certificate.
+func (ca *CA) Certificate() *x509.Certificate {
+	return ca.cert
+}
+
+// CertificatePEM returns the PEM encoding of the CA certificate.
+func (ca *CA) CertificatePEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+}
+
+// CertPool returns a new x509.CertPool containing only this CA.
+func (ca *CA) CertPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+// NewCertificate returns a certificate for the given name signed by
+// this CA. We cache certificates, so calling this method again for
+// the same name returns the same certificate. The name can either be
+// a domain name or an IP address.
+func (ca *CA) NewCertificate(name string) (*tls.Certificate, error) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	if cert := ca.cache[name]; cert != nil {
+		return cert, nil
+	}
+	now := ca.timeNow()
+	cert, err := ca.issue(name, now.Add(-time.Hour), now.Add(24*time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	ca.cache[name] = cert
+	return cert, nil
+}
+
+// NewExpiredCertificate is like NewCertificate except that the
+// returned certificate has already expired. Clients should fail with
+// ssl_invalid_certificate regardless of whether they trust this CA.
+func (ca *CA) NewExpiredCertificate(name string) (*tls.Certificate, error) {
+	now := ca.timeNow()
+	return ca.issue(name, now.Add(-48*time.Hour), now.Add(-24*time.Hour))
+}
+
+// issue issues a certificate for name valid between notBefore and notAfter.
+func (ca *CA) issue(name string, notBefore, notAfter time.Time) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(name); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{name}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	if err != nil {
+		return nil, err
+	}
+	cert := &tls.Certificate{
+		Certificate: [][]byte{der, ca.cert.Raw},
+		PrivateKey:  key,
+	}
+	return cert, nil
+}
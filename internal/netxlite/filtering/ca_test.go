@@ -0,0 +1,99 @@
+package filtering
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+)
+
+func TestCA(t *testing.T) {
+	ca, err := NewCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verify := func(name string, leaf []byte) error {
+		cert, err := x509.ParseCertificate(leaf)
+		if err != nil {
+			return err
+		}
+		_, err = cert.Verify(x509.VerifyOptions{
+			DNSName: name,
+			Roots:   ca.CertPool(),
+		})
+		return err
+	}
+
+	t.Run("Certificate", func(t *testing.T) {
+		if !ca.Certificate().IsCA {
+			t.Fatal("expected a CA certificate")
+		}
+	})
+
+	t.Run("CertificatePEM", func(t *testing.T) {
+		block, _ := pem.Decode(ca.CertificatePEM())
+		if block == nil || block.Type != "CERTIFICATE" {
+			t.Fatal("cannot decode the PEM")
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cert.Equal(ca.Certificate()) {
+			t.Fatal("not the certificate we expected")
+		}
+	})
+
+	t.Run("NewCertificate", func(t *testing.T) {
+		t.Run("for a domain name", func(t *testing.T) {
+			cert, err := ca.NewCertificate("dns.google")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := verify("dns.google", cert.Certificate[0]); err != nil {
+				t.Fatal(err)
+			}
+			var hostnameErr x509.HostnameError
+			if err := verify("example.com", cert.Certificate[0]); !errors.As(err, &hostnameErr) {
+				t.Fatal("not the error we expected", err)
+			}
+		})
+
+		t.Run("for an IP address", func(t *testing.T) {
+			cert, err := ca.NewCertificate("8.8.8.8")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := verify("8.8.8.8", cert.Certificate[0]); err != nil {
+				t.Fatal(err)
+			}
+		})
+
+		t.Run("we cache the certificates", func(t *testing.T) {
+			first, err := ca.NewCertificate("example.org")
+			if err != nil {
+				t.Fatal(err)
+			}
+			second, err := ca.NewCertificate("example.org")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if first != second {
+				t.Fatal("expected the same certificate")
+			}
+		})
+	})
+
+	t.Run("NewExpiredCertificate", func(t *testing.T) {
+		cert, err := ca.NewExpiredCertificate("dns.google")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var invalidErr x509.CertificateInvalidError
+		err = verify("dns.google", cert.Certificate[0])
+		if !errors.As(err, &invalidErr) || invalidErr.Reason != x509.Expired {
+			t.Fatal("not the error we expected", err)
+		}
+	})
+}
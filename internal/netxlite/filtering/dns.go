@@ -2,13 +2,17 @@ package filtering
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
 	"io"
 	"net"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/miekg/dns"
+	"github.com/ooni/probe-cli/v3/internal/multierror"
 	"github.com/ooni/probe-cli/v3/internal/netxlite"
 	"github.com/ooni/probe-cli/v3/internal/runtimex"
 )
@@ -38,8 +42,48 @@ const (
 	// DNSActionCache causes the proxy to check the cache. If there
 	// are entries, they are returned. Otherwise, NXDOMAIN is returned.
 	DNSActionCache = DNSAction("cache")
+
+	// DNSActionBogon replies with the Addrs of the domain's
+	// DNSActionParams or, if there are no Addrs, with `10.10.34.35`,
+	// which is the private address used by Iran's blockpage.
+	DNSActionBogon = DNSAction("bogon")
+
+	// DNSActionCNAME replies with a CNAME pointing to the CNAME of the
+	// domain's DNSActionParams (e.g., a blockpage host) along with the
+	// records of such a CNAME built using the Addrs of the params. If
+	// the params do not contain any CNAME, this action replies with
+	// SERVFAIL, like a misconfigured DNS server would do.
+	DNSActionCNAME = DNSAction("cname")
+
+	// DNSActionServFail replies with SERVFAIL.
+	DNSActionServFail = DNSAction("servfail")
+
+	// DNSActionTruncated replies over UDP with an empty reply having the
+	// truncated bit set, so that the client should retry using TCP. Over
+	// TCP this action behaves like DNSActionPass.
+	DNSActionTruncated = DNSAction("truncated")
+
+	// DNSActionDelay waits for the DelayMilliseconds of the domain's
+	// DNSActionParams and then behaves like DNSActionPass.
+	DNSActionDelay = DNSAction("delay")
 )
 
+// DNSActionParams contains the parameters of DNS actions.
+type DNSActionParams struct {
+	// Addrs contains the addresses for DNSActionBogon and DNSActionCNAME.
+	Addrs []string
+
+	// CNAME is the canonical name for DNSActionCNAME. Note that this
+	// name will be canonicalized when building the reply.
+	CNAME string
+
+	// DelayMilliseconds is the delay for DNSActionDelay.
+	DelayMilliseconds int64
+}
+
+// dnsDefaultBogon is the address returned by DNSActionBogon by default.
+const dnsDefaultBogon = "10.10.34.35"
+
 // DNSProxy is a DNS proxy that routes traffic to an upstream
 // resolver and may implement filtering policies.
 type DNSProxy struct {
@@ -51,6 +95,10 @@ type DNSProxy struct {
 	// receive a query for the given domain.
 	OnQuery func(domain string) DNSAction
 
+	// Params contains the OPTIONAL parameters of the actions. Note that
+	// the keys of the map must be FQDNs (i.e., including the final `.`).
+	Params map[string]*DNSActionParams
+
 	// Upstream is the OPTIONAL upstream transport.
 	Upstream DNSTransport
 
@@ -70,29 +118,155 @@ type DNSListener interface {
 	LocalAddr() net.Addr
 }
 
-// Start starts the proxy.
+// Start starts the proxy. The proxy listens for UDP queries on the
+// given address and for TCP queries on the same address and port.
 func (p *DNSProxy) Start(address string) (DNSListener, error) {
-	pconn, _, err := p.start(address)
-	return pconn, err
+	listener, _, err := p.start(address)
+	return listener, err
 }
 
 func (p *DNSProxy) start(address string) (DNSListener, <-chan interface{}, error) {
-	pconn, err := net.ListenPacket("udp", address)
+	pconn, tcpListener, err := dnsListen(address)
 	if err != nil {
 		return nil, nil, err
 	}
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+	go p.mainloop(pconn, wg)
+	go p.mainloopTCP(tcpListener, wg)
 	done := make(chan interface{})
-	go p.mainloop(pconn, done)
-	return pconn, done, nil
+	go func() {
+		defer close(done)
+		wg.Wait()
+	}()
+	return &dnsListener{PacketConn: pconn, tcpListener: tcpListener}, done, nil
+}
+
+// dnsListenAttempts is the number of times we try to bind the same
+// port for UDP and TCP when the caller asks for an ephemeral port.
+const dnsListenAttempts = 10
+
+// dnsListen listens for UDP and TCP on the same address and port. When
+// the port is zero, the kernel chooses the UDP port, which may be already
+// in use for TCP, so we retry with another port in such a case.
+func dnsListen(address string) (net.PacketConn, net.Listener, error) {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, nil, err
+	}
+	for attempt := 1; ; attempt++ {
+		pconn, err := net.ListenPacket("udp", address)
+		if err != nil {
+			return nil, nil, err
+		}
+		tcpListener, err := net.Listen("tcp", pconn.LocalAddr().String())
+		if err == nil {
+			return pconn, tcpListener, nil
+		}
+		pconn.Close()
+		if port != "0" || attempt >= dnsListenAttempts || !errors.Is(err, netxlite.EADDRINUSE) {
+			return nil, nil, err
+		}
+	}
+}
+
+// dnsListener is the DNSListener returned by DNSProxy.Start.
+type dnsListener struct {
+	net.PacketConn
+	tcpListener net.Listener
 }
 
-func (p *DNSProxy) mainloop(pconn net.PacketConn, done chan<- interface{}) {
-	defer close(done)
+// ErrCloseDNSListener indicates that we could not close
+// the UDP listener, the TCP listener, or both.
+var ErrCloseDNSListener = errors.New("filtering: cannot close the DNS listener")
+
+// Close closes both the UDP and the TCP listeners. On failure, it returns
+// a multierror.Union wrapping ErrCloseDNSListener and the close errors.
+func (l *dnsListener) Close() error {
+	union := multierror.New(ErrCloseDNSListener)
+	if err := l.tcpListener.Close(); err != nil {
+		union.AddWithPrefix("tcp", err)
+	}
+	if err := l.PacketConn.Close(); err != nil {
+		union.AddWithPrefix("udp", err)
+	}
+	if len(union.Children) > 0 {
+		return union
+	}
+	return nil
+}
+
+func (p *DNSProxy) mainloop(pconn net.PacketConn, wg *sync.WaitGroup) {
+	defer wg.Done()
 	for p.oneloop(pconn) {
 		// nothing
 	}
 }
 
+// mainloopTCP accepts and serves DNS-over-TCP connections until the
+// listener is closed. When Accept fails for other reasons (e.g., because
+// we ran out of file descriptors), we wait before trying again, using an
+// exponential backoff, to avoid spinning in a tight loop.
+func (p *DNSProxy) mainloopTCP(listener net.Listener, wg *sync.WaitGroup) {
+	defer wg.Done()
+	var delay time.Duration
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			delay = dnsProxyAcceptBackoff(delay)
+			time.Sleep(delay)
+			continue
+		}
+		delay = 0
+		go p.serveTCP(conn)
+	}
+}
+
+// dnsProxyAcceptBackoff returns the delay to wait for after a failed
+// Accept given the previous delay, which is zero after a success.
+func dnsProxyAcceptBackoff(delay time.Duration) time.Duration {
+	const (
+		minDelay = 5 * time.Millisecond
+		maxDelay = time.Second
+	)
+	switch {
+	case delay <= 0:
+		return minDelay
+	case 2*delay > maxDelay:
+		return maxDelay
+	default:
+		return 2 * delay
+	}
+}
+
+// serveTCP serves the DNS-over-TCP queries sent using conn. When
+// we cannot reply to a query, we keep reading the next queries.
+func (p *DNSProxy) serveTCP(conn net.Conn) {
+	defer conn.Close()
+	for {
+		header := make([]byte, 2)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		buffer := make([]byte, binary.BigEndian.Uint16(header))
+		if _, err := io.ReadFull(conn, buffer); err != nil {
+			return
+		}
+		replyBytes, err := p.serve(buffer, "tcp")
+		if err != nil {
+			continue
+		}
+		header = make([]byte, 2)
+		binary.BigEndian.PutUint16(header, uint16(len(replyBytes)))
+		if _, err := conn.Write(append(header, replyBytes...)); err != nil {
+			return
+		}
+	}
+}
+
 func (p *DNSProxy) oneloop(pconn net.PacketConn) bool {
 	buffer := make([]byte, 1<<12)
 	count, addr, err := pconn.ReadFrom(buffer)
@@ -105,29 +279,35 @@ func (p *DNSProxy) oneloop(pconn net.PacketConn) bool {
 }
 
 func (p *DNSProxy) serveAsync(pconn net.PacketConn, addr net.Addr, buffer []byte) {
-	query := &dns.Msg{}
-	if err := query.Unpack(buffer); err != nil {
-		return
-	}
-	reply, err := p.reply(query)
+	replyBytes, err := p.serve(buffer, "udp")
 	if err != nil {
 		return
 	}
-	replyBytes, err := reply.Pack()
+	pconn.WriteTo(replyBytes, addr)
+}
+
+// serve returns the serialized reply to the serialized query
+// received using the given network ("udp" or "tcp").
+func (p *DNSProxy) serve(buffer []byte, network string) ([]byte, error) {
+	query := &dns.Msg{}
+	if err := query.Unpack(buffer); err != nil {
+		return nil, err
+	}
+	reply, err := p.reply(query, network)
 	if err != nil {
-		return
+		return nil, err
 	}
-	pconn.WriteTo(replyBytes, addr)
+	return reply.Pack()
 }
 
-func (p *DNSProxy) reply(query *dns.Msg) (*dns.Msg, error) {
+func (p *DNSProxy) reply(query *dns.Msg, network string) (*dns.Msg, error) {
 	if p.mockableReply != nil {
 		return p.mockableReply(query)
 	}
-	return p.replyDefault(query)
+	return p.replyDefault(query, network)
 }
 
-func (p *DNSProxy) replyDefault(query *dns.Msg) (*dns.Msg, error) {
+func (p *DNSProxy) replyDefault(query *dns.Msg, network string) (*dns.Msg, error) {
 	if len(query.Question) != 1 {
 		return nil, errors.New("unhandled message")
 	}
@@ -145,11 +325,34 @@ func (p *DNSProxy) replyDefault(query *dns.Msg) (*dns.Msg, error) {
 		return nil, errors.New("let's ignore this query")
 	case DNSActionCache:
 		return p.cache(name, query), nil
+	case DNSActionBogon:
+		return p.bogon(name, query), nil
+	case DNSActionCNAME:
+		return p.cname(name, query), nil
+	case DNSActionServFail:
+		return p.servfail(query), nil
+	case DNSActionTruncated:
+		if network == "tcp" {
+			return p.proxy(query)
+		}
+		return p.truncated(query), nil
+	case DNSActionDelay:
+		time.Sleep(time.Duration(p.params(name).DelayMilliseconds) * time.Millisecond)
+		return p.proxy(query)
 	default:
 		return p.refused(query), nil
 	}
 }
 
+// params returns the params for the given domain. If there
+// are no params, this function returns empty params.
+func (p *DNSProxy) params(name string) *DNSActionParams {
+	if params := p.Params[name]; params != nil {
+		return params
+	}
+	return &DNSActionParams{}
+}
+
 func (p *DNSProxy) refused(query *dns.Msg) *dns.Msg {
 	m := new(dns.Msg)
 	m.SetRcode(query, dns.RcodeRefused)
@@ -162,6 +365,57 @@ func (p *DNSProxy) nxdomain(query *dns.Msg) *dns.Msg {
 	return m
 }
 
+func (p *DNSProxy) servfail(query *dns.Msg) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetRcode(query, dns.RcodeServerFailure)
+	return m
+}
+
+func (p *DNSProxy) truncated(query *dns.Msg) *dns.Msg {
+	m := p.empty(query)
+	m.Truncated = true
+	return m
+}
+
+func (p *DNSProxy) bogon(name string, query *dns.Msg) *dns.Msg {
+	addrs := p.params(name).Addrs
+	if len(addrs) <= 0 {
+		addrs = []string{dnsDefaultBogon}
+	}
+	return p.compose(query, dnsParseIPs(addrs)...)
+}
+
+func (p *DNSProxy) cname(name string, query *dns.Msg) *dns.Msg {
+	params := p.params(name)
+	if params.CNAME == "" {
+		return p.servfail(query)
+	}
+	target := dns.CanonicalName(params.CNAME)
+	reply := p.composeForName(query, target, dnsParseIPs(params.Addrs)...)
+	cname := &dns.CNAME{
+		Hdr: dns.RR_Header{
+			Name:   name,
+			Rrtype: dns.TypeCNAME,
+			Class:  dns.ClassINET,
+			Ttl:    0,
+		},
+		Target: target,
+	}
+	reply.Answer = append([]dns.RR{cname}, reply.Answer...)
+	return reply
+}
+
+// dnsParseIPs converts addrs to a list of IPs, ignoring
+// the entries that are not valid IP addresses.
+func dnsParseIPs(addrs []string) (out []net.IP) {
+	for _, addr := range addrs {
+		if ip := net.ParseIP(addr); ip != nil {
+			out = append(out, ip)
+		}
+	}
+	return
+}
+
 func (p *DNSProxy) localHost(query *dns.Msg) *dns.Msg {
 	return p.compose(query, net.IPv6loopback, net.IPv4(127, 0, 0, 1))
 }
@@ -171,6 +425,13 @@ func (p *DNSProxy) empty(query *dns.Msg) *dns.Msg {
 }
 
 func (p *DNSProxy) compose(query *dns.Msg, ips ...net.IP) *dns.Msg {
+	runtimex.PanicIfTrue(len(query.Question) != 1, "expecting a single question")
+	return p.composeForName(query, query.Question[0].Name, ips...)
+}
+
+// composeForName is like compose but the records we add
+// to the reply refer to the given name.
+func (p *DNSProxy) composeForName(query *dns.Msg, name string, ips ...net.IP) *dns.Msg {
 	runtimex.PanicIfTrue(len(query.Question) != 1, "expecting a single question")
 	question := query.Question[0]
 	reply := new(dns.Msg)
@@ -182,7 +443,7 @@ func (p *DNSProxy) compose(query *dns.Msg, ips ...net.IP) *dns.Msg {
 		if !isIPv6 && question.Qtype == dns.TypeA {
 			reply.Answer = append(reply.Answer, &dns.A{
 				Hdr: dns.RR_Header{
-					Name:   question.Name,
+					Name:   name,
 					Rrtype: dns.TypeA,
 					Class:  dns.ClassINET,
 					Ttl:    0,
@@ -192,7 +453,7 @@ func (p *DNSProxy) compose(query *dns.Msg, ips ...net.IP) *dns.Msg {
 		} else if isIPv6 && question.Qtype == dns.TypeAAAA {
 			reply.Answer = append(reply.Answer, &dns.AAAA{
 				Hdr: dns.RR_Header{
-					Name:   question.Name,
+					Name:   name,
 					Rrtype: dns.TypeAAAA,
 					Class:  dns.ClassINET,
 					Ttl:    0,
@@ -224,13 +485,7 @@ func (p *DNSProxy) proxy(query *dns.Msg) (*dns.Msg, error) {
 }
 
 func (p *DNSProxy) cache(name string, query *dns.Msg) *dns.Msg {
-	addrs := p.Cache[name]
-	var ipAddrs []net.IP
-	for _, addr := range addrs {
-		if ip := net.ParseIP(addr); ip != nil {
-			ipAddrs = append(ipAddrs, ip)
-		}
-	}
+	ipAddrs := dnsParseIPs(p.Cache[name])
 	if len(ipAddrs) <= 0 {
 		return p.nxdomain(query)
 	}
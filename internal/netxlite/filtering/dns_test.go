@@ -3,15 +3,19 @@ package filtering
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/apex/log"
+	"github.com/google/go-cmp/cmp"
 	"github.com/miekg/dns"
 	"github.com/ooni/probe-cli/v3/internal/model"
 	"github.com/ooni/probe-cli/v3/internal/model/mocks"
+	"github.com/ooni/probe-cli/v3/internal/multierror"
 	"github.com/ooni/probe-cli/v3/internal/netxlite"
 )
 
@@ -30,6 +34,18 @@ func TestDNSProxy(t *testing.T) {
 		return newProxyWithCache(action, nil)
 	}
 
+	newProxyWithParams := func(action DNSAction, params *DNSActionParams) (DNSListener, <-chan interface{}, error) {
+		p := &DNSProxy{
+			OnQuery: func(domain string) DNSAction {
+				return action
+			},
+			Params: map[string]*DNSActionParams{
+				"dns.google.": params,
+			},
+		}
+		return p.start("127.0.0.1:0")
+	}
+
 	newresolver := func(listener DNSListener) model.Resolver {
 		dlr := netxlite.NewDialerWithoutResolver(log.Log)
 		r := netxlite.NewResolverUDP(log.Log, dlr, listener.LocalAddr().String())
@@ -209,6 +225,201 @@ func TestDNSProxy(t *testing.T) {
 		<-done // wait for background goroutine to exit
 	})
 
+	t.Run("DNSActionBogon without params", func(t *testing.T) {
+		ctx := context.Background()
+		listener, done, err := newProxy(DNSActionBogon)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := newresolver(listener)
+		addrs, err := r.LookupHost(ctx, "dns.google")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != 1 || addrs[0] != "10.10.34.35" {
+			t.Fatal("unexpected addrs", addrs)
+		}
+		if !netxlite.IsBogon(addrs[0]) {
+			t.Fatal("expected a bogon")
+		}
+		listener.Close()
+		<-done // wait for background goroutine to exit
+	})
+
+	t.Run("DNSActionBogon with params", func(t *testing.T) {
+		ctx := context.Background()
+		params := &DNSActionParams{Addrs: []string{"192.168.1.1", "fc00::1"}}
+		listener, done, err := newProxyWithParams(DNSActionBogon, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := newresolver(listener)
+		addrs, err := r.LookupHost(ctx, "dns.google")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != 2 {
+			t.Fatal("expected two entries", addrs)
+		}
+		for _, addr := range addrs {
+			if addr != "192.168.1.1" && addr != "fc00::1" {
+				t.Fatal("unexpected addr", addr)
+			}
+		}
+		listener.Close()
+		<-done // wait for background goroutine to exit
+	})
+
+	t.Run("DNSActionCNAME without params", func(t *testing.T) {
+		ctx := context.Background()
+		listener, done, err := newProxy(DNSActionCNAME)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := newresolver(listener)
+		addrs, err := r.LookupHost(ctx, "dns.google")
+		if err == nil || err.Error() != netxlite.FailureDNSServerMisbehaving {
+			t.Fatal("unexpected err", err)
+		}
+		if addrs != nil {
+			t.Fatal("expected empty addrs")
+		}
+		listener.Close()
+		<-done // wait for background goroutine to exit
+	})
+
+	t.Run("DNSActionCNAME with params", func(t *testing.T) {
+		ctx := context.Background()
+		params := &DNSActionParams{
+			Addrs: []string{"93.184.216.34"},
+			CNAME: "blockpage.example.com",
+		}
+		listener, done, err := newProxyWithParams(DNSActionCNAME, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := newresolver(listener)
+		addrs, err := r.LookupHost(ctx, "dns.google")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != 1 || addrs[0] != "93.184.216.34" {
+			t.Fatal("unexpected addrs", addrs)
+		}
+		listener.Close()
+		<-done // wait for background goroutine to exit
+	})
+
+	t.Run("DNSActionServFail", func(t *testing.T) {
+		ctx := context.Background()
+		listener, done, err := newProxy(DNSActionServFail)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := newresolver(listener)
+		addrs, err := r.LookupHost(ctx, "dns.google")
+		if err == nil || err.Error() != netxlite.FailureDNSServerMisbehaving {
+			t.Fatal("unexpected err", err)
+		}
+		if addrs != nil {
+			t.Fatal("expected empty addrs")
+		}
+		listener.Close()
+		<-done // wait for background goroutine to exit
+	})
+
+	t.Run("DNSActionTruncated", func(t *testing.T) {
+		t.Run("over UDP", func(t *testing.T) {
+			p := &DNSProxy{
+				OnQuery: func(domain string) DNSAction {
+					return DNSActionTruncated
+				},
+			}
+			query := &dns.Msg{}
+			query.SetQuestion("dns.google.", dns.TypeA)
+			reply, err := p.replyDefault(query, "udp")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reply.Truncated {
+				t.Fatal("expected the truncated bit")
+			}
+			if len(reply.Answer) != 0 {
+				t.Fatal("expected no answers")
+			}
+		})
+
+		t.Run("over TCP", func(t *testing.T) {
+			ctx := context.Background()
+			p := &DNSProxy{
+				OnQuery: func(domain string) DNSAction {
+					return DNSActionTruncated
+				},
+				Upstream: &mocks.DNSTransport{
+					MockRoundTrip: func(ctx context.Context, rawQuery []byte) ([]byte, error) {
+						query := &dns.Msg{}
+						if err := query.Unpack(rawQuery); err != nil {
+							return nil, err
+						}
+						var p DNSProxy
+						return p.compose(query, net.IPv4(8, 8, 8, 8)).Pack()
+					},
+					MockCloseIdleConnections: func() {},
+				},
+			}
+			listener, done, err := p.start("127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			dlr := netxlite.NewDialerWithoutResolver(log.Log)
+			txp := netxlite.NewDNSOverTCP(dlr.DialContext, listener.LocalAddr().String())
+			r := netxlite.WrapResolver(log.Log, netxlite.NewSerialResolver(txp))
+			addrs, err := r.LookupHost(ctx, "dns.google")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var found bool
+			for _, addr := range addrs {
+				found = found || addr == "8.8.8.8"
+			}
+			if !found {
+				t.Fatal("did not find 8.8.8.8")
+			}
+			listener.Close()
+			<-done // wait for background goroutine to exit
+		})
+	})
+
+	t.Run("DNSActionDelay", func(t *testing.T) {
+		p := &DNSProxy{
+			OnQuery: func(domain string) DNSAction {
+				return DNSActionDelay
+			},
+			Params: map[string]*DNSActionParams{
+				"dns.google.": {DelayMilliseconds: 100},
+			},
+			Upstream: &mocks.DNSTransport{
+				MockRoundTrip: func(ctx context.Context, query []byte) ([]byte, error) {
+					return nil, errors.New("mocked error")
+				},
+				MockCloseIdleConnections: func() {},
+			},
+		}
+		query := &dns.Msg{}
+		query.SetQuestion("dns.google.", dns.TypeA)
+		t0 := time.Now()
+		reply, err := p.replyDefault(query, "udp")
+		if err == nil || err.Error() != "mocked error" {
+			t.Fatal("unexpected err", err)
+		}
+		if reply != nil {
+			t.Fatal("expected nil reply")
+		}
+		if elapsed := time.Since(t0); elapsed < 100*time.Millisecond {
+			t.Fatal("we did not sleep enough", elapsed)
+		}
+	})
+
 	t.Run("Start with invalid address", func(t *testing.T) {
 		p := &DNSProxy{}
 		listener, err := p.Start("127.0.0.1")
@@ -324,6 +535,62 @@ func TestDNSProxy(t *testing.T) {
 		})
 	})
 
+	t.Run("mainloopTCP", func(t *testing.T) {
+		t.Run("stops when the listener is closed", func(t *testing.T) {
+			p := &DNSProxy{}
+			listener := &mocks.Listener{
+				MockAccept: func() (net.Conn, error) {
+					return nil, fmt.Errorf("accept tcp: %w", net.ErrClosed)
+				},
+			}
+			wg := &sync.WaitGroup{}
+			wg.Add(1)
+			p.mainloopTCP(listener, wg)
+			wg.Wait()
+		})
+
+		t.Run("backs off after other Accept failures", func(t *testing.T) {
+			p := &DNSProxy{}
+			var count int
+			listener := &mocks.Listener{
+				MockAccept: func() (net.Conn, error) {
+					count++
+					if count < 3 {
+						return nil, errors.New("mocked error")
+					}
+					return nil, net.ErrClosed
+				},
+			}
+			wg := &sync.WaitGroup{}
+			wg.Add(1)
+			t0 := time.Now()
+			p.mainloopTCP(listener, wg)
+			if elapsed := time.Since(t0); elapsed < 15*time.Millisecond {
+				t.Fatal("we did not back off", elapsed)
+			}
+			if count != 3 {
+				t.Fatal("unexpected number of Accept calls", count)
+			}
+		})
+	})
+
+	t.Run("dnsProxyAcceptBackoff", func(t *testing.T) {
+		var delays []time.Duration
+		var delay time.Duration
+		for i := 0; i < 10; i++ {
+			delay = dnsProxyAcceptBackoff(delay)
+			delays = append(delays, delay)
+		}
+		expect := []time.Duration{
+			5 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond,
+			40 * time.Millisecond, 80 * time.Millisecond, 160 * time.Millisecond,
+			320 * time.Millisecond, 640 * time.Millisecond, time.Second, time.Second,
+		}
+		if diff := cmp.Diff(expect, delays); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
 	t.Run("proxy", func(t *testing.T) {
 		t.Run("Pack fails", func(t *testing.T) {
 			p := &DNSProxy{}
@@ -376,3 +643,57 @@ func TestDNSProxy(t *testing.T) {
 		})
 	})
 }
+
+func TestDNSListen(t *testing.T) {
+	t.Run("with an invalid address", func(t *testing.T) {
+		pconn, listener, err := dnsListen("127.0.0.1")
+		if err == nil || !strings.HasSuffix(err.Error(), "missing port in address") {
+			t.Fatal("unexpected err", err)
+		}
+		if pconn != nil || listener != nil {
+			t.Fatal("expected nil pconn and listener")
+		}
+	})
+
+	t.Run("when the TCP port is already in use", func(t *testing.T) {
+		busy, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer busy.Close()
+		pconn, listener, err := dnsListen(busy.Addr().String())
+		if !errors.Is(err, netxlite.EADDRINUSE) {
+			t.Fatal("unexpected err", err)
+		}
+		if pconn != nil || listener != nil {
+			t.Fatal("expected nil pconn and listener")
+		}
+	})
+}
+
+func TestDNSListenerClose(t *testing.T) {
+	t.Run("when both closes fail", func(t *testing.T) {
+		pconn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		pconn.Close() // so closing it again fails
+		expected := errors.New("mocked error")
+		listener := &dnsListener{
+			PacketConn: pconn,
+			tcpListener: &mocks.Listener{
+				MockClose: func() error {
+					return expected
+				},
+			},
+		}
+		err = listener.Close()
+		if !errors.Is(err, ErrCloseDNSListener) || !errors.Is(err, expected) {
+			t.Fatal("unexpected err", err)
+		}
+		var union *multierror.Union
+		if !errors.As(err, &union) || len(union.Children) != 2 {
+			t.Fatal("expected two child errors", err)
+		}
+	})
+}
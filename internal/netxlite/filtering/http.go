@@ -1,6 +1,7 @@
 package filtering
 
 import (
+	"io"
 	"net"
 	"net/http"
 	"net/http/httputil"
@@ -27,14 +28,64 @@ const (
 
 	// HTTPAction451 causes the proxy to return a 451 error.
 	HTTPAction451 = HTTPAction("451")
+
+	// HTTPAction200 causes the proxy to return a blockpage with
+	// status 200. The blockpage is the Blockpage of the host's
+	// HTTPActionParams or, if empty, a default blockpage.
+	HTTPAction200 = HTTPAction("200")
+
+	// HTTPAction302 causes the proxy to redirect to the Location
+	// of the host's HTTPActionParams. If the Location is empty, the
+	// proxy returns a 500 error, like it happens for unknown actions.
+	HTTPAction302 = HTTPAction("302")
+
+	// HTTPActionInjectHeaders passes the traffic to the destination
+	// and adds the Headers of the host's HTTPActionParams to the response.
+	HTTPActionInjectHeaders = HTTPAction("inject-headers")
+
+	// HTTPActionStripHeaders passes the traffic to the destination
+	// and removes the StripHeaders of the host's HTTPActionParams
+	// from the response.
+	HTTPActionStripHeaders = HTTPAction("strip-headers")
+
+	// HTTPActionTruncate passes the traffic to the destination and
+	// only returns the first TruncateBytes bytes of the response body
+	// according to the host's HTTPActionParams.
+	HTTPActionTruncate = HTTPAction("truncate")
 )
 
+// HTTPActionParams contains the parameters of HTTP actions.
+type HTTPActionParams struct {
+	// Blockpage is the HTML body for HTTPAction200.
+	Blockpage string
+
+	// Headers contains the headers for HTTPActionInjectHeaders.
+	Headers map[string]string
+
+	// Location is the redirect URL for HTTPAction302.
+	Location string
+
+	// StripHeaders contains the headers for HTTPActionStripHeaders.
+	StripHeaders []string
+
+	// TruncateBytes is the body length for HTTPActionTruncate.
+	TruncateBytes int64
+}
+
 // HTTPProxy is a proxy that routes traffic depending on the
 // host header and may implement filtering policies.
 type HTTPProxy struct {
 	// OnIncomingHost is the MANDATORY hook called whenever we have
 	// successfully received an HTTP request.
 	OnIncomingHost func(host string) HTTPAction
+
+	// Params contains the OPTIONAL parameters of the actions
+	// indexed by the value of the host header.
+	Params map[string]*HTTPActionParams
+
+	// Transport is the OPTIONAL transport used to forward the
+	// requests. If nil, we use http.DefaultTransport.
+	Transport http.RoundTripper
 }
 
 // Start starts the proxy.
@@ -56,6 +107,14 @@ var httpBlockpage451 = []byte(`<html><head>
 </body></html>
 `)
 
+var httpBlockpage200 = []byte(`<html><head>
+  <title>Access Denied</title>
+</head><body>
+  <center><h1>Access Denied</h1></center>
+  <p>Access to this website has been blocked.</p>
+</body></html>
+`)
+
 const httpProxyProduct = "jafar/0.1.0"
 
 // ServeHTTP serves HTTP requests
@@ -78,11 +137,46 @@ func (p *HTTPProxy) handle(w http.ResponseWriter, r *http.Request) {
 	case HTTPAction451:
 		w.WriteHeader(http.StatusUnavailableForLegalReasons)
 		w.Write(httpBlockpage451)
+	case HTTPAction200:
+		p.blockpage(w, r)
+	case HTTPAction302:
+		p.redirect(w, r)
+	case HTTPActionInjectHeaders, HTTPActionStripHeaders, HTTPActionTruncate:
+		p.proxyAndModify(w, r, policy)
 	default:
 		w.WriteHeader(http.StatusInternalServerError)
 	}
 }
 
+// params returns the params for the given host. If there
+// are no params, this function returns empty params.
+func (p *HTTPProxy) params(host string) *HTTPActionParams {
+	if params := p.Params[host]; params != nil {
+		return params
+	}
+	return &HTTPActionParams{}
+}
+
+func (p *HTTPProxy) blockpage(w http.ResponseWriter, r *http.Request) {
+	body := httpBlockpage200
+	if blockpage := p.params(r.Host).Blockpage; blockpage != "" {
+		body = []byte(blockpage)
+	}
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+func (p *HTTPProxy) redirect(w http.ResponseWriter, r *http.Request) {
+	location := p.params(r.Host).Location
+	if location == "" {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Location", location)
+	w.WriteHeader(http.StatusFound)
+}
+
 func (p *HTTPProxy) hijack(w http.ResponseWriter, r *http.Request, policy HTTPAction) {
 	// Note:
 	//
@@ -106,11 +200,50 @@ func (p *HTTPProxy) hijack(w http.ResponseWriter, r *http.Request, policy HTTPAc
 }
 
 func (p *HTTPProxy) proxy(w http.ResponseWriter, r *http.Request) {
+	p.newReverseProxy(r).ServeHTTP(w, r)
+}
+
+func (p *HTTPProxy) newReverseProxy(r *http.Request) *httputil.ReverseProxy {
 	r.Header.Add("Via", httpProxyProduct) // see ServeHTTP
 	proxy := httputil.NewSingleHostReverseProxy(&url.URL{
 		Host:   r.Host,
 		Scheme: "http",
 	})
-	proxy.Transport = http.DefaultTransport
+	proxy.Transport = p.Transport
+	if proxy.Transport == nil {
+		proxy.Transport = http.DefaultTransport
+	}
+	return proxy
+}
+
+func (p *HTTPProxy) proxyAndModify(w http.ResponseWriter, r *http.Request, policy HTTPAction) {
+	params := p.params(r.Host)
+	proxy := p.newReverseProxy(r)
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		switch policy {
+		case HTTPActionInjectHeaders:
+			for key, value := range params.Headers {
+				resp.Header.Set(key, value)
+			}
+		case HTTPActionStripHeaders:
+			for _, key := range params.StripHeaders {
+				resp.Header.Del(key)
+			}
+		case HTTPActionTruncate:
+			resp.Body = &httpTruncatedBody{
+				Reader: io.LimitReader(resp.Body, params.TruncateBytes),
+				Closer: resp.Body,
+			}
+			resp.ContentLength = -1 // we don't know the new length
+			resp.Header.Del("Content-Length")
+		}
+		return nil
+	}
 	proxy.ServeHTTP(w, r)
 }
+
+// httpTruncatedBody is the body returned by HTTPActionTruncate.
+type httpTruncatedBody struct {
+	io.Reader
+	io.Closer
+}
@@ -5,12 +5,14 @@ import (
 	"errors"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/apex/log"
+	"github.com/google/go-cmp/cmp"
 	"github.com/ooni/probe-cli/v3/internal/netxlite"
 	"github.com/ooni/probe-cli/v3/internal/runtimex"
 )
@@ -25,6 +27,27 @@ func TestHTTPProxy(t *testing.T) {
 		return p.Start("127.0.0.1:0")
 	}
 
+	newproxyWithParams := func(action HTTPAction, host string, params *HTTPActionParams) (net.Listener, error) {
+		p := &HTTPProxy{
+			OnIncomingHost: func(host string) HTTPAction {
+				return action
+			},
+			Params: map[string]*HTTPActionParams{
+				host: params,
+			},
+		}
+		return p.Start("127.0.0.1:0")
+	}
+
+	// newserver returns a local server used as the destination.
+	newserver := func() *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("X-Server", "antani")
+			w.Write([]byte("0123456789"))
+		}))
+	}
+
 	httpGET := func(ctx context.Context, addr net.Addr, host string) (*http.Response, error) {
 		txp := netxlite.NewHTTPTransportStdlib(log.Log)
 		clnt := &http.Client{Transport: txp}
@@ -140,6 +163,200 @@ func TestHTTPProxy(t *testing.T) {
 		listener.Close()
 	})
 
+	t.Run("HTTPAction200", func(t *testing.T) {
+		t.Run("with the default blockpage", func(t *testing.T) {
+			ctx := context.Background()
+			listener, err := newproxy(HTTPAction200)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := httpGET(ctx, listener.Addr(), "nexa.polito.it")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != 200 {
+				t.Fatal("unexpected status code", resp.StatusCode)
+			}
+			data, err := netxlite.ReadAllContext(ctx, resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(httpBlockpage200, data); diff != "" {
+				t.Fatal(diff)
+			}
+			resp.Body.Close()
+			listener.Close()
+		})
+
+		t.Run("with a custom blockpage", func(t *testing.T) {
+			ctx := context.Background()
+			const blockpage = "<html><head><title>Blocked</title></head></html>"
+			listener, err := newproxyWithParams(HTTPAction200, "nexa.polito.it", &HTTPActionParams{
+				Blockpage: blockpage,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := httpGET(ctx, listener.Addr(), "nexa.polito.it")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != 200 {
+				t.Fatal("unexpected status code", resp.StatusCode)
+			}
+			data, err := netxlite.ReadAllContext(ctx, resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != blockpage {
+				t.Fatal("unexpected body", string(data))
+			}
+			resp.Body.Close()
+			listener.Close()
+		})
+	})
+
+	t.Run("HTTPAction302", func(t *testing.T) {
+		// httpGETNoRedirect is like httpGET but does not follow redirects.
+		httpGETNoRedirect := func(ctx context.Context, addr net.Addr, host string) (*http.Response, error) {
+			clnt := &http.Client{
+				CheckRedirect: func(req *http.Request, via []*http.Request) error {
+					return http.ErrUseLastResponse
+				},
+				Transport: netxlite.NewHTTPTransportStdlib(log.Log),
+			}
+			req, err := http.NewRequestWithContext(ctx, "GET", "http://"+addr.String()+"/", nil)
+			runtimex.PanicOnError(err, "http.NewRequest failed")
+			req.Host = host
+			return clnt.Do(req)
+		}
+
+		t.Run("with a location", func(t *testing.T) {
+			ctx := context.Background()
+			const location = "http://blockpage.example.com/"
+			listener, err := newproxyWithParams(HTTPAction302, "nexa.polito.it", &HTTPActionParams{
+				Location: location,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := httpGETNoRedirect(ctx, listener.Addr(), "nexa.polito.it")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != 302 {
+				t.Fatal("unexpected status code", resp.StatusCode)
+			}
+			if resp.Header.Get("Location") != location {
+				t.Fatal("unexpected location", resp.Header.Get("Location"))
+			}
+			resp.Body.Close()
+			listener.Close()
+		})
+
+		t.Run("without a location", func(t *testing.T) {
+			ctx := context.Background()
+			listener, err := newproxy(HTTPAction302)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := httpGETNoRedirect(ctx, listener.Addr(), "nexa.polito.it")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != 500 {
+				t.Fatal("unexpected status code", resp.StatusCode)
+			}
+			resp.Body.Close()
+			listener.Close()
+		})
+	})
+
+	t.Run("HTTPActionInjectHeaders", func(t *testing.T) {
+		ctx := context.Background()
+		srvr := newserver()
+		defer srvr.Close()
+		host := srvr.Listener.Addr().String()
+		listener, err := newproxyWithParams(HTTPActionInjectHeaders, host, &HTTPActionParams{
+			Headers: map[string]string{"Server": "Blocker/1.0", "X-Server": "mascetti"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := httpGET(ctx, listener.Addr(), host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != 200 {
+			t.Fatal("unexpected status code", resp.StatusCode)
+		}
+		if resp.Header.Get("Server") != "Blocker/1.0" {
+			t.Fatal("did not inject the Server header")
+		}
+		if resp.Header.Get("X-Server") != "mascetti" {
+			t.Fatal("did not replace the X-Server header")
+		}
+		resp.Body.Close()
+		listener.Close()
+	})
+
+	t.Run("HTTPActionStripHeaders", func(t *testing.T) {
+		ctx := context.Background()
+		srvr := newserver()
+		defer srvr.Close()
+		host := srvr.Listener.Addr().String()
+		listener, err := newproxyWithParams(HTTPActionStripHeaders, host, &HTTPActionParams{
+			StripHeaders: []string{"x-server"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := httpGET(ctx, listener.Addr(), host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != 200 {
+			t.Fatal("unexpected status code", resp.StatusCode)
+		}
+		if _, found := resp.Header["X-Server"]; found {
+			t.Fatal("did not strip the X-Server header")
+		}
+		if resp.Header.Get("Content-Type") != "text/plain" {
+			t.Fatal("stripped too many headers")
+		}
+		resp.Body.Close()
+		listener.Close()
+	})
+
+	t.Run("HTTPActionTruncate", func(t *testing.T) {
+		ctx := context.Background()
+		srvr := newserver()
+		defer srvr.Close()
+		host := srvr.Listener.Addr().String()
+		listener, err := newproxyWithParams(HTTPActionTruncate, host, &HTTPActionParams{
+			TruncateBytes: 4,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := httpGET(ctx, listener.Addr(), host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != 200 {
+			t.Fatal("unexpected status code", resp.StatusCode)
+		}
+		data, err := netxlite.ReadAllContext(ctx, resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "0123" {
+			t.Fatal("unexpected body", string(data))
+		}
+		resp.Body.Close()
+		listener.Close()
+	})
+
 	t.Run("unknown action", func(t *testing.T) {
 		ctx := context.Background()
 		listener, err := newproxy("")
@@ -0,0 +1,344 @@
+package filtering
+
+import (
+	"crypto/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QUICAction is a QUIC filtering action that this proxy should take.
+type QUICAction string
+
+const (
+	// QUICActionPass passes the traffic to the destination.
+	QUICActionPass = QUICAction("pass")
+
+	// QUICActionDrop drops all the packets.
+	QUICActionDrop = QUICAction("drop")
+
+	// QUICActionDropAfter passes the first DropAfterPackets packets
+	// according to the SNI's QUICActionParams and then drops all the
+	// packets. We count the packets sent in both directions.
+	QUICActionDropAfter = QUICAction("drop-after")
+
+	// QUICActionStatelessReset sends a stateless reset to the client
+	// and then drops all the packets. Note that a client only honours a
+	// stateless reset containing a token it received from the server,
+	// hence clients will typically ignore it and timeout. This action
+	// is useful to check how clients react to such packets.
+	QUICActionStatelessReset = QUICAction("stateless-reset")
+)
+
+// QUICActionParams contains the parameters of QUIC actions.
+type QUICActionParams struct {
+	// DropAfterPackets is the number of packets for QUICActionDropAfter.
+	DropAfterPackets int64
+}
+
+// QUICProxy is a UDP proxy that routes QUIC traffic depending on
+// the SNI and may implement filtering policies. To find out the SNI,
+// the proxy decrypts the client's QUIC Initial packets.
+type QUICProxy struct {
+	// OnIncomingSNI is the MANDATORY hook called whenever we have
+	// successfully received the ClientHello. If we cannot find the
+	// ClientHello (e.g., the client is not using QUIC), this hook is
+	// called with an empty SNI. In such a case, there is no way for
+	// us to know the destination, so passing will drop the packets.
+	OnIncomingSNI func(sni string) QUICAction
+
+	// Params contains the OPTIONAL parameters of the actions
+	// indexed by SNI.
+	Params map[string]*QUICActionParams
+
+	// Dial is the OPTIONAL function used to connect to the
+	// destination. If nil, we use net.Dial.
+	Dial func(network, address string) (net.Conn, error)
+
+	// IdleTimeout is the OPTIONAL time after which we forget about
+	// a client with which we have not exchanged any packet, and we
+	// close the conn with its destination. If zero, we use 30 seconds.
+	IdleTimeout time.Duration
+}
+
+// quicProxyIdleTimeout is the default QUICProxy.IdleTimeout.
+const quicProxyIdleTimeout = 30 * time.Second
+
+// Start starts the proxy.
+func (p *QUICProxy) Start(address string) (net.PacketConn, error) {
+	listener, _, err := p.start(address)
+	return listener, err
+}
+
+func (p *QUICProxy) start(address string) (net.PacketConn, <-chan interface{}, error) {
+	pconn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, nil, err
+	}
+	idleTimeout := p.IdleTimeout
+	if idleTimeout <= 0 {
+		idleTimeout = quicProxyIdleTimeout
+	}
+	listener := &quicProxyListener{
+		PacketConn:  pconn,
+		idleTimeout: idleTimeout,
+		sessions:    map[string]*quicProxySession{},
+	}
+	done := make(chan interface{})
+	go p.mainloop(listener, done)
+	return listener, done, nil
+}
+
+// quicProxyListener is the net.PacketConn returned by QUICProxy.Start.
+type quicProxyListener struct {
+	net.PacketConn
+	idleTimeout time.Duration
+	mu          sync.Mutex
+	sessions    map[string]*quicProxySession
+}
+
+// Close closes the listener and the sessions.
+func (l *quicProxyListener) Close() error {
+	l.mu.Lock()
+	for _, session := range l.sessions {
+		session.close()
+	}
+	l.sessions = map[string]*quicProxySession{}
+	l.mu.Unlock()
+	return l.PacketConn.Close()
+}
+
+// session returns the session for addr, creating it if needed.
+func (l *quicProxyListener) session(addr net.Addr) *quicProxySession {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	session := l.sessions[addr.String()]
+	if session == nil {
+		session = &quicProxySession{addr: addr, listener: l, lastActivity: time.Now()}
+		l.sessions[addr.String()] = session
+	}
+	return session
+}
+
+// expire closes and forgets the sessions that have been idle
+// for more than the idle timeout. Closing a session stops the
+// goroutine reading from its destination, if any.
+func (l *quicProxyListener) expire(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, session := range l.sessions {
+		if session.idleSince(now.Add(-l.idleTimeout)) {
+			session.close()
+			delete(l.sessions, key)
+		}
+	}
+}
+
+func (p *QUICProxy) mainloop(listener *quicProxyListener, done chan<- interface{}) {
+	defer close(done)
+	lastExpire := time.Now()
+	for {
+		// Use a deadline such that we periodically wake up to
+		// expire the idle sessions even without new packets.
+		listener.SetReadDeadline(time.Now().Add(listener.idleTimeout))
+		if !p.oneloop(listener) {
+			return
+		}
+		if now := time.Now(); now.Sub(lastExpire) >= listener.idleTimeout {
+			listener.expire(now)
+			lastExpire = now
+		}
+	}
+}
+
+func (p *QUICProxy) oneloop(listener *quicProxyListener) bool {
+	buffer := make([]byte, 1<<16)
+	count, addr, err := listener.ReadFrom(buffer)
+	if err != nil && strings.HasSuffix(err.Error(), "use of closed network connection") {
+		return false // we need to stop
+	}
+	if err != nil {
+		return true // we can continue running
+	}
+	listener.session(addr).onClientPacket(p, buffer[:count])
+	return true // we can continue running
+}
+
+// quicProxyMaxPending is the maximum number of packets we
+// buffer while waiting for the complete ClientHello.
+const quicProxyMaxPending = 16
+
+// quicProxySession is the state of the packets exchanged with a client.
+type quicProxySession struct {
+	// addr is the client address.
+	addr net.Addr
+
+	// listener is the listener.
+	listener *quicProxyListener
+
+	// The following fields are only written by the mainloop before
+	// we start reading packets from the destination.
+	action    QUICAction
+	assembler quicClientHelloAssembler
+	decided   bool
+	params    *QUICActionParams
+	pending   [][]byte
+	resetSent bool
+	sni       string
+
+	// The following fields are shared with the upstream reader.
+	mu           sync.Mutex
+	closed       bool
+	count        int64
+	lastActivity time.Time
+	upstream     net.Conn
+}
+
+// touch records that we have exchanged a packet.
+func (s *quicProxySession) touch() {
+	s.mu.Lock()
+	s.lastActivity = time.Now()
+	s.mu.Unlock()
+}
+
+// idleSince returns whether we have not exchanged packets since t.
+func (s *quicProxySession) idleSince(t time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastActivity.Before(t)
+}
+
+func (s *quicProxySession) onClientPacket(p *QUICProxy, pkt []byte) {
+	s.touch()
+	if s.decided {
+		s.apply(p, pkt)
+		return
+	}
+	s.pending = append(s.pending, pkt)
+	sni, found := s.sniff(pkt)
+	if !found && len(s.pending) < quicProxyMaxPending {
+		return // wait for more packets
+	}
+	s.decided, s.sni, s.action = true, sni, p.OnIncomingSNI(sni)
+	s.params = p.Params[sni]
+	if s.params == nil {
+		s.params = &QUICActionParams{}
+	}
+	pending := s.pending
+	s.pending = nil
+	for _, pkt := range pending {
+		s.apply(p, pkt)
+	}
+}
+
+// sniff returns the SNI and whether we have found the ClientHello.
+func (s *quicProxySession) sniff(pkt []byte) (string, bool) {
+	initial, err := quicParseInitial(pkt)
+	if err != nil {
+		return "", false
+	}
+	frames, err := quicParseCryptoFrames(initial.Payload)
+	if err != nil {
+		return "", false
+	}
+	s.assembler.add(frames...)
+	clientHello := s.assembler.clientHello()
+	if clientHello == nil {
+		return "", false
+	}
+	sni, _ := quicParseClientHelloSNI(clientHello)
+	return sni, true
+}
+
+func (s *quicProxySession) apply(p *QUICProxy, pkt []byte) {
+	switch s.action {
+	case QUICActionPass, QUICActionDropAfter:
+		s.forward(p, pkt)
+	case QUICActionStatelessReset:
+		if !s.resetSent {
+			s.resetSent = true
+			s.listener.WriteTo(quicStatelessReset(), s.addr)
+		}
+	default:
+		// drop
+	}
+}
+
+// quicStatelessReset returns a stateless reset (RFC9000 Sec. 10.3)
+// whose token is random because we don't know the real token.
+func quicStatelessReset() []byte {
+	pkt := make([]byte, 43)
+	rand.Read(pkt)
+	pkt[0] = (pkt[0] & 0x3f) | 0x40 // short header with fixed bit
+	return pkt
+}
+
+// forward forwards pkt to the destination.
+func (s *quicProxySession) forward(p *QUICProxy, pkt []byte) {
+	upstream := s.getUpstream(p)
+	if upstream == nil || !s.allow() {
+		return
+	}
+	upstream.Write(pkt)
+}
+
+// allow returns whether we should forward the next packet.
+func (s *quicProxySession) allow() bool {
+	if s.action != QUICActionDropAfter {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.count >= s.params.DropAfterPackets {
+		return false
+	}
+	s.count++
+	return true
+}
+
+// getUpstream returns the conn with the destination, creating it if
+// needed. On failure, this function returns nil.
+func (s *quicProxySession) getUpstream(p *QUICProxy) net.Conn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.upstream != nil || s.closed || s.sni == "" {
+		return s.upstream
+	}
+	dial := p.Dial
+	if dial == nil {
+		dial = net.Dial
+	}
+	conn, err := dial("udp", net.JoinHostPort(s.sni, "443"))
+	if err != nil {
+		return nil
+	}
+	s.upstream = conn
+	go s.readloop(conn)
+	return conn
+}
+
+// readloop forwards the packets sent by the destination to the client.
+func (s *quicProxySession) readloop(conn net.Conn) {
+	buffer := make([]byte, 1<<16)
+	for {
+		count, err := conn.Read(buffer)
+		if err != nil {
+			return // includes the case where the session has expired
+		}
+		s.touch()
+		if !s.allow() {
+			continue
+		}
+		s.listener.WriteTo(buffer[:count], s.addr)
+	}
+}
+
+func (s *quicProxySession) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.upstream != nil {
+		s.upstream.Close()
+	}
+}
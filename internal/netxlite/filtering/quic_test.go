@@ -0,0 +1,281 @@
+package filtering
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/lucas-clemente/quic-go"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+func TestQUICProxy(t *testing.T) {
+	ca, err := NewCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// newServer creates a local QUIC server accepting sessions.
+	newServer := func(t *testing.T) quic.Listener {
+		cert, err := ca.NewCertificate("example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tlsConfig := &tls.Config{
+			Certificates: []tls.Certificate{*cert},
+			NextProtos:   []string{"h3"},
+		}
+		listener, err := quic.ListenAddr("127.0.0.1:0", tlsConfig, &quic.Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			for {
+				sess, err := listener.Accept(context.Background())
+				if err != nil {
+					return
+				}
+				go func() {
+					<-sess.Context().Done()
+				}()
+			}
+		}()
+		return listener
+	}
+
+	// newProxy creates a proxy routing all traffic to server.
+	newProxy := func(t *testing.T, action QUICAction, params *QUICActionParams,
+		server quic.Listener) net.PacketConn {
+		p := &QUICProxy{
+			OnIncomingSNI: func(sni string) QUICAction {
+				return action
+			},
+			Params: map[string]*QUICActionParams{"example.com": params},
+			Dial: func(network, address string) (net.Conn, error) {
+				if address != "example.com:443" {
+					return nil, errors.New("unexpected address")
+				}
+				return net.Dial(network, server.Addr().String())
+			},
+		}
+		listener, err := p.Start("127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return listener
+	}
+
+	// handshake performs a QUIC handshake with the proxy.
+	handshake := func(listener net.PacketConn) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		dialer := netxlite.NewQUICDialerWithoutResolver(netxlite.NewQUICListener(), log.Log)
+		tlsConfig := &tls.Config{
+			ServerName: "example.com",
+			NextProtos: []string{"h3"},
+			RootCAs:    ca.CertPool(),
+		}
+		quicConfig := &quic.Config{HandshakeIdleTimeout: time.Second}
+		sess, err := dialer.DialContext(
+			ctx, "udp", listener.LocalAddr().String(), tlsConfig, quicConfig)
+		if err != nil {
+			return err
+		}
+		sess.CloseWithError(0, "")
+		return nil
+	}
+
+	t.Run("QUICActionPass", func(t *testing.T) {
+		server := newServer(t)
+		defer server.Close()
+		listener := newProxy(t, QUICActionPass, nil, server)
+		defer listener.Close()
+		if err := handshake(listener); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("QUICActionDrop", func(t *testing.T) {
+		server := newServer(t)
+		defer server.Close()
+		listener := newProxy(t, QUICActionDrop, nil, server)
+		defer listener.Close()
+		err := handshake(listener)
+		if err == nil || err.Error() != netxlite.FailureGenericTimeoutError {
+			t.Fatal("unexpected err", err)
+		}
+	})
+
+	t.Run("QUICActionDropAfter", func(t *testing.T) {
+		t.Run("with few packets", func(t *testing.T) {
+			server := newServer(t)
+			defer server.Close()
+			params := &QUICActionParams{DropAfterPackets: 1}
+			listener := newProxy(t, QUICActionDropAfter, params, server)
+			defer listener.Close()
+			err := handshake(listener)
+			if err == nil || err.Error() != netxlite.FailureGenericTimeoutError {
+				t.Fatal("unexpected err", err)
+			}
+		})
+
+		t.Run("with many packets", func(t *testing.T) {
+			server := newServer(t)
+			defer server.Close()
+			params := &QUICActionParams{DropAfterPackets: 1000}
+			listener := newProxy(t, QUICActionDropAfter, params, server)
+			defer listener.Close()
+			if err := handshake(listener); err != nil {
+				t.Fatal(err)
+			}
+		})
+	})
+
+	t.Run("QUICActionStatelessReset", func(t *testing.T) {
+		server := newServer(t)
+		defer server.Close()
+		listener := newProxy(t, QUICActionStatelessReset, nil, server)
+		defer listener.Close()
+		pconn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pconn.Close()
+		initial := quicCaptureInitial(t, "example.com", quic.Version1)
+		if _, err := pconn.WriteTo(initial, listener.LocalAddr()); err != nil {
+			t.Fatal(err)
+		}
+		pconn.SetDeadline(time.Now().Add(time.Second))
+		buffer := make([]byte, 1<<16)
+		count, _, err := pconn.ReadFrom(buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 43 || buffer[0]&0xc0 != 0x40 {
+			t.Fatal("not a stateless reset", buffer[:count])
+		}
+	})
+
+	t.Run("expires idle sessions", func(t *testing.T) {
+		server := newServer(t)
+		defer server.Close()
+		p := &QUICProxy{
+			OnIncomingSNI: func(sni string) QUICAction {
+				return QUICActionPass
+			},
+			Dial: func(network, address string) (net.Conn, error) {
+				return net.Dial(network, server.Addr().String())
+			},
+			IdleTimeout: 100 * time.Millisecond,
+		}
+		pconn, done, err := p.start("127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		listener := pconn.(*quicProxyListener)
+		if err := handshake(listener); err != nil {
+			t.Fatal(err)
+		}
+		var sessions []*quicProxySession
+		listener.mu.Lock()
+		for _, session := range listener.sessions {
+			sessions = append(sessions, session)
+		}
+		listener.mu.Unlock()
+		if len(sessions) != 1 {
+			t.Fatal("unexpected number of sessions", len(sessions))
+		}
+		time.Sleep(500 * time.Millisecond)
+		listener.mu.Lock()
+		count := len(listener.sessions)
+		listener.mu.Unlock()
+		if count != 0 {
+			t.Fatal("the session did not expire")
+		}
+		sessions[0].mu.Lock()
+		closed := sessions[0].closed
+		sessions[0].mu.Unlock()
+		if !closed {
+			t.Fatal("the session is not closed")
+		}
+		listener.Close()
+		<-done // wait for the mainloop to return
+	})
+
+	t.Run("with non-QUIC traffic", func(t *testing.T) {
+		var called []string
+		p := &QUICProxy{
+			OnIncomingSNI: func(sni string) QUICAction {
+				called = append(called, sni)
+				return QUICActionPass
+			},
+		}
+		listener, done, err := p.start("127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		pconn, err := net.Dial("udp", listener.LocalAddr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for idx := 0; idx < quicProxyMaxPending; idx++ {
+			if _, err := pconn.Write([]byte("garbage")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		pconn.Close()
+		time.Sleep(250 * time.Millisecond)
+		listener.Close()
+		<-done // wait for the mainloop to return
+		if len(called) != 1 || called[0] != "" {
+			t.Fatal("unexpected calls", called)
+		}
+	})
+
+	t.Run("Start fails on an invalid address", func(t *testing.T) {
+		p := &QUICProxy{}
+		listener, err := p.Start("127.0.0.1")
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		if listener != nil {
+			t.Fatal("expected nil listener")
+		}
+	})
+
+	t.Run("oneloop", func(t *testing.T) {
+		t.Run("with a temporary error", func(t *testing.T) {
+			p := &QUICProxy{}
+			listener := &quicProxyListener{
+				PacketConn: &quicProxyTestPacketConn{err: errors.New("mocked error")},
+			}
+			if !p.oneloop(listener) {
+				t.Fatal("we should continue running")
+			}
+		})
+
+		t.Run("with a closed connection", func(t *testing.T) {
+			p := &QUICProxy{}
+			listener := &quicProxyListener{
+				PacketConn: &quicProxyTestPacketConn{err: net.ErrClosed},
+			}
+			if p.oneloop(listener) {
+				t.Fatal("we should stop running")
+			}
+		})
+	})
+}
+
+// quicProxyTestPacketConn is a net.PacketConn whose ReadFrom fails.
+type quicProxyTestPacketConn struct {
+	net.PacketConn
+	err error
+}
+
+func (c *quicProxyTestPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	return 0, nil, c.err
+}
@@ -0,0 +1,389 @@
+package filtering
+
+//
+// QUIC Initial packets decryption
+//
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/crypto/hkdf"
+)
+
+// quicInitialSalts maps the QUIC versions we know to the salt
+// used to derive the Initial secrets. See RFC9001 Sec. 5.2.
+var quicInitialSalts = map[uint32][]byte{
+	// QUIC v1
+	0x00000001: {
+		0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17,
+		0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a,
+	},
+	// QUIC draft-29
+	0xff00001d: {
+		0xaf, 0xbf, 0xec, 0x28, 0x99, 0x93, 0xd2, 0x4c, 0x9e, 0x97,
+		0x86, 0xf1, 0x9c, 0x61, 0x11, 0xe0, 0x43, 0x90, 0xa8, 0x99,
+	},
+}
+
+var (
+	// errQUICNotInitial indicates that a packet is not a QUIC Initial.
+	errQUICNotInitial = errors.New("filtering: not a QUIC Initial packet")
+
+	// errQUICUnknownVersion indicates that we don't know the version.
+	errQUICUnknownVersion = errors.New("filtering: unknown QUIC version")
+
+	// errQUICTruncatedPacket indicates that the packet is truncated.
+	errQUICTruncatedPacket = errors.New("filtering: truncated QUIC packet")
+
+	// errQUICUnknownFrame indicates that we cannot parse a frame.
+	errQUICUnknownFrame = errors.New("filtering: unknown QUIC frame")
+
+	// errQUICInvalidClientHello indicates the ClientHello is invalid.
+	errQUICInvalidClientHello = errors.New("filtering: invalid ClientHello")
+)
+
+// quicInitialPacket is a decrypted QUIC Initial packet.
+type quicInitialPacket struct {
+	// Version is the QUIC version.
+	Version uint32
+
+	// DestConnID is the destination connection ID.
+	DestConnID []byte
+
+	// SrcConnID is the source connection ID.
+	SrcConnID []byte
+
+	// Payload contains the decrypted frames.
+	Payload []byte
+}
+
+// quicParseInitial decrypts the first QUIC Initial packet inside
+// pkt, which may contain several coalesced packets. This function
+// does not modify pkt. Because we only care about the first packets
+// sent by clients, we use the truncated packet number as the full
+// packet number when computing the nonce.
+func quicParseInitial(pkt []byte) (*quicInitialPacket, error) {
+	s := cryptobyte.String(pkt)
+	var (
+		first   uint8
+		version uint32
+		dcid    cryptobyte.String
+		scid    cryptobyte.String
+		token   []byte
+	)
+	if !s.ReadUint8(&first) || !s.ReadUint32(&version) {
+		return nil, errQUICTruncatedPacket
+	}
+	const (
+		headerFormLong = 0x80
+		packetTypeMask = 0x30
+	)
+	if first&headerFormLong == 0 || first&packetTypeMask != 0 {
+		return nil, errQUICNotInitial // short header or not an Initial
+	}
+	salt, found := quicInitialSalts[version]
+	if !found {
+		return nil, errQUICUnknownVersion
+	}
+	if !s.ReadUint8LengthPrefixed(&dcid) || !s.ReadUint8LengthPrefixed(&scid) {
+		return nil, errQUICTruncatedPacket
+	}
+	tokenLength, okay := quicReadVarint(&s)
+	if !okay || tokenLength > uint64(len(s)) || !s.ReadBytes(&token, int(tokenLength)) {
+		return nil, errQUICTruncatedPacket
+	}
+	length, okay := quicReadVarint(&s)
+	const (
+		maxPacketNumberLength = 4
+		sampleLength          = 16
+	)
+	if !okay || length < maxPacketNumberLength+sampleLength || uint64(len(s)) < length {
+		return nil, errQUICTruncatedPacket
+	}
+	pnOffset := len(pkt) - len(s)
+	key, iv, hp := quicInitialClientKeys(salt, dcid)
+	// remove header protection (RFC9001 Sec. 5.4)
+	block, err := aes.NewCipher(hp)
+	if err != nil {
+		return nil, err
+	}
+	mask := make([]byte, block.BlockSize())
+	sample := pkt[pnOffset+maxPacketNumberLength : pnOffset+maxPacketNumberLength+sampleLength]
+	block.Encrypt(mask, sample)
+	header := append([]byte{}, pkt[:pnOffset+maxPacketNumberLength]...)
+	header[0] ^= mask[0] & 0x0f
+	pnLength := int(header[0]&0x03) + 1
+	var pn uint64
+	for idx := 0; idx < pnLength; idx++ {
+		header[pnOffset+idx] ^= mask[1+idx]
+		pn = pn<<8 | uint64(header[pnOffset+idx])
+	}
+	header = header[:pnOffset+pnLength]
+	// remove packet protection (RFC9001 Sec. 5.3)
+	aesBlock, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(aesBlock)
+	if err != nil {
+		return nil, err
+	}
+	nonce := append([]byte{}, iv...)
+	for idx := 0; idx < 8; idx++ {
+		nonce[len(nonce)-1-idx] ^= byte(pn >> (8 * idx))
+	}
+	ciphertext := pkt[pnOffset+pnLength : pnOffset+int(length)]
+	payload, err := aead.Open(nil, nonce, ciphertext, header)
+	if err != nil {
+		return nil, err
+	}
+	out := &quicInitialPacket{
+		Version:    version,
+		DestConnID: []byte(dcid),
+		SrcConnID:  []byte(scid),
+		Payload:    payload,
+	}
+	return out, nil
+}
+
+// quicInitialClientKeys derives the client's Initial key, IV, and
+// header protection key. See RFC9001 Sec. 5.2.
+func quicInitialClientKeys(salt, dcid []byte) (key, iv, hp []byte) {
+	initialSecret := hkdf.Extract(crypto.SHA256.New, dcid, salt)
+	clientSecret := quicHKDFExpandLabel(initialSecret, "client in", crypto.SHA256.Size())
+	key = quicHKDFExpandLabel(clientSecret, "quic key", 16)
+	iv = quicHKDFExpandLabel(clientSecret, "quic iv", 12)
+	hp = quicHKDFExpandLabel(clientSecret, "quic hp", 16)
+	return
+}
+
+// quicHKDFExpandLabel implements HKDF-Expand-Label with an empty
+// context as defined in RFC8446 Sec. 7.1.
+func quicHKDFExpandLabel(secret []byte, label string, length int) []byte {
+	var b cryptobyte.Builder
+	b.AddUint16(uint16(length))
+	b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes([]byte("tls13 " + label))
+	})
+	b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {})
+	out := make([]byte, length)
+	if _, err := hkdf.Expand(crypto.SHA256.New, secret, b.BytesOrPanic()).Read(out); err != nil {
+		panic("filtering: HKDF-Expand-Label failed unexpectedly")
+	}
+	return out
+}
+
+// quicReadVarint reads a QUIC variable-length integer (RFC9000 Sec. 16).
+func quicReadVarint(s *cryptobyte.String) (uint64, bool) {
+	var first uint8
+	if !s.ReadUint8(&first) {
+		return 0, false
+	}
+	length := 1 << (first >> 6)
+	value := uint64(first & 0x3f)
+	var rest []byte
+	if !s.ReadBytes(&rest, length-1) {
+		return 0, false
+	}
+	for _, b := range rest {
+		value = value<<8 | uint64(b)
+	}
+	return value, true
+}
+
+// quicCryptoFrame is a QUIC CRYPTO frame.
+type quicCryptoFrame struct {
+	// Offset is the offset of Data in the crypto stream.
+	Offset uint64
+
+	// Data contains the frame data.
+	Data []byte
+}
+
+// quicParseCryptoFrames returns the CRYPTO frames inside the payload
+// of an Initial packet, skipping the other frames that may appear
+// inside Initial packets (see RFC9000 Sec. 12.4).
+func quicParseCryptoFrames(payload []byte) ([]*quicCryptoFrame, error) {
+	s := cryptobyte.String(payload)
+	var out []*quicCryptoFrame
+	for !s.Empty() {
+		frameType, okay := quicReadVarint(&s)
+		if !okay {
+			return nil, errQUICTruncatedPacket
+		}
+		switch frameType {
+		case 0x00, 0x01: // PADDING, PING
+			continue
+		case 0x02, 0x03: // ACK
+			okay = quicSkipACKFrame(&s, frameType == 0x03)
+		case 0x06: // CRYPTO
+			var frame *quicCryptoFrame
+			frame, okay = quicReadCryptoFrame(&s)
+			if okay {
+				out = append(out, frame)
+			}
+		case 0x1c: // CONNECTION_CLOSE
+			okay = quicSkipConnectionCloseFrame(&s)
+		default:
+			return nil, errQUICUnknownFrame
+		}
+		if !okay {
+			return nil, errQUICTruncatedPacket
+		}
+	}
+	return out, nil
+}
+
+func quicReadCryptoFrame(s *cryptobyte.String) (*quicCryptoFrame, bool) {
+	offset, okay := quicReadVarint(s)
+	if !okay {
+		return nil, false
+	}
+	length, okay := quicReadVarint(s)
+	if !okay || length > uint64(len(*s)) {
+		return nil, false
+	}
+	var data []byte
+	if !s.ReadBytes(&data, int(length)) {
+		return nil, false
+	}
+	return &quicCryptoFrame{Offset: offset, Data: data}, true
+}
+
+func quicSkipACKFrame(s *cryptobyte.String, withECN bool) bool {
+	count := 4 // largest acknowledged, delay, range count, first range
+	if withECN {
+		count += 3
+	}
+	var ranges uint64
+	for idx := 0; idx < count; idx++ {
+		value, okay := quicReadVarint(s)
+		if !okay {
+			return false
+		}
+		if idx == 2 {
+			ranges = value
+		}
+	}
+	for ; ranges > 0; ranges-- {
+		if _, okay := quicReadVarint(s); !okay { // gap
+			return false
+		}
+		if _, okay := quicReadVarint(s); !okay { // range length
+			return false
+		}
+	}
+	return true
+}
+
+func quicSkipConnectionCloseFrame(s *cryptobyte.String) bool {
+	if _, okay := quicReadVarint(s); !okay { // error code
+		return false
+	}
+	if _, okay := quicReadVarint(s); !okay { // frame type
+		return false
+	}
+	length, okay := quicReadVarint(s)
+	return okay && length <= uint64(len(*s)) && s.Skip(int(length))
+}
+
+// quicClientHelloAssembler reassembles the ClientHello from the
+// CRYPTO frames, which may span several Initial packets.
+type quicClientHelloAssembler struct {
+	frames []*quicCryptoFrame
+}
+
+// add adds the given frames to the assembler.
+func (a *quicClientHelloAssembler) add(frames ...*quicCryptoFrame) {
+	a.frames = append(a.frames, frames...)
+}
+
+// clientHello returns the ClientHello handshake message if we have
+// received all of it, and nil otherwise.
+func (a *quicClientHelloAssembler) clientHello() []byte {
+	var data []byte
+	for progress := true; progress; {
+		progress = false
+		for _, frame := range a.frames {
+			end := frame.Offset + uint64(len(frame.Data))
+			if frame.Offset <= uint64(len(data)) && end > uint64(len(data)) {
+				data = append(data, frame.Data[uint64(len(data))-frame.Offset:]...)
+				progress = true
+			}
+		}
+	}
+	const headerLength = 4 // type and uint24 length
+	if len(data) < headerLength {
+		return nil
+	}
+	length := headerLength + int(binary.BigEndian.Uint32(data[:headerLength])&0x00ffffff)
+	if len(data) < length {
+		return nil
+	}
+	return data[:length]
+}
+
+// quicParseClientHelloSNI returns the SNI inside a ClientHello handshake
+// message (see RFC8446 Sec. 4.1.2 and RFC6066 Sec. 3). When there is no
+// SNI, this function returns an empty string.
+func quicParseClientHelloSNI(message []byte) (string, error) {
+	s := cryptobyte.String(message)
+	var (
+		msgType            uint8
+		body               cryptobyte.String
+		sessionID          cryptobyte.String
+		cipherSuites       cryptobyte.String
+		compressionMethods cryptobyte.String
+		extensions         cryptobyte.String
+	)
+	const handshakeTypeClientHello = 1
+	if !s.ReadUint8(&msgType) || msgType != handshakeTypeClientHello ||
+		!s.ReadUint24LengthPrefixed(&body) || !body.Skip(2+32) || // version and random
+		!body.ReadUint8LengthPrefixed(&sessionID) ||
+		!body.ReadUint16LengthPrefixed(&cipherSuites) ||
+		!body.ReadUint8LengthPrefixed(&compressionMethods) {
+		return "", errQUICInvalidClientHello
+	}
+	if body.Empty() {
+		return "", nil // no extensions
+	}
+	if !body.ReadUint16LengthPrefixed(&extensions) {
+		return "", errQUICInvalidClientHello
+	}
+	for !extensions.Empty() {
+		var (
+			extType uint16
+			extData cryptobyte.String
+		)
+		if !extensions.ReadUint16(&extType) || !extensions.ReadUint16LengthPrefixed(&extData) {
+			return "", errQUICInvalidClientHello
+		}
+		const extensionServerName = 0
+		if extType != extensionServerName {
+			continue
+		}
+		var names cryptobyte.String
+		if !extData.ReadUint16LengthPrefixed(&names) {
+			return "", errQUICInvalidClientHello
+		}
+		for !names.Empty() {
+			var (
+				nameType uint8
+				name     cryptobyte.String
+			)
+			if !names.ReadUint8(&nameType) || !names.ReadUint16LengthPrefixed(&name) {
+				return "", errQUICInvalidClientHello
+			}
+			const nameTypeHostName = 0
+			if nameType == nameTypeHostName {
+				return string(name), nil
+			}
+		}
+	}
+	return "", nil
+}
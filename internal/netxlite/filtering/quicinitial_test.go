@@ -0,0 +1,206 @@
+package filtering
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/lucas-clemente/quic-go"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+// quicCaptureInitial returns the first datagram sent by a QUIC client
+// dialing a local UDP socket using the given SNI and QUIC version.
+func quicCaptureInitial(t *testing.T, sni string, version quic.VersionNumber) []byte {
+	pconn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pconn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	go func() {
+		dialer := netxlite.NewQUICDialerWithoutResolver(netxlite.NewQUICListener(), log.Log)
+		tlsConfig := &tls.Config{ServerName: sni, NextProtos: []string{"h3"}}
+		quicConfig := &quic.Config{Versions: []quic.VersionNumber{version}}
+		sess, err := dialer.DialContext(ctx, "udp", pconn.LocalAddr().String(), tlsConfig, quicConfig)
+		if err == nil {
+			sess.CloseWithError(0, "")
+		}
+	}()
+	buffer := make([]byte, 1<<16)
+	count, _, err := pconn.ReadFrom(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buffer[:count]
+}
+
+func TestQUICParseInitial(t *testing.T) {
+	// parseSNI parses the SNI inside the given Initial packet.
+	parseSNI := func(t *testing.T, pkt []byte) string {
+		initial, err := quicParseInitial(pkt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames, err := quicParseCryptoFrames(initial.Payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var assembler quicClientHelloAssembler
+		assembler.add(frames...)
+		clientHello := assembler.clientHello()
+		if clientHello == nil {
+			t.Fatal("incomplete ClientHello")
+		}
+		sni, err := quicParseClientHelloSNI(clientHello)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sni
+	}
+
+	t.Run("with QUIC v1", func(t *testing.T) {
+		pkt := quicCaptureInitial(t, "dns.google", quic.Version1)
+		if sni := parseSNI(t, pkt); sni != "dns.google" {
+			t.Fatal("unexpected SNI", sni)
+		}
+	})
+
+	t.Run("with QUIC draft-29", func(t *testing.T) {
+		pkt := quicCaptureInitial(t, "www.example.com", quic.VersionDraft29)
+		if sni := parseSNI(t, pkt); sni != "www.example.com" {
+			t.Fatal("unexpected SNI", sni)
+		}
+	})
+
+	t.Run("does not modify the packet", func(t *testing.T) {
+		pkt := quicCaptureInitial(t, "dns.google", quic.Version1)
+		orig := append([]byte{}, pkt...)
+		if _, err := quicParseInitial(pkt); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(orig, pkt); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("with a short header packet", func(t *testing.T) {
+		_, err := quicParseInitial(quicStatelessReset())
+		if !errors.Is(err, errQUICNotInitial) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+
+	t.Run("with an unknown version", func(t *testing.T) {
+		pkt := quicCaptureInitial(t, "dns.google", quic.Version1)
+		pkt[1], pkt[2], pkt[3], pkt[4] = 0x0a, 0x0a, 0x0a, 0x0a
+		_, err := quicParseInitial(pkt)
+		if !errors.Is(err, errQUICUnknownVersion) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+
+	t.Run("with a truncated packet", func(t *testing.T) {
+		pkt := quicCaptureInitial(t, "dns.google", quic.Version1)
+		for _, size := range []int{0, 3, 6, 30, 100} {
+			_, err := quicParseInitial(pkt[:size])
+			if !errors.Is(err, errQUICTruncatedPacket) {
+				t.Fatal("unexpected err", size, err)
+			}
+		}
+	})
+
+	t.Run("with a corrupted payload", func(t *testing.T) {
+		pkt := quicCaptureInitial(t, "dns.google", quic.Version1)
+		pkt[len(pkt)-1] ^= 0xff
+		_, err := quicParseInitial(pkt)
+		if err == nil || err.Error() != "cipher: message authentication failed" {
+			t.Fatal("unexpected err", err)
+		}
+	})
+}
+
+func TestQUICParseCryptoFrames(t *testing.T) {
+	t.Run("skips the other frames", func(t *testing.T) {
+		payload := []byte{
+			0x00,                   // PADDING
+			0x01,                   // PING
+			0x02, 0, 0, 1, 0, 1, 1, // ACK with one range
+			0x03, 0, 0, 0, 0, 1, 1, 1, // ACK with ECN
+			0x06, 0, 2, 0xaa, 0xbb, // CRYPTO
+			0x1c, 0, 0, 1, 'x', // CONNECTION_CLOSE
+			0x06, 2, 1, 0xcc, // CRYPTO
+		}
+		frames, err := quicParseCryptoFrames(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []*quicCryptoFrame{
+			{Offset: 0, Data: []byte{0xaa, 0xbb}},
+			{Offset: 2, Data: []byte{0xcc}},
+		}
+		if diff := cmp.Diff(expected, frames); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("with an unknown frame", func(t *testing.T) {
+		_, err := quicParseCryptoFrames([]byte{0x08})
+		if !errors.Is(err, errQUICUnknownFrame) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+
+	t.Run("with a truncated frame", func(t *testing.T) {
+		for _, payload := range [][]byte{{0x06, 0, 10, 1}, {0x02, 0}, {0x1c, 0, 0, 10}, {0x40}} {
+			_, err := quicParseCryptoFrames(payload)
+			if !errors.Is(err, errQUICTruncatedPacket) {
+				t.Fatal("unexpected err", payload, err)
+			}
+		}
+	})
+}
+
+func TestQUICClientHelloAssembler(t *testing.T) {
+	var assembler quicClientHelloAssembler
+	assembler.add(&quicCryptoFrame{Offset: 4, Data: []byte{0xcc, 0xdd}})
+	if assembler.clientHello() != nil {
+		t.Fatal("expected nil ClientHello")
+	}
+	assembler.add(&quicCryptoFrame{Offset: 0, Data: []byte{1, 0, 0, 3}})
+	if assembler.clientHello() != nil {
+		t.Fatal("expected nil ClientHello")
+	}
+	assembler.add(&quicCryptoFrame{Offset: 5, Data: []byte{0xdd, 0xee}})
+	expected := []byte{1, 0, 0, 3, 0xcc, 0xdd, 0xee}
+	if diff := cmp.Diff(expected, assembler.clientHello()); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestQUICParseClientHelloSNI(t *testing.T) {
+	t.Run("with an invalid message", func(t *testing.T) {
+		_, err := quicParseClientHelloSNI([]byte{2, 0, 0, 0})
+		if !errors.Is(err, errQUICInvalidClientHello) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+
+	t.Run("without extensions", func(t *testing.T) {
+		message := append([]byte{1, 0, 0, 38, 3, 3}, make([]byte, 32)...)
+		message = append(message, 0, 0, 0, 0)
+		sni, err := quicParseClientHelloSNI(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sni != "" {
+			t.Fatal("unexpected SNI", sni)
+		}
+	})
+}
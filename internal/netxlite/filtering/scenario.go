@@ -0,0 +1,228 @@
+package filtering
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// TProxyScenario is a declarative censorship scenario. A scenario
+// combines DNS, TLS, HTTP, QUIC and endpoint rules and may build on
+// top of the profiles bundled with this package. Use the Config method
+// to obtain the TProxyConfig implementing the scenario.
+//
+// This is an example of a scenario in JSON format:
+//
+//     {
+//       "Name": "example",
+//       "Description": "resets TLS connections using www.example.com",
+//       "Profiles": ["dns-injection"],
+//       "TLS": {"SNIs": {"www.example.com": "reset"}},
+//       "Endpoints": {"Policies": {"*:443/tcp": "hijack-tls"}}
+//     }
+type TProxyScenario struct {
+	// Name is the OPTIONAL name of the scenario.
+	Name string
+
+	// Description is the OPTIONAL description of the scenario.
+	Description string
+
+	// Profiles contains the OPTIONAL names of the bundled profiles
+	// on top of which we build this scenario. We apply the profiles
+	// in order, followed by the rules of this scenario, and a later
+	// rule for the same key replaces an earlier one.
+	Profiles []string
+
+	// DNS contains the DNS rules.
+	DNS TProxyScenarioDNS
+
+	// TLS contains the TLS rules.
+	TLS TProxyScenarioTLS
+
+	// HTTP contains the HTTP rules.
+	HTTP TProxyScenarioHTTP
+
+	// QUIC contains the QUIC rules.
+	QUIC TProxyScenarioQUIC
+
+	// Endpoints contains the endpoint rules.
+	Endpoints TProxyScenarioEndpoints
+}
+
+// TProxyScenarioDNS contains the DNS rules of a TProxyScenario. See the
+// documentation of the TProxyConfig fields with the same meaning.
+type TProxyScenarioDNS struct {
+	// Cache is like TProxyConfig.DNSCache.
+	Cache map[string][]string
+
+	// Domains is like TProxyConfig.Domains.
+	Domains map[string]DNSAction
+
+	// Params is like TProxyConfig.DNSParams.
+	Params map[string]*DNSActionParams
+}
+
+// TProxyScenarioTLS contains the TLS rules of a TProxyScenario.
+type TProxyScenarioTLS struct {
+	// ALPNs is like TProxyConfig.ALPNs.
+	ALPNs map[string]TLSAction
+
+	// SNIs is like TProxyConfig.SNIs.
+	SNIs map[string]TLSAction
+}
+
+// TProxyScenarioHTTP contains the HTTP rules of a TProxyScenario.
+type TProxyScenarioHTTP struct {
+	// Hosts is like TProxyConfig.Hosts.
+	Hosts map[string]HTTPAction
+
+	// Params is like TProxyConfig.HTTPParams.
+	Params map[string]*HTTPActionParams
+}
+
+// TProxyScenarioQUIC contains the QUIC rules of a TProxyScenario.
+type TProxyScenarioQUIC struct {
+	// SNIs is like TProxyConfig.QUICSNIs.
+	SNIs map[string]QUICAction
+
+	// Params is like TProxyConfig.QUICParams.
+	Params map[string]*QUICActionParams
+}
+
+// TProxyScenarioEndpoints contains the endpoint rules of a TProxyScenario.
+type TProxyScenarioEndpoints struct {
+	// Policies is like TProxyConfig.Endpoints.
+	Policies map[string]TProxyPolicy
+
+	// Params is like TProxyConfig.EndpointParams.
+	Params map[string]*TProxyPolicyParams
+}
+
+//go:embed profiles/*.json
+var tProxyProfilesFS embed.FS
+
+// ErrUnknownTProxyProfile indicates that a profile does not exist.
+var ErrUnknownTProxyProfile = errors.New("filtering: unknown profile")
+
+// ErrTProxyProfileLoop indicates that profiles include each other.
+var ErrTProxyProfileLoop = errors.New("filtering: profiles include each other")
+
+// TProxyProfiles returns the sorted names of the bundled profiles.
+func TProxyProfiles() []string {
+	entries, _ := tProxyProfilesFS.ReadDir("profiles")
+	var out []string
+	for _, entry := range entries {
+		out = append(out, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+	sort.Strings(out)
+	return out
+}
+
+// NewTProxyProfile returns the bundled profile with the given name.
+func NewTProxyProfile(name string) (*TProxyScenario, error) {
+	data, err := tProxyProfilesFS.ReadFile(path.Join("profiles", name+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTProxyProfile, name)
+	}
+	return newTProxyScenario(data)
+}
+
+// NewTProxyScenario reads the TProxyScenario from the given file.
+func NewTProxyScenario(file string) (*TProxyScenario, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return newTProxyScenario(data)
+}
+
+func newTProxyScenario(data []byte) (*TProxyScenario, error) {
+	var scenario TProxyScenario
+	if err := json.Unmarshal(data, &scenario); err != nil {
+		return nil, err
+	}
+	return &scenario, nil
+}
+
+// NewTProxyConfigFromScenario returns the TProxyConfig implementing
+// the given scenario, which is either the path of a file containing a
+// scenario or the name of a bundled profile.
+func NewTProxyConfigFromScenario(fileOrProfile string) (*TProxyConfig, error) {
+	scenario, err := NewTProxyScenario(fileOrProfile)
+	if errors.Is(err, os.ErrNotExist) {
+		scenario, err = NewTProxyProfile(fileOrProfile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return scenario.Config()
+}
+
+// Config returns the TProxyConfig implementing the scenario.
+func (s *TProxyScenario) Config() (*TProxyConfig, error) {
+	config := &TProxyConfig{}
+	if err := s.apply(config, map[string]bool{}); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// apply applies the profiles and the rules of this scenario to the
+// given config. The active argument contains the profiles we are
+// currently applying and allows us to detect loops.
+func (s *TProxyScenario) apply(config *TProxyConfig, active map[string]bool) error {
+	for _, name := range s.Profiles {
+		if active[name] {
+			return fmt.Errorf("%w: %s", ErrTProxyProfileLoop, name)
+		}
+		profile, err := NewTProxyProfile(name)
+		if err != nil {
+			return err
+		}
+		active[name] = true
+		if err := profile.apply(config, active); err != nil {
+			return err
+		}
+		delete(active, name)
+	}
+	dns := &TProxyConfig{
+		DNSCache:  s.DNS.Cache,
+		DNSParams: s.DNS.Params,
+		Domains:   s.DNS.Domains,
+	}
+	dns.CanonicalizeDNS() // so we merge `x.org` and `x.org.`
+	config.DNSCache = tProxyMergeMaps(config.DNSCache, dns.DNSCache).(map[string][]string)
+	config.Domains = tProxyMergeMaps(config.Domains, dns.Domains).(map[string]DNSAction)
+	config.DNSParams = tProxyMergeMaps(config.DNSParams, dns.DNSParams).(map[string]*DNSActionParams)
+	config.ALPNs = tProxyMergeMaps(config.ALPNs, s.TLS.ALPNs).(map[string]TLSAction)
+	config.SNIs = tProxyMergeMaps(config.SNIs, s.TLS.SNIs).(map[string]TLSAction)
+	config.Hosts = tProxyMergeMaps(config.Hosts, s.HTTP.Hosts).(map[string]HTTPAction)
+	config.HTTPParams = tProxyMergeMaps(config.HTTPParams, s.HTTP.Params).(map[string]*HTTPActionParams)
+	config.QUICSNIs = tProxyMergeMaps(config.QUICSNIs, s.QUIC.SNIs).(map[string]QUICAction)
+	config.QUICParams = tProxyMergeMaps(config.QUICParams, s.QUIC.Params).(map[string]*QUICActionParams)
+	config.Endpoints = tProxyMergeMaps(config.Endpoints, s.Endpoints.Policies).(map[string]TProxyPolicy)
+	config.EndpointParams = tProxyMergeMaps(
+		config.EndpointParams, s.Endpoints.Params).(map[string]*TProxyPolicyParams)
+	return nil
+}
+
+// tProxyMergeMaps returns a map containing the entries of dst and src
+// where entries in src replace entries in dst with the same key. Both
+// arguments MUST be maps of the same type and dst MAY be nil.
+func tProxyMergeMaps(dst, src interface{}) interface{} {
+	dv, sv := reflect.ValueOf(dst), reflect.ValueOf(src)
+	if dv.IsNil() {
+		dv = reflect.MakeMap(dv.Type())
+	}
+	iter := sv.MapRange()
+	for iter.Next() {
+		dv.SetMapIndex(iter.Key(), iter.Value())
+	}
+	return dv.Interface()
+}
@@ -0,0 +1,175 @@
+package filtering
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTProxyScenario(t *testing.T) {
+	t.Run("NewTProxyScenario", func(t *testing.T) {
+		t.Run("with nonexistent file", func(t *testing.T) {
+			scenario, err := NewTProxyScenario(filepath.Join("testdata", "nonexistent"))
+			if !errors.Is(err, os.ErrNotExist) {
+				t.Fatal("unexpected err", err)
+			}
+			if scenario != nil {
+				t.Fatal("expected nil scenario here")
+			}
+		})
+
+		t.Run("with file containing invalid JSON", func(t *testing.T) {
+			scenario, err := NewTProxyScenario(filepath.Join("testdata", "invalid.json"))
+			if err == nil {
+				t.Fatal("expected an error here")
+			}
+			if scenario != nil {
+				t.Fatal("expected nil scenario here")
+			}
+		})
+
+		t.Run("with file containing valid JSON", func(t *testing.T) {
+			scenario, err := NewTProxyScenario(filepath.Join("testdata", "scenario.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if scenario.Name != "example" {
+				t.Fatal("unexpected name", scenario.Name)
+			}
+		})
+	})
+
+	t.Run("Config", func(t *testing.T) {
+		t.Run("builds on top of profiles", func(t *testing.T) {
+			scenario, err := NewTProxyScenario(filepath.Join("testdata", "scenario.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			config, err := scenario.Config()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Domains["www.example.com."] != DNSActionNXDOMAIN {
+				t.Fatal("did not canonicalize config.Domains")
+			}
+			expectedSNIs := map[string]TLSAction{
+				"twitter.com":      TLSActionTimeout,
+				"www.facebook.com": TLSActionReset,
+				"www.youtube.com":  TLSActionReset,
+			}
+			if diff := cmp.Diff(expectedSNIs, config.SNIs); diff != "" {
+				t.Fatal(diff)
+			}
+			if config.Endpoints["*:443/tcp"] != TProxyPolicyHijackTLS {
+				t.Fatal("did not include the profile's endpoints")
+			}
+		})
+
+		t.Run("merges canonical and non-canonical names", func(t *testing.T) {
+			scenario := &TProxyScenario{
+				Profiles: []string{"dns-injection"},
+				DNS: TProxyScenarioDNS{
+					Domains: map[string]DNSAction{
+						"twitter.com.": DNSActionNXDOMAIN,
+					},
+				},
+			}
+			config, err := scenario.Config()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Domains["twitter.com."] != DNSActionNXDOMAIN {
+				t.Fatal("the scenario did not override the profile")
+			}
+			if len(config.Domains) != 3 {
+				t.Fatal("unexpected domains", config.Domains)
+			}
+		})
+
+		t.Run("with an unknown profile", func(t *testing.T) {
+			scenario := &TProxyScenario{Profiles: []string{"nonexistent"}}
+			config, err := scenario.Config()
+			if !errors.Is(err, ErrUnknownTProxyProfile) {
+				t.Fatal("unexpected err", err)
+			}
+			if config != nil {
+				t.Fatal("expected nil config here")
+			}
+		})
+
+		t.Run("with a profile loop", func(t *testing.T) {
+			scenario := &TProxyScenario{Profiles: []string{"gfw"}}
+			config, err := scenario.Config()
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = scenario.apply(config, map[string]bool{"sni-reset": true})
+			if !errors.Is(err, ErrTProxyProfileLoop) {
+				t.Fatal("unexpected err", err)
+			}
+		})
+	})
+
+	t.Run("NewTProxyConfigFromScenario", func(t *testing.T) {
+		t.Run("with a file", func(t *testing.T) {
+			config, err := NewTProxyConfigFromScenario(filepath.Join("testdata", "scenario.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.SNIs["twitter.com"] != TLSActionTimeout {
+				t.Fatal("not the config we expected")
+			}
+		})
+
+		t.Run("with a profile", func(t *testing.T) {
+			config, err := NewTProxyConfigFromScenario("gfw")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.QUICSNIs["twitter.com"] != QUICActionDrop {
+				t.Fatal("not the config we expected")
+			}
+		})
+
+		t.Run("with neither a file nor a profile", func(t *testing.T) {
+			config, err := NewTProxyConfigFromScenario("nonexistent")
+			if !errors.Is(err, ErrUnknownTProxyProfile) {
+				t.Fatal("unexpected err", err)
+			}
+			if config != nil {
+				t.Fatal("expected nil config here")
+			}
+		})
+	})
+}
+
+func TestTProxyProfiles(t *testing.T) {
+	profiles := TProxyProfiles()
+	if len(profiles) <= 0 {
+		t.Fatal("expected bundled profiles")
+	}
+	for _, name := range profiles {
+		t.Run(name, func(t *testing.T) {
+			profile, err := NewTProxyProfile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if profile.Name != name || profile.Description == "" {
+				t.Fatal("profile without a proper name or description")
+			}
+			config, err := profile.Config()
+			if err != nil {
+				t.Fatal(err)
+			}
+			proxy, err := NewTProxy(config, log.Log)
+			if err != nil {
+				t.Fatal(err)
+			}
+			proxy.Close()
+		})
+	}
+}
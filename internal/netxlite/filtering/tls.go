@@ -1,10 +1,15 @@
 package filtering
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"io"
 	"net"
+	"net/http"
 	"strings"
 	"sync"
 
@@ -34,11 +39,40 @@ const (
 	// TLSActionAlertUnrecognizedName tells the client that
 	// it's handshaking with an unknown SNI.
 	TLSActionAlertUnrecognizedName = TLSAction("alert-unrecognized-name")
+
+	// TLSActionMITM completes the handshake using a certificate for
+	// the SNI signed by the proxy's CA and then forwards the decrypted
+	// traffic to the destination. Clients that do not trust the CA
+	// will fail with ssl_unknown_authority.
+	TLSActionMITM = TLSAction("mitm")
+
+	// TLSActionBlockPage completes the handshake like TLSActionMITM
+	// and then replies to the first HTTP request with a 451 blockpage.
+	TLSActionBlockPage = TLSAction("blockpage")
+
+	// TLSActionExpiredCertificate is like TLSActionBlockPage except that
+	// the certificate has expired, so clients will fail with
+	// ssl_invalid_certificate even if they trust the proxy's CA.
+	TLSActionExpiredCertificate = TLSAction("expired-certificate")
 )
 
 // TLSProxy is a TLS proxy that routes the traffic depending
 // on the SNI value and may implement filtering policies.
 type TLSProxy struct {
+	// CA is the OPTIONAL CA used to issue certificates when we need
+	// to complete the TLS handshake. If nil, Start creates a new CA.
+	CA *CA
+
+	// Dial is the OPTIONAL function used to connect to the
+	// destination. If nil, we use net.Dial.
+	Dial func(network, address string) (net.Conn, error)
+
+	// OnIncomingALPN is the OPTIONAL hook called for each ALPN
+	// protocol offered by the client when OnIncomingSNI returns
+	// TLSActionPass. The first action that is not TLSActionPass
+	// is the action the proxy will take.
+	OnIncomingALPN func(alpn string) TLSAction
+
 	// OnIncomingSNI is the MANDATORY hook called whenever we have
 	// successfully received a ClientHello message.
 	OnIncomingSNI func(sni string) TLSAction
@@ -51,6 +85,13 @@ func (p *TLSProxy) Start(address string) (net.Listener, error) {
 }
 
 func (p *TLSProxy) start(address string) (net.Listener, <-chan interface{}, error) {
+	if p.CA == nil {
+		ca, err := NewCA()
+		if err != nil {
+			return nil, nil, err
+		}
+		p.CA = ca
+	}
 	listener, err := net.Listen("tcp", address)
 	if err != nil {
 		return nil, nil, err
@@ -86,14 +127,20 @@ const (
 
 func (p *TLSProxy) handle(conn net.Conn) {
 	defer conn.Close()
-	sni, hello, err := p.readClientHello(conn)
+	sni, alpns, hello, err := p.readClientHello(conn)
 	if err != nil {
 		p.reset(conn)
 		return
 	}
-	switch p.OnIncomingSNI(sni) {
+	switch p.action(sni, alpns) {
 	case TLSActionPass:
 		p.proxy(conn, sni, hello)
+	case TLSActionMITM:
+		p.mitm(conn, sni, alpns, hello)
+	case TLSActionBlockPage:
+		p.blockpage(conn, sni, hello, p.CA.NewCertificate)
+	case TLSActionExpiredCertificate:
+		p.blockpage(conn, sni, hello, p.CA.NewExpiredCertificate)
 	case TLSActionTimeout:
 		p.timeout(conn)
 	case TLSActionAlertInternalError:
@@ -107,6 +154,20 @@ func (p *TLSProxy) handle(conn net.Conn) {
 	}
 }
 
+// action returns the action to take given the SNI and the ALPN.
+func (p *TLSProxy) action(sni string, alpns []string) TLSAction {
+	action := p.OnIncomingSNI(sni)
+	if action != TLSActionPass || p.OnIncomingALPN == nil {
+		return action
+	}
+	for _, alpn := range alpns {
+		if action := p.OnIncomingALPN(alpn); action != TLSActionPass {
+			return action
+		}
+	}
+	return TLSActionPass
+}
+
 // readClientHello reads the incoming ClientHello message.
 //
 // Arguments:
@@ -117,28 +178,32 @@ func (p *TLSProxy) handle(conn net.Conn) {
 //
 // - a string containing the SNI (empty on error);
 //
+// - the ALPN protocols offered by the client (nil on error);
+//
 // - bytes from the original ClientHello (nil on error);
 //
 // - an error (nil on success).
-func (p *TLSProxy) readClientHello(conn net.Conn) (string, []byte, error) {
+func (p *TLSProxy) readClientHello(conn net.Conn) (string, []string, []byte, error) {
 	connWrapper := &tlsClientHelloReader{Conn: conn}
 	var (
 		expectedErr = errors.New("cannot continue handhake")
 		sni         string
+		alpns       []string
 		mutex       sync.Mutex // just for safety
 	)
 	err := tls.Server(connWrapper, &tls.Config{
 		GetCertificate: func(info *tls.ClientHelloInfo) (*tls.Certificate, error) {
 			mutex.Lock()
 			sni = info.ServerName
+			alpns = info.SupportedProtos
 			mutex.Unlock()
 			return nil, expectedErr
 		},
 	}).Handshake()
 	if !errors.Is(err, expectedErr) {
-		return "", nil, err
+		return "", nil, nil, err
 	}
-	return sni, connWrapper.clientHello, nil
+	return sni, alpns, connWrapper.clientHello, nil
 }
 
 // tlsClientHelloReader wraps a net.Conn for the purpose of
@@ -194,7 +259,15 @@ func (p *TLSProxy) alert(conn net.Conn, code byte) {
 }
 
 func (p *TLSProxy) proxy(conn net.Conn, sni string, hello []byte) {
-	p.proxydial(conn, sni, hello, net.Dial)
+	p.proxydial(conn, sni, hello, p.dial())
+}
+
+// dial returns the function to connect to the destination.
+func (p *TLSProxy) dial() func(network, address string) (net.Conn, error) {
+	if p.Dial != nil {
+		return p.Dial
+	}
+	return net.Dial
 }
 
 func (p *TLSProxy) proxydial(conn net.Conn, sni string, hello []byte,
@@ -239,3 +312,116 @@ func (p *TLSProxy) forward(wg *sync.WaitGroup, left net.Conn, right net.Conn) {
 	defer wg.Done()
 	netxlite.CopyContext(context.Background(), left, right)
 }
+
+// tlsReplayConn is a net.Conn that returns the bytes of the
+// ClientHello we have already read before reading from the
+// underlying connection.
+type tlsReplayConn struct {
+	net.Conn
+	pending *bytes.Reader
+}
+
+func (c *tlsReplayConn) Read(b []byte) (int, error) {
+	if c.pending.Len() > 0 {
+		return c.pending.Read(b)
+	}
+	return c.Conn.Read(b)
+}
+
+// serverHandshake completes the TLS handshake with the client using
+// the given certificate and the given ALPN protocols.
+func (p *TLSProxy) serverHandshake(conn net.Conn, hello []byte,
+	cert *tls.Certificate, alpns []string) (*tls.Conn, error) {
+	replayConn := &tlsReplayConn{Conn: conn, pending: bytes.NewReader(hello)}
+	tlsConn := tls.Server(replayConn, &tls.Config{
+		Certificates: []tls.Certificate{*cert},
+		NextProtos:   alpns,
+	})
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+func (p *TLSProxy) blockpage(conn net.Conn, sni string, hello []byte,
+	newCert func(sni string) (*tls.Certificate, error)) {
+	if sni == "" { // don't know for which host to issue the certificate
+		p.reset(conn)
+		return
+	}
+	cert, err := newCert(sni)
+	if err != nil {
+		p.reset(conn)
+		return
+	}
+	tlsConn, err := p.serverHandshake(conn, hello, cert, []string{"http/1.1"})
+	if err != nil {
+		return // conn is owned by the caller
+	}
+	req, err := http.ReadRequest(bufio.NewReader(tlsConn))
+	if err != nil {
+		return
+	}
+	resp := &http.Response{
+		StatusCode:    http.StatusUnavailableForLegalReasons,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Request:       req,
+		Header:        http.Header{"Content-Type": {"text/html"}},
+		Body:          io.NopCloser(bytes.NewReader(httpBlockpage451)),
+		ContentLength: int64(len(httpBlockpage451)),
+		Close:         true,
+	}
+	resp.Write(tlsConn)
+	tlsConn.Close()
+}
+
+func (p *TLSProxy) mitm(conn net.Conn, sni string, alpns []string, hello []byte) {
+	p.mitmdial(conn, sni, alpns, hello, p.dial(), netxlite.NewDefaultCertPool())
+}
+
+func (p *TLSProxy) mitmdial(conn net.Conn, sni string, alpns []string, hello []byte,
+	dial func(network, address string) (net.Conn, error), rootCAs *x509.CertPool) {
+	if sni == "" { // don't know the destination host
+		p.reset(conn)
+		return
+	}
+	cert, err := p.CA.NewCertificate(sni)
+	if err != nil {
+		p.reset(conn)
+		return
+	}
+	// Note: we complete the handshake with the client before connecting
+	// to the destination, so clients not trusting our CA fail without
+	// us touching the network. We then ask the destination to use the
+	// same ALPN protocol we have negotiated with the client.
+	tlsConn, err := p.serverHandshake(conn, hello, cert, alpns)
+	if err != nil {
+		return // conn is owned by the caller
+	}
+	defer tlsConn.Close()
+	serverconn, err := dial("tcp", net.JoinHostPort(sni, "443"))
+	if err != nil {
+		return
+	}
+	defer serverconn.Close()
+	if p.connectingToMyself(serverconn) {
+		return
+	}
+	config := &tls.Config{
+		ServerName: sni,
+		RootCAs:    rootCAs,
+	}
+	if proto := tlsConn.ConnectionState().NegotiatedProtocol; proto != "" {
+		config.NextProtos = []string{proto}
+	}
+	tlsServerConn := tls.Client(serverconn, config)
+	if err := tlsServerConn.Handshake(); err != nil {
+		return
+	}
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+	go p.forward(wg, tlsConn, tlsServerConn)
+	go p.forward(wg, tlsServerConn, tlsConn)
+	wg.Wait()
+}
@@ -1,10 +1,14 @@
 package filtering
 
 import (
+	"bufio"
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
@@ -13,6 +17,15 @@ import (
 	"github.com/ooni/probe-cli/v3/internal/netxlite"
 )
 
+// tlsProxyTestConnWithLocalAddr is a net.Conn with a fake local address.
+type tlsProxyTestConnWithLocalAddr struct {
+	net.Conn
+}
+
+func (c *tlsProxyTestConnWithLocalAddr) LocalAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1)}
+}
+
 func TestTLSProxy(t *testing.T) {
 	newproxy := func(action TLSAction) (net.Listener, <-chan interface{}, error) {
 		p := &TLSProxy{
@@ -134,6 +147,226 @@ func TestTLSProxy(t *testing.T) {
 		<-done // wait for background goroutine to exit
 	})
 
+	t.Run("TLSActionMITM with a client not trusting the CA", func(t *testing.T) {
+		ctx := context.Background()
+		listener, done, err := newproxy(TLSActionMITM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn, err := dialTLS(ctx, listener.Addr().String(), "dns.google")
+		if err == nil || err.Error() != netxlite.FailureSSLUnknownAuthority {
+			t.Fatal("unexpected err", err)
+		}
+		if conn != nil {
+			t.Fatal("expected nil conn")
+		}
+		listener.Close()
+		<-done // wait for background goroutine to exit
+	})
+
+	// getBlockpage fetches the blockpage using a client trusting the CA.
+	getBlockpage := func(ctx context.Context, p *TLSProxy,
+		endpoint string, sni string) (*http.Response, error) {
+		d := netxlite.NewDialerWithoutResolver(log.Log)
+		th := netxlite.NewTLSHandshakerStdlib(log.Log)
+		tdx := netxlite.NewTLSDialerWithConfig(d, th, &tls.Config{
+			ServerName: sni,
+			NextProtos: []string{"h2", "http/1.1"},
+			RootCAs:    p.CA.CertPool(),
+		})
+		conn, err := tdx.DialTLSContext(ctx, "tcp", endpoint)
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+		if _, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: " + sni + "\r\n\r\n")); err != nil {
+			return nil, err
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if _, err := netxlite.ReadAllContext(ctx, resp.Body); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+
+	t.Run("TLSActionBlockPage", func(t *testing.T) {
+		ctx := context.Background()
+		p := &TLSProxy{
+			OnIncomingSNI: func(sni string) TLSAction {
+				return TLSActionBlockPage
+			},
+		}
+		listener, done, err := p.start("127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := getBlockpage(ctx, p, listener.Addr().String(), "dns.google")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusUnavailableForLegalReasons {
+			t.Fatal("unexpected status code", resp.StatusCode)
+		}
+		listener.Close()
+		<-done // wait for background goroutine to exit
+	})
+
+	t.Run("TLSActionBlockPage fails because we don't have SNI", func(t *testing.T) {
+		ctx := context.Background()
+		listener, done, err := newproxy(TLSActionBlockPage)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn, err := dialTLS(ctx, listener.Addr().String(), "127.0.0.1")
+		if err == nil || err.Error() != netxlite.FailureConnectionReset {
+			t.Fatal("unexpected err", err)
+		}
+		if conn != nil {
+			t.Fatal("expected nil conn")
+		}
+		listener.Close()
+		<-done // wait for background goroutine to exit
+	})
+
+	t.Run("TLSActionExpiredCertificate", func(t *testing.T) {
+		ctx := context.Background()
+		p := &TLSProxy{
+			OnIncomingSNI: func(sni string) TLSAction {
+				return TLSActionExpiredCertificate
+			},
+		}
+		listener, done, err := p.start("127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := getBlockpage(ctx, p, listener.Addr().String(), "dns.google")
+		if err == nil || err.Error() != netxlite.FailureSSLInvalidCertificate {
+			t.Fatal("unexpected err", err)
+		}
+		if resp != nil {
+			t.Fatal("expected nil resp")
+		}
+		listener.Close()
+		<-done // wait for background goroutine to exit
+	})
+
+	t.Run("OnIncomingALPN", func(t *testing.T) {
+		t.Run("when an offered ALPN matches", func(t *testing.T) {
+			ctx := context.Background()
+			p := &TLSProxy{
+				OnIncomingALPN: func(alpn string) TLSAction {
+					if alpn == "http/1.1" {
+						return TLSActionReset
+					}
+					return TLSActionPass
+				},
+				OnIncomingSNI: func(sni string) TLSAction {
+					return TLSActionPass
+				},
+			}
+			listener, done, err := p.start("127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn, err := dialTLS(ctx, listener.Addr().String(), "dns.google")
+			if err == nil || err.Error() != netxlite.FailureConnectionReset {
+				t.Fatal("unexpected err", err)
+			}
+			if conn != nil {
+				t.Fatal("expected nil conn")
+			}
+			listener.Close()
+			<-done // wait for background goroutine to exit
+		})
+
+		t.Run("the SNI takes precedence", func(t *testing.T) {
+			ctx := context.Background()
+			p := &TLSProxy{
+				OnIncomingALPN: func(alpn string) TLSAction {
+					return TLSActionReset
+				},
+				OnIncomingSNI: func(sni string) TLSAction {
+					return TLSActionEOF
+				},
+			}
+			listener, done, err := p.start("127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn, err := dialTLS(ctx, listener.Addr().String(), "dns.google")
+			if err == nil || err.Error() != netxlite.FailureEOFError {
+				t.Fatal("unexpected err", err)
+			}
+			if conn != nil {
+				t.Fatal("expected nil conn")
+			}
+			listener.Close()
+			<-done // wait for background goroutine to exit
+		})
+	})
+
+	t.Run("mitmdial forwards the decrypted traffic", func(t *testing.T) {
+		srvr := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("hello, world"))
+		}))
+		defer srvr.Close()
+		rootCAs := x509.NewCertPool()
+		rootCAs.AddCert(srvr.Certificate())
+		ca, err := NewCA()
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := &TLSProxy{CA: ca}
+		left, right := net.Pipe()
+		go func() {
+			defer right.Close()
+			sni, alpns, hello, err := p.readClientHello(right)
+			if err != nil {
+				return
+			}
+			p.mitmdial(right, sni, alpns, hello, func(network, address string) (net.Conn, error) {
+				conn, err := net.Dial(network, srvr.Listener.Addr().String())
+				if err != nil {
+					return nil, err
+				}
+				// pretend we're not connecting to ourselves
+				return &tlsProxyTestConnWithLocalAddr{Conn: conn}, nil
+			}, rootCAs)
+		}()
+		client := &http.Client{
+			Transport: &http.Transport{
+				DialTLSContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+					conn := tls.Client(left, &tls.Config{
+						ServerName: "example.com",
+						NextProtos: []string{"http/1.1"},
+						RootCAs:    ca.CertPool(),
+					})
+					if err := conn.HandshakeContext(ctx); err != nil {
+						return nil, err
+					}
+					return conn, nil
+				},
+			},
+		}
+		defer client.CloseIdleConnections()
+		resp, err := client.Get("https://example.com/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, err := netxlite.ReadAllContext(context.Background(), resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "hello, world" {
+			t.Fatal("unexpected body", string(data))
+		}
+	})
+
 	dial := func(ctx context.Context, endpoint string) (net.Conn, error) {
 		d := netxlite.NewDialerWithoutResolver(log.Log)
 		return d.DialContext(ctx, "tcp", endpoint)
@@ -1,12 +1,17 @@
 package filtering
 
 import (
+	"bytes"
 	"context"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/miekg/dns"
@@ -39,10 +44,50 @@ const (
 	// TProxyPolicyHijackHTTP causes the dialer to replace the target
 	// address with the address of the local censored HTTP server.
 	TProxyPolicyHijackHTTP = TProxyPolicy("hijack-http")
+
+	// TProxyPolicyHijackQUIC causes UDP sockets to send the packets
+	// for the target address to the local censored QUIC proxy.
+	TProxyPolicyHijackQUIC = TProxyPolicy("hijack-quic")
+
+	// TProxyPolicyThrottle limits the bandwidth of an established TCP
+	// connection to ThrottleBytesPerSecond after the first ThrottleAfterBytes
+	// bytes have been sent or received. We account for each direction
+	// separately and use the endpoint's TProxyPolicyParams.
+	TProxyPolicyThrottle = TProxyPolicy("throttle")
+
+	// TProxyPolicyResetOnPattern resets an established TCP connection
+	// as soon as the endpoint's ResetPattern appears in the stream of
+	// bytes sent or received, like a keyword-based DPI would do.
+	TProxyPolicyResetOnPattern = TProxyPolicy("reset-on-pattern")
+
+	// TProxyPolicyDelay adds DelayMilliseconds of latency to the connect
+	// and to each write of a TCP connection.
+	TProxyPolicyDelay = TProxyPolicy("delay")
 )
 
+// TProxyPolicyParams contains the parameters of the endpoint policies.
+type TProxyPolicyParams struct {
+	// DelayMilliseconds is the latency for TProxyPolicyDelay.
+	DelayMilliseconds int64
+
+	// ResetPattern is the pattern for TProxyPolicyResetOnPattern.
+	ResetPattern string
+
+	// ThrottleAfterBytes is the number of bytes for which
+	// TProxyPolicyThrottle does not limit the bandwidth.
+	ThrottleAfterBytes int64
+
+	// ThrottleBytesPerSecond is the bandwidth for TProxyPolicyThrottle.
+	ThrottleBytesPerSecond int64
+}
+
 // TProxyConfig contains configuration for TProxy.
 type TProxyConfig struct {
+	// ALPNs contains rules for filtering the ALPN protocols offered
+	// by TLS clients. We only apply these rules when the SNIs rules
+	// would otherwise pass the traffic.
+	ALPNs map[string]TLSAction
+
 	// DNSCache is the cached used when the domains policy is "cache". Note
 	// that the map MUST contain FQDNs. That is, you need to append
 	// a final dot to the domain name (e.g., `example.com.`).  If you
@@ -52,6 +97,16 @@ type TProxyConfig struct {
 	// method _before_ using the TProxy.
 	DNSCache map[string][]string
 
+	// DNSParams contains the parameters of the DNS actions that need
+	// them (e.g., the IP addresses returned by the "bogon" action). Note
+	// that the map MUST contain FQDNs. That is, you need to append
+	// a final dot to the domain name (e.g., `example.com.`).  If you
+	// use the NewTProxyConfig factory, you don't need to worry about this
+	// issue, because the factory will canonicalize non-canonical
+	// entries. Otherwise, you can explicitly call the CanonicalizeDNS
+	// method _before_ using the TProxy.
+	DNSParams map[string]*DNSActionParams
+
 	// Domains contains rules for filtering the lookup of domains. Note
 	// that the map MUST contain FQDNs. That is, you need to append
 	// a final dot to the domain name (e.g., `example.com.`).  If you
@@ -61,14 +116,36 @@ type TProxyConfig struct {
 	// method _before_ using the TProxy.
 	Domains map[string]DNSAction
 
-	// Endpoints contains rules for filtering TCP/UDP endpoints.
+	// Endpoints contains rules for filtering TCP/UDP endpoints (e.g.,
+	// `8.8.8.8:443/tcp`). You can use `*` instead of the IP address
+	// (e.g., `*:443/tcp`) to write a rule matching any address. When
+	// both kinds of rules match, the rule with the address wins.
 	Endpoints map[string]TProxyPolicy
 
+	// EndpointParams contains the parameters of the endpoint policies
+	// that need them (e.g., the bandwidth used by the "throttle" policy)
+	// indexed by endpoint (e.g., `8.8.8.8:443/tcp`).
+	EndpointParams map[string]*TProxyPolicyParams
+
 	// SNIs contains rules for filtering TLS SNIs.
 	SNIs map[string]TLSAction
 
 	// Hosts contains rules for filtering by HTTP host.
 	Hosts map[string]HTTPAction
+
+	// HTTPParams contains the parameters of the HTTP actions that
+	// need them (e.g., the blockpage returned by the "200" action)
+	// indexed by HTTP host.
+	HTTPParams map[string]*HTTPActionParams
+
+	// QUICSNIs contains rules for filtering the SNIs of QUIC
+	// connections that we hijack using the "hijack-quic" policy.
+	QUICSNIs map[string]QUICAction
+
+	// QUICParams contains the parameters of the QUIC actions that
+	// need them (e.g., the number of packets to pass before dropping
+	// with the "drop-after" action) indexed by SNI.
+	QUICParams map[string]*QUICActionParams
 }
 
 // NewTProxyConfig reads the TProxyConfig from the given file.
@@ -98,10 +175,18 @@ func (c *TProxyConfig) CanonicalizeDNS() {
 		cache[dns.CanonicalName(domain)] = addrs
 	}
 	c.DNSCache = cache
+	params := make(map[string]*DNSActionParams)
+	for domain, value := range c.DNSParams {
+		params[dns.CanonicalName(domain)] = value
+	}
+	c.DNSParams = params
 }
 
 // TProxy is a model.UnderlyingNetworkLibrary that implements self censorship.
 type TProxy struct {
+	// ca is the CA used by the TLS proxy.
+	ca *CA
+
 	// config contains settings for TProxy.
 	config *TProxyConfig
 
@@ -120,8 +205,15 @@ type TProxy struct {
 	// logger is the underlying logger to use.
 	logger model.InfoLogger
 
+	// quicListener is the QUIC listener.
+	quicListener net.PacketConn
+
 	// tlsListener is the TLS listener.
 	tlsListener net.Listener
+
+	// underlying is the OPTIONAL underlying network. When it is nil, we
+	// use the stdlib and the proxies use their default upstreams.
+	underlying model.UnderlyingNetworkLibrary
 }
 
 //
@@ -130,18 +222,27 @@ type TProxy struct {
 
 // NewTProxy creates a new TProxy instance.
 func NewTProxy(config *TProxyConfig, logger model.InfoLogger) (*TProxy, error) {
-	return newTProxy(config, logger, "127.0.0.1:0", "127.0.0.1:0", "127.0.0.1:0")
+	return newTProxy(config, logger, nil, "127.0.0.1:0", "127.0.0.1:0", "127.0.0.1:0", "127.0.0.1:0")
 }
 
-func newTProxy(config *TProxyConfig, logger model.InfoLogger, dnsListenerAddr,
-	tlsListenerAddr, httpListenerAddr string) (*TProxy, error) {
+// NewTProxyWithUnderlyingNetwork is like NewTProxy except that the TProxy
+// censors the given underlying network rather than the stdlib. The DNS,
+// TLS, HTTP and QUIC proxies also use the underlying network to reach the
+// destination when the traffic passes. This allows to censor a simulated
+// network (e.g., for running experiments against a censored world).
+func NewTProxyWithUnderlyingNetwork(config *TProxyConfig, logger model.InfoLogger,
+	underlying model.UnderlyingNetworkLibrary) (*TProxy, error) {
+	return newTProxy(config, logger, underlying, "127.0.0.1:0", "127.0.0.1:0", "127.0.0.1:0", "127.0.0.1:0")
+}
+
+func newTProxy(config *TProxyConfig, logger model.InfoLogger, underlying model.UnderlyingNetworkLibrary,
+	dnsListenerAddr, tlsListenerAddr, httpListenerAddr, quicListenerAddr string) (*TProxy, error) {
 	p := &TProxy{
-		config: config,
-		listenUDP: func(network string, laddr *net.UDPAddr) (model.UDPLikeConn, error) {
-			return net.ListenUDP(network, laddr)
-		},
-		logger: logger,
+		config:     config,
+		logger:     logger,
+		underlying: underlying,
 	}
+	p.listenUDP = p.underlyingNetwork().ListenUDP
 	if err := p.newDNSListener(dnsListenerAddr); err != nil {
 		return nil, err
 	}
@@ -155,12 +256,25 @@ func newTProxy(config *TProxyConfig, logger model.InfoLogger, dnsListenerAddr,
 		p.tlsListener.Close()
 		return nil, err
 	}
+	if err := p.newQUICListener(quicListenerAddr); err != nil {
+		p.dnsListener.Close()
+		p.tlsListener.Close()
+		p.httpListener.Close()
+		return nil, err
+	}
 	return p, nil
 }
 
 func (p *TProxy) newDNSListener(listenAddr string) error {
 	var err error
-	dnsProxy := &DNSProxy{Cache: p.config.DNSCache, OnQuery: p.onQuery}
+	dnsProxy := &DNSProxy{
+		Cache:   p.config.DNSCache,
+		OnQuery: p.onQuery,
+		Params:  p.config.DNSParams,
+	}
+	if p.underlying != nil {
+		dnsProxy.Upstream = &tProxyDNSTransport{underlying: p.underlying}
+	}
 	p.dnsListener, err = dnsProxy.Start(listenAddr)
 	return err
 }
@@ -172,23 +286,133 @@ func (p *TProxy) newDNSClient(logger model.DebugLogger) {
 
 func (p *TProxy) newTLSListener(listenAddr string, logger model.DebugLogger) error {
 	var err error
-	tlsProxy := &TLSProxy{OnIncomingSNI: p.onIncomingSNI}
+	tlsProxy := &TLSProxy{
+		OnIncomingALPN: p.onIncomingALPN,
+		OnIncomingSNI:  p.onIncomingSNI,
+	}
+	if p.underlying != nil {
+		tlsProxy.Dial = p.dialUnderlying
+	}
 	p.tlsListener, err = tlsProxy.Start(listenAddr)
+	p.ca = tlsProxy.CA
 	return err
 }
 
+// CA returns the CA used to issue certificates when the TLS proxy
+// needs to complete the TLS handshake (e.g., with the "mitm" action).
+func (p *TProxy) CA() *CA {
+	return p.ca
+}
+
 func (p *TProxy) newHTTPListener(listenAddr string) error {
 	var err error
-	httpProxy := &HTTPProxy{OnIncomingHost: p.onIncomingHost}
+	httpProxy := &HTTPProxy{
+		OnIncomingHost: p.onIncomingHost,
+		Params:         p.config.HTTPParams,
+	}
+	if p.underlying != nil {
+		httpProxy.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return p.dialUnderlying(network, address)
+			},
+			DisableCompression: true,
+		}
+	}
 	p.httpListener, err = httpProxy.Start(listenAddr)
 	return err
 }
 
+func (p *TProxy) newQUICListener(listenAddr string) error {
+	var err error
+	quicProxy := &QUICProxy{
+		OnIncomingSNI: p.onIncomingQUICSNI,
+		Params:        p.config.QUICParams,
+	}
+	if p.underlying != nil {
+		quicProxy.Dial = p.dialUnderlying
+	}
+	p.quicListener, err = quicProxy.Start(listenAddr)
+	return err
+}
+
+// underlyingNetwork returns the underlying network.
+func (p *TProxy) underlyingNetwork() model.UnderlyingNetworkLibrary {
+	if p.underlying != nil {
+		return p.underlying
+	}
+	return &netxlite.TProxyStdlib{}
+}
+
+// tProxyUnderlyingDialTimeout is the timeout used by the proxies when
+// connecting to the destination using the underlying network.
+const tProxyUnderlyingDialTimeout = 15 * time.Second
+
+// dialUnderlying allows the proxies to connect to the destination using
+// the underlying network without applying any censorship policy.
+func (p *TProxy) dialUnderlying(network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), tProxyUnderlyingDialTimeout)
+	defer cancel()
+	addrs := []string{host}
+	if net.ParseIP(host) == nil {
+		addrs, err = p.underlying.LookupHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+	}
+	dialer := p.underlying.NewSimpleDialer(tProxyUnderlyingDialTimeout)
+	for _, addr := range addrs {
+		var conn net.Conn
+		conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(addr, port))
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// tProxyDNSTransport is the DNSTransport that the DNS proxy uses to
+// resolve the queries it passes using the underlying network.
+type tProxyDNSTransport struct {
+	underlying model.UnderlyingNetworkLibrary
+}
+
+// RoundTrip implements DNSTransport.RoundTrip.
+func (txp *tProxyDNSTransport) RoundTrip(ctx context.Context, query []byte) ([]byte, error) {
+	msg := &dns.Msg{}
+	if err := msg.Unpack(query); err != nil {
+		return nil, err
+	}
+	if len(msg.Question) != 1 {
+		return nil, errors.New("unhandled message")
+	}
+	name := strings.TrimSuffix(msg.Question[0].Name, ".")
+	addrs, err := txp.underlying.LookupHost(ctx, name)
+	proxy := &DNSProxy{} // for composing replies
+	switch {
+	case err != nil && strings.HasSuffix(err.Error(), netxlite.DNSNoSuchHostSuffix):
+		return proxy.nxdomain(msg).Pack()
+	case err != nil:
+		return proxy.servfail(msg).Pack()
+	default:
+		return proxy.compose(msg, dnsParseIPs(addrs)...).Pack()
+	}
+}
+
+// CloseIdleConnections implements DNSTransport.CloseIdleConnections.
+func (txp *tProxyDNSTransport) CloseIdleConnections() {
+	// nothing
+}
+
 // Close closes the resources used by a TProxy.
 func (p *TProxy) Close() error {
 	p.dnsClient.CloseIdleConnections()
 	p.dnsListener.Close()
 	p.httpListener.Close()
+	p.quicListener.Close()
 	p.tlsListener.Close()
 	return nil
 }
@@ -213,22 +437,51 @@ type tProxyUDPLikeConn struct {
 
 	// proxy refers to the TProxy.
 	proxy *TProxy
+
+	// hijacked is the address whose packets we have most recently
+	// sent to the local QUIC proxy, or nil.
+	hijacked net.Addr
+
+	// mu provides mutual exclusion for hijacked.
+	mu sync.Mutex
 }
 
 // WriteTo implements UDPLikeConn.WriteTo. This function will
 // apply the proper tproxy policies, if required.
 func (c *tProxyUDPLikeConn) WriteTo(pkt []byte, addr net.Addr) (int, error) {
 	endpoint := fmt.Sprintf("%s/%s", addr.String(), addr.Network())
-	policy := c.proxy.config.Endpoints[endpoint]
+	policy := c.proxy.endpointPolicy(endpoint)
 	switch policy {
 	case TProxyPolicyDropData:
 		c.proxy.logger.Infof("tproxy: WriteTo: %s => %s", endpoint, policy)
 		return len(pkt), nil
+	case TProxyPolicyHijackQUIC:
+		c.proxy.logger.Infof("tproxy: WriteTo: %s => %s", endpoint, policy)
+		c.mu.Lock()
+		c.hijacked = addr
+		c.mu.Unlock()
+		return c.UDPLikeConn.WriteTo(pkt, c.proxy.quicListener.LocalAddr())
 	default:
 		return c.UDPLikeConn.WriteTo(pkt, addr)
 	}
 }
 
+// ReadFrom implements UDPLikeConn.ReadFrom. When we have hijacked the
+// packets, this function pretends that the packets sent by the local
+// QUIC proxy have been sent by the original destination.
+func (c *tProxyUDPLikeConn) ReadFrom(pkt []byte) (int, net.Addr, error) {
+	count, addr, err := c.UDPLikeConn.ReadFrom(pkt)
+	if err != nil {
+		return 0, nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.hijacked != nil && addr.String() == c.proxy.quicListener.LocalAddr().String() {
+		addr = c.hijacked
+	}
+	return count, addr, nil
+}
+
 //
 // System resolver
 //
@@ -238,6 +491,17 @@ func (p *TProxy) LookupHost(ctx context.Context, domain string) ([]string, error
 	return p.dnsClient.LookupHost(ctx, domain)
 }
 
+//
+// Certificates
+//
+
+// DefaultCertPool implements netxlite.TProxy.DefaultCertPool. We return
+// the pool of the underlying network, so that clients do not trust the
+// CA that the TLS proxy uses to perform the man-in-the-middle.
+func (p *TProxy) DefaultCertPool() *x509.CertPool {
+	return p.underlyingNetwork().DefaultCertPool()
+}
+
 //
 // Dialer
 //
@@ -245,7 +509,7 @@ func (p *TProxy) LookupHost(ctx context.Context, domain string) ([]string, error
 // NewSimpleDialer implements netxlite.TProxy.NewTProxyDialer.
 func (p *TProxy) NewSimpleDialer(timeout time.Duration) model.SimpleDialer {
 	return &tProxyDialer{
-		dialer: &net.Dialer{Timeout: timeout},
+		dialer: p.underlyingNetwork().NewSimpleDialer(timeout),
 		proxy:  p,
 	}
 }
@@ -253,7 +517,7 @@ func (p *TProxy) NewSimpleDialer(timeout time.Duration) model.SimpleDialer {
 // tProxyDialer is a TProxy-aware Dialer.
 type tProxyDialer struct {
 	// dialer is the underlying network dialer.
-	dialer *net.Dialer
+	dialer model.SimpleDialer
 
 	// proxy refers to the TProxy.
 	proxy *TProxy
@@ -263,7 +527,8 @@ type tProxyDialer struct {
 // apply the proper tproxy policies, if required.
 func (d *tProxyDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
 	endpoint := fmt.Sprintf("%s/%s", address, network)
-	policy := d.proxy.config.Endpoints[endpoint]
+	policy := d.proxy.endpointPolicy(endpoint)
+	params := d.proxy.endpointParams(endpoint)
 	switch policy {
 	case TProxyPolicyTCPDropSYN:
 		d.proxy.logger.Infof("tproxy: DialContext: %s/%s => %s", address, network, policy)
@@ -285,6 +550,13 @@ func (d *tProxyDialer) DialContext(ctx context.Context, network, address string)
 	case TProxyPolicyHijackHTTP:
 		d.proxy.logger.Infof("tproxy: DialContext: %s/%s => %s", address, network, policy)
 		address = d.proxy.httpListener.Addr().String()
+	case TProxyPolicyDelay:
+		d.proxy.logger.Infof("tproxy: DialContext: %s/%s => %s", address, network, policy)
+		select {
+		case <-time.After(params.delay()):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
 	default:
 		// nothing
 	}
@@ -292,7 +564,18 @@ func (d *tProxyDialer) DialContext(ctx context.Context, network, address string)
 	if err != nil {
 		return nil, err
 	}
-	return &tProxyConn{Conn: conn, proxy: d.proxy}, nil
+	tconn := &tProxyConn{
+		Conn:     conn,
+		proxy:    d.proxy,
+		endpoint: endpoint,
+		policy:   policy,
+		params:   params,
+	}
+	if policy == TProxyPolicyThrottle {
+		tconn.readThrottler = newTProxyThrottler(params)
+		tconn.writeThrottler = newTProxyThrottler(params)
+	}
+	return tconn, nil
 }
 
 // tProxyConn is a TProxy-aware net.Conn.
@@ -302,6 +585,57 @@ type tProxyConn struct {
 
 	// proxy refers to the TProxy.
 	proxy *TProxy
+
+	// endpoint is the endpoint we dialed.
+	endpoint string
+
+	// policy is the policy of the endpoint we dialed.
+	policy TProxyPolicy
+
+	// params contains the policy parameters.
+	params *TProxyPolicyParams
+
+	// readThrottler throttles reads with TProxyPolicyThrottle.
+	readThrottler *tProxyThrottler
+
+	// writeThrottler throttles writes with TProxyPolicyThrottle.
+	writeThrottler *tProxyThrottler
+
+	// mu provides mutual exclusion for the following fields.
+	mu sync.Mutex
+
+	// tail contains the last bytes we have seen in each direction
+	// with TProxyPolicyResetOnPattern, so that we can match patterns
+	// crossing the boundary between two reads or writes.
+	readTail, writeTail []byte
+
+	// reset indicates we have reset the connection.
+	reset bool
+}
+
+// Read implements Conn.Read. This function will apply
+// the proper tproxy policies, if required.
+func (c *tProxyConn) Read(b []byte) (int, error) {
+	switch c.policy {
+	case TProxyPolicyThrottle:
+		b = b[:c.readThrottler.limit(len(b))]
+		count, err := c.Conn.Read(b)
+		c.readThrottler.account(count)
+		return count, err
+	case TProxyPolicyResetOnPattern:
+		if c.isReset() {
+			return 0, netxlite.ECONNRESET
+		}
+		count, err := c.Conn.Read(b)
+		if c.matches(&c.readTail, b[:count]) {
+			c.proxy.logger.Infof("tproxy: Read: %s => %s", c.endpoint, c.policy)
+			c.resetConn()
+			return 0, netxlite.ECONNRESET
+		}
+		return count, err
+	default:
+		return c.Conn.Read(b)
+	}
 }
 
 // Write implements Conn.Write. This function will apply
@@ -309,16 +643,189 @@ type tProxyConn struct {
 func (c *tProxyConn) Write(b []byte) (int, error) {
 	addr := c.Conn.RemoteAddr()
 	endpoint := fmt.Sprintf("%s/%s", addr.String(), addr.Network())
-	policy := c.proxy.config.Endpoints[endpoint]
+	policy := c.proxy.endpointPolicy(endpoint)
 	switch policy {
 	case TProxyPolicyDropData:
 		c.proxy.logger.Infof("tproxy: Write: %s => %s", endpoint, policy)
 		return len(b), nil
+	}
+	switch c.policy {
+	case TProxyPolicyThrottle:
+		var total int
+		for len(b) > 0 {
+			chunk := b[:c.writeThrottler.limit(len(b))]
+			count, err := c.Conn.Write(chunk)
+			c.writeThrottler.account(count)
+			total += count
+			if err != nil {
+				return total, err
+			}
+			b = b[count:]
+		}
+		return total, nil
+	case TProxyPolicyResetOnPattern:
+		if c.isReset() {
+			return 0, netxlite.ECONNRESET
+		}
+		if c.matches(&c.writeTail, b) {
+			c.proxy.logger.Infof("tproxy: Write: %s => %s", c.endpoint, c.policy)
+			c.resetConn()
+			return 0, netxlite.ECONNRESET
+		}
+		return c.Conn.Write(b)
+	case TProxyPolicyDelay:
+		time.Sleep(c.params.delay())
+		return c.Conn.Write(b)
 	default:
 		return c.Conn.Write(b)
 	}
 }
 
+// matches returns whether the ResetPattern appears in the
+// concatenation of tail and data. This function updates tail
+// to contain the last bytes needed for the next match.
+func (c *tProxyConn) matches(tail *[]byte, data []byte) bool {
+	pattern := []byte(c.params.ResetPattern)
+	if len(pattern) <= 0 {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	window := append(append([]byte{}, *tail...), data...)
+	if bytes.Contains(window, pattern) {
+		return true
+	}
+	if keep := len(pattern) - 1; len(window) > keep {
+		window = window[len(window)-keep:]
+	}
+	*tail = window
+	return false
+}
+
+// isReset returns whether we have reset the connection.
+func (c *tProxyConn) isReset() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reset
+}
+
+// resetConn closes the connection such that we send a RST segment.
+func (c *tProxyConn) resetConn() {
+	c.mu.Lock()
+	c.reset = true
+	c.mu.Unlock()
+	if tc, ok := c.Conn.(*net.TCPConn); ok {
+		tc.SetLinger(0)
+	}
+	c.Conn.Close()
+}
+
+// tProxyThrottler limits the bandwidth of a direction of a connection.
+type tProxyThrottler struct {
+	// after is the number of bytes we don't throttle.
+	after int64
+
+	// rate is the bandwidth in bytes per second.
+	rate int64
+
+	// count is the number of bytes transferred so far.
+	count int64
+
+	// mu provides mutual exclusion for count.
+	mu sync.Mutex
+
+	// sleep allows mocking time.Sleep in tests.
+	sleep func(d time.Duration)
+}
+
+// newTProxyThrottler creates a new tProxyThrottler.
+func newTProxyThrottler(params *TProxyPolicyParams) *tProxyThrottler {
+	return &tProxyThrottler{
+		after: params.ThrottleAfterBytes,
+		rate:  params.ThrottleBytesPerSecond,
+		sleep: time.Sleep,
+	}
+}
+
+// tProxyThrottlerChunksPerSecond is the number of chunks per second
+// in which we split the transfers once we start throttling.
+const tProxyThrottlerChunksPerSecond = 10
+
+// limit returns the maximum number of bytes that the next I/O
+// operation should transfer given a buffer of size bytes.
+func (t *tProxyThrottler) limit(size int) int {
+	if t.rate <= 0 {
+		return size
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	max := t.rate / tProxyThrottlerChunksPerSecond
+	if t.count < t.after {
+		max = t.after - t.count
+	}
+	if max < 1 {
+		max = 1
+	}
+	if int64(size) > max {
+		return int(max)
+	}
+	return size
+}
+
+// account accounts for count bytes transferred and sleeps for as
+// long as needed to honour the bandwidth, if we're throttling.
+func (t *tProxyThrottler) account(count int) {
+	if t.rate <= 0 || count <= 0 {
+		return
+	}
+	t.mu.Lock()
+	throttling := t.count >= t.after
+	t.count += int64(count)
+	t.mu.Unlock()
+	if throttling {
+		t.sleep(time.Duration(count) * time.Second / time.Duration(t.rate))
+	}
+}
+
+// endpointPolicy returns the policy of the given endpoint.
+func (p *TProxy) endpointPolicy(endpoint string) TProxyPolicy {
+	if policy, found := p.config.Endpoints[endpoint]; found {
+		return policy
+	}
+	return p.config.Endpoints[tProxyWildcardEndpoint(endpoint)]
+}
+
+// endpointParams returns the parameters of the given endpoint.
+func (p *TProxy) endpointParams(endpoint string) *TProxyPolicyParams {
+	if params := p.config.EndpointParams[endpoint]; params != nil {
+		return params
+	}
+	if params := p.config.EndpointParams[tProxyWildcardEndpoint(endpoint)]; params != nil {
+		return params
+	}
+	return &TProxyPolicyParams{}
+}
+
+// tProxyWildcardEndpoint converts an endpoint like `8.8.8.8:443/tcp`
+// to the corresponding wildcard endpoint `*:443/tcp`. This function
+// returns an empty string if the endpoint is not valid.
+func tProxyWildcardEndpoint(endpoint string) string {
+	idx := strings.LastIndex(endpoint, "/")
+	if idx < 0 {
+		return ""
+	}
+	_, port, err := net.SplitHostPort(endpoint[:idx])
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("*:%s%s", port, endpoint[idx:])
+}
+
+// delay returns the delay for TProxyPolicyDelay.
+func (p *TProxyPolicyParams) delay() time.Duration {
+	return time.Duration(p.DelayMilliseconds) * time.Millisecond
+}
+
 //
 // Filtering policies implementation
 //
@@ -345,6 +852,28 @@ func (p *TProxy) onIncomingSNI(sni string) TLSAction {
 	return policy
 }
 
+// onIncomingALPN is called for filtering ALPN values.
+func (p *TProxy) onIncomingALPN(alpn string) TLSAction {
+	policy := p.config.ALPNs[alpn]
+	if policy == "" {
+		policy = TLSActionPass
+	} else {
+		p.logger.Infof("tproxy: ALPN: %s => %s", alpn, policy)
+	}
+	return policy
+}
+
+// onIncomingQUICSNI is called for filtering QUIC SNI values.
+func (p *TProxy) onIncomingQUICSNI(sni string) QUICAction {
+	policy := p.config.QUICSNIs[sni]
+	if policy == "" {
+		policy = QUICActionPass
+	} else {
+		p.logger.Infof("tproxy: QUIC: %s => %s", sni, policy)
+	}
+	return policy
+}
+
 // onIncomingHost is called for filtering HTTP hosts.
 func (p *TProxy) onIncomingHost(host string) HTTPAction {
 	policy := p.config.Hosts[host]
@@ -3,9 +3,13 @@ package filtering
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"io"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"path/filepath"
 	"strings"
 	"syscall"
@@ -13,6 +17,7 @@ import (
 	"time"
 
 	"github.com/apex/log"
+	"github.com/lucas-clemente/quic-go"
 	"github.com/ooni/probe-cli/v3/internal/model"
 	"github.com/ooni/probe-cli/v3/internal/model/mocks"
 	"github.com/ooni/probe-cli/v3/internal/netxlite"
@@ -63,6 +68,9 @@ func TestNewTProxyConfig(t *testing.T) {
 		if len(config.DNSCache["dns.google."]) != 2 {
 			t.Fatal("did not auto-canonicalize config.DNSCache")
 		}
+		if config.DNSParams["example.com."] == nil {
+			t.Fatal("did not auto-canonicalize config.DNSParams")
+		}
 	})
 }
 
@@ -80,7 +88,7 @@ func TestNewTProxy(t *testing.T) {
 
 	t.Run("cannot create DNS listener", func(t *testing.T) {
 		config := &TProxyConfig{}
-		proxy, err := newTProxy(config, log.Log, "127.0.0.1", "", "")
+		proxy, err := newTProxy(config, log.Log, nil, "127.0.0.1", "", "", "")
 		if err == nil || !strings.HasSuffix(err.Error(), "missing port in address") {
 			t.Fatal("unexpected err", err)
 		}
@@ -91,7 +99,7 @@ func TestNewTProxy(t *testing.T) {
 
 	t.Run("cannot create TLS listener", func(t *testing.T) {
 		config := &TProxyConfig{}
-		proxy, err := newTProxy(config, log.Log, "127.0.0.1:0", "127.0.0.1", "")
+		proxy, err := newTProxy(config, log.Log, nil, "127.0.0.1:0", "127.0.0.1", "", "")
 		if err == nil || !strings.HasSuffix(err.Error(), "missing port in address") {
 			t.Fatal("unexpected err", err)
 		}
@@ -102,7 +110,18 @@ func TestNewTProxy(t *testing.T) {
 
 	t.Run("cannot create HTTP listener", func(t *testing.T) {
 		config := &TProxyConfig{}
-		proxy, err := newTProxy(config, log.Log, "127.0.0.1:0", "127.0.0.1:0", "127.0.0.1")
+		proxy, err := newTProxy(config, log.Log, nil, "127.0.0.1:0", "127.0.0.1:0", "127.0.0.1", "")
+		if err == nil || !strings.HasSuffix(err.Error(), "missing port in address") {
+			t.Fatal("unexpected err", err)
+		}
+		if proxy != nil {
+			t.Fatal("expected nil proxy here")
+		}
+	})
+
+	t.Run("cannot create QUIC listener", func(t *testing.T) {
+		config := &TProxyConfig{}
+		proxy, err := newTProxy(config, log.Log, nil, "127.0.0.1:0", "127.0.0.1:0", "127.0.0.1:0", "127.0.0.1")
 		if err == nil || !strings.HasSuffix(err.Error(), "missing port in address") {
 			t.Fatal("unexpected err", err)
 		}
@@ -224,6 +243,158 @@ func TestTProxyQUIC(t *testing.T) {
 				t.Fatal("called")
 			}
 		})
+
+		t.Run("with the hijack-quic policy", func(t *testing.T) {
+			config := &TProxyConfig{
+				Endpoints: map[string]TProxyPolicy{
+					"8.8.8.8:443/udp": TProxyPolicyHijackQUIC,
+				},
+			}
+			proxy, err := NewTProxy(config, log.Log)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer proxy.Close()
+			var gotAddr net.Addr
+			proxy.listenUDP = func(network string, laddr *net.UDPAddr) (model.UDPLikeConn, error) {
+				return &mocks.UDPLikeConn{
+					MockWriteTo: func(p []byte, addr net.Addr) (int, error) {
+						gotAddr = addr
+						return len(p), nil
+					},
+				}, nil
+			}
+			pconn, err := proxy.ListenUDP("udp", &net.UDPAddr{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			data := make([]byte, 128)
+			destAddr := &net.UDPAddr{IP: net.IPv4(8, 8, 8, 8), Port: 443}
+			count, err := pconn.WriteTo(data, destAddr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != len(data) {
+				t.Fatal("unexpected number of bytes written")
+			}
+			if gotAddr.String() != proxy.quicListener.LocalAddr().String() {
+				t.Fatal("packet not sent to the QUIC proxy", gotAddr)
+			}
+			if pconn.(*tProxyUDPLikeConn).hijacked != destAddr {
+				t.Fatal("hijacked address not recorded")
+			}
+		})
+	})
+
+	t.Run("ReadFrom", func(t *testing.T) {
+		// newConn returns a conn whose ReadFrom returns addr and err.
+		newConn := func(t *testing.T, addr net.Addr, err error) (*TProxy, *tProxyUDPLikeConn) {
+			proxy, perr := NewTProxy(&TProxyConfig{}, log.Log)
+			if perr != nil {
+				t.Fatal(perr)
+			}
+			proxy.listenUDP = func(network string, laddr *net.UDPAddr) (model.UDPLikeConn, error) {
+				return &mocks.UDPLikeConn{
+					MockReadFrom: func(p []byte) (int, net.Addr, error) {
+						if err != nil {
+							return 0, nil, err
+						}
+						return len(p), addr, nil
+					},
+				}, nil
+			}
+			pconn, perr := proxy.ListenUDP("udp", &net.UDPAddr{})
+			if perr != nil {
+				t.Fatal(perr)
+			}
+			return proxy, pconn.(*tProxyUDPLikeConn)
+		}
+
+		t.Run("on failure", func(t *testing.T) {
+			expected := errors.New("mocked error")
+			proxy, pconn := newConn(t, nil, expected)
+			defer proxy.Close()
+			count, addr, err := pconn.ReadFrom(make([]byte, 128))
+			if !errors.Is(err, expected) {
+				t.Fatal("unexpected err", err)
+			}
+			if count != 0 || addr != nil {
+				t.Fatal("unexpected count or addr")
+			}
+		})
+
+		t.Run("without hijacking", func(t *testing.T) {
+			srcAddr := &net.UDPAddr{IP: net.IPv4(8, 8, 4, 4), Port: 443}
+			proxy, pconn := newConn(t, srcAddr, nil)
+			defer proxy.Close()
+			_, addr, err := pconn.ReadFrom(make([]byte, 128))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if addr != srcAddr {
+				t.Fatal("unexpected addr", addr)
+			}
+		})
+
+		t.Run("with hijacking", func(t *testing.T) {
+			proxy, err := NewTProxy(&TProxyConfig{}, log.Log)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer proxy.Close()
+			pconn := &tProxyUDPLikeConn{
+				UDPLikeConn: &mocks.UDPLikeConn{
+					MockReadFrom: func(p []byte) (int, net.Addr, error) {
+						return len(p), proxy.quicListener.LocalAddr(), nil
+					},
+				},
+				proxy:    proxy,
+				hijacked: &net.UDPAddr{IP: net.IPv4(8, 8, 8, 8), Port: 443},
+			}
+			_, addr, err := pconn.ReadFrom(make([]byte, 128))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if addr != pconn.hijacked {
+				t.Fatal("unexpected addr", addr)
+			}
+		})
+	})
+
+	t.Run("with the hijack-quic policy and filtering", func(t *testing.T) {
+		config := &TProxyConfig{
+			Endpoints: map[string]TProxyPolicy{
+				"8.8.8.8:443/udp": TProxyPolicyHijackQUIC,
+			},
+			QUICSNIs: map[string]QUICAction{
+				"dns.google": QUICActionDrop,
+			},
+		}
+		proxy, err := NewTProxy(config, log.Log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer proxy.Close()
+		pconn, err := proxy.ListenUDP("udp", &net.UDPAddr{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pconn.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		destAddr := &net.UDPAddr{IP: net.IPv4(8, 8, 8, 8), Port: 443}
+		tlsConfig := &tls.Config{ServerName: "dns.google", NextProtos: []string{"h3"}}
+		quicConfig := &quic.Config{HandshakeIdleTimeout: time.Second}
+		sess, err := quic.DialEarlyContext(
+			ctx, pconn, destAddr, "dns.google", tlsConfig, quicConfig)
+		if err == nil {
+			sess.CloseWithError(0, "")
+			t.Fatal("expected an error here")
+		}
+		var nerr net.Error
+		if !errors.As(err, &nerr) || !nerr.Timeout() {
+			t.Fatal("unexpected err", err)
+		}
 	})
 }
 
@@ -325,6 +496,97 @@ func TestTProxyOnIncomingSNI(t *testing.T) {
 	})
 }
 
+func TestTProxyTLSMITM(t *testing.T) {
+	// handshake dials 8.8.8.8:443 using the proxy and performs a TLS
+	// handshake for dns.google using the given root CAs.
+	handshake := func(proxy *TProxy, rootCAs *x509.CertPool, alpn ...string) (net.Conn, error) {
+		ctx := context.Background()
+		dialer := proxy.NewSimpleDialer(10 * time.Second)
+		conn, err := dialer.DialContext(ctx, "tcp", "8.8.8.8:443")
+		if err != nil {
+			return nil, err
+		}
+		tlsh := netxlite.NewTLSHandshakerStdlib(log.Log)
+		tconn, _, err := tlsh.Handshake(ctx, conn, &tls.Config{
+			NextProtos: alpn,
+			RootCAs:    rootCAs,
+			ServerName: "dns.google",
+		})
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tconn, nil
+	}
+
+	t.Run("with a client not trusting the CA", func(t *testing.T) {
+		config := &TProxyConfig{
+			Endpoints: map[string]TProxyPolicy{
+				"8.8.8.8:443/tcp": TProxyPolicyHijackTLS,
+			},
+			SNIs: map[string]TLSAction{
+				"dns.google": TLSActionMITM,
+			},
+		}
+		proxy, err := NewTProxy(config, log.Log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer proxy.Close()
+		tconn, err := handshake(proxy, netxlite.NewDefaultCertPool())
+		if err == nil || err.Error() != netxlite.FailureSSLUnknownAuthority {
+			t.Fatal("unexpected err", err)
+		}
+		if tconn != nil {
+			t.Fatal("expected nil tconn")
+		}
+	})
+
+	t.Run("with a client trusting the CA", func(t *testing.T) {
+		config := &TProxyConfig{
+			Endpoints: map[string]TProxyPolicy{
+				"8.8.8.8:443/tcp": TProxyPolicyHijackTLS,
+			},
+			SNIs: map[string]TLSAction{
+				"dns.google": TLSActionBlockPage,
+			},
+		}
+		proxy, err := NewTProxy(config, log.Log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer proxy.Close()
+		tconn, err := handshake(proxy, proxy.CA().CertPool())
+		if err != nil {
+			t.Fatal(err)
+		}
+		tconn.Close()
+	})
+
+	t.Run("with ALPN filtering", func(t *testing.T) {
+		config := &TProxyConfig{
+			ALPNs: map[string]TLSAction{
+				"h2": TLSActionExpiredCertificate,
+			},
+			Endpoints: map[string]TProxyPolicy{
+				"8.8.8.8:443/tcp": TProxyPolicyHijackTLS,
+			},
+		}
+		proxy, err := NewTProxy(config, log.Log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer proxy.Close()
+		tconn, err := handshake(proxy, proxy.CA().CertPool(), "h2", "http/1.1")
+		if err == nil || err.Error() != netxlite.FailureSSLInvalidCertificate {
+			t.Fatal("unexpected err", err)
+		}
+		if tconn != nil {
+			t.Fatal("expected nil tconn")
+		}
+	})
+}
+
 func TestTProxyOnIncomingHost(t *testing.T) {
 	t.Run("without filtering", func(t *testing.T) {
 		config := &TProxyConfig{
@@ -386,6 +648,46 @@ func TestTProxyOnIncomingHost(t *testing.T) {
 			t.Fatal("expected nil resp here")
 		}
 	})
+
+	t.Run("with a custom blockpage", func(t *testing.T) {
+		const blockpage = "<html><head><title>Blocked</title></head></html>"
+		config := &TProxyConfig{
+			Endpoints: map[string]TProxyPolicy{
+				"130.192.16.171:80/tcp": TProxyPolicyHijackHTTP,
+			},
+			Hosts: map[string]HTTPAction{
+				"nexa.polito.it": HTTPAction200,
+			},
+			HTTPParams: map[string]*HTTPActionParams{
+				"nexa.polito.it": {Blockpage: blockpage},
+			},
+		}
+		proxy, err := NewTProxy(config, log.Log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer proxy.Close()
+		dialer := &tProxyDialerAdapter{proxy.NewSimpleDialer(10 * time.Second)}
+		req, err := http.NewRequest("GET", "http://130.192.16.171:80", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Host = "nexa.polito.it"
+		txp := &http.Transport{DialContext: dialer.DialContext}
+		defer txp.CloseIdleConnections()
+		resp, err := txp.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, err := netxlite.ReadAllContext(req.Context(), resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != 200 || string(data) != blockpage {
+			t.Fatal("unexpected response", resp.StatusCode, string(data))
+		}
+	})
 }
 
 func TestTProxyDial(t *testing.T) {
@@ -523,6 +825,243 @@ func TestTProxyDial(t *testing.T) {
 	})
 }
 
+// tProxyEchoServer starts a TCP server that writes back whatever it
+// receives. It returns the server's endpoint (e.g., `127.0.0.1:5432/tcp`).
+func tProxyEchoServer(t *testing.T) (net.Listener, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener, listener.Addr().String() + "/tcp"
+}
+
+func TestTProxyTCPPolicies(t *testing.T) {
+	// dial uses the proxy to dial the given listener.
+	dial := func(t *testing.T, config *TProxyConfig, listener net.Listener) (*TProxy, net.Conn) {
+		proxy, err := NewTProxy(config, log.Log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dialer := proxy.NewSimpleDialer(10 * time.Second)
+		conn, err := dialer.DialContext(
+			context.Background(), "tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return proxy, conn
+	}
+
+	t.Run("with throttle", func(t *testing.T) {
+		listener, endpoint := tProxyEchoServer(t)
+		defer listener.Close()
+		config := &TProxyConfig{
+			Endpoints: map[string]TProxyPolicy{
+				endpoint: TProxyPolicyThrottle,
+			},
+			EndpointParams: map[string]*TProxyPolicyParams{
+				endpoint: {
+					ThrottleAfterBytes:     1 << 10,
+					ThrottleBytesPerSecond: 1 << 12,
+				},
+			},
+		}
+		proxy, conn := dial(t, config, listener)
+		defer proxy.Close()
+		defer conn.Close()
+		data := make([]byte, 3<<10)
+		t0 := time.Now()
+		if _, err := conn.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadFull(conn, data); err != nil {
+			t.Fatal(err)
+		}
+		// We send and receive 2 KiB beyond the threshold at 4 KiB/s in
+		// each direction, so the transfer should take at least one second.
+		if elapsed := time.Since(t0); elapsed < 900*time.Millisecond {
+			t.Fatal("transfer was not throttled", elapsed)
+		}
+	})
+
+	t.Run("with reset on pattern", func(t *testing.T) {
+		t.Run("when writing", func(t *testing.T) {
+			listener, endpoint := tProxyEchoServer(t)
+			defer listener.Close()
+			config := &TProxyConfig{
+				Endpoints: map[string]TProxyPolicy{
+					endpoint: TProxyPolicyResetOnPattern,
+				},
+				EndpointParams: map[string]*TProxyPolicyParams{
+					endpoint: {ResetPattern: "Host: example.com"},
+				},
+			}
+			proxy, conn := dial(t, config, listener)
+			defer proxy.Close()
+			defer conn.Close()
+			if _, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: exa")); err != nil {
+				t.Fatal(err)
+			}
+			_, err := conn.Write([]byte("mple.com\r\n\r\n"))
+			if !errors.Is(err, netxlite.ECONNRESET) {
+				t.Fatal("unexpected err", err)
+			}
+			_, err = conn.Write([]byte("x"))
+			if !errors.Is(err, netxlite.ECONNRESET) {
+				t.Fatal("unexpected err", err)
+			}
+		})
+
+		t.Run("when reading", func(t *testing.T) {
+			listener, endpoint := tProxyEchoServer(t)
+			defer listener.Close()
+			config := &TProxyConfig{
+				Endpoints: map[string]TProxyPolicy{
+					endpoint: TProxyPolicyResetOnPattern,
+				},
+				EndpointParams: map[string]*TProxyPolicyParams{
+					endpoint: {ResetPattern: "Host: example.com"},
+				},
+			}
+			proxy, conn := dial(t, config, listener)
+			defer proxy.Close()
+			defer conn.Close()
+			tconn := conn.(*tProxyConn)
+			// write directly on the underlying conn to only match on reads
+			if _, err := tconn.Conn.Write([]byte("Host: example.com")); err != nil {
+				t.Fatal(err)
+			}
+			_, err := io.ReadFull(conn, make([]byte, 17))
+			if !errors.Is(err, netxlite.ECONNRESET) {
+				t.Fatal("unexpected err", err)
+			}
+		})
+
+		t.Run("without a pattern", func(t *testing.T) {
+			listener, endpoint := tProxyEchoServer(t)
+			defer listener.Close()
+			config := &TProxyConfig{
+				Endpoints: map[string]TProxyPolicy{
+					endpoint: TProxyPolicyResetOnPattern,
+				},
+			}
+			proxy, conn := dial(t, config, listener)
+			defer proxy.Close()
+			defer conn.Close()
+			data := []byte("Host: example.com")
+			if _, err := conn.Write(data); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.ReadFull(conn, data); err != nil {
+				t.Fatal(err)
+			}
+		})
+	})
+
+	t.Run("with delay", func(t *testing.T) {
+		listener, endpoint := tProxyEchoServer(t)
+		defer listener.Close()
+		config := &TProxyConfig{
+			Endpoints: map[string]TProxyPolicy{
+				endpoint: TProxyPolicyDelay,
+			},
+			EndpointParams: map[string]*TProxyPolicyParams{
+				endpoint: {DelayMilliseconds: 200},
+			},
+		}
+		t0 := time.Now()
+		proxy, conn := dial(t, config, listener)
+		defer proxy.Close()
+		defer conn.Close()
+		data := []byte("ping")
+		if _, err := conn.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadFull(conn, data); err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Since(t0); elapsed < 400*time.Millisecond {
+			t.Fatal("connection was not delayed", elapsed)
+		}
+	})
+
+	t.Run("with delay and a canceled context", func(t *testing.T) {
+		config := &TProxyConfig{
+			Endpoints: map[string]TProxyPolicy{
+				"127.0.0.1:1234/tcp": TProxyPolicyDelay,
+			},
+			EndpointParams: map[string]*TProxyPolicyParams{
+				"127.0.0.1:1234/tcp": {DelayMilliseconds: 10000},
+			},
+		}
+		proxy, err := NewTProxy(config, log.Log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer proxy.Close()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel() // fail immediately
+		dialer := proxy.NewSimpleDialer(10 * time.Second)
+		conn, err := dialer.DialContext(ctx, "tcp", "127.0.0.1:1234")
+		if !errors.Is(err, context.Canceled) {
+			t.Fatal("unexpected err", err)
+		}
+		if conn != nil {
+			t.Fatal("expected nil conn here")
+		}
+	})
+}
+
+func TestTProxyThrottler(t *testing.T) {
+	var slept time.Duration
+	throttler := newTProxyThrottler(&TProxyPolicyParams{
+		ThrottleAfterBytes:     100,
+		ThrottleBytesPerSecond: 1000,
+	})
+	throttler.sleep = func(d time.Duration) {
+		slept += d
+	}
+	if n := throttler.limit(1 << 10); n != 100 {
+		t.Fatal("unexpected limit", n)
+	}
+	throttler.account(100)
+	if slept != 0 {
+		t.Fatal("should not throttle before the threshold")
+	}
+	if n := throttler.limit(1 << 10); n != 100 {
+		t.Fatal("unexpected limit", n)
+	}
+	throttler.account(100)
+	if slept != 100*time.Millisecond {
+		t.Fatal("unexpected sleep", slept)
+	}
+	if n := throttler.limit(10); n != 10 {
+		t.Fatal("unexpected limit", n)
+	}
+
+	t.Run("without a rate", func(t *testing.T) {
+		throttler := newTProxyThrottler(&TProxyPolicyParams{})
+		throttler.sleep = func(d time.Duration) {
+			t.Fatal("should not sleep")
+		}
+		if n := throttler.limit(1 << 10); n != 1<<10 {
+			t.Fatal("unexpected limit", n)
+		}
+		throttler.account(1 << 10)
+	})
+}
+
 func TestTProxyDNSCache(t *testing.T) {
 	t.Run("without cache but with the cache rule", func(t *testing.T) {
 		config := &TProxyConfig{
@@ -573,3 +1112,247 @@ func TestTProxyDNSCache(t *testing.T) {
 		}
 	})
 }
+
+func TestTProxyDNSParams(t *testing.T) {
+	t.Run("with the bogon rule", func(t *testing.T) {
+		config := &TProxyConfig{
+			DNSParams: map[string]*DNSActionParams{
+				"dns.google": {Addrs: []string{"10.0.0.1"}},
+			},
+			Domains: map[string]DNSAction{
+				"dns.google": DNSActionBogon,
+			},
+		}
+		config.CanonicalizeDNS()
+		proxy, err := NewTProxy(config, log.Log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := context.Background()
+		addrs, err := proxy.LookupHost(ctx, "dns.google")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != 1 || addrs[0] != "10.0.0.1" {
+			t.Fatal("unexpected addrs", addrs)
+		}
+	})
+
+	t.Run("with the cname rule", func(t *testing.T) {
+		config := &TProxyConfig{
+			DNSParams: map[string]*DNSActionParams{
+				"dns.google.": {
+					Addrs: []string{"93.184.216.34"},
+					CNAME: "blockpage.example.com.",
+				},
+			},
+			Domains: map[string]DNSAction{
+				"dns.google.": DNSActionCNAME,
+			},
+		}
+		proxy, err := NewTProxy(config, log.Log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := context.Background()
+		addrs, err := proxy.LookupHost(ctx, "dns.google")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != 1 || addrs[0] != "93.184.216.34" {
+			t.Fatal("unexpected addrs", addrs)
+		}
+	})
+}
+
+func TestTProxyWildcardEndpoints(t *testing.T) {
+	t.Run("tProxyWildcardEndpoint", func(t *testing.T) {
+		expectations := map[string]string{
+			"8.8.8.8:443/tcp":    "*:443/tcp",
+			"[::1]:53/udp":       "*:53/udp",
+			"8.8.8.8:443":        "",
+			"8.8.8.8/tcp":        "",
+			"dns.google:853/tcp": "*:853/tcp",
+		}
+		for endpoint, expected := range expectations {
+			if got := tProxyWildcardEndpoint(endpoint); got != expected {
+				t.Fatal("unexpected result", endpoint, got)
+			}
+		}
+	})
+
+	t.Run("the rule with the address wins", func(t *testing.T) {
+		config := &TProxyConfig{
+			Endpoints: map[string]TProxyPolicy{
+				"*:443/tcp":         TProxyPolicyTCPRejectSYN,
+				"127.0.0.1:443/tcp": TProxyPolicyDropData,
+			},
+			EndpointParams: map[string]*TProxyPolicyParams{
+				"*:443/tcp": {DelayMilliseconds: 10},
+			},
+		}
+		proxy, err := NewTProxy(config, log.Log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer proxy.Close()
+		if policy := proxy.endpointPolicy("127.0.0.1:443/tcp"); policy != TProxyPolicyDropData {
+			t.Fatal("unexpected policy", policy)
+		}
+		if policy := proxy.endpointPolicy("127.0.0.2:443/tcp"); policy != TProxyPolicyTCPRejectSYN {
+			t.Fatal("unexpected policy", policy)
+		}
+		if policy := proxy.endpointPolicy("127.0.0.2:443/udp"); policy != "" {
+			t.Fatal("unexpected policy", policy)
+		}
+		if params := proxy.endpointParams("127.0.0.2:443/tcp"); params.DelayMilliseconds != 10 {
+			t.Fatal("unexpected params", params)
+		}
+	})
+
+	t.Run("with dial", func(t *testing.T) {
+		config := &TProxyConfig{
+			Endpoints: map[string]TProxyPolicy{
+				"*:443/tcp": TProxyPolicyTCPRejectSYN,
+			},
+		}
+		proxy, err := NewTProxy(config, log.Log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer proxy.Close()
+		dialer := proxy.NewSimpleDialer(10 * time.Second)
+		conn, err := dialer.DialContext(context.Background(), "tcp", "8.8.8.8:443")
+		if !errors.Is(err, netxlite.ECONNREFUSED) {
+			t.Fatal("unexpected err", err)
+		}
+		if conn != nil {
+			t.Fatal("expected nil conn here")
+		}
+	})
+}
+
+// tProxyFakeNetwork is an underlying network using the stdlib except
+// for LookupHost, which calls the configured function.
+type tProxyFakeNetwork struct {
+	netxlite.TProxyStdlib
+	lookupHost func(ctx context.Context, domain string) ([]string, error)
+}
+
+// LookupHost implements model.UnderlyingNetworkLibrary.LookupHost.
+func (n *tProxyFakeNetwork) LookupHost(ctx context.Context, domain string) ([]string, error) {
+	return n.lookupHost(ctx, domain)
+}
+
+func TestTProxyUnderlyingNetwork(t *testing.T) {
+	t.Run("DNS", func(t *testing.T) {
+		underlying := &tProxyFakeNetwork{
+			lookupHost: func(ctx context.Context, domain string) ([]string, error) {
+				switch domain {
+				case "www.example.com":
+					return []string{"93.184.216.34", "2606:2800:220:1:248:1893:25c8:1946"}, nil
+				case "www.example.org":
+					return nil, &net.DNSError{Err: "no such host", Name: domain, IsNotFound: true}
+				default:
+					return nil, errors.New("mocked error")
+				}
+			},
+		}
+		proxy, err := NewTProxyWithUnderlyingNetwork(&TProxyConfig{}, log.Log, underlying)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer proxy.Close()
+		ctx := context.Background()
+
+		t.Run("with success", func(t *testing.T) {
+			addrs, err := proxy.LookupHost(ctx, "www.example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(addrs) != 2 {
+				t.Fatal("unexpected addrs", addrs)
+			}
+		})
+
+		t.Run("with NXDOMAIN", func(t *testing.T) {
+			addrs, err := proxy.LookupHost(ctx, "www.example.org")
+			if err == nil || err.Error() != netxlite.FailureDNSNXDOMAINError {
+				t.Fatal("unexpected err", err)
+			}
+			if len(addrs) != 0 {
+				t.Fatal("expected no addrs")
+			}
+		})
+
+		t.Run("with another error", func(t *testing.T) {
+			addrs, err := proxy.LookupHost(ctx, "www.example.net")
+			if err == nil || err.Error() != netxlite.FailureDNSServerMisbehaving {
+				t.Fatal("unexpected err", err)
+			}
+			if len(addrs) != 0 {
+				t.Fatal("expected no addrs")
+			}
+		})
+	})
+
+	t.Run("HTTP proxy", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		}))
+		defer server.Close()
+		URL, err := url.Parse(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		underlying := &tProxyFakeNetwork{
+			lookupHost: func(ctx context.Context, domain string) ([]string, error) {
+				return []string{URL.Hostname()}, nil
+			},
+		}
+		config := &TProxyConfig{
+			Endpoints: map[string]TProxyPolicy{
+				URL.Host + "/tcp": TProxyPolicyHijackHTTP,
+			},
+		}
+		proxy, err := NewTProxyWithUnderlyingNetwork(config, log.Log, underlying)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer proxy.Close()
+		dialer := proxy.NewSimpleDialer(10 * time.Second)
+		req, err := http.NewRequest("GET", server.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Host = net.JoinHostPort("www.example.com", URL.Port())
+		txp := &http.Transport{DialContext: dialer.DialContext}
+		resp, err := txp.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, err := netxlite.ReadAllContext(context.Background(), resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "ok" {
+			t.Fatal("unexpected body", string(data))
+		}
+	})
+
+	t.Run("DefaultCertPool", func(t *testing.T) {
+		proxy, err := NewTProxy(&TProxyConfig{}, log.Log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer proxy.Close()
+		pool := proxy.DefaultCertPool()
+		if len(pool.Subjects()) != len(netxlite.NewDefaultCertPool().Subjects()) {
+			t.Fatal("unexpected pool")
+		}
+		if len(pool.Subjects()) == len(proxy.CA().CertPool().Subjects()) {
+			t.Fatal("the pool should not contain only the CA of the proxy")
+		}
+	})
+}
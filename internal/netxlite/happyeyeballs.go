@@ -0,0 +1,229 @@
+package netxlite
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+// NewDialerWithResolverHappyEyeballs calls WrapDialerHappyEyeballs
+// for the stdlib dialer.
+func NewDialerWithResolverHappyEyeballs(
+	logger model.DebugLogger, resolver model.Resolver) model.Dialer {
+	return WrapDialerHappyEyeballs(logger, resolver, &dialerSystem{})
+}
+
+// WrapDialerHappyEyeballs is like WrapDialer except that the returned
+// dialer does not try each available endpoint sequentially. Rather, it
+// races the endpoints using the Happy Eyeballs algorithm (RFC8305): we
+// interleave IPv6 and IPv4 addresses, we start a new connection attempt
+// every 250 ms or as soon as the previous attempt fails, we use the
+// first connection that succeeds, and we cancel the other attempts.
+//
+// This dialer is not deterministic, so it is not suitable for measuring
+// but it is much better than WrapDialer when we are communicating with
+// the OONI backend and some of the backend addresses are not working.
+func WrapDialerHappyEyeballs(logger model.DebugLogger,
+	resolver model.Resolver, dialer model.Dialer) model.Dialer {
+	return &dialerLogger{
+		Dialer: &dialerHappyEyeballs{
+			Dialer: &dialerLogger{
+				Dialer: &dialerErrWrapper{
+					Dialer: dialer,
+				},
+				DebugLogger:     logger,
+				operationSuffix: "_address",
+			},
+			Resolver: resolver,
+			Logger:   logger,
+		},
+		DebugLogger: logger,
+	}
+}
+
+// NewDialerHappyEyeballsLegacy returns a dialer racing the endpoints
+// like WrapDialerHappyEyeballs does. Unlike WrapDialerHappyEyeballs, it
+// does not add logging and error wrapping around the given dialer, since
+// legacy netx code has already added them. The logger is OPTIONAL and we
+// only use it to report which address won the race.
+//
+// Deprecated: do not use this function in new code.
+func NewDialerHappyEyeballsLegacy(logger model.DebugLogger,
+	resolver model.Resolver, dialer model.Dialer) model.Dialer {
+	return &dialerHappyEyeballs{
+		Dialer:   dialer,
+		Resolver: resolver,
+		Logger:   logger,
+	}
+}
+
+// dialerHappyEyeballs combines domain name resolution with
+// dialing using the Happy Eyeballs algorithm (RFC8305).
+type dialerHappyEyeballs struct {
+	// Dialer is the MANDATORY underlying dialer.
+	model.Dialer
+
+	// Resolver is the MANDATORY resolver.
+	model.Resolver
+
+	// Delay is the OPTIONAL delay between connection attempts. If
+	// zero, we use the 250 ms delay recommended by RFC8305.
+	Delay time.Duration
+
+	// Logger is the OPTIONAL logger we use to report
+	// which address won the race.
+	Logger model.DebugLogger
+}
+
+var _ model.Dialer = &dialerHappyEyeballs{}
+
+// dialerHappyEyeballsResult is the result of a connection attempt.
+type dialerHappyEyeballsResult struct {
+	// conn is the conn on success.
+	conn net.Conn
+
+	// err is the error on failure.
+	err error
+
+	// idx is the index of the attempt.
+	idx int
+}
+
+func (d *dialerHappyEyeballs) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	onlyhost, onlyport, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := d.lookupHost(ctx, onlyhost)
+	if err != nil {
+		return nil, err
+	}
+	addrs = happyEyeballsSortAddrs(addrs)
+	if len(addrs) <= 0 {
+		return nil, quirkReduceErrors(nil) // consistent with dialerResolver
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// Note: the channel is buffered such that the goroutines
+	// never block even after we have stopped reading.
+	resch := make(chan *dialerHappyEyeballsResult, len(addrs))
+	errorslist := make([]error, len(addrs))
+	var next, pending int
+	start := func() {
+		idx, target := next, net.JoinHostPort(addrs[next], onlyport)
+		go func() {
+			conn, err := d.Dialer.DialContext(ctx, network, target)
+			resch <- &dialerHappyEyeballsResult{conn: conn, err: err, idx: idx}
+		}()
+		next++
+		pending++
+	}
+	start()
+	for pending > 0 {
+		timerch, stop := d.newTimer(next < len(addrs))
+		var res *dialerHappyEyeballsResult
+		select {
+		case <-timerch:
+			start()
+			continue
+		case res = <-resch:
+			stop()
+		}
+		pending--
+		if res.err == nil {
+			d.logWinner(addrs[res.idx], address)
+			go d.closeLosers(resch, pending)
+			return res.conn, nil
+		}
+		errorslist[res.idx] = res.err
+		if next < len(addrs) {
+			start() // do not wait for the delay after a failure
+		}
+	}
+	return nil, quirkReduceErrors(happyEyeballsCompactErrors(errorslist))
+}
+
+// lookupHost ensures we correctly handle IP addresses.
+func (d *dialerHappyEyeballs) lookupHost(ctx context.Context, hostname string) ([]string, error) {
+	if net.ParseIP(hostname) != nil {
+		return []string{hostname}, nil
+	}
+	return d.Resolver.LookupHost(ctx, hostname)
+}
+
+// newTimer returns the channel where we receive the signal to start the
+// next attempt and the function to stop the timer. When enabled is false,
+// the channel is nil, so we will never receive any signal from it.
+func (d *dialerHappyEyeballs) newTimer(enabled bool) (<-chan time.Time, func()) {
+	if !enabled {
+		return nil, func() {}
+	}
+	timer := time.NewTimer(d.delay())
+	return timer.C, func() { timer.Stop() }
+}
+
+func (d *dialerHappyEyeballs) delay() time.Duration {
+	if d.Delay > 0 {
+		return d.Delay
+	}
+	return 250 * time.Millisecond
+}
+
+// logWinner reports which address won the race.
+func (d *dialerHappyEyeballs) logWinner(winner, address string) {
+	if d.Logger != nil {
+		d.Logger.Debugf("happy eyeballs: %s won the race for %s", winner, address)
+	}
+}
+
+// closeLosers closes the connections that succeeded after
+// the winner. We read exactly pending results from resch.
+func (d *dialerHappyEyeballs) closeLosers(resch <-chan *dialerHappyEyeballsResult, pending int) {
+	for ; pending > 0; pending-- {
+		if res := <-resch; res.err == nil {
+			res.conn.Close()
+		}
+	}
+}
+
+func (d *dialerHappyEyeballs) CloseIdleConnections() {
+	d.Dialer.CloseIdleConnections()
+	d.Resolver.CloseIdleConnections()
+}
+
+// happyEyeballsSortAddrs interleaves IPv6 and IPv4 addresses
+// starting with IPv6, as recommended by RFC8305.
+func happyEyeballsSortAddrs(addrs []string) (out []string) {
+	var ipv4, ipv6 []string
+	for _, addr := range addrs {
+		if strings.Contains(addr, ":") {
+			ipv6 = append(ipv6, addr)
+			continue
+		}
+		ipv4 = append(ipv4, addr)
+	}
+	for len(ipv4) > 0 || len(ipv6) > 0 {
+		if len(ipv6) > 0 {
+			out = append(out, ipv6[0])
+			ipv6 = ipv6[1:]
+		}
+		if len(ipv4) > 0 {
+			out = append(out, ipv4[0])
+			ipv4 = ipv4[1:]
+		}
+	}
+	return
+}
+
+// happyEyeballsCompactErrors returns the non-nil errors in the list.
+func happyEyeballsCompactErrors(errorslist []error) (out []error) {
+	for _, err := range errorslist {
+		if err != nil {
+			out = append(out, err)
+		}
+	}
+	return
+}
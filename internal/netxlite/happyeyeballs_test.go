@@ -0,0 +1,280 @@
+package netxlite
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/model/mocks"
+)
+
+func TestNewDialerWithResolverHappyEyeballs(t *testing.T) {
+	t.Run("produces a chain with the expected types", func(t *testing.T) {
+		d := NewDialerWithResolverHappyEyeballs(log.Log, &nullResolver{})
+		logger := d.(*dialerLogger)
+		if logger.DebugLogger != log.Log {
+			t.Fatal("invalid logger")
+		}
+		he := logger.Dialer.(*dialerHappyEyeballs)
+		if _, okay := he.Resolver.(*nullResolver); !okay {
+			t.Fatal("invalid Resolver type")
+		}
+		if he.Logger != log.Log {
+			t.Fatal("invalid logger")
+		}
+		logger = he.Dialer.(*dialerLogger)
+		if logger.DebugLogger != log.Log {
+			t.Fatal("invalid logger")
+		}
+		errWrapper := logger.Dialer.(*dialerErrWrapper)
+		_ = errWrapper.Dialer.(*dialerSystem)
+	})
+}
+
+func TestNewDialerHappyEyeballsLegacy(t *testing.T) {
+	t.Run("does not wrap the underlying dialer", func(t *testing.T) {
+		underlying := &mocks.Dialer{}
+		d := NewDialerHappyEyeballsLegacy(log.Log, &nullResolver{}, underlying)
+		he := d.(*dialerHappyEyeballs)
+		if he.Dialer != underlying {
+			t.Fatal("invalid Dialer")
+		}
+		if _, okay := he.Resolver.(*nullResolver); !okay {
+			t.Fatal("invalid Resolver type")
+		}
+		if he.Logger != log.Log {
+			t.Fatal("invalid logger")
+		}
+	})
+}
+
+func TestDialerHappyEyeballs(t *testing.T) {
+	// newResolver returns a resolver always returning addrs.
+	newResolver := func(addrs ...string) model.Resolver {
+		return &mocks.Resolver{
+			MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+				return addrs, nil
+			},
+		}
+	}
+
+	t.Run("fails without a port", func(t *testing.T) {
+		d := &dialerHappyEyeballs{}
+		conn, err := d.DialContext(context.Background(), "tcp", "dns.google")
+		if err == nil || err.Error() != "address dns.google: missing port in address" {
+			t.Fatal("not the error we expected", err)
+		}
+		if conn != nil {
+			t.Fatal("expected nil conn")
+		}
+	})
+
+	t.Run("handles resolver failures", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		d := &dialerHappyEyeballs{
+			Resolver: &mocks.Resolver{
+				MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+					return nil, expected
+				},
+			},
+		}
+		conn, err := d.DialContext(context.Background(), "tcp", "dns.google:443")
+		if !errors.Is(err, expected) {
+			t.Fatal("not the error we expected", err)
+		}
+		if conn != nil {
+			t.Fatal("expected nil conn")
+		}
+	})
+
+	t.Run("handles an empty list of addresses", func(t *testing.T) {
+		d := &dialerHappyEyeballs{Resolver: newResolver()}
+		conn, err := d.DialContext(context.Background(), "tcp", "dns.google:443")
+		if !errors.Is(err, errReduceErrorsEmptyList) {
+			t.Fatal("not the error we expected", err)
+		}
+		if conn != nil {
+			t.Fatal("expected nil conn")
+		}
+	})
+
+	t.Run("does not resolve IP addresses", func(t *testing.T) {
+		expected := &mocks.Conn{}
+		var target string
+		d := &dialerHappyEyeballs{
+			Dialer: &mocks.Dialer{
+				MockDialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+					target = address
+					return expected, nil
+				},
+			},
+			Resolver: &nullResolver{},
+		}
+		conn, err := d.DialContext(context.Background(), "tcp", "[::1]:443")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conn != expected {
+			t.Fatal("unexpected conn")
+		}
+		if target != "[::1]:443" {
+			t.Fatal("unexpected target", target)
+		}
+	})
+
+	t.Run("the first address to connect wins and we cancel the others", func(t *testing.T) {
+		// The IPv6 address is blackholed, so we should be using the IPv4
+		// address after the connection attempt delay. We also check that
+		// we cancel the blackholed attempt once we have a winner.
+		expected := &mocks.Conn{}
+		canceled := make(chan bool, 1)
+		var logged []string
+		d := &dialerHappyEyeballs{
+			Delay: 10 * time.Millisecond,
+			Dialer: &mocks.Dialer{
+				MockDialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+					if address == "[2001:4860:4860::8888]:443" {
+						<-ctx.Done()
+						canceled <- true
+						return nil, ctx.Err()
+					}
+					return expected, nil
+				},
+			},
+			Logger: &mocks.Logger{
+				MockDebugf: func(format string, v ...interface{}) {
+					logged = append(logged, v[0].(string))
+				},
+			},
+			Resolver: newResolver("8.8.8.8", "2001:4860:4860::8888"),
+		}
+		conn, err := d.DialContext(context.Background(), "tcp", "dns.google:443")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conn != expected {
+			t.Fatal("unexpected conn")
+		}
+		<-canceled
+		if diff := cmp.Diff([]string{"8.8.8.8"}, logged); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("a failure starts the next attempt immediately", func(t *testing.T) {
+		expected := &mocks.Conn{}
+		d := &dialerHappyEyeballs{
+			Delay: time.Hour, // we would hang if we waited for the delay
+			Dialer: &mocks.Dialer{
+				MockDialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+					if address == "[2001:4860:4860::8888]:443" {
+						return nil, ECONNREFUSED
+					}
+					return expected, nil
+				},
+			},
+			Resolver: newResolver("8.8.8.8", "2001:4860:4860::8888"),
+		}
+		conn, err := d.DialContext(context.Background(), "tcp", "dns.google:443")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conn != expected {
+			t.Fatal("unexpected conn")
+		}
+	})
+
+	t.Run("we close the connections established after the winner", func(t *testing.T) {
+		winner := &mocks.Conn{}
+		closed := make(chan bool, 1)
+		loser := &mocks.Conn{
+			MockClose: func() error {
+				closed <- true
+				return nil
+			},
+		}
+		winnerDone := &sync.WaitGroup{}
+		winnerDone.Add(1)
+		d := &dialerHappyEyeballs{
+			Delay: time.Millisecond,
+			Dialer: &mocks.Dialer{
+				MockDialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+					if address == "[2001:4860:4860::8888]:443" {
+						// ensure the loser is still connecting when the winner succeeds
+						winnerDone.Wait()
+						return loser, nil
+					}
+					defer winnerDone.Done()
+					return winner, nil
+				},
+			},
+			Resolver: newResolver("8.8.8.8", "2001:4860:4860::8888"),
+		}
+		conn, err := d.DialContext(context.Background(), "tcp", "dns.google:443")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conn != winner {
+			t.Fatal("unexpected conn")
+		}
+		<-closed
+	})
+
+	t.Run("when all attempts fail we return the first error", func(t *testing.T) {
+		d := &dialerHappyEyeballs{
+			Dialer: &mocks.Dialer{
+				MockDialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+					if address == "[2001:4860:4860::8888]:443" {
+						return nil, ENETUNREACH
+					}
+					return nil, ECONNREFUSED
+				},
+			},
+			Resolver: newResolver("8.8.8.8", "2001:4860:4860::8888"),
+		}
+		conn, err := d.DialContext(context.Background(), "tcp", "dns.google:443")
+		if !errors.Is(err, ENETUNREACH) {
+			t.Fatal("not the error we expected", err)
+		}
+		if conn != nil {
+			t.Fatal("expected nil conn")
+		}
+	})
+
+	t.Run("CloseIdleConnections", func(t *testing.T) {
+		var (
+			calledDialer   bool
+			calledResolver bool
+		)
+		d := &dialerHappyEyeballs{
+			Dialer: &mocks.Dialer{
+				MockCloseIdleConnections: func() {
+					calledDialer = true
+				},
+			},
+			Resolver: &mocks.Resolver{
+				MockCloseIdleConnections: func() {
+					calledResolver = true
+				},
+			},
+		}
+		d.CloseIdleConnections()
+		if !calledDialer || !calledResolver {
+			t.Fatal("not called")
+		}
+	})
+}
+
+func TestHappyEyeballsSortAddrs(t *testing.T) {
+	addrs := []string{"8.8.8.8", "8.8.4.4", "2001:4860:4860::8888", "1.1.1.1"}
+	expected := []string{"2001:4860:4860::8888", "8.8.8.8", "8.8.4.4", "1.1.1.1"}
+	if diff := cmp.Diff(expected, happyEyeballsSortAddrs(addrs)); diff != "" {
+		t.Fatal(diff)
+	}
+}
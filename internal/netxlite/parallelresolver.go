@@ -0,0 +1,158 @@
+package netxlite
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-cli/v3/internal/atomicx"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+// ParallelResolver uses a transport and performs a LookupHost
+// operation in a parallel fashion (i.e., it sends the A and the
+// AAAA queries at the same time and waits for both responses),
+// hence its name. Both queries use the same transport, so any
+// wrapper around the transport sees both round trips.
+//
+// You should probably use NewParallelResolver to create a new instance.
+type ParallelResolver struct {
+	// Encoder is the MANDATORY encoder to use.
+	Encoder model.DNSEncoder
+
+	// Decoder is the MANDATORY decoder to use.
+	Decoder model.DNSDecoder
+
+	// NumTimeouts is MANDATORY and counts the number of timeouts.
+	NumTimeouts *atomicx.Int64
+
+	// QueryOptions contains the OPTIONAL EDNS0 options to use. When
+	// nil, we only add EDNS0 padding if the transport requires it.
+	QueryOptions *model.DNSQueryOptions
+
+	// Txp is the underlying DNS transport.
+	Txp model.DNSTransport
+}
+
+// NewParallelResolver creates a new ParallelResolver instance.
+func NewParallelResolver(t model.DNSTransport) *ParallelResolver {
+	return &ParallelResolver{
+		Encoder:     &DNSEncoderMiekg{},
+		Decoder:     &DNSDecoderMiekg{},
+		NumTimeouts: &atomicx.Int64{},
+		Txp:         t,
+	}
+}
+
+// Transport returns the transport being used.
+func (r *ParallelResolver) Transport() model.DNSTransport {
+	return r.Txp
+}
+
+// Network returns the "network" of the underlying transport.
+func (r *ParallelResolver) Network() string {
+	return r.Txp.Network()
+}
+
+// Address returns the "address" of the underlying transport.
+func (r *ParallelResolver) Address() string {
+	return r.Txp.Address()
+}
+
+// CloseIdleConnections closes idle connections, if any.
+func (r *ParallelResolver) CloseIdleConnections() {
+	r.Txp.CloseIdleConnections()
+}
+
+// parallelResolverResult is the result of a parallel lookup.
+type parallelResolverResult struct {
+	addrs []string
+	ttl   time.Duration
+	err   error
+}
+
+// LookupHost performs the A and the AAAA lookups for hostname in parallel.
+func (r *ParallelResolver) LookupHost(ctx context.Context, hostname string) ([]string, error) {
+	addrs, _, err := r.LookupHostWithTTL(ctx, hostname)
+	return addrs, err
+}
+
+// LookupHostWithTTL implements model.ResolverWithTTL.LookupHostWithTTL. The
+// returned TTL is the minimum between the TTLs of the A and AAAA replies.
+func (r *ParallelResolver) LookupHostWithTTL(
+	ctx context.Context, hostname string) ([]string, time.Duration, error) {
+	ach := make(chan *parallelResolverResult)
+	go r.lookupHost(ctx, hostname, dns.TypeA, ach)
+	aaaach := make(chan *parallelResolverResult)
+	go r.lookupHost(ctx, hostname, dns.TypeAAAA, aaaach)
+	ares := <-ach
+	aaaares := <-aaaach
+	ttl := ares.ttl
+	if aaaares.ttl < ttl {
+		ttl = aaaares.ttl
+	}
+	if ares.err != nil && aaaares.err != nil {
+		// Note: the A error comes first because we assume that it's the
+		// more meaningful one: the AAAA error may just be telling us that
+		// there is no AAAA record for the website. This is consistent
+		// with what the SerialResolver does.
+		return nil, ttl, quirkReduceErrors([]error{ares.err, aaaares.err})
+	}
+	var addrs []string
+	addrs = append(addrs, ares.addrs...)
+	addrs = append(addrs, aaaares.addrs...)
+	return quirkSortIPAddrs(addrs), ttl, nil
+}
+
+// LookupHTTPS implements Resolver.LookupHTTPS.
+func (r *ParallelResolver) LookupHTTPS(
+	ctx context.Context, hostname string) (*model.HTTPSSvc, error) {
+	return r.querier().lookupHTTPS(ctx, hostname)
+}
+
+// LookupSVCB implements Resolver.LookupSVCB.
+func (r *ParallelResolver) LookupSVCB(
+	ctx context.Context, hostname string) (*model.HTTPSSvc, error) {
+	return r.querier().lookupSVCB(ctx, hostname)
+}
+
+// LookupCNAME implements Resolver.LookupCNAME.
+func (r *ParallelResolver) LookupCNAME(ctx context.Context, hostname string) ([]string, error) {
+	return r.querier().lookupCNAME(ctx, hostname)
+}
+
+// LookupNS implements Resolver.LookupNS.
+func (r *ParallelResolver) LookupNS(ctx context.Context, hostname string) ([]*net.NS, error) {
+	return r.querier().lookupNS(ctx, hostname)
+}
+
+// LookupMX implements Resolver.LookupMX.
+func (r *ParallelResolver) LookupMX(ctx context.Context, hostname string) ([]*net.MX, error) {
+	return r.querier().lookupMX(ctx, hostname)
+}
+
+// LookupTXT implements Resolver.LookupTXT.
+func (r *ParallelResolver) LookupTXT(ctx context.Context, hostname string) ([]string, error) {
+	return r.querier().lookupTXT(ctx, hostname)
+}
+
+// lookupHost performs a lookup with retry and emits the result on out.
+func (r *ParallelResolver) lookupHost(ctx context.Context,
+	hostname string, qtype uint16, out chan<- *parallelResolverResult) {
+	addrs, ttl, err := r.querier().lookupHostWithRetry(ctx, hostname, qtype)
+	out <- &parallelResolverResult{addrs: addrs, ttl: ttl, err: err}
+}
+
+// querier returns the dnsQuerier for sending queries.
+func (r *ParallelResolver) querier() *dnsQuerier {
+	return &dnsQuerier{
+		decoder:     r.Decoder,
+		encoder:     r.Encoder,
+		numTimeouts: r.NumTimeouts,
+		options:     r.QueryOptions,
+		txp:         r.Txp,
+	}
+}
+
+var _ model.ResolverWithTTL = &ParallelResolver{}
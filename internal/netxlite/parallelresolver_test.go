@@ -0,0 +1,355 @@
+package netxlite
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-cli/v3/internal/atomicx"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/model/mocks"
+)
+
+func TestParallelResolver(t *testing.T) {
+	t.Run("transport okay", func(t *testing.T) {
+		txp := NewDNSOverTLS((&tls.Dialer{}).DialContext, "8.8.8.8:853")
+		r := NewParallelResolver(txp)
+		rtx := r.Transport()
+		if rtx.Network() != "dot" || rtx.Address() != "8.8.8.8:853" {
+			t.Fatal("not the transport we expected")
+		}
+		if r.Network() != rtx.Network() {
+			t.Fatal("invalid network seen from the resolver")
+		}
+		if r.Address() != rtx.Address() {
+			t.Fatal("invalid address seen from the resolver")
+		}
+	})
+
+	t.Run("LookupHost", func(t *testing.T) {
+		t.Run("Encode error", func(t *testing.T) {
+			mocked := errors.New("mocked error")
+			txp := NewDNSOverTLS((&tls.Dialer{}).DialContext, "8.8.8.8:853")
+			r := ParallelResolver{
+				Encoder: &mocks.DNSEncoder{
+					MockEncode: func(domain string, qtype uint16, padding bool) ([]byte, error) {
+						return nil, mocked
+					},
+				},
+				Txp: txp,
+			}
+			addrs, err := r.LookupHost(context.Background(), "www.gogle.com")
+			if !errors.Is(err, mocked) {
+				t.Fatal("not the error we expected")
+			}
+			if addrs != nil {
+				t.Fatal("expected nil address here")
+			}
+		})
+
+		t.Run("RoundTrip error", func(t *testing.T) {
+			mocked := errors.New("mocked error")
+			txp := &mocks.DNSTransport{
+				MockRoundTrip: func(ctx context.Context, query []byte) (reply []byte, err error) {
+					return nil, mocked
+				},
+				MockRequiresPadding: func() bool {
+					return true
+				},
+			}
+			r := NewParallelResolver(txp)
+			addrs, err := r.LookupHost(context.Background(), "www.gogle.com")
+			if !errors.Is(err, mocked) {
+				t.Fatal("not the error we expected")
+			}
+			if addrs != nil {
+				t.Fatal("expected nil address here")
+			}
+		})
+
+		t.Run("empty reply", func(t *testing.T) {
+			txp := &mocks.DNSTransport{
+				MockRoundTrip: func(ctx context.Context, query []byte) (reply []byte, err error) {
+					return dnsGenLookupHostReplySuccess(t, dns.TypeA), nil
+				},
+				MockRequiresPadding: func() bool {
+					return true
+				},
+			}
+			r := NewParallelResolver(txp)
+			addrs, err := r.LookupHost(context.Background(), "www.gogle.com")
+			if !errors.Is(err, ErrOODNSNoAnswer) {
+				t.Fatal("not the error we expected", err)
+			}
+			if addrs != nil {
+				t.Fatal("expected nil address here")
+			}
+		})
+
+		t.Run("with A reply", func(t *testing.T) {
+			txp := &mocks.DNSTransport{
+				MockRoundTrip: func(ctx context.Context, query []byte) (reply []byte, err error) {
+					return dnsGenLookupHostReplySuccess(t, dns.TypeA, "8.8.8.8"), nil
+				},
+				MockRequiresPadding: func() bool {
+					return true
+				},
+			}
+			r := NewParallelResolver(txp)
+			addrs, err := r.LookupHost(context.Background(), "www.gogle.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(addrs) != 1 || addrs[0] != "8.8.8.8" {
+				t.Fatal("not the result we expected")
+			}
+		})
+
+		t.Run("with AAAA reply", func(t *testing.T) {
+			txp := &mocks.DNSTransport{
+				MockRoundTrip: func(ctx context.Context, query []byte) (reply []byte, err error) {
+					return dnsGenLookupHostReplySuccess(t, dns.TypeAAAA, "::1"), nil
+				},
+				MockRequiresPadding: func() bool {
+					return true
+				},
+			}
+			r := NewParallelResolver(txp)
+			addrs, err := r.LookupHost(context.Background(), "www.gogle.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(addrs) != 1 || addrs[0] != "::1" {
+				t.Fatal("not the result we expected")
+			}
+		})
+
+		t.Run("with timeout", func(t *testing.T) {
+			txp := &mocks.DNSTransport{
+				MockRoundTrip: func(ctx context.Context, query []byte) (reply []byte, err error) {
+					return nil, &net.OpError{
+						Err: &errorWithTimeout{ETIMEDOUT},
+						Op:  "dial",
+					}
+				},
+				MockRequiresPadding: func() bool {
+					return true
+				},
+			}
+			r := NewParallelResolver(txp)
+			addrs, err := r.LookupHost(context.Background(), "www.gogle.com")
+			if !errors.Is(err, ETIMEDOUT) {
+				t.Fatal("not the error we expected")
+			}
+			if addrs != nil {
+				t.Fatal("expected nil address here")
+			}
+			if r.NumTimeouts.Load() <= 0 {
+				t.Fatal("we didn't actually take the timeouts")
+			}
+		})
+		t.Run("with A and AAAA replies", func(t *testing.T) {
+			txp := &mocks.DNSTransport{
+				MockRoundTrip: func(ctx context.Context, query []byte) (reply []byte, err error) {
+					msg := &dns.Msg{}
+					if err := msg.Unpack(query); err != nil {
+						return nil, err
+					}
+					if msg.Question[0].Qtype == dns.TypeAAAA {
+						return dnsGenLookupHostReplySuccess(t, dns.TypeAAAA, "::1"), nil
+					}
+					return dnsGenLookupHostReplySuccess(t, dns.TypeA, "8.8.8.8"), nil
+				},
+				MockRequiresPadding: func() bool {
+					return true
+				},
+			}
+			r := NewParallelResolver(txp)
+			addrs, err := r.LookupHost(context.Background(), "www.gogle.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(addrs) != 2 || addrs[0] != "8.8.8.8" || addrs[1] != "::1" {
+				t.Fatal("not the result we expected", addrs)
+			}
+		})
+
+		t.Run("queries are concurrent", func(t *testing.T) {
+			// Each round trip blocks until both queries are in
+			// flight, which would deadlock a serial resolver.
+			inflight := &sync.WaitGroup{}
+			inflight.Add(2)
+			txp := &mocks.DNSTransport{
+				MockRoundTrip: func(ctx context.Context, query []byte) (reply []byte, err error) {
+					inflight.Done()
+					inflight.Wait()
+					return dnsGenLookupHostReplySuccess(t, dns.TypeA, "8.8.8.8"), nil
+				},
+				MockRequiresPadding: func() bool {
+					return true
+				},
+			}
+			r := NewParallelResolver(txp)
+			addrs, err := r.LookupHost(context.Background(), "www.gogle.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(addrs) != 1 || addrs[0] != "8.8.8.8" {
+				t.Fatal("not the result we expected")
+			}
+		})
+	})
+
+	t.Run("CloseIdleConnections", func(t *testing.T) {
+		var called bool
+		r := &ParallelResolver{
+			Txp: &mocks.DNSTransport{
+				MockCloseIdleConnections: func() {
+					called = true
+				},
+			},
+		}
+		r.CloseIdleConnections()
+		if !called {
+			t.Fatal("not called")
+		}
+	})
+
+	t.Run("LookupHTTPS", func(t *testing.T) {
+		t.Run("for encoding error", func(t *testing.T) {
+			expected := errors.New("mocked error")
+			r := &ParallelResolver{
+				Encoder: &mocks.DNSEncoder{
+					MockEncode: func(domain string, qtype uint16, padding bool) ([]byte, error) {
+						return nil, expected
+					},
+				},
+				Decoder:     nil,
+				NumTimeouts: &atomicx.Int64{},
+				Txp: &mocks.DNSTransport{
+					MockRequiresPadding: func() bool {
+						return false
+					},
+				},
+			}
+			ctx := context.Background()
+			https, err := r.LookupHTTPS(ctx, "example.com")
+			if !errors.Is(err, expected) {
+				t.Fatal("unexpected err", err)
+			}
+			if https != nil {
+				t.Fatal("unexpected result")
+			}
+		})
+
+		t.Run("for round-trip error", func(t *testing.T) {
+			expected := errors.New("mocked error")
+			r := &ParallelResolver{
+				Encoder: &mocks.DNSEncoder{
+					MockEncode: func(domain string, qtype uint16, padding bool) ([]byte, error) {
+						return make([]byte, 64), nil
+					},
+				},
+				Decoder:     nil,
+				NumTimeouts: &atomicx.Int64{},
+				Txp: &mocks.DNSTransport{
+					MockRoundTrip: func(ctx context.Context, query []byte) (reply []byte, err error) {
+						return nil, expected
+					},
+					MockRequiresPadding: func() bool {
+						return false
+					},
+				},
+			}
+			ctx := context.Background()
+			https, err := r.LookupHTTPS(ctx, "example.com")
+			if !errors.Is(err, expected) {
+				t.Fatal("unexpected err", err)
+			}
+			if https != nil {
+				t.Fatal("unexpected result")
+			}
+		})
+
+		t.Run("for decode error", func(t *testing.T) {
+			expected := errors.New("mocked error")
+			r := &ParallelResolver{
+				Encoder: &mocks.DNSEncoder{
+					MockEncode: func(domain string, qtype uint16, padding bool) ([]byte, error) {
+						return make([]byte, 64), nil
+					},
+				},
+				Decoder: &mocks.DNSDecoder{
+					MockDecodeHTTPS: func(reply []byte) (*model.HTTPSSvc, error) {
+						return nil, expected
+					},
+				},
+				NumTimeouts: &atomicx.Int64{},
+				Txp: &mocks.DNSTransport{
+					MockRoundTrip: func(ctx context.Context, query []byte) (reply []byte, err error) {
+						return make([]byte, 128), nil
+					},
+					MockRequiresPadding: func() bool {
+						return false
+					},
+				},
+			}
+			ctx := context.Background()
+			https, err := r.LookupHTTPS(ctx, "example.com")
+			if !errors.Is(err, expected) {
+				t.Fatal("unexpected err", err)
+			}
+			if https != nil {
+				t.Fatal("unexpected result")
+			}
+		})
+	})
+
+	t.Run("record type lookups", func(t *testing.T) {
+		r := NewParallelResolver(dnsRecordTypesTransport(t))
+		dnsCheckRecordTypeLookups(t, r)
+	})
+
+	t.Run("LookupHostWithTTL", func(t *testing.T) {
+		dnsCheckLookupHostWithTTL(t, func(txp model.DNSTransport) model.ResolverWithTTL {
+			return NewParallelResolver(txp)
+		})
+	})
+
+	t.Run("with QueryOptions", func(t *testing.T) {
+		var queries []*dns.Msg
+		txp := &mocks.DNSTransport{
+			MockRoundTrip: func(ctx context.Context, rawQuery []byte) ([]byte, error) {
+				query := new(dns.Msg)
+				if err := query.Unpack(rawQuery); err != nil {
+					return nil, err
+				}
+				queries = append(queries, query)
+				return dnsGenReplyWithAnswers(t, query.Question[0].Qtype), nil
+			},
+			MockRequiresPadding: func() bool {
+				return true
+			},
+		}
+		r := NewParallelResolver(txp)
+		r.QueryOptions = &model.DNSQueryOptions{
+			DNSSECOK:     true,
+			ClientSubnet: "130.192.91.0/24",
+		}
+		r.LookupTXT(context.Background(), "x.org")
+		if len(queries) != 1 {
+			t.Fatal("unexpected number of queries")
+		}
+		opt := queries[0].IsEdns0()
+		if opt == nil || !opt.Do() || len(opt.Option) != 2 {
+			t.Fatal("the query does not contain the expected EDNS0 options")
+		}
+		if _, ok := opt.Option[1].(*dns.EDNS0_PADDING); !ok {
+			t.Fatal("expected padding because the transport requires it")
+		}
+	})
+}
@@ -119,7 +119,7 @@ func (d *quicDialerQUICGo) DialContext(ctx context.Context, network string,
 		return nil, err
 	}
 	udpAddr := &net.UDPAddr{IP: ip, Port: port, Zone: ""}
-	tlsConfig = d.maybeApplyTLSDefaults(tlsConfig, port)
+	tlsConfig = maybeApplyTLSRand(ctx, d.maybeApplyTLSDefaults(tlsConfig, port))
 	sess, err := d.dialEarlyContext(
 		ctx, pconn, udpAddr, address, tlsConfig, quicConfig)
 	if err != nil {
@@ -145,7 +145,7 @@ func (d *quicDialerQUICGo) dialEarlyContext(ctx context.Context,
 func (d *quicDialerQUICGo) maybeApplyTLSDefaults(config *tls.Config, port int) *tls.Config {
 	config = config.Clone()
 	if config.RootCAs == nil {
-		config.RootCAs = defaultCertPool
+		config.RootCAs = DefaultCertPool()
 	}
 	if len(config.NextProtos) <= 0 {
 		switch port {
@@ -0,0 +1,285 @@
+package replay
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+// Recorder is a model.UnderlyingNetworkLibrary that records a trace
+// of the operations performed using an underlying network.
+type Recorder struct {
+	// begin is when we started recording.
+	begin time.Time
+
+	// connID is the ID of the last connection or UDP socket.
+	connID int64
+
+	// encoder writes the events.
+	encoder *json.Encoder
+
+	// err is the first error that occurred writing an event.
+	err error
+
+	// mu provides mutual exclusion for encoder and err.
+	mu sync.Mutex
+
+	// underlying is the underlying network.
+	underlying model.UnderlyingNetworkLibrary
+}
+
+var _ model.UnderlyingNetworkLibrary = &Recorder{}
+
+// NewRecorder creates a new Recorder using the given underlying network
+// (e.g., &netxlite.TProxyStdlib{}) and writing the trace to w.
+func NewRecorder(underlying model.UnderlyingNetworkLibrary, w io.Writer) *Recorder {
+	return &Recorder{
+		begin:      time.Now(),
+		encoder:    json.NewEncoder(w),
+		underlying: underlying,
+	}
+}
+
+// Err returns the first error that occurred when writing the
+// trace or nil if we successfully wrote all the events.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// record writes the event to the trace.
+func (r *Recorder) record(ev *Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.encoder.Encode(ev); err != nil && r.err == nil {
+		r.err = err
+	}
+}
+
+// now returns the current time relative to the beginning of the trace.
+func (r *Recorder) now() time.Duration {
+	return time.Since(r.begin)
+}
+
+// nextConnID returns the ID for a new connection or UDP socket.
+func (r *Recorder) nextConnID() int64 {
+	return atomic.AddInt64(&r.connID, 1)
+}
+
+// Entropy returns a reader that records the bytes read from the given
+// entropy source (usually crypto/rand.Reader).
+func (r *Recorder) Entropy(source io.Reader) io.Reader {
+	return &recorderEntropy{r: r, source: source}
+}
+
+// recorderEntropy records the entropy read from source.
+type recorderEntropy struct {
+	r      *Recorder
+	source io.Reader
+}
+
+// Read implements io.Reader.Read.
+func (e *recorderEntropy) Read(b []byte) (int, error) {
+	t := e.r.now()
+	count, err := e.source.Read(b)
+	e.r.record(&Event{
+		Operation: OperationEntropy,
+		Data:      b[:count],
+		Error:     newError(err),
+		T:         t,
+		Duration:  e.r.now() - t,
+	})
+	return count, err
+}
+
+// DefaultCertPool implements model.UnderlyingNetworkLibrary.DefaultCertPool.
+func (r *Recorder) DefaultCertPool() *x509.CertPool {
+	return r.underlying.DefaultCertPool()
+}
+
+// LookupHost implements model.UnderlyingNetworkLibrary.LookupHost.
+func (r *Recorder) LookupHost(ctx context.Context, domain string) ([]string, error) {
+	t := r.now()
+	addrs, err := r.underlying.LookupHost(ctx, domain)
+	r.record(&Event{
+		Operation: OperationLookupHost,
+		Address:   domain,
+		Addresses: addrs,
+		Error:     newError(err),
+		T:         t,
+		Duration:  r.now() - t,
+	})
+	return addrs, err
+}
+
+// NewSimpleDialer implements model.UnderlyingNetworkLibrary.NewSimpleDialer.
+func (r *Recorder) NewSimpleDialer(timeout time.Duration) model.SimpleDialer {
+	return &recorderDialer{dialer: r.underlying.NewSimpleDialer(timeout), r: r}
+}
+
+// recorderDialer is the model.SimpleDialer of a Recorder.
+type recorderDialer struct {
+	dialer model.SimpleDialer
+	r      *Recorder
+}
+
+// DialContext implements model.SimpleDialer.DialContext.
+func (d *recorderDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	t := d.r.now()
+	conn, err := d.dialer.DialContext(ctx, network, address)
+	ev := &Event{
+		Operation: OperationDial,
+		Network:   network,
+		Address:   address,
+		Error:     newError(err),
+		T:         t,
+		Duration:  d.r.now() - t,
+	}
+	if err != nil {
+		d.r.record(ev)
+		return nil, err
+	}
+	ev.ConnID = d.r.nextConnID()
+	ev.LocalAddr = conn.LocalAddr().String()
+	d.r.record(ev)
+	return &recorderConn{Conn: conn, id: ev.ConnID, r: d.r}, nil
+}
+
+// recorderConn is a net.Conn recording reads, writes and close.
+type recorderConn struct {
+	net.Conn
+	id int64
+	r  *Recorder
+}
+
+// Read implements net.Conn.Read.
+func (c *recorderConn) Read(b []byte) (int, error) {
+	t := c.r.now()
+	count, err := c.Conn.Read(b)
+	c.r.record(&Event{
+		Operation: OperationRead,
+		ConnID:    c.id,
+		Data:      b[:count],
+		Error:     newError(err),
+		T:         t,
+		Duration:  c.r.now() - t,
+	})
+	return count, err
+}
+
+// Write implements net.Conn.Write.
+func (c *recorderConn) Write(b []byte) (int, error) {
+	t := c.r.now()
+	count, err := c.Conn.Write(b)
+	c.r.record(&Event{
+		Operation: OperationWrite,
+		ConnID:    c.id,
+		Data:      b[:count],
+		Error:     newError(err),
+		T:         t,
+		Duration:  c.r.now() - t,
+	})
+	return count, err
+}
+
+// Close implements net.Conn.Close.
+func (c *recorderConn) Close() error {
+	t := c.r.now()
+	err := c.Conn.Close()
+	c.r.record(&Event{
+		Operation: OperationClose,
+		ConnID:    c.id,
+		Error:     newError(err),
+		T:         t,
+		Duration:  c.r.now() - t,
+	})
+	return err
+}
+
+// ListenUDP implements model.UnderlyingNetworkLibrary.ListenUDP.
+func (r *Recorder) ListenUDP(network string, laddr *net.UDPAddr) (model.UDPLikeConn, error) {
+	t := r.now()
+	pconn, err := r.underlying.ListenUDP(network, laddr)
+	ev := &Event{
+		Operation: OperationListenUDP,
+		Network:   network,
+		Error:     newError(err),
+		T:         t,
+		Duration:  r.now() - t,
+	}
+	if laddr != nil {
+		ev.Address = laddr.String()
+	}
+	if err != nil {
+		r.record(ev)
+		return nil, err
+	}
+	ev.ConnID = r.nextConnID()
+	ev.LocalAddr = pconn.LocalAddr().String()
+	r.record(ev)
+	return &recorderUDPLikeConn{UDPLikeConn: pconn, id: ev.ConnID, r: r}, nil
+}
+
+// recorderUDPLikeConn is a model.UDPLikeConn recording datagrams and close.
+type recorderUDPLikeConn struct {
+	model.UDPLikeConn
+	id int64
+	r  *Recorder
+}
+
+// ReadFrom implements model.UDPLikeConn.ReadFrom.
+func (c *recorderUDPLikeConn) ReadFrom(pkt []byte) (int, net.Addr, error) {
+	t := c.r.now()
+	count, addr, err := c.UDPLikeConn.ReadFrom(pkt)
+	ev := &Event{
+		Operation: OperationReadFrom,
+		ConnID:    c.id,
+		Data:      pkt[:count],
+		Error:     newError(err),
+		T:         t,
+		Duration:  c.r.now() - t,
+	}
+	if addr != nil {
+		ev.Address = addr.String()
+	}
+	c.r.record(ev)
+	return count, addr, err
+}
+
+// WriteTo implements model.UDPLikeConn.WriteTo.
+func (c *recorderUDPLikeConn) WriteTo(pkt []byte, addr net.Addr) (int, error) {
+	t := c.r.now()
+	count, err := c.UDPLikeConn.WriteTo(pkt, addr)
+	c.r.record(&Event{
+		Operation: OperationWriteTo,
+		ConnID:    c.id,
+		Address:   addr.String(),
+		Data:      pkt[:count],
+		Error:     newError(err),
+		T:         t,
+		Duration:  c.r.now() - t,
+	})
+	return count, err
+}
+
+// Close implements model.UDPLikeConn.Close.
+func (c *recorderUDPLikeConn) Close() error {
+	t := c.r.now()
+	err := c.UDPLikeConn.Close()
+	c.r.record(&Event{
+		Operation: OperationClose,
+		ConnID:    c.id,
+		Error:     newError(err),
+		T:         t,
+		Duration:  c.r.now() - t,
+	})
+	return err
+}
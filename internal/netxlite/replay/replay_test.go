@@ -0,0 +1,336 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+func TestError(t *testing.T) {
+	t.Run("with nil error", func(t *testing.T) {
+		if newError(nil) != nil {
+			t.Fatal("expected nil")
+		}
+		var e *Error
+		if e.Err() != nil {
+			t.Fatal("expected nil")
+		}
+	})
+
+	t.Run("we return sentinel errors as is", func(t *testing.T) {
+		for _, sentinel := range sentinelErrors {
+			if err := newError(sentinel).Err(); err != sentinel {
+				t.Fatal("unexpected err", err)
+			}
+		}
+	})
+
+	t.Run("we preserve wrapped sentinel errors", func(t *testing.T) {
+		orig := fmt.Errorf("read: %w", io.EOF)
+		err := newError(orig).Err()
+		if err == io.EOF || !errors.Is(err, io.EOF) {
+			t.Fatal("unexpected err", err)
+		}
+		if err.Error() != orig.Error() {
+			t.Fatal("unexpected message", err.Error())
+		}
+	})
+
+	t.Run("we preserve system call errors", func(t *testing.T) {
+		orig := &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+		ev, err := roundTrip(&Event{Error: newError(orig)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		replayed := ev.Error.Err()
+		if !errors.Is(replayed, syscall.ECONNRESET) {
+			t.Fatal("unexpected err", replayed)
+		}
+		failure := netxlite.NewTopLevelGenericErrWrapper(replayed)
+		if failure.Failure != netxlite.FailureConnectionReset {
+			t.Fatal("unexpected failure", failure.Failure)
+		}
+	})
+
+	t.Run("we preserve timeouts", func(t *testing.T) {
+		orig := &net.OpError{Op: "read", Net: "udp", Err: os.ErrDeadlineExceeded}
+		replayed := newError(orig).Err()
+		var netErr net.Error
+		if !errors.As(replayed, &netErr) || !netErr.Timeout() {
+			t.Fatal("expected a timeout")
+		}
+		if !errors.Is(replayed, os.ErrDeadlineExceeded) {
+			t.Fatal("unexpected err", replayed)
+		}
+	})
+}
+
+// roundTrip serializes and parses back the given event.
+func roundTrip(ev *Event) (*Event, error) {
+	buf := &bytes.Buffer{}
+	if err := NewRecorder(nil, buf).encoder.Encode(ev); err != nil {
+		return nil, err
+	}
+	events, err := ReadTrace(buf)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) != 1 {
+		return nil, errors.New("expected one event")
+	}
+	return events[0], nil
+}
+
+// warningsLogger is a model.Logger collecting warnings.
+type warningsLogger struct {
+	model.Logger
+	mu       sync.Mutex
+	warnings []string
+}
+
+func (lo *warningsLogger) Warn(message string) {
+	lo.mu.Lock()
+	lo.warnings = append(lo.warnings, message)
+	lo.mu.Unlock()
+}
+
+func (lo *warningsLogger) Warnf(format string, v ...interface{}) {
+	lo.Warn(fmt.Sprintf(format, v...))
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	entropy := rand.Reader
+	defer func() {
+		netxlite.TProxy = &netxlite.TProxyStdlib{}
+	}()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Bonsoir, Elliot!"))
+	}))
+	server.StartTLS()
+	defer server.Close()
+	config := &tls.Config{
+		RootCAs: server.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs,
+	}
+
+	fetch := func(rand io.Reader) (string, error) {
+		dialer := netxlite.NewDialerWithoutResolver(log.Log)
+		tlsDialer := netxlite.NewTLSDialerWithConfig(
+			dialer, netxlite.NewTLSHandshakerStdlib(log.Log), config)
+		txp := netxlite.NewHTTPTransport(log.Log, dialer, tlsDialer)
+		defer txp.CloseIdleConnections()
+		clnt := &http.Client{Transport: txp}
+		ctx := netxlite.ContextWithTLSRand(context.Background(), rand)
+		req, err := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+		if err != nil {
+			return "", err
+		}
+		resp, err := clnt.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		data, err := netxlite.ReadAllContext(context.Background(), resp.Body)
+		return string(data), err
+	}
+
+	trace := &bytes.Buffer{}
+	recorder := NewRecorder(&netxlite.TProxyStdlib{}, trace)
+	netxlite.TProxy = recorder
+	recorded, err := fetch(recorder.Entropy(entropy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.Err(); err != nil {
+		t.Fatal(err)
+	}
+	server.Close() // make sure we do not use the network when replaying
+
+	events, err := ReadTrace(trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	operations := map[string]bool{}
+	for _, ev := range events {
+		operations[ev.Operation] = true
+	}
+	for _, operation := range []string{OperationDial, OperationEntropy, OperationRead, OperationWrite} {
+		if !operations[operation] {
+			t.Fatal("missing operation", operation)
+		}
+	}
+
+	logger := &warningsLogger{Logger: model.DiscardLogger}
+	replayer := NewReplayer(events, logger)
+	netxlite.TProxy = replayer
+	replayed, err := fetch(replayer.Entropy(entropy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(recorded, replayed); diff != "" {
+		t.Fatal(diff)
+	}
+	if len(logger.warnings) > 0 {
+		t.Fatal("unexpected warnings", logger.warnings)
+	}
+
+	t.Run("when the operation is not in the trace", func(t *testing.T) {
+		_, err := fetch(replayer.Entropy(entropy))
+		if !errors.Is(err, ErrNotInTrace) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+}
+
+func TestReplayer(t *testing.T) {
+	t.Run("LookupHost", func(t *testing.T) {
+		events := []*Event{{
+			Operation: OperationLookupHost,
+			Address:   "dns.google",
+			Addresses: []string{"8.8.8.8", "8.8.4.4"},
+		}, {
+			Operation: OperationLookupHost,
+			Address:   "dns.google",
+			Error:     &Error{Message: "lookup dns.google: no such host"},
+		}}
+		replayer := NewReplayer(events, model.DiscardLogger)
+		addrs, err := replayer.LookupHost(context.Background(), "dns.google")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"8.8.8.8", "8.8.4.4"}, addrs); diff != "" {
+			t.Fatal(diff)
+		}
+		_, err = replayer.LookupHost(context.Background(), "dns.google")
+		if err == nil || !strings.HasSuffix(err.Error(), netxlite.DNSNoSuchHostSuffix) {
+			t.Fatal("unexpected err", err)
+		}
+		_, err = replayer.LookupHost(context.Background(), "dns.google")
+		if !errors.Is(err, ErrNotInTrace) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+
+	t.Run("ListenUDP", func(t *testing.T) {
+		events := []*Event{{
+			Operation: OperationListenUDP,
+			Network:   "udp",
+			ConnID:    1,
+			LocalAddr: "0.0.0.0:54321",
+		}, {
+			Operation: OperationWriteTo,
+			ConnID:    1,
+			Address:   "8.8.8.8:53",
+			Data:      []byte("query"),
+		}, {
+			Operation: OperationReadFrom,
+			ConnID:    1,
+			Address:   "8.8.8.8:53",
+			Data:      []byte("response"),
+		}}
+		replayer := NewReplayer(events, model.DiscardLogger)
+		pconn, err := replayer.ListenUDP("udp", &net.UDPAddr{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := pconn.LocalAddr().(*net.UDPAddr); !ok {
+			t.Fatal("expected a *net.UDPAddr")
+		}
+		dest := &net.UDPAddr{IP: net.IPv4(8, 8, 8, 8), Port: 53}
+		if _, err := pconn.WriteTo([]byte("query"), dest); err != nil {
+			t.Fatal(err)
+		}
+		buffer := make([]byte, 1024)
+		count, addr, err := pconn.ReadFrom(buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buffer[:count]) != "response" || addr.String() != "8.8.8.8:53" {
+			t.Fatal("unexpected datagram", string(buffer[:count]), addr)
+		}
+
+		t.Run("we block until the read deadline", func(t *testing.T) {
+			pconn.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+			_, _, err := pconn.ReadFrom(buffer)
+			if !errors.Is(err, os.ErrDeadlineExceeded) {
+				t.Fatal("unexpected err", err)
+			}
+		})
+
+		t.Run("we block until close", func(t *testing.T) {
+			pconn.SetReadDeadline(time.Time{})
+			time.AfterFunc(10*time.Millisecond, func() {
+				pconn.Close()
+			})
+			_, _, err := pconn.ReadFrom(buffer)
+			if !errors.Is(err, net.ErrClosed) {
+				t.Fatal("unexpected err", err)
+			}
+		})
+	})
+
+	t.Run("Read with a small buffer", func(t *testing.T) {
+		events := []*Event{{
+			Operation: OperationDial,
+			Network:   "tcp",
+			Address:   "8.8.8.8:853",
+			ConnID:    1,
+		}, {
+			Operation: OperationRead,
+			ConnID:    1,
+			Data:      []byte("abcdef"),
+			Error:     newError(io.EOF),
+		}}
+		replayer := NewReplayer(events, model.DiscardLogger)
+		conn, err := replayer.NewSimpleDialer(0).DialContext(context.Background(), "tcp", "8.8.8.8:853")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		buffer := make([]byte, 4)
+		count, err := conn.Read(buffer)
+		if err != nil || string(buffer[:count]) != "abcd" {
+			t.Fatal("unexpected result", string(buffer[:count]), err)
+		}
+		count, err = conn.Read(buffer)
+		if err != io.EOF || string(buffer[:count]) != "ef" {
+			t.Fatal("unexpected result", string(buffer[:count]), err)
+		}
+	})
+
+	t.Run("Entropy", func(t *testing.T) {
+		events := []*Event{{
+			Operation: OperationEntropy,
+			Data:      []byte("ab"),
+		}, {
+			Operation: OperationEntropy,
+			Data:      []byte("cd"),
+		}}
+		replayer := NewReplayer(events, model.DiscardLogger)
+		reader := replayer.Entropy(strings.NewReader("xyz"))
+		data, err := netxlite.ReadAllContext(context.Background(), reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "abcdxyz" {
+			t.Fatal("unexpected data", string(data))
+		}
+	})
+}
@@ -0,0 +1,470 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+// Replayer is a model.UnderlyingNetworkLibrary that replays a trace
+// written by a Recorder without using the network.
+//
+// We match each dial with the first unused recorded dial for the same
+// network and address, each lookup with the first unused recorded lookup
+// for the same domain and each UDP socket with the first unused recorded
+// UDP socket for the same network. Then, we replay the reads and the writes
+// of the corresponding connection or UDP socket in order. Each replayed
+// operation takes as long as the recorded operation.
+type Replayer struct {
+	// conns maps connection IDs to their reads and writes.
+	conns map[int64]*replayerQueues
+
+	// dials maps networks and addresses to the recorded dials.
+	dials map[string][]*Event
+
+	// entropy contains the recorded entropy.
+	entropy []byte
+
+	// listens maps networks to the recorded UDP sockets.
+	listens map[string][]*Event
+
+	// logger is the logger to use.
+	logger model.Logger
+
+	// lookups maps domains to the recorded lookups.
+	lookups map[string][]*Event
+
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+}
+
+var _ model.UnderlyingNetworkLibrary = &Replayer{}
+
+// replayerQueues contains the reads and the writes of a connection.
+type replayerQueues struct {
+	reads  []*Event
+	writes []*Event
+}
+
+// NewReplayer creates a new Replayer for the given trace. We use
+// the logger to warn about divergences from the trace.
+func NewReplayer(events []*Event, logger model.Logger) *Replayer {
+	r := &Replayer{
+		conns:   map[int64]*replayerQueues{},
+		dials:   map[string][]*Event{},
+		listens: map[string][]*Event{},
+		logger:  logger,
+		lookups: map[string][]*Event{},
+	}
+	for _, ev := range events {
+		switch ev.Operation {
+		case OperationDial:
+			key := dialKey(ev.Network, ev.Address)
+			r.dials[key] = append(r.dials[key], ev)
+		case OperationEntropy:
+			r.entropy = append(r.entropy, ev.Data...)
+		case OperationListenUDP:
+			r.listens[ev.Network] = append(r.listens[ev.Network], ev)
+		case OperationLookupHost:
+			r.lookups[ev.Address] = append(r.lookups[ev.Address], ev)
+		case OperationRead, OperationReadFrom:
+			q := r.queues(ev.ConnID)
+			q.reads = append(q.reads, ev)
+		case OperationWrite, OperationWriteTo:
+			q := r.queues(ev.ConnID)
+			q.writes = append(q.writes, ev)
+		}
+	}
+	return r
+}
+
+// dialKey returns the key of the dials map.
+func dialKey(network, address string) string {
+	return network + " " + address
+}
+
+// queues returns the queues of the given connection.
+func (r *Replayer) queues(id int64) *replayerQueues {
+	q := r.conns[id]
+	if q == nil {
+		q = &replayerQueues{}
+		r.conns[id] = q
+	}
+	return q
+}
+
+// ErrNotInTrace indicates that the trace does not contain an operation.
+var ErrNotInTrace = errors.New("replay: operation not in trace")
+
+// pop removes and returns the first event of the given slice.
+func (r *Replayer) pop(events *[]*Event) *Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(*events) <= 0 {
+		return nil
+	}
+	ev := (*events)[0]
+	*events = (*events)[1:]
+	return ev
+}
+
+// popByKey is like pop but uses the slice inside the given map.
+func (r *Replayer) popByKey(m map[string][]*Event, key string) *Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events := m[key]
+	if len(events) <= 0 {
+		return nil
+	}
+	m[key] = events[1:]
+	return events[0]
+}
+
+// Entropy returns a reader returning the recorded entropy, which you
+// should pass to netxlite.ContextWithTLSRand. When we run out of recorded
+// entropy, we read from the given fallback reader.
+func (r *Replayer) Entropy(fallback io.Reader) io.Reader {
+	return &replayerEntropy{r: r, fallback: fallback}
+}
+
+// replayerEntropy returns the recorded entropy.
+type replayerEntropy struct {
+	r        *Replayer
+	fallback io.Reader
+}
+
+// Read implements io.Reader.Read.
+func (e *replayerEntropy) Read(b []byte) (int, error) {
+	e.r.mu.Lock()
+	count := copy(b, e.r.entropy)
+	e.r.entropy = e.r.entropy[count:]
+	e.r.mu.Unlock()
+	if count <= 0 && len(b) > 0 {
+		e.r.logger.Warn("replay: no more recorded entropy")
+		return e.fallback.Read(b)
+	}
+	return count, nil
+}
+
+// DefaultCertPool implements model.UnderlyingNetworkLibrary.DefaultCertPool
+// by returning the pool used by the stdlib.
+func (r *Replayer) DefaultCertPool() *x509.CertPool {
+	return (&netxlite.TProxyStdlib{}).DefaultCertPool()
+}
+
+// LookupHost implements model.UnderlyingNetworkLibrary.LookupHost.
+func (r *Replayer) LookupHost(ctx context.Context, domain string) ([]string, error) {
+	ev := r.popByKey(r.lookups, domain)
+	if ev == nil {
+		r.logger.Warnf("replay: lookup_host %s: not in trace", domain)
+		return nil, fmt.Errorf("%w: lookup_host %s", ErrNotInTrace, domain)
+	}
+	if err := sleepContext(ctx, ev.Duration); err != nil {
+		return nil, err
+	}
+	return ev.Addresses, ev.Error.Err()
+}
+
+// sleepContext sleeps for the given duration unless the context is done first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// NewSimpleDialer implements model.UnderlyingNetworkLibrary.NewSimpleDialer.
+func (r *Replayer) NewSimpleDialer(timeout time.Duration) model.SimpleDialer {
+	return &replayerDialer{r: r}
+}
+
+// replayerDialer is the model.SimpleDialer of a Replayer.
+type replayerDialer struct {
+	r *Replayer
+}
+
+// DialContext implements model.SimpleDialer.DialContext.
+func (d *replayerDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	ev := d.r.popByKey(d.r.dials, dialKey(network, address))
+	if ev == nil {
+		d.r.logger.Warnf("replay: dial %s %s: not in trace", network, address)
+		return nil, fmt.Errorf("%w: dial %s %s", ErrNotInTrace, network, address)
+	}
+	if err := sleepContext(ctx, ev.Duration); err != nil {
+		return nil, err
+	}
+	if ev.Error != nil {
+		return nil, ev.Error.Err()
+	}
+	return &replayerConn{
+		replayerSocket: newReplayerSocket(d.r, ev),
+		remote:         &replayerAddr{network: network, address: address},
+	}, nil
+}
+
+// replayerAddr is a recorded net.Addr.
+type replayerAddr struct {
+	network string
+	address string
+}
+
+// Network implements net.Addr.Network.
+func (a *replayerAddr) Network() string {
+	return a.network
+}
+
+// String implements net.Addr.String.
+func (a *replayerAddr) String() string {
+	return a.address
+}
+
+// replayerSocket contains the code shared by replayed connections
+// and replayed UDP sockets.
+type replayerSocket struct {
+	closeOnce sync.Once
+	closed    chan interface{}
+	deadline  time.Time
+	ev        *Event
+	local     net.Addr
+	mu        sync.Mutex
+	pending   []byte
+	pendingEv *Event
+	queues    *replayerQueues
+	r         *Replayer
+}
+
+// newReplayerSocket creates a replayerSocket for the given recorded
+// dial or listen_udp event.
+func newReplayerSocket(r *Replayer, ev *Event) *replayerSocket {
+	r.mu.Lock()
+	queues := r.queues(ev.ConnID)
+	r.mu.Unlock()
+	return &replayerSocket{
+		closed: make(chan interface{}),
+		ev:     ev,
+		local:  &replayerAddr{network: ev.Network, address: ev.LocalAddr},
+		queues: queues,
+		r:      r,
+	}
+}
+
+// LocalAddr implements net.Conn.LocalAddr.
+func (s *replayerSocket) LocalAddr() net.Addr {
+	return s.local
+}
+
+// Close implements net.Conn.Close.
+func (s *replayerSocket) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+	return nil
+}
+
+// SetDeadline implements net.Conn.SetDeadline.
+func (s *replayerSocket) SetDeadline(t time.Time) error {
+	return s.SetReadDeadline(t)
+}
+
+// SetReadDeadline implements net.Conn.SetReadDeadline.
+func (s *replayerSocket) SetReadDeadline(t time.Time) error {
+	s.mu.Lock()
+	s.deadline = t
+	s.mu.Unlock()
+	return nil
+}
+
+// SetWriteDeadline implements net.Conn.SetWriteDeadline.
+func (s *replayerSocket) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// read returns the next recorded read. When the recorded read returned
+// more bytes than fit into b, we return the remaining bytes with the
+// next read. When the trace contains no more reads, or when the recorded
+// read failed because the socket was closed, we block until the socket
+// is closed or the read deadline expires.
+func (s *replayerSocket) read(b []byte) (int, *Event, error) {
+	s.mu.Lock()
+	if len(s.pending) > 0 {
+		count := copy(b, s.pending)
+		s.pending = s.pending[count:]
+		ev := s.pendingEv
+		s.mu.Unlock()
+		if len(s.pending) > 0 {
+			return count, ev, nil
+		}
+		return count, ev, ev.Error.Err()
+	}
+	s.mu.Unlock()
+	ev := s.r.pop(&s.queues.reads)
+	if ev == nil || (ev.Error != nil && ev.Error.Sentinel == "closed") {
+		return 0, nil, s.wait()
+	}
+	if err := s.sleep(ev.Duration); err != nil {
+		return 0, nil, err
+	}
+	count := copy(b, ev.Data)
+	if count < len(ev.Data) {
+		s.mu.Lock()
+		s.pending = ev.Data[count:]
+		s.pendingEv = ev
+		s.mu.Unlock()
+		return count, ev, nil
+	}
+	return count, ev, ev.Error.Err()
+}
+
+// write replays the next recorded write and warns when the bytes
+// we are writing differ from the recorded ones.
+func (s *replayerSocket) write(b []byte) (int, error) {
+	select {
+	case <-s.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+	ev := s.r.pop(&s.queues.writes)
+	if ev == nil {
+		s.r.logger.Warnf("replay: conn %d: write not in trace", s.ev.ConnID)
+		return len(b), nil
+	}
+	if !bytes.Equal(b, ev.Data) && ev.Error == nil {
+		s.r.logger.Warnf("replay: conn %d: written bytes differ from trace", s.ev.ConnID)
+	}
+	if err := s.sleep(ev.Duration); err != nil {
+		return 0, err
+	}
+	count := len(ev.Data)
+	if count > len(b) {
+		count = len(b)
+	}
+	return count, ev.Error.Err()
+}
+
+// sleep sleeps for the given duration unless the socket is closed first.
+func (s *replayerSocket) sleep(d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-s.closed:
+		return net.ErrClosed
+	}
+}
+
+// wait blocks until the socket is closed or the read deadline expires.
+func (s *replayerSocket) wait() error {
+	s.mu.Lock()
+	deadline := s.deadline
+	s.mu.Unlock()
+	var expired <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case <-s.closed:
+		return net.ErrClosed
+	case <-expired:
+		return os.ErrDeadlineExceeded
+	}
+}
+
+// replayerConn is a replayed net.Conn.
+type replayerConn struct {
+	*replayerSocket
+	remote net.Addr
+}
+
+// Read implements net.Conn.Read.
+func (c *replayerConn) Read(b []byte) (int, error) {
+	count, _, err := c.read(b)
+	return count, err
+}
+
+// Write implements net.Conn.Write.
+func (c *replayerConn) Write(b []byte) (int, error) {
+	return c.write(b)
+}
+
+// RemoteAddr implements net.Conn.RemoteAddr.
+func (c *replayerConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// ListenUDP implements model.UnderlyingNetworkLibrary.ListenUDP.
+func (r *Replayer) ListenUDP(network string, laddr *net.UDPAddr) (model.UDPLikeConn, error) {
+	ev := r.popByKey(r.listens, network)
+	if ev == nil {
+		r.logger.Warnf("replay: listen_udp %s: not in trace", network)
+		return nil, fmt.Errorf("%w: listen_udp %s", ErrNotInTrace, network)
+	}
+	if ev.Error != nil {
+		return nil, ev.Error.Err()
+	}
+	socket := newReplayerSocket(r, ev)
+	if local := udpAddr(ev.LocalAddr); local != nil {
+		socket.local = local
+	}
+	return &replayerUDPLikeConn{replayerSocket: socket}, nil
+}
+
+// udpAddr converts a recorded address to a *net.UDPAddr, which is what
+// the code using UDP sockets (e.g., quic-go) expects. It returns nil if
+// the address is empty or invalid.
+func udpAddr(address string) net.Addr {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if address == "" || err != nil {
+		return nil
+	}
+	return addr
+}
+
+// replayerUDPLikeConn is a replayed model.UDPLikeConn.
+type replayerUDPLikeConn struct {
+	*replayerSocket
+}
+
+// ReadFrom implements model.UDPLikeConn.ReadFrom.
+func (c *replayerUDPLikeConn) ReadFrom(pkt []byte) (int, net.Addr, error) {
+	count, ev, err := c.read(pkt)
+	if ev == nil {
+		return count, nil, err
+	}
+	return count, udpAddr(ev.Address), err
+}
+
+// WriteTo implements model.UDPLikeConn.WriteTo.
+func (c *replayerUDPLikeConn) WriteTo(pkt []byte, addr net.Addr) (int, error) {
+	return c.write(pkt)
+}
+
+// SetReadBuffer implements model.UDPLikeConn.SetReadBuffer.
+func (c *replayerUDPLikeConn) SetReadBuffer(bytes int) error {
+	return nil
+}
+
+// errNoSyscallConn indicates that a replayed UDP socket is not a real socket.
+var errNoSyscallConn = errors.New("replay: no syscall conn")
+
+// SyscallConn implements model.UDPLikeConn.SyscallConn.
+func (c *replayerUDPLikeConn) SyscallConn() (syscall.RawConn, error) {
+	return nil, errNoSyscallConn
+}
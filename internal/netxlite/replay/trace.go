@@ -0,0 +1,248 @@
+// Package replay contains model.UnderlyingNetworkLibrary implementations
+// for reproducing measurements bit-for-bit.
+//
+// The Recorder wraps another model.UnderlyingNetworkLibrary (usually the
+// stdlib) and writes to a trace every dial, connection read and write,
+// UDP exchange and system lookup, along with its timing, its payload and
+// its result. The Replayer reads back a trace and serves the recorded
+// results without touching the network. If you set netxlite.TProxy to a
+// Recorder during a real run and to a Replayer later, the experiment sees
+// the same bytes and the same errors in both runs. This allows to rerun an
+// experiment and its analysis offline (e.g., under a debugger).
+//
+// The bytes sent by TLS and QUIC clients depend on the entropy they read
+// (e.g., the client random and the key shares). Therefore, you should also
+// pass the reader returned by Recorder.Entropy when recording and the reader
+// returned by Replayer.Entropy when replaying to netxlite.ContextWithTLSRand
+// and use the returned context for the measurement. Otherwise, replaying the
+// recorded server bytes fails when the client verifies the handshake. Do not
+// replace crypto/rand.Reader instead, since that would also record (or make
+// predictable) the keys of every other TLS session of the process. Because
+// the entropy is a single stream, the replay is exact when the experiment
+// consumes entropy in the same order in both runs, which is the case when
+// the experiment performs operations sequentially. Likewise, code using
+// math/rand to decide which servers to use may diverge from the trace. In
+// such cases, the Replayer logs a warning and fails the operations that
+// are not in the trace with ErrNotInTrace.
+//
+// A trace contains secrets. Along with the payloads of every connection
+// using the Recorder (including connections that do not use the recorded
+// entropy, e.g., with the OONI backend, whose payloads are encrypted), it
+// contains the entropy of the measurement handshakes, which allows to
+// decrypt the measurement traffic and may include credentials (e.g.,
+// cookies). Only share traces with people you would share the traffic of
+// the run with.
+//
+// We store traces using the JSONL format: each line is an Event. We store
+// system call errors using their number, so you should replay a trace
+// on the operating system where you recorded it.
+package replay
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+// The operations of an Event.
+const (
+	// OperationClose is the close of a connection.
+	OperationClose = "close"
+
+	// OperationDial is the dial of a connection.
+	OperationDial = "dial"
+
+	// OperationEntropy is a read from the entropy source.
+	OperationEntropy = "entropy"
+
+	// OperationListenUDP is the creation of a UDP socket.
+	OperationListenUDP = "listen_udp"
+
+	// OperationLookupHost is a lookup using the system resolver.
+	OperationLookupHost = "lookup_host"
+
+	// OperationRead is a read from a connection.
+	OperationRead = "read"
+
+	// OperationReadFrom is a read from a UDP socket.
+	OperationReadFrom = "read_from"
+
+	// OperationWrite is a write to a connection.
+	OperationWrite = "write"
+
+	// OperationWriteTo is a write to a UDP socket.
+	OperationWriteTo = "write_to"
+)
+
+// Event is an event inside a trace.
+type Event struct {
+	// Operation is the operation (e.g., OperationDial).
+	Operation string `json:"operation"`
+
+	// ConnID is the ID of the connection or UDP socket. We assign
+	// IDs to connections and UDP sockets when we create them.
+	ConnID int64 `json:"conn_id,omitempty"`
+
+	// Network is the network used by dial and listen_udp.
+	Network string `json:"network,omitempty"`
+
+	// Address is the address used by the operation: the remote address
+	// for dial, the peer for read_from and write_to, the local address
+	// for listen_udp and the domain for lookup_host.
+	Address string `json:"address,omitempty"`
+
+	// LocalAddr is the local address of a dialed connection or of a
+	// UDP socket created by listen_udp.
+	LocalAddr string `json:"local_addr,omitempty"`
+
+	// Addresses contains the addresses returned by lookup_host.
+	Addresses []string `json:"addresses,omitempty"`
+
+	// Data contains the bytes read or written.
+	Data []byte `json:"data,omitempty"`
+
+	// Error is the error that occurred or nil.
+	Error *Error `json:"error,omitempty"`
+
+	// T is the time when the operation started relative to the
+	// beginning of the trace.
+	T time.Duration `json:"t"`
+
+	// Duration is the duration of the operation.
+	Duration time.Duration `json:"duration"`
+}
+
+// Error is an error inside a trace. We store enough information
+// to rebuild an error that netxlite classifies like the original one.
+type Error struct {
+	// Message is the error string.
+	Message string `json:"message"`
+
+	// Errno is the system call error wrapped by the error or zero.
+	Errno uintptr `json:"errno,omitempty"`
+
+	// Sentinel is the name of the sentinel error wrapped by the
+	// error (e.g., "eof") or empty. See sentinelErrors.
+	Sentinel string `json:"sentinel,omitempty"`
+
+	// Timeout indicates that the error is a timeout.
+	Timeout bool `json:"timeout,omitempty"`
+}
+
+// sentinelErrors contains the sentinel errors that we preserve.
+var sentinelErrors = map[string]error{
+	"canceled":          context.Canceled,
+	"closed":            net.ErrClosed,
+	"context_deadline":  context.DeadlineExceeded,
+	"deadline_exceeded": os.ErrDeadlineExceeded,
+	"eof":               io.EOF,
+	"unexpected_eof":    io.ErrUnexpectedEOF,
+}
+
+// newError converts an error to an *Error. It returns nil
+// when the input error is nil.
+func newError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	out := &Error{Message: err.Error()}
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		out.Errno = uintptr(errno)
+	}
+	for name, sentinel := range sentinelErrors {
+		if errors.Is(err, sentinel) {
+			out.Sentinel = name
+			break
+		}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		out.Timeout = netErr.Timeout()
+	}
+	return out
+}
+
+// Err rebuilds the original error. We return the sentinel error itself
+// when the original error was the sentinel (e.g., io.EOF), because some
+// code compares errors with sentinels using ==. It returns nil when the
+// receiver is nil.
+func (e *Error) Err() error {
+	if e == nil {
+		return nil
+	}
+	sentinel := sentinelErrors[e.Sentinel]
+	if sentinel != nil && sentinel.Error() == e.Message {
+		return sentinel
+	}
+	return &replayedError{e: e}
+}
+
+// replayedError is an error rebuilt from an *Error.
+type replayedError struct {
+	e *Error
+}
+
+// Error implements error.Error.
+func (err *replayedError) Error() string {
+	return err.e.Message
+}
+
+// Unwrap returns the wrapped system call error or sentinel error.
+func (err *replayedError) Unwrap() error {
+	if err.e.Errno != 0 {
+		return syscall.Errno(err.e.Errno)
+	}
+	return sentinelErrors[err.e.Sentinel]
+}
+
+// Timeout implements net.Error.Timeout.
+func (err *replayedError) Timeout() bool {
+	return err.e.Timeout
+}
+
+// Temporary implements net.Error.Temporary.
+func (err *replayedError) Temporary() bool {
+	return err.e.Timeout
+}
+
+// maxLineSize is the maximum size of a line of a trace.
+const maxLineSize = 1 << 24
+
+// ReadTrace reads a trace in JSONL format.
+func ReadTrace(r io.Reader) ([]*Event, error) {
+	var events []*Event
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLineSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) <= 0 {
+			continue
+		}
+		var ev Event
+		if err := json.Unmarshal(line, &ev); err != nil {
+			return nil, err
+		}
+		events = append(events, &ev)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// ReadTraceFile is like ReadTrace but reads the given file.
+func ReadTraceFile(path string) ([]*Event, error) {
+	filep, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer filep.Close()
+	return ReadTrace(filep)
+}
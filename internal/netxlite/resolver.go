@@ -7,6 +7,7 @@ import (
 	"net"
 	"time"
 
+	"github.com/miekg/dns"
 	"github.com/ooni/probe-cli/v3/internal/model"
 	"golang.org/x/net/idna"
 )
@@ -32,7 +33,7 @@ func NewResolverStdlib(logger model.DebugLogger) model.Resolver {
 //
 // - address is the server address (e.g., 1.1.1.1:53)
 func NewResolverUDP(logger model.DebugLogger, dialer model.Dialer, address string) model.Resolver {
-	return WrapResolver(logger, NewSerialResolver(
+	return WrapResolver(logger, NewParallelResolver(
 		NewDNSOverUDP(dialer, address),
 	))
 }
@@ -70,6 +71,16 @@ func WrapResolver(logger model.DebugLogger, resolver model.Resolver) model.Resol
 type resolverSystem struct {
 	testableTimeout    time.Duration
 	testableLookupHost func(ctx context.Context, domain string) ([]string, error)
+	testableStdlib     resolverSystemStdlib
+}
+
+// resolverSystemStdlib is the part of the net.Resolver API we use
+// for lookups other than LookupHost.
+type resolverSystemStdlib interface {
+	LookupCNAME(ctx context.Context, host string) (string, error)
+	LookupNS(ctx context.Context, name string) ([]*net.NS, error)
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupTXT(ctx context.Context, name string) ([]string, error)
 }
 
 var _ model.Resolver = &resolverSystem{}
@@ -131,6 +142,90 @@ func (r *resolverSystem) LookupHTTPS(
 	return nil, ErrNoDNSTransport
 }
 
+func (r *resolverSystem) LookupSVCB(
+	ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+	return nil, ErrNoDNSTransport
+}
+
+// LookupCNAME uses the stdlib, which only tells us the canonical
+// name. Hence, the returned chain contains at most one entry.
+func (r *resolverSystem) LookupCNAME(ctx context.Context, domain string) ([]string, error) {
+	var cname string
+	err := r.withTimeout(ctx, func(ctx context.Context) (err error) {
+		cname, err = r.stdlib().LookupCNAME(ctx, domain)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	if dns.Fqdn(cname) == dns.Fqdn(domain) {
+		return nil, ErrOODNSNoAnswer
+	}
+	return []string{dns.Fqdn(cname)}, nil
+}
+
+func (r *resolverSystem) LookupNS(ctx context.Context, domain string) ([]*net.NS, error) {
+	var out []*net.NS
+	err := r.withTimeout(ctx, func(ctx context.Context) (err error) {
+		out, err = r.stdlib().LookupNS(ctx, domain)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *resolverSystem) LookupMX(ctx context.Context, domain string) ([]*net.MX, error) {
+	var out []*net.MX
+	err := r.withTimeout(ctx, func(ctx context.Context) (err error) {
+		out, err = r.stdlib().LookupMX(ctx, domain)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *resolverSystem) LookupTXT(ctx context.Context, domain string) ([]string, error) {
+	var out []string
+	err := r.withTimeout(ctx, func(ctx context.Context) (err error) {
+		out, err = r.stdlib().LookupTXT(ctx, domain)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *resolverSystem) stdlib() resolverSystemStdlib {
+	if r.testableStdlib != nil {
+		return r.testableStdlib
+	}
+	return net.DefaultResolver
+}
+
+// withTimeout runs fn in a background goroutine using the same timeout
+// policy of LookupHost and returns early when the context is done. The
+// caller MUST NOT use the results set by fn when we return an error.
+func (r *resolverSystem) withTimeout(
+	ctx context.Context, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout())
+	defer cancel()
+	errch := make(chan error, 1)
+	go func() {
+		errch <- fn(ctx)
+	}()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-errch:
+		return err
+	}
+}
+
 // resolverLogger is a resolver that emits events
 type resolverLogger struct {
 	model.Resolver
@@ -171,6 +266,85 @@ func (r *resolverLogger) LookupHTTPS(
 	return https, nil
 }
 
+func (r *resolverLogger) LookupSVCB(
+	ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+	prefix := fmt.Sprintf("resolve[SVCB] %s with %s (%s)", domain, r.Network(), r.Address())
+	r.Logger.Debugf("%s...", prefix)
+	start := time.Now()
+	svcb, err := r.Resolver.LookupSVCB(ctx, domain)
+	elapsed := time.Since(start)
+	if err != nil {
+		r.Logger.Debugf("%s... %s in %s", prefix, err, elapsed)
+		return nil, err
+	}
+	r.Logger.Debugf("%s... %+v %+v %+v in %s", prefix, svcb.ALPN, svcb.IPv4, svcb.IPv6, elapsed)
+	return svcb, nil
+}
+
+func (r *resolverLogger) LookupCNAME(ctx context.Context, domain string) ([]string, error) {
+	prefix := fmt.Sprintf("resolve[CNAME] %s with %s (%s)", domain, r.Network(), r.Address())
+	r.Logger.Debugf("%s...", prefix)
+	start := time.Now()
+	chain, err := r.Resolver.LookupCNAME(ctx, domain)
+	elapsed := time.Since(start)
+	if err != nil {
+		r.Logger.Debugf("%s... %s in %s", prefix, err, elapsed)
+		return nil, err
+	}
+	r.Logger.Debugf("%s... %+v in %s", prefix, chain, elapsed)
+	return chain, nil
+}
+
+func (r *resolverLogger) LookupNS(ctx context.Context, domain string) ([]*net.NS, error) {
+	prefix := fmt.Sprintf("resolve[NS] %s with %s (%s)", domain, r.Network(), r.Address())
+	r.Logger.Debugf("%s...", prefix)
+	start := time.Now()
+	ns, err := r.Resolver.LookupNS(ctx, domain)
+	elapsed := time.Since(start)
+	if err != nil {
+		r.Logger.Debugf("%s... %s in %s", prefix, err, elapsed)
+		return nil, err
+	}
+	var hosts []string
+	for _, entry := range ns {
+		hosts = append(hosts, entry.Host)
+	}
+	r.Logger.Debugf("%s... %+v in %s", prefix, hosts, elapsed)
+	return ns, nil
+}
+
+func (r *resolverLogger) LookupMX(ctx context.Context, domain string) ([]*net.MX, error) {
+	prefix := fmt.Sprintf("resolve[MX] %s with %s (%s)", domain, r.Network(), r.Address())
+	r.Logger.Debugf("%s...", prefix)
+	start := time.Now()
+	mx, err := r.Resolver.LookupMX(ctx, domain)
+	elapsed := time.Since(start)
+	if err != nil {
+		r.Logger.Debugf("%s... %s in %s", prefix, err, elapsed)
+		return nil, err
+	}
+	var hosts []string
+	for _, entry := range mx {
+		hosts = append(hosts, fmt.Sprintf("%d %s", entry.Pref, entry.Host))
+	}
+	r.Logger.Debugf("%s... %+v in %s", prefix, hosts, elapsed)
+	return mx, nil
+}
+
+func (r *resolverLogger) LookupTXT(ctx context.Context, domain string) ([]string, error) {
+	prefix := fmt.Sprintf("resolve[TXT] %s with %s (%s)", domain, r.Network(), r.Address())
+	r.Logger.Debugf("%s...", prefix)
+	start := time.Now()
+	txt, err := r.Resolver.LookupTXT(ctx, domain)
+	elapsed := time.Since(start)
+	if err != nil {
+		r.Logger.Debugf("%s... %s in %s", prefix, err, elapsed)
+		return nil, err
+	}
+	r.Logger.Debugf("%s... %+v in %s", prefix, txt, elapsed)
+	return txt, nil
+}
+
 // resolverIDNA supports resolving Internationalized Domain Names.
 //
 // See RFC3492 for more information.
@@ -195,6 +369,47 @@ func (r *resolverIDNA) LookupHTTPS(
 	return r.Resolver.LookupHTTPS(ctx, host)
 }
 
+func (r *resolverIDNA) LookupSVCB(
+	ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+	host, err := idna.ToASCII(domain)
+	if err != nil {
+		return nil, err
+	}
+	return r.Resolver.LookupSVCB(ctx, host)
+}
+
+func (r *resolverIDNA) LookupCNAME(ctx context.Context, domain string) ([]string, error) {
+	host, err := idna.ToASCII(domain)
+	if err != nil {
+		return nil, err
+	}
+	return r.Resolver.LookupCNAME(ctx, host)
+}
+
+func (r *resolverIDNA) LookupNS(ctx context.Context, domain string) ([]*net.NS, error) {
+	host, err := idna.ToASCII(domain)
+	if err != nil {
+		return nil, err
+	}
+	return r.Resolver.LookupNS(ctx, host)
+}
+
+func (r *resolverIDNA) LookupMX(ctx context.Context, domain string) ([]*net.MX, error) {
+	host, err := idna.ToASCII(domain)
+	if err != nil {
+		return nil, err
+	}
+	return r.Resolver.LookupMX(ctx, host)
+}
+
+func (r *resolverIDNA) LookupTXT(ctx context.Context, domain string) ([]string, error) {
+	host, err := idna.ToASCII(domain)
+	if err != nil {
+		return nil, err
+	}
+	return r.Resolver.LookupTXT(ctx, host)
+}
+
 // resolverShortCircuitIPAddr recognizes when the input hostname is an
 // IP address and returns it immediately to the caller.
 type resolverShortCircuitIPAddr struct {
@@ -238,6 +453,27 @@ func (r *nullResolver) LookupHTTPS(
 	return nil, ErrNoResolver
 }
 
+func (r *nullResolver) LookupSVCB(
+	ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+	return nil, ErrNoResolver
+}
+
+func (r *nullResolver) LookupCNAME(ctx context.Context, domain string) ([]string, error) {
+	return nil, ErrNoResolver
+}
+
+func (r *nullResolver) LookupNS(ctx context.Context, domain string) ([]*net.NS, error) {
+	return nil, ErrNoResolver
+}
+
+func (r *nullResolver) LookupMX(ctx context.Context, domain string) ([]*net.MX, error) {
+	return nil, ErrNoResolver
+}
+
+func (r *nullResolver) LookupTXT(ctx context.Context, domain string) ([]string, error) {
+	return nil, ErrNoResolver
+}
+
 // resolverErrWrapper is a Resolver that knows about wrapping errors.
 type resolverErrWrapper struct {
 	model.Resolver
@@ -261,3 +497,43 @@ func (r *resolverErrWrapper) LookupHTTPS(
 	}
 	return out, nil
 }
+
+func (r *resolverErrWrapper) LookupSVCB(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+	out, err := r.Resolver.LookupSVCB(ctx, domain)
+	if err != nil {
+		return nil, NewErrWrapper(classifyResolverError, ResolveOperation, err)
+	}
+	return out, nil
+}
+
+func (r *resolverErrWrapper) LookupCNAME(ctx context.Context, domain string) ([]string, error) {
+	out, err := r.Resolver.LookupCNAME(ctx, domain)
+	if err != nil {
+		return nil, NewErrWrapper(classifyResolverError, ResolveOperation, err)
+	}
+	return out, nil
+}
+
+func (r *resolverErrWrapper) LookupNS(ctx context.Context, domain string) ([]*net.NS, error) {
+	out, err := r.Resolver.LookupNS(ctx, domain)
+	if err != nil {
+		return nil, NewErrWrapper(classifyResolverError, ResolveOperation, err)
+	}
+	return out, nil
+}
+
+func (r *resolverErrWrapper) LookupMX(ctx context.Context, domain string) ([]*net.MX, error) {
+	out, err := r.Resolver.LookupMX(ctx, domain)
+	if err != nil {
+		return nil, NewErrWrapper(classifyResolverError, ResolveOperation, err)
+	}
+	return out, nil
+}
+
+func (r *resolverErrWrapper) LookupTXT(ctx context.Context, domain string) ([]string, error) {
+	out, err := r.Resolver.LookupTXT(ctx, domain)
+	if err != nil {
+		return nil, NewErrWrapper(classifyResolverError, ResolveOperation, err)
+	}
+	return out, nil
+}
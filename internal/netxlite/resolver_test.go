@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"io"
+	"net"
 	"strings"
 	"sync"
 	"testing"
@@ -37,8 +38,8 @@ func TestNewResolverUDP(t *testing.T) {
 	}
 	shortCircuit := logger.Resolver.(*resolverShortCircuitIPAddr)
 	errWrapper := shortCircuit.Resolver.(*resolverErrWrapper)
-	serio := errWrapper.Resolver.(*SerialResolver)
-	txp := serio.Transport().(*DNSOverUDP)
+	reso := errWrapper.Resolver.(*ParallelResolver)
+	txp := reso.Transport().(*DNSOverUDP)
 	if txp.Address() != "1.1.1.1:53" {
 		t.Fatal("invalid address")
 	}
@@ -166,6 +167,168 @@ func TestResolverSystem(t *testing.T) {
 			t.Fatal("expected nil result")
 		}
 	})
+
+	t.Run("LookupSVCB", func(t *testing.T) {
+		r := &resolverSystem{}
+		svcb, err := r.LookupSVCB(context.Background(), "x.org")
+		if !errors.Is(err, ErrNoDNSTransport) {
+			t.Fatal("not the error we expected")
+		}
+		if svcb != nil {
+			t.Fatal("expected nil result")
+		}
+	})
+
+	t.Run("LookupCNAME", func(t *testing.T) {
+		t.Run("with success", func(t *testing.T) {
+			r := &resolverSystem{
+				testableStdlib: &resolverSystemStdlibMock{cname: "cdn.x.org"},
+			}
+			cnames, err := r.LookupCNAME(context.Background(), "www.x.org")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff([]string{"cdn.x.org."}, cnames); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+
+		t.Run("without any CNAME", func(t *testing.T) {
+			r := &resolverSystem{
+				testableStdlib: &resolverSystemStdlibMock{cname: "x.org."},
+			}
+			cnames, err := r.LookupCNAME(context.Background(), "x.org")
+			if !errors.Is(err, ErrOODNSNoAnswer) {
+				t.Fatal("not the error we expected", err)
+			}
+			if cnames != nil {
+				t.Fatal("expected nil result")
+			}
+		})
+
+		t.Run("with failure", func(t *testing.T) {
+			expected := errors.New("mocked error")
+			r := &resolverSystem{
+				testableStdlib: &resolverSystemStdlibMock{err: expected},
+			}
+			cnames, err := r.LookupCNAME(context.Background(), "www.x.org")
+			if !errors.Is(err, expected) {
+				t.Fatal("not the error we expected", err)
+			}
+			if cnames != nil {
+				t.Fatal("expected nil result")
+			}
+		})
+	})
+
+	t.Run("LookupNS, LookupMX, and LookupTXT", func(t *testing.T) {
+		t.Run("with success", func(t *testing.T) {
+			stdlib := &resolverSystemStdlibMock{
+				ns:  []*net.NS{{Host: "ns1.x.org."}},
+				mx:  []*net.MX{{Host: "mx.x.org.", Pref: 10}},
+				txt: []string{"v=spf1 -all"},
+			}
+			r := &resolverSystem{testableStdlib: stdlib}
+			ctx := context.Background()
+			ns, err := r.LookupNS(ctx, "x.org")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(stdlib.ns, ns); diff != "" {
+				t.Fatal(diff)
+			}
+			mx, err := r.LookupMX(ctx, "x.org")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(stdlib.mx, mx); diff != "" {
+				t.Fatal(diff)
+			}
+			txt, err := r.LookupTXT(ctx, "x.org")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(stdlib.txt, txt); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+
+		t.Run("with failure", func(t *testing.T) {
+			expected := errors.New("mocked error")
+			r := &resolverSystem{
+				testableStdlib: &resolverSystemStdlibMock{err: expected},
+			}
+			ctx := context.Background()
+			if ns, err := r.LookupNS(ctx, "x.org"); !errors.Is(err, expected) || ns != nil {
+				t.Fatal("unexpected LookupNS result", ns, err)
+			}
+			if mx, err := r.LookupMX(ctx, "x.org"); !errors.Is(err, expected) || mx != nil {
+				t.Fatal("unexpected LookupMX result", mx, err)
+			}
+			if txt, err := r.LookupTXT(ctx, "x.org"); !errors.Is(err, expected) || txt != nil {
+				t.Fatal("unexpected LookupTXT result", txt, err)
+			}
+		})
+
+		t.Run("with timeout", func(t *testing.T) {
+			done := make(chan interface{})
+			r := &resolverSystem{
+				testableTimeout: 1 * time.Microsecond,
+				testableStdlib:  &resolverSystemStdlibMock{block: done},
+			}
+			txt, err := r.LookupTXT(context.Background(), "x.org")
+			close(done)
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatal("not the error we expected", err)
+			}
+			if txt != nil {
+				t.Fatal("expected nil result")
+			}
+		})
+	})
+
+	t.Run("check default stdlib", func(t *testing.T) {
+		r := &resolverSystem{}
+		if r.stdlib() != net.DefaultResolver {
+			t.Fatal("unexpected default stdlib")
+		}
+	})
+}
+
+// resolverSystemStdlibMock is a mockable resolverSystemStdlib.
+type resolverSystemStdlibMock struct {
+	block chan interface{}
+	cname string
+	err   error
+	mx    []*net.MX
+	ns    []*net.NS
+	txt   []string
+}
+
+func (m *resolverSystemStdlibMock) wait() {
+	if m.block != nil {
+		<-m.block
+	}
+}
+
+func (m *resolverSystemStdlibMock) LookupCNAME(ctx context.Context, host string) (string, error) {
+	m.wait()
+	return m.cname, m.err
+}
+
+func (m *resolverSystemStdlibMock) LookupNS(ctx context.Context, name string) ([]*net.NS, error) {
+	m.wait()
+	return m.ns, m.err
+}
+
+func (m *resolverSystemStdlibMock) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	m.wait()
+	return m.mx, m.err
+}
+
+func (m *resolverSystemStdlibMock) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	m.wait()
+	return m.txt, m.err
 }
 
 func TestResolverLogger(t *testing.T) {
@@ -312,6 +475,77 @@ func TestResolverLogger(t *testing.T) {
 		})
 	})
 
+	t.Run("record type lookups", func(t *testing.T) {
+		newResolver := func(err error) *mocks.Resolver {
+			return &mocks.Resolver{
+				MockLookupSVCB: func(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+					if err != nil {
+						return nil, err
+					}
+					return &model.HTTPSSvc{ALPN: []string{"dot"}}, nil
+				},
+				MockLookupCNAME: func(ctx context.Context, domain string) ([]string, error) {
+					if err != nil {
+						return nil, err
+					}
+					return []string{"cdn.x.org."}, nil
+				},
+				MockLookupNS: func(ctx context.Context, domain string) ([]*net.NS, error) {
+					if err != nil {
+						return nil, err
+					}
+					return []*net.NS{{Host: "ns1.x.org."}}, nil
+				},
+				MockLookupMX: func(ctx context.Context, domain string) ([]*net.MX, error) {
+					if err != nil {
+						return nil, err
+					}
+					return []*net.MX{{Host: "mx.x.org.", Pref: 10}}, nil
+				},
+				MockLookupTXT: func(ctx context.Context, domain string) ([]string, error) {
+					if err != nil {
+						return nil, err
+					}
+					return []string{"v=spf1 -all"}, nil
+				},
+				MockNetwork: func() string {
+					return "udp"
+				},
+				MockAddress: func() string {
+					return "8.8.8.8:53"
+				},
+			}
+		}
+
+		for _, expected := range []error{nil, errors.New("mocked error")} {
+			var count int
+			lo := &mocks.Logger{
+				MockDebugf: func(format string, v ...interface{}) {
+					count++
+				},
+			}
+			r := &resolverLogger{Logger: lo, Resolver: newResolver(expected)}
+			ctx := context.Background()
+			if _, err := r.LookupSVCB(ctx, "x.org"); !errors.Is(err, expected) {
+				t.Fatal("unexpected LookupSVCB error", err)
+			}
+			if _, err := r.LookupCNAME(ctx, "x.org"); !errors.Is(err, expected) {
+				t.Fatal("unexpected LookupCNAME error", err)
+			}
+			if _, err := r.LookupNS(ctx, "x.org"); !errors.Is(err, expected) {
+				t.Fatal("unexpected LookupNS error", err)
+			}
+			if _, err := r.LookupMX(ctx, "x.org"); !errors.Is(err, expected) {
+				t.Fatal("unexpected LookupMX error", err)
+			}
+			if _, err := r.LookupTXT(ctx, "x.org"); !errors.Is(err, expected) {
+				t.Fatal("unexpected LookupTXT error", err)
+			}
+			if count != 10 {
+				t.Fatal("unexpected count", count)
+			}
+		}
+	})
 }
 
 func TestResolverIDNA(t *testing.T) {
@@ -400,6 +634,70 @@ func TestResolverIDNA(t *testing.T) {
 			}
 		})
 	})
+
+	t.Run("record type lookups", func(t *testing.T) {
+		const expectDomain = "xn--d1acpjx3f.xn--p1ai"
+		r := &resolverIDNA{
+			Resolver: &mocks.Resolver{
+				MockLookupSVCB: func(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+					if domain != expectDomain {
+						return nil, errors.New("passed invalid domain")
+					}
+					return &model.HTTPSSvc{}, nil
+				},
+				MockLookupCNAME: func(ctx context.Context, domain string) ([]string, error) {
+					if domain != expectDomain {
+						return nil, errors.New("passed invalid domain")
+					}
+					return []string{}, nil
+				},
+				MockLookupNS: func(ctx context.Context, domain string) ([]*net.NS, error) {
+					if domain != expectDomain {
+						return nil, errors.New("passed invalid domain")
+					}
+					return []*net.NS{}, nil
+				},
+				MockLookupMX: func(ctx context.Context, domain string) ([]*net.MX, error) {
+					if domain != expectDomain {
+						return nil, errors.New("passed invalid domain")
+					}
+					return []*net.MX{}, nil
+				},
+				MockLookupTXT: func(ctx context.Context, domain string) ([]string, error) {
+					if domain != expectDomain {
+						return nil, errors.New("passed invalid domain")
+					}
+					return []string{}, nil
+				},
+			},
+		}
+		for _, domain := range []string{"яндекс.рф", "xn--0000h"} {
+			// See https://www.farsightsecurity.com/blog/txt-record/punycode-20180711/
+			// for why xn--0000h is not a valid punycode domain.
+			check := func(err error) {
+				if domain == "xn--0000h" {
+					if err == nil || !strings.HasPrefix(err.Error(), "idna: invalid label") {
+						t.Fatal("not the error we expected", err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			ctx := context.Background()
+			_, err := r.LookupSVCB(ctx, domain)
+			check(err)
+			_, err = r.LookupCNAME(ctx, domain)
+			check(err)
+			_, err = r.LookupNS(ctx, domain)
+			check(err)
+			_, err = r.LookupMX(ctx, domain)
+			check(err)
+			_, err = r.LookupTXT(ctx, domain)
+			check(err)
+		}
+	})
 }
 
 func TestResolverShortCircuitIPAddr(t *testing.T) {
@@ -480,6 +778,26 @@ func TestNullResolver(t *testing.T) {
 		}
 		r.CloseIdleConnections() // for coverage
 	})
+
+	t.Run("record type lookups", func(t *testing.T) {
+		r := &nullResolver{}
+		ctx := context.Background()
+		if svcb, err := r.LookupSVCB(ctx, "dns.google"); !errors.Is(err, ErrNoResolver) || svcb != nil {
+			t.Fatal("unexpected LookupSVCB result", svcb, err)
+		}
+		if cnames, err := r.LookupCNAME(ctx, "dns.google"); !errors.Is(err, ErrNoResolver) || cnames != nil {
+			t.Fatal("unexpected LookupCNAME result", cnames, err)
+		}
+		if ns, err := r.LookupNS(ctx, "dns.google"); !errors.Is(err, ErrNoResolver) || ns != nil {
+			t.Fatal("unexpected LookupNS result", ns, err)
+		}
+		if mx, err := r.LookupMX(ctx, "dns.google"); !errors.Is(err, ErrNoResolver) || mx != nil {
+			t.Fatal("unexpected LookupMX result", mx, err)
+		}
+		if txt, err := r.LookupTXT(ctx, "dns.google"); !errors.Is(err, ErrNoResolver) || txt != nil {
+			t.Fatal("unexpected LookupTXT result", txt, err)
+		}
+	})
 }
 
 func TestResolverErrWrapper(t *testing.T) {
@@ -607,4 +925,51 @@ func TestResolverErrWrapper(t *testing.T) {
 			}
 		})
 	})
+
+	t.Run("record type lookups", func(t *testing.T) {
+		reso := &resolverErrWrapper{
+			Resolver: &mocks.Resolver{
+				MockLookupSVCB: func(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+					return nil, io.EOF
+				},
+				MockLookupCNAME: func(ctx context.Context, domain string) ([]string, error) {
+					return nil, io.EOF
+				},
+				MockLookupNS: func(ctx context.Context, domain string) ([]*net.NS, error) {
+					return nil, io.EOF
+				},
+				MockLookupMX: func(ctx context.Context, domain string) ([]*net.MX, error) {
+					return nil, io.EOF
+				},
+				MockLookupTXT: func(ctx context.Context, domain string) ([]string, error) {
+					return []string{"v=spf1 -all"}, nil
+				},
+			},
+		}
+		ctx := context.Background()
+		check := func(err error) {
+			if err == nil || err.Error() != FailureEOFError {
+				t.Fatal("unexpected err", err)
+			}
+			var ew *ErrWrapper
+			if !errors.As(err, &ew) || ew.Operation != ResolveOperation {
+				t.Fatal("unexpected operation", err)
+			}
+		}
+		_, err := reso.LookupSVCB(ctx, "")
+		check(err)
+		_, err = reso.LookupCNAME(ctx, "")
+		check(err)
+		_, err = reso.LookupNS(ctx, "")
+		check(err)
+		_, err = reso.LookupMX(ctx, "")
+		check(err)
+		txt, err := reso.LookupTXT(ctx, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"v=spf1 -all"}, txt); diff != "" {
+			t.Fatal(diff)
+		}
+	})
 }
@@ -2,8 +2,8 @@ package netxlite
 
 import (
 	"context"
-	"errors"
 	"net"
+	"time"
 
 	"github.com/miekg/dns"
 	"github.com/ooni/probe-cli/v3/internal/atomicx"
@@ -25,6 +25,10 @@ type SerialResolver struct {
 	// NumTimeouts is MANDATORY and counts the number of timeouts.
 	NumTimeouts *atomicx.Int64
 
+	// QueryOptions contains the OPTIONAL EDNS0 options to use. When
+	// nil, we only add EDNS0 padding if the transport requires it.
+	QueryOptions *model.DNSQueryOptions
+
 	// Txp is the underlying DNS transport.
 	Txp model.DNSTransport
 }
@@ -61,72 +65,73 @@ func (r *SerialResolver) CloseIdleConnections() {
 
 // LookupHost performs an A lookup followed by an AAAA lookup for hostname.
 func (r *SerialResolver) LookupHost(ctx context.Context, hostname string) ([]string, error) {
+	addrs, _, err := r.LookupHostWithTTL(ctx, hostname)
+	return addrs, err
+}
+
+// LookupHostWithTTL implements model.ResolverWithTTL.LookupHostWithTTL. The
+// returned TTL is the minimum between the TTLs of the A and AAAA replies.
+func (r *SerialResolver) LookupHostWithTTL(
+	ctx context.Context, hostname string) ([]string, time.Duration, error) {
 	var addrs []string
-	addrsA, errA := r.lookupHostWithRetry(ctx, hostname, dns.TypeA)
-	addrsAAAA, errAAAA := r.lookupHostWithRetry(ctx, hostname, dns.TypeAAAA)
+	addrsA, ttlA, errA := r.querier().lookupHostWithRetry(ctx, hostname, dns.TypeA)
+	addrsAAAA, ttlAAAA, errAAAA := r.querier().lookupHostWithRetry(ctx, hostname, dns.TypeAAAA)
+	ttl := ttlA
+	if ttlAAAA < ttl {
+		ttl = ttlAAAA
+	}
 	if errA != nil && errAAAA != nil {
 		// Note: we choose to return the errA because we assume that
 		// it's the more meaningful one: the errAAAA may just be telling
 		// us that there is no AAAA record for the website.
-		return nil, errA
+		return nil, ttl, errA
 	}
 	addrs = append(addrs, addrsA...)
 	addrs = append(addrs, addrsAAAA...)
-	return addrs, nil
+	return addrs, ttl, nil
 }
 
 // LookupHTTPS implements Resolver.LookupHTTPS.
 func (r *SerialResolver) LookupHTTPS(
 	ctx context.Context, hostname string) (*model.HTTPSSvc, error) {
-	querydata, err := r.Encoder.Encode(
-		hostname, dns.TypeHTTPS, r.Txp.RequiresPadding())
-	if err != nil {
-		return nil, err
-	}
-	replydata, err := r.Txp.RoundTrip(ctx, querydata)
-	if err != nil {
-		return nil, err
-	}
-	return r.Decoder.DecodeHTTPS(replydata)
+	return r.querier().lookupHTTPS(ctx, hostname)
 }
 
-func (r *SerialResolver) lookupHostWithRetry(
-	ctx context.Context, hostname string, qtype uint16) ([]string, error) {
-	var errorslist []error
-	for i := 0; i < 3; i++ {
-		replies, err := r.lookupHostWithoutRetry(ctx, hostname, qtype)
-		if err == nil {
-			return replies, nil
-		}
-		errorslist = append(errorslist, err)
-		var operr *net.OpError
-		if !errors.As(err, &operr) || !operr.Timeout() {
-			// The first error is the one that is most likely to be caused
-			// by the network. Subsequent errors are more likely to be caused
-			// by context deadlines. So, the first error is attached to an
-			// operation, while subsequent errors may possibly not be. If
-			// so, the resulting failing operation is not correct.
-			break
-		}
-		r.NumTimeouts.Add(1)
-	}
-	// bugfix: we MUST return one of the errors otherwise we confuse the
-	// mechanism in errwrap that classifies the root cause operation, since
-	// it would not be able to find a child with a major operation error
-	return nil, errorslist[0]
+// LookupSVCB implements Resolver.LookupSVCB.
+func (r *SerialResolver) LookupSVCB(
+	ctx context.Context, hostname string) (*model.HTTPSSvc, error) {
+	return r.querier().lookupSVCB(ctx, hostname)
 }
 
-// lookupHostWithoutRetry issues a lookup host query for the specified
-// qtype (dns.A or dns.AAAA) without retrying on failure.
-func (r *SerialResolver) lookupHostWithoutRetry(
-	ctx context.Context, hostname string, qtype uint16) ([]string, error) {
-	querydata, err := r.Encoder.Encode(hostname, qtype, r.Txp.RequiresPadding())
-	if err != nil {
-		return nil, err
-	}
-	replydata, err := r.Txp.RoundTrip(ctx, querydata)
-	if err != nil {
-		return nil, err
+// LookupCNAME implements Resolver.LookupCNAME.
+func (r *SerialResolver) LookupCNAME(ctx context.Context, hostname string) ([]string, error) {
+	return r.querier().lookupCNAME(ctx, hostname)
+}
+
+// LookupNS implements Resolver.LookupNS.
+func (r *SerialResolver) LookupNS(ctx context.Context, hostname string) ([]*net.NS, error) {
+	return r.querier().lookupNS(ctx, hostname)
+}
+
+// LookupMX implements Resolver.LookupMX.
+func (r *SerialResolver) LookupMX(ctx context.Context, hostname string) ([]*net.MX, error) {
+	return r.querier().lookupMX(ctx, hostname)
+}
+
+// LookupTXT implements Resolver.LookupTXT.
+func (r *SerialResolver) LookupTXT(ctx context.Context, hostname string) ([]string, error) {
+	return r.querier().lookupTXT(ctx, hostname)
+}
+
+// querier returns the dnsQuerier for sending queries.
+func (r *SerialResolver) querier() *dnsQuerier {
+	return &dnsQuerier{
+		decoder:     r.Decoder,
+		encoder:     r.Encoder,
+		numTimeouts: r.NumTimeouts,
+		options:     r.QueryOptions,
+		txp:         r.Txp,
 	}
-	return r.Decoder.DecodeLookupHost(qtype, replydata)
 }
+
+var _ model.ResolverWithTTL = &SerialResolver{}
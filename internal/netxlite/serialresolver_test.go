@@ -6,7 +6,9 @@ import (
 	"errors"
 	"net"
 	"testing"
+	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/miekg/dns"
 	"github.com/ooni/probe-cli/v3/internal/atomicx"
 	"github.com/ooni/probe-cli/v3/internal/model"
@@ -273,4 +275,218 @@ func TestSerialResolver(t *testing.T) {
 			}
 		})
 	})
+
+	t.Run("record type lookups", func(t *testing.T) {
+		r := NewSerialResolver(dnsRecordTypesTransport(t))
+		dnsCheckRecordTypeLookups(t, r)
+	})
+
+	t.Run("LookupHostWithTTL", func(t *testing.T) {
+		dnsCheckLookupHostWithTTL(t, func(txp model.DNSTransport) model.ResolverWithTTL {
+			return NewSerialResolver(txp)
+		})
+	})
+
+	t.Run("with QueryOptions", func(t *testing.T) {
+		var queries []*dns.Msg
+		txp := &mocks.DNSTransport{
+			MockRoundTrip: func(ctx context.Context, rawQuery []byte) ([]byte, error) {
+				query := new(dns.Msg)
+				if err := query.Unpack(rawQuery); err != nil {
+					return nil, err
+				}
+				queries = append(queries, query)
+				return dnsGenReplyWithAnswers(t, query.Question[0].Qtype), nil
+			},
+			MockRequiresPadding: func() bool {
+				return true
+			},
+		}
+		r := NewSerialResolver(txp)
+		r.QueryOptions = &model.DNSQueryOptions{
+			DNSSECOK:     true,
+			ClientSubnet: "130.192.91.0/24",
+		}
+		r.LookupTXT(context.Background(), "x.org")
+		if len(queries) != 1 {
+			t.Fatal("unexpected number of queries")
+		}
+		opt := queries[0].IsEdns0()
+		if opt == nil || !opt.Do() || len(opt.Option) != 2 {
+			t.Fatal("the query does not contain the expected EDNS0 options")
+		}
+		if _, ok := opt.Option[1].(*dns.EDNS0_PADDING); !ok {
+			t.Fatal("expected padding because the transport requires it")
+		}
+	})
+}
+
+// dnsRecordTypesTransport returns a transport that answers to SVCB, A
+// (with a CNAME chain), NS, MX, and TXT queries for x.org.
+func dnsRecordTypesTransport(t *testing.T) model.DNSTransport {
+	return &mocks.DNSTransport{
+		MockRoundTrip: func(ctx context.Context, rawQuery []byte) ([]byte, error) {
+			query := new(dns.Msg)
+			if err := query.Unpack(rawQuery); err != nil {
+				return nil, err
+			}
+			qtype := query.Question[0].Qtype
+			var answers []dns.RR
+			switch qtype {
+			case dns.TypeSVCB:
+				answers = append(answers, &dns.SVCB{
+					Hdr:    dnsGenRRHeader(dns.TypeSVCB),
+					Target: "dns.x.org.",
+					Value:  []dns.SVCBKeyValue{&dns.SVCBAlpn{Alpn: []string{"dot"}}},
+				})
+			case dns.TypeA:
+				answers = append(answers, &dns.CNAME{
+					Hdr:    dnsGenRRHeader(dns.TypeCNAME),
+					Target: "cdn.x.org.",
+				})
+			case dns.TypeNS:
+				answers = append(answers, &dns.NS{
+					Hdr: dnsGenRRHeader(dns.TypeNS),
+					Ns:  "ns1.x.org.",
+				})
+			case dns.TypeMX:
+				answers = append(answers, &dns.MX{
+					Hdr:        dnsGenRRHeader(dns.TypeMX),
+					Preference: 10,
+					Mx:         "mx.x.org.",
+				})
+			case dns.TypeTXT:
+				answers = append(answers, &dns.TXT{
+					Hdr: dnsGenRRHeader(dns.TypeTXT),
+					Txt: []string{"v=spf1 -all"},
+				})
+			}
+			return dnsGenReplyWithAnswers(t, qtype, answers...), nil
+		},
+		MockRequiresPadding: func() bool {
+			return false
+		},
+	}
+}
+
+// dnsCheckRecordTypeLookups checks that r sends the expected queries
+// to a transport created using dnsRecordTypesTransport.
+func dnsCheckRecordTypeLookups(t *testing.T, r model.Resolver) {
+	ctx := context.Background()
+	svcb, err := r.LookupSVCB(ctx, "x.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"dot"}, svcb.ALPN); diff != "" {
+		t.Fatal(diff)
+	}
+	cnames, err := r.LookupCNAME(ctx, "x.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"cdn.x.org."}, cnames); diff != "" {
+		t.Fatal(diff)
+	}
+	ns, err := r.LookupNS(ctx, "x.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]*net.NS{{Host: "ns1.x.org."}}, ns); diff != "" {
+		t.Fatal(diff)
+	}
+	mx, err := r.LookupMX(ctx, "x.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]*net.MX{{Host: "mx.x.org.", Pref: 10}}, mx); diff != "" {
+		t.Fatal(diff)
+	}
+	txt, err := r.LookupTXT(ctx, "x.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"v=spf1 -all"}, txt); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+// dnsCheckLookupHostWithTTL checks the TTL returned by the
+// LookupHostWithTTL method of the resolvers created by newResolver.
+func dnsCheckLookupHostWithTTL(
+	t *testing.T, newResolver func(txp model.DNSTransport) model.ResolverWithTTL) {
+	// newTransport returns a transport replying to A queries with
+	// replyA and to AAAA queries with replyAAAA.
+	newTransport := func(replyA, replyAAAA []byte) model.DNSTransport {
+		return &mocks.DNSTransport{
+			MockRoundTrip: func(ctx context.Context, rawQuery []byte) ([]byte, error) {
+				query := new(dns.Msg)
+				if err := query.Unpack(rawQuery); err != nil {
+					return nil, err
+				}
+				reply := replyA
+				if query.Question[0].Qtype == dns.TypeAAAA {
+					reply = replyAAAA
+				}
+				if reply == nil {
+					return nil, errors.New("mocked error")
+				}
+				return reply, nil
+			},
+			MockRequiresPadding: func() bool {
+				return false
+			},
+		}
+	}
+	replyA := dnsGenReplyWithAnswers(t, dns.TypeA, &dns.A{
+		Hdr: dns.RR_Header{
+			Name:   dns.Fqdn("x.org"),
+			Rrtype: dns.TypeA,
+			Class:  dns.ClassINET,
+			Ttl:    300,
+		},
+		A: net.IPv4(1, 1, 1, 1),
+	})
+	replyNXDOMAIN := dnsGenNXDOMAINReplyWithSOA(t, 3600, 60)
+
+	t.Run("with the minimum TTL of the A and AAAA replies", func(t *testing.T) {
+		r := newResolver(newTransport(replyA, replyNXDOMAIN))
+		addrs, ttl, err := r.LookupHostWithTTL(context.Background(), "x.org")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"1.1.1.1"}, addrs); diff != "" {
+			t.Fatal(diff)
+		}
+		if ttl != 60*time.Second {
+			t.Fatal("unexpected TTL", ttl)
+		}
+	})
+
+	t.Run("with the negative TTL on NXDOMAIN", func(t *testing.T) {
+		r := newResolver(newTransport(replyNXDOMAIN, replyNXDOMAIN))
+		addrs, ttl, err := r.LookupHostWithTTL(context.Background(), "x.org")
+		if !errors.Is(err, ErrOODNSNoSuchHost) {
+			t.Fatal("not the error we expected", err)
+		}
+		if addrs != nil {
+			t.Fatal("expected nil addrs")
+		}
+		if ttl != 60*time.Second {
+			t.Fatal("unexpected TTL", ttl)
+		}
+	})
+
+	t.Run("with zero TTL when a round trip fails", func(t *testing.T) {
+		r := newResolver(newTransport(replyA, nil))
+		addrs, ttl, err := r.LookupHostWithTTL(context.Background(), "x.org")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"1.1.1.1"}, addrs); diff != "" {
+			t.Fatal(diff)
+		}
+		if ttl != 0 {
+			t.Fatal("unexpected TTL", ttl)
+		}
+	})
 }
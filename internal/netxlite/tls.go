@@ -6,6 +6,7 @@ import (
 	"crypto/x509"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"time"
 
@@ -77,12 +78,12 @@ func TLSCipherSuiteString(value uint16) string {
 // NewDefaultCertPool returns the default x509 certificate pool
 // that we bundle from Mozilla. It's safe to modify the returned
 // value: every invocation returns a distinct *x509.CertPool instance.
+//
+// When you replace TProxy, this function returns the pool returned
+// by TProxy.DefaultCertPool instead (e.g., the pool containing the CA
+// used by the servers of a simulated network).
 func NewDefaultCertPool() *x509.CertPool {
-	pool := x509.NewCertPool()
-	// Assumption: AppendCertsFromPEM cannot fail because we
-	// have a test in certify_test.go that guarantees that
-	pool.AppendCertsFromPEM([]byte(pemcerts))
-	return pool
+	return TProxy.DefaultCertPool()
 }
 
 // ErrInvalidTLSVersion indicates that you passed us a string
@@ -165,6 +166,17 @@ var _ model.TLSHandshaker = &tlsHandshakerConfigurable{}
 // value into a private variable to enable for unit testing.
 var defaultCertPool = NewDefaultCertPool()
 
+// DefaultCertPool returns the cert pool that netxlite uses when the
+// RootCAs of a tls.Config are nil. Unlike NewDefaultCertPool, this
+// function returns a shared pool when using the default TProxy, so
+// you MUST NOT modify the returned value.
+func DefaultCertPool() *x509.CertPool {
+	if _, ok := TProxy.(*TProxyStdlib); ok {
+		return defaultCertPool
+	}
+	return TProxy.DefaultCertPool()
+}
+
 // Handshake implements Handshaker.Handshake. This function will
 // configure the code to use the built-in Mozilla CA if the config
 // field contains a nil RootCAs field.
@@ -179,8 +191,9 @@ func (h *tlsHandshakerConfigurable) Handshake(
 	conn.SetDeadline(time.Now().Add(timeout))
 	if config.RootCAs == nil {
 		config = config.Clone()
-		config.RootCAs = defaultCertPool
+		config.RootCAs = DefaultCertPool()
 	}
+	config = maybeApplyTLSRand(ctx, config)
 	tlsconn := h.newConn(conn, config)
 	if err := tlsconn.HandshakeContext(ctx); err != nil {
 		return nil, tls.ConnectionState{}, err
@@ -188,6 +201,30 @@ func (h *tlsHandshakerConfigurable) Handshake(
 	return tlsconn, tlsconn.ConnectionState(), nil
 }
 
+// tlsRandKey is the context key for the TLS entropy source.
+type tlsRandKey struct{}
+
+// ContextWithTLSRand returns a copy of ctx where the TLS and QUIC handshakes
+// read entropy from rand, unless their tls.Config already sets Rand. Since
+// this setting only affects the operations using the returned context, it
+// allows to record or replay the entropy used by a measurement without
+// touching the TLS sessions with the OONI backend.
+func ContextWithTLSRand(ctx context.Context, rand io.Reader) context.Context {
+	return context.WithValue(ctx, tlsRandKey{}, rand)
+}
+
+// maybeApplyTLSRand returns config or, if ctx contains an entropy source
+// and config.Rand is nil, a copy of config using such entropy source.
+func maybeApplyTLSRand(ctx context.Context, config *tls.Config) *tls.Config {
+	rand, _ := ctx.Value(tlsRandKey{}).(io.Reader)
+	if rand == nil || config.Rand != nil {
+		return config
+	}
+	config = config.Clone()
+	config.Rand = rand
+	return config
+}
+
 // newConn creates a new TLSConn.
 func (h *tlsHandshakerConfigurable) newConn(conn net.Conn, config *tls.Config) TLSConn {
 	if h.NewConn != nil {
@@ -235,6 +235,47 @@ func TestTLSHandshakerConfigurable(t *testing.T) {
 				t.Fatal("gotTLSConfig.RootCAs has not been correctly set")
 			}
 		})
+
+		t.Run("uses the entropy source in the context", func(t *testing.T) {
+			expected := errors.New("mocked error")
+			var gotTLSConfig *tls.Config
+			handshaker := &tlsHandshakerConfigurable{
+				NewConn: func(conn net.Conn, config *tls.Config) TLSConn {
+					gotTLSConfig = config
+					return &mocks.TLSConn{
+						MockHandshakeContext: func(ctx context.Context) error {
+							return expected
+						},
+					}
+				},
+			}
+			conn := &mocks.Conn{
+				MockSetDeadline: func(t time.Time) error {
+					return nil
+				},
+			}
+			rand := strings.NewReader("deterministic")
+			ctx := ContextWithTLSRand(context.Background(), rand)
+			config := &tls.Config{}
+			_, _, err := handshaker.Handshake(ctx, conn, config)
+			if !errors.Is(err, expected) {
+				t.Fatal("not the error we expected", err)
+			}
+			if config.Rand != nil {
+				t.Fatal("config.Rand should still be nil")
+			}
+			if gotTLSConfig.Rand != rand {
+				t.Fatal("gotTLSConfig.Rand has not been correctly set")
+			}
+			other := strings.NewReader("other")
+			_, _, err = handshaker.Handshake(ctx, conn, &tls.Config{Rand: other})
+			if !errors.Is(err, expected) {
+				t.Fatal("not the error we expected", err)
+			}
+			if gotTLSConfig.Rand != other {
+				t.Fatal("we should not override an explicit config.Rand")
+			}
+		})
 	})
 }
 
@@ -0,0 +1,226 @@
+package netxlite
+
+//
+// TLS ClientHello splitting
+//
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+// The TLS ClientHello splitting strategies we support. Some middleboxes
+// only inspect the first segment or the first TLS record, hence splitting
+// the ClientHello may prevent them from seeing the SNI.
+const (
+	// TLSSplitSNISegments sends the SNI using three-bytes TCP segments.
+	TLSSplitSNISegments = "sni_segments"
+
+	// TLSSplit84Rest sends the ClientHello using three TCP segments
+	// containing respectively 8 bytes, 4 bytes, and the rest. This technique
+	// was described by Kevin Bock during the Internet Measurements
+	// Village 2020: https://youtu.be/ksojSRFLbBM?t=1140.
+	TLSSplit84Rest = "8_4_rest"
+
+	// TLSSplitRandom32To64 splits the ClientHello into two TCP segments at
+	// a random offset between 32 and 64 bytes. This is the methodology used
+	// by github.com/Jigsaw-Code/outline-go-tun2socks.
+	TLSSplitRandom32To64 = "random_32_64"
+
+	// TLSSplitRecordFragment splits the ClientHello handshake message into
+	// two TLS records, such that the split occurs in the middle of the SNI,
+	// and sends both records using a single write.
+	TLSSplitRecordFragment = "record_fragment"
+)
+
+// ErrUnknownTLSSplitStrategy indicates that the TLSSplitConfig
+// contains a strategy that we do not support.
+var ErrUnknownTLSSplitStrategy = errors.New("netxlite: unknown TLS split strategy")
+
+// TLSSplitConfig contains the config for splitting the ClientHello.
+type TLSSplitConfig struct {
+	// Strategy is the MANDATORY strategy (one of the TLSSplit constants).
+	Strategy string
+
+	// Delay is the OPTIONAL delay between subsequent writes.
+	Delay time.Duration
+}
+
+// Validate returns ErrUnknownTLSSplitStrategy if the strategy is unknown.
+func (c *TLSSplitConfig) Validate() error {
+	if _, found := tlsSplitters[c.Strategy]; !found {
+		return ErrUnknownTLSSplitStrategy
+	}
+	return nil
+}
+
+// WrapTLSHandshakerSplit wraps a TLSHandshaker such that we split the
+// ClientHello according to the given config. We only modify how we
+// write the ClientHello (including a ClientHello sent again after a
+// HelloRetryRequest), so any other write is left untouched.
+//
+// The SNI we split is the config.ServerName passed to Handshake. If
+// the ServerName is empty, TLSSplitRecordFragment splits in the middle
+// of the ClientHello and TLSSplitSNISegments does not split.
+func WrapTLSHandshakerSplit(th model.TLSHandshaker, config *TLSSplitConfig) model.TLSHandshaker {
+	return &tlsHandshakerSplit{
+		TLSHandshaker: th,
+		Config:        config,
+	}
+}
+
+// tlsHandshakerSplit is the TLSHandshaker splitting the ClientHello.
+type tlsHandshakerSplit struct {
+	// TLSHandshaker is the MANDATORY underlying handshaker.
+	model.TLSHandshaker
+
+	// Config is the MANDATORY splitting config.
+	Config *TLSSplitConfig
+}
+
+var _ model.TLSHandshaker = &tlsHandshakerSplit{}
+
+// Handshake implements model.TLSHandshaker.Handshake.
+func (h *tlsHandshakerSplit) Handshake(
+	ctx context.Context, conn net.Conn, config *tls.Config,
+) (net.Conn, tls.ConnectionState, error) {
+	splitter, found := tlsSplitters[h.Config.Strategy]
+	if !found {
+		return nil, tls.ConnectionState{}, ErrUnknownTLSSplitStrategy
+	}
+	conn = &tlsSplitConn{
+		Conn:     conn,
+		delay:    h.Config.Delay,
+		sni:      []byte(config.ServerName),
+		splitter: splitter,
+	}
+	return h.TLSHandshaker.Handshake(ctx, conn, config)
+}
+
+// tlsSplitConn is the net.Conn splitting the ClientHello.
+type tlsSplitConn struct {
+	net.Conn
+	delay    time.Duration
+	sni      []byte
+	splitter tlsSplitterFunc
+}
+
+// Write implements net.Conn.Write.
+func (c *tlsSplitConn) Write(b []byte) (int, error) {
+	if !tlsSplitIsClientHello(b) {
+		return c.Conn.Write(b)
+	}
+	for idx, data := range c.splitter(b, c.sni) {
+		if len(data) <= 0 {
+			continue
+		}
+		if idx > 0 && c.delay > 0 {
+			time.Sleep(c.delay)
+		}
+		if _, err := c.Conn.Write(data); err != nil {
+			return 0, err
+		}
+	}
+	// Note: with TLSSplitRecordFragment we write more bytes than
+	// len(b) because of the extra record header, but the caller
+	// wants to know how many bytes of b we have written.
+	return len(b), nil
+}
+
+// tlsSplitterFunc splits the TLS record containing the
+// ClientHello into a list of buffers to write.
+type tlsSplitterFunc func(record, sni []byte) [][]byte
+
+// tlsSplitters maps each strategy to its splitter.
+var tlsSplitters = map[string]tlsSplitterFunc{
+	TLSSplitSNISegments:    tlsSplitSNISegments,
+	TLSSplit84Rest:         tlsSplit84Rest,
+	TLSSplitRandom32To64:   tlsSplitRandom32To64,
+	TLSSplitRecordFragment: tlsSplitRecordFragment,
+}
+
+// tlsSplitIsClientHello returns whether b starts with a
+// handshake record containing a ClientHello.
+func tlsSplitIsClientHello(b []byte) bool {
+	const (
+		contentTypeHandshake     = 22
+		handshakeTypeClientHello = 1
+	)
+	return len(b) > 5 && b[0] == contentTypeHandshake && b[5] == handshakeTypeClientHello
+}
+
+// tlsSplitSNISegments splits the record such that the SNI is sent using
+// segments of three bytes. When the SNI is empty or we cannot find it, we
+// return the whole record as a single buffer.
+func tlsSplitSNISegments(record, sni []byte) (out [][]byte) {
+	idx := bytes.Index(record, sni)
+	if len(sni) <= 0 || idx < 0 {
+		return [][]byte{record}
+	}
+	out = append(out, record[:idx])
+	const segmentsize = 3
+	for off := idx; off < idx+len(sni); off += segmentsize {
+		end := off + segmentsize
+		if end > idx+len(sni) {
+			end = idx + len(sni)
+		}
+		out = append(out, record[off:end])
+	}
+	out = append(out, record[idx+len(sni):])
+	return
+}
+
+// tlsSplit84Rest splits the record into 8 bytes, 4 bytes, and the rest.
+func tlsSplit84Rest(record, sni []byte) [][]byte {
+	if len(record) <= 12 {
+		return [][]byte{record}
+	}
+	return [][]byte{record[:8], record[8:12], record[12:]}
+}
+
+// tlsSplitRandom32To64 splits the record at a random offset between 32 and 64.
+func tlsSplitRandom32To64(record, sni []byte) [][]byte {
+	if len(record) <= 64 {
+		return [][]byte{record}
+	}
+	offset := rand.Intn(32) + 32
+	return [][]byte{record[:offset], record[offset:]}
+}
+
+// tlsSplitRecordFragment splits the handshake message inside the record
+// into two records. The split occurs in the middle of the SNI or in the
+// middle of the message if we cannot find the SNI. When the record is not
+// well formed, we return the whole record as a single buffer.
+func tlsSplitRecordFragment(record, sni []byte) [][]byte {
+	const headersize = 5
+	if len(record) < headersize {
+		return [][]byte{record}
+	}
+	length := int(binary.BigEndian.Uint16(record[3:headersize]))
+	if length < 2 || len(record) != headersize+length {
+		return [][]byte{record}
+	}
+	header, payload := record[:headersize], record[headersize:]
+	offset := length / 2
+	if idx := bytes.Index(payload, sni); len(sni) > 0 && idx >= 0 {
+		offset = idx + (len(sni)+1)/2
+	}
+	if offset >= length {
+		offset = length / 2
+	}
+	out := make([]byte, 0, len(record)+headersize)
+	for _, fragment := range [][]byte{payload[:offset], payload[offset:]} {
+		out = append(out, header[:3]...) // content type and version
+		out = append(out, byte(len(fragment)>>8), byte(len(fragment)))
+		out = append(out, fragment...)
+	}
+	return [][]byte{out}
+}
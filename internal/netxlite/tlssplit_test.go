@@ -0,0 +1,337 @@
+package netxlite
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/model/mocks"
+)
+
+// tlsSplitFakeClientHello returns a fake handshake record
+// containing a ClientHello that includes the given SNI.
+func tlsSplitFakeClientHello(sni string) []byte {
+	payload := append([]byte{1, 0, 0, 0, 0xaa, 0xbb}, sni...)
+	payload = append(payload, 0xcc, 0xdd)
+	record := []byte{22, 3, 1, byte(len(payload) >> 8), byte(len(payload))}
+	return append(record, payload...)
+}
+
+func TestTLSSplitConfig(t *testing.T) {
+	t.Run("Validate", func(t *testing.T) {
+		t.Run("with a known strategy", func(t *testing.T) {
+			config := &TLSSplitConfig{Strategy: TLSSplitRecordFragment}
+			if err := config.Validate(); err != nil {
+				t.Fatal(err)
+			}
+		})
+
+		t.Run("with an unknown strategy", func(t *testing.T) {
+			config := &TLSSplitConfig{Strategy: "antani"}
+			if err := config.Validate(); !errors.Is(err, ErrUnknownTLSSplitStrategy) {
+				t.Fatal("not the error we expected", err)
+			}
+		})
+	})
+}
+
+func TestTLSHandshakerSplit(t *testing.T) {
+	t.Run("WrapTLSHandshakerSplit", func(t *testing.T) {
+		th := &mocks.TLSHandshaker{}
+		config := &TLSSplitConfig{Strategy: TLSSplit84Rest}
+		splitter := WrapTLSHandshakerSplit(th, config).(*tlsHandshakerSplit)
+		if splitter.TLSHandshaker != th {
+			t.Fatal("invalid handshaker")
+		}
+		if splitter.Config != config {
+			t.Fatal("invalid config")
+		}
+	})
+
+	t.Run("Handshake", func(t *testing.T) {
+		t.Run("with an unknown strategy", func(t *testing.T) {
+			th := &tlsHandshakerSplit{Config: &TLSSplitConfig{Strategy: "antani"}}
+			conn, _, err := th.Handshake(context.Background(), &mocks.Conn{}, &tls.Config{})
+			if !errors.Is(err, ErrUnknownTLSSplitStrategy) {
+				t.Fatal("not the error we expected", err)
+			}
+			if conn != nil {
+				t.Fatal("expected nil conn")
+			}
+		})
+
+		t.Run("wraps the conn used by the underlying handshaker", func(t *testing.T) {
+			origConn := &mocks.Conn{}
+			th := &tlsHandshakerSplit{
+				TLSHandshaker: &mocks.TLSHandshaker{
+					MockHandshake: func(ctx context.Context, conn net.Conn,
+						config *tls.Config) (net.Conn, tls.ConnectionState, error) {
+						return conn, tls.ConnectionState{}, nil
+					},
+				},
+				Config: &TLSSplitConfig{Strategy: TLSSplitSNISegments, Delay: time.Second},
+			}
+			config := &tls.Config{ServerName: "dns.google"}
+			conn, _, err := th.Handshake(context.Background(), origConn, config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sconn := conn.(*tlsSplitConn)
+			if sconn.Conn != origConn {
+				t.Fatal("invalid conn")
+			}
+			if sconn.delay != time.Second {
+				t.Fatal("invalid delay")
+			}
+			if string(sconn.sni) != "dns.google" {
+				t.Fatal("invalid sni")
+			}
+		})
+
+		t.Run("works with a real TLS server", func(t *testing.T) {
+			srvr := httptest.NewTLSServer(http.NewServeMux())
+			defer srvr.Close()
+			for strategy := range tlsSplitters {
+				t.Run(strategy, func(t *testing.T) {
+					conn, err := net.Dial("tcp", srvr.Listener.Addr().String())
+					if err != nil {
+						t.Fatal(err)
+					}
+					defer conn.Close()
+					th := WrapTLSHandshakerSplit(
+						NewTLSHandshakerStdlib(log.Log), &TLSSplitConfig{Strategy: strategy})
+					config := &tls.Config{
+						InsecureSkipVerify: true,
+						ServerName:         "www.example.com",
+					}
+					tlsConn, _, err := th.Handshake(context.Background(), conn, config)
+					if err != nil {
+						t.Fatal(err)
+					}
+					tlsConn.Close()
+				})
+			}
+		})
+	})
+}
+
+func TestTLSSplitConn(t *testing.T) {
+	// newConn returns a conn using the given splitter
+	// and the list where we append the writes.
+	newConn := func(splitter tlsSplitterFunc) (*tlsSplitConn, *[][]byte) {
+		var writes [][]byte
+		conn := &tlsSplitConn{
+			Conn: &mocks.Conn{
+				MockWrite: func(b []byte) (int, error) {
+					writes = append(writes, append([]byte{}, b...))
+					return len(b), nil
+				},
+			},
+			sni:      []byte("dns.google"),
+			splitter: splitter,
+		}
+		return conn, &writes
+	}
+
+	t.Run("Write", func(t *testing.T) {
+		t.Run("does not split data other than the ClientHello", func(t *testing.T) {
+			conn, writes := newConn(tlsSplit84Rest)
+			data := []byte{23, 3, 3, 0, 20, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+			count, err := conn.Write(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != len(data) {
+				t.Fatal("unexpected count", count)
+			}
+			if diff := cmp.Diff([][]byte{data}, *writes); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+
+		t.Run("splits the ClientHello", func(t *testing.T) {
+			conn, writes := newConn(tlsSplit84Rest)
+			data := tlsSplitFakeClientHello("dns.google")
+			count, err := conn.Write(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != len(data) {
+				t.Fatal("unexpected count", count)
+			}
+			expected := [][]byte{data[:8], data[8:12], data[12:]}
+			if diff := cmp.Diff(expected, *writes); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+
+		t.Run("returns the number of input bytes when fragmenting records", func(t *testing.T) {
+			conn, writes := newConn(tlsSplitRecordFragment)
+			data := tlsSplitFakeClientHello("dns.google")
+			count, err := conn.Write(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != len(data) {
+				t.Fatal("unexpected count", count)
+			}
+			if len(*writes) != 1 || len((*writes)[0]) != len(data)+5 {
+				t.Fatal("unexpected writes", *writes)
+			}
+		})
+
+		t.Run("sleeps between writes", func(t *testing.T) {
+			conn, _ := newConn(tlsSplit84Rest)
+			conn.delay = 10 * time.Millisecond
+			t0 := time.Now()
+			if _, err := conn.Write(tlsSplitFakeClientHello("dns.google")); err != nil {
+				t.Fatal(err)
+			}
+			if elapsed := time.Since(t0); elapsed < 20*time.Millisecond {
+				t.Fatal("we did not sleep enough", elapsed)
+			}
+		})
+
+		t.Run("handles write errors", func(t *testing.T) {
+			expected := errors.New("mocked error")
+			conn := &tlsSplitConn{
+				Conn: &mocks.Conn{
+					MockWrite: func(b []byte) (int, error) {
+						return 0, expected
+					},
+				},
+				splitter: tlsSplit84Rest,
+			}
+			count, err := conn.Write(tlsSplitFakeClientHello("dns.google"))
+			if !errors.Is(err, expected) {
+				t.Fatal("not the error we expected", err)
+			}
+			if count != 0 {
+				t.Fatal("unexpected count", count)
+			}
+		})
+	})
+}
+
+func TestTLSSplitIsClientHello(t *testing.T) {
+	if !tlsSplitIsClientHello(tlsSplitFakeClientHello("dns.google")) {
+		t.Fatal("expected a ClientHello")
+	}
+	if tlsSplitIsClientHello([]byte{22, 3, 1, 0, 4, 2, 0, 0, 0}) {
+		t.Fatal("a ServerHello is not a ClientHello")
+	}
+	if tlsSplitIsClientHello([]byte{22, 3, 1}) {
+		t.Fatal("a short buffer is not a ClientHello")
+	}
+}
+
+func TestTLSSplitSNISegments(t *testing.T) {
+	t.Run("with the SNI", func(t *testing.T) {
+		data := []byte("abcdns.googlexyz")
+		expected := [][]byte{
+			[]byte("abc"), []byte("dns"), []byte(".go"), []byte("ogl"),
+			[]byte("e"), []byte("xyz"),
+		}
+		if diff := cmp.Diff(expected, tlsSplitSNISegments(data, []byte("dns.google"))); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("without the SNI", func(t *testing.T) {
+		data := []byte("abcxyz")
+		out := tlsSplitSNISegments(data, []byte("dns.google"))
+		if diff := cmp.Diff([][]byte{data}, out); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("with an empty SNI", func(t *testing.T) {
+		data := []byte("abcxyz")
+		if diff := cmp.Diff([][]byte{data}, tlsSplitSNISegments(data, nil)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
+func TestTLSSplit84Rest(t *testing.T) {
+	t.Run("with a short buffer", func(t *testing.T) {
+		data := []byte("0123456789ab")
+		if diff := cmp.Diff([][]byte{data}, tlsSplit84Rest(data, nil)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("with a long buffer", func(t *testing.T) {
+		data := []byte("0123456789abcdef")
+		expected := [][]byte{[]byte("01234567"), []byte("89ab"), []byte("cdef")}
+		if diff := cmp.Diff(expected, tlsSplit84Rest(data, nil)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
+func TestTLSSplitRandom32To64(t *testing.T) {
+	t.Run("with a short buffer", func(t *testing.T) {
+		data := make([]byte, 64)
+		if diff := cmp.Diff([][]byte{data}, tlsSplitRandom32To64(data, nil)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("with a long buffer", func(t *testing.T) {
+		data := make([]byte, 128)
+		for i := 0; i < 100; i++ {
+			out := tlsSplitRandom32To64(data, nil)
+			if len(out) != 2 || len(out[0]) < 32 || len(out[0]) >= 64 {
+				t.Fatal("unexpected split", len(out[0]))
+			}
+		}
+	})
+}
+
+func TestTLSSplitRecordFragment(t *testing.T) {
+	t.Run("splits in the middle of the SNI", func(t *testing.T) {
+		data := tlsSplitFakeClientHello("dns.google")
+		out := tlsSplitRecordFragment(data, []byte("dns.google"))
+		expected := [][]byte{append(
+			append([]byte{22, 3, 1, 0, 11}, data[5:16]...),
+			append([]byte{22, 3, 1, 0, 7}, data[16:]...)...,
+		)}
+		if diff := cmp.Diff(expected, out); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("splits in the middle without the SNI", func(t *testing.T) {
+		data := tlsSplitFakeClientHello("dns.google")
+		out := tlsSplitRecordFragment(data, nil)
+		expected := [][]byte{append(
+			append([]byte{22, 3, 1, 0, 9}, data[5:14]...),
+			append([]byte{22, 3, 1, 0, 9}, data[14:]...)...,
+		)}
+		if diff := cmp.Diff(expected, out); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("with a truncated header", func(t *testing.T) {
+		data := []byte{22, 3, 1}
+		if diff := cmp.Diff([][]byte{data}, tlsSplitRecordFragment(data, nil)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("with an invalid length", func(t *testing.T) {
+		data := []byte{22, 3, 1, 0, 10, 1, 2, 3}
+		if diff := cmp.Diff([][]byte{data}, tlsSplitRecordFragment(data, nil)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
@@ -2,6 +2,7 @@ package netxlite
 
 import (
 	"context"
+	"crypto/x509"
 	"net"
 	"time"
 
@@ -33,3 +34,12 @@ func (*TProxyStdlib) LookupHost(ctx context.Context, domain string) ([]string, e
 func (*TProxyStdlib) NewSimpleDialer(timeout time.Duration) model.SimpleDialer {
 	return &net.Dialer{Timeout: timeout}
 }
+
+// DefaultCertPool returns a new pool containing the Mozilla CA bundle.
+func (*TProxyStdlib) DefaultCertPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	// Assumption: AppendCertsFromPEM cannot fail because we
+	// have a test in certify_test.go that guarantees that
+	pool.AppendCertsFromPEM([]byte(pemcerts))
+	return pool
+}
@@ -28,6 +28,71 @@ func NewTLSHandshakerUTLS(logger model.DebugLogger, id *utls.ClientHelloID) mode
 	}, logger)
 }
 
+// The TLS ClientHello fingerprints we know how to produce. Except for
+// TLSFingerprintGo, we parrot the ClientHello using utls.
+const (
+	// TLSFingerprintChrome parrots a recent version of Chrome.
+	TLSFingerprintChrome = "chrome"
+
+	// TLSFingerprintFirefox parrots a recent version of Firefox.
+	TLSFingerprintFirefox = "firefox"
+
+	// TLSFingerprintIOS parrots a recent version of iOS.
+	TLSFingerprintIOS = "ios"
+
+	// TLSFingerprintRandomized randomizes extensions, ciphersuites, etc.
+	TLSFingerprintRandomized = "randomized"
+
+	// TLSFingerprintGo uses the ClientHello of crypto/tls.
+	TLSFingerprintGo = "go"
+)
+
+// ErrUnknownTLSFingerprint indicates that we do not know
+// how to produce the requested TLS ClientHello fingerprint.
+var ErrUnknownTLSFingerprint = errors.New("netxlite: unknown TLS fingerprint")
+
+// utlsFingerprints maps each fingerprint to the corresponding
+// utls.ClientHelloID. We use nil for crypto/tls.
+var utlsFingerprints = map[string]*utls.ClientHelloID{
+	"":                       nil,
+	TLSFingerprintChrome:     &utls.HelloChrome_Auto,
+	TLSFingerprintFirefox:    &utls.HelloFirefox_Auto,
+	TLSFingerprintIOS:        &utls.HelloIOS_Auto,
+	TLSFingerprintRandomized: &utls.HelloRandomized,
+	TLSFingerprintGo:         nil,
+}
+
+// NewConnForTLSFingerprint returns a factory suitable for the NewConn
+// field of the TLSHandshakerConfigurable that creates connections using
+// the given fingerprint (one of the TLSFingerprint constants). We return
+// a nil factory, which means using crypto/tls, for TLSFingerprintGo and
+// the empty string. We return ErrUnknownTLSFingerprint if we don't know
+// how to produce the requested fingerprint.
+func NewConnForTLSFingerprint(fingerprint string) (func(conn net.Conn, config *tls.Config) TLSConn, error) {
+	id, found := utlsFingerprints[fingerprint]
+	if !found {
+		return nil, ErrUnknownTLSFingerprint
+	}
+	if id == nil {
+		return nil, nil
+	}
+	return newConnUTLS(id), nil
+}
+
+// NewTLSHandshakerFingerprint is like NewTLSHandshakerUTLS except that
+// it takes in input the fingerprint name (one of the TLSFingerprint
+// constants) rather than an utls.ClientHelloID. We use crypto/tls for
+// TLSFingerprintGo and we return ErrUnknownTLSFingerprint if we don't
+// know how to produce the requested fingerprint.
+func NewTLSHandshakerFingerprint(
+	logger model.DebugLogger, fingerprint string) (model.TLSHandshaker, error) {
+	newConn, err := NewConnForTLSFingerprint(fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	return newTLSHandshaker(&tlsHandshakerConfigurable{NewConn: newConn}, logger), nil
+}
+
 // utlsConn implements TLSConn and uses a utls UConn as its underlying connection
 type utlsConn struct {
 	*utls.UConn
@@ -46,6 +111,7 @@ func newConnUTLS(clientHello *utls.ClientHelloID) func(conn net.Conn, config *tl
 			ServerName:                  config.ServerName,
 			InsecureSkipVerify:          config.InsecureSkipVerify,
 			DynamicRecordSizingDisabled: config.DynamicRecordSizingDisabled,
+			Rand:                        config.Rand,
 		}
 		tlsConn := utls.UClient(conn, uConfig, *clientHello)
 		return &utlsConn{UConn: tlsConn}
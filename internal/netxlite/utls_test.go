@@ -2,7 +2,11 @@ package netxlite
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"sync"
 	"testing"
 	"time"
@@ -24,6 +28,103 @@ func TestNewTLSHandshakerUTLS(t *testing.T) {
 	}
 }
 
+func TestNewConnForTLSFingerprint(t *testing.T) {
+	t.Run("with fingerprints using utls", func(t *testing.T) {
+		for _, fp := range []string{
+			TLSFingerprintChrome, TLSFingerprintFirefox,
+			TLSFingerprintIOS, TLSFingerprintRandomized,
+		} {
+			newConn, err := NewConnForTLSFingerprint(fp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if newConn == nil {
+				t.Fatal("expected non-nil NewConn for", fp)
+			}
+		}
+	})
+
+	t.Run("with fingerprints using crypto/tls", func(t *testing.T) {
+		for _, fp := range []string{"", TLSFingerprintGo} {
+			newConn, err := NewConnForTLSFingerprint(fp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if newConn != nil {
+				t.Fatal("expected nil NewConn for", fp)
+			}
+		}
+	})
+
+	t.Run("with an unknown fingerprint", func(t *testing.T) {
+		newConn, err := NewConnForTLSFingerprint("antani")
+		if !errors.Is(err, ErrUnknownTLSFingerprint) {
+			t.Fatal("not the error we expected", err)
+		}
+		if newConn != nil {
+			t.Fatal("expected nil NewConn")
+		}
+	})
+}
+
+func TestNewTLSHandshakerFingerprint(t *testing.T) {
+	t.Run("with a known fingerprint", func(t *testing.T) {
+		th, err := NewTLSHandshakerFingerprint(log.Log, TLSFingerprintFirefox)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logger := th.(*tlsHandshakerLogger)
+		if logger.DebugLogger != log.Log {
+			t.Fatal("invalid logger")
+		}
+		errWrapper := logger.TLSHandshaker.(*tlsHandshakerErrWrapper)
+		configurable := errWrapper.TLSHandshaker.(*tlsHandshakerConfigurable)
+		if configurable.NewConn == nil {
+			t.Fatal("expected non-nil NewConn")
+		}
+	})
+
+	t.Run("with an unknown fingerprint", func(t *testing.T) {
+		th, err := NewTLSHandshakerFingerprint(log.Log, "antani")
+		if !errors.Is(err, ErrUnknownTLSFingerprint) {
+			t.Fatal("not the error we expected", err)
+		}
+		if th != nil {
+			t.Fatal("expected nil handshaker")
+		}
+	})
+
+	t.Run("works with a real TLS server", func(t *testing.T) {
+		srvr := httptest.NewTLSServer(http.NewServeMux())
+		defer srvr.Close()
+		for fp := range utlsFingerprints {
+			t.Run(fp, func(t *testing.T) {
+				conn, err := net.Dial("tcp", srvr.Listener.Addr().String())
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer conn.Close()
+				th, err := NewTLSHandshakerFingerprint(log.Log, fp)
+				if err != nil {
+					t.Fatal(err)
+				}
+				config := &tls.Config{
+					InsecureSkipVerify: true,
+					ServerName:         "www.example.com",
+				}
+				tlsConn, state, err := th.Handshake(context.Background(), conn, config)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer tlsConn.Close()
+				if state.Version == 0 || state.CipherSuite == 0 {
+					t.Fatal("expected to see the negotiated parameters")
+				}
+			})
+		}
+	})
+}
+
 func TestUTLSConn(t *testing.T) {
 	t.Run("Handshake", func(t *testing.T) {
 		t.Run("not interrupted with success", func(t *testing.T) {
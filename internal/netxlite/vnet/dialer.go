@@ -0,0 +1,242 @@
+package vnet
+
+//
+// Dialer and UDP sockets
+//
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+// NewSimpleDialer implements model.UnderlyingNetworkLibrary.NewSimpleDialer.
+func (n *Network) NewSimpleDialer(timeout time.Duration) model.SimpleDialer {
+	return &dialer{network: n, timeout: timeout}
+}
+
+// dialer is the model.SimpleDialer of a Network.
+type dialer struct {
+	// network is the Network.
+	network *Network
+
+	// timeout is the connect timeout.
+	timeout time.Duration
+}
+
+// errTimeout is the error returned when a connect times out. We
+// use the same string of the stdlib so netxlite maps this error
+// to the generic_timeout_error failure.
+var errTimeout = errors.New("i/o timeout")
+
+// DialContext behaves like net.Dialer.DialContext. We route loopback
+// addresses to the real network. We route all the other addresses to
+// the corresponding servers. Connecting to a host that does not serve
+// the given port fails with ECONNREFUSED, while connecting to an unknown
+// address or losing the connection attempt fails with a timeout.
+func (d *dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		addrs, err := d.network.LookupHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		ip = net.ParseIP(addrs[0])
+	}
+	if ip.IsLoopback() {
+		child := &net.Dialer{Timeout: d.timeout}
+		return child.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+	}
+	portnum, err := strconv.Atoi(port)
+	if err != nil {
+		return nil, err
+	}
+	proto := "tcp"
+	if strings.HasPrefix(network, "udp") {
+		proto = "udp"
+	}
+	realAddr, found := d.network.routes[endpoint(ip.String(), portnum, proto)]
+	if proto == "tcp" {
+		if err := d.network.sleep(ctx, d.network.config.RTT); err != nil {
+			return nil, err
+		}
+		if !d.network.hosts[ip.String()] || d.network.lose() {
+			return nil, d.waitTimeout(ctx)
+		}
+		if !found {
+			return nil, netxlite.ECONNREFUSED
+		}
+	}
+	if !found {
+		// Like the stdlib, we do not fail when we cannot reach the
+		// destination of a connected UDP socket. We use an unconnected
+		// socket from which we never read anything.
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			return nil, err
+		}
+		return &udpConn{Conn: conn, network: d.network, remote: &net.UDPAddr{IP: ip, Port: portnum}}, nil
+	}
+	child := &net.Dialer{Timeout: d.timeout}
+	conn, err := child.DialContext(ctx, proto, realAddr)
+	if err != nil {
+		return nil, err
+	}
+	if proto == "udp" {
+		return &udpConn{
+			Conn:    conn,
+			network: d.network,
+			remote:  &net.UDPAddr{IP: ip, Port: portnum},
+			routed:  found,
+		}, nil
+	}
+	return &tcpConn{
+		Conn:    conn,
+		network: d.network,
+		remote:  &net.TCPAddr{IP: ip, Port: portnum},
+	}, nil
+}
+
+// waitTimeout waits for the connect timeout to expire.
+func (d *dialer) waitTimeout(ctx context.Context) error {
+	if d.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.timeout)
+		defer cancel()
+	}
+	<-ctx.Done()
+	return errTimeout
+}
+
+// tcpConn is a TCP conn connected to a host.
+type tcpConn struct {
+	// Conn is the real conn.
+	net.Conn
+
+	// network is the Network.
+	network *Network
+
+	// remote is the virtual remote address.
+	remote net.Addr
+}
+
+// RemoteAddr implements net.Conn.RemoteAddr.
+func (c *tcpConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// Write implements net.Conn.Write by delaying the data.
+func (c *tcpConn) Write(b []byte) (int, error) {
+	time.Sleep(c.network.config.RTT / 2)
+	return c.Conn.Write(b)
+}
+
+// udpConn is a connected UDP socket.
+type udpConn struct {
+	// Conn is the real conn.
+	net.Conn
+
+	// network is the Network.
+	network *Network
+
+	// remote is the virtual remote address.
+	remote net.Addr
+
+	// routed indicates whether the destination exists.
+	routed bool
+}
+
+// RemoteAddr implements net.Conn.RemoteAddr.
+func (c *udpConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// Write implements net.Conn.Write by delaying or losing the datagram.
+func (c *udpConn) Write(b []byte) (int, error) {
+	if !c.routed || c.network.lose() {
+		return len(b), nil
+	}
+	data := append([]byte{}, b...) // the caller may reuse b
+	c.network.delay(func() {
+		c.Conn.Write(data)
+	})
+	return len(b), nil
+}
+
+// delay runs f after half of the RTT without blocking the caller.
+func (n *Network) delay(f func()) {
+	if n.config.RTT <= 0 {
+		f()
+		return
+	}
+	time.AfterFunc(n.config.RTT/2, f)
+}
+
+// ListenUDP implements model.UnderlyingNetworkLibrary.ListenUDP. The
+// returned socket translates between virtual and real addresses.
+func (n *Network) ListenUDP(network string, laddr *net.UDPAddr) (model.UDPLikeConn, error) {
+	pconn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return nil, err
+	}
+	return &udpLikeConn{UDPLikeConn: pconn, network: n}, nil
+}
+
+// udpLikeConn is an unconnected UDP socket.
+type udpLikeConn struct {
+	// UDPLikeConn is the real socket.
+	model.UDPLikeConn
+
+	// network is the Network.
+	network *Network
+}
+
+// WriteTo implements model.UDPLikeConn.WriteTo by routing the datagram
+// to the real address of the destination and possibly delaying or
+// losing the datagram. Like the stdlib, we silently drop the datagrams
+// directed to unknown destinations.
+func (c *udpLikeConn) WriteTo(pkt []byte, addr net.Addr) (int, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr.String())
+	if err != nil {
+		return 0, err
+	}
+	if udpAddr.IP.IsLoopback() {
+		return c.UDPLikeConn.WriteTo(pkt, udpAddr)
+	}
+	realAddr, found := c.network.routes[endpoint(udpAddr.IP.String(), udpAddr.Port, "udp")]
+	if !found || c.network.lose() {
+		return len(pkt), nil
+	}
+	dest, err := net.ResolveUDPAddr("udp", realAddr)
+	if err != nil {
+		return 0, err
+	}
+	data := append([]byte{}, pkt...) // the caller may reuse pkt
+	c.network.delay(func() {
+		c.UDPLikeConn.WriteTo(data, dest)
+	})
+	return len(pkt), nil
+}
+
+// ReadFrom implements model.UDPLikeConn.ReadFrom by translating the
+// real address of the sender to the corresponding virtual address.
+func (c *udpLikeConn) ReadFrom(pkt []byte) (int, net.Addr, error) {
+	count, addr, err := c.UDPLikeConn.ReadFrom(pkt)
+	if err != nil {
+		return 0, nil, err
+	}
+	if virtual := c.network.reverse[addr.String()]; virtual != nil {
+		addr = virtual
+	}
+	return count, addr, nil
+}
@@ -0,0 +1,202 @@
+package vnet
+
+//
+// Servers running on the hosts
+//
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/http3"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+	"github.com/ooni/probe-cli/v3/internal/netxlite/filtering"
+)
+
+// startHost starts the servers of the given host.
+func (n *Network) startHost(host *Host) error {
+	if host.DNS {
+		if err := n.startDNS(host); err != nil {
+			return err
+		}
+	}
+	if host.Handler != nil {
+		for _, port := range host.httpPorts() {
+			if err := n.startHTTP(host, port); err != nil {
+				return err
+			}
+		}
+	}
+	handler := n.httpsHandler(host)
+	if handler == nil {
+		return nil
+	}
+	for _, port := range host.httpsPorts() {
+		if err := n.startHTTPS(host, port, handler); err != nil {
+			return err
+		}
+		if err := n.startHTTP3(host, port, handler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// httpsHandler returns the handler serving HTTPS and HTTP/3 for
+// the given host or nil if the host does not serve HTTPS.
+func (n *Network) httpsHandler(host *Host) http.Handler {
+	if !host.DNS {
+		return host.Handler
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/dns-query", &dohHandler{network: n, host: host})
+	if host.Handler != nil {
+		mux.Handle("/", host.Handler)
+	}
+	return mux
+}
+
+// startHTTP starts serving cleartext HTTP on the given port.
+func (n *Network) startHTTP(host *Host, port int) error {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: host.Handler}
+	go server.Serve(listener)
+	n.closers = append(n.closers, server)
+	return n.addRoute(host, port, "tcp", listener.Addr())
+}
+
+// startHTTPS starts serving HTTPS on the given port.
+func (n *Network) startHTTPS(host *Host, port int, handler http.Handler) error {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: handler, TLSConfig: n.tlsConfig(host)}
+	go server.ServeTLS(listener, "", "")
+	n.closers = append(n.closers, server)
+	return n.addRoute(host, port, "tcp", listener.Addr())
+}
+
+// startHTTP3 starts serving HTTP/3 on the given port.
+func (n *Network) startHTTP3(host *Host, port int, handler http.Handler) error {
+	pconn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	server := &http3.Server{
+		Server: &http.Server{Handler: handler, TLSConfig: n.tlsConfig(host)},
+	}
+	go server.Serve(pconn)
+	n.closers = append(n.closers, server, pconn)
+	return n.addRoute(host, port, "udp", pconn.LocalAddr())
+}
+
+// startDNS starts serving DNS over UDP and TCP on port 53 using a
+// filtering.DNSProxy answering from the records of the network, and
+// DNS-over-TLS on port 853 by forwarding queries to such a proxy.
+func (n *Network) startDNS(host *Host) error {
+	proxy := &filtering.DNSProxy{
+		Cache: n.dnsCache(),
+		OnQuery: func(domain string) filtering.DNSAction {
+			return filtering.DNSActionCache
+		},
+	}
+	dnsListener, err := proxy.Start("127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	n.closers = append(n.closers, dnsListener)
+	if err := n.addRoute(host, 53, "udp", dnsListener.LocalAddr()); err != nil {
+		return err
+	}
+	if err := n.addRoute(host, 53, "tcp", dnsListener.LocalAddr()); err != nil {
+		return err
+	}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", n.tlsConfig(host))
+	if err != nil {
+		return err
+	}
+	n.closers = append(n.closers, listener)
+	go n.serveDoT(listener, dnsListener.LocalAddr().String())
+	return n.addRoute(host, 853, "tcp", listener.Addr())
+}
+
+// serveDoT forwards each DNS-over-TLS conn to the DNS-over-TCP server
+// listening at the given address. Both use the same framing.
+func (n *Network) serveDoT(listener net.Listener, address string) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			upstream, err := net.Dial("tcp", address)
+			if err != nil {
+				return
+			}
+			defer upstream.Close()
+			go io.Copy(upstream, conn)
+			io.Copy(conn, upstream)
+		}()
+	}
+}
+
+// dohHandler serves DNS-over-HTTPS by forwarding each query to the
+// DNS server of the host using DNS over UDP.
+type dohHandler struct {
+	network *Network
+	host    *Host
+}
+
+// dohMaxQuerySize is the maximum size of a DNS-over-HTTPS query.
+const dohMaxQuerySize = 1 << 16
+
+// ServeHTTP implements http.Handler.
+func (h *dohHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" || r.Header.Get("content-type") != "application/dns-message" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	query, err := netxlite.ReadAllContext(r.Context(), io.LimitReader(r.Body, dohMaxQuerySize))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	reply, err := h.exchange(query)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("content-type", "application/dns-message")
+	w.Write(reply)
+}
+
+// dohExchangeTimeout is the timeout of a DNS-over-UDP exchange.
+const dohExchangeTimeout = 4 * time.Second
+
+// exchange sends the query to the DNS server and returns the reply.
+func (h *dohHandler) exchange(query []byte) ([]byte, error) {
+	address := h.network.routes[endpoint(net.ParseIP(h.host.Addresses[0]).String(), 53, "udp")]
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(dohExchangeTimeout))
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buffer := make([]byte, dohMaxQuerySize)
+	count, err := conn.Read(buffer)
+	if err != nil {
+		return nil, err
+	}
+	return buffer[:count], nil
+}
@@ -0,0 +1,291 @@
+// Package vnet implements an in-process virtual network for running
+// experiments in integration tests without touching the internet.
+//
+// The top-level struct is the Network. It implements model's
+// UnderlyingNetworkLibrary interface. Therefore, you can replace
+// netxlite.TProxy with a Network to route all the traffic generated
+// by netxlite (and hence by OONI experiments) to simulated hosts.
+//
+// Each Host has one or more virtual IP addresses and domain names and
+// may run HTTP, HTTPS, HTTP/3 and DNS (including DoT and DoH) servers
+// using certificates issued by the CA of the Network. We implement each
+// server using a real listener bound to 127.0.0.1 and a routing table
+// mapping virtual endpoints to real endpoints. The Network also allows
+// to simulate latency and packet loss.
+//
+// This setup gives you an uncensored world. To obtain a censored world,
+// use filtering.NewTProxyWithUnderlyingNetwork to wrap the Network with a
+// TProxy and replace netxlite.TProxy with the TProxy. The TProxy will
+// apply its censorship policies and will otherwise route the traffic
+// through the Network.
+package vnet
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite/filtering"
+)
+
+// Config contains the configuration of a Network.
+type Config struct {
+	// Hosts contains the hosts of the network.
+	Hosts []*Host
+
+	// Loss is the OPTIONAL probability between zero and one that
+	// we lose a UDP datagram or a TCP connection attempt. We do
+	// not simulate TCP retransmissions, hence a lost connection
+	// attempt fails with a timeout like a dropped SYN segment.
+	Loss float64
+
+	// RTT is the OPTIONAL round trip time between the client and
+	// the hosts. We delay the connect and each LookupHost by RTT
+	// and each write by half of the RTT.
+	RTT time.Duration
+
+	// Seed is the OPTIONAL seed of the generator deciding which
+	// datagrams and connection attempts we lose.
+	Seed int64
+}
+
+// Host is a host of the network.
+type Host struct {
+	// Addresses contains the MANDATORY virtual IP addresses of
+	// the host. They must not be loopback addresses, since the
+	// Network routes loopback traffic to the real network.
+	Addresses []string
+
+	// Domains contains the OPTIONAL domain names of the host. The
+	// DNS servers of the Network and LookupHost map each name to
+	// the Addresses of the host.
+	Domains []string
+
+	// Handler is the OPTIONAL handler serving HTTP requests. When
+	// it is not nil, the host serves cleartext HTTP on HTTPPorts and
+	// HTTPS and HTTP/3 on HTTPSPorts.
+	Handler http.Handler
+
+	// HTTPPorts contains the ports where the host serves cleartext
+	// HTTP. If nil, we use port 80.
+	HTTPPorts []int
+
+	// HTTPSPorts contains the ports where the host serves HTTPS over
+	// TCP and HTTP/3 over UDP. If nil, we use port 443.
+	HTTPSPorts []int
+
+	// DNS indicates that the host is a DNS server. If true, the host
+	// serves DNS on port 53 over UDP and TCP, DNS-over-TLS on port 853
+	// and DNS-over-HTTPS at /dns-query on HTTPSPorts.
+	DNS bool
+}
+
+// httpPorts returns the ports serving cleartext HTTP.
+func (h *Host) httpPorts() []int {
+	if h.HTTPPorts == nil {
+		return []int{80}
+	}
+	return h.HTTPPorts
+}
+
+// httpsPorts returns the ports serving HTTPS and HTTP/3.
+func (h *Host) httpsPorts() []int {
+	if h.HTTPSPorts == nil {
+		return []int{443}
+	}
+	return h.HTTPSPorts
+}
+
+// Network is an in-process virtual network.
+type Network struct {
+	// ca is the CA issuing the certificates of the hosts.
+	ca *filtering.CA
+
+	// closers contains the servers to close.
+	closers []io.Closer
+
+	// config is the network config.
+	config *Config
+
+	// hosts contains the virtual IP addresses of the hosts.
+	hosts map[string]bool
+
+	// mu provides mutual exclusion for rng.
+	mu sync.Mutex
+
+	// records maps canonical domain names to IP addresses.
+	records map[string][]string
+
+	// reverse maps the real UDP endpoints to the virtual ones.
+	reverse map[string]*net.UDPAddr
+
+	// rng is the generator deciding which packets we lose.
+	rng *rand.Rand
+
+	// routes maps virtual endpoints (e.g., `8.8.8.8:53/udp`) to
+	// the real addresses of the corresponding servers.
+	routes map[string]string
+}
+
+var _ model.UnderlyingNetworkLibrary = &Network{}
+
+// ErrInvalidAddress indicates that a host address is not valid.
+var ErrInvalidAddress = errors.New("vnet: invalid host address")
+
+// NewNetwork creates a new Network and starts the servers of its
+// hosts. You must call Close when done using the Network.
+func NewNetwork(config *Config) (*Network, error) {
+	ca, err := filtering.NewCA()
+	if err != nil {
+		return nil, err
+	}
+	n := &Network{
+		ca:      ca,
+		config:  config,
+		hosts:   map[string]bool{},
+		records: map[string][]string{},
+		reverse: map[string]*net.UDPAddr{},
+		rng:     rand.New(rand.NewSource(config.Seed)),
+		routes:  map[string]string{},
+	}
+	for _, host := range config.Hosts {
+		for _, addr := range host.Addresses {
+			ip := net.ParseIP(addr)
+			if ip == nil || ip.IsLoopback() {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidAddress, addr)
+			}
+			n.hosts[ip.String()] = true
+		}
+		for _, domain := range host.Domains {
+			name := canonicalName(domain)
+			n.records[name] = append(n.records[name], host.Addresses...)
+		}
+	}
+	for _, host := range config.Hosts {
+		if err := n.startHost(host); err != nil {
+			n.Close()
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// canonicalName returns the name we use as key of the records.
+func canonicalName(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(domain), ".")
+}
+
+// CA returns the CA issuing the certificates of the hosts.
+func (n *Network) CA() *filtering.CA {
+	return n.ca
+}
+
+// Close stops the servers of the hosts.
+func (n *Network) Close() error {
+	for _, closer := range n.closers {
+		closer.Close()
+	}
+	return nil
+}
+
+// DefaultCertPool implements model.UnderlyingNetworkLibrary.DefaultCertPool
+// by returning a pool containing only the CA of the Network.
+func (n *Network) DefaultCertPool() *x509.CertPool {
+	return n.ca.CertPool()
+}
+
+// LookupHost implements model.UnderlyingNetworkLibrary.LookupHost
+// using the domain names of the hosts.
+func (n *Network) LookupHost(ctx context.Context, domain string) ([]string, error) {
+	if err := n.sleep(ctx, n.config.RTT); err != nil {
+		return nil, err
+	}
+	if net.ParseIP(domain) != nil {
+		return []string{domain}, nil
+	}
+	addrs := n.records[canonicalName(domain)]
+	if len(addrs) <= 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: domain, IsNotFound: true}
+	}
+	return append([]string{}, addrs...), nil
+}
+
+// dnsCache returns the DNS records in the format used by filtering.DNSProxy.
+func (n *Network) dnsCache() map[string][]string {
+	out := map[string][]string{}
+	for name, addrs := range n.records {
+		out[dns.Fqdn(name)] = addrs
+	}
+	return out
+}
+
+// lose returns whether we should lose the current packet.
+func (n *Network) lose() bool {
+	if n.config.Loss <= 0 {
+		return false
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.rng.Float64() < n.config.Loss
+}
+
+// sleep sleeps for the given duration unless the context is done first.
+func (n *Network) sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// endpoint returns the key of routes for the given address and network.
+func endpoint(ip string, port int, network string) string {
+	return fmt.Sprintf("%s/%s", net.JoinHostPort(ip, fmt.Sprint(port)), network)
+}
+
+// addRoute routes the given virtual port of the host to the given real address.
+func (n *Network) addRoute(host *Host, port int, network string, addr net.Addr) error {
+	for _, ip := range host.Addresses {
+		key := endpoint(net.ParseIP(ip).String(), port, network)
+		if _, found := n.routes[key]; found {
+			return fmt.Errorf("vnet: duplicate endpoint: %s", key)
+		}
+		n.routes[key] = addr.String()
+		if network == "udp" {
+			n.reverse[addr.String()] = &net.UDPAddr{IP: net.ParseIP(ip), Port: port}
+		}
+	}
+	return nil
+}
+
+// tlsConfig returns the TLS config used by the servers of the given
+// host. When the client does not send the SNI, we use a certificate
+// for the first address of the host.
+func (n *Network) tlsConfig(host *Host) *tls.Config {
+	return &tls.Config{
+		GetCertificate: func(info *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			name := info.ServerName
+			if name == "" {
+				name = host.Addresses[0]
+			}
+			return n.ca.NewCertificate(name)
+		},
+	}
+}
@@ -0,0 +1,404 @@
+package vnet
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+	"github.com/ooni/probe-cli/v3/internal/netxlite/filtering"
+)
+
+// newTestingConfig returns the config of the network we use for testing.
+func newTestingConfig() *Config {
+	return &Config{
+		Hosts: []*Host{{
+			Addresses: []string{"8.8.8.8", "2001:4860:4860::8888"},
+			Domains:   []string{"dns.google"},
+			DNS:       true,
+		}, {
+			Addresses: []string{"93.184.216.34"},
+			Domains:   []string{"example.com", "www.example.com"},
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("Example Domain"))
+			}),
+		}},
+	}
+}
+
+// withNetwork runs f after replacing netxlite.TProxy with a network
+// created using the given config.
+func withNetwork(t *testing.T, config *Config, f func(n *Network)) {
+	n, err := NewNetwork(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+	netxlite.TProxy = n
+	defer func() {
+		netxlite.TProxy = &netxlite.TProxyStdlib{}
+	}()
+	f(n)
+}
+
+// httpGet fetches the body at the given URL using netxlite.
+func httpGet(ctx context.Context, URL string) (string, error) {
+	txp := netxlite.NewHTTPTransportStdlib(log.Log)
+	defer txp.CloseIdleConnections()
+	return httpGetWithTransport(ctx, txp, URL)
+}
+
+// httpGetWithTransport is like httpGet but uses the given transport.
+func httpGetWithTransport(ctx context.Context, txp model.HTTPTransport, URL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", URL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := txp.RoundTrip(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := netxlite.ReadAllContext(ctx, resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func TestNewNetwork(t *testing.T) {
+	t.Run("with invalid address", func(t *testing.T) {
+		n, err := NewNetwork(&Config{Hosts: []*Host{{Addresses: []string{"antani"}}}})
+		if !errors.Is(err, ErrInvalidAddress) {
+			t.Fatal("unexpected err", err)
+		}
+		if n != nil {
+			t.Fatal("expected nil network")
+		}
+	})
+
+	t.Run("with loopback address", func(t *testing.T) {
+		n, err := NewNetwork(&Config{Hosts: []*Host{{Addresses: []string{"127.0.0.1"}}}})
+		if !errors.Is(err, ErrInvalidAddress) {
+			t.Fatal("unexpected err", err)
+		}
+		if n != nil {
+			t.Fatal("expected nil network")
+		}
+	})
+
+	t.Run("with duplicate endpoint", func(t *testing.T) {
+		handler := http.NotFoundHandler()
+		n, err := NewNetwork(&Config{Hosts: []*Host{{
+			Addresses: []string{"10.0.0.1"},
+			Handler:   handler,
+		}, {
+			Addresses: []string{"10.0.0.1"},
+			Handler:   handler,
+		}}})
+		if err == nil || err.Error() != "vnet: duplicate endpoint: 10.0.0.1:80/tcp" {
+			t.Fatal("unexpected err", err)
+		}
+		if n != nil {
+			t.Fatal("expected nil network")
+		}
+	})
+}
+
+func TestLookupHost(t *testing.T) {
+	withNetwork(t, newTestingConfig(), func(n *Network) {
+		ctx := context.Background()
+
+		t.Run("with existing domain", func(t *testing.T) {
+			addrs, err := n.LookupHost(ctx, "WWW.example.com.")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff([]string{"93.184.216.34"}, addrs); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+
+		t.Run("with IP address", func(t *testing.T) {
+			addrs, err := n.LookupHost(ctx, "1.1.1.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff([]string{"1.1.1.1"}, addrs); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+
+		t.Run("with nonexistent domain using netxlite", func(t *testing.T) {
+			reso := netxlite.NewResolverStdlib(log.Log)
+			addrs, err := reso.LookupHost(ctx, "antani.example.com")
+			if err == nil || err.Error() != netxlite.FailureDNSNXDOMAINError {
+				t.Fatal("unexpected err", err)
+			}
+			if len(addrs) != 0 {
+				t.Fatal("expected no addrs")
+			}
+		})
+	})
+}
+
+func TestDNSServers(t *testing.T) {
+	withNetwork(t, newTestingConfig(), func(n *Network) {
+		dialer := netxlite.NewDialerWithoutResolver(log.Log)
+		resolvers := map[string]model.Resolver{
+			"udp": netxlite.NewResolverUDP(log.Log, dialer, "8.8.8.8:53"),
+			"tcp": netxlite.WrapResolver(log.Log, netxlite.NewSerialResolver(
+				netxlite.NewDNSOverTCP(dialer.DialContext, "8.8.8.8:53"))),
+			"udp6": netxlite.NewResolverUDP(log.Log, dialer, "[2001:4860:4860::8888]:53"),
+			"dot": netxlite.WrapResolver(log.Log, netxlite.NewSerialResolver(
+				netxlite.NewDNSOverTLS(netxlite.NewTLSDialer(
+					dialer, netxlite.NewTLSHandshakerStdlib(log.Log)).DialTLSContext,
+					"8.8.8.8:853"))),
+			"doh": netxlite.WrapResolver(log.Log, netxlite.NewSerialResolver(
+				netxlite.NewDNSOverHTTPS(&http.Client{
+					Transport: netxlite.NewHTTPTransportStdlib(log.Log),
+				}, "https://dns.google/dns-query"))),
+		}
+		for name, reso := range resolvers {
+			t.Run(name, func(t *testing.T) {
+				defer reso.CloseIdleConnections()
+				addrs, err := reso.LookupHost(context.Background(), "example.com")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff([]string{"93.184.216.34"}, addrs); diff != "" {
+					t.Fatal(diff)
+				}
+			})
+		}
+	})
+}
+
+func TestHTTPServers(t *testing.T) {
+	withNetwork(t, newTestingConfig(), func(n *Network) {
+		ctx := context.Background()
+
+		for _, URL := range []string{"http://example.com/", "https://www.example.com/"} {
+			t.Run(URL, func(t *testing.T) {
+				body, err := httpGet(ctx, URL)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if body != "Example Domain" {
+					t.Fatal("unexpected body", body)
+				}
+			})
+		}
+
+		t.Run("HTTP/3", func(t *testing.T) {
+			reso := netxlite.NewResolverStdlib(log.Log)
+			dialer := netxlite.NewQUICDialerWithResolver(netxlite.NewQUICListener(), log.Log, reso)
+			txp := netxlite.NewHTTP3Transport(log.Log, dialer, &tls.Config{})
+			defer txp.CloseIdleConnections()
+			body, err := httpGetWithTransport(ctx, txp, "https://example.com/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if body != "Example Domain" {
+				t.Fatal("unexpected body", body)
+			}
+		})
+
+		t.Run("the certificates are not valid with the Mozilla CA bundle", func(t *testing.T) {
+			dialer := netxlite.NewDialerWithoutResolver(log.Log)
+			conn, err := dialer.DialContext(ctx, "tcp", "93.184.216.34:443")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			handshaker := netxlite.NewTLSHandshakerStdlib(log.Log)
+			_, _, err = handshaker.Handshake(ctx, conn, &tls.Config{
+				ServerName: "example.com",
+				RootCAs:    (&netxlite.TProxyStdlib{}).DefaultCertPool(),
+			})
+			if err == nil || err.Error() != netxlite.FailureSSLUnknownAuthority {
+				t.Fatal("unexpected err", err)
+			}
+		})
+	})
+}
+
+func TestDialer(t *testing.T) {
+	withNetwork(t, newTestingConfig(), func(n *Network) {
+		ctx := context.Background()
+
+		t.Run("the remote address is the virtual address", func(t *testing.T) {
+			conn, err := n.NewSimpleDialer(time.Second).DialContext(ctx, "tcp", "93.184.216.34:80")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			if conn.RemoteAddr().String() != "93.184.216.34:80" {
+				t.Fatal("unexpected remote address", conn.RemoteAddr())
+			}
+		})
+
+		t.Run("with closed port", func(t *testing.T) {
+			dialer := netxlite.NewDialerWithoutResolver(log.Log)
+			conn, err := dialer.DialContext(ctx, "tcp", "93.184.216.34:22")
+			if err == nil || err.Error() != netxlite.FailureConnectionRefused {
+				t.Fatal("unexpected err", err)
+			}
+			if conn != nil {
+				t.Fatal("expected nil conn")
+			}
+		})
+
+		t.Run("with unknown address", func(t *testing.T) {
+			conn, err := n.NewSimpleDialer(100*time.Millisecond).DialContext(ctx, "tcp", "10.0.0.1:80")
+			if !errors.Is(err, errTimeout) {
+				t.Fatal("unexpected err", err)
+			}
+			if conn != nil {
+				t.Fatal("expected nil conn")
+			}
+		})
+
+		t.Run("with loopback address", func(t *testing.T) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer listener.Close()
+			conn, err := n.NewSimpleDialer(time.Second).DialContext(ctx, "tcp", listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn.Close()
+		})
+	})
+}
+
+func TestLatencyAndLoss(t *testing.T) {
+	t.Run("with latency", func(t *testing.T) {
+		config := newTestingConfig()
+		config.RTT = 100 * time.Millisecond
+		withNetwork(t, config, func(n *Network) {
+			t0 := time.Now()
+			conn, err := n.NewSimpleDialer(time.Second).DialContext(
+				context.Background(), "tcp", "93.184.216.34:80")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			if elapsed := time.Since(t0); elapsed < config.RTT {
+				t.Fatal("connect took less than the RTT", elapsed)
+			}
+		})
+	})
+
+	t.Run("with total loss", func(t *testing.T) {
+		config := newTestingConfig()
+		config.Loss = 1
+		withNetwork(t, config, func(n *Network) {
+			conn, err := n.NewSimpleDialer(100*time.Millisecond).DialContext(
+				context.Background(), "tcp", "93.184.216.34:80")
+			if !errors.Is(err, errTimeout) {
+				t.Fatal("unexpected err", err)
+			}
+			if conn != nil {
+				t.Fatal("expected nil conn")
+			}
+		})
+	})
+}
+
+func TestCensoredNetwork(t *testing.T) {
+	n, err := NewNetwork(newTestingConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+	proxy, err := filtering.NewTProxyWithUnderlyingNetwork(&filtering.TProxyConfig{
+		Domains: map[string]filtering.DNSAction{
+			"www.example.com.": filtering.DNSActionNXDOMAIN,
+		},
+		Endpoints: map[string]filtering.TProxyPolicy{
+			"93.184.216.34:443/tcp": filtering.TProxyPolicyHijackTLS,
+		},
+		SNIs: map[string]filtering.TLSAction{
+			"example.com": filtering.TLSActionReset,
+		},
+	}, log.Log, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.Close()
+	netxlite.TProxy = proxy
+	defer func() {
+		netxlite.TProxy = &netxlite.TProxyStdlib{}
+	}()
+	ctx := context.Background()
+
+	t.Run("DNS censorship", func(t *testing.T) {
+		reso := netxlite.NewResolverStdlib(log.Log)
+		_, err := reso.LookupHost(ctx, "www.example.com")
+		if err == nil || err.Error() != netxlite.FailureDNSNXDOMAINError {
+			t.Fatal("unexpected err", err)
+		}
+	})
+
+	t.Run("DNS passing through", func(t *testing.T) {
+		reso := netxlite.NewResolverStdlib(log.Log)
+		addrs, err := reso.LookupHost(ctx, "example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"93.184.216.34"}, addrs); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("TLS censorship", func(t *testing.T) {
+		_, err := httpGet(ctx, "https://example.com/")
+		if err == nil || err.Error() != netxlite.FailureConnectionReset {
+			t.Fatal("unexpected err", err)
+		}
+	})
+
+	t.Run("TLS passing through", func(t *testing.T) {
+		dialer := netxlite.NewDialerWithoutResolver(log.Log)
+		conn, err := dialer.DialContext(ctx, "tcp", "93.184.216.34:443")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		handshaker := netxlite.NewTLSHandshakerStdlib(log.Log)
+		tlsConn, _, err := handshaker.Handshake(ctx, conn, &tls.Config{
+			ServerName: "www.example.com",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tlsConn.Close()
+	})
+
+	t.Run("HTTP passing through", func(t *testing.T) {
+		body, err := httpGet(ctx, "http://example.com/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if body != "Example Domain" {
+			t.Fatal("unexpected body", body)
+		}
+	})
+
+	t.Run("the TProxy uses the CA of the network", func(t *testing.T) {
+		pool := netxlite.NewDefaultCertPool()
+		if diff := cmp.Diff(n.DefaultCertPool().Subjects(), pool.Subjects()); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}